@@ -75,6 +75,7 @@ func main() {
 		os.Exit(1)
 	}
 	server.OptionallyStartInformers(ctx)
+	server.SelfCheck(ctx)
 	if err := server.Run(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v", err) // nolint: errcheck
 		os.Exit(1)
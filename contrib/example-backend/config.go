@@ -17,15 +17,18 @@ limitations under the License.
 package backend
 
 import (
+	htmltemplate "html/template"
 	"time"
 
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	apiextensionsinformers "k8s.io/apiextensions-apiserver/pkg/client/informers/externalversions"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	kubeinformers "k8s.io/client-go/informers"
 	kubernetesclient "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
+	examplehttp "github.com/kube-bind/kube-bind/contrib/example-backend/http"
 	"github.com/kube-bind/kube-bind/contrib/example-backend/options"
 	bindclient "github.com/kube-bind/kube-bind/pkg/client/clientset/versioned"
 	bindinformers "github.com/kube-bind/kube-bind/pkg/client/informers/externalversions"
@@ -42,6 +45,19 @@ type Config struct {
 	KubeInformers          kubeinformers.SharedInformerFactory
 	BindInformers          bindinformers.SharedInformerFactory
 	ApiextensionsInformers apiextensionsinformers.SharedInformerFactory
+
+	// NamespacedInformers are the informers of namespaced objects, watching the
+	// informer namespaces only if there are any.
+	NamespacedInformers NamespacedInformers
+
+	// Entitlement optionally restricts the resources offered to and bound by a user.
+	Entitlement examplehttp.EntitlementFunc
+
+	// Authorizer optionally approves or denies binds. Nil allows all binds.
+	Authorizer examplehttp.Authorizer
+
+	// TemplateFuncs are added to the functions of the resources template, see examplehttp.TemplateFuncs.
+	TemplateFuncs htmltemplate.FuncMap
 }
 
 func NewConfig(options *options.CompletedOptions) (*Config, error) {
@@ -53,7 +69,9 @@ func NewConfig(options *options.CompletedOptions) (*Config, error) {
 	rules := clientcmd.NewDefaultClientConfigLoadingRules()
 	rules.ExplicitPath = options.KubeConfig
 	var err error
-	config.ClientConfig, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, nil).ClientConfig()
+	config.ClientConfig, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{
+		CurrentContext: options.Context,
+	}).ClientConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -71,9 +89,43 @@ func NewConfig(options *options.CompletedOptions) (*Config, error) {
 	}
 
 	// construct informer factories
-	config.KubeInformers = kubeinformers.NewSharedInformerFactory(config.KubeClient, time.Minute*30)
-	config.BindInformers = bindinformers.NewSharedInformerFactory(config.BindClient, time.Minute*30)
-	config.ApiextensionsInformers = apiextensionsinformers.NewSharedInformerFactory(config.ApiextensionsClient, time.Minute*30)
+	config.KubeInformers, config.BindInformers, config.ApiextensionsInformers, config.NamespacedInformers = newInformerFactories(
+		config.KubeClient,
+		config.BindClient,
+		config.ApiextensionsClient,
+		options.ResyncPeriod,
+		options.InformerNamespaces,
+	)
 
 	return config, nil
 }
+
+// newInformerFactories returns the shared informer factories of the clients, resyncing
+// their informers every resyncPeriod. Informers of namespaced objects come with one
+// factory per given namespace, or watch all namespaces if there are none. Namespaces
+// and CRDs are cluster-scoped and always watched cluster-wide.
+func newInformerFactories(
+	kubeClient kubernetesclient.Interface,
+	bindClient bindclient.Interface,
+	apiextensionsClient apiextensionsclient.Interface,
+	resyncPeriod time.Duration,
+	namespaces []string,
+) (kubeinformers.SharedInformerFactory, bindinformers.SharedInformerFactory, apiextensionsinformers.SharedInformerFactory, NamespacedInformers) {
+	kubeInformers := kubeinformers.NewSharedInformerFactory(kubeClient, resyncPeriod)
+	bindInformers := bindinformers.NewSharedInformerFactory(bindClient, resyncPeriod)
+	apiextensionsInformers := apiextensionsinformers.NewSharedInformerFactory(apiextensionsClient, resyncPeriod)
+
+	if len(namespaces) == 0 {
+		return kubeInformers, bindInformers, apiextensionsInformers, NamespacedInformers{
+			Namespaces: []string{metav1.NamespaceAll},
+			Kube:       []kubeinformers.SharedInformerFactory{kubeInformers},
+			Bind:       []bindinformers.SharedInformerFactory{bindInformers},
+		}
+	}
+	namespaced := NamespacedInformers{Namespaces: namespaces}
+	for _, ns := range namespaces {
+		namespaced.Kube = append(namespaced.Kube, kubeinformers.NewSharedInformerFactoryWithOptions(kubeClient, resyncPeriod, kubeinformers.WithNamespace(ns)))
+		namespaced.Bind = append(namespaced.Bind, bindinformers.NewSharedInformerFactoryWithOptions(bindClient, resyncPeriod, bindinformers.WithNamespace(ns)))
+	}
+	return kubeInformers, bindInformers, apiextensionsInformers, namespaced
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backend
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+	bindfake "github.com/kube-bind/kube-bind/pkg/client/clientset/versioned/fake"
+	"github.com/kube-bind/kube-bind/pkg/indexers"
+)
+
+func TestInformerFactoriesResyncPeriod(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kubeClient := kubefake.NewSimpleClientset(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cluster-abc"}})
+	kubeInformers, bindInformers, apiextensionsInformers, _ := newInformerFactories(kubeClient, bindfake.NewSimpleClientset(), apiextensionsfake.NewSimpleClientset(), 100*time.Millisecond, nil)
+	require.NotNil(t, bindInformers)
+	require.NotNil(t, apiextensionsInformers)
+
+	// resyncs deliver updates of unchanged objects at the factory period.
+	var resyncs int32
+	kubeInformers.Core().V1().Namespaces().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(old, obj interface{}) {
+			if old.(*corev1.Namespace).ResourceVersion == obj.(*corev1.Namespace).ResourceVersion {
+				atomic.AddInt32(&resyncs, 1)
+			}
+		},
+	})
+	kubeInformers.Start(ctx.Done())
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&resyncs) > 0
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestInformerFactoriesNamespaces(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	kubeClient := kubefake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cluster-abc"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cluster-def"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cluster-ghi"}},
+		&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-abc", Name: "a"}},
+		&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-def", Name: "a"}},
+		&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-ghi", Name: "a"}},
+	)
+	bindClient := bindfake.NewSimpleClientset(
+		&kubebindv1alpha1.APIServiceExport{ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-abc", Name: "mangodbs.mangodb.com"}},
+		&kubebindv1alpha1.APIServiceExport{ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-def", Name: "mangodbs.mangodb.com"}},
+		&kubebindv1alpha1.APIServiceExport{ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-ghi", Name: "mangodbs.mangodb.com"}},
+	)
+	kubeInformers, _, _, namespaced := newInformerFactories(kubeClient, bindClient, apiextensionsfake.NewSimpleClientset(), time.Minute, []string{"cluster-abc", "cluster-def"})
+
+	namespaces := kubeInformers.Core().V1().Namespaces().Lister()
+	roles := namespaced.Roles().Lister()
+	exportInformer := namespaced.APIServiceExports()
+	indexers.AddIfNotPresentOrDie(exportInformer.Informer().GetIndexer(), cache.Indexers{
+		indexers.ServiceExportByCustomResourceDefinition: indexers.IndexServiceExportByCustomResourceDefinition,
+	})
+	var added int32
+	exportInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			atomic.AddInt32(&added, 1)
+		},
+	})
+	kubeInformers.Start(ctx.Done())
+	namespaced.Start(ctx.Done())
+	kubeInformers.WaitForCacheSync(ctx.Done())
+	for _, ok := range namespaced.WaitForCacheSync(ctx.Done()) {
+		require.True(t, ok)
+	}
+	require.True(t, exportInformer.Informer().HasSynced())
+	require.NotNil(t, exportInformer.Informer().GetController())
+	require.True(t, exportInformer.Informer().GetController().HasSynced())
+
+	// namespaces are cluster-scoped and not affected.
+	nss, err := namespaces.List(labels.Everything())
+	require.NoError(t, err)
+	require.Len(t, nss, 3)
+
+	// namespaced objects are merged from the informer namespaces.
+	rs, err := roles.List(labels.Everything())
+	require.NoError(t, err)
+	var names []string
+	for _, r := range rs {
+		names = append(names, r.Namespace)
+	}
+	require.ElementsMatch(t, []string{"cluster-abc", "cluster-def"}, names)
+
+	rs, err = roles.Roles("cluster-def").List(labels.Everything())
+	require.NoError(t, err)
+	require.Len(t, rs, 1)
+	_, err = roles.Roles("cluster-abc").Get("a")
+	require.NoError(t, err)
+	_, err = roles.Roles("cluster-ghi").Get("a")
+	require.True(t, errors.IsNotFound(err), "objects of other namespaces must not be found, got %v", err)
+
+	es, err := exportInformer.Lister().List(labels.Everything())
+	require.NoError(t, err)
+	require.Len(t, es, 2)
+	indexed, err := exportInformer.Informer().GetIndexer().ByIndex(cache.NamespaceIndex, "cluster-def")
+	require.NoError(t, err)
+	require.Len(t, indexed, 1)
+	require.Contains(t, exportInformer.Informer().GetIndexer().GetIndexers(), indexers.ServiceExportByCustomResourceDefinition)
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&added) == 2
+	}, 5*time.Second, 50*time.Millisecond)
+}
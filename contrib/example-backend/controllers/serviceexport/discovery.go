@@ -0,0 +1,116 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package serviceexport
+
+import (
+	"fmt"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/openapi"
+	"sigs.k8s.io/yaml"
+
+	kubebindhelpers "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1/helpers"
+)
+
+// discoverResource returns the resource as published by discovery, with the schemas
+// of the OpenAPI v3 documents of its group versions, or nil if no version of the
+// group serves it. The client is expected to cache, see memory.NewMemCacheClient.
+func discoverResource(client discovery.DiscoveryInterface, group, resource string) (*kubebindhelpers.DiscoveredResource, error) {
+	groups, err := client.ServerGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	// API servers before 1.24 or with the feature disabled publish no OpenAPI v3.
+	paths, err := client.OpenAPIV3().Paths()
+	if errors.IsNotFound(err) {
+		paths = nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get OpenAPI v3 paths: %w", err)
+	}
+
+	for _, g := range groups.Groups {
+		if g.Name != group {
+			continue
+		}
+
+		discovered := &kubebindhelpers.DiscoveredResource{
+			Group:            group,
+			PreferredVersion: g.PreferredVersion.Version,
+		}
+		for _, v := range g.Versions {
+			list, err := client.ServerResourcesForGroupVersion(v.GroupVersion)
+			if errors.IsNotFound(err) || err == memory.ErrCacheNotFound {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+
+			version := kubebindhelpers.DiscoveredVersion{Name: v.Version}
+			found := false
+			for _, r := range list.APIResources {
+				if r.Name == resource {
+					version.Resource = r
+					found = true
+				} else if sub := strings.TrimPrefix(r.Name, resource+"/"); sub != r.Name {
+					version.Subresources = append(version.Subresources, sub)
+				}
+			}
+			if !found {
+				continue
+			}
+			if gv, found := paths["apis/"+v.GroupVersion]; found {
+				gvk := metav1.GroupVersionKind{Group: group, Version: v.Version, Kind: version.Resource.Kind}
+				if version.Schema, err = kindSchema(gv, gvk); err != nil {
+					return nil, err
+				}
+			}
+			discovered.Versions = append(discovered.Versions, version)
+		}
+		if len(discovered.Versions) == 0 {
+			return nil, nil
+		}
+		return discovered, nil
+	}
+
+	return nil, nil
+}
+
+// kindSchema returns the schema of the kind in the OpenAPI v3 document of the group
+// version, or nil if there is none.
+func kindSchema(gv openapi.GroupVersion, gvk metav1.GroupVersionKind) (*apiextensionsv1.JSONSchemaProps, error) {
+	doc, err := gv.Schema()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OpenAPI v3 schema of %s/%s: %w", gvk.Group, gvk.Version, err)
+	}
+	bs, err := yamlv3.Marshal(doc.ToRawInfo())
+	if err != nil {
+		return nil, err
+	}
+	bs, err = yaml.YAMLToJSON(bs)
+	if err != nil {
+		return nil, err
+	}
+	return kubebindhelpers.OpenAPIV3KindSchema(bs, gvk)
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package serviceexport
+
+import (
+	"testing"
+
+	openapi_v3 "github.com/google/gnostic/openapiv3"
+	"github.com/stretchr/testify/require"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/openapi"
+)
+
+// usageDocument is the OpenAPI v3 document of metrics.mangodb.com/v1.
+const usageDocument = `{"openapi":"3.0.0","info":{"title":"Kubernetes","version":"v1.25.0"},"paths":{},"components":{"schemas":{
+	"com.mangodb.metrics.v1.Usage": {
+		"type": "object",
+		"x-kubernetes-group-version-kind": [{"group":"metrics.mangodb.com","version":"v1","kind":"Usage"}],
+		"properties": {
+			"spec": {"type":"object","properties":{"replicas":{"type":"integer","format":"int32"}}}
+		}
+	}
+}}}`
+
+// fakeOpenAPIDiscovery serves OpenAPI v3 paths, which the fake discovery does not.
+type fakeOpenAPIDiscovery struct {
+	*fakediscovery.FakeDiscovery
+	paths map[string]openapi.GroupVersion
+}
+
+func (d *fakeOpenAPIDiscovery) OpenAPIV3() openapi.Client {
+	return fakeOpenAPIClient(d.paths)
+}
+
+type fakeOpenAPIClient map[string]openapi.GroupVersion
+
+func (c fakeOpenAPIClient) Paths() (map[string]openapi.GroupVersion, error) {
+	return c, nil
+}
+
+type fakeGroupVersion struct {
+	doc *openapi_v3.Document
+}
+
+func (gv fakeGroupVersion) Schema() (*openapi_v3.Document, error) {
+	return gv.doc, nil
+}
+
+func newFakeGroupVersion(t *testing.T, document string) openapi.GroupVersion {
+	doc, err := openapi_v3.ParseDocument([]byte(document))
+	require.NoError(t, err)
+	return fakeGroupVersion{doc: doc}
+}
+
+func TestKindSchema(t *testing.T) {
+	schema, err := kindSchema(newFakeGroupVersion(t, usageDocument), metav1.GroupVersionKind{Group: "metrics.mangodb.com", Version: "v1", Kind: "Usage"})
+	require.NoError(t, err)
+	require.NotNil(t, schema)
+	require.Equal(t, "object", schema.Type)
+	require.Equal(t, "integer", schema.Properties["spec"].Properties["replicas"].Type)
+	require.Equal(t, "int32", schema.Properties["spec"].Properties["replicas"].Format)
+}
+
+func TestKindSchemaOtherKind(t *testing.T) {
+	schema, err := kindSchema(newFakeGroupVersion(t, usageDocument), metav1.GroupVersionKind{Group: "metrics.mangodb.com", Version: "v1", Kind: "Quota"})
+	require.NoError(t, err)
+	require.Nil(t, schema)
+}
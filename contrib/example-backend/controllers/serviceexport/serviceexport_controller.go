@@ -19,6 +19,7 @@ package serviceexport
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
@@ -26,9 +27,14 @@ import (
 	apiextensionslisters "k8s.io/apiextensions-apiserver/pkg/client/listers/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/version"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
 	kubernetesclient "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
@@ -36,6 +42,7 @@ import (
 	"k8s.io/klog/v2"
 
 	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+	kubebindhelpers "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1/helpers"
 	bindclient "github.com/kube-bind/kube-bind/pkg/client/clientset/versioned"
 	bindinformers "github.com/kube-bind/kube-bind/pkg/client/informers/externalversions/kubebind/v1alpha1"
 	bindlisters "github.com/kube-bind/kube-bind/pkg/client/listers/kubebind/v1alpha1"
@@ -45,6 +52,10 @@ import (
 
 const (
 	controllerName = "kube-bind-example-backend-serviceexport"
+
+	// aggregatedResyncPeriod is how often discovery is refreshed and exports of
+	// aggregated resources are requeued, as there are no events for their changes.
+	aggregatedResyncPeriod = 5 * time.Minute
 )
 
 // NewController returns a new controller to reconcile CRDs.
@@ -53,6 +64,7 @@ func NewController(
 	serviceExportInformer bindinformers.APIServiceExportInformer,
 	serviceExportResourceInformer bindinformers.APIServiceExportResourceInformer,
 	crdInformer apiextensionsinformers.CustomResourceDefinitionInformer,
+	minConsumerVersion *version.Version,
 ) (*Controller, error) {
 	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName)
 
@@ -69,12 +81,19 @@ func NewController(
 	if err != nil {
 		return nil, err
 	}
+	discoveryClient := memory.NewMemCacheClient(kubeClient.Discovery())
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	selectableFields := &selectableFieldsCache{client: dynamicClient, crdLister: crdInformer.Lister(), fields: map[string]crdSelectableFields{}}
 
 	c := &Controller{
 		queue: queue,
 
-		bindClient: bindClient,
-		kubeClient: kubeClient,
+		bindClient:      bindClient,
+		kubeClient:      kubeClient,
+		discoveryClient: discoveryClient,
 
 		serviceExportLister:  serviceExportInformer.Lister(),
 		serviceExportIndexer: serviceExportInformer.Informer().GetIndexer(),
@@ -86,9 +105,15 @@ func NewController(
 		crdIndexer: crdInformer.Informer().GetIndexer(),
 
 		reconciler: reconciler{
+			minConsumerVersion: minConsumerVersion,
+
 			getCRD: func(name string) (*apiextensionsv1.CustomResourceDefinition, error) {
 				return crdInformer.Lister().Get(name)
 			},
+			getCRDSelectableFields: selectableFields.get,
+			discoverResource: func(group, resource string) (*kubebindhelpers.DiscoveredResource, error) {
+				return discoverResource(discoveryClient, group, resource)
+			},
 			getServiceExportResource: func(ns, name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
 				return serviceExportResourceInformer.Lister().APIServiceExportResources(ns).Get(name)
 			},
@@ -165,8 +190,9 @@ type CommitFunc = func(context.Context, *Resource, *Resource) error
 type Controller struct {
 	queue workqueue.RateLimitingInterface
 
-	bindClient bindclient.Interface
-	kubeClient kubernetesclient.Interface
+	bindClient      bindclient.Interface
+	kubeClient      kubernetesclient.Interface
+	discoveryClient discovery.CachedDiscoveryInterface
 
 	serviceExportLister  bindlisters.APIServiceExportLister
 	serviceExportIndexer cache.Indexer
@@ -182,6 +208,52 @@ type Controller struct {
 	commit CommitFunc
 }
 
+// selectableFieldsCache reads the selectable fields of CRDs from the unstructured CRD,
+// as the CustomResourceDefinition types do not know them. The result is cached for the
+// resource version of the informer CRD, and dropped when the CRD is gone.
+type selectableFieldsCache struct {
+	client    dynamic.Interface
+	crdLister apiextensionslisters.CustomResourceDefinitionLister
+
+	lock   sync.Mutex
+	fields map[string]crdSelectableFields // by CRD name
+}
+
+type crdSelectableFields struct {
+	resourceVersion string
+	fields          map[string][]kubebindv1alpha1.SelectableField
+}
+
+func (c *selectableFieldsCache) get(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) (map[string][]kubebindv1alpha1.SelectableField, error) {
+	c.lock.Lock()
+	cached, found := c.fields[crd.Name]
+	c.lock.Unlock()
+	if found && cached.resourceVersion == crd.ResourceVersion {
+		return cached.fields, nil
+	}
+
+	obj, err := c.client.Resource(apiextensionsv1.SchemeGroupVersion.WithResource("customresourcedefinitions")).Get(ctx, crd.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	fields, err := kubebindhelpers.CRDSelectableFields(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.fields[crd.Name] = crdSelectableFields{resourceVersion: crd.ResourceVersion, fields: fields}
+
+	// prune deleted CRDs on misses, which are rare compared to hits.
+	for name := range c.fields {
+		if _, err := c.crdLister.Get(name); errors.IsNotFound(err) {
+			delete(c.fields, name)
+		}
+	}
+	return fields, nil
+}
+
 func (c *Controller) enqueueServiceExport(logger klog.Logger, obj interface{}) {
 	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
 	if err != nil {
@@ -245,6 +317,35 @@ func (c *Controller) enqueueCRD(logger klog.Logger, obj interface{}) {
 	}
 }
 
+// resyncAggregated invalidates the cached discovery and queues all exports with
+// aggregated resources.
+func (c *Controller) resyncAggregated(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+
+	c.discoveryClient.Invalidate()
+
+	exports, err := c.serviceExportLister.List(labels.Everything())
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, export := range exports {
+		for _, gr := range export.Spec.Resources {
+			if gr.Source != kubebindv1alpha1.AggregatedAPISource {
+				continue
+			}
+			key, err := cache.MetaNamespaceKeyFunc(export)
+			if err != nil {
+				runtime.HandleError(err)
+				break
+			}
+			logger.V(2).Info("queueing APIServiceExport", "key", key, "reason", "AggregatedResync")
+			c.queue.Add(key)
+			break
+		}
+	}
+}
+
 // Start starts the controller, which stops when ctx.Done() is closed.
 func (c *Controller) Start(ctx context.Context, numThreads int) {
 	defer runtime.HandleCrash()
@@ -258,6 +359,7 @@ func (c *Controller) Start(ctx context.Context, numThreads int) {
 	for i := 0; i < numThreads; i++ {
 		go wait.UntilWithContext(ctx, c.startWorker, time.Second)
 	}
+	go wait.UntilWithContext(ctx, c.resyncAggregated, aggregatedResyncPeriod)
 
 	<-ctx.Done()
 }
@@ -18,10 +18,13 @@ package serviceexport
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/version"
 	"k8s.io/klog/v2"
 
 	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
@@ -31,11 +34,20 @@ import (
 )
 
 type reconciler struct {
+	// minConsumerVersion is the oldest consumer cluster version the exported resources
+	// must be served by. Nil disables the check.
+	minConsumerVersion *version.Version
+
 	getCRD                      func(name string) (*apiextensionsv1.CustomResourceDefinition, error)
+	discoverResource            func(group, resource string) (*kubebindhelpers.DiscoveredResource, error)
 	getServiceExportResource    func(ns, name string) (*kubebindv1alpha1.APIServiceExportResource, error)
 	createServiceExportResource func(ctx context.Context, resource *kubebindv1alpha1.APIServiceExportResource) (*kubebindv1alpha1.APIServiceExportResource, error)
 	updateServiceExportResource func(ctx context.Context, resource *kubebindv1alpha1.APIServiceExportResource) (*kubebindv1alpha1.APIServiceExportResource, error)
 	deleteServiceExportResource func(ctx context.Context, ns, name string) error
+
+	// getCRDSelectableFields returns the selectable fields of the CRD by version. Nil
+	// exports no selectable fields.
+	getCRDSelectableFields func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) (map[string][]kubebindv1alpha1.SelectableField, error)
 }
 
 func (r *reconciler) reconcile(ctx context.Context, export *kubebindv1alpha1.APIServiceExport) error {
@@ -43,56 +55,195 @@ func (r *reconciler) reconcile(ctx context.Context, export *kubebindv1alpha1.API
 	var errs []error
 
 	resourceInSync := true
+	var unsupported []string
+	var shadowing []string
 	for _, gr := range export.Spec.Resources {
 		name := gr.Resource + "." + gr.Group
 
-		ser, err := r.getServiceExportResource(export.Namespace, name)
-		if err != nil && !errors.IsNotFound(err) {
-			return err
+		if err := kubebindhelpers.ValidateGroup(gr.Group); err != nil {
+			if resourceInSync {
+				conditions.MarkFalse(
+					export,
+					kubebindv1alpha1.APIServiceExportConditionResourcesInSync,
+					"InvalidGroup",
+					conditionsapi.ConditionSeverityError,
+					"Referenced resource %s cannot be exported: %s",
+					name, err,
+				)
+				resourceInSync = false
+			}
+			continue
 		}
-		crd, err := r.getCRD(name)
+
+		ser, err := r.getServiceExportResource(export.Namespace, name)
 		if err != nil && !errors.IsNotFound(err) {
 			return err
 		}
 
-		if crd == nil {
-			if ser != nil {
-				// CRD missing => delete SER too
-				logger.V(1).Info("Deleting APIServiceExportResource because CRD is missing")
-				if err := r.deleteServiceExportResource(ctx, export.Namespace, name); err != nil && !errors.IsNotFound(err) {
-					return err
+		var resource *kubebindv1alpha1.APIServiceExportResource
+		if gr.Source == kubebindv1alpha1.AggregatedAPISource {
+			discovered, err := r.discoverResource(gr.Group, gr.Resource)
+			if err != nil {
+				return err
+			}
+			if discovered == nil {
+				if ser != nil {
+					logger.V(1).Info("Deleting APIServiceExportResource because the aggregated resource is missing")
+					if err := r.deleteServiceExportResource(ctx, export.Namespace, name); err != nil && !errors.IsNotFound(err) {
+						return err
+					}
+				}
+				if resourceInSync {
+					conditions.MarkFalse(
+						export,
+						kubebindv1alpha1.APIServiceExportConditionResourcesInSync,
+						"AggregatedResourceMissing",
+						conditionsapi.ConditionSeverityError,
+						"Referenced resource %s is not served by an API server",
+						name,
+					)
+					resourceInSync = false
 				}
+				continue
+			}
+			resource, err = kubebindhelpers.DiscoveredResourceToServiceExportResource(discovered)
+			if err != nil {
+				if resourceInSync {
+					conditions.MarkFalse(
+						export,
+						kubebindv1alpha1.APIServiceExportConditionResourcesInSync,
+						"AggregatedResourceUpdateFailed",
+						conditionsapi.ConditionSeverityError,
+						"Aggregated resource %s cannot be converted into a APIServiceExportResource: %s",
+						name, err,
+					)
+					resourceInSync = false
+				}
+				continue
+			}
+		} else {
+			crd, err := r.getCRD(name)
+			if err != nil && !errors.IsNotFound(err) {
+				return err
 			}
 
+			// a terminating CRD is still listed, but must not be exported anymore.
+			deleting := crd != nil && crd.DeletionTimestamp != nil
+			if crd == nil || deleting {
+				if ser != nil {
+					// CRD missing => delete SER too
+					logger.V(1).Info("Deleting APIServiceExportResource because CRD is missing", "deleting", deleting)
+					if err := r.deleteServiceExportResource(ctx, export.Namespace, name); err != nil && !errors.IsNotFound(err) {
+						return err
+					}
+				}
+
+				if resourceInSync && deleting {
+					conditions.MarkFalse(
+						export,
+						kubebindv1alpha1.APIServiceExportConditionResourcesInSync,
+						"CustomResourceDefinitionDeleting",
+						conditionsapi.ConditionSeverityError,
+						"Referenced CustomResourceDefinition %s is being deleted",
+						name,
+					)
+					resourceInSync = false
+				} else if resourceInSync && kubebindhelpers.IsBuiltInGroup(gr.Group) {
+					conditions.MarkFalse(
+						export,
+						kubebindv1alpha1.APIServiceExportConditionResourcesInSync,
+						"BuiltInResource",
+						conditionsapi.ConditionSeverityError,
+						"Referenced resource %s is built into Kubernetes, only CustomResourceDefinitions can be exported",
+						name,
+					)
+					resourceInSync = false
+				} else if resourceInSync {
+					conditions.MarkFalse(
+						export,
+						kubebindv1alpha1.APIServiceExportConditionResourcesInSync,
+						"CustomResourceDefinitionMissing",
+						conditionsapi.ConditionSeverityError,
+						"Referenced CustomResourceDefinition %s does not exist",
+						name,
+					)
+					resourceInSync = false
+				}
+				continue
+			}
+
+			resource, err = kubebindhelpers.CRDToServiceExportResource(crd)
+			if err != nil {
+				if resourceInSync {
+					conditions.MarkFalse(
+						export,
+						kubebindv1alpha1.APIServiceExportConditionResourcesInSync,
+						"CustomResourceDefinitionUpdateFailed",
+						conditionsapi.ConditionSeverityError,
+						"CustomResourceDefinition %s cannot be converted into a APIServiceExportResource: %s",
+						name, err,
+					)
+					resourceInSync = false
+				}
+				continue
+			}
+			if r.getCRDSelectableFields != nil {
+				fields, err := r.getCRDSelectableFields(ctx, crd)
+				if err != nil {
+					errs = append(errs, err)
+					continue
+				}
+				kubebindhelpers.SetSelectableFields(resource, fields)
+			}
+		}
+		resource.Spec.MetadataPropagation = gr.MetadataPropagation.DeepCopy()
+		if err := kubebindhelpers.PinVersions(resource, gr.Versions); err != nil {
 			if resourceInSync {
 				conditions.MarkFalse(
 					export,
 					kubebindv1alpha1.APIServiceExportConditionResourcesInSync,
-					"CustomResourceDefinitionMissing",
+					"PinnedVersionNotServed",
 					conditionsapi.ConditionSeverityError,
-					"Referenced CustomResourceDefinition %s does not exist",
-					name,
+					"CustomResourceDefinition %s cannot be exported with the pinned versions: %s",
+					name, err,
 				)
 				resourceInSync = false
 			}
 			continue
 		}
-
-		resource, err := kubebindhelpers.CRDToServiceExportResource(crd)
-		if err != nil {
+		if gr.Source == kubebindv1alpha1.AggregatedAPISource {
+			// follow the storage version if pinning dropped the preferred version.
+			resource.Spec.CanonicalVersion = resource.Spec.StorageVersion
+		}
+		if err := kubebindhelpers.ValidateCanonicalVersion(resource); err != nil {
 			if resourceInSync {
 				conditions.MarkFalse(
 					export,
 					kubebindv1alpha1.APIServiceExportConditionResourcesInSync,
-					"CustomResourceDefinitionUpdateFailed",
+					"InvalidCanonicalVersion",
 					conditionsapi.ConditionSeverityError,
-					"CustomResourceDefinition %s cannot be converted into a APIServiceExportResource: %s",
+					"CustomResourceDefinition %s cannot be collapsed to its canonical version: %s",
 					name, err,
 				)
 				resourceInSync = false
 			}
 			continue
 		}
+		if r.minConsumerVersion != nil {
+			features, err := kubebindhelpers.UnsupportedFeatures(resource, r.minConsumerVersion)
+			if err != nil {
+				errs = append(errs, err)
+			} else if len(features) > 0 {
+				unsupported = append(unsupported, fmt.Sprintf("%s uses %s", name, strings.Join(features, ", ")))
+			}
+		}
+		consumerNames := resource.Spec.Names
+		if rewrite := resource.Spec.ConsumerRewrite; rewrite != nil && rewrite.Names != nil {
+			consumerNames = *rewrite.Names
+		}
+		if shadowed := kubebindhelpers.ShadowedBuiltInResources(consumerNames); len(shadowed) > 0 {
+			shadowing = append(shadowing, fmt.Sprintf("%s shadows %s", name, strings.Join(shadowed, ", ")))
+		}
 		resource.Namespace = export.Namespace
 
 		if ser == nil {
@@ -117,5 +268,33 @@ func (r *reconciler) reconcile(ctx context.Context, export *kubebindv1alpha1.API
 		conditions.MarkTrue(export, kubebindv1alpha1.APIServiceExportConditionResourcesInSync)
 	}
 
+	if r.minConsumerVersion != nil {
+		if len(unsupported) > 0 {
+			conditions.MarkFalse(
+				export,
+				kubebindv1alpha1.APIServiceExportConditionConsumerVersionSupported,
+				"UnsupportedByMinimumConsumerVersion",
+				conditionsapi.ConditionSeverityWarning,
+				"Consumer clusters of the minimum supported version %s cannot serve all resources: %s",
+				r.minConsumerVersion, strings.Join(unsupported, "; "),
+			)
+		} else {
+			conditions.MarkTrue(export, kubebindv1alpha1.APIServiceExportConditionConsumerVersionSupported)
+		}
+	}
+
+	if len(shadowing) > 0 {
+		conditions.MarkFalse(
+			export,
+			kubebindv1alpha1.APIServiceExportConditionBuiltInResourcesNotShadowed,
+			"ShadowsBuiltInResources",
+			conditionsapi.ConditionSeverityWarning,
+			"Names of resources collide with built-in resources, which kubectl resolves instead: %s",
+			strings.Join(shadowing, "; "),
+		)
+	} else {
+		conditions.MarkTrue(export, kubebindv1alpha1.APIServiceExportConditionBuiltInResourcesNotShadowed)
+	}
+
 	return utilerrors.NewAggregate(errs)
 }
@@ -0,0 +1,518 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package serviceexport
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionslisters "k8s.io/apiextensions-apiserver/pkg/client/listers/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/openapi"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+	kubebindhelpers "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1/helpers"
+	"github.com/kube-bind/kube-bind/pkg/apis/third_party/conditions/util/conditions"
+)
+
+func TestReconcileMinConsumerVersion(t *testing.T) {
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "mangodb.com",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb", Kind: "MangoDB", ListKind: "MangoDBList"},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{
+				Name:    "v1",
+				Served:  true,
+				Storage: true,
+				Schema: &apiextensionsv1.CustomResourceValidation{
+					OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+						Type:         "object",
+						XValidations: apiextensionsv1.ValidationRules{{Rule: "has(self.spec)"}},
+					},
+				},
+			}},
+		},
+	}
+
+	tests := []struct {
+		name               string
+		minConsumerVersion string
+		wantStatus         corev1.ConditionStatus
+	}{
+		{name: "disabled"},
+		{name: "old consumers", minConsumerVersion: "1.24", wantStatus: corev1.ConditionFalse},
+		{name: "new consumers", minConsumerVersion: "1.25", wantStatus: corev1.ConditionTrue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created *kubebindv1alpha1.APIServiceExportResource
+			r := &reconciler{
+				getCRD: func(name string) (*apiextensionsv1.CustomResourceDefinition, error) {
+					return crd, nil
+				},
+				getServiceExportResource: func(ns, name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					return nil, errors.NewNotFound(kubebindv1alpha1.Resource("apiserviceexportresources"), name)
+				},
+				createServiceExportResource: func(ctx context.Context, resource *kubebindv1alpha1.APIServiceExportResource) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					created = resource
+					return resource, nil
+				},
+			}
+			if tt.minConsumerVersion != "" {
+				r.minConsumerVersion = version.MustParseGeneric(tt.minConsumerVersion)
+			}
+			export := &kubebindv1alpha1.APIServiceExport{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-abc", Name: "mangodbs.mangodb.com"},
+				Spec: kubebindv1alpha1.APIServiceExportSpec{
+					Resources: []kubebindv1alpha1.APIServiceExportGroupResource{{GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: "mangodbs"}}},
+				},
+			}
+
+			require.NoError(t, r.reconcile(context.Background(), export))
+			require.NotNil(t, created, "resources are exported regardless of the consumer version")
+
+			cond := conditions.Get(export, kubebindv1alpha1.APIServiceExportConditionConsumerVersionSupported)
+			if tt.wantStatus == "" {
+				require.Nil(t, cond)
+				return
+			}
+			require.NotNil(t, cond)
+			require.Equal(t, tt.wantStatus, cond.Status)
+			if tt.wantStatus == corev1.ConditionFalse {
+				require.Equal(t, "UnsupportedByMinimumConsumerVersion", cond.Reason)
+				require.Contains(t, cond.Message, "x-kubernetes-validations (requires 1.25)")
+			}
+		})
+	}
+}
+
+func TestReconcileBuiltInResource(t *testing.T) {
+	tests := []struct {
+		name       string
+		gr         kubebindv1alpha1.GroupResource
+		wantReason string
+	}{
+		{name: "built-in", gr: kubebindv1alpha1.GroupResource{Resource: "configmaps"}, wantReason: "BuiltInResource"},
+		{name: "missing crd", gr: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: "mangodbs"}, wantReason: "CustomResourceDefinitionMissing"},
+		{name: "invalid group", gr: kubebindv1alpha1.GroupResource{Group: "mango_db.com", Resource: "mangodbs"}, wantReason: "InvalidGroup"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &reconciler{
+				getCRD: func(name string) (*apiextensionsv1.CustomResourceDefinition, error) {
+					return nil, errors.NewNotFound(apiextensionsv1.Resource("customresourcedefinitions"), name)
+				},
+				getServiceExportResource: func(ns, name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					return nil, errors.NewNotFound(kubebindv1alpha1.Resource("apiserviceexportresources"), name)
+				},
+			}
+			export := &kubebindv1alpha1.APIServiceExport{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-abc", Name: tt.gr.Resource + "." + tt.gr.Group},
+				Spec: kubebindv1alpha1.APIServiceExportSpec{
+					Resources: []kubebindv1alpha1.APIServiceExportGroupResource{{GroupResource: tt.gr}},
+				},
+			}
+
+			require.NoError(t, r.reconcile(context.Background(), export))
+			cond := conditions.Get(export, kubebindv1alpha1.APIServiceExportConditionResourcesInSync)
+			require.NotNil(t, cond)
+			require.Equal(t, corev1.ConditionFalse, cond.Status)
+			require.Equal(t, tt.wantReason, cond.Reason)
+		})
+	}
+}
+
+func TestReconcileStaleServiceExportResource(t *testing.T) {
+	now := metav1.Now()
+	tests := []struct {
+		name       string
+		crd        *apiextensionsv1.CustomResourceDefinition
+		wantReason string
+	}{
+		{name: "deleted crd", wantReason: "CustomResourceDefinitionMissing"},
+		{name: "terminating crd", crd: &apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com", DeletionTimestamp: &now, Finalizers: []string{apiextensionsv1.CustomResourceCleanupFinalizer}},
+			Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+				Group:    "mangodb.com",
+				Names:    apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb", Kind: "MangoDB", ListKind: "MangoDBList"},
+				Scope:    apiextensionsv1.NamespaceScoped,
+				Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{Name: "v1", Served: true, Storage: true}},
+			},
+		}, wantReason: "CustomResourceDefinitionDeleting"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deleted []string
+			r := &reconciler{
+				getCRD: func(name string) (*apiextensionsv1.CustomResourceDefinition, error) {
+					if tt.crd == nil {
+						return nil, errors.NewNotFound(apiextensionsv1.Resource("customresourcedefinitions"), name)
+					}
+					return tt.crd, nil
+				},
+				// the informer still has the export resource of the CRD.
+				getServiceExportResource: func(ns, name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					return &kubebindv1alpha1.APIServiceExportResource{ObjectMeta: metav1.ObjectMeta{Namespace: ns, Name: name}}, nil
+				},
+				updateServiceExportResource: func(ctx context.Context, resource *kubebindv1alpha1.APIServiceExportResource) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					t.Fatalf("unexpected update of %s", resource.Name)
+					return nil, nil
+				},
+				deleteServiceExportResource: func(ctx context.Context, ns, name string) error {
+					deleted = append(deleted, ns+"/"+name)
+					return nil
+				},
+			}
+			export := &kubebindv1alpha1.APIServiceExport{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-abc", Name: "mangodbs.mangodb.com"},
+				Spec: kubebindv1alpha1.APIServiceExportSpec{
+					Resources: []kubebindv1alpha1.APIServiceExportGroupResource{{GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: "mangodbs"}}},
+				},
+			}
+
+			require.NoError(t, r.reconcile(context.Background(), export))
+			require.Equal(t, []string{"cluster-abc/mangodbs.mangodb.com"}, deleted)
+			cond := conditions.Get(export, kubebindv1alpha1.APIServiceExportConditionResourcesInSync)
+			require.NotNil(t, cond)
+			require.Equal(t, corev1.ConditionFalse, cond.Status)
+			require.Equal(t, tt.wantReason, cond.Reason)
+		})
+	}
+}
+
+func TestReconcileBuiltInResourcesShadowed(t *testing.T) {
+	tests := []struct {
+		name        string
+		shortNames  []string
+		wantStatus  corev1.ConditionStatus
+		wantMessage string
+	}{
+		{name: "no collision", shortNames: []string{"mdb"}, wantStatus: corev1.ConditionTrue},
+		{name: "colliding short name", shortNames: []string{"po"}, wantStatus: corev1.ConditionFalse, wantMessage: "mangodbs.mangodb.com shadows pods"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crd := &apiextensionsv1.CustomResourceDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+				Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+					Group:    "mangodb.com",
+					Names:    apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb", Kind: "MangoDB", ListKind: "MangoDBList", ShortNames: tt.shortNames},
+					Scope:    apiextensionsv1.NamespaceScoped,
+					Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{Name: "v1", Served: true, Storage: true}},
+				},
+			}
+			r := &reconciler{
+				getCRD: func(name string) (*apiextensionsv1.CustomResourceDefinition, error) {
+					return crd, nil
+				},
+				getServiceExportResource: func(ns, name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					return nil, errors.NewNotFound(kubebindv1alpha1.Resource("apiserviceexportresources"), name)
+				},
+				createServiceExportResource: func(ctx context.Context, resource *kubebindv1alpha1.APIServiceExportResource) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					return resource, nil
+				},
+			}
+			export := &kubebindv1alpha1.APIServiceExport{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-abc", Name: "mangodbs.mangodb.com"},
+				Spec: kubebindv1alpha1.APIServiceExportSpec{
+					Resources: []kubebindv1alpha1.APIServiceExportGroupResource{{GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: "mangodbs"}}},
+				},
+			}
+
+			require.NoError(t, r.reconcile(context.Background(), export))
+
+			cond := conditions.Get(export, kubebindv1alpha1.APIServiceExportConditionBuiltInResourcesNotShadowed)
+			require.NotNil(t, cond)
+			require.Equal(t, tt.wantStatus, cond.Status)
+			if tt.wantStatus == corev1.ConditionFalse {
+				require.Equal(t, "ShadowsBuiltInResources", cond.Reason)
+				require.Contains(t, cond.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestReconcileCanonicalVersion(t *testing.T) {
+	newVersion := func(name string, storage bool) apiextensionsv1.CustomResourceDefinitionVersion {
+		return apiextensionsv1.CustomResourceDefinitionVersion{
+			Name:    name,
+			Served:  true,
+			Storage: storage,
+			Schema: &apiextensionsv1.CustomResourceValidation{
+				OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{Type: "object"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		canonical  string
+		pinned     []string
+		wantReason string
+	}{
+		{name: "canonical version", canonical: "v1"},
+		{name: "unknown canonical version", canonical: "v2", wantReason: "InvalidCanonicalVersion"},
+		{name: "canonical version not pinned", canonical: "v1", pinned: []string{"v1beta1"}, wantReason: "InvalidCanonicalVersion"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crd := &apiextensionsv1.CustomResourceDefinition{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "mangodbs.mangodb.com",
+					Annotations: map[string]string{kubebindv1alpha1.CanonicalVersionAnnotationKey: tt.canonical},
+				},
+				Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+					Group:    "mangodb.com",
+					Names:    apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb", Kind: "MangoDB", ListKind: "MangoDBList"},
+					Scope:    apiextensionsv1.NamespaceScoped,
+					Versions: []apiextensionsv1.CustomResourceDefinitionVersion{newVersion("v1alpha1", false), newVersion("v1beta1", true), newVersion("v1", false)},
+				},
+			}
+			var created *kubebindv1alpha1.APIServiceExportResource
+			r := &reconciler{
+				getCRD: func(name string) (*apiextensionsv1.CustomResourceDefinition, error) {
+					return crd, nil
+				},
+				getServiceExportResource: func(ns, name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					return nil, errors.NewNotFound(kubebindv1alpha1.Resource("apiserviceexportresources"), name)
+				},
+				createServiceExportResource: func(ctx context.Context, resource *kubebindv1alpha1.APIServiceExportResource) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					created = resource
+					return resource, nil
+				},
+			}
+			export := &kubebindv1alpha1.APIServiceExport{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-abc", Name: "mangodbs.mangodb.com"},
+				Spec: kubebindv1alpha1.APIServiceExportSpec{
+					Resources: []kubebindv1alpha1.APIServiceExportGroupResource{{
+						GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: "mangodbs"},
+						Versions:      tt.pinned,
+					}},
+				},
+			}
+
+			require.NoError(t, r.reconcile(context.Background(), export))
+
+			cond := conditions.Get(export, kubebindv1alpha1.APIServiceExportConditionResourcesInSync)
+			require.NotNil(t, cond)
+			if tt.wantReason != "" {
+				require.Equal(t, corev1.ConditionFalse, cond.Status)
+				require.Equal(t, tt.wantReason, cond.Reason)
+				require.Nil(t, created)
+				return
+			}
+			require.Equal(t, corev1.ConditionTrue, cond.Status)
+			require.NotNil(t, created)
+			require.Equal(t, tt.canonical, created.Spec.CanonicalVersion)
+			require.Equal(t, tt.canonical, created.Spec.StorageVersion)
+		})
+	}
+}
+
+func TestReconcileAggregatedResource(t *testing.T) {
+	fake := &fakediscovery.FakeDiscovery{Fake: &clienttesting.Fake{Resources: []*metav1.APIResourceList{
+		{
+			GroupVersion: "metrics.mangodb.com/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "usages", SingularName: "usage", Namespaced: true, Kind: "Usage", Verbs: metav1.Verbs{"get", "list", "watch"}},
+				{Name: "usages/status", Namespaced: true, Kind: "Usage", Verbs: metav1.Verbs{"get"}},
+			},
+		},
+		{
+			GroupVersion: "metrics.mangodb.com/v1beta1",
+			APIResources: []metav1.APIResource{
+				{Name: "usages", SingularName: "usage", Namespaced: true, Kind: "Usage", Verbs: metav1.Verbs{"get", "list", "watch"}},
+			},
+		},
+	}}}
+	// only v1 publishes an OpenAPI v3 schema.
+	client := &fakeOpenAPIDiscovery{
+		FakeDiscovery: fake,
+		paths:         map[string]openapi.GroupVersion{"apis/metrics.mangodb.com/v1": newFakeGroupVersion(t, usageDocument)},
+	}
+
+	tests := []struct {
+		name          string
+		resource      string
+		pinned        []string
+		wantReason    string
+		wantCanonical string
+	}{
+		{name: "preferred version", resource: "usages", wantCanonical: "v1"},
+		{name: "pinned to non-preferred version", resource: "usages", pinned: []string{"v1beta1"}, wantCanonical: "v1beta1"},
+		{name: "missing resource", resource: "quotas", wantReason: "AggregatedResourceMissing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created *kubebindv1alpha1.APIServiceExportResource
+			r := &reconciler{
+				getCRD: func(name string) (*apiextensionsv1.CustomResourceDefinition, error) {
+					t.Fatalf("unexpected CRD lookup of %s", name)
+					return nil, nil
+				},
+				discoverResource: func(group, resource string) (*kubebindhelpers.DiscoveredResource, error) {
+					return discoverResource(client, group, resource)
+				},
+				getServiceExportResource: func(ns, name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					return nil, errors.NewNotFound(kubebindv1alpha1.Resource("apiserviceexportresources"), name)
+				},
+				createServiceExportResource: func(ctx context.Context, resource *kubebindv1alpha1.APIServiceExportResource) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					created = resource
+					return resource, nil
+				},
+			}
+			export := &kubebindv1alpha1.APIServiceExport{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-abc", Name: tt.resource + ".metrics.mangodb.com"},
+				Spec: kubebindv1alpha1.APIServiceExportSpec{
+					Resources: []kubebindv1alpha1.APIServiceExportGroupResource{{
+						GroupResource: kubebindv1alpha1.GroupResource{Group: "metrics.mangodb.com", Resource: tt.resource},
+						Source:        kubebindv1alpha1.AggregatedAPISource,
+						Versions:      tt.pinned,
+					}},
+				},
+			}
+
+			require.NoError(t, r.reconcile(context.Background(), export))
+
+			cond := conditions.Get(export, kubebindv1alpha1.APIServiceExportConditionResourcesInSync)
+			require.NotNil(t, cond)
+			if tt.wantReason != "" {
+				require.Equal(t, corev1.ConditionFalse, cond.Status)
+				require.Equal(t, tt.wantReason, cond.Reason)
+				require.Nil(t, created)
+				return
+			}
+			require.Equal(t, corev1.ConditionTrue, cond.Status)
+			require.NotNil(t, created)
+			require.Equal(t, "cluster-abc", created.Namespace)
+			require.Equal(t, "Usage", created.Spec.Names.Kind)
+			require.Equal(t, apiextensionsv1.NamespaceScoped, created.Spec.Scope)
+			require.Equal(t, tt.wantCanonical, created.Spec.CanonicalVersion)
+			require.Equal(t, tt.wantCanonical, created.Spec.StorageVersion)
+			for _, v := range created.Spec.Versions {
+				if v.Name == "v1" {
+					require.Contains(t, string(v.Schema.OpenAPIV3Schema.Raw), `"replicas"`)
+				} else {
+					require.Contains(t, string(v.Schema.OpenAPIV3Schema.Raw), `"x-kubernetes-preserve-unknown-fields":true`)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileSelectableFields(t *testing.T) {
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com", ResourceVersion: "1"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "mangodb.com",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb", Kind: "MangoDB", ListKind: "MangoDBList"},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{
+				Name:    "v1",
+				Served:  true,
+				Storage: true,
+				Schema: &apiextensionsv1.CustomResourceValidation{
+					OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{
+						Type: "object",
+						Properties: map[string]apiextensionsv1.JSONSchemaProps{
+							"spec": {Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{"tier": {Type: "string"}}},
+						},
+					},
+				},
+			}},
+		},
+	}
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(crd)
+	require.NoError(t, err)
+	provider := &unstructured.Unstructured{Object: obj}
+	provider.SetAPIVersion("apiextensions.k8s.io/v1")
+	provider.SetKind("CustomResourceDefinition")
+	versions, _, err := unstructured.NestedSlice(provider.Object, "spec", "versions")
+	require.NoError(t, err)
+	versions[0].(map[string]interface{})["selectableFields"] = []interface{}{map[string]interface{}{"jsonPath": ".spec.tier"}}
+	require.NoError(t, unstructured.SetNestedSlice(provider.Object, versions, "spec", "versions"))
+
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), provider)
+	crdIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	require.NoError(t, crdIndexer.Add(crd))
+	fields := &selectableFieldsCache{client: client, crdLister: apiextensionslisters.NewCustomResourceDefinitionLister(crdIndexer), fields: map[string]crdSelectableFields{}}
+
+	var created *kubebindv1alpha1.APIServiceExportResource
+	r := &reconciler{
+		minConsumerVersion: version.MustParseGeneric("1.29"),
+		getCRD: func(name string) (*apiextensionsv1.CustomResourceDefinition, error) {
+			return crd, nil
+		},
+		getCRDSelectableFields: fields.get,
+		getServiceExportResource: func(ns, name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+			return nil, errors.NewNotFound(kubebindv1alpha1.Resource("apiserviceexportresources"), name)
+		},
+		createServiceExportResource: func(ctx context.Context, resource *kubebindv1alpha1.APIServiceExportResource) (*kubebindv1alpha1.APIServiceExportResource, error) {
+			created = resource
+			return resource, nil
+		},
+	}
+	export := &kubebindv1alpha1.APIServiceExport{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-abc", Name: "mangodbs.mangodb.com"},
+		Spec: kubebindv1alpha1.APIServiceExportSpec{
+			Resources: []kubebindv1alpha1.APIServiceExportGroupResource{{GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: "mangodbs"}}},
+		},
+	}
+
+	require.NoError(t, r.reconcile(context.Background(), export))
+	require.NotNil(t, created)
+	require.Equal(t, []kubebindv1alpha1.SelectableField{{JSONPath: ".spec.tier"}}, created.Spec.Versions[0].SelectableFields)
+
+	cond := conditions.Get(export, kubebindv1alpha1.APIServiceExportConditionConsumerVersionSupported)
+	require.NotNil(t, cond)
+	require.Equal(t, corev1.ConditionFalse, cond.Status)
+	require.Contains(t, cond.Message, "selectableFields (requires 1.30)")
+
+	// the fields are read once per resource version of the CRD.
+	require.Len(t, client.Actions(), 1)
+	_, err = fields.get(context.Background(), crd)
+	require.NoError(t, err)
+	require.Len(t, client.Actions(), 1)
+	crd = crd.DeepCopy()
+	crd.ResourceVersion = "2"
+	_, err = fields.get(context.Background(), crd)
+	require.NoError(t, err)
+	require.Len(t, client.Actions(), 2)
+
+	// fields of deleted CRDs are dropped.
+	fields.fields["gone.example.com"] = crdSelectableFields{resourceVersion: "1"}
+	crd = crd.DeepCopy()
+	crd.ResourceVersion = "3"
+	_, err = fields.get(context.Background(), crd)
+	require.NoError(t, err)
+	require.Equal(t, []string{"mangodbs.mangodb.com"}, sets.StringKeySet(fields.fields).List())
+}
@@ -0,0 +1,201 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tokenrefresh
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	kubernetesclient "k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	kuberesources "github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes/resources"
+)
+
+const (
+	controllerName = "kube-bind-example-backend-tokenrefresh"
+)
+
+// NewController returns a new controller re-minting bound service account tokens of
+// kubeconfig secrets before they expire. The konnector syncs the updated kubeconfig
+// secret to the consumer.
+func NewController(
+	config *rest.Config,
+	ttl time.Duration,
+	secretInformer coreinformers.SecretInformer,
+) (*Controller, error) {
+	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName)
+
+	logger := klog.Background().WithValues("controller", controllerName)
+
+	clusterConfig := rest.CopyConfig(config)
+	config = rest.CopyConfig(config)
+	config = rest.AddUserAgent(config, controllerName)
+
+	kubeClient, err := kubernetesclient.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Controller{
+		queue: queue,
+
+		kubeClient: kubeClient,
+
+		secretLister:  secretInformer.Lister(),
+		secretIndexer: secretInformer.Informer().GetIndexer(),
+
+		reconciler: reconciler{
+			ttl: ttl,
+			now: time.Now,
+			refresh: func(ctx context.Context, ns string) error {
+				_, err := kuberesources.GenerateBoundTokenKubeconfig(ctx, kubeClient, clusterConfig, ns, kuberesources.ClusterAdminName, ttl, nil)
+				return err
+			},
+		},
+	}
+
+	secretInformer.Informer().AddEventHandler(cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			secret, ok := obj.(*corev1.Secret)
+			if !ok {
+				return false
+			}
+			_, found := secret.Annotations[kuberesources.TokenExpirationAnnotationKey]
+			return found
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				c.enqueueSecret(logger, obj)
+			},
+			UpdateFunc: func(old, newObj interface{}) {
+				c.enqueueSecret(logger, newObj)
+			},
+		},
+	})
+
+	return c, nil
+}
+
+// Controller refreshes kubeconfig secrets with bound service account tokens.
+type Controller struct {
+	queue workqueue.RateLimitingInterface
+
+	kubeClient kubernetesclient.Interface
+
+	secretLister  corelisters.SecretLister
+	secretIndexer cache.Indexer
+
+	reconciler
+}
+
+func (c *Controller) enqueueSecret(logger klog.Logger, obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+
+	logger.V(2).Info("queueing Secret", "key", key)
+	c.queue.Add(key)
+}
+
+// Start starts the controller, which stops when ctx.Done() is closed.
+func (c *Controller) Start(ctx context.Context, numThreads int) {
+	defer runtime.HandleCrash()
+	defer c.queue.ShutDown()
+
+	logger := klog.FromContext(ctx).WithValues("controller", controllerName)
+
+	logger.Info("Starting controller")
+	defer logger.Info("Shutting down controller")
+
+	for i := 0; i < numThreads; i++ {
+		go wait.UntilWithContext(ctx, c.startWorker, time.Second)
+	}
+
+	<-ctx.Done()
+}
+
+func (c *Controller) startWorker(ctx context.Context) {
+	defer runtime.HandleCrash()
+
+	for c.processNextWorkItem(ctx) {
+	}
+}
+
+func (c *Controller) processNextWorkItem(ctx context.Context) bool {
+	// Wait until there is a new item in the working queue
+	k, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	key := k.(string)
+
+	logger := klog.FromContext(ctx).WithValues("key", key)
+	ctx = klog.NewContext(ctx, logger)
+	logger.V(2).Info("processing key")
+
+	// No matter what, tell the queue we're done with this key, to unblock
+	// other workers.
+	defer c.queue.Done(key)
+
+	requeueAfter, err := c.process(ctx, key)
+	if err != nil {
+		runtime.HandleError(fmt.Errorf("%q controller failed to sync %q, err: %w", controllerName, key, err))
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	if requeueAfter > 0 {
+		c.queue.AddAfter(key, requeueAfter)
+	}
+	return true
+}
+
+func (c *Controller) process(ctx context.Context, key string) (time.Duration, error) {
+	logger := klog.FromContext(ctx)
+
+	ns, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		runtime.HandleError(err)
+		return 0, nil // we cannot do anything
+	}
+
+	obj, err := c.secretLister.Secrets(ns).Get(name)
+	if err != nil && !errors.IsNotFound(err) {
+		return 0, err
+	} else if errors.IsNotFound(err) {
+		logger.V(2).Info("Secret not found, ignoring")
+		return 0, nil // nothing we can do
+	}
+
+	return c.reconcile(ctx, obj)
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tokenrefresh
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+
+	kuberesources "github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes/resources"
+)
+
+// minRefreshInterval is the minimal time between two refreshes of a token, which stops
+// refresh loops if the API server issues tokens of a very short lifetime.
+const minRefreshInterval = time.Minute
+
+type reconciler struct {
+	// ttl is the requested token lifetime, assumed for secrets without issue time.
+	ttl time.Duration
+	now func() time.Time
+
+	// refresh mints a new bound token for the kubeconfig secret of the namespace.
+	refresh func(ctx context.Context, ns string) error
+}
+
+// reconcile refreshes the token of the secret once less than a third of the issued
+// lifetime is left, and otherwise returns the time until then.
+func (r *reconciler) reconcile(ctx context.Context, secret *corev1.Secret) (time.Duration, error) {
+	logger := klog.FromContext(ctx)
+
+	value, found := secret.Annotations[kuberesources.TokenExpirationAnnotationKey]
+	if !found {
+		return 0, nil
+	}
+	expiration, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		// unparsable, mint a new token to fix it.
+		logger.Info("invalid token expiration, refreshing token", "expiration", value)
+		return 0, r.refresh(ctx, secret.Namespace)
+	}
+
+	// the issued lifetime can be shorter than the requested ttl, e.g. capped by the API server.
+	lifetime := r.ttl
+	issuedAt := expiration.Add(-r.ttl)
+	if value, found := secret.Annotations[kuberesources.TokenIssuedAtAnnotationKey]; found {
+		if t, err := time.Parse(time.RFC3339, value); err != nil {
+			logger.Info("invalid token issue time, assuming the requested TTL", "issuedAt", value)
+		} else if expiration.After(t) {
+			issuedAt, lifetime = t, expiration.Sub(t)
+		}
+	}
+
+	refreshAt := expiration.Add(-lifetime / 3)
+	if earliest := issuedAt.Add(minRefreshInterval); refreshAt.Before(earliest) {
+		refreshAt = earliest
+	}
+	if wait := refreshAt.Sub(r.now()); wait > 0 {
+		if wait < minRefreshInterval {
+			wait = minRefreshInterval
+		}
+		return wait, nil
+	}
+
+	logger.Info("Refreshing service account token", "expiration", value)
+	if err := r.refresh(ctx, secret.Namespace); errors.IsNotFound(err) {
+		// the service account was deleted to rotate the credentials. The next bind recreates it.
+		logger.Info("Service account not found, not refreshing token")
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to refresh token: %w", err)
+	}
+	return 0, nil
+}
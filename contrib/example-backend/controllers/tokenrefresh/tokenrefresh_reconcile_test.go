@@ -0,0 +1,160 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tokenrefresh
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/clientcmd"
+
+	kuberesources "github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes/resources"
+)
+
+func TestReconcile(t *testing.T) {
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	ttl := time.Hour
+
+	tests := []struct {
+		name        string
+		expiration  string
+		issuedAt    string
+		wantRefresh bool
+		wantRequeue time.Duration
+	}{
+		{name: "fresh token", expiration: now.Add(50 * time.Minute).Format(time.RFC3339), wantRequeue: 30 * time.Minute},
+		{name: "near expiry", expiration: now.Add(10 * time.Minute).Format(time.RFC3339), wantRefresh: true},
+		{name: "expired", expiration: now.Add(-time.Minute).Format(time.RFC3339), wantRefresh: true},
+		{name: "invalid expiration", expiration: "tomorrow", wantRefresh: true},
+		{
+			name:        "shorter issued lifetime",
+			expiration:  now.Add(10 * time.Minute).Format(time.RFC3339),
+			issuedAt:    now.Add(-5 * time.Minute).Format(time.RFC3339),
+			wantRequeue: 5 * time.Minute,
+		},
+		{
+			name:        "longer issued lifetime",
+			expiration:  now.Add(10 * time.Minute).Format(time.RFC3339),
+			issuedAt:    now.Add(-3 * time.Hour).Format(time.RFC3339),
+			wantRefresh: true,
+		},
+		{
+			name:        "just issued",
+			expiration:  now.Add(30 * time.Second).Format(time.RFC3339),
+			issuedAt:    now.Format(time.RFC3339),
+			wantRequeue: time.Minute,
+		},
+		{name: "invalid issue time", expiration: now.Add(50 * time.Minute).Format(time.RFC3339), issuedAt: "yesterday", wantRequeue: 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			annotations := map[string]string{kuberesources.TokenExpirationAnnotationKey: tt.expiration}
+			if tt.issuedAt != "" {
+				annotations[kuberesources.TokenIssuedAtAnnotationKey] = tt.issuedAt
+			}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "kubeconfig",
+					Namespace:   "cluster-abc",
+					Annotations: annotations,
+				},
+				Data: map[string][]byte{"kubeconfig": []byte("old")},
+			}
+			client := fake.NewSimpleClientset(secret, &corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{Name: kuberesources.ClusterAdminName, Namespace: "cluster-abc"},
+			})
+			client.PrependReactor("create", "serviceaccounts", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				if action.GetSubresource() != "token" {
+					return false, nil, nil
+				}
+				req := action.(clienttesting.CreateAction).GetObject().(*authenticationv1.TokenRequest).DeepCopy()
+				require.Equal(t, int64(ttl/time.Second), *req.Spec.ExpirationSeconds)
+				req.Status = authenticationv1.TokenRequestStatus{
+					Token:               "new-token",
+					ExpirationTimestamp: metav1.NewTime(now.Add(ttl)),
+				}
+				return true, req, nil
+			})
+
+			r := reconciler{
+				ttl: ttl,
+				now: func() time.Time { return now },
+				refresh: func(ctx context.Context, ns string) error {
+					_, err := kuberesources.GenerateBoundTokenKubeconfig(ctx, client, &rest.Config{Host: "https://provider.example.com"}, ns, kuberesources.ClusterAdminName, ttl, nil)
+					return err
+				},
+			}
+
+			requeue, err := r.reconcile(ctx, secret)
+			require.NoError(t, err)
+			require.Equal(t, tt.wantRequeue, requeue)
+
+			got, err := client.CoreV1().Secrets("cluster-abc").Get(ctx, "kubeconfig", metav1.GetOptions{})
+			require.NoError(t, err)
+			if !tt.wantRefresh {
+				require.Equal(t, secret, got)
+				return
+			}
+			require.Equal(t, now.Add(ttl).Format(time.RFC3339), got.Annotations[kuberesources.TokenExpirationAnnotationKey])
+			_, err = time.Parse(time.RFC3339, got.Annotations[kuberesources.TokenIssuedAtAnnotationKey])
+			require.NoError(t, err)
+			cfg, err := clientcmd.Load(got.Data["kubeconfig"])
+			require.NoError(t, err)
+			require.Equal(t, "new-token", cfg.AuthInfos["default"].Token)
+			require.Equal(t, "cluster-abc", cfg.Contexts["default"].Namespace)
+		})
+	}
+}
+
+func TestReconcileServiceAccountDeleted(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	r := reconciler{
+		ttl: time.Hour,
+		now: time.Now,
+		refresh: func(ctx context.Context, ns string) error {
+			_, err := kuberesources.GenerateBoundTokenKubeconfig(ctx, client, &rest.Config{}, ns, kuberesources.ClusterAdminName, time.Hour, nil)
+			return err
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "kubeconfig",
+			Namespace:   "cluster-abc",
+			Annotations: map[string]string{kuberesources.TokenExpirationAnnotationKey: time.Now().Add(-time.Minute).Format(time.RFC3339)},
+		},
+	}
+
+	requeue, err := r.reconcile(ctx, secret)
+	require.NoError(t, err)
+	require.Zero(t, requeue)
+
+	_, err = client.CoreV1().Secrets("cluster-abc").Get(ctx, "kubeconfig", metav1.GetOptions{})
+	require.True(t, errors.IsNotFound(err), "no kubeconfig must be written without a token")
+}
@@ -23,6 +23,9 @@ import (
 	"time"
 )
 
+// DefaultNamePrefix is followed by the session id in the session cookie names.
+const DefaultNamePrefix = "kube-bind-"
+
 func MakeCookie(req *http.Request, name string, value []byte, expiration time.Duration) *http.Cookie {
 	return &http.Cookie{
 		Name:     name,
@@ -37,6 +40,14 @@ func MakeCookie(req *http.Request, name string, value []byte, expiration time.Du
 	}
 }
 
+// ClearCookie returns a cookie that makes the browser drop the cookie with the given name.
+func ClearCookie(req *http.Request, name string) *http.Cookie {
+	c := MakeCookie(req, name, nil, 0)
+	c.Expires = time.Unix(0, 0)
+	c.MaxAge = -1
+	return c
+}
+
 func ParseSameSite(v string) http.SameSite {
 	switch v {
 	case "lax":
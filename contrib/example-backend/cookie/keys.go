@@ -0,0 +1,151 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cookie
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// MinKeyLength is the minimal length of a signing key in bytes.
+const MinKeyLength = 32
+
+var (
+	errInvalidSignature = errors.New("invalid signature")
+	errDecryptionFailed = errors.New("decryption failed")
+)
+
+// KeySet signs and encrypts values with its first key, and verifies and decrypts them
+// with any of its keys. Keys are rotated by prepending the new key and removing the old
+// one after a grace period, during which values signed or encrypted with it stay valid.
+// A nil KeySet neither signs nor encrypts.
+type KeySet struct {
+	keys [][]byte
+}
+
+// NewKeySet returns a KeySet signing with the first of the given keys.
+func NewKeySet(keys ...[]byte) (*KeySet, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one key is required")
+	}
+	for i, key := range keys {
+		if len(key) < MinKeyLength {
+			return nil, fmt.Errorf("key %d is shorter than %d bytes", i, MinKeyLength)
+		}
+	}
+	return &KeySet{keys: keys}, nil
+}
+
+// Derive returns the key set for the given purpose, whose keys are derived from the
+// keys of s with HMAC-SHA256 over the purpose. Values signed or encrypted for one
+// purpose are hence invalid for any other. Rotation carries over. Nil stays nil.
+func (s *KeySet) Derive(purpose string) *KeySet {
+	if s == nil {
+		return nil
+	}
+	derived := make([][]byte, 0, len(s.keys))
+	for _, key := range s.keys {
+		derived = append(derived, mac(key, []byte("kube-bind "+purpose)))
+	}
+	return &KeySet{keys: derived}
+}
+
+// Sign returns the value with the HMAC-SHA256 of the current key appended.
+func (s *KeySet) Sign(value []byte) []byte {
+	if s == nil {
+		return value
+	}
+	signed := make([]byte, 0, len(value)+sha256.Size)
+	signed = append(signed, value...)
+	return append(signed, mac(s.keys[0], value)...)
+}
+
+// Verify returns the value of a signed value if any of the keys signed it.
+func (s *KeySet) Verify(signed []byte) ([]byte, error) {
+	if s == nil {
+		return signed, nil
+	}
+	if len(signed) < sha256.Size {
+		return nil, errInvalidSignature
+	}
+	value, sum := signed[:len(signed)-sha256.Size], signed[len(signed)-sha256.Size:]
+	for _, key := range s.keys {
+		if hmac.Equal(sum, mac(key, value)) {
+			return value, nil
+		}
+	}
+	return nil, errInvalidSignature
+}
+
+func mac(key, value []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(value)
+	return h.Sum(nil)
+}
+
+// Seal returns the value encrypted and authenticated with AES-256-GCM under the
+// current key, prefixed with the random nonce.
+func (s *KeySet) Seal(value []byte) ([]byte, error) {
+	if s == nil {
+		return value, nil
+	}
+	aead, err := newAEAD(s.keys[0])
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, value, nil), nil
+}
+
+// Open returns the value of a sealed value if any of the keys sealed it.
+func (s *KeySet) Open(sealed []byte) ([]byte, error) {
+	if s == nil {
+		return sealed, nil
+	}
+	for _, key := range s.keys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(sealed) < aead.NonceSize()+aead.Overhead() {
+			return nil, errDecryptionFailed
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if value, err := aead.Open(nil, nonce, ciphertext, nil); err == nil {
+			return value, nil
+		}
+	}
+	return nil, errDecryptionFailed
+}
+
+// newAEAD returns AES-256-GCM with a key derived from the given one, such that the
+// same key set can sign and encrypt without reusing key material.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(mac(key, []byte("kube-bind aes-256-gcm")))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cookie
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeySetRotation(t *testing.T) {
+	oldKey := bytes.Repeat([]byte("o"), MinKeyLength)
+	newKey := bytes.Repeat([]byte("n"), MinKeyLength)
+
+	before, err := NewKeySet(oldKey)
+	require.NoError(t, err)
+	signedOld := before.Sign([]byte("value"))
+
+	// the new key signs, the old one keeps verifying during rotation.
+	rotating, err := NewKeySet(newKey, oldKey)
+	require.NoError(t, err)
+	got, err := rotating.Verify(signedOld)
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), got)
+	signedNew := rotating.Sign([]byte("value"))
+	require.NotEqual(t, signedOld, signedNew)
+
+	after, err := NewKeySet(newKey)
+	require.NoError(t, err)
+	got, err = after.Verify(signedNew)
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), got)
+	_, err = after.Verify(signedOld)
+	require.Error(t, err, "removed keys must not verify")
+
+	tampered := append([]byte("other"), signedNew[len("value"):]...)
+	_, err = after.Verify(tampered)
+	require.Error(t, err)
+	_, err = after.Verify([]byte("short"))
+	require.Error(t, err)
+}
+
+func TestKeySetSealRotation(t *testing.T) {
+	oldKey := bytes.Repeat([]byte("o"), MinKeyLength)
+	newKey := bytes.Repeat([]byte("n"), MinKeyLength)
+
+	before, err := NewKeySet(oldKey)
+	require.NoError(t, err)
+	sealedOld, err := before.Seal([]byte("secret value"))
+	require.NoError(t, err)
+	require.NotContains(t, string(sealedOld), "secret value")
+	again, err := before.Seal([]byte("secret value"))
+	require.NoError(t, err)
+	require.NotEqual(t, sealedOld, again, "nonces must be random")
+
+	// the new key encrypts, the old one keeps decrypting during rotation.
+	rotating, err := NewKeySet(newKey, oldKey)
+	require.NoError(t, err)
+	got, err := rotating.Open(sealedOld)
+	require.NoError(t, err)
+	require.Equal(t, []byte("secret value"), got)
+	sealedNew, err := rotating.Seal([]byte("secret value"))
+	require.NoError(t, err)
+
+	after, err := NewKeySet(newKey)
+	require.NoError(t, err)
+	got, err = after.Open(sealedNew)
+	require.NoError(t, err)
+	require.Equal(t, []byte("secret value"), got)
+	_, err = after.Open(sealedOld)
+	require.Error(t, err, "removed keys must not decrypt")
+
+	tampered := append([]byte{}, sealedNew...)
+	tampered[len(tampered)-1] ^= 1
+	_, err = after.Open(tampered)
+	require.Error(t, err)
+	_, err = after.Open([]byte("short"))
+	require.Error(t, err)
+
+	// the signing and encryption keys differ, hence a value signed with the key set
+	// does not decrypt, nor vice versa.
+	_, err = after.Open(after.Sign([]byte("secret value")))
+	require.Error(t, err)
+	_, err = after.Verify(sealedNew)
+	require.Error(t, err)
+}
+
+func TestKeySetDerive(t *testing.T) {
+	oldKey := bytes.Repeat([]byte("o"), MinKeyLength)
+	newKey := bytes.Repeat([]byte("n"), MinKeyLength)
+	keys, err := NewKeySet(oldKey)
+	require.NoError(t, err)
+
+	cookies, states := keys.Derive("cookie"), keys.Derive("state")
+	signed := states.Sign([]byte("value"))
+	_, err = cookies.Verify(signed)
+	require.Error(t, err, "values of one purpose must be invalid for another")
+	_, err = keys.Verify(signed)
+	require.Error(t, err, "derived keys must differ from the root keys")
+	got, err := keys.Derive("state").Verify(signed)
+	require.NoError(t, err, "derivation must be deterministic")
+	require.Equal(t, []byte("value"), got)
+
+	// rotation carries over to the derived keys.
+	rotating, err := NewKeySet(newKey, oldKey)
+	require.NoError(t, err)
+	got, err = rotating.Derive("state").Verify(signed)
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), got)
+}
+
+func TestNilKeySet(t *testing.T) {
+	var keys *KeySet
+	require.Equal(t, []byte("value"), keys.Sign([]byte("value")))
+	got, err := keys.Verify([]byte("value"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), got)
+	require.Nil(t, keys.Derive("cookie"))
+	sealed, err := keys.Seal([]byte("value"))
+	require.NoError(t, err)
+	got, err = keys.Open(sealed)
+	require.NoError(t, err)
+	require.Equal(t, []byte("value"), got)
+}
+
+func TestNewKeySet(t *testing.T) {
+	_, err := NewKeySet()
+	require.Error(t, err)
+	_, err = NewKeySet(bytes.Repeat([]byte("k"), MinKeyLength), []byte("short"))
+	require.ErrorContains(t, err, "key 1 is shorter than 32 bytes")
+}
+
+func TestDecodeEncryptedSession(t *testing.T) {
+	oldKeys, err := NewKeySet(bytes.Repeat([]byte("o"), MinKeyLength))
+	require.NoError(t, err)
+	newKeys, err := NewKeySet(bytes.Repeat([]byte("n"), MinKeyLength))
+	require.NoError(t, err)
+
+	state := &SessionState{SessionID: "abc", RedirectURL: "http://localhost:1234/callback"}
+	bs, err := state.Encode()
+	require.NoError(t, err)
+	sealed, err := oldKeys.Seal(bs)
+	require.NoError(t, err)
+	value := MakeCookie(nil, "kube-bind-abc", sealed, 0).Value
+
+	got, err := Decode(value, oldKeys)
+	require.NoError(t, err)
+	require.Equal(t, state, got)
+	_, err = Decode(value, newKeys)
+	require.Error(t, err)
+}
@@ -37,21 +37,38 @@ type SessionState struct {
 
 	RedirectURL string `msgpack:"ru,omitempty"`
 	SessionID   string `msgpack:"si,omitempty"`
+	// ClientSessionID is the session id chosen by the consumer if SessionID was generated by the backend.
+	ClientSessionID string `msgpack:"cs,omitempty"`
+	// CorrelationID is the id the consumer passed at /authorize to correlate the flow.
+	CorrelationID string `msgpack:"ci,omitempty"`
+
+	// ServerSide is set on states too large for a cookie. The cookie then only carries
+	// the SessionID, and the state is kept in the server-side session store.
+	ServerSide bool `msgpack:"ss,omitempty"`
 }
 
 func (s *SessionState) Encode() ([]byte, error) {
 	return msgpack.Marshal(s)
 }
 
-func Decode(data string) (*SessionState, error) {
+// Decode decodes the value of a session cookie, decrypting it with the keys.
+func Decode(data string, keys *KeySet) (*SessionState, error) {
 	decoded, err := base64.RawURLEncoding.DecodeString(data)
 	if err != nil {
 		return nil, err
 	}
+	decoded, err = keys.Open(decoded)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting session state: %w", err)
+	}
 
+	return DecodeState(decoded)
+}
+
+// DecodeState decodes an encoded session state, e.g. one kept server-side.
+func DecodeState(data []byte) (*SessionState, error) {
 	var ss SessionState
-	err = msgpack.Unmarshal(decoded, &ss)
-	if err != nil {
+	if err := msgpack.Unmarshal(data, &ss); err != nil {
 		return nil, fmt.Errorf("error unmarshalling data to session state: %w", err)
 	}
 
@@ -0,0 +1,153 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+
+	"github.com/kube-bind/kube-bind/contrib/example-backend/session"
+)
+
+// SessionInfo is the metadata of a session shown to operators. It never carries tokens.
+type SessionInfo struct {
+	ID        string    `json:"id"`
+	Identity  string    `json:"identity"`
+	CreatedAt time.Time `json:"created"`
+	ExpiresAt time.Time `json:"expires"`
+	Expired   bool      `json:"expired"`
+}
+
+// SessionList is the response of listing sessions.
+type SessionList struct {
+	Sessions []SessionInfo `json:"sessions"`
+}
+
+// PurgeResult is the response of purging expired sessions.
+type PurgeResult struct {
+	Purged int `json:"purged"`
+}
+
+// MaintenanceStatus is the request and response of the maintenance mode endpoint.
+type MaintenanceStatus struct {
+	Enabled bool `json:"enabled"`
+}
+
+type adminHandler struct {
+	token       string
+	sessions    *session.Store
+	maintenance *Maintenance
+}
+
+// NewAdminHandler returns the handler of the /admin endpoints and /metrics. Requests
+// must carry the admin token as bearer token. The maintenance mode can be toggled if it is non-nil.
+func NewAdminHandler(token string, sessions *session.Store, maintenance *Maintenance) *adminHandler {
+	return &adminHandler{
+		token:       token,
+		sessions:    sessions,
+		maintenance: maintenance,
+	}
+}
+
+func (h *adminHandler) AddRoutes(mux *mux.Router) {
+	admin := mux.PathPrefix("/admin").Subrouter()
+	admin.Use(h.authenticate)
+	admin.HandleFunc("/sessions", h.handleListSessions).Methods("GET")
+	admin.HandleFunc("/sessions/purge", h.handlePurgeSessions).Methods("POST")
+	if h.maintenance != nil {
+		admin.HandleFunc("/maintenance", h.handleGetMaintenance).Methods("GET")
+		admin.HandleFunc("/maintenance", h.handleSetMaintenance).Methods("PUT")
+	}
+	// metrics reveal the load and the state of the IdP, hence require the token as well.
+	mux.Handle("/metrics", h.authenticate(legacyregistry.Handler())).Methods("GET")
+}
+
+func (h *adminHandler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if h.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, r, http.StatusUnauthorized, "A valid admin token is required.")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (h *adminHandler) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	list := SessionList{Sessions: []SessionInfo{}}
+	for _, s := range h.sessions.List() {
+		list.Sessions = append(list.Sessions, SessionInfo{
+			ID:        s.ID,
+			Identity:  s.Identity,
+			CreatedAt: s.CreatedAt,
+			ExpiresAt: s.ExpiresAt,
+			Expired:   h.sessions.Expired(s),
+		})
+	}
+
+	writeJSON(w, r, list)
+}
+
+func (h *adminHandler) handlePurgeSessions(w http.ResponseWriter, r *http.Request) {
+	logger := klog.FromContext(r.Context()).WithValues("method", r.Method, "url", r.URL.String())
+
+	purged := h.sessions.DeleteExpired()
+	logger.Info("purged expired sessions", "count", purged)
+
+	writeJSON(w, r, PurgeResult{Purged: purged})
+}
+
+func (h *adminHandler) handleGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, MaintenanceStatus{Enabled: h.maintenance.Enabled()})
+}
+
+func (h *adminHandler) handleSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	logger := klog.FromContext(r.Context()).WithValues("method", r.Method, "url", r.URL.String())
+
+	var status MaintenanceStatus
+	if err := json.NewDecoder(r.Body).Decode(&status); err != nil {
+		writeError(w, r, http.StatusBadRequest, "The body must be a JSON object like {\"enabled\": true}.")
+		return
+	}
+	h.maintenance.Set(status.Enabled)
+	logger.Info("set maintenance mode", "enabled", status.Enabled)
+
+	writeJSON(w, r, status)
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	logger := klog.FromContext(r.Context()).WithValues("method", r.Method, "url", r.URL.String())
+
+	bs, err := json.Marshal(v)
+	if err != nil {
+		logger.Error(err, "failed to marshal response")
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	prepareNoCache(w)
+	writeBody(w, contentTypeJSON, bs)
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kube-bind/kube-bind/contrib/example-backend/session"
+)
+
+func TestAdminSessions(t *testing.T) {
+	sessions := session.NewStore()
+	sessions.Add("active", "jane", time.Hour)
+	sessions.Add("expired", "joe", -time.Minute)
+
+	router := mux.NewRouter()
+	NewAdminHandler("s3cr3t", sessions, nil).AddRoutes(router)
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("token required", func(t *testing.T) {
+		for _, token := range []string{"", "wrong"} {
+			w := do(http.MethodGet, "/admin/sessions", token)
+			require.Equal(t, http.StatusUnauthorized, w.Code)
+			require.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+
+			w = do(http.MethodPost, "/admin/sessions/purge", token)
+			require.Equal(t, http.StatusUnauthorized, w.Code)
+		}
+		require.Len(t, sessions.List(), 2, "unauthenticated purge must not delete sessions")
+	})
+
+	t.Run("list", func(t *testing.T) {
+		w := do(http.MethodGet, "/admin/sessions", "s3cr3t")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NotContains(t, w.Body.String(), "token")
+
+		var list SessionList
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		require.Len(t, list.Sessions, 2)
+		byIdentity := map[string]SessionInfo{}
+		for _, s := range list.Sessions {
+			byIdentity[s.Identity] = s
+		}
+		require.Equal(t, "active", byIdentity["jane"].ID)
+		require.False(t, byIdentity["jane"].Expired)
+		require.Equal(t, "expired", byIdentity["joe"].ID)
+		require.True(t, byIdentity["joe"].Expired)
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		w := do(http.MethodPost, "/admin/sessions/purge", "s3cr3t")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var result PurgeResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		require.Equal(t, 1, result.Purged)
+
+		remaining := sessions.List()
+		require.Len(t, remaining, 1)
+		require.Equal(t, "active", remaining[0].ID)
+	})
+}
+
+func TestAdminMetrics(t *testing.T) {
+	router := mux.NewRouter()
+	NewAdminHandler("s3cr3t", session.NewStore(), nil).AddRoutes(router)
+
+	for _, token := range []string{"", "wrong"} {
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	r.Header.Set("Authorization", "Bearer s3cr3t")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "go_goroutines")
+}
+
+func TestAdminDisabledWithoutToken(t *testing.T) {
+	router := mux.NewRouter()
+	NewAdminHandler("", session.NewStore(), nil).AddRoutes(router)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/sessions", nil))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAdminMaintenance(t *testing.T) {
+	maintenance := NewMaintenance(false)
+	router := mux.NewRouter()
+	NewAdminHandler("s3cr3t", session.NewStore(), maintenance).AddRoutes(router)
+
+	do := func(method, body, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/admin/maintenance", strings.NewReader(body))
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do(http.MethodPut, `{"enabled":true}`, "wrong")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	require.False(t, maintenance.Enabled(), "unauthenticated requests must not toggle maintenance")
+
+	w = do(http.MethodPut, `{"enabled":true}`, "s3cr3t")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.True(t, maintenance.Enabled())
+
+	w = do(http.MethodGet, "", "s3cr3t")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"enabled":true}`, w.Body.String())
+
+	w = do(http.MethodPut, "on", "s3cr3t")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.True(t, maintenance.Enabled())
+
+	w = do(http.MethodPut, `{"enabled":false}`, "s3cr3t")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.False(t, maintenance.Enabled())
+}
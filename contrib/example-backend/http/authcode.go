@@ -0,0 +1,150 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kube-bind/kube-bind/contrib/example-backend/cookie"
+	"github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes/resources"
+	"github.com/kube-bind/kube-bind/contrib/example-backend/session"
+)
+
+const (
+	// StateAuthCodeStorage round-trips the AuthCode through the OAuth2 state parameter.
+	StateAuthCodeStorage = "state"
+	// ServerAuthCodeStorage keeps the AuthCode server-side and only sends an opaque id
+	// through the OAuth2 state parameter.
+	ServerAuthCodeStorage = "server"
+
+	// authCodeTTL is how long a server-side AuthCode waits for the callback if
+	// the state age is not limited.
+	authCodeTTL = 10 * time.Minute
+)
+
+var (
+	errAuthCodeNotFound = errors.New("authorization expired or already completed, please restart the binding")
+	errAuthCodeExpired  = errors.New("authorization expired, please restart the binding")
+)
+
+// authCodeStorage carries the AuthCode from the authorize request through the
+// identity provider to the callback.
+type authCodeStorage interface {
+	// Encode returns the state parameter for the code.
+	Encode(code *resources.AuthCode) (string, error)
+	// Decode returns the code of the state parameter.
+	Decode(state string) (*resources.AuthCode, error)
+}
+
+func newAuthCodeStorage(kind string, authCodes *session.ClaimStore, ttl time.Duration, keys *cookie.KeySet) (authCodeStorage, error) {
+	if ttl == 0 {
+		ttl = authCodeTTL
+	}
+	switch kind {
+	case StateAuthCodeStorage:
+		if keys == nil {
+			// the state passes the identity provider, hence is signed in any case.
+			key := make([]byte, cookie.MinKeyLength)
+			if _, err := rand.Read(key); err != nil {
+				return nil, fmt.Errorf("failed to generate state signing key: %w", err)
+			}
+			var err error
+			if keys, err = cookie.NewKeySet(key); err != nil {
+				return nil, err
+			}
+		}
+		return stateAuthCodeStorage{keys: keys}, nil
+	case ServerAuthCodeStorage:
+		return &serverAuthCodeStorage{authCodes: authCodes, ttl: ttl}, nil
+	default:
+		return nil, fmt.Errorf("unknown auth code storage %q, must be one of %q or %q", kind, StateAuthCodeStorage, ServerAuthCodeStorage)
+	}
+}
+
+// stateAuthCodeStorage encodes the code into the signed state parameter, such that
+// neither the redirect URL nor the issue time can be tampered with on the way through
+// the identity provider.
+type stateAuthCodeStorage struct {
+	keys *cookie.KeySet
+}
+
+func (s stateAuthCodeStorage) Encode(code *resources.AuthCode) (string, error) {
+	bs, err := json.Marshal(code)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(s.keys.Sign(bs)), nil
+}
+
+func (s stateAuthCodeStorage) Decode(state string) (*resources.AuthCode, error) {
+	bs, err := base64.StdEncoding.DecodeString(state)
+	if err != nil {
+		return nil, err
+	}
+	if bs, err = s.keys.Verify(bs); err != nil {
+		return nil, err
+	}
+	code := &resources.AuthCode{}
+	if err := json.Unmarshal(bs, code); err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// serverAuthCodeStorage stores the code server-side under an opaque one-time id,
+// such that the redirect URL and session id cannot be tampered with.
+type serverAuthCodeStorage struct {
+	authCodes *session.ClaimStore
+	ttl       time.Duration
+}
+
+func (s *serverAuthCodeStorage) Encode(code *resources.AuthCode) (string, error) {
+	bs, err := json.Marshal(code)
+	if err != nil {
+		return "", err
+	}
+	return s.authCodes.Put(bs, s.ttl)
+}
+
+func (s *serverAuthCodeStorage) Decode(state string) (*resources.AuthCode, error) {
+	bs, found := s.authCodes.Take(state)
+	if !found {
+		return nil, errAuthCodeNotFound
+	}
+	code := &resources.AuthCode{}
+	if err := json.Unmarshal(bs, code); err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// validateAuthCodeAge returns errAuthCodeExpired if the code was issued longer than
+// ttl ago at now, or without an issue time. Zero ttl accepts any code.
+func validateAuthCodeAge(code *resources.AuthCode, now time.Time, ttl time.Duration) error {
+	if ttl == 0 {
+		return nil
+	}
+	if code.IssuedAt == 0 || now.Sub(time.Unix(code.IssuedAt, 0)) > ttl {
+		return errAuthCodeExpired
+	}
+	return nil
+}
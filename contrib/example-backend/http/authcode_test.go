@@ -0,0 +1,188 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	oidc "github.com/coreos/go-oidc"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kube-bind/kube-bind/contrib/example-backend/cookie"
+	"github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes/resources"
+	"github.com/kube-bind/kube-bind/contrib/example-backend/session"
+)
+
+func TestAuthCodeStorage(t *testing.T) {
+	code := &resources.AuthCode{RedirectURL: "http://localhost:1234/callback", SessionID: "abc"}
+
+	_, err := newAuthCodeStorage("cookie", session.NewClaimStore(), 0, nil)
+	require.Error(t, err)
+
+	t.Run("state", func(t *testing.T) {
+		storage, err := newAuthCodeStorage(StateAuthCodeStorage, nil, 0, nil)
+		require.NoError(t, err)
+
+		state, err := storage.Encode(code)
+		require.NoError(t, err)
+		decoded, err := base64.StdEncoding.DecodeString(state)
+		require.NoError(t, err)
+		require.Contains(t, string(decoded), code.RedirectURL, "the code travels in the state")
+
+		got, err := storage.Decode(state)
+		require.NoError(t, err)
+		require.Equal(t, code, got)
+		got, err = storage.Decode(state)
+		require.NoError(t, err, "stateless decoding can be repeated")
+		require.Equal(t, code, got)
+
+		_, err = storage.Decode("not base64!")
+		require.Error(t, err)
+	})
+
+	t.Run("signed state", func(t *testing.T) {
+		oldKey := bytes.Repeat([]byte("o"), cookie.MinKeyLength)
+		newKey := bytes.Repeat([]byte("n"), cookie.MinKeyLength)
+		newStorage := func(keys ...[]byte) authCodeStorage {
+			keySet, err := cookie.NewKeySet(keys...)
+			require.NoError(t, err)
+			storage, err := newAuthCodeStorage(StateAuthCodeStorage, nil, 0, keySet)
+			require.NoError(t, err)
+			return storage
+		}
+
+		state, err := newStorage(oldKey).Encode(code)
+		require.NoError(t, err)
+
+		// a state issued before the rotation keeps working until the old key is removed.
+		got, err := newStorage(newKey, oldKey).Decode(state)
+		require.NoError(t, err)
+		require.Equal(t, code, got)
+		_, err = newStorage(newKey).Decode(state)
+		require.Error(t, err)
+
+		unsigned, err := (stateAuthCodeStorage{}).Encode(code)
+		require.NoError(t, err)
+		_, err = newStorage(newKey, oldKey).Decode(unsigned)
+		require.Error(t, err, "unsigned states must be rejected")
+	})
+
+	t.Run("server", func(t *testing.T) {
+		storage, err := newAuthCodeStorage(ServerAuthCodeStorage, session.NewClaimStore(), 0, nil)
+		require.NoError(t, err)
+
+		state, err := storage.Encode(code)
+		require.NoError(t, err)
+		require.NotContains(t, state, "abc")
+		decoded, _ := base64.StdEncoding.DecodeString(state)
+		require.NotContains(t, string(decoded), code.RedirectURL, "the state must be opaque")
+
+		// a tampered state does not map to any code.
+		tampered, err := (stateAuthCodeStorage{}).Encode(&resources.AuthCode{RedirectURL: "http://evil.example.com/callback", SessionID: "abc"})
+		require.NoError(t, err)
+		_, err = storage.Decode(tampered)
+		require.ErrorIs(t, err, errAuthCodeNotFound)
+
+		got, err := storage.Decode(state)
+		require.NoError(t, err)
+		require.Equal(t, code, got)
+		_, err = storage.Decode(state)
+		require.ErrorIs(t, err, errAuthCodeNotFound, "server-side codes are single use")
+	})
+}
+
+func TestAuthorizeServerAuthCodeStorage(t *testing.T) {
+	h := newTestHandler(t, HandlerOptions{
+		AuthCodeStorage: ServerAuthCodeStorage,
+	})
+	h.oidc = &OIDCServiceProvider{provider: &oidc.Provider{}}
+
+	w := httptest.NewRecorder()
+	h.handleAuthorize(w, httptest.NewRequest(http.MethodGet, "/authorize?u=http://localhost:1234/callback&s=abc", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	state := location.Query().Get("state")
+	require.NotContains(t, state, "localhost")
+
+	code, err := h.authCodes.Decode(state)
+	require.NoError(t, err)
+	require.Equal(t, "http://localhost:1234/callback", code.RedirectURL)
+	require.Equal(t, "abc", code.SessionID)
+	require.NotZero(t, code.IssuedAt)
+
+	// the callback rejects a state that was already used.
+	w = httptest.NewRecorder()
+	h.handleCallback(w, httptest.NewRequest(http.MethodGet, "/callback?code=xyz&state="+url.QueryEscape(state), nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "restart the binding")
+}
+
+func TestValidateAuthCodeAge(t *testing.T) {
+	now := time.Date(2022, time.October, 1, 12, 0, 0, 0, time.UTC)
+	issued := func(age time.Duration) *resources.AuthCode {
+		return &resources.AuthCode{RedirectURL: "http://localhost:1234/callback", SessionID: "abc", IssuedAt: now.Add(-age).Unix()}
+	}
+
+	require.NoError(t, validateAuthCodeAge(issued(time.Minute), now, 10*time.Minute))
+	require.NoError(t, validateAuthCodeAge(issued(10*time.Minute), now, 10*time.Minute))
+	require.ErrorIs(t, validateAuthCodeAge(issued(11*time.Minute), now, 10*time.Minute), errAuthCodeExpired)
+	require.ErrorIs(t, validateAuthCodeAge(&resources.AuthCode{SessionID: "abc"}, now, 10*time.Minute), errAuthCodeExpired, "codes without issue time are rejected")
+	require.NoError(t, validateAuthCodeAge(issued(24*time.Hour), now, 0), "zero ttl accepts any age")
+}
+
+func TestCallbackStateTTL(t *testing.T) {
+	h := newTestHandler(t, HandlerOptions{
+		StateTTL: 10 * time.Minute,
+	})
+	h.oidc = &OIDCServiceProvider{provider: &oidc.Provider{}}
+
+	// a fresh state from /authorize passes the age check and fails at the token exchange.
+	w := httptest.NewRecorder()
+	h.handleAuthorize(w, httptest.NewRequest(http.MethodGet, "/authorize?u=http://localhost:1234/callback&s=abc", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	h.oidc = &OIDCServiceProvider{provider: &oidc.Provider{}, breaker: newCircuitBreaker("test", 0, time.Minute, isTokenExchangeFailure)}
+	w = httptest.NewRecorder()
+	h.handleCallback(w, httptest.NewRequest(http.MethodGet, "/callback?code=xyz&state="+url.QueryEscape(location.Query().Get("state")), nil))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.NotContains(t, w.Body.String(), "authorization expired")
+
+	// a replayed old state is rejected before the code is exchanged.
+	stale, err := h.authCodes.Encode(&resources.AuthCode{RedirectURL: "http://localhost:1234/callback", SessionID: "abc", IssuedAt: time.Now().Add(-time.Hour).Unix()})
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	h.handleCallback(w, httptest.NewRequest(http.MethodGet, "/callback?code=xyz&state="+url.QueryEscape(stale), nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "authorization expired")
+
+	// a state with a forged issue time is rejected, the state is signed without configured keys too.
+	forged, err := json.Marshal(&resources.AuthCode{RedirectURL: "http://localhost:1234/callback", SessionID: "abc", IssuedAt: time.Now().Unix()})
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	h.handleCallback(w, httptest.NewRequest(http.MethodGet, "/callback?code=xyz&state="+url.QueryEscape(base64.StdEncoding.EncodeToString(forged)), nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "invalid signature")
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"context"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+// BindRequest is a bind to be authorized.
+type BindRequest struct {
+	// Identity is the identity derived from the claims.
+	Identity string
+	// Claims are the ID token claims of the user.
+	Claims map[string]interface{}
+
+	// CRD is the requested exported resource.
+	CRD      *apiextensionsv1.CustomResourceDefinition
+	Group    string
+	Resource string
+	// Version is the pinned version, or empty for all served versions.
+	Version string
+
+	// TargetNamespace is the requested namespace on the service provider cluster, or empty.
+	TargetNamespace string
+	// Rotate is true if the credentials of the identity are rotated.
+	Rotate bool
+}
+
+// Authorizer approves or denies binds before anything is provisioned for them.
+type Authorizer interface {
+	// Authorize returns whether the bind is allowed. The reason is shown to the user
+	// if denied. An error fails the bind without a decision.
+	Authorize(ctx context.Context, req *BindRequest) (allowed bool, reason string, err error)
+}
+
+// AuthorizerFunc is an Authorizer as function.
+type AuthorizerFunc func(ctx context.Context, req *BindRequest) (allowed bool, reason string, err error)
+
+func (f AuthorizerFunc) Authorize(ctx context.Context, req *BindRequest) (bool, string, error) {
+	return f(ctx, req)
+}
+
+// AllowAll is the default Authorizer, allowing every bind.
+var AllowAll Authorizer = AuthorizerFunc(func(ctx context.Context, req *BindRequest) (bool, string, error) {
+	return true, "", nil
+})
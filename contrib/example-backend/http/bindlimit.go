@@ -0,0 +1,132 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+var (
+	// errBindingLimitReached is returned when a subject has bound the maximal number of resources.
+	errBindingLimitReached = errors.New("binding limit reached")
+	// errBindingInProgress is returned when the limit is only reached because of binds
+	// in flight, which might still fail.
+	errBindingInProgress = errors.New("binding in progress")
+)
+
+// bindingLimiter limits the number of resources an identity can bind. Binds in flight
+// are counted too, such that concurrent binds cannot exceed the limit together.
+type bindingLimiter struct {
+	max int
+	// bound returns the names of the resources bound by the identity.
+	bound func(ctx context.Context, identity string) ([]string, error)
+
+	// lock guards identities only. Listing bound resources happens under the lock of
+	// the identity, such that slow listings do not hold up binds of other identities.
+	lock       sync.Mutex
+	identities map[string]*identityLimit
+}
+
+// identityLimit is the state of one identity, kept while any bind of it is reserved or
+// waiting for the lock.
+type identityLimit struct {
+	lock     sync.Mutex
+	inflight int
+	// refs is the number of goroutines holding or waiting for lock, guarded by the
+	// limiter lock.
+	refs int
+}
+
+// newBindingLimiter returns a limiter of max bindings per identity. Zero is unlimited.
+func newBindingLimiter(max int, bound func(ctx context.Context, identity string) ([]string, error)) *bindingLimiter {
+	return &bindingLimiter{
+		max:        max,
+		bound:      bound,
+		identities: map[string]*identityLimit{},
+	}
+}
+
+// Reserve counts a bind of the named resource against the limit of the identity until
+// release is called. Binding an already bound resource again is always allowed.
+func (l *bindingLimiter) Reserve(ctx context.Context, identity, name string) (release func(), err error) {
+	if l.max == 0 {
+		return func() {}, nil
+	}
+
+	// list under the identity lock, such that a bind completing and releasing
+	// concurrently is either counted as in flight or as bound.
+	state := l.lockIdentity(identity)
+	defer l.unlockIdentity(identity, state)
+
+	bound, err := l.bound(ctx, identity)
+	if err != nil {
+		return nil, err
+	}
+	if sets.NewString(bound...).Has(name) {
+		return func() {}, nil
+	}
+
+	if len(bound)+state.inflight >= l.max {
+		if state.inflight > 0 {
+			return nil, errBindingInProgress
+		}
+		return nil, errBindingLimitReached
+	}
+	state.inflight++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			state := l.lockIdentity(identity)
+			defer l.unlockIdentity(identity, state)
+			state.inflight--
+		})
+	}, nil
+}
+
+// lockIdentity locks the state of the identity, creating it if needed.
+func (l *bindingLimiter) lockIdentity(identity string) *identityLimit {
+	l.lock.Lock()
+	state, ok := l.identities[identity]
+	if !ok {
+		state = &identityLimit{}
+		l.identities[identity] = state
+	}
+	state.refs++
+	l.lock.Unlock()
+
+	state.lock.Lock()
+	return state
+}
+
+// unlockIdentity unlocks the state of the identity, dropping it if nobody else waits
+// for it and no bind is in flight.
+func (l *bindingLimiter) unlockIdentity(identity string, state *identityLimit) {
+	// with nobody else holding or waiting for the lock, inflight cannot change anymore.
+	inflight := state.inflight
+	state.lock.Unlock()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if state.refs--; state.refs == 0 && inflight <= 0 {
+		delete(l.identities, identity)
+	}
+}
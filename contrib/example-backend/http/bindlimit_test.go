@@ -0,0 +1,144 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindingLimiter(t *testing.T) {
+	ctx := context.Background()
+	bound := map[string][]string{}
+	l := newBindingLimiter(2, func(ctx context.Context, identity string) ([]string, error) {
+		return bound[identity], nil
+	})
+
+	// binds up to the limit.
+	release, err := l.Reserve(ctx, "jane", "mangodbs.mangodb.com")
+	require.NoError(t, err)
+	bound["jane"] = append(bound["jane"], "mangodbs.mangodb.com")
+	release()
+	release() // releasing twice is harmless
+
+	release, err = l.Reserve(ctx, "jane", "caches.redis.io")
+	require.NoError(t, err)
+
+	// the bind in progress counts against the limit.
+	_, err = l.Reserve(ctx, "jane", "queues.rabbitmq.com")
+	require.ErrorIs(t, err, errBindingInProgress)
+
+	bound["jane"] = append(bound["jane"], "caches.redis.io")
+	release()
+
+	// beyond the limit.
+	_, err = l.Reserve(ctx, "jane", "queues.rabbitmq.com")
+	require.ErrorIs(t, err, errBindingLimitReached)
+
+	// rebinding a bound resource is allowed.
+	release, err = l.Reserve(ctx, "jane", "mangodbs.mangodb.com")
+	require.NoError(t, err)
+	release()
+
+	// other users are not affected.
+	release, err = l.Reserve(ctx, "joe", "queues.rabbitmq.com")
+	require.NoError(t, err)
+	release()
+
+	// failing to count bindings fails the reservation.
+	l.bound = func(ctx context.Context, identity string) ([]string, error) {
+		return nil, errors.New("boom")
+	}
+	_, err = l.Reserve(ctx, "jane", "queues.rabbitmq.com")
+	require.EqualError(t, err, "boom")
+}
+
+func TestBindingLimiterConcurrent(t *testing.T) {
+	var lock sync.Mutex
+	var bound []string
+	l := newBindingLimiter(1, func(ctx context.Context, identity string) ([]string, error) {
+		lock.Lock()
+		names := append([]string(nil), bound...)
+		lock.Unlock()
+		time.Sleep(time.Millisecond) // give concurrent binds time to complete
+		return names, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			release, err := l.Reserve(context.Background(), "jane", fmt.Sprintf("resource-%d", i))
+			if err != nil {
+				return
+			}
+			lock.Lock()
+			bound = append(bound, fmt.Sprintf("resource-%d", i))
+			lock.Unlock()
+			release()
+		}(i)
+	}
+	wg.Wait()
+
+	require.Len(t, bound, 1, "concurrent binds must not exceed the limit")
+}
+
+func TestBindingLimiterPerIdentity(t *testing.T) {
+	listing := make(chan struct{})
+	unblock := make(chan struct{})
+	l := newBindingLimiter(1, func(ctx context.Context, identity string) ([]string, error) {
+		if identity == "jane" {
+			close(listing)
+			<-unblock
+		}
+		return nil, nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		release, err := l.Reserve(context.Background(), "jane", "mangodbs.mangodb.com")
+		if err == nil {
+			release()
+		}
+	}()
+	<-listing
+
+	// a slow listing of one identity does not hold up others.
+	release, err := l.Reserve(context.Background(), "joe", "mangodbs.mangodb.com")
+	require.NoError(t, err)
+	release()
+
+	close(unblock)
+	<-done
+	require.Empty(t, l.identities, "released identities are dropped")
+}
+
+func TestBindingLimiterUnlimited(t *testing.T) {
+	l := newBindingLimiter(0, nil)
+	for i := 0; i < 10; i++ {
+		_, err := l.Reserve(context.Background(), "jane", "mangodbs.mangodb.com")
+		require.NoError(t, err)
+	}
+}
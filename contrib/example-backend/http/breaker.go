@@ -0,0 +1,160 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// errCircuitOpen is returned while a circuit breaker fails fast.
+var errCircuitOpen = errors.New("circuit breaker open")
+
+var (
+	breakerState = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      "kube_bind",
+			Subsystem:      "backend",
+			Name:           "circuit_breaker_state",
+			Help:           "Whether a circuit breaker is in the given state (1) or not (0).",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"breaker", "state"},
+	)
+	breakerRejections = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      "kube_bind",
+			Subsystem:      "backend",
+			Name:           "circuit_breaker_rejections_total",
+			Help:           "Number of calls failed fast by an open circuit breaker.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"breaker"},
+	)
+)
+
+func init() {
+	legacyregistry.MustRegister(breakerState, breakerRejections)
+}
+
+// circuitBreaker fails calls to a dependency fast after threshold consecutive
+// failures. After the cool-down, a single trial call is let through, which
+// closes the breaker on success and opens it again on failure. Errors which
+// isFailure does not consider a failure of the dependency count as success.
+type circuitBreaker struct {
+	name      string
+	threshold int
+	coolDown  time.Duration
+	isFailure func(error) bool
+	now       func() time.Time
+
+	lock     sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// newCircuitBreaker returns a closed breaker. A threshold of zero disables it. A nil
+// isFailure considers every error a failure.
+func newCircuitBreaker(name string, threshold int, coolDown time.Duration, isFailure func(error) bool) *circuitBreaker {
+	if isFailure == nil {
+		isFailure = func(err error) bool { return err != nil }
+	}
+	b := &circuitBreaker{
+		name:      name,
+		threshold: threshold,
+		coolDown:  coolDown,
+		isFailure: isFailure,
+		now:       time.Now,
+	}
+	b.setState(breakerClosed)
+	return b
+}
+
+// Do calls fn unless the breaker is open, and records its result.
+func (b *circuitBreaker) Do(fn func() error) error {
+	if !b.allow() {
+		breakerRejections.WithLabelValues(b.name).Inc()
+		return errCircuitOpen
+	}
+	err := fn()
+	b.record(err)
+	return err
+}
+
+// State returns the current state of the breaker.
+func (b *circuitBreaker) State() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.state
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.coolDown {
+			return false
+		}
+		b.setState(breakerHalfOpen)
+		return true
+	case breakerHalfOpen:
+		return false // the trial call is in flight
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) record(err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if err == nil || !b.isFailure(err) {
+		b.failures = 0
+		b.setState(breakerClosed)
+		return
+	}
+
+	b.failures++
+	if b.threshold > 0 && (b.state == breakerHalfOpen || b.failures >= b.threshold) {
+		b.openedAt = b.now()
+		b.setState(breakerOpen)
+	}
+}
+
+func (b *circuitBreaker) setState(state string) {
+	b.state = state
+	for _, s := range []string{breakerClosed, breakerOpen, breakerHalfOpen} {
+		value := 0.0
+		if s == state {
+			value = 1.0
+		}
+		breakerState.WithLabelValues(b.name, s).Set(value)
+	}
+}
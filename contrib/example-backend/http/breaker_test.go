@@ -0,0 +1,145 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	oidc "github.com/coreos/go-oidc"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"k8s.io/component-base/metrics/testutil"
+
+	"github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes/resources"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2022, time.October, 1, 12, 0, 0, 0, time.UTC)
+	b := newCircuitBreaker("test", 3, time.Minute, nil)
+	b.now = func() time.Time { return now }
+
+	failing := func() error { return errors.New("idp down") }
+	calls := 0
+	counting := func() error { calls++; return nil }
+
+	// consecutive failures open the breaker.
+	for i := 0; i < 3; i++ {
+		require.EqualError(t, b.Do(failing), "idp down")
+	}
+	require.Equal(t, breakerOpen, b.State())
+	value, err := testutil.GetGaugeMetricValue(breakerState.WithLabelValues("test", breakerOpen))
+	require.NoError(t, err)
+	require.Equal(t, 1.0, value)
+
+	// open breaker fails fast.
+	require.ErrorIs(t, b.Do(counting), errCircuitOpen)
+	require.Zero(t, calls)
+
+	// after the cool-down, a failing trial opens it again.
+	now = now.Add(time.Minute)
+	require.EqualError(t, b.Do(failing), "idp down")
+	require.Equal(t, breakerOpen, b.State())
+	require.ErrorIs(t, b.Do(counting), errCircuitOpen)
+
+	// after another cool-down, a successful trial closes it.
+	now = now.Add(time.Minute)
+	require.NoError(t, b.Do(counting))
+	require.Equal(t, 1, calls)
+	require.Equal(t, breakerClosed, b.State())
+	value, err = testutil.GetGaugeMetricValue(breakerState.WithLabelValues("test", breakerOpen))
+	require.NoError(t, err)
+	require.Equal(t, 0.0, value)
+
+	// failures below the threshold keep it closed.
+	require.Error(t, b.Do(failing))
+	require.Error(t, b.Do(failing))
+	require.NoError(t, b.Do(counting))
+	require.Error(t, b.Do(failing))
+	require.Equal(t, breakerClosed, b.State())
+}
+
+func TestCircuitBreakerIgnoresNonFailures(t *testing.T) {
+	rejected := errors.New("invalid code")
+	b := newCircuitBreaker("test-ignore", 2, time.Minute, func(err error) bool { return err != rejected })
+
+	for i := 0; i < 3; i++ {
+		require.ErrorIs(t, b.Do(func() error { return rejected }), rejected)
+	}
+	require.Equal(t, breakerClosed, b.State(), "rejections must not open the breaker")
+
+	// a rejection in between resets the consecutive failures.
+	require.Error(t, b.Do(func() error { return errors.New("idp down") }))
+	require.ErrorIs(t, b.Do(func() error { return rejected }), rejected)
+	require.Error(t, b.Do(func() error { return errors.New("idp down") }))
+	require.Equal(t, breakerClosed, b.State())
+}
+
+func TestIsTokenExchangeFailure(t *testing.T) {
+	retrieveError := func(code int) error {
+		return fmt.Errorf("exchange: %w", &oauth2.RetrieveError{Response: &http.Response{StatusCode: code}})
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "invalid grant", err: retrieveError(http.StatusBadRequest), want: false},
+		{name: "unauthorized client", err: retrieveError(http.StatusUnauthorized), want: false},
+		{name: "too many requests", err: retrieveError(http.StatusTooManyRequests), want: false},
+		{name: "internal server error", err: retrieveError(http.StatusInternalServerError), want: true},
+		{name: "bad gateway", err: retrieveError(http.StatusBadGateway), want: true},
+		{name: "transport error", err: &url.Error{Op: "Post", URL: "https://idp.example.com/token", Err: errors.New("connection refused")}, want: true},
+		{name: "timeout", err: &url.Error{Op: "Post", URL: "https://idp.example.com/token", Err: context.DeadlineExceeded}, want: true},
+		{name: "canceled", err: &url.Error{Op: "Post", URL: "https://idp.example.com/token", Err: context.Canceled}, want: false},
+		{name: "malformed response", err: errors.New("oauth2: server response missing access_token"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, isTokenExchangeFailure(tt.err))
+		})
+	}
+}
+
+func TestHandleCallbackCircuitBreaker(t *testing.T) {
+	h := newTestHandler(t, HandlerOptions{})
+	// the zero provider has no token endpoint, hence every exchange fails.
+	h.oidc = &OIDCServiceProvider{provider: &oidc.Provider{}, breaker: newCircuitBreaker("test-callback", 2, time.Hour, isTokenExchangeFailure)}
+
+	state, err := h.authCodes.Encode(&resources.AuthCode{RedirectURL: "http://localhost:1234/callback", SessionID: "abc"})
+	require.NoError(t, err)
+	target := "/callback?code=xyz&state=" + url.QueryEscape(state)
+
+	callback := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.handleCallback(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+	require.Equal(t, http.StatusInternalServerError, callback().Code)
+	require.Equal(t, http.StatusInternalServerError, callback().Code)
+
+	w := callback()
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "3600", w.Header().Get("Retry-After"))
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// correlationIDHeader carries an optional id chosen by the consumer at /authorize to
+// correlate its own request with the binding flow. It is carried through the state
+// and the session, logged, and echoed in the AuthResponse.
+const correlationIDHeader = "X-Correlation-ID"
+
+// correlationIDRegexp bounds the correlation id to a safe length and charset, as it
+// ends up in logs and the auth response.
+var correlationIDRegexp = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// correlationID returns the correlation id of the request, or empty if none is given.
+func correlationID(r *http.Request) (string, error) {
+	id := r.Header.Get(correlationIDHeader)
+	if id == "" {
+		return "", nil
+	}
+	if !correlationIDRegexp.MatchString(id) {
+		return "", fmt.Errorf("invalid %s header, must be at most 128 letters, digits, '.', '_', ':' or '-'", correlationIDHeader)
+	}
+	return id, nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/kube-bind/kube-bind/contrib/example-backend/cookie"
+)
+
+func TestCorrelationIDRoundTrip(t *testing.T) {
+	provider, err := NewOIDCServiceProvider("client", "secret", "http://127.0.0.1:8080/callback", newTestIdP(t), 3, time.Minute, 0)
+	require.NoError(t, err)
+	h := newTestHandler(t, HandlerOptions{
+		Provider: provider,
+	})
+
+	authorize := func(correlationID string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/authorize?u=http://localhost:1234/callback&s=abc", nil)
+		r.Header.Set(correlationIDHeader, correlationID)
+		for _, ck := range cookies {
+			r.AddCookie(ck)
+		}
+		w := httptest.NewRecorder()
+		h.handleAuthorize(w, r)
+		return w
+	}
+
+	w := authorize("req-1")
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	code, err := h.authCodes.Decode(location.Query().Get("state"))
+	require.NoError(t, err)
+	require.Equal(t, "req-1", code.CorrelationID, "the correlation id travels in the state")
+
+	w = httptest.NewRecorder()
+	h.handleCallback(w, httptest.NewRequest(http.MethodGet, "/callback?code=xyz&state="+url.QueryEscape(location.Query().Get("state")), nil))
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	state, err := cookie.Decode(cookies[0].Value, nil)
+	require.NoError(t, err)
+	require.Equal(t, "req-1", state.CorrelationID)
+
+	authResponse := newAuthResponse(state, "jane", nil, "mangodb.com", "mangodbs", "")
+	require.Equal(t, "req-1", authResponse.CorrelationID)
+	require.Equal(t, "abc", authResponse.SessionID)
+
+	// a reused session answers with the correlation id of the new request.
+	w = authorize("req-2", cookies[0])
+	require.Equal(t, http.StatusFound, w.Code)
+	require.Equal(t, "/resources?s=abc", w.Header().Get("Location"))
+	reissued := w.Result().Cookies()
+	require.Len(t, reissued, 1)
+	state, err = cookie.Decode(reissued[0].Value, nil)
+	require.NoError(t, err)
+	require.Equal(t, "req-2", state.CorrelationID)
+	require.WithinDuration(t, cookies[0].Expires, reissued[0].Expires, 2*time.Second, "the session expiry is kept")
+
+	w = authorize("req-2", reissued[0])
+	require.Equal(t, http.StatusFound, w.Code)
+	require.Empty(t, w.Result().Cookies(), "unchanged correlation ids do not reissue the cookie")
+}
+
+func TestCorrelationIDValidation(t *testing.T) {
+	for _, id := range []string{"req 1", "req/1", strings.Repeat("a", 129)} {
+		r := httptest.NewRequest(http.MethodGet, "/authorize", nil)
+		r.Header.Set(correlationIDHeader, id)
+		_, err := correlationID(r)
+		require.Error(t, err, id)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/authorize", nil)
+	got, err := correlationID(r)
+	require.NoError(t, err)
+	require.Empty(t, got)
+	r.Header.Set(correlationIDHeader, "2f1c:req_1.a-b")
+	got, err = correlationID(r)
+	require.NoError(t, err)
+	require.Equal(t, "2f1c:req_1.a-b", got)
+
+	h := newTestHandler(t, HandlerOptions{})
+	r = httptest.NewRequest(http.MethodGet, "/authorize?u=http://localhost:1234/callback&s=abc", nil)
+	r.Header.Set(correlationIDHeader, "not valid")
+	w := httptest.NewRecorder()
+	h.handleAuthorize(w, r)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// errorLogWindow is how long identical errors are collapsed in the logs.
+const errorLogWindow = time.Minute
+
+// errorLogger collapses identical errors logged within a window into the first one,
+// such that e.g. an IdP outage does not flood the logs with one line per request.
+// The number of collapsed errors is logged with the next identical error after the
+// window. A nil errorLogger logs every error.
+type errorLogger struct {
+	window time.Duration
+	now    func() time.Time
+
+	lock   sync.Mutex
+	logged map[string]*loggedError
+}
+
+type loggedError struct {
+	at        time.Time
+	collapsed int
+}
+
+func newErrorLogger(window time.Duration) *errorLogger {
+	return &errorLogger{
+		window: window,
+		now:    time.Now,
+		logged: map[string]*loggedError{},
+	}
+}
+
+// Info logs the message with the error and the key/value pairs, unless the same
+// message with an identical error was logged within the window. The key/value pairs
+// are not compared, as they usually differ per request.
+func (l *errorLogger) Info(logger klog.Logger, msg string, err error, keysAndValues ...interface{}) {
+	kvs := append([]interface{}{"error", err}, keysAndValues...)
+	if l == nil {
+		logger.Info(msg, kvs...)
+		return
+	}
+
+	key := msg + "\x00" + fmt.Sprint(err)
+	l.lock.Lock()
+	now := l.now()
+	if e, found := l.logged[key]; found && now.Sub(e.at) < l.window {
+		e.collapsed++
+		l.lock.Unlock()
+		return
+	} else if found && e.collapsed > 0 {
+		kvs = append(kvs, "collapsed", e.collapsed)
+	}
+	for k, e := range l.logged {
+		// forget errors not seen anymore, dropping their counts.
+		if now.Sub(e.at) >= 2*l.window {
+			delete(l.logged, k)
+		}
+	}
+	l.logged[key] = &loggedError{at: now}
+	l.lock.Unlock()
+
+	logger.Info(msg, kvs...)
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorLogger(t *testing.T) {
+	var lines []string
+	logger := funcr.New(func(prefix, args string) {
+		lines = append(lines, args)
+	}, funcr.Options{})
+
+	now := time.Unix(1000, 0)
+	l := newErrorLogger(time.Minute)
+	l.now = func() time.Time { return now }
+
+	outage := errors.New("dial tcp: connection refused")
+	for i := 0; i < 10; i++ {
+		l.Info(logger, "failed to exchange token", outage, "url", "/callback")
+	}
+	require.Len(t, lines, 1, "identical errors within the window must be collapsed")
+	require.Contains(t, lines[0], `"error"="dial tcp: connection refused"`)
+	require.NotContains(t, lines[0], "collapsed")
+
+	l.Info(logger, "failed to exchange token", errors.New("timeout"))
+	l.Info(logger, "failed to get userinfo claims", outage)
+	require.Len(t, lines, 3, "other errors and messages are logged")
+
+	now = now.Add(time.Minute)
+	l.Info(logger, "failed to exchange token", outage)
+	require.Len(t, lines, 4)
+	require.Contains(t, lines[3], `"collapsed"=9`)
+
+	l.Info(logger, "failed to exchange token", outage)
+	require.Len(t, lines, 4)
+
+	now = now.Add(time.Minute)
+	l.Info(logger, "failed to exchange token", outage)
+	require.Len(t, lines, 5)
+	require.Contains(t, lines[4], `"collapsed"=1`)
+
+	now = now.Add(3 * time.Minute)
+	l.Info(logger, "failed to exchange token", outage)
+	require.Len(t, lines, 6)
+	require.NotContains(t, lines[5], "collapsed")
+	require.Len(t, l.logged, 1, "expired errors must be forgotten")
+
+	lines = nil
+	var unlimited *errorLogger
+	for i := 0; i < 3; i++ {
+		unlimited.Info(logger, "failed to exchange token", outage)
+	}
+	require.Len(t, lines, 3)
+	require.Contains(t, lines[0], "connection refused")
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	htmltemplate "html/template"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"k8s.io/klog/v2"
+)
+
+const requestIDHeader = "X-Request-Id"
+
+var (
+	errorTemplate = htmltemplate.Must(htmltemplate.New("error").Parse(`<!doctype html>
+<html lang="en">
+  <head><title>{{.Code}} {{.Status}}</title></head>
+  <body>
+    <h1>{{.Code}} {{.Status}}</h1>
+    <p>{{.Message}}</p>
+    {{- if .Hint}}
+    <p>{{.Hint}}</p>
+    {{- end}}
+    <p><small>Request ID: {{.RequestID}}</small></p>
+  </body>
+</html>
+`))
+
+	// candidateMethods are probed to compute the Allow header of 405 responses.
+	candidateMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions}
+)
+
+// ErrorResponse is the JSON body of error responses.
+type ErrorResponse struct {
+	Code      int    `json:"code"`
+	Status    string `json:"status"`
+	Message   string `json:"message"`
+	Detail    string `json:"detail,omitempty"`
+	RequestID string `json:"requestID"`
+
+	// Hint is shown to browser users instead of the detail.
+	Hint string `json:"-"`
+}
+
+// installErrorHandlers makes the router answer unknown paths and methods with
+// a consistent JSON or HTML error, depending on what the client accepts.
+func installErrorHandlers(router *mux.Router) {
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusNotFound, "The requested path does not exist.")
+	})
+	router.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := allowedMethods(router, r)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeError(w, r, http.StatusMethodNotAllowed, "Method "+r.Method+" is not allowed, use one of "+strings.Join(allowed, ", ")+".")
+	})
+}
+
+// allowedMethods returns the methods the router would serve for the path of r.
+func allowedMethods(router *mux.Router, r *http.Request) []string {
+	var allowed []string
+	for _, method := range candidateMethods {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		var match mux.RouteMatch
+		if router.Match(probe, &match) && match.MatchErr == nil {
+			allowed = append(allowed, method)
+		}
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, code int, message string) {
+	writeErrorResponse(w, r, ErrorResponse{Code: code, Message: message})
+}
+
+// writeIdPError renders an error returned by the identity provider. API clients
+// get the raw error, browsers a friendly page without provider text.
+func writeIdPError(w http.ResponseWriter, r *http.Request, idpError, description string) {
+	message := "The identity provider could not sign you in."
+	if idpError == "access_denied" {
+		message = "The sign-in was cancelled or access was denied."
+	}
+	detail := idpError
+	if description != "" {
+		detail += ": " + description
+	}
+	writeErrorResponse(w, r, ErrorResponse{
+		Code:    http.StatusBadRequest,
+		Message: message,
+		Detail:  detail,
+		Hint:    "Please start the binding again. If the problem persists, contact the service provider with the request ID below.",
+	})
+}
+
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, resp ErrorResponse) {
+	logger := klog.FromContext(r.Context()).WithValues("method", r.Method, "url", r.URL.String())
+
+	code := resp.Code
+	resp.Status = http.StatusText(code)
+	resp.RequestID = requestID(r)
+	logger.V(2).Info("request failed", "code", code, "requestID", resp.RequestID)
+
+	w.Header().Set(requestIDHeader, resp.RequestID)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	// render fully before writing the status, such that a failure still gives a clean
+	// response. Plain text is used then, as rendering the error page itself failed.
+	var buf bytes.Buffer
+	contentType := contentTypeHTML
+	var err error
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		contentType = contentTypeJSON
+		err = json.NewEncoder(&buf).Encode(resp)
+	} else {
+		err = errorTemplate.Execute(&buf, resp)
+	}
+	if err != nil {
+		logger.Error(err, "failed to render error response", "code", code)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	w.Write(buf.Bytes()) // nolint:errcheck
+}
+
+// requestID returns the request id passed by the client or a new random one.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); id != "" {
+		return id
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
@@ -17,34 +17,71 @@ limitations under the License.
 package http
 
 import (
-	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	htmltemplate "html/template"
+	"math"
+	"net"
 	"net/http"
 	"net/url"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/template"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gorilla/mux"
+	"golang.org/x/oauth2"
 
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apiextensionslisters "k8s.io/apiextensions-apiserver/pkg/client/listers/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 
 	"github.com/kube-bind/kube-bind/contrib/example-backend/cookie"
 	"github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes"
 	"github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes/resources"
-	"github.com/kube-bind/kube-bind/contrib/example-backend/template"
+	"github.com/kube-bind/kube-bind/contrib/example-backend/options"
+	"github.com/kube-bind/kube-bind/contrib/example-backend/session"
 	"github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+	kubebindhelpers "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1/helpers"
 )
 
-var (
-	resourcesTemplate = htmltemplate.Must(htmltemplate.New("resource").Parse(mustRead(template.Files.ReadFile, "resources.gohtml")))
+const (
+	// sessionCookieKeyPurpose and stateKeyPurpose separate the keys derived from the
+	// cookie keys for the session cookies and the state parameter.
+	sessionCookieKeyPurpose = "session-cookie"
+	stateKeyPurpose         = "oauth2-state"
+
+	// callbackCheckRetryDelay is the pause between attempts to reach the consumer callback.
+	callbackCheckRetryDelay = 500 * time.Millisecond
+
+	// claimTTL is how long an auth response too large for the redirect URL can be claimed.
+	claimTTL = 5 * time.Minute
+
+	// maxSessionCookieBytes is the largest encoded session cookie value. Browsers drop
+	// cookies of more than 4096 bytes including name and attributes without notice.
+	maxSessionCookieBytes = 3800
+
+	// bindFormatDownload makes bind return the kubeconfig as file download instead
+	// of redirecting to the consumer callback.
+	bindFormatDownload = "download"
 )
 
 // See https://developers.google.com/web/fundamentals/performance/optimizing-content-efficiency/http-caching?hl=en
@@ -54,42 +91,314 @@ var noCacheHeaders = map[string]string{
 	"X-Accel-Expires": "0", // https://www.nginx.com/resources/wiki/start/topics/examples/x-accel/
 }
 
+// EntitlementFunc returns whether the user with the given ID token claims may bind the CRD.
+type EntitlementFunc func(crd *apiextensionsv1.CustomResourceDefinition, claims map[string]interface{}) bool
+
 type handler struct {
 	oidc *OIDCServiceProvider
 
 	backendCallbackURL string
 	providerPrettyName string
+	providerLogoURL    string
+	providerThemeColor string
 	testingAutoSelect  string
+	identity           *identityBuilder
+	claimLabels        *claimLabeler
+
+	// stateless disables refresh tokens and ends the session with the first bind.
+	stateless bool
+
+	// sessionTTL is the lifetime of the session and its cookie.
+	sessionTTL time.Duration
+
+	// forbiddenGroups are group patterns that are neither offered nor bound.
+	forbiddenGroups []string
+
+	// entitlement decides per user which of the remaining CRDs are offered and bound. Nil entitles everybody.
+	entitlement EntitlementFunc
+
+	// authorizer approves or denies every bind before provisioning.
+	authorizer Authorizer
+
+	// resourcesTemplate renders the resources page.
+	resourcesTemplate *htmltemplate.Template
+	// boundTemplate renders the landing page after a successful bind.
+	boundTemplate *htmltemplate.Template
+
+	// bindings limits the resources a user can bind.
+	bindings *bindingLimiter
+
+	// prompt and maxAge are the default OpenID prompt and max_age parameters.
+	prompt string
+	maxAge time.Duration
+
+	// acrValues are the requested authentication context class references. The acr
+	// claim must be one of them to bind. Empty disables the check.
+	acrValues []string
+
+	// allowedScopes bound the scopes a client may request on top of the default ones.
+	// Others are dropped, or rejected if rejectDisallowedScopes is set.
+	allowedScopes          []string
+	rejectDisallowedScopes bool
+
+	// callbackCheckTimeout enables checking that the consumer callback is reachable
+	// before redirecting to it, with callbackCheckRetries retries. Only callbacks on
+	// callbackCheckHosts are checked, with a client refusing loopback and link-local
+	// addresses.
+	callbackCheckTimeout time.Duration
+	callbackCheckRetries int
+	callbackCheckHosts   sets.String
+	callbackCheckClient  *http.Client
+
+	// targetNamespacePattern restricts namespaces consumers may choose. Nil disallows choosing.
+	targetNamespacePattern *regexp.Regexp
+	// targetNamespaces, if not empty, are the only namespaces consumers may bind into.
+	targetNamespaces sets.String
 
-	client              *http.Client
 	apiextensionsLister apiextensionslisters.CustomResourceDefinitionLister
+	apiextensionsSynced cache.InformerSynced
+
+	// maxInlineAuthResponseBytes is the maximal size of the encoded auth response
+	// passed in the redirect URL. Larger ones are claimed at /claim. Zero always inlines.
+	maxInlineAuthResponseBytes int
+
+	// authCodes carries the AuthCode through the identity provider.
+	authCodes authCodeStorage
+
+	// stateTTL is the maximal age of an AuthCode at the callback. Zero accepts any age.
+	stateTTL time.Duration
+
+	// serverSessionIDs makes the backend generate the session ids naming the session
+	// cookies, instead of using the one chosen by the consumer.
+	serverSessionIDs bool
+
+	// resourcesETag lets browsers revalidate the resources page with an ETag
+	// instead of re-rendering it on every visit.
+	resourcesETag bool
+
+	// errorLogs collapses repeated identical errors of the identity provider and the
+	// cluster in the logs.
+	errorLogs *errorLogger
+
+	// bindLandingPage shows a page summarizing the binding before redirecting to the
+	// consumer, unless overridden by the landing parameter of /bind.
+	bindLandingPage bool
+
+	// maintenance refuses binds while enabled.
+	maintenance *Maintenance
+
+	// signingKey signs auth responses if non-nil. Its public key is advertised at /export.
+	signingKey ed25519.PrivateKey
+	// signingKeyID names the signing key in signed auth responses.
+	signingKeyID string
+	// authResponseKeys are advertised at /export, the signing key first, followed by
+	// the verification keys accepted during key rotation.
+	authResponseKeys []v1alpha1.AuthResponseKey
+
+	// cookieKeys encrypt the session cookies. They are derived for that purpose only.
+	// Nil disables encryption.
+	cookieKeys *cookie.KeySet
+	// cookieNamePrefix is followed by the session id in the session cookie names.
+	cookieNamePrefix string
 
 	kubeManager *kubernetes.Manager
+
+	// exportedResources and boundKubeconfig return the exports and the kubeconfig in the
+	// given format of an identity for /kubeconfig. Nil funcs mean there is nothing bound.
+	exportedResources func(ctx context.Context, identity string) ([]string, error)
+	boundKubeconfig   func(ctx context.Context, identity, format string) ([]byte, error)
+	sessions          *session.Store
+	claims            *session.ClaimStore
+}
+
+// HandlerOptions configures the handler returned by NewHandler.
+type HandlerOptions struct {
+	Provider *OIDCServiceProvider
+
+	BackendCallbackURL     string
+	ProviderPrettyName     string
+	ProviderLogoURL        string
+	ProviderThemeColor     string
+	TestingAutoSelect      string
+	TargetNamespacePattern string
+	ClaimLabels            []string
+
+	// TargetNamespaces, if set, are the only namespaces consumers may bind into, e.g.
+	// the namespaces the informers watch. A target namespace is required then.
+	TargetNamespaces []string
+
+	// Identity is the parsed identity template, see options.ParseIdentityTemplate.
+	Identity *template.Template
+
+	Stateless  bool
+	SessionTTL time.Duration
+
+	ForbiddenGroups []string
+	Entitlement     EntitlementFunc
+	Authorizer      Authorizer
+	TemplateFuncs   htmltemplate.FuncMap
+
+	MaxBindingsPerSubject int
+
+	Prompt    string
+	MaxAge    time.Duration
+	AcrValues []string
+
+	AllowedScopes          []string
+	RejectDisallowedScopes bool
+
+	CallbackCheckTimeout time.Duration
+	CallbackCheckRetries int
+	CallbackCheckHosts   []string
+
+	MaxInlineAuthResponseBytes int
+
+	AuthCodeStorage  string
+	StateTTL         time.Duration
+	ServerSessionIDs bool
+	ResourcesETag    bool
+	BindLandingPage  bool
+	Maintenance      *Maintenance
+
+	SigningKey       ed25519.PrivateKey
+	VerificationKeys []ed25519.PublicKey
+	CookieKeys       *cookie.KeySet
+	CookieNamePrefix string
+
+	Manager   *kubernetes.Manager
+	CRDLister apiextensionslisters.CustomResourceDefinitionLister
+	CRDSynced cache.InformerSynced
+
+	Sessions  *session.Store
+	Claims    *session.ClaimStore
+	AuthCodes *session.ClaimStore
 }
 
-func NewHandler(
-	provider *OIDCServiceProvider,
-	backendCallbackURL, providerPrettyName, testingAutoSelect string,
-	mgr *kubernetes.Manager,
-	apiextensionsLister apiextensionslisters.CustomResourceDefinitionLister,
-) (*handler, error) {
+func NewHandler(opts HandlerOptions) (*handler, error) {
+	identity, err := newIdentityBuilder(opts.Identity)
+	if err != nil {
+		return nil, err
+	}
+	labeler, err := newClaimLabeler(opts.ClaimLabels)
+	if err != nil {
+		return nil, err
+	}
+	codes, err := newAuthCodeStorage(opts.AuthCodeStorage, opts.AuthCodes, opts.StateTTL, opts.CookieKeys.Derive(stateKeyPurpose))
+	if err != nil {
+		return nil, err
+	}
+	resourcesTemplate, err := newResourcesTemplate(opts.TemplateFuncs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid resources template: %w", err)
+	}
+	boundTemplate, err := newBoundTemplate(opts.TemplateFuncs)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bound template: %w", err)
+	}
+	var exported func(ctx context.Context, identity string) ([]string, error)
+	var kubeconfig func(ctx context.Context, identity, format string) ([]byte, error)
+	if opts.Manager != nil {
+		exported = opts.Manager.ExportedResources
+		kubeconfig = opts.Manager.Kubeconfig
+	}
+	authorizer := opts.Authorizer
+	if authorizer == nil {
+		authorizer = AllowAll
+	}
+	cookieNamePrefix := opts.CookieNamePrefix
+	if cookieNamePrefix == "" {
+		cookieNamePrefix = cookie.DefaultNamePrefix
+	}
+	var targetNamespaceRegexp *regexp.Regexp
+	if opts.TargetNamespacePattern != "" {
+		if targetNamespaceRegexp, err = regexp.Compile("^(?:" + opts.TargetNamespacePattern + ")$"); err != nil {
+			return nil, fmt.Errorf("invalid target namespace pattern: %w", err)
+		}
+	}
+	var signingKeyID string
+	var authResponseKeys []v1alpha1.AuthResponseKey
+	if opts.SigningKey != nil {
+		pub := opts.SigningKey.Public().(ed25519.PublicKey)
+		signingKeyID = kubebindhelpers.AuthResponseKeyID(pub)
+		authResponseKeys = append(authResponseKeys, kubebindhelpers.Ed25519ToAuthResponseKey(pub))
+		seen := sets.NewString(signingKeyID)
+		for _, key := range opts.VerificationKeys {
+			if id := kubebindhelpers.AuthResponseKeyID(key); !seen.Has(id) {
+				seen.Insert(id)
+				authResponseKeys = append(authResponseKeys, kubebindhelpers.Ed25519ToAuthResponseKey(key))
+			}
+		}
+	} else if len(opts.VerificationKeys) > 0 {
+		return nil, fmt.Errorf("auth response verification keys require a signing key")
+	}
+
 	return &handler{
-		oidc:                provider,
-		backendCallbackURL:  backendCallbackURL,
-		providerPrettyName:  providerPrettyName,
-		testingAutoSelect:   testingAutoSelect,
-		client:              http.DefaultClient,
-		kubeManager:         mgr,
-		apiextensionsLister: apiextensionsLister,
+		oidc:               opts.Provider,
+		backendCallbackURL: opts.BackendCallbackURL,
+		providerPrettyName: opts.ProviderPrettyName,
+		providerLogoURL:    opts.ProviderLogoURL,
+		providerThemeColor: opts.ProviderThemeColor,
+		testingAutoSelect:  opts.TestingAutoSelect,
+		identity:           identity,
+		claimLabels:        labeler,
+		stateless:          opts.Stateless,
+		sessionTTL:         opts.SessionTTL,
+		forbiddenGroups:    opts.ForbiddenGroups,
+		entitlement:        opts.Entitlement,
+		authorizer:         authorizer,
+		resourcesTemplate:  resourcesTemplate,
+		boundTemplate:      boundTemplate,
+		bindings:           newBindingLimiter(opts.MaxBindingsPerSubject, exported),
+		prompt:             opts.Prompt,
+		maxAge:             opts.MaxAge,
+		acrValues:          opts.AcrValues,
+
+		allowedScopes:          opts.AllowedScopes,
+		rejectDisallowedScopes: opts.RejectDisallowedScopes,
+
+		callbackCheckTimeout: opts.CallbackCheckTimeout,
+		callbackCheckRetries: opts.CallbackCheckRetries,
+		callbackCheckHosts:   sets.NewString(opts.CallbackCheckHosts...),
+		callbackCheckClient:  newCallbackCheckClient(),
+
+		maxInlineAuthResponseBytes: opts.MaxInlineAuthResponseBytes,
+		authCodes:                  codes,
+		stateTTL:                   opts.StateTTL,
+		serverSessionIDs:           opts.ServerSessionIDs,
+		resourcesETag:              opts.ResourcesETag,
+		errorLogs:                  newErrorLogger(errorLogWindow),
+		bindLandingPage:            opts.BindLandingPage,
+		maintenance:                opts.Maintenance,
+		signingKey:                 opts.SigningKey,
+		signingKeyID:               signingKeyID,
+		authResponseKeys:           authResponseKeys,
+		cookieKeys:                 opts.CookieKeys.Derive(sessionCookieKeyPurpose),
+		cookieNamePrefix:           cookieNamePrefix,
+
+		targetNamespacePattern: targetNamespaceRegexp,
+		targetNamespaces:       sets.NewString(opts.TargetNamespaces...),
+		kubeManager:            opts.Manager,
+		exportedResources:      exported,
+		boundKubeconfig:        kubeconfig,
+		apiextensionsLister:    opts.CRDLister,
+		apiextensionsSynced:    opts.CRDSynced,
+		sessions:               opts.Sessions,
+		claims:                 opts.Claims,
 	}, nil
 }
 
 func (h *handler) AddRoutes(mux *mux.Router) {
 	mux.HandleFunc("/export", h.handleServiceExport).Methods("GET")
+	mux.HandleFunc("/metadata", h.handleMetadata).Methods("GET")
+	mux.HandleFunc("/oidc-requirements", h.handleOIDCRequirements).Methods("GET")
 	mux.HandleFunc("/resources", h.handleResources).Methods("GET")
 	mux.HandleFunc("/bind", h.handleBind).Methods("GET")
+	mux.HandleFunc("/rotate", h.handleRotate).Methods("POST")
+	mux.HandleFunc("/kubeconfig", h.handleKubeconfig).Methods("GET")
 	mux.HandleFunc("/authorize", h.handleAuthorize).Methods("GET")
 	mux.HandleFunc("/callback", h.handleCallback).Methods("GET")
+	mux.HandleFunc("/cancel", h.handleCancel).Methods("GET", "POST")
+	mux.HandleFunc("/claim", h.handleClaim).Methods("POST")
 }
 
 func (h *handler) handleServiceExport(w http.ResponseWriter, r *http.Request) {
@@ -101,6 +410,16 @@ func (h *handler) handleServiceExport(w http.ResponseWriter, r *http.Request) {
 			ProviderPrettyName:     h.providerPrettyName,
 		},
 	}
+	if h.signingKey != nil {
+		pub, err := x509.MarshalPKIXPublicKey(h.signingKey.Public())
+		if err != nil {
+			logger.Error(err, "failed to marshal auth response public key")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		serviceProvider.Spec.AuthResponsePublicKey = base64.StdEncoding.EncodeToString(pub)
+		serviceProvider.Spec.AuthResponseKeys = h.authResponseKeys
+	}
 
 	bs, err := json.Marshal(serviceProvider)
 	if err != nil {
@@ -109,8 +428,56 @@ func (h *handler) handleServiceExport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(bs) // nolint:errcheck
+	writeBody(w, contentTypeJSON, bs)
+}
+
+func (h *handler) handleMetadata(w http.ResponseWriter, r *http.Request) {
+	logger := klog.FromContext(r.Context()).WithValues("method", r.Method, "url", r.URL.String())
+
+	bs, err := json.Marshal(resources.ProviderMetadata{
+		ProviderPrettyName: h.providerPrettyName,
+		LogoURL:            h.providerLogoURL,
+		ThemeColor:         h.providerThemeColor,
+	})
+	if err != nil {
+		logger.Error(err, "failed to marshal provider metadata")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeBody(w, contentTypeJSON, bs)
+}
+
+func (h *handler) handleOIDCRequirements(w http.ResponseWriter, r *http.Request) {
+	logger := klog.FromContext(r.Context()).WithValues("method", r.Method, "url", r.URL.String())
+
+	grantTypes := []string{"authorization_code"}
+	if !h.stateless {
+		grantTypes = append(grantTypes, "refresh_token")
+	}
+	bs, err := json.Marshal(resources.OIDCRequirements{
+		RedirectURIs:   []string{h.backendCallbackURL},
+		Scopes:         h.defaultScopes(),
+		OptionalScopes: h.allowedScopes,
+		ResponseTypes:  []string{"code"},
+		GrantTypes:     grantTypes,
+	})
+	if err != nil {
+		logger.Error(err, "failed to marshal OIDC requirements")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeBody(w, contentTypeJSON, bs)
+}
+
+// defaultScopes returns the scopes always requested from the identity provider.
+func (h *handler) defaultScopes() []string {
+	scopes := []string{"openid", "profile", "email"}
+	if !h.stateless {
+		scopes = append(scopes, "offline_access")
+	}
+	return scopes
 }
 
 // prepareNoCache prepares headers for preventing browser caching.
@@ -121,13 +488,59 @@ func prepareNoCache(w http.ResponseWriter) {
 	}
 }
 
+// resourcesETag returns a strong ETag of the resources page of the session listing the
+// given CRDs. It changes with every change of the CRDs.
+func resourcesETag(sessionID string, crds []*apiextensionsv1.CustomResourceDefinition) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\n", sessionID)
+	for _, crd := range crds {
+		fmt.Fprintf(hash, "%s/%s/%s\n", crd.Name, crd.UID, crd.ResourceVersion)
+	}
+	return `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// etagMatches returns whether the If-None-Match header matches the ETag, using the
+// weak comparison of RFC 7232.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
 func (h *handler) handleAuthorize(w http.ResponseWriter, r *http.Request) {
 	logger := klog.FromContext(r.Context()).WithValues("method", r.Method, "url", r.URL.String())
 
-	scopes := []string{"openid", "profile", "email", "offline_access"}
+	correlation, err := correlationID(r)
+	if err != nil {
+		logger.Info("invalid correlation id", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if correlation != "" {
+		logger = logger.WithValues("correlationID", correlation)
+	}
+
+	scopes := h.defaultScopes()
+	requested, err := h.requestedScopes(r)
+	if err != nil {
+		logger.Info("invalid authorize scopes", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, scope := range requested {
+		if !sets.NewString(scopes...).Has(scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
 	code := &resources.AuthCode{
-		RedirectURL: r.URL.Query().Get("u"),
-		SessionID:   r.URL.Query().Get("s"),
+		RedirectURL:   r.URL.Query().Get("u"),
+		SessionID:     r.URL.Query().Get("s"),
+		CorrelationID: correlation,
 	}
 	if code.RedirectURL == "" || code.SessionID == "" {
 		logger.Error(errors.New("missing redirect url or session id"), "failed to authorize")
@@ -135,18 +548,289 @@ func (h *handler) handleAuthorize(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dataCode, err := json.Marshal(code)
+	authOpts, err := h.authCodeOptions(r)
 	if err != nil {
-		logger.Info("failed to marshal auth code", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logger.Info("invalid authorize parameters", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	encoded := base64.StdEncoding.EncodeToString(dataCode)
-	authURL := h.oidc.OIDCProviderConfig(scopes).AuthCodeURL(encoded)
+	if h.serverSessionIDs {
+		// the consumer session id only correlates the auth response. Sessions cannot
+		// be reused because their cookie name is unknown to the consumer.
+		id, err := newSessionID()
+		if err != nil {
+			logger.Info("failed to generate session id", "error", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		code.ClientSessionID = code.SessionID
+		code.SessionID = id
+	} else if state := h.reusableSession(r, code, len(requested) > 0); state != nil {
+		if state.CorrelationID != code.CorrelationID {
+			// the reused session answers the new request, keeping its expiry.
+			state.CorrelationID = code.CorrelationID
+			if err := h.setSessionCookie(w, r, state, time.Until(state.CreatedAt.Add(h.sessionTTL))); err != nil {
+				logger.Info("failed to encode session cookie", "error", err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+		}
+		logger.V(2).Info("reusing valid session, skipping authorization", "session", code.SessionID)
+		http.Redirect(w, r, "/resources?s="+code.SessionID, http.StatusFound)
+		return
+	}
+
+	code.IssuedAt = time.Now().Unix()
+	encoded, err := h.authCodes.Encode(code)
+	if err != nil {
+		logger.Info("failed to encode auth code", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	authURL := h.oidc.OIDCProviderConfig(scopes).AuthCodeURL(encoded, authOpts...)
 	http.Redirect(w, r, authURL, http.StatusFound)
 }
 
+// newSessionID returns a random session id that is safe to use in cookie names and URLs.
+func newSessionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// requestedScopes returns the scopes of the scope query parameter that are in the
+// allow-list. Disallowed scopes are dropped, or fail the request if configured so.
+func (h *handler) requestedScopes(r *http.Request) ([]string, error) {
+	allowed := sets.NewString(h.allowedScopes...)
+	var scopes []string
+	for _, value := range r.URL.Query()["scope"] {
+		for _, scope := range strings.Fields(value) {
+			if allowed.Has(scope) {
+				scopes = append(scopes, scope)
+				continue
+			}
+			if h.rejectDisallowedScopes {
+				return nil, fmt.Errorf("scope %q is not allowed", scope)
+			}
+		}
+	}
+	return scopes, nil
+}
+
+// authCodeOptions returns the prompt, max_age and login_hint parameters for the auth
+// code URL. The query parameters of the request override the configured defaults.
+func (h *handler) authCodeOptions(r *http.Request) ([]oauth2.AuthCodeOption, error) {
+	var opts []oauth2.AuthCodeOption
+
+	prompt := h.requestedPrompt(r)
+	if err := options.ValidatePrompt(prompt); err != nil {
+		return nil, err
+	}
+	if prompt != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("prompt", prompt))
+	}
+
+	maxAge, err := h.requestedMaxAge(r)
+	if err != nil {
+		return nil, err
+	}
+	if maxAge >= 0 {
+		opts = append(opts, oauth2.SetAuthURLParam("max_age", strconv.FormatInt(int64(maxAge/time.Second), 10)))
+	}
+
+	if len(h.acrValues) > 0 {
+		opts = append(opts, oauth2.SetAuthURLParam("acr_values", strings.Join(h.acrValues, " ")))
+	}
+
+	loginHint := r.URL.Query().Get("login_hint")
+	if err := validateLoginHint(loginHint); err != nil {
+		return nil, err
+	}
+	if loginHint != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("login_hint", loginHint))
+	}
+
+	return opts, nil
+}
+
+// maxLoginHintLength bounds the login_hint parameter, long enough for any email address.
+const maxLoginHintLength = 256
+
+// validateLoginHint checks the login_hint parameter prefilling the username at the IdP.
+// It is passed on verbatim, hence it must be short printable UTF-8.
+func validateLoginHint(hint string) error {
+	if len(hint) > maxLoginHintLength {
+		return fmt.Errorf("invalid login_hint, must have at most %d bytes", maxLoginHintLength)
+	}
+	if !utf8.ValidString(hint) {
+		return fmt.Errorf("invalid login_hint, must be valid UTF-8")
+	}
+	for _, c := range hint {
+		if unicode.IsControl(c) {
+			return fmt.Errorf("invalid login_hint, must not contain control characters")
+		}
+	}
+	return nil
+}
+
+// requestedPrompt returns the prompt query parameter, or the configured default.
+func (h *handler) requestedPrompt(r *http.Request) string {
+	if values, found := r.URL.Query()["prompt"]; found {
+		return strings.Join(values, " ")
+	}
+	return h.prompt
+}
+
+// requestedMaxAge returns the max_age query parameter, or the configured default.
+// It is negative if neither is set.
+func (h *handler) requestedMaxAge(r *http.Request) (time.Duration, error) {
+	if value := r.URL.Query().Get("max_age"); value != "" {
+		seconds, err := strconv.ParseUint(value, 10, 63)
+		if err != nil || seconds > uint64(math.MaxInt64/int64(time.Second)) {
+			return 0, fmt.Errorf("invalid max_age %q, must be a non-negative number of seconds", value)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	if h.maxAge > 0 {
+		return h.maxAge, nil
+	}
+	return -1, nil
+}
+
+// reusableSession returns the session state if the request carries the cookie of a
+// valid session for the same session id and consumer callback, such that
+// authorization can be skipped, or nil otherwise. Prompts other than "none", an
+// exceeded max_age, additional scopes and an insufficient acr claim require a new
+// authorization.
+func (h *handler) reusableSession(r *http.Request, code *resources.AuthCode, additionalScopes bool) *cookie.SessionState {
+	if additionalScopes {
+		return nil
+	}
+	if prompt := h.requestedPrompt(r); prompt != "" && prompt != "none" {
+		return nil
+	}
+
+	ck, err := r.Cookie(h.cookieName(code.SessionID))
+	if err != nil {
+		return nil
+	}
+	state, err := h.sessionState(ck)
+	if err != nil || state.SessionID != code.SessionID || state.RedirectURL != code.RedirectURL {
+		return nil
+	}
+	if _, found := h.sessions.Get(state.SessionID); !found {
+		return nil
+	}
+
+	maxAge, err := h.requestedMaxAge(r)
+	if err != nil || (maxAge >= 0 && time.Since(state.CreatedAt) > maxAge) {
+		return nil
+	}
+	if len(h.acrValues) > 0 {
+		var claims map[string]interface{}
+		if err := json.Unmarshal([]byte(state.IDToken), &claims); err != nil || !h.acrSatisfied(claims) {
+			return nil
+		}
+	}
+	return state
+}
+
+// newAuthResponse returns the auth response of the session for the bound resource.
+// The consumer gets back its own session id and correlation id.
+func newAuthResponse(state *cookie.SessionState, identity string, kubeconfig []byte, group, resource, version string) *resources.AuthResponse {
+	sessionID := state.SessionID
+	if state.ClientSessionID != "" {
+		sessionID = state.ClientSessionID
+	}
+	return &resources.AuthResponse{
+		SessionID:  sessionID,
+		ID:         identity,
+		Kubeconfig: kubeconfig,
+		Group:      group,
+		Resource:   resource,
+		Version:    version,
+		Export:     resource + "." + group,
+
+		CorrelationID: state.CorrelationID,
+	}
+}
+
+// cookieName returns the name of the session cookie of the session id.
+func (h *handler) cookieName(sessionID string) string {
+	return h.cookieNamePrefix + sessionID
+}
+
+// setSessionCookie encrypts the session state and sets it as the session cookie. States
+// too large for browsers to keep are stored with the session, which must exist, and the
+// cookie only references them.
+func (h *handler) setSessionCookie(w http.ResponseWriter, r *http.Request, state *cookie.SessionState, ttl time.Duration) error {
+	b, err := state.Encode()
+	if err != nil {
+		return err
+	}
+	value, err := h.cookieKeys.Seal(b)
+	if err != nil {
+		return err
+	}
+
+	serverSide := base64.RawURLEncoding.EncodedLen(len(value)) > maxSessionCookieBytes
+	if serverSide {
+		logger := klog.FromContext(r.Context())
+		logger.Info("session state too large for a cookie, keeping it server-side", "session", state.SessionID, "bytes", base64.RawURLEncoding.EncodedLen(len(value)), "max", maxSessionCookieBytes)
+
+		ref, err := (&cookie.SessionState{SessionID: state.SessionID, ServerSide: true}).Encode()
+		if err != nil {
+			return err
+		}
+		if value, err = h.cookieKeys.Seal(ref); err != nil {
+			return err
+		}
+	} else {
+		b = nil // a re-issued state might fit the cookie again
+	}
+	if !h.sessions.SetState(state.SessionID, b) && serverSide {
+		return fmt.Errorf("session %q not found", state.SessionID)
+	}
+
+	http.SetCookie(w, cookie.MakeCookie(r, h.cookieName(state.SessionID), value, ttl))
+	return nil
+}
+
+// sessionState decodes the session cookie, reading the state from the session store
+// if it is kept server-side. Without the session, only the session id is known, and
+// the caller's session lookup fails.
+func (h *handler) sessionState(ck *http.Cookie) (*cookie.SessionState, error) {
+	state, err := cookie.Decode(ck.Value, h.cookieKeys)
+	if err != nil || !state.ServerSide {
+		return state, err
+	}
+	s, found := h.sessions.Get(state.SessionID)
+	if !found || s.State == nil {
+		return state, nil
+	}
+	stored, err := cookie.DecodeState(s.State)
+	if err != nil {
+		return nil, err
+	}
+	if stored.SessionID != state.SessionID {
+		return nil, fmt.Errorf("server-side state of session %q belongs to session %q", state.SessionID, stored.SessionID)
+	}
+	return stored, nil
+}
+
+// acrSatisfied returns whether the acr claim is one of the requested acr values,
+// i.e. whether the user authenticated with a sufficient authentication context.
+func (h *handler) acrSatisfied(claims map[string]interface{}) bool {
+	if len(h.acrValues) == 0 {
+		return true
+	}
+	acr, ok := claims["acr"].(string)
+	return ok && sets.NewString(h.acrValues...).Has(acr)
+}
+
 func parseJWT(p string) ([]byte, error) {
 	parts := strings.Split(p, ".")
 	if len(parts) < 2 {
@@ -163,9 +847,14 @@ func parseJWT(p string) ([]byte, error) {
 func (h *handler) handleCallback(w http.ResponseWriter, r *http.Request) {
 	logger := klog.FromContext(r.Context()).WithValues("method", r.Method, "url", r.URL.String())
 
+	if err := r.ParseForm(); err != nil {
+		logger.Info("failed to parse form", "error", err)
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
 	if errMsg := r.Form.Get("error"); errMsg != "" {
-		logger.Info("failed to authorize", "error", errMsg)
-		http.Error(w, errMsg+": "+r.Form.Get("error_description"), http.StatusBadRequest)
+		logger.Info("failed to authorize", "error", errMsg, "errorDescription", r.Form.Get("error_description"))
+		writeIdPError(w, r, errMsg, r.Form.Get("error_description"))
 		return
 	}
 	code := r.Form.Get("code")
@@ -182,32 +871,43 @@ func (h *handler) handleCallback(w http.ResponseWriter, r *http.Request) {
 	if state == "" {
 		state = r.URL.Query().Get("state")
 	}
-	decode, err := base64.StdEncoding.DecodeString(state)
+	authCode, err := h.authCodes.Decode(state)
+	if err == nil && authCode.CorrelationID != "" {
+		logger = logger.WithValues("correlationID", authCode.CorrelationID)
+	}
 	if err != nil {
 		logger.Info("failed to decode state", "error", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	authCode := &resources.AuthCode{}
-	if err := json.Unmarshal(decode, authCode); err != nil {
-		logger.Info("faile to unmarshal authCode", "error", err)
+	if err := validateAuthCodeAge(authCode, time.Now(), h.stateTTL); err != nil {
+		logger.Info("rejecting stale state", "issuedAt", authCode.IssuedAt, "error", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// TODO: sign state and verify that it is not faked by the oauth provider
-
-	token, err := h.oidc.OIDCProviderConfig(nil).Exchange(r.Context(), code)
-	if err != nil {
-		logger.Info("failed to exchange token", "error", err)
+	token, err := h.oidc.Exchange(r.Context(), code)
+	if errors.Is(err, errCircuitOpen) {
+		h.errorLogs.Info(logger, "not exchanging token, identity provider is unavailable", err)
+		w.Header().Set("Retry-After", strconv.Itoa(int(h.oidc.breaker.coolDown/time.Second)))
+		http.Error(w, "identity provider unavailable, retry later", http.StatusServiceUnavailable)
+		return
+	} else if err != nil {
+		h.errorLogs.Info(logger, "failed to exchange token", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
-	jwtStr, ok := token.Extra("id_token").(string)
+	rawIDToken := token.Extra("id_token")
+	if rawIDToken == nil {
+		// without the openid scope, many identity providers return a plain OAuth2 token.
+		logger.Info("identity provider did not return an id_token", "hint", "is the openid scope supported?")
+		http.Error(w, `identity provider did not return an id_token, make sure it supports the "openid" scope`, http.StatusBadGateway)
+		return
+	}
+	jwtStr, ok := rawIDToken.(string)
 	if !ok {
-		logger.Info("failed to get id_token from token", "error", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		logger.Info("failed to get id_token from token", "error", fmt.Errorf("unexpected id_token type %T", rawIDToken))
+		http.Error(w, "identity provider returned an invalid id_token", http.StatusBadGateway)
 		return
 	}
 
@@ -217,36 +917,49 @@ func (h *handler) handleCallback(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
-	if !ok {
-		logger.Info("failed to get id_token from token", "error", err)
+	var claims map[string]interface{}
+	if err := json.Unmarshal(jwt, &claims); err != nil {
+		logger.Info("failed to unmarshal id token", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	// the session is recorded with the identity later binds act for.
+	if err := h.enrichClaims(r.Context(), claims, token.AccessToken); err != nil {
+		h.errorLogs.Info(logger, "failed to get userinfo claims", err)
+		http.Error(w, "failed to get user info from the identity provider, please restart the binding", http.StatusBadGateway)
+		return
+	}
+	identity, err := h.identityOf(r.Context(), claims)
+	if err != nil {
+		logger.Info("failed to derive identity from id token", "error", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
 	sessionCookie := cookie.SessionState{
-		CreatedAt:    time.Now(),
-		ExpiresOn:    token.Expiry,
-		AccessToken:  token.AccessToken,
-		IDToken:      string(jwt),
-		RefreshToken: token.RefreshToken,
-		RedirectURL:  authCode.RedirectURL,
-		SessionID:    authCode.SessionID,
+		CreatedAt:   time.Now(),
+		ExpiresOn:   token.Expiry,
+		AccessToken: token.AccessToken,
+		IDToken:     string(jwt),
+		RedirectURL: authCode.RedirectURL,
+		SessionID:   authCode.SessionID,
+
+		ClientSessionID: authCode.ClientSessionID,
+		CorrelationID:   authCode.CorrelationID,
+	}
+	if !h.stateless {
+		sessionCookie.RefreshToken = token.RefreshToken
 	}
 
-	b, err := sessionCookie.Encode()
-	if err != nil {
+	// the session must exist to keep states too large for the cookie.
+	h.sessions.Add(authCode.SessionID, identity, h.sessionTTL)
+	if err := h.setSessionCookie(w, r, &sessionCookie, h.sessionTTL); err != nil {
+		h.sessions.Delete(authCode.SessionID)
 		logger.Info("failed to encode session cookie", "error", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
-	http.SetCookie(w, cookie.MakeCookie(
-		r,
-		"kube-bind-"+authCode.SessionID,
-		b,
-		time.Duration(1)*time.Hour),
-	)
-
 	http.Redirect(w, r, "/resources?s="+authCode.SessionID, http.StatusFound)
 }
 
@@ -261,103 +974,698 @@ func (h *handler) handleResources(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// an unsynced lister would silently render an empty or partial page.
+	if !h.apiextensionsSynced() {
+		logger.V(2).Info("CustomResourceDefinition informer not synced yet")
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "service not ready, retry later", http.StatusServiceUnavailable)
+		return
+	}
+
 	crds, err := h.apiextensionsLister.List(labels.Everything())
 	if err != nil {
-		logger.Info("failed to list crds", "error", err)
+		h.errorLogs.Info(logger, "failed to list crds", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	var claims map[string]interface{}
+	if h.entitlement != nil {
+		if claims, err = h.sessionClaims(r); err != nil {
+			logger.Info("failed to get session claims", "error", err)
+			http.Error(w, "session cancelled or expired, please restart the binding", http.StatusUnauthorized)
+			return
+		}
+	}
+	var allowed []*apiextensionsv1.CustomResourceDefinition
+	for _, crd := range crds {
+		if kubebindhelpers.IsKubeBindGroup(crd.Spec.Group) || kubebindhelpers.IsGroupForbidden(crd.Spec.Group, h.forbiddenGroups) {
+			continue
+		}
+		if h.entitlement != nil && !h.entitlement(crd, claims) {
+			continue
+		}
+		allowed = append(allowed, crd)
+	}
+	crds = allowed
 	sort.SliceStable(crds, func(i, j int) bool {
 		return crds[i].Name < crds[j].Name
 	})
 
-	bs := bytes.Buffer{}
-	if err := resourcesTemplate.Execute(&bs, struct {
+	if h.resourcesETag {
+		// the page is per session, hence it must be revalidated and not be shared.
+		w.Header().Set("Cache-Control", "private, no-cache")
+		etag := resourcesETag(r.URL.Query().Get("s"), crds)
+		w.Header().Set("ETag", etag)
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	writeHTML(w, r, http.StatusOK, h.resourcesTemplate, struct {
 		SessionID string
 		CRDs      []*apiextensionsv1.CustomResourceDefinition
 	}{
 		SessionID: r.URL.Query().Get("s"),
 		CRDs:      crds,
-	}); err != nil {
-		logger.Info("failed to execute template", "error", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
-		return
+	})
+}
+
+// identityOf derives the identity from the claims. A namespace bound by the same user
+// before the identity template was introduced, keyed by the sub claim alone, is moved
+// over to the identity.
+func (h *handler) identityOf(ctx context.Context, claims map[string]interface{}) (string, error) {
+	identity, err := h.identity.Identity(claims)
+	if err != nil {
+		return "", err
+	}
+	if h.kubeManager != nil {
+		legacy, _ := claims["sub"].(string)
+		if err := h.kubeManager.MigrateIdentity(ctx, legacy, identity); err != nil {
+			return "", fmt.Errorf("failed to migrate the namespace of %q: %w", legacy, err)
+		}
 	}
+	return identity, nil
+}
 
-	w.Header().Set("Content-Type", "text/html")
-	w.Write(bs.Bytes()) // nolint:errcheck
+// sessionClaims returns the ID token claims of the session of the request.
+func (h *handler) sessionClaims(r *http.Request) (map[string]interface{}, error) {
+	ck, err := r.Cookie(h.cookieName(r.URL.Query().Get("s")))
+	if err != nil {
+		return nil, err
+	}
+	state, err := h.sessionState(ck)
+	if err != nil {
+		return nil, err
+	}
+	if _, found := h.sessions.Get(state.SessionID); !found {
+		return nil, fmt.Errorf("session %q not found", state.SessionID)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal([]byte(state.IDToken), &claims); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal id token: %w", err)
+	}
+	if err := h.enrichClaims(r.Context(), claims, state.AccessToken); err != nil {
+		return nil, fmt.Errorf("failed to get userinfo claims: %w", err)
+	}
+	return claims, nil
+}
+
+// enrichClaims adds the claims of the userinfo endpoint that are missing from the
+// ID token claims, if enabled. The claims of the signed ID token take precedence.
+func (h *handler) enrichClaims(ctx context.Context, claims map[string]interface{}, accessToken string) error {
+	if h.oidc == nil || h.oidc.userInfoTimeout == 0 {
+		return nil
+	}
+
+	subject, _ := claims["sub"].(string)
+	info, err := h.oidc.UserInfo(ctx, accessToken, subject)
+	if err != nil {
+		return err
+	}
+	for k, v := range info {
+		if _, found := claims[k]; !found {
+			claims[k] = v
+		}
+	}
+	return nil
 }
 
 func (h *handler) handleBind(w http.ResponseWriter, r *http.Request) {
+	h.bind(w, r, r.URL.Query(), false)
+}
+
+// handleRotate invalidates the credentials minted for the session user and
+// responds like handleBind with a fresh kubeconfig. It takes the parameters of
+// handleBind as form values of a same-origin POST, as a cross-site request would
+// otherwise invalidate the credentials of the victim.
+func (h *handler) handleRotate(w http.ResponseWriter, r *http.Request) {
 	logger := klog.FromContext(r.Context()).WithValues("method", r.Method, "url", r.URL.String())
 
 	prepareNoCache(w)
 
-	ck, err := r.Cookie("kube-bind-" + r.URL.Query().Get("s"))
+	if err := h.checkSameOrigin(r); err != nil {
+		logger.Info("refusing cross-site rotation", "error", err)
+		http.Error(w, "cross-site request refused", http.StatusForbidden)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	h.bind(w, r, r.Form, true)
+}
+
+// checkSameOrigin returns an error unless the browser marks the request as coming
+// from the origin of the backend, i.e. the origin of its callback URL. Requests
+// without an Origin or Sec-Fetch-Site header are refused too.
+func (h *handler) checkSameOrigin(r *http.Request) error {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		if site != "same-origin" {
+			return fmt.Errorf("Sec-Fetch-Site is %q", site)
+		}
+		return nil
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return fmt.Errorf("missing Origin header")
+	}
+	backend, err := url.Parse(h.backendCallbackURL)
+	if err != nil {
+		return err
+	}
+	if want := backend.Scheme + "://" + backend.Host; !strings.EqualFold(origin, want) {
+		return fmt.Errorf("origin %q is not %q", origin, want)
+	}
+	return nil
+}
+
+func (h *handler) bind(w http.ResponseWriter, r *http.Request, params url.Values, rotate bool) {
+	logger := klog.FromContext(r.Context()).WithValues("method", r.Method, "url", r.URL.String())
+
+	prepareNoCache(w)
+
+	if h.maintenance.refuse(w, r) {
+		logger.V(2).Info("refusing to bind during maintenance")
+		return
+	}
+
+	group, resource, err := normalizeGroupResource(params.Get("group"), params.Get("resource"))
+	if err != nil {
+		logger.Info("invalid bind target", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if kubebindhelpers.IsKubeBindGroup(group) {
+		logger.Info("refusing to bind kube-bind group", "group", group)
+		http.Error(w, fmt.Sprintf("group %q belongs to kube-bind itself and cannot be exported", group), http.StatusForbidden)
+		return
+	}
+	if kubebindhelpers.IsGroupForbidden(group, h.forbiddenGroups) {
+		logger.Info("refusing to bind forbidden group", "group", group)
+		http.Error(w, fmt.Sprintf("group %q cannot be exported", group), http.StatusForbidden)
+		return
+	}
+	// an unsynced lister would reject existing CRDs.
+	if !h.apiextensionsSynced() {
+		logger.V(2).Info("CustomResourceDefinition informer not synced yet")
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "service not ready, retry later", http.StatusServiceUnavailable)
+		return
+	}
+	crd, err := h.getCRD(resource, group)
+	if err != nil {
+		logger.Info("invalid bind target", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	version := params.Get("version")
+	if err := validateVersion(crd, version); err != nil {
+		logger.Info("invalid version pin", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	format := params.Get("format")
+	if format != "" && format != bindFormatDownload {
+		http.Error(w, fmt.Sprintf("invalid format %q, must be empty or %q", format, bindFormatDownload), http.StatusBadRequest)
+		return
+	}
+	kubeconfigFormat := params.Get("kubeconfigFormat")
+	if err := h.validateKubeconfigFormat(kubeconfigFormat); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	landing := h.bindLandingPage
+	if v := params.Get("landing"); v != "" {
+		if landing, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, fmt.Sprintf("invalid landing %q, must be true or false", v), http.StatusBadRequest)
+			return
+		}
+	}
+
+	ck, err := r.Cookie(h.cookieName(params.Get("s")))
 	if err != nil {
 		logger.Info("failed to get session cookie", "error", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
-	state, err := cookie.Decode(ck.Value)
+	state, err := h.sessionState(ck)
 	if err != nil {
 		logger.Info("failed to decode session cookie", "error", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
-
-	var idToken struct {
-		Subject string `json:"sub"`
-		Issuer  string `json:"iss"`
+	if state.CorrelationID != "" {
+		logger = logger.WithValues("correlationID", state.CorrelationID)
+	}
+	if _, found := h.sessions.Get(state.SessionID); !found {
+		logger.Info("session not found, it was cancelled or has expired", "session", state.SessionID)
+		http.SetCookie(w, cookie.ClearCookie(r, ck.Name))
+		http.Error(w, "session cancelled or expired, please restart the binding", http.StatusUnauthorized)
+		return
 	}
-	if err := json.Unmarshal([]byte(state.IDToken), &idToken); err != nil {
+
+	var claims map[string]interface{}
+	if err := json.Unmarshal([]byte(state.IDToken), &claims); err != nil {
 		logger.Info("failed to unmarshal id token", "error", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
-
-	group := r.URL.Query().Get("group")
-	resource := r.URL.Query().Get("resource")
-	kfg, err := h.kubeManager.HandleResources(r.Context(), idToken.Subject, resource, group)
+	if err := h.enrichClaims(r.Context(), claims, state.AccessToken); err != nil {
+		h.errorLogs.Info(logger, "failed to get userinfo claims", err)
+		http.Error(w, "failed to get user info from the identity provider, please restart the binding", http.StatusBadGateway)
+		return
+	}
+	identity, err := h.identityOf(r.Context(), claims)
+	if err != nil {
+		logger.Info("failed to derive identity from id token", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !h.acrSatisfied(claims) {
+		logger.Info("refusing to bind with insufficient authentication context", "identity", identity, "acr", claims["acr"])
+		http.Error(w, fmt.Sprintf("authentication context does not satisfy %q, please restart the binding", strings.Join(h.acrValues, " ")), http.StatusForbidden)
+		return
+	}
+	if h.entitlement != nil && !h.entitlement(crd, claims) {
+		logger.Info("refusing to bind resource the user is not entitled to", "identity", identity, "crd", crd.Name)
+		http.Error(w, fmt.Sprintf("not entitled to bind %s", crd.Name), http.StatusForbidden)
+		return
+	}
+	targetNamespace := params.Get("targetNamespace")
+	if err := validateTargetNamespace(targetNamespace, h.targetNamespacePattern, h.targetNamespaces); err != nil {
+		logger.Info("invalid target namespace", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	allowed, reason, err := h.authorizer.Authorize(r.Context(), &BindRequest{
+		Identity:        identity,
+		Claims:          claims,
+		CRD:             crd,
+		Group:           group,
+		Resource:        resource,
+		Version:         version,
+		TargetNamespace: targetNamespace,
+		Rotate:          rotate,
+	})
 	if err != nil {
-		logger.Info("failed to handle resources", "error", err)
+		h.errorLogs.Info(logger, "failed to authorize bind", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
+	} else if !allowed {
+		logger.Info("bind denied by authorizer", "identity", identity, "crd", crd.Name, "reason", reason)
+		msg := fmt.Sprintf("not allowed to bind %s", crd.Name)
+		if reason != "" {
+			msg += ": " + reason
+		}
+		http.Error(w, msg, http.StatusForbidden)
+		return
 	}
+	release, err := h.bindings.Reserve(r.Context(), identity, resource+"."+group)
+	if errors.Is(err, errBindingInProgress) {
+		logger.Info("refusing to bind while other binds of the user are in progress", "identity", identity)
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "binding limit reached with binds in progress, retry later", http.StatusTooManyRequests)
+		return
+	} else if errors.Is(err, errBindingLimitReached) {
+		logger.Info("refusing to bind beyond the binding limit", "identity", identity, "limit", h.bindings.max)
+		http.Error(w, fmt.Sprintf("binding limit of %d resources reached", h.bindings.max), http.StatusForbidden)
+		return
+	} else if err != nil {
+		h.errorLogs.Info(logger, "failed to count bindings", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	defer release()
 
-	// callback client with access token and kubeconfig
-	authResponse := resources.AuthResponse{
-		SessionID:  state.SessionID,
-		ID:         idToken.Issuer + "/" + idToken.Subject,
-		Kubeconfig: kfg,
-		Group:      group,
-		Resource:   resource,
-		Export:     resource + "." + group,
+	// downloads are not redirected to the consumer callback, hence it need not be reachable.
+	if format != bindFormatDownload {
+		if err := h.checkCallbackReachable(r.Context(), state.RedirectURL); err != nil {
+			logger.Info("consumer callback not reachable", "error", err)
+			writeErrorResponse(w, r, ErrorResponse{
+				Code:    http.StatusBadGateway,
+				Message: "The tool you started the binding with cannot be reached anymore.",
+				Detail:  err.Error(),
+				Hint:    "Please make sure kubectl bind is still running, or start the binding again.",
+			})
+			return
+		}
+	}
+
+	if rotate {
+		if err := h.kubeManager.RotateCredentials(r.Context(), identity); errors.Is(err, kubernetes.ErrRotationNotSupported) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			h.errorLogs.Info(logger, "failed to rotate credentials", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	kfg, err := h.kubeManager.HandleResources(r.Context(), identity, h.claimLabels.Labels(claims), resource, group, version, targetNamespace, kubeconfigFormat)
+	var conflictErr *kubernetes.TargetNamespaceConflictError
+	if errors.As(err, &conflictErr) || apierrors.IsAlreadyExists(err) {
+		logger.Info("target namespace not available", "error", err)
+		http.Error(w, "target namespace not available: "+err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		h.errorLogs.Info(logger, "failed to handle resources", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
 	}
 
-	payload, err := json.Marshal(authResponse)
+	if format == bindFormatDownload {
+		h.completeSession(w, r, ck.Name, state.SessionID)
+		writeKubeconfigDownload(w, kfg)
+		return
+	}
+
+	// callback client with access token and kubeconfig
+	payload, err := json.Marshal(newAuthResponse(state, identity, kfg, group, resource, version))
 	if err != nil {
 		logger.Info("failed to marshal auth response", "error", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
+	redirectURL, err := h.authResponseRedirectURL(state.RedirectURL, payload)
+	if err != nil {
+		logger.Info("failed to build redirect url", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	h.completeSession(w, r, ck.Name, state.SessionID)
+	h.redirectToConsumer(w, r, landing, &boundPage{
+		ProviderPrettyName: h.providerPrettyName,
+		CRD:                crd,
+		Version:            version,
+		TargetNamespace:    targetNamespace,
+		RedirectURL:        redirectURL,
+	})
+}
+
+// boundPage is the data of the landing page after a bind.
+type boundPage struct {
+	ProviderPrettyName string
+	CRD                *apiextensionsv1.CustomResourceDefinition
+	// Version is the pinned version, empty if all served versions are bound.
+	Version         string
+	TargetNamespace string
+	// RedirectURL is the consumer callback carrying the auth response.
+	RedirectURL string
+}
+
+// redirectToConsumer redirects to the consumer callback, or with landing renders the
+// landing page summarizing the binding and linking to the callback.
+func (h *handler) redirectToConsumer(w http.ResponseWriter, r *http.Request, landing bool, page *boundPage) {
+	if !landing {
+		http.Redirect(w, r, page.RedirectURL, http.StatusFound)
+		return
+	}
+	writeHTML(w, r, http.StatusOK, h.boundTemplate, page)
+}
+
+// authResponseRedirectURL returns the consumer callback URL carrying the auth response.
+// Responses too large for a URL are stored to be claimed with the returned claim token.
+func (h *handler) authResponseRedirectURL(callbackURL string, payload []byte) (string, error) {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return "", err
+	}
+
 	encoded := base64.StdEncoding.EncodeToString(payload)
+	values := u.Query()
+	if h.maxInlineAuthResponseBytes > 0 && len(encoded) > h.maxInlineAuthResponseBytes {
+		token, err := h.claims.Put(payload, claimTTL)
+		if err != nil {
+			return "", err
+		}
+		values.Add("claim", token)
+		values.Add("claim_url", strings.TrimSuffix(h.backendCallbackURL, "/callback")+"/claim")
+	} else {
+		values.Add("auth_response", encoded)
+	}
+	if h.signingKey != nil {
+		// the signature covers the payload as claimed or inlined.
+		values.Add("auth_response_signature", base64.StdEncoding.EncodeToString(ed25519.Sign(h.signingKey, payload)))
+		values.Add("auth_response_key_id", h.signingKeyID)
+	}
+	u.RawQuery = values.Encode()
 
-	parsedAuthURL, err := url.Parse(state.RedirectURL)
+	return u.String(), nil
+}
+
+// checkCallbackReachable checks that the consumer callback answers at all, such that
+// users are not redirected to a dead page. It is a no-op if the check is disabled or
+// the callback is not on one of the allowed hosts. The callback is chosen by the
+// client, hence probing arbitrary hosts would let anybody reach the backend network.
+// Loopback callbacks, like the usual one of kubectl bind, point at the machine of
+// the consumer and are never probed: loopback hosts are refused as allowed hosts.
+func (h *handler) checkCallbackReachable(ctx context.Context, callbackURL string) error {
+	if h.callbackCheckTimeout == 0 {
+		return nil
+	}
+	u, err := url.Parse(callbackURL)
 	if err != nil {
-		logger.Info("failed to parse redirect url", "error", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		return err
+	}
+	if !h.callbackCheckHosts.Has(u.Hostname()) {
+		return nil
+	}
+
+	for attempt := 0; attempt <= h.callbackCheckRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(callbackCheckRetryDelay):
+			}
+		}
+		if err = h.probeCallback(ctx, callbackURL); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// probeCallback sends a HEAD request to the callback. Any response, whatever the
+// status, means it is reachable.
+func (h *handler) probeCallback(ctx context.Context, callbackURL string) error {
+	ctx, cancel := context.WithTimeout(ctx, h.callbackCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, callbackURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := h.callbackCheckClient.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// newCallbackCheckClient returns a client for probing consumer callbacks. It does not
+// follow redirects, bypasses proxies, and refuses to connect to loopback, link-local,
+// multicast and unspecified addresses, also if a host resolves to one. Private
+// addresses are allowed, as the hosts probed are chosen by the operator and may well
+// be internal ones, but link-local ones like cloud metadata endpoints are not.
+func newCallbackCheckClient() *http.Client {
+	dialer := &net.Dialer{
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isProbeableIP(ip) {
+				return fmt.Errorf("refusing to connect to address %s", host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func isProbeableIP(ip net.IP) bool {
+	return ip.IsGlobalUnicast()
+}
+
+// writeKubeconfigDownload makes the browser save the kubeconfig as a file.
+func writeKubeconfigDownload(w http.ResponseWriter, kubeconfig []byte) {
+	w.Header().Set("Content-Disposition", `attachment; filename="kubeconfig.yaml"`)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	writeBody(w, contentTypeYAML, kubeconfig)
+}
+
+// completeSession ends the session after a successful bind in stateless mode,
+// such that nothing outlives the bind.
+func (h *handler) completeSession(w http.ResponseWriter, r *http.Request, cookieName, sessionID string) {
+	if !h.stateless {
+		return
+	}
+	h.sessions.Delete(sessionID)
+	http.SetCookie(w, cookie.ClearCookie(r, cookieName))
+}
+
+// handleClaim returns the auth response stored for the claim token of a bind whose
+// response was too large for the redirect URL. Each token can be claimed once.
+func (h *handler) handleClaim(w http.ResponseWriter, r *http.Request) {
+	logger := klog.FromContext(r.Context()).WithValues("method", r.Method, "url", r.URL.String())
+
+	prepareNoCache(w)
+
+	if err := r.ParseForm(); err != nil {
+		logger.Info("failed to parse form", "error", err)
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	token := r.PostForm.Get("token")
+	if token == "" {
+		http.Error(w, "missing token", http.StatusBadRequest)
+		return
+	}
+
+	payload, found := h.claims.Take(token)
+	if !found {
+		logger.Info("claim not found, it was already claimed or has expired")
+		http.Error(w, "claim not found or expired", http.StatusNotFound)
+		return
+	}
+
+	writeBody(w, contentTypeJSON, payload)
+}
+
+// handleCancel invalidates the session of an abandoned binding flow and clears its cookie.
+func (h *handler) handleCancel(w http.ResponseWriter, r *http.Request) {
+	logger := klog.FromContext(r.Context()).WithValues("method", r.Method, "url", r.URL.String())
+
+	prepareNoCache(w)
+
+	// the session can also be passed as form value when posting from the consent page.
+	if err := r.ParseForm(); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid form", http.StatusBadRequest)
 		return
 	}
+	sessionID := r.Form.Get("s")
+	if sessionID == "" {
+		http.Error(w, "missing session_id", http.StatusBadRequest)
+		return
+	}
+
+	h.sessions.Delete(sessionID)
+	http.SetCookie(w, cookie.ClearCookie(r, h.cookieName(sessionID)))
+	logger.V(2).Info("cancelled session", "session", sessionID)
+
+	writeBody(w, contentTypeText, []byte("Binding cancelled. You can close this window.\n"))
+}
+
+// validateKubeconfigFormat returns an error if the kubeconfig format is unknown or
+// not supported by the backend. Empty is kubernetes.TokenKubeconfigFormat.
+func (h *handler) validateKubeconfigFormat(format string) error {
+	switch format {
+	case "", kubernetes.TokenKubeconfigFormat:
+		return nil
+	case kubernetes.ExecKubeconfigFormat:
+		if h.kubeManager != nil && !h.kubeManager.SupportsKubeconfigFormat(format) {
+			return fmt.Errorf("exec kubeconfigs are not supported by this backend")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid kubeconfigFormat %q, must be empty, %q or %q", format, kubernetes.TokenKubeconfigFormat, kubernetes.ExecKubeconfigFormat)
+	}
+}
+
+// validateVersion checks that a pinned version is served by the CRD of the resource.
+// An empty version means all served versions.
+func validateVersion(crd *apiextensionsv1.CustomResourceDefinition, version string) error {
+	if version == "" {
+		return nil
+	}
+	var served []string
+	for _, v := range crd.Spec.Versions {
+		if !v.Served {
+			continue
+		}
+		if v.Name == version {
+			return nil
+		}
+		served = append(served, v.Name)
+	}
+	return fmt.Errorf("version %q of %s is not served, must be one of %s", version, crd.Name, strings.Join(served, ", "))
+}
 
-	values := parsedAuthURL.Query()
-	values.Add("auth_response", encoded)
+// getCRD returns the CustomResourceDefinition of the resource. Built-in resources
+// are not represented by a CRD and cannot be bound.
+func (h *handler) getCRD(resource, group string) (*apiextensionsv1.CustomResourceDefinition, error) {
+	if kubebindhelpers.IsBuiltInGroup(group) {
+		return nil, fmt.Errorf("resource %q of group %q is built into Kubernetes, only CustomResourceDefinitions can be bound", resource, group)
+	}
+	crd, err := h.apiextensionsLister.Get(resource + "." + group)
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("resource %s.%s is not a CustomResourceDefinition", resource, group)
+	} else if err != nil {
+		return nil, err
+	}
+	return crd, nil
+}
 
-	parsedAuthURL.RawQuery = values.Encode()
+// normalizeGroupResource lowercases the group, as API groups are DNS names, and
+// validates the resource, which must be the lowercase plural as in the API server paths.
+func normalizeGroupResource(group, resource string) (string, string, error) {
+	group = strings.ToLower(group)
+	if err := kubebindhelpers.ValidateGroup(group); err != nil {
+		return "", "", err
+	}
+	if resource != strings.ToLower(resource) {
+		return "", "", fmt.Errorf("invalid resource %q: must be the lowercase plural name of the resource, e.g. %q", resource, strings.ToLower(resource))
+	}
+	if errs := validation.IsDNS1035Label(resource); len(errs) > 0 {
+		return "", "", fmt.Errorf("invalid resource %q: %s", resource, strings.Join(errs, ", "))
+	}
+	return group, resource, nil
+}
 
-	http.Redirect(w, r, parsedAuthURL.String(), http.StatusFound)
+// validateTargetNamespace checks a consumer-chosen namespace against the policy. An
+// empty namespace means the namespace is derived from the identity, which is not
+// allowed if the namespaces are restricted to allowed ones.
+func validateTargetNamespace(ns string, pattern *regexp.Regexp, allowed sets.String) error {
+	if ns == "" {
+		if allowed.Len() > 0 {
+			return fmt.Errorf("a target namespace is required by this provider, one of %s", strings.Join(allowed.List(), ", "))
+		}
+		return nil
+	}
+	if pattern == nil {
+		return errors.New("choosing a target namespace is not allowed by this provider")
+	}
+	if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+		return fmt.Errorf("invalid target namespace %q: %s", ns, strings.Join(errs, ", "))
+	}
+	if !pattern.MatchString(ns) || (allowed.Len() > 0 && !allowed.Has(ns)) {
+		return fmt.Errorf("target namespace %q is not allowed by this provider", ns)
+	}
+	return nil
 }
 
 func mustRead(f func(name string) ([]byte, error), name string) string {
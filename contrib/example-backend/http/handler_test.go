@@ -0,0 +1,2121 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"text/template"
+	"time"
+
+	oidc "github.com/coreos/go-oidc"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionslisters "k8s.io/apiextensions-apiserver/pkg/client/listers/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	kubeinformers "k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/kube-bind/kube-bind/contrib/example-backend/cookie"
+	"github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes"
+	"github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes/resources"
+	"github.com/kube-bind/kube-bind/contrib/example-backend/options"
+	"github.com/kube-bind/kube-bind/contrib/example-backend/session"
+	"github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+	kubebindhelpers "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1/helpers"
+	bindfake "github.com/kube-bind/kube-bind/pkg/client/clientset/versioned/fake"
+	bindinformers "github.com/kube-bind/kube-bind/pkg/client/informers/externalversions"
+)
+
+func newTestCRDLister(t *testing.T, crds ...*apiextensionsv1.CustomResourceDefinition) apiextensionslisters.CustomResourceDefinitionLister {
+	t.Helper()
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, crd := range crds {
+		require.NoError(t, indexer.Add(crd))
+	}
+	return apiextensionslisters.NewCustomResourceDefinitionLister(indexer)
+}
+
+// newTestIdentityTemplate parses the identity template.
+func newTestIdentityTemplate(t *testing.T, identityTemplate string) *template.Template {
+	t.Helper()
+
+	tmpl, err := options.ParseIdentityTemplate(identityTemplate)
+	require.NoError(t, err)
+	return tmpl
+}
+
+// newTestHandler returns a handler with the given options, defaulting those every
+// handler needs.
+func newTestHandler(t *testing.T, opts HandlerOptions) *handler {
+	t.Helper()
+
+	if opts.ProviderPrettyName == "" {
+		opts.ProviderPrettyName = "Test Backend"
+	}
+	if opts.Identity == nil {
+		opts.Identity = newTestIdentityTemplate(t, "{{.iss}}/{{.sub}}")
+	}
+	if opts.SessionTTL == 0 {
+		opts.SessionTTL = time.Hour
+	}
+	if opts.AuthCodeStorage == "" {
+		opts.AuthCodeStorage = StateAuthCodeStorage
+	}
+	if opts.CRDLister == nil {
+		opts.CRDLister = newTestCRDLister(t)
+	}
+	if opts.CRDSynced == nil {
+		opts.CRDSynced = func() bool { return true }
+	}
+	if opts.Sessions == nil {
+		opts.Sessions = session.NewStore()
+	}
+	if opts.Claims == nil {
+		opts.Claims = session.NewClaimStore()
+	}
+	if opts.AuthCodes == nil {
+		opts.AuthCodes = session.NewClaimStore()
+	}
+
+	h, err := NewHandler(opts)
+	require.NoError(t, err)
+	return h
+}
+
+// newTestCRD returns the CustomResourceDefinition of mangodbs.mangodb.com.
+func newTestCRD() *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "mangodb.com",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb"},
+			Scope: apiextensionsv1.ClusterScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1", Served: true, Storage: true},
+			},
+		},
+	}
+}
+
+func TestHandleResourcesInformerSync(t *testing.T) {
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "mangodb.com",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb"},
+			Scope: apiextensionsv1.ClusterScoped,
+		},
+	}
+
+	synced := false
+	h := newTestHandler(t, HandlerOptions{
+		CRDLister: newTestCRDLister(t, crd),
+		CRDSynced: func() bool { return synced },
+	})
+
+	t.Run("not synced", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.handleResources(w, httptest.NewRequest(http.MethodGet, "/resources?s=abc", nil))
+		require.Equal(t, http.StatusServiceUnavailable, w.Code)
+		require.NotEmpty(t, w.Header().Get("Retry-After"))
+	})
+
+	t.Run("synced", func(t *testing.T) {
+		synced = true
+		w := httptest.NewRecorder()
+		h.handleResources(w, httptest.NewRequest(http.MethodGet, "/resources?s=abc", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Contains(t, w.Body.String(), "mangodbs")
+	})
+}
+
+func TestAuthorizePromptMaxAge(t *testing.T) {
+	h := newTestHandler(t, HandlerOptions{
+		Prompt: "consent",
+		MaxAge: 10 * time.Minute,
+	})
+	h.oidc = &OIDCServiceProvider{provider: &oidc.Provider{}}
+
+	tests := []struct {
+		name       string
+		query      string
+		wantCode   int
+		wantPrompt string
+		wantMaxAge string
+	}{
+		{name: "defaults", wantCode: http.StatusFound, wantPrompt: "consent", wantMaxAge: "600"},
+		{name: "force login", query: "&prompt=login&max_age=0", wantCode: http.StatusFound, wantPrompt: "login", wantMaxAge: "0"},
+		{name: "silent", query: "&prompt=none", wantCode: http.StatusFound, wantPrompt: "none", wantMaxAge: "600"},
+		{name: "invalid prompt", query: "&prompt=always", wantCode: http.StatusBadRequest},
+		{name: "invalid max_age", query: "&max_age=-1", wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.handleAuthorize(w, httptest.NewRequest(http.MethodGet, "/authorize?u=http://localhost:1234/callback&s=abc"+tt.query, nil))
+			require.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode != http.StatusFound {
+				return
+			}
+
+			location, err := url.Parse(w.Header().Get("Location"))
+			require.NoError(t, err)
+			require.Equal(t, tt.wantPrompt, location.Query().Get("prompt"))
+			require.Equal(t, tt.wantMaxAge, location.Query().Get("max_age"))
+		})
+	}
+}
+
+func TestAuthorizeLoginHint(t *testing.T) {
+	h := newTestHandler(t, HandlerOptions{})
+	h.oidc = &OIDCServiceProvider{provider: &oidc.Provider{}}
+
+	tests := []struct {
+		name      string
+		hint      string
+		wantCode  int
+		wantError string
+	}{
+		{name: "none", wantCode: http.StatusFound},
+		{name: "email", hint: "jane@example.com", wantCode: http.StatusFound},
+		{name: "unicode", hint: "Jäne Dœ", wantCode: http.StatusFound},
+		{name: "too long", hint: strings.Repeat("a", maxLoginHintLength+1), wantCode: http.StatusBadRequest, wantError: "at most 256 bytes"},
+		{name: "newline", hint: "jane@example.com\r\nX-Injected: 1", wantCode: http.StatusBadRequest, wantError: "control characters"},
+		{name: "invalid utf-8", hint: "jane\xff", wantCode: http.StatusBadRequest, wantError: "valid UTF-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := url.Values{"u": {"http://localhost:1234/callback"}, "s": {"abc"}}
+			if tt.hint != "" {
+				query.Set("login_hint", tt.hint)
+			}
+			w := httptest.NewRecorder()
+			h.handleAuthorize(w, httptest.NewRequest(http.MethodGet, "/authorize?"+query.Encode(), nil))
+			require.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode != http.StatusFound {
+				require.Contains(t, w.Body.String(), tt.wantError)
+				return
+			}
+
+			location, err := url.Parse(w.Header().Get("Location"))
+			require.NoError(t, err)
+			hints, found := location.Query()["login_hint"]
+			require.Equal(t, tt.hint != "", found)
+			if found {
+				require.Equal(t, []string{tt.hint}, hints)
+			}
+		})
+	}
+}
+
+func TestAcrValues(t *testing.T) {
+	// the entitlement hook runs after the acr check and tells whether it was passed.
+	var entitlementChecked bool
+	entitlement := func(crd *apiextensionsv1.CustomResourceDefinition, claims map[string]interface{}) bool {
+		entitlementChecked = true
+		return false
+	}
+	sessions := session.NewStore()
+	h := newTestHandler(t, HandlerOptions{
+		Entitlement: entitlement,
+		AcrValues:   []string{"mfa", "phr"},
+		CRDLister:   newTestCRDLister(t, newTestCRD()),
+		Sessions:    sessions,
+	})
+	h.oidc = &OIDCServiceProvider{provider: &oidc.Provider{}}
+
+	w := httptest.NewRecorder()
+	h.handleAuthorize(w, httptest.NewRequest(http.MethodGet, "/authorize?u=http://localhost:1234/callback&s=abc", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, "mfa phr", location.Query().Get("acr_values"))
+
+	tests := []struct {
+		name      string
+		idToken   string
+		satisfied bool
+	}{
+		{name: "satisfied", idToken: `{"iss":"https://issuer","sub":"jane","acr":"phr"}`, satisfied: true},
+		{name: "insufficient", idToken: `{"iss":"https://issuer","sub":"jane","acr":"pwd"}`},
+		{name: "missing", idToken: `{"iss":"https://issuer","sub":"jane"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entitlementChecked = false
+			sessions.Add("abc", "jane", time.Hour)
+			b, err := (&cookie.SessionState{IDToken: tt.idToken, SessionID: "abc"}).Encode()
+			require.NoError(t, err)
+			r := httptest.NewRequest(http.MethodGet, "/bind?s=abc&group=mangodb.com&resource=mangodbs", nil)
+			r.AddCookie(cookie.MakeCookie(r, "kube-bind-abc", b, time.Hour))
+
+			w := httptest.NewRecorder()
+			h.handleBind(w, r)
+			require.Equal(t, http.StatusForbidden, w.Code)
+			require.Equal(t, tt.satisfied, entitlementChecked)
+			if !tt.satisfied {
+				require.Contains(t, w.Body.String(), `authentication context does not satisfy "mfa phr"`)
+			}
+		})
+	}
+}
+
+func TestAuthorizeScopes(t *testing.T) {
+	tests := []struct {
+		name       string
+		reject     bool
+		query      string
+		wantCode   int
+		wantScopes string
+	}{
+		{name: "defaults", wantCode: http.StatusFound, wantScopes: "openid profile email offline_access"},
+		{name: "allowed subset", query: "&scope=groups", wantCode: http.StatusFound, wantScopes: "openid profile email offline_access groups"},
+		{name: "default scope requested again", query: "&scope=openid+groups", wantCode: http.StatusFound, wantScopes: "openid profile email offline_access groups"},
+		{name: "disallowed dropped", query: "&scope=groups+admin", wantCode: http.StatusFound, wantScopes: "openid profile email offline_access groups"},
+		{name: "disallowed rejected", reject: true, query: "&scope=groups+admin", wantCode: http.StatusBadRequest},
+		{name: "allowed accepted when rejecting", reject: true, query: "&scope=groups&scope=audit", wantCode: http.StatusFound, wantScopes: "openid profile email offline_access groups audit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, HandlerOptions{
+				AllowedScopes:          []string{"groups", "audit"},
+				RejectDisallowedScopes: tt.reject,
+			})
+			h.oidc = &OIDCServiceProvider{provider: &oidc.Provider{}}
+
+			w := httptest.NewRecorder()
+			h.handleAuthorize(w, httptest.NewRequest(http.MethodGet, "/authorize?u=http://localhost:1234/callback&s=abc"+tt.query, nil))
+			require.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode != http.StatusFound {
+				return
+			}
+
+			location, err := url.Parse(w.Header().Get("Location"))
+			require.NoError(t, err)
+			require.Equal(t, tt.wantScopes, location.Query().Get("scope"))
+		})
+	}
+}
+
+func TestForbiddenGroups(t *testing.T) {
+	crd := func(name, group string) *apiextensionsv1.CustomResourceDefinition {
+		return &apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       apiextensionsv1.CustomResourceDefinitionSpec{Group: group},
+		}
+	}
+	h := newTestHandler(t, HandlerOptions{
+		ForbiddenGroups: []string{"*.k8s.io"},
+		CRDLister: newTestCRDLister(t,
+			crd("mangodbs.mangodb.com", "mangodb.com"),
+			crd("volumesnapshots.snapshot.storage.k8s.io", "snapshot.storage.k8s.io"),
+		),
+	})
+
+	t.Run("hidden", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.handleResources(w, httptest.NewRequest(http.MethodGet, "/resources?s=abc", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Contains(t, w.Body.String(), "mangodb.com")
+		require.NotContains(t, w.Body.String(), "snapshot.storage.k8s.io")
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.handleBind(w, httptest.NewRequest(http.MethodGet, "/bind?s=abc&group=snapshot.storage.k8s.io&resource=volumesnapshots", nil))
+		require.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("rejected with mixed case", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.handleBind(w, httptest.NewRequest(http.MethodGet, "/bind?s=abc&group=Snapshot.Storage.K8s.io&resource=volumesnapshots", nil))
+		require.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestKubeBindGroupsExcluded(t *testing.T) {
+	crd := func(name, group string) *apiextensionsv1.CustomResourceDefinition {
+		return &apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       apiextensionsv1.CustomResourceDefinitionSpec{Group: group},
+		}
+	}
+	// no forbidden groups are configured, kube-bind's own groups are excluded anyway.
+	h := newTestHandler(t, HandlerOptions{
+		CRDLister: newTestCRDLister(t,
+			crd("mangodbs.mangodb.com", "mangodb.com"),
+			crd("apiserviceexports.kube-bind.io", "kube-bind.io"),
+			crd("widgets.example.kube-bind.io", "example.kube-bind.io"),
+		),
+	})
+
+	t.Run("hidden", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.handleResources(w, httptest.NewRequest(http.MethodGet, "/resources?s=abc", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Contains(t, w.Body.String(), "mangodb.com")
+		require.NotContains(t, w.Body.String(), "kube-bind.io")
+	})
+
+	for _, group := range []string{"kube-bind.io", "example.kube-bind.io", "Kube-Bind.io"} {
+		t.Run("rejected "+group, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.handleBind(w, httptest.NewRequest(http.MethodGet, "/bind?s=abc&group="+group+"&resource=apiserviceexports", nil))
+			require.Equal(t, http.StatusForbidden, w.Code)
+			require.Contains(t, w.Body.String(), "belongs to kube-bind itself")
+		})
+	}
+}
+
+func TestVersionPin(t *testing.T) {
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "mangodb.com",
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1", Served: true, Storage: true},
+				{Name: "v1beta1", Served: true},
+				{Name: "v1alpha1", Served: false},
+			},
+		},
+	}
+	h := newTestHandler(t, HandlerOptions{
+		CRDLister: newTestCRDLister(t, crd),
+	})
+
+	require.NoError(t, validateVersion(crd, ""))
+	require.NoError(t, validateVersion(crd, "v1beta1"))
+	require.Error(t, validateVersion(crd, "v1alpha1"), "unserved version")
+	require.Error(t, validateVersion(crd, "v2"), "unknown version")
+
+	w := httptest.NewRecorder()
+	h.handleBind(w, httptest.NewRequest(http.MethodGet, "/bind?s=abc&group=mangodb.com&resource=mangodbs&version=v2", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "not served")
+}
+
+func TestIdentityTemplate(t *testing.T) {
+	claims := map[string]interface{}{
+		"iss":   "https://login.example.com/tenant-a/v2.0",
+		"sub":   "1234",
+		"email": "jane@example.com",
+		"tid":   "tenant-a",
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{name: "default", template: "{{.iss}}/{{.sub}}", want: "https://login.example.com/tenant-a/v2.0/1234"},
+		{name: "email", template: "{{.email}}", want: "jane@example.com"},
+		{name: "tenant claim", template: "{{.tid}}/{{.sub}}", want: "tenant-a/1234"},
+		{name: "missing claim", template: "{{.groups}}", wantErr: true},
+		{name: "empty", template: "{{if false}}x{{end}}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := newIdentityBuilder(newTestIdentityTemplate(t, tt.template))
+			require.NoError(t, err)
+
+			got, err := b.Identity(claims)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHandleCancel(t *testing.T) {
+	sessions := session.NewStore()
+	h := newTestHandler(t, HandlerOptions{
+		Sessions: sessions,
+	})
+
+	sessions.Add("abc", "jane", time.Hour)
+	sessions.Add("other", "jane", time.Hour)
+
+	w := httptest.NewRecorder()
+	h.handleCancel(w, httptest.NewRequest(http.MethodPost, "/cancel?s=abc", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	_, found := sessions.Get("abc")
+	require.False(t, found, "cancelled session should be removed")
+	_, found = sessions.Get("other")
+	require.True(t, found, "other sessions should be kept")
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	require.Equal(t, "kube-bind-abc", cookies[0].Name)
+	require.Equal(t, -1, cookies[0].MaxAge)
+}
+
+func TestInFlightLimit(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	router := mux.NewRouter()
+	router.Use(limitInFlight(1))
+	router.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	})
+	router.HandleFunc("/export", func(w http.ResponseWriter, r *http.Request) {})
+	for _, path := range []string{"/healthz", "/readyz"} {
+		router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {})
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		get("/slow")
+	}()
+	<-entered
+
+	w := get("/export")
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		require.Equal(t, http.StatusOK, get(path).Code, path)
+	}
+
+	close(release)
+	<-done
+	require.Equal(t, http.StatusOK, get("/export").Code)
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	sessions := session.NewStore()
+	h := newTestHandler(t, HandlerOptions{
+		Sessions: sessions,
+	})
+
+	router := mux.NewRouter()
+	router.Use(limitRequestBody(64))
+	h.AddRoutes(router)
+
+	post := func(body string, contentLength int64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/cancel", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.ContentLength = contentLength
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	oversized := "s=abc&padding=" + strings.Repeat("x", 128)
+
+	t.Run("within limit", func(t *testing.T) {
+		sessions.Add("abc", "jane", time.Hour)
+		w := post("s=abc", 5)
+		require.Equal(t, http.StatusOK, w.Code)
+		_, found := sessions.Get("abc")
+		require.False(t, found)
+	})
+
+	t.Run("oversized content length", func(t *testing.T) {
+		w := post(oversized, int64(len(oversized)))
+		require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+
+	t.Run("oversized body without content length", func(t *testing.T) {
+		w := post(oversized, -1)
+		require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	})
+}
+
+func TestErrorHandlers(t *testing.T) {
+	h := newTestHandler(t, HandlerOptions{})
+
+	router := mux.NewRouter()
+	installErrorHandlers(router)
+	h.AddRoutes(router)
+
+	t.Run("unknown path as json", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/unknown", nil)
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set(requestIDHeader, "abc123")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusNotFound, w.Code)
+		require.Equal(t, contentTypeJSON, w.Header().Get("Content-Type"))
+		require.Equal(t, "abc123", w.Header().Get(requestIDHeader))
+		var resp ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Equal(t, http.StatusNotFound, resp.Code)
+		require.Equal(t, "abc123", resp.RequestID)
+	})
+
+	t.Run("unknown path as html", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+
+		require.Equal(t, http.StatusNotFound, w.Code)
+		require.Contains(t, w.Header().Get("Content-Type"), "text/html")
+		require.NotEmpty(t, w.Header().Get(requestIDHeader))
+		require.Contains(t, w.Body.String(), w.Header().Get(requestIDHeader))
+	})
+
+	t.Run("wrong method", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/cancel", nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		require.Equal(t, "GET, POST", w.Header().Get("Allow"))
+		var resp ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Equal(t, http.StatusMethodNotAllowed, resp.Code)
+		require.NotEmpty(t, resp.RequestID)
+	})
+}
+
+func TestHandleCallbackIdPError(t *testing.T) {
+	h := newTestHandler(t, HandlerOptions{})
+
+	const target = "/callback?error=access_denied&error_description=%3Cb%3EAADSTS65004%3C%2Fb%3E+User+declined"
+
+	t.Run("browser", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept", "text/html,application/xhtml+xml")
+		w := httptest.NewRecorder()
+		h.handleCallback(w, req)
+
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Contains(t, w.Header().Get("Content-Type"), "text/html")
+		require.Contains(t, w.Body.String(), "The sign-in was cancelled or access was denied.")
+		require.Contains(t, w.Body.String(), w.Header().Get(requestIDHeader))
+		require.NotContains(t, w.Body.String(), "AADSTS65004", "provider text must not be shown")
+	})
+
+	t.Run("api", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+		h.handleCallback(w, req)
+
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		var resp ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		require.Equal(t, "access_denied: <b>AADSTS65004</b> User declined", resp.Detail)
+		require.NotEmpty(t, resp.RequestID)
+	})
+}
+
+func TestHandleMetadata(t *testing.T) {
+	h := newTestHandler(t, HandlerOptions{
+		ProviderPrettyName: "MangoDB Inc.",
+		ProviderLogoURL:    "https://mangodb.com/logo.svg",
+		ProviderThemeColor: "#326ce5",
+	})
+
+	w := httptest.NewRecorder()
+	h.handleMetadata(w, httptest.NewRequest(http.MethodGet, "/metadata", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, contentTypeJSON, w.Header().Get("Content-Type"))
+
+	var metadata resources.ProviderMetadata
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &metadata))
+	require.Equal(t, resources.ProviderMetadata{
+		ProviderPrettyName: "MangoDB Inc.",
+		LogoURL:            "https://mangodb.com/logo.svg",
+		ThemeColor:         "#326ce5",
+	}, metadata)
+}
+
+func TestHandleOIDCRequirements(t *testing.T) {
+	tests := []struct {
+		name      string
+		stateless bool
+		want      resources.OIDCRequirements
+	}{
+		{name: "default", want: resources.OIDCRequirements{
+			RedirectURIs:   []string{"https://backend.example.com/callback"},
+			Scopes:         []string{"openid", "profile", "email", "offline_access"},
+			OptionalScopes: []string{"groups"},
+			ResponseTypes:  []string{"code"},
+			GrantTypes:     []string{"authorization_code", "refresh_token"},
+		}},
+		{name: "stateless", stateless: true, want: resources.OIDCRequirements{
+			RedirectURIs:   []string{"https://backend.example.com/callback"},
+			Scopes:         []string{"openid", "profile", "email"},
+			OptionalScopes: []string{"groups"},
+			ResponseTypes:  []string{"code"},
+			GrantTypes:     []string{"authorization_code"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, HandlerOptions{
+				BackendCallbackURL: "https://backend.example.com/callback",
+				Stateless:          tt.stateless,
+				AllowedScopes:      []string{"groups"},
+			})
+			router := mux.NewRouter()
+			h.AddRoutes(router)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/oidc-requirements", nil))
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Equal(t, contentTypeJSON, w.Header().Get("Content-Type"))
+
+			var requirements resources.OIDCRequirements
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &requirements))
+			require.Equal(t, tt.want, requirements)
+		})
+	}
+}
+
+func TestValidateTargetNamespace(t *testing.T) {
+	pattern := regexp.MustCompile("^(?:team-.*)$")
+
+	tests := []struct {
+		name    string
+		ns      string
+		pattern *regexp.Regexp
+		allowed []string
+		wantErr bool
+	}{
+		{name: "derived namespace", ns: ""},
+		{name: "derived namespace without policy", ns: "", pattern: nil},
+		{name: "allowed", ns: "team-a", pattern: pattern},
+		{name: "not matching policy", ns: "kube-system", pattern: pattern, wantErr: true},
+		{name: "disallowed without policy", ns: "team-a", wantErr: true},
+		{name: "invalid name", ns: "team-A_1", pattern: pattern, wantErr: true},
+		{name: "allowed namespace", ns: "team-a", pattern: pattern, allowed: []string{"team-a", "team-b"}},
+		{name: "matching but not an allowed namespace", ns: "team-c", pattern: pattern, allowed: []string{"team-a", "team-b"}, wantErr: true},
+		{name: "derived namespace with allowed namespaces", ns: "", pattern: pattern, allowed: []string{"team-a"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTargetNamespace(tt.ns, tt.pattern, sets.NewString(tt.allowed...))
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestStateless(t *testing.T) {
+	for _, stateless := range []bool{false, true} {
+		t.Run(fmt.Sprintf("stateless=%v", stateless), func(t *testing.T) {
+			sessions := session.NewStore()
+			h := newTestHandler(t, HandlerOptions{
+				Stateless: stateless,
+				Sessions:  sessions,
+			})
+			h.oidc = &OIDCServiceProvider{provider: &oidc.Provider{}}
+
+			w := httptest.NewRecorder()
+			h.handleAuthorize(w, httptest.NewRequest(http.MethodGet, "/authorize?u=http://localhost:1234/callback&s=abc", nil))
+			require.Equal(t, http.StatusFound, w.Code)
+			location, err := url.Parse(w.Header().Get("Location"))
+			require.NoError(t, err)
+			scopes := strings.Fields(location.Query().Get("scope"))
+			require.Contains(t, scopes, "openid")
+			if stateless {
+				require.NotContains(t, scopes, "offline_access")
+			} else {
+				require.Contains(t, scopes, "offline_access")
+			}
+
+			sessions.Add("abc", "jane", time.Hour)
+			w = httptest.NewRecorder()
+			h.completeSession(w, httptest.NewRequest(http.MethodGet, "/bind?s=abc", nil), "kube-bind-abc", "abc")
+			_, found := sessions.Get("abc")
+			require.Equal(t, !stateless, found, "session kept after bind")
+			if stateless {
+				cookies := w.Result().Cookies()
+				require.Len(t, cookies, 1)
+				require.Equal(t, "kube-bind-abc", cookies[0].Name)
+				require.Equal(t, -1, cookies[0].MaxAge)
+			} else {
+				require.Empty(t, w.Result().Cookies())
+			}
+		})
+	}
+}
+
+func TestCallbackCheck(t *testing.T) {
+	var probes int32
+	reachable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			atomic.AddInt32(&probes, 1)
+		}
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer reachable.Close()
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+
+	var slowProbes int32
+	slowOnce := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&slowProbes, 1) == 1 {
+			time.Sleep(200 * time.Millisecond)
+		}
+	}))
+	defer slowOnce.Close()
+
+	newHandler := func(timeout time.Duration, retries int) *handler {
+		h := newTestHandler(t, HandlerOptions{
+			CallbackCheckTimeout: timeout,
+			CallbackCheckRetries: retries,
+			CallbackCheckHosts:   []string{"127.0.0.1"},
+			CRDLister:            newTestCRDLister(t, newTestCRD()),
+		})
+		// the test servers listen on loopback, which the real client refuses.
+		h.callbackCheckClient = http.DefaultClient
+		return h
+	}
+	ctx := context.Background()
+
+	t.Run("reachable", func(t *testing.T) {
+		require.NoError(t, newHandler(time.Second, 0).checkCallbackReachable(ctx, reachable.URL+"/callback"))
+		require.Equal(t, int32(1), atomic.LoadInt32(&probes))
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		require.Error(t, newHandler(time.Second, 0).checkCallbackReachable(ctx, unreachable.URL+"/callback"))
+	})
+
+	t.Run("retried", func(t *testing.T) {
+		require.NoError(t, newHandler(50*time.Millisecond, 1).checkCallbackReachable(ctx, slowOnce.URL+"/callback"))
+		require.Equal(t, int32(2), atomic.LoadInt32(&slowProbes))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		require.NoError(t, newHandler(0, 0).checkCallbackReachable(ctx, unreachable.URL+"/callback"))
+	})
+
+	t.Run("other hosts are not probed", func(t *testing.T) {
+		h := newHandler(time.Second, 0)
+		h.callbackCheckHosts = nil
+		require.NoError(t, h.checkCallbackReachable(ctx, unreachable.URL+"/callback"))
+	})
+
+	t.Run("loopback addresses are refused", func(t *testing.T) {
+		var hits int32
+		internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+		}))
+		defer internal.Close()
+
+		h := newHandler(time.Second, 0)
+		h.callbackCheckClient = newCallbackCheckClient()
+		require.ErrorContains(t, h.checkCallbackReachable(ctx, internal.URL+"/callback"), "refusing to connect")
+		require.Zero(t, atomic.LoadInt32(&hits))
+	})
+
+	t.Run("bind fails friendly", func(t *testing.T) {
+		h := newHandler(time.Second, 0)
+		h.sessions.Add("abc", "jane", time.Hour)
+		state := cookie.SessionState{
+			IDToken:     `{"iss":"https://issuer","sub":"jane"}`,
+			RedirectURL: unreachable.URL + "/callback",
+			SessionID:   "abc",
+		}
+		b, err := state.Encode()
+		require.NoError(t, err)
+
+		r := httptest.NewRequest(http.MethodGet, "/bind?s=abc&group=mangodb.com&resource=mangodbs", nil)
+		r.Header.Set("Accept", "application/json")
+		r.AddCookie(cookie.MakeCookie(r, "kube-bind-abc", b, time.Hour))
+		w := httptest.NewRecorder()
+		h.handleBind(w, r)
+		require.Equal(t, http.StatusBadGateway, w.Code)
+		require.Empty(t, w.Header().Get("Location"))
+		_, found := h.sessions.Get("abc")
+		require.True(t, found, "session must survive a failed bind")
+	})
+}
+
+func TestIsProbeableIP(t *testing.T) {
+	for _, ip := range []string{"127.0.0.1", "::1", "169.254.169.254", "fe80::1", "0.0.0.0", "::", "224.0.0.1", "ff02::1"} {
+		require.False(t, isProbeableIP(net.ParseIP(ip)), ip)
+	}
+	// allowed hosts may well be internal ones.
+	for _, ip := range []string{"8.8.8.8", "2001:4860:4860::8888", "10.0.0.1", "172.16.0.1", "192.168.1.1", "fd00::1", "100.64.0.1"} {
+		require.True(t, isProbeableIP(net.ParseIP(ip)), ip)
+	}
+}
+
+func TestBindDownload(t *testing.T) {
+	t.Run("invalid format", func(t *testing.T) {
+		h := newTestHandler(t, HandlerOptions{
+			CRDLister: newTestCRDLister(t, newTestCRD()),
+		})
+
+		w := httptest.NewRecorder()
+		h.handleBind(w, httptest.NewRequest(http.MethodGet, "/bind?s=abc&group=mangodb.com&resource=mangodbs&format=json", nil))
+		require.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("requires session", func(t *testing.T) {
+		h := newTestHandler(t, HandlerOptions{
+			CRDLister: newTestCRDLister(t, newTestCRD()),
+		})
+
+		w := httptest.NewRecorder()
+		h.handleBind(w, httptest.NewRequest(http.MethodGet, "/bind?s=abc&group=mangodb.com&resource=mangodbs&format=download", nil))
+		require.NotEqual(t, http.StatusOK, w.Code)
+		require.Empty(t, w.Header().Get("Content-Disposition"))
+	})
+
+	t.Run("bind", func(t *testing.T) {
+		// the consumer callback must neither be probed nor redirected to.
+		var hits int32
+		callback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&hits, 1)
+		}))
+		defer callback.Close()
+
+		manager, _ := newTestManager(t)
+		h := newTestHandler(t, HandlerOptions{
+			CallbackCheckTimeout: time.Second,
+			CallbackCheckHosts:   []string{"127.0.0.1"},
+			Stateless:            true,
+			CRDLister:            newTestCRDLister(t, newTestCRD()),
+			Manager:              manager,
+		})
+		h.callbackCheckClient = http.DefaultClient
+		h.sessions.Add("abc", "jane", time.Hour)
+		b, err := (&cookie.SessionState{
+			IDToken:     `{"iss":"https://issuer","sub":"jane"}`,
+			RedirectURL: callback.URL + "/callback",
+			SessionID:   "abc",
+		}).Encode()
+		require.NoError(t, err)
+
+		r := httptest.NewRequest(http.MethodGet, "/bind?s=abc&group=mangodb.com&resource=mangodbs&format=download", nil)
+		r.AddCookie(cookie.MakeCookie(r, "kube-bind-abc", b, time.Hour))
+		w := httptest.NewRecorder()
+		h.handleBind(w, r)
+
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.Equal(t, `attachment; filename="kubeconfig.yaml"`, w.Header().Get("Content-Disposition"))
+		require.Equal(t, contentTypeYAML, w.Header().Get("Content-Type"))
+		require.Empty(t, w.Header().Get("Location"))
+		require.NotContains(t, w.Body.String(), callback.URL)
+		require.Equal(t, "token-1", kubeconfigToken(t, w.Body.Bytes()))
+		require.Zero(t, atomic.LoadInt32(&hits))
+
+		// stateless sessions end with the download.
+		_, found := h.sessions.Get("abc")
+		require.False(t, found)
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		require.Equal(t, -1, cookies[0].MaxAge)
+	})
+}
+
+func TestClaimLabels(t *testing.T) {
+	_, err := newClaimLabeler([]string{"groups=Not A Key"})
+	require.Error(t, err)
+
+	labeler, err := newClaimLabeler([]string{"groups=example.com/groups", "department=example.com/department", "missing=example.com/missing"})
+	require.NoError(t, err)
+
+	labels := labeler.Labels(map[string]interface{}{
+		"groups":     []interface{}{"admins", "db ops", "---"},
+		"department": "R&D Europe",
+	})
+	require.Equal(t, map[string]string{
+		"example.com/groups":     "admins.db-ops",
+		"example.com/department": "R-D-Europe",
+	}, labels)
+
+	labels = labeler.Labels(map[string]interface{}{
+		"department": strings.Repeat("a", 70) + "!",
+		"groups":     []interface{}{},
+	})
+	require.Equal(t, map[string]string{"example.com/department": strings.Repeat("a", 63)}, labels)
+}
+
+func TestAuthResponseClaim(t *testing.T) {
+	h := newTestHandler(t, HandlerOptions{
+		BackendCallbackURL:         "https://backend.example.com/callback",
+		MaxInlineAuthResponseBytes: 64,
+	})
+
+	small := []byte(`{"kind":"BindingResponse"}`)
+	redirectURL, err := h.authResponseRedirectURL("http://127.0.0.1:8080/callback?p=1", small)
+	require.NoError(t, err)
+	u, err := url.Parse(redirectURL)
+	require.NoError(t, err)
+	require.NotEmpty(t, u.Query().Get("auth_response"))
+	require.Empty(t, u.Query().Get("claim"))
+	require.Equal(t, "1", u.Query().Get("p"))
+
+	large := []byte(`{"kind":"BindingResponse","kubeconfig":"` + strings.Repeat("a", 100) + `"}`)
+	redirectURL, err = h.authResponseRedirectURL("http://127.0.0.1:8080/callback", large)
+	require.NoError(t, err)
+	u, err = url.Parse(redirectURL)
+	require.NoError(t, err)
+	require.Empty(t, u.Query().Get("auth_response"))
+	require.Equal(t, "https://backend.example.com/claim", u.Query().Get("claim_url"))
+	token := u.Query().Get("claim")
+	require.NotEmpty(t, token)
+
+	claim := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/claim", strings.NewReader(url.Values{"token": {token}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.handleClaim(w, req)
+		return w
+	}
+
+	w := claim(token)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, large, w.Body.Bytes())
+
+	require.Equal(t, http.StatusNotFound, claim(token).Code, "claim tokens must be single use")
+	require.Equal(t, http.StatusBadRequest, claim("").Code)
+}
+
+func TestAuthResponseSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	h := newTestHandler(t, HandlerOptions{
+		BackendCallbackURL:         "https://backend.example.com/callback",
+		MaxInlineAuthResponseBytes: 64,
+		SigningKey:                 priv,
+	})
+
+	signature := func(redirectURL string) []byte {
+		u, err := url.Parse(redirectURL)
+		require.NoError(t, err)
+		sig, err := base64.StdEncoding.DecodeString(u.Query().Get("auth_response_signature"))
+		require.NoError(t, err)
+		return sig
+	}
+
+	small := []byte(`{"kind":"BindingResponse"}`)
+	redirectURL, err := h.authResponseRedirectURL("http://127.0.0.1:8080/callback", small)
+	require.NoError(t, err)
+	require.True(t, ed25519.Verify(pub, small, signature(redirectURL)))
+	require.False(t, ed25519.Verify(pub, []byte(`{"kind":"Tampered"}`), signature(redirectURL)))
+
+	large := []byte(`{"kind":"BindingResponse","kubeconfig":"` + strings.Repeat("a", 100) + `"}`)
+	redirectURL, err = h.authResponseRedirectURL("http://127.0.0.1:8080/callback", large)
+	require.NoError(t, err)
+	require.True(t, ed25519.Verify(pub, large, signature(redirectURL)), "claimed responses must be signed too")
+
+	w := httptest.NewRecorder()
+	h.handleServiceExport(w, httptest.NewRequest(http.MethodGet, "/export", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var provider struct {
+		Spec struct {
+			AuthResponsePublicKey string `json:"authResponsePublicKey"`
+		} `json:"spec"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &provider))
+	der, err := base64.StdEncoding.DecodeString(provider.Spec.AuthResponsePublicKey)
+	require.NoError(t, err)
+	advertised, err := x509.ParsePKIXPublicKey(der)
+	require.NoError(t, err)
+	require.Equal(t, pub, advertised)
+}
+
+func TestAuthResponseKeys(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	retired, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	h := newTestHandler(t, HandlerOptions{
+		BackendCallbackURL: "https://backend.example.com/callback",
+		SigningKey:         priv,
+		VerificationKeys:   []ed25519.PublicKey{retired, pub},
+	})
+
+	w := httptest.NewRecorder()
+	h.handleServiceExport(w, httptest.NewRequest(http.MethodGet, "/export", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var provider v1alpha1.APIServiceProvider
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &provider))
+	require.Equal(t, []v1alpha1.AuthResponseKey{
+		kubebindhelpers.Ed25519ToAuthResponseKey(pub),
+		kubebindhelpers.Ed25519ToAuthResponseKey(retired),
+	}, provider.Spec.AuthResponseKeys, "the signing key must come first and only once")
+
+	keys := map[string]ed25519.PublicKey{}
+	for _, key := range provider.Spec.AuthResponseKeys {
+		advertised, err := kubebindhelpers.AuthResponseKeyToEd25519(key)
+		require.NoError(t, err)
+		keys[key.KeyID] = advertised
+	}
+
+	payload := []byte(`{"kind":"BindingResponse"}`)
+	redirectURL, err := h.authResponseRedirectURL("http://127.0.0.1:8080/callback", payload)
+	require.NoError(t, err)
+	u, err := url.Parse(redirectURL)
+	require.NoError(t, err)
+	key, found := keys[u.Query().Get("auth_response_key_id")]
+	require.True(t, found, "the response must be signed with an advertised key")
+	sig, err := base64.StdEncoding.DecodeString(u.Query().Get("auth_response_signature"))
+	require.NoError(t, err)
+	require.True(t, ed25519.Verify(key, payload, sig))
+
+	_, err = NewHandler(HandlerOptions{
+		Identity:         newTestIdentityTemplate(t, "{{.iss}}/{{.sub}}"),
+		AuthCodeStorage:  StateAuthCodeStorage,
+		VerificationKeys: []ed25519.PublicKey{retired},
+	})
+	require.ErrorContains(t, err, "verification keys require a signing key")
+}
+
+func TestHandleClaim(t *testing.T) {
+	claims := session.NewClaimStore()
+	h := newTestHandler(t, HandlerOptions{
+		BackendCallbackURL:         "https://backend.example.com/callback",
+		MaxInlineAuthResponseBytes: 64,
+		Claims:                     claims,
+	})
+	router := mux.NewRouter()
+	h.AddRoutes(router)
+
+	claim := func(method, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/claim", strings.NewReader(url.Values{"token": {token}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	payload := []byte(`{"apiVersion":"kube-bind.io/v1alpha1","kind":"BindingResponse"}`)
+	token, err := claims.Put(payload, time.Minute)
+	require.NoError(t, err)
+
+	require.Equal(t, http.StatusMethodNotAllowed, claim(http.MethodGet, token).Code, "tokens must not end up in URLs")
+
+	w := claim(http.MethodPost, token)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, contentTypeJSON, w.Header().Get("Content-Type"))
+	require.Equal(t, payload, w.Body.Bytes())
+
+	require.Equal(t, http.StatusNotFound, claim(http.MethodPost, token).Code, "reuse must be rejected")
+
+	expired, err := claims.Put(payload, 0)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, claim(http.MethodPost, expired).Code, "expired claims must be rejected")
+}
+
+func TestSessionCookieTTL(t *testing.T) {
+	var issuer string
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":%q,"token_endpoint":%q,"jwks_uri":%q}`, issuer, issuer+"/auth", issuer+"/token", issuer+"/keys")
+		case "/token":
+			payload := base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"` + issuer + `","sub":"jane"}`))
+			fmt.Fprintf(w, `{"access_token":"access","token_type":"Bearer","expires_in":3600,"id_token":"header.%s.signature"}`, payload)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer idp.Close()
+	issuer = idp.URL
+
+	provider, err := NewOIDCServiceProvider("client", "secret", "http://127.0.0.1:8080/callback", issuer, 3, time.Minute, 0)
+	require.NoError(t, err)
+	sessions := session.NewStore()
+	h := newTestHandler(t, HandlerOptions{
+		Provider:   provider,
+		SessionTTL: 3 * time.Hour,
+		Sessions:   sessions,
+	})
+
+	state, err := h.authCodes.Encode(&resources.AuthCode{RedirectURL: "http://localhost:1234/callback", SessionID: "abc"})
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	start := time.Now()
+	h.handleCallback(w, httptest.NewRequest(http.MethodGet, "/callback?code=xyz&state="+url.QueryEscape(state), nil))
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	require.Equal(t, "kube-bind-abc", cookies[0].Name)
+	require.WithinDuration(t, start.Add(3*time.Hour), cookies[0].Expires, time.Minute)
+
+	s, found := sessions.Get("abc")
+	require.True(t, found)
+	require.Equal(t, issuer+"/jane", s.Identity, "sessions are recorded with the identity, not the sub claim")
+	require.WithinDuration(t, start.Add(3*time.Hour), s.ExpiresAt, time.Minute)
+}
+
+func TestServerSessionIDs(t *testing.T) {
+	var issuer string
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":%q,"token_endpoint":%q,"jwks_uri":%q}`, issuer, issuer+"/auth", issuer+"/token", issuer+"/keys")
+		case "/token":
+			payload := base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"` + issuer + `","sub":"jane"}`))
+			fmt.Fprintf(w, `{"access_token":"access","token_type":"Bearer","expires_in":3600,"id_token":"header.%s.signature"}`, payload)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer idp.Close()
+	issuer = idp.URL
+
+	provider, err := NewOIDCServiceProvider("client", "secret", "http://127.0.0.1:8080/callback", issuer, 3, time.Minute, 0)
+	require.NoError(t, err)
+	sessions := session.NewStore()
+	h := newTestHandler(t, HandlerOptions{
+		Provider:         provider,
+		AuthCodeStorage:  ServerAuthCodeStorage,
+		ServerSessionIDs: true,
+		Sessions:         sessions,
+	})
+
+	w := httptest.NewRecorder()
+	h.handleAuthorize(w, httptest.NewRequest(http.MethodGet, "/authorize?u=http://localhost:1234/callback&s=abc", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	h.handleCallback(w, httptest.NewRequest(http.MethodGet, "/callback?code=xyz&state="+url.QueryEscape(location.Query().Get("state")), nil))
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+
+	// the cookie is named after the generated session id, not the one of the consumer.
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	id := strings.TrimPrefix(cookies[0].Name, "kube-bind-")
+	require.NotEqual(t, "abc", id)
+	require.Len(t, id, 43)
+	require.Equal(t, "/resources?s="+id, w.Header().Get("Location"))
+
+	state, err := cookie.Decode(cookies[0].Value, nil)
+	require.NoError(t, err)
+	require.Equal(t, id, state.SessionID)
+	require.Equal(t, "abc", state.ClientSessionID, "the consumer session id is kept for the auth response")
+
+	_, found := sessions.Get(id)
+	require.True(t, found)
+	_, found = sessions.Get("abc")
+	require.False(t, found)
+
+	// every authorization gets a fresh id.
+	w = httptest.NewRecorder()
+	h.handleAuthorize(w, httptest.NewRequest(http.MethodGet, "/authorize?u=http://localhost:1234/callback&s=abc", nil))
+	again, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	code, err := h.authCodes.Decode(again.Query().Get("state"))
+	require.NoError(t, err)
+	require.NotEqual(t, id, code.SessionID)
+	require.Equal(t, "abc", code.ClientSessionID)
+}
+
+// newTestIdP returns the issuer URL of an identity provider issuing unsigned ID
+// tokens for the subject jane.
+func newTestIdP(t *testing.T) string {
+	return newTestIdPWithAccessToken(t, "access")
+}
+
+// newTestIdPWithAccessToken is newTestIdP issuing the given access token.
+func newTestIdPWithAccessToken(t *testing.T, accessToken string) string {
+	var issuer string
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":%q,"token_endpoint":%q,"jwks_uri":%q}`, issuer, issuer+"/auth", issuer+"/token", issuer+"/keys")
+		case "/token":
+			payload := base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"` + issuer + `","sub":"jane"}`))
+			fmt.Fprintf(w, `{"access_token":%q,"token_type":"Bearer","expires_in":3600,"id_token":"header.%s.signature"}`, accessToken, payload)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(idp.Close)
+	issuer = idp.URL
+	return issuer
+}
+
+func TestEncryptedSessionCookie(t *testing.T) {
+	issuer := newTestIdP(t)
+
+	oldKey := bytes.Repeat([]byte("o"), cookie.MinKeyLength)
+	newKey := bytes.Repeat([]byte("n"), cookie.MinKeyLength)
+	newKeySet := func(keys ...[]byte) *cookie.KeySet {
+		keySet, err := cookie.NewKeySet(keys...)
+		require.NoError(t, err)
+		return keySet
+	}
+
+	provider, err := NewOIDCServiceProvider("client", "secret", "http://127.0.0.1:8080/callback", issuer, 3, time.Minute, 0)
+	require.NoError(t, err)
+	h := newTestHandler(t, HandlerOptions{
+		Provider:   provider,
+		CookieKeys: newKeySet(oldKey),
+	})
+
+	w := httptest.NewRecorder()
+	h.handleAuthorize(w, httptest.NewRequest(http.MethodGet, "/authorize?u=http://localhost:1234/callback&s=abc", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	h.handleCallback(w, httptest.NewRequest(http.MethodGet, "/callback?code=xyz&state="+url.QueryEscape(location.Query().Get("state")), nil))
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	newRequest := func(ck *http.Cookie) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/resources?s=abc", nil)
+		r.AddCookie(ck)
+		return r
+	}
+
+	// the cookie signed with the old key stays valid while rotating to the new key.
+	h.cookieKeys = newKeySet(newKey, oldKey).Derive(sessionCookieKeyPurpose)
+	claims, err := h.sessionClaims(newRequest(cookies[0]))
+	require.NoError(t, err)
+	require.Equal(t, "jane", claims["sub"])
+
+	h.cookieKeys = newKeySet(newKey).Derive(sessionCookieKeyPurpose)
+	_, err = h.sessionClaims(newRequest(cookies[0]))
+	require.Error(t, err, "cookies encrypted with a removed key must be rejected")
+
+	forged, err := (&cookie.SessionState{SessionID: "abc", IDToken: `{"sub":"admin"}`}).Encode()
+	require.NoError(t, err)
+	_, err = h.sessionClaims(newRequest(cookie.MakeCookie(nil, cookies[0].Name, forged, time.Hour)))
+	require.Error(t, err, "unencrypted cookies must be rejected")
+
+	// the cookie is encrypted, hence does not reveal the tokens.
+	raw, err := base64.RawURLEncoding.DecodeString(cookies[0].Value)
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), "jane")
+
+	// keys are separated by purpose, hence a signed state is no valid cookie.
+	h.cookieKeys = newKeySet(oldKey).Derive(sessionCookieKeyPurpose)
+	state, err := (&cookie.SessionState{SessionID: "abc", IDToken: `{"sub":"admin"}`}).Encode()
+	require.NoError(t, err)
+	for _, keys := range []*cookie.KeySet{newKeySet(oldKey), newKeySet(oldKey).Derive(stateKeyPurpose)} {
+		sealed, err := keys.Seal(state)
+		require.NoError(t, err)
+		_, err = h.sessionClaims(newRequest(cookie.MakeCookie(nil, cookies[0].Name, sealed, time.Hour)))
+		require.Error(t, err, "cookies encrypted with the keys of another purpose must be rejected")
+	}
+}
+
+func TestCookieNamePrefix(t *testing.T) {
+	provider, err := NewOIDCServiceProvider("client", "secret", "http://127.0.0.1:8080/callback", newTestIdP(t), 3, time.Minute, 0)
+	require.NoError(t, err)
+	h := newTestHandler(t, HandlerOptions{
+		Provider:         provider,
+		CookieNamePrefix: "backend-a-",
+	})
+
+	w := httptest.NewRecorder()
+	h.handleAuthorize(w, httptest.NewRequest(http.MethodGet, "/authorize?u=http://localhost:1234/callback&s=abc", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	h.handleCallback(w, httptest.NewRequest(http.MethodGet, "/callback?code=xyz&state="+url.QueryEscape(location.Query().Get("state")), nil))
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	require.Equal(t, "backend-a-abc", cookies[0].Name)
+
+	r := httptest.NewRequest(http.MethodGet, "/resources?s=abc", nil)
+	r.AddCookie(cookies[0])
+	claims, err := h.sessionClaims(r)
+	require.NoError(t, err)
+	require.Equal(t, "jane", claims["sub"])
+
+	// cookies of other backends on the same domain are not read.
+	other := *cookies[0]
+	other.Name = cookie.DefaultNamePrefix + "abc"
+	r = httptest.NewRequest(http.MethodGet, "/resources?s=abc", nil)
+	r.AddCookie(&other)
+	_, err = h.sessionClaims(r)
+	require.ErrorIs(t, err, http.ErrNoCookie)
+
+	// a valid session is reused with the prefixed cookie.
+	r = httptest.NewRequest(http.MethodGet, "/authorize?u=http://localhost:1234/callback&s=abc", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	h.handleAuthorize(w, r)
+	require.Equal(t, "/resources?s=abc", w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	h.handleCancel(w, httptest.NewRequest(http.MethodPost, "/cancel?s=abc", nil))
+	cleared := w.Result().Cookies()
+	require.Len(t, cleared, 1)
+	require.Equal(t, "backend-a-abc", cleared[0].Name)
+	require.Equal(t, -1, cleared[0].MaxAge)
+}
+
+func TestHandleCallbackMissingIDToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		token    string
+		wantBody string
+	}{
+		{name: "missing", token: `{"access_token":"access","token_type":"Bearer","expires_in":3600}`, wantBody: `make sure it supports the "openid" scope`},
+		{name: "not a string", token: `{"access_token":"access","token_type":"Bearer","expires_in":3600,"id_token":42}`, wantBody: "invalid id_token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var issuer string
+			idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.Path {
+				case "/.well-known/openid-configuration":
+					fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":%q,"token_endpoint":%q,"jwks_uri":%q}`, issuer, issuer+"/auth", issuer+"/token", issuer+"/keys")
+				case "/token":
+					fmt.Fprint(w, tt.token)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			defer idp.Close()
+			issuer = idp.URL
+
+			provider, err := NewOIDCServiceProvider("client", "secret", "http://127.0.0.1:8080/callback", issuer, 3, time.Minute, 0)
+			require.NoError(t, err)
+			h := newTestHandler(t, HandlerOptions{
+				Provider: provider,
+			})
+
+			state, err := h.authCodes.Encode(&resources.AuthCode{RedirectURL: "http://localhost:1234/callback", SessionID: "abc"})
+			require.NoError(t, err)
+			w := httptest.NewRecorder()
+			h.handleCallback(w, httptest.NewRequest(http.MethodGet, "/callback?code=xyz&state="+url.QueryEscape(state), nil))
+			require.Equal(t, http.StatusBadGateway, w.Code)
+			require.Contains(t, w.Body.String(), tt.wantBody)
+			require.Empty(t, w.Result().Cookies())
+		})
+	}
+}
+
+func TestAuthorizeReuseSession(t *testing.T) {
+	sessions := session.NewStore()
+	h := newTestHandler(t, HandlerOptions{
+		AllowedScopes: []string{"groups"},
+		Sessions:      sessions,
+	})
+	h.oidc = &OIDCServiceProvider{provider: &oidc.Provider{}}
+	sessions.Add("abc", "jane", time.Hour)
+
+	sessionCookie := func(sessionID, redirectURL string, createdAt time.Time) *http.Cookie {
+		b, err := (&cookie.SessionState{CreatedAt: createdAt, SessionID: sessionID, RedirectURL: redirectURL}).Encode()
+		require.NoError(t, err)
+		return cookie.MakeCookie(nil, "kube-bind-abc", b, time.Hour)
+	}
+	callback := "http://localhost:1234/callback"
+
+	tests := []struct {
+		name     string
+		query    string
+		cookie   *http.Cookie
+		wantSkip bool
+	}{
+		{name: "valid session", cookie: sessionCookie("abc", callback, time.Now()), wantSkip: true},
+		{name: "silent", query: "&prompt=none", cookie: sessionCookie("abc", callback, time.Now()), wantSkip: true},
+		{name: "within max_age", query: "&max_age=600", cookie: sessionCookie("abc", callback, time.Now()), wantSkip: true},
+		{name: "no cookie"},
+		{name: "forced login", query: "&prompt=login", cookie: sessionCookie("abc", callback, time.Now())},
+		{name: "forced consent", query: "&prompt=consent", cookie: sessionCookie("abc", callback, time.Now())},
+		{name: "exceeded max_age", query: "&max_age=60", cookie: sessionCookie("abc", callback, time.Now().Add(-time.Hour))},
+		{name: "additional scopes", query: "&scope=groups", cookie: sessionCookie("abc", callback, time.Now())},
+		{name: "other callback", cookie: sessionCookie("abc", "http://localhost:4321/callback", time.Now())},
+		{name: "other session", cookie: sessionCookie("def", callback, time.Now())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/authorize?u="+callback+"&s=abc"+tt.query, nil)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			w := httptest.NewRecorder()
+			h.handleAuthorize(w, req)
+			require.Equal(t, http.StatusFound, w.Code)
+			if tt.wantSkip {
+				require.Equal(t, "/resources?s=abc", w.Header().Get("Location"))
+			} else {
+				require.NotEqual(t, "/resources?s=abc", w.Header().Get("Location"), "expected a new authorization")
+			}
+		})
+	}
+
+	// cancelled sessions are not reused.
+	sessions.Delete("abc")
+	req := httptest.NewRequest(http.MethodGet, "/authorize?u="+callback+"&s=abc", nil)
+	req.AddCookie(sessionCookie("abc", callback, time.Now()))
+	w := httptest.NewRecorder()
+	h.handleAuthorize(w, req)
+	require.NotEqual(t, "/resources?s=abc", w.Header().Get("Location"))
+}
+
+func TestBindTargetCRD(t *testing.T) {
+	synced := true
+	h := newTestHandler(t, HandlerOptions{
+		CRDLister: newTestCRDLister(t, newTestCRD()),
+		CRDSynced: func() bool { return synced },
+	})
+
+	crd, err := h.getCRD("mangodbs", "mangodb.com")
+	require.NoError(t, err)
+	require.Equal(t, "mangodbs.mangodb.com", crd.Name)
+	_, err = h.getCRD("configmaps", "")
+	require.ErrorContains(t, err, "only CustomResourceDefinitions can be bound")
+	_, err = h.getCRD("deployments", "apps")
+	require.ErrorContains(t, err, "only CustomResourceDefinitions can be bound")
+	_, err = h.getCRD("foos", "mangodb.com")
+	require.ErrorContains(t, err, "is not a CustomResourceDefinition")
+
+	w := httptest.NewRecorder()
+	h.handleBind(w, httptest.NewRequest(http.MethodGet, "/bind?s=abc&resource=configmaps", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "only CustomResourceDefinitions can be bound")
+
+	// unsynced CRDs must not be reported as missing.
+	synced = false
+	w = httptest.NewRecorder()
+	h.handleBind(w, httptest.NewRequest(http.MethodGet, "/bind?s=abc&group=mangodb.com&resource=mangodbs", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestEntitlement(t *testing.T) {
+	redis := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "caches.redis.io"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group:    "redis.io",
+			Names:    apiextensionsv1.CustomResourceDefinitionNames{Plural: "caches", Singular: "cache"},
+			Scope:    apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{Name: "v1", Served: true, Storage: true}},
+		},
+	}
+	// users are entitled to the groups named like their OIDC groups.
+	entitlement := func(crd *apiextensionsv1.CustomResourceDefinition, claims map[string]interface{}) bool {
+		groups, _ := claims["groups"].([]interface{})
+		for _, g := range groups {
+			if g == crd.Spec.Group {
+				return true
+			}
+		}
+		return false
+	}
+	sessions := session.NewStore()
+	h := newTestHandler(t, HandlerOptions{
+		Entitlement: entitlement,
+		CRDLister:   newTestCRDLister(t, newTestCRD(), redis),
+		Sessions:    sessions,
+	})
+
+	sessions.Add("abc", "jane", time.Hour)
+	b, err := (&cookie.SessionState{
+		IDToken:   `{"iss":"https://issuer","sub":"jane","groups":["mangodb.com"]}`,
+		SessionID: "abc",
+	}).Encode()
+	require.NoError(t, err)
+	request := func(target string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.AddCookie(cookie.MakeCookie(r, "kube-bind-abc", b, time.Hour))
+		return r
+	}
+
+	w := httptest.NewRecorder()
+	h.handleResources(w, request("/resources?s=abc"))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "mangodb.com")
+	require.NotContains(t, w.Body.String(), "redis.io")
+
+	w = httptest.NewRecorder()
+	h.handleBind(w, request("/bind?s=abc&group=redis.io&resource=caches"))
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Contains(t, w.Body.String(), "not entitled to bind caches.redis.io")
+
+	// without a session, nobody is entitled to anything.
+	w = httptest.NewRecorder()
+	h.handleResources(w, httptest.NewRequest(http.MethodGet, "/resources?s=abc", nil))
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestMaxBindingsPerSubject(t *testing.T) {
+	redis := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "caches.redis.io"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group:    "redis.io",
+			Names:    apiextensionsv1.CustomResourceDefinitionNames{Plural: "caches", Singular: "cache"},
+			Scope:    apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{Name: "v1", Served: true, Storage: true}},
+		},
+	}
+	sessions := session.NewStore()
+	h := newTestHandler(t, HandlerOptions{
+		MaxBindingsPerSubject: 1,
+		CRDLister:             newTestCRDLister(t, newTestCRD(), redis),
+		Sessions:              sessions,
+	})
+	var bound []string
+	h.bindings.bound = func(ctx context.Context, identity string) ([]string, error) {
+		require.Equal(t, "https://issuer/jane", identity)
+		return bound, nil
+	}
+
+	sessions.Add("abc", "jane", time.Hour)
+	b, err := (&cookie.SessionState{
+		IDToken:   `{"iss":"https://issuer","sub":"jane"}`,
+		SessionID: "abc",
+	}).Encode()
+	require.NoError(t, err)
+	request := func(target string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.AddCookie(cookie.MakeCookie(r, "kube-bind-abc", b, time.Hour))
+		return r
+	}
+
+	// a concurrent bind of the user is still in progress.
+	release, err := h.bindings.Reserve(context.Background(), "https://issuer/jane", "mangodbs.mangodb.com")
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	h.handleBind(w, request("/bind?s=abc&group=redis.io&resource=caches"))
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "5", w.Header().Get("Retry-After"))
+
+	// the bind finished.
+	bound = []string{"mangodbs.mangodb.com"}
+	release()
+	w = httptest.NewRecorder()
+	h.handleBind(w, request("/bind?s=abc&group=redis.io&resource=caches"))
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.Contains(t, w.Body.String(), "binding limit of 1 resources reached")
+}
+
+func TestBindAuthorizer(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowed    bool
+		reason     string
+		err        error
+		wantCode   int
+		wantReason string
+	}{
+		{name: "allowing", allowed: true, wantCode: http.StatusInternalServerError},
+		{name: "denying", reason: "outside of business hours", wantCode: http.StatusForbidden, wantReason: "not allowed to bind mangodbs.mangodb.com: outside of business hours"},
+		{name: "failing", err: fmt.Errorf("policy engine down"), wantCode: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *BindRequest
+			authorizer := AuthorizerFunc(func(ctx context.Context, req *BindRequest) (bool, string, error) {
+				got = req
+				return tt.allowed, tt.reason, tt.err
+			})
+			sessions := session.NewStore()
+			h := newTestHandler(t, HandlerOptions{
+				Authorizer:            authorizer,
+				MaxBindingsPerSubject: 1,
+				CRDLister:             newTestCRDLister(t, newTestCRD()),
+				Sessions:              sessions,
+			})
+			// stop allowed binds before provisioning.
+			bindingsCounted := false
+			h.bindings.bound = func(ctx context.Context, identity string) ([]string, error) {
+				bindingsCounted = true
+				return nil, fmt.Errorf("not provisioning in tests")
+			}
+
+			sessions.Add("abc", "jane", time.Hour)
+			b, err := (&cookie.SessionState{
+				IDToken:   `{"iss":"https://issuer","sub":"jane","groups":["dba"]}`,
+				SessionID: "abc",
+			}).Encode()
+			require.NoError(t, err)
+			r := httptest.NewRequest(http.MethodGet, "/bind?s=abc&group=mangodb.com&resource=mangodbs&version=v1", nil)
+			r.AddCookie(cookie.MakeCookie(r, "kube-bind-abc", b, time.Hour))
+			w := httptest.NewRecorder()
+			h.handleBind(w, r)
+
+			require.Equal(t, tt.wantCode, w.Code)
+			require.Contains(t, w.Body.String(), tt.wantReason)
+			require.Equal(t, tt.allowed, bindingsCounted, "only allowed binds must proceed")
+			require.NotNil(t, got)
+			require.Equal(t, "https://issuer/jane", got.Identity)
+			require.Equal(t, []interface{}{"dba"}, got.Claims["groups"])
+			require.Equal(t, "mangodbs.mangodb.com", got.CRD.Name)
+			require.Equal(t, "mangodb.com", got.Group)
+			require.Equal(t, "mangodbs", got.Resource)
+			require.Equal(t, "v1", got.Version)
+			require.False(t, got.Rotate)
+		})
+	}
+}
+
+func TestResourcesETag(t *testing.T) {
+	crd := newTestCRD()
+	crd.ResourceVersion = "1"
+	h := newTestHandler(t, HandlerOptions{
+		ResourcesETag: true,
+		CRDLister:     newTestCRDLister(t, crd),
+	})
+	request := func(s, ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/resources?s="+s, nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		h.handleResources(w, r)
+		return w
+	}
+
+	w := request("abc", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "mangodbs")
+	require.Equal(t, "private, no-cache", w.Header().Get("Cache-Control"))
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	w = request("abc", etag)
+	require.Equal(t, http.StatusNotModified, w.Code)
+	require.Empty(t, w.Body.String())
+	require.Equal(t, etag, w.Header().Get("ETag"))
+
+	w = request("abc", `"other", W/`+etag)
+	require.Equal(t, http.StatusNotModified, w.Code, "weak comparison within a list must match")
+
+	// the page links the session, hence other sessions get another ETag.
+	w = request("def", etag)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// a changed CRD invalidates the ETag.
+	crd.ResourceVersion = "2"
+	w = request("abc", etag)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotEqual(t, etag, w.Header().Get("ETag"))
+}
+
+func TestUserInfoClaims(t *testing.T) {
+	var issuer string
+	userInfo := `{"sub":"jane","email":"jane@example.com","groups":["mangodb.com"]}`
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			fmt.Fprintf(w, `{"issuer":%q,"authorization_endpoint":%q,"token_endpoint":%q,"jwks_uri":%q,"userinfo_endpoint":%q}`, issuer, issuer+"/auth", issuer+"/token", issuer+"/keys", issuer+"/userinfo")
+		case "/userinfo":
+			if r.Header.Get("Authorization") != "Bearer access" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, userInfo)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer idp.Close()
+	issuer = idp.URL
+
+	provider, err := NewOIDCServiceProvider("client", "secret", "http://127.0.0.1:8080/callback", issuer, 3, time.Minute, 5*time.Second)
+	require.NoError(t, err)
+	// users are entitled to the groups named like their OIDC groups.
+	entitlement := func(crd *apiextensionsv1.CustomResourceDefinition, claims map[string]interface{}) bool {
+		groups, _ := claims["groups"].([]interface{})
+		for _, g := range groups {
+			if g == crd.Spec.Group {
+				return true
+			}
+		}
+		return false
+	}
+	sessions := session.NewStore()
+	h := newTestHandler(t, HandlerOptions{
+		Provider:              provider,
+		Identity:              newTestIdentityTemplate(t, "{{.email}}"),
+		Entitlement:           entitlement,
+		MaxBindingsPerSubject: 1,
+		CRDLister:             newTestCRDLister(t, newTestCRD()),
+		Sessions:              sessions,
+	})
+	// stops the bind before provisioning, recording the identity.
+	var identity string
+	h.bindings.bound = func(ctx context.Context, id string) ([]string, error) {
+		identity = id
+		return nil, fmt.Errorf("stop")
+	}
+
+	sessions.Add("abc", "jane", time.Hour)
+	request := func(target, accessToken string) *http.Request {
+		// a thin ID token without email and groups.
+		b, err := (&cookie.SessionState{
+			IDToken:     `{"iss":"https://issuer","sub":"jane"}`,
+			AccessToken: accessToken,
+			SessionID:   "abc",
+		}).Encode()
+		require.NoError(t, err)
+		r := httptest.NewRequest(http.MethodGet, target, nil)
+		r.AddCookie(cookie.MakeCookie(r, "kube-bind-abc", b, time.Hour))
+		return r
+	}
+
+	w := httptest.NewRecorder()
+	h.handleResources(w, request("/resources?s=abc", "access"))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "mangodbs", "the groups of the userinfo endpoint must entitle")
+
+	w = httptest.NewRecorder()
+	h.handleBind(w, request("/bind?s=abc&group=mangodb.com&resource=mangodbs", "access"))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Equal(t, "jane@example.com", identity, "the email of the userinfo endpoint must make the identity")
+
+	w = httptest.NewRecorder()
+	h.handleBind(w, request("/bind?s=abc&group=mangodb.com&resource=mangodbs", "expired"))
+	require.Equal(t, http.StatusBadGateway, w.Code)
+
+	userInfo = `{"sub":"joe","groups":["mangodb.com"]}`
+	w = httptest.NewRecorder()
+	h.handleBind(w, request("/bind?s=abc&group=mangodb.com&resource=mangodbs", "access"))
+	require.Equal(t, http.StatusBadGateway, w.Code, "userinfo of another subject must be rejected")
+}
+
+func TestBindGroupResourceCasing(t *testing.T) {
+	h := newTestHandler(t, HandlerOptions{
+		CRDLister: newTestCRDLister(t, newTestCRD()),
+	})
+
+	tests := []struct {
+		name     string
+		query    string
+		wantBody string
+	}{
+		// the unknown version is only detected after the CRD has been found.
+		{name: "mixed-case group", query: "group=MangoDB.com&resource=mangodbs&version=v2", wantBody: `version "v2" of mangodbs.mangodb.com is not served`},
+		{name: "mixed-case resource", query: "group=mangodb.com&resource=MangoDBs", wantBody: `invalid resource "MangoDBs": must be the lowercase plural name of the resource, e.g. "mangodbs"`},
+		{name: "invalid group", query: "group=mangodb_com&resource=mangodbs", wantBody: `invalid group "mangodb_com"`},
+		{name: "invalid resource", query: "group=mangodb.com&resource=mango.dbs", wantBody: `invalid resource "mango.dbs"`},
+		// the core group is valid, but not backed by CRDs.
+		{name: "empty group", query: "resource=configmaps", wantBody: `resource "configmaps" of group "" is built into Kubernetes`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.handleBind(w, httptest.NewRequest(http.MethodGet, "/bind?s=abc&"+tt.query, nil))
+			require.Equal(t, http.StatusBadRequest, w.Code)
+			require.Contains(t, w.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestBindLandingPage(t *testing.T) {
+	h := newTestHandler(t, HandlerOptions{
+		CRDLister: newTestCRDLister(t, newTestCRD()),
+	})
+
+	page := &boundPage{
+		ProviderPrettyName: "Test Backend",
+		CRD:                newTestCRD(),
+		TargetNamespace:    "team-a",
+		RedirectURL:        "http://127.0.0.1:8080/callback?auth_response=eyJ9&p=1",
+	}
+
+	t.Run("invalid landing", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.handleBind(w, httptest.NewRequest(http.MethodGet, "/bind?s=abc&group=mangodb.com&resource=mangodbs&landing=maybe", nil))
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Contains(t, w.Body.String(), `invalid landing "maybe"`)
+	})
+
+	t.Run("direct redirect", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.redirectToConsumer(w, httptest.NewRequest(http.MethodGet, "/bind", nil), false, page)
+		require.Equal(t, http.StatusFound, w.Code)
+		require.Equal(t, page.RedirectURL, w.Header().Get("Location"))
+	})
+
+	t.Run("landing page", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.redirectToConsumer(w, httptest.NewRequest(http.MethodGet, "/bind", nil), true, page)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, contentTypeHTML, w.Header().Get("Content-Type"))
+		require.Empty(t, w.Header().Get("Location"))
+		body := w.Body.String()
+		require.Contains(t, body, "Provider: Test Backend")
+		require.Contains(t, body, "Resource: mangodbs")
+		require.Contains(t, body, "Group: mangodb.com")
+		require.Contains(t, body, "Versions: v1<")
+		require.Contains(t, body, "Target namespace: team-a")
+		require.Contains(t, body, `href="http://127.0.0.1:8080/callback?auth_response=eyJ9&amp;p=1"`)
+	})
+
+	t.Run("landing page pinned version", func(t *testing.T) {
+		pinned := *page
+		pinned.Version = "v2"
+		pinned.TargetNamespace = ""
+		w := httptest.NewRecorder()
+		h.redirectToConsumer(w, httptest.NewRequest(http.MethodGet, "/bind", nil), true, &pinned)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Contains(t, w.Body.String(), "Versions: v2<")
+		require.NotContains(t, w.Body.String(), "Target namespace")
+	})
+}
+
+func TestBindKubeconfigFormat(t *testing.T) {
+	h := newTestHandler(t, HandlerOptions{
+		CRDLister: newTestCRDLister(t, newTestCRD()),
+	})
+
+	w := httptest.NewRecorder()
+	h.handleBind(w, httptest.NewRequest(http.MethodGet, "/bind?s=abc&group=mangodb.com&resource=mangodbs&kubeconfigFormat=oidc", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), `invalid kubeconfigFormat "oidc"`)
+
+	for _, format := range []string{kubernetes.TokenKubeconfigFormat, kubernetes.ExecKubeconfigFormat} {
+		w := httptest.NewRecorder()
+		h.handleBind(w, httptest.NewRequest(http.MethodGet, "/bind?s=abc&group=mangodb.com&resource=mangodbs&kubeconfigFormat="+format, nil))
+		require.NotContains(t, w.Body.String(), "kubeconfigFormat", "format %q must be accepted", format)
+	}
+}
+
+func TestOversizedSessionCookie(t *testing.T) {
+	accessToken := strings.Repeat("a", 2*maxSessionCookieBytes)
+	issuer := newTestIdPWithAccessToken(t, accessToken)
+
+	keys, err := cookie.NewKeySet(bytes.Repeat([]byte("k"), cookie.MinKeyLength))
+	require.NoError(t, err)
+	provider, err := NewOIDCServiceProvider("client", "secret", "http://127.0.0.1:8080/callback", issuer, 3, time.Minute, 0)
+	require.NoError(t, err)
+	h := newTestHandler(t, HandlerOptions{
+		Provider:   provider,
+		CookieKeys: keys,
+	})
+
+	w := httptest.NewRecorder()
+	h.handleAuthorize(w, httptest.NewRequest(http.MethodGet, "/authorize?u=http://localhost:1234/callback&s=abc", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	h.handleCallback(w, httptest.NewRequest(http.MethodGet, "/callback?code=xyz&state="+url.QueryEscape(location.Query().Get("state")), nil))
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	require.LessOrEqual(t, len(cookies[0].Value), maxSessionCookieBytes)
+
+	ref, err := cookie.Decode(cookies[0].Value, keys.Derive(sessionCookieKeyPurpose))
+	require.NoError(t, err)
+	require.True(t, ref.ServerSide)
+	require.Equal(t, "abc", ref.SessionID)
+	require.Empty(t, ref.AccessToken, "the cookie must only reference the server-side state")
+
+	r := httptest.NewRequest(http.MethodGet, "/resources?s=abc", nil)
+	r.AddCookie(cookies[0])
+	state, err := h.sessionState(cookies[0])
+	require.NoError(t, err)
+	require.False(t, state.ServerSide)
+	require.Equal(t, accessToken, state.AccessToken)
+	require.Equal(t, "http://localhost:1234/callback", state.RedirectURL)
+	claims, err := h.sessionClaims(r)
+	require.NoError(t, err)
+	require.Equal(t, "jane", claims["sub"])
+
+	// re-issuing a state that fits again drops the server-side copy.
+	state.AccessToken = "access"
+	w = httptest.NewRecorder()
+	require.NoError(t, h.setSessionCookie(w, r, state, time.Hour))
+	s, found := h.sessions.Get("abc")
+	require.True(t, found)
+	require.Nil(t, s.State)
+	small, err := cookie.Decode(w.Result().Cookies()[0].Value, keys.Derive(sessionCookieKeyPurpose))
+	require.NoError(t, err)
+	require.False(t, small.ServerSide)
+	require.Equal(t, "access", small.AccessToken)
+
+	// cancelled sessions take their server-side state with them.
+	w = httptest.NewRecorder()
+	require.NoError(t, h.setSessionCookie(w, r, &cookie.SessionState{SessionID: "abc", AccessToken: accessToken}, time.Hour))
+	h.sessions.Delete("abc")
+	_, err = h.sessionClaims(r)
+	require.Error(t, err)
+	require.Error(t, h.setSessionCookie(httptest.NewRecorder(), r, &cookie.SessionState{SessionID: "abc", AccessToken: accessToken}, time.Hour), "oversized states need a session")
+}
+
+// newTestManager returns a kubernetes manager over fake clientsets, whose informers
+// are never started. Service account token secrets get a new token on every create.
+func newTestManager(t *testing.T) (*kubernetes.Manager, *kubefake.Clientset) {
+	t.Helper()
+
+	kubeClient := kubefake.NewSimpleClientset()
+	var minted int32
+	kubeClient.PrependReactor("create", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		switch obj := action.(clienttesting.CreateAction).GetObject().(type) {
+		case *corev1.Namespace:
+			// the fake clientset does not implement generateName.
+			if obj.Name == "" {
+				obj.Name = obj.GenerateName + "abcde"
+			}
+		case *corev1.Secret:
+			// simulates the token controller populating the service account token secret.
+			if obj.Type == resources.ServiceAccountTokenType {
+				token := fmt.Sprintf("token-%d", atomic.AddInt32(&minted, 1))
+				obj.Data = map[string][]byte{"token": []byte(token), "ca.crt": []byte("ca")}
+			}
+		}
+		return false, nil, nil
+	})
+	bindClient := bindfake.NewSimpleClientset()
+
+	m := kubernetes.NewKubernetesManagerForClients(
+		"cluster", "Example Backend", kubernetes.ServiceAccountKubeconfigMode, false, 0, nil,
+		&rest.Config{Host: "https://provider.example.com"},
+		kubeClient,
+		bindClient,
+		kubeinformers.NewSharedInformerFactory(kubeClient, 0).Core().V1().Namespaces(),
+		bindinformers.NewSharedInformerFactory(bindClient, 0).KubeBind().V1alpha1().APIServiceExports(),
+	)
+	return m, kubeClient
+}
+
+// kubeconfigToken returns the token of the current context of the kubeconfig.
+func kubeconfigToken(t *testing.T, kubeconfig []byte) string {
+	t.Helper()
+
+	cfg, err := clientcmd.Load(kubeconfig)
+	require.NoError(t, err)
+	return cfg.AuthInfos[cfg.Contexts[cfg.CurrentContext].AuthInfo].Token
+}
+
+func TestRotate(t *testing.T) {
+	manager, kubeClient := newTestManager(t)
+	sessions := session.NewStore()
+	h := newTestHandler(t, HandlerOptions{
+		BackendCallbackURL: "https://backend.example.com/callback",
+		CRDLister:          newTestCRDLister(t, newTestCRD()),
+		Sessions:           sessions,
+		Manager:            manager,
+	})
+	router := mux.NewRouter()
+	h.AddRoutes(router)
+
+	sessions.Add("abc", "jane", time.Hour)
+	b, err := (&cookie.SessionState{
+		IDToken:   `{"iss":"https://issuer","sub":"jane"}`,
+		SessionID: "abc",
+	}).Encode()
+	require.NoError(t, err)
+	params := "s=abc&group=mangodb.com&resource=mangodbs&format=download"
+	rotate := func(origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/rotate", strings.NewReader(params))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		r.AddCookie(cookie.MakeCookie(r, "kube-bind-abc", b, time.Hour))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+	// valid returns whether the API server would accept the service account token.
+	valid := func(token string) bool {
+		secrets, err := kubeClient.CoreV1().Secrets("").List(context.Background(), metav1.ListOptions{})
+		require.NoError(t, err)
+		for _, s := range secrets.Items {
+			if s.Type == resources.ServiceAccountTokenType && string(s.Data["token"]) == token {
+				return true
+			}
+		}
+		return false
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/bind?"+params, nil)
+	r.AddCookie(cookie.MakeCookie(r, "kube-bind-abc", b, time.Hour))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	oldToken := kubeconfigToken(t, w.Body.Bytes())
+	require.True(t, valid(oldToken))
+
+	t.Run("get", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/rotate?"+params, nil)
+		r.AddCookie(cookie.MakeCookie(r, "kube-bind-abc", b, time.Hour))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		require.True(t, valid(oldToken))
+	})
+
+	t.Run("cross-site", func(t *testing.T) {
+		for _, origin := range []string{"", "https://evil.example.com", "http://backend.example.com"} {
+			w := rotate(origin)
+			require.Equal(t, http.StatusForbidden, w.Code, origin)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/rotate", strings.NewReader(params))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Sec-Fetch-Site", "cross-site")
+		r.Header.Set("Origin", "https://backend.example.com")
+		r.AddCookie(cookie.MakeCookie(r, "kube-bind-abc", b, time.Hour))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		require.Equal(t, http.StatusForbidden, w.Code)
+		require.True(t, valid(oldToken), "refused rotations must not invalidate the token")
+	})
+
+	t.Run("same origin", func(t *testing.T) {
+		w := rotate("https://backend.example.com")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		newToken := kubeconfigToken(t, w.Body.Bytes())
+		require.NotEqual(t, oldToken, newToken)
+		require.False(t, valid(oldToken), "the old token must stop working")
+		require.True(t, valid(newToken))
+	})
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+)
+
+// identityBuilder derives the stable identity of a user from the claims of the ID token.
+type identityBuilder struct {
+	tmpl *template.Template
+}
+
+// newIdentityBuilder returns the builder rendering the parsed identity template,
+// see options.ParseIdentityTemplate.
+func newIdentityBuilder(tmpl *template.Template) (*identityBuilder, error) {
+	if tmpl == nil {
+		return nil, fmt.Errorf("identity template is required")
+	}
+	return &identityBuilder{tmpl: tmpl}, nil
+}
+
+// Identity renders the identity template with the given claims. It fails if a
+// referenced claim is missing or the result is empty.
+func (b *identityBuilder) Identity(claims map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := b.tmpl.Execute(&buf, claims); err != nil {
+		return "", fmt.Errorf("failed to render identity: %w", err)
+	}
+	if buf.Len() == 0 {
+		return "", fmt.Errorf("identity template rendered an empty identity")
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"k8s.io/klog/v2"
+
+	"github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes"
+)
+
+// contextNameInvalidChars are replaced in context names, such that they can be
+// passed to kubectl --context without quoting.
+var contextNameInvalidChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// boundKubeconfig is the kubeconfig of a bound export.
+type boundKubeconfig struct {
+	Export     string
+	Kubeconfig []byte
+}
+
+// handleKubeconfig returns one kubeconfig with a context per export bound by the
+// subject of the session, named <provider>/<export>. All exports of an identity
+// share the credentials of its namespace, hence the contexts share one cluster and
+// one user. The kubeconfigFormat query parameter selects the format of the
+// credentials as for /bind.
+func (h *handler) handleKubeconfig(w http.ResponseWriter, r *http.Request) {
+	logger := klog.FromContext(r.Context()).WithValues("method", r.Method, "url", r.URL.String())
+
+	prepareNoCache(w)
+
+	claims, err := h.sessionClaims(r)
+	if err != nil {
+		logger.Info("failed to get session claims", "error", err)
+		http.Error(w, "session cancelled or expired, please restart the binding", http.StatusUnauthorized)
+		return
+	}
+	kubeconfigFormat := r.URL.Query().Get("kubeconfigFormat")
+	if err := h.validateKubeconfigFormat(kubeconfigFormat); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	identity, err := h.identityOf(r.Context(), claims)
+	if err != nil {
+		logger.Info("failed to derive identity from id token", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	var exports []string
+	var kfg []byte
+	if h.exportedResources != nil {
+		if exports, err = h.exportedResources(r.Context(), identity); err != nil {
+			h.errorLogs.Info(logger, "failed to list exported resources", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if len(exports) > 0 && h.boundKubeconfig != nil {
+		if kfg, err = h.boundKubeconfig(r.Context(), identity, kubeconfigFormat); errors.Is(err, kubernetes.ErrExecKubeconfigNotConfigured) {
+			http.Error(w, "exec kubeconfigs are not supported by this backend", http.StatusBadRequest)
+			return
+		} else if err != nil {
+			h.errorLogs.Info(logger, "failed to get kubeconfig", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if len(exports) == 0 || kfg == nil {
+		http.Error(w, "nothing bound yet", http.StatusNotFound)
+		return
+	}
+
+	bound := make([]boundKubeconfig, 0, len(exports))
+	for _, export := range exports {
+		bound = append(bound, boundKubeconfig{Export: export, Kubeconfig: kfg})
+	}
+	merged, err := mergeKubeconfigs(h.providerPrettyName, bound)
+	if err != nil {
+		logger.Info("failed to merge kubeconfigs", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	writeKubeconfigDownload(w, merged)
+}
+
+// mergeKubeconfigs returns a kubeconfig with the current context of each of the
+// given kubeconfigs as context <provider>/<export>. Identical clusters and users
+// are merged into one entry, named after the first context by name using it. The
+// current context is the first one by name.
+func mergeKubeconfigs(provider string, bound []boundKubeconfig) ([]byte, error) {
+	bound = append([]boundKubeconfig(nil), bound...)
+	sort.Slice(bound, func(i, j int) bool {
+		return contextName(provider, bound[i].Export) < contextName(provider, bound[j].Export)
+	})
+
+	merged := clientcmdapi.NewConfig()
+	for _, b := range bound {
+		cfg, err := clientcmd.Load(b.Kubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kubeconfig of %s: %w", b.Export, err)
+		}
+		kubeContext, found := cfg.Contexts[cfg.CurrentContext]
+		if !found {
+			return nil, fmt.Errorf("kubeconfig of %s has no current context", b.Export)
+		}
+		cluster, found := cfg.Clusters[kubeContext.Cluster]
+		if !found {
+			return nil, fmt.Errorf("kubeconfig of %s has no cluster %q", b.Export, kubeContext.Cluster)
+		}
+		authInfo, found := cfg.AuthInfos[kubeContext.AuthInfo]
+		if !found {
+			return nil, fmt.Errorf("kubeconfig of %s has no user %q", b.Export, kubeContext.AuthInfo)
+		}
+
+		name := contextName(provider, b.Export)
+		if _, found := merged.Contexts[name]; found {
+			return nil, fmt.Errorf("duplicate context %q", name)
+		}
+		clusterName := findEqual(merged.Clusters, cluster)
+		if clusterName == "" {
+			clusterName = name
+			merged.Clusters[name] = cluster.DeepCopy()
+		}
+		authInfoName := findEqual(merged.AuthInfos, authInfo)
+		if authInfoName == "" {
+			authInfoName = name
+			merged.AuthInfos[name] = authInfo.DeepCopy()
+		}
+		merged.Contexts[name] = &clientcmdapi.Context{
+			Cluster:   clusterName,
+			AuthInfo:  authInfoName,
+			Namespace: kubeContext.Namespace,
+		}
+		if merged.CurrentContext == "" {
+			merged.CurrentContext = name
+		}
+	}
+
+	return clientcmd.Write(*merged)
+}
+
+// findEqual returns the name of an entry deeply equal to v, or empty if there is none.
+func findEqual[V any](entries map[string]V, v V) string {
+	for name, e := range entries {
+		if reflect.DeepEqual(e, v) {
+			return name
+		}
+	}
+	return ""
+}
+
+// contextName returns <provider>/<export> with both parts lowercased and
+// characters other than letters, digits, dots and dashes replaced by dashes.
+func contextName(provider, export string) string {
+	sanitize := func(s string) string {
+		return strings.Trim(contextNameInvalidChars.ReplaceAllString(strings.ToLower(s), "-"), "-.")
+	}
+	if p := sanitize(provider); p != "" {
+		return p + "/" + sanitize(export)
+	}
+	return sanitize(export)
+}
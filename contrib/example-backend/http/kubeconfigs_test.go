@@ -0,0 +1,160 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/kube-bind/kube-bind/contrib/example-backend/cookie"
+	"github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes"
+	"github.com/kube-bind/kube-bind/contrib/example-backend/session"
+)
+
+func newTestKubeconfig(t *testing.T, host, namespace, token string) []byte {
+	t.Helper()
+	bs, err := clientcmd.Write(clientcmdapi.Config{
+		Clusters:       map[string]*clientcmdapi.Cluster{"default": {Server: host}},
+		AuthInfos:      map[string]*clientcmdapi.AuthInfo{"default": {Token: token}},
+		Contexts:       map[string]*clientcmdapi.Context{"default": {Cluster: "default", AuthInfo: "default", Namespace: namespace}},
+		CurrentContext: "default",
+	})
+	require.NoError(t, err)
+	return bs
+}
+
+func TestMergeKubeconfigs(t *testing.T) {
+	merged, err := mergeKubeconfigs("MangoDB Inc.", []boundKubeconfig{
+		{Export: "mangodbs.mangodb.com", Kubeconfig: newTestKubeconfig(t, "https://a.example.com", "kube-bind-abc", "a")},
+		{Export: "backups.mangodb.com", Kubeconfig: newTestKubeconfig(t, "https://b.example.com", "kube-bind-def", "b")},
+	})
+	require.NoError(t, err)
+
+	cfg, err := clientcmd.Load(merged)
+	require.NoError(t, err)
+	require.NoError(t, clientcmd.Validate(*cfg))
+	require.Len(t, cfg.Contexts, 2)
+	require.Equal(t, "mangodb-inc/backups.mangodb.com", cfg.CurrentContext)
+
+	for name, want := range map[string]struct{ host, namespace, token string }{
+		"mangodb-inc/mangodbs.mangodb.com": {"https://a.example.com", "kube-bind-abc", "a"},
+		"mangodb-inc/backups.mangodb.com":  {"https://b.example.com", "kube-bind-def", "b"},
+	} {
+		kubeContext := cfg.Contexts[name]
+		require.NotNil(t, kubeContext, name)
+		require.Equal(t, want.namespace, kubeContext.Namespace)
+		require.Equal(t, want.host, cfg.Clusters[kubeContext.Cluster].Server)
+		require.Equal(t, want.token, cfg.AuthInfos[kubeContext.AuthInfo].Token)
+	}
+
+	shared := newTestKubeconfig(t, "https://a.example.com", "kube-bind-abc", "a")
+	merged, err = mergeKubeconfigs("MangoDB Inc.", []boundKubeconfig{
+		{Export: "mangodbs.mangodb.com", Kubeconfig: shared},
+		{Export: "backups.mangodb.com", Kubeconfig: shared},
+		{Export: "restores.mangodb.com", Kubeconfig: newTestKubeconfig(t, "https://a.example.com", "kube-bind-abc", "b")},
+	})
+	require.NoError(t, err)
+	cfg, err = clientcmd.Load(merged)
+	require.NoError(t, err)
+	require.NoError(t, clientcmd.Validate(*cfg))
+	require.Len(t, cfg.Contexts, 3)
+	require.Equal(t, []string{"mangodb-inc/backups.mangodb.com"}, keys(cfg.Clusters), "identical clusters are merged")
+	require.ElementsMatch(t, []string{"mangodb-inc/backups.mangodb.com", "mangodb-inc/restores.mangodb.com"}, keys(cfg.AuthInfos))
+	require.Equal(t, "mangodb-inc/backups.mangodb.com", cfg.Contexts["mangodb-inc/mangodbs.mangodb.com"].AuthInfo)
+	require.Equal(t, "b", cfg.AuthInfos[cfg.Contexts["mangodb-inc/restores.mangodb.com"].AuthInfo].Token)
+
+	_, err = mergeKubeconfigs("MangoDB Inc.", []boundKubeconfig{{Export: "mangodbs.mangodb.com", Kubeconfig: []byte("current-context: missing")}})
+	require.ErrorContains(t, err, "has no current context")
+}
+
+func TestHandleKubeconfig(t *testing.T) {
+	sessions := session.NewStore()
+	sessions.Add("abc", "jane", time.Hour)
+	h := newTestHandler(t, HandlerOptions{
+		ProviderPrettyName: "MangoDB Inc.",
+		Sessions:           sessions,
+	})
+
+	kfg := newTestKubeconfig(t, "https://provider.example.com", "kube-bind-abc", "token")
+	var exports []string
+	h.exportedResources = func(ctx context.Context, identity string) ([]string, error) {
+		require.Equal(t, "https://issuer/jane", identity)
+		return exports, nil
+	}
+	h.boundKubeconfig = func(ctx context.Context, identity, format string) ([]byte, error) {
+		if format == kubernetes.ExecKubeconfigFormat {
+			return nil, kubernetes.ErrExecKubeconfigNotConfigured
+		}
+		return kfg, nil
+	}
+
+	b, err := (&cookie.SessionState{IDToken: `{"iss":"https://issuer","sub":"jane"}`, SessionID: "abc"}).Encode()
+	require.NoError(t, err)
+	get := func(query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/kubeconfig?s=abc"+query, nil)
+		r.AddCookie(cookie.MakeCookie(nil, "kube-bind-abc", b, time.Hour))
+		w := httptest.NewRecorder()
+		h.handleKubeconfig(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusNotFound, get("").Code, "nothing bound yet")
+
+	exports = []string{"mangodbs.mangodb.com", "backups.mangodb.com"}
+	w := get("")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Equal(t, contentTypeYAML, w.Header().Get("Content-Type"))
+	require.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+
+	cfg, err := clientcmd.Load(w.Body.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, clientcmd.Validate(*cfg))
+	require.ElementsMatch(t, []string{"mangodb-inc/mangodbs.mangodb.com", "mangodb-inc/backups.mangodb.com"}, keys(cfg.Contexts))
+	require.Len(t, cfg.Clusters, 1, "exports share one cluster")
+	require.Len(t, cfg.AuthInfos, 1, "exports share one credential")
+	for _, kubeContext := range cfg.Contexts {
+		require.Equal(t, "kube-bind-abc", kubeContext.Namespace)
+	}
+
+	w = get("&kubeconfigFormat=exec")
+	require.Equal(t, http.StatusBadRequest, w.Code, "no exec credential plugin configured")
+	require.Contains(t, w.Body.String(), "exec kubeconfigs are not supported")
+	w = get("&kubeconfigFormat=foo")
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "invalid kubeconfigFormat")
+
+	r := httptest.NewRequest(http.MethodGet, "/kubeconfig?s=abc", nil)
+	w = httptest.NewRecorder()
+	h.handleKubeconfig(w, r)
+	require.Equal(t, http.StatusUnauthorized, w.Code, "a session is required")
+}
+
+func keys[V any](m map[string]V) []string {
+	ks := make([]string, 0, len(m))
+	for k := range m {
+		ks = append(ks, k)
+	}
+	return ks
+}
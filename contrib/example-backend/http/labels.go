@@ -0,0 +1,85 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/kube-bind/kube-bind/contrib/example-backend/options"
+)
+
+var invalidLabelValueChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// claimLabeler derives namespace labels from the claims of the ID token.
+type claimLabeler struct {
+	// labelKeys maps claims to label keys.
+	labelKeys map[string]string
+}
+
+func newClaimLabeler(mappings []string) (*claimLabeler, error) {
+	labelKeys, err := options.ParseClaimLabels(mappings)
+	if err != nil {
+		return nil, err
+	}
+	return &claimLabeler{labelKeys: labelKeys}, nil
+}
+
+// Labels returns the labels of the mapped claims. Values are sanitized to valid
+// label values, list claims like groups are joined with dots. Claims that are
+// missing or sanitize to an empty value are skipped.
+func (l *claimLabeler) Labels(claims map[string]interface{}) map[string]string {
+	labels := map[string]string{}
+	for claim, key := range l.labelKeys {
+		value, found := claims[claim]
+		if !found {
+			continue
+		}
+
+		var parts []string
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				if part := sanitizeLabelValue(fmt.Sprint(item)); part != "" {
+					parts = append(parts, part)
+				}
+			}
+		default:
+			parts = append(parts, sanitizeLabelValue(fmt.Sprint(v)))
+		}
+
+		if sanitized := sanitizeLabelValue(strings.Join(parts, ".")); sanitized != "" {
+			labels[key] = sanitized
+		}
+	}
+	return labels
+}
+
+// sanitizeLabelValue replaces characters not allowed in label values by dashes,
+// and trims the result to the allowed length and alphanumeric ends.
+func sanitizeLabelValue(value string) string {
+	value = invalidLabelValueChars.ReplaceAllString(value, "-")
+	if len(value) > validation.LabelValueMaxLength {
+		value = value[:validation.LabelValueMaxLength]
+	}
+	return strings.TrimFunc(value, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"net/http"
+	"sync/atomic"
+)
+
+// maintenanceRetryAfter is the Retry-After in seconds of binds refused during maintenance.
+const maintenanceRetryAfter = "60"
+
+// Maintenance is the maintenance mode of the backend, e.g. during migrations. While
+// enabled, read endpoints keep being served, but no new binds are provisioned. It can
+// be toggled at runtime. A nil Maintenance is never enabled.
+type Maintenance struct {
+	enabled atomic.Bool
+}
+
+// NewMaintenance returns a maintenance mode, initially enabled or not.
+func NewMaintenance(enabled bool) *Maintenance {
+	m := &Maintenance{}
+	m.enabled.Store(enabled)
+	return m
+}
+
+// Enabled returns true if the backend is in maintenance.
+func (m *Maintenance) Enabled() bool {
+	return m != nil && m.enabled.Load()
+}
+
+// Set enables or disables the maintenance mode.
+func (m *Maintenance) Set(enabled bool) {
+	m.enabled.Store(enabled)
+}
+
+// refuse answers with 503 and returns true if the backend is in maintenance.
+func (m *Maintenance) refuse(w http.ResponseWriter, r *http.Request) bool {
+	if !m.Enabled() {
+		return false
+	}
+	w.Header().Set("Retry-After", maintenanceRetryAfter)
+	writeError(w, r, http.StatusServiceUnavailable, "The service provider is under maintenance and does not accept new bindings at the moment. Please retry later.")
+	return true
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	maintenance := NewMaintenance(true)
+	h := newTestHandler(t, HandlerOptions{
+		BackendCallbackURL: "https://backend.example.com/callback",
+		Maintenance:        maintenance,
+		CRDLister:          newTestCRDLister(t, newTestCRD()),
+	})
+	router := mux.NewRouter()
+	h.AddRoutes(router)
+
+	do := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if strings.HasPrefix(path, "/rotate") {
+			r.Method = http.MethodPost
+			r.Header.Set("Origin", "https://backend.example.com")
+		}
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, path := range []string{"/bind?s=abc&group=mangodb.com&resource=mangodbs", "/rotate?s=abc&group=mangodb.com&resource=mangodbs"} {
+		w := do(path)
+		require.Equal(t, http.StatusServiceUnavailable, w.Code, path)
+		require.Equal(t, maintenanceRetryAfter, w.Header().Get("Retry-After"))
+		require.Contains(t, w.Body.String(), "under maintenance")
+	}
+	for _, path := range []string{"/resources?s=abc", "/export", "/metadata"} {
+		require.Equal(t, http.StatusOK, do(path).Code, path)
+	}
+
+	maintenance.Set(false)
+	w := do("/bind?s=abc&group=mangodb.com&resource=mangodbs")
+	require.NotEqual(t, http.StatusServiceUnavailable, w.Code)
+	require.NotContains(t, w.Body.String(), "under maintenance")
+}
@@ -18,6 +18,11 @@ package http
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
 
 	oidc "github.com/coreos/go-oidc"
 	"golang.org/x/oauth2"
@@ -31,9 +36,16 @@ type OIDCServiceProvider struct {
 
 	verifier *oidc.IDTokenVerifier
 	provider *oidc.Provider
+
+	// breaker fails token exchanges fast while the IdP is down.
+	breaker *circuitBreaker
+
+	// userInfoTimeout enables enriching the ID token claims with the userinfo
+	// endpoint, bounding each call. Zero disables it.
+	userInfoTimeout time.Duration
 }
 
-func NewOIDCServiceProvider(clientID, clientSecret, redirectURI, issuerURL string) (*OIDCServiceProvider, error) {
+func NewOIDCServiceProvider(clientID, clientSecret, redirectURI, issuerURL string, breakerThreshold int, breakerCoolDown, userInfoTimeout time.Duration) (*OIDCServiceProvider, error) {
 	provider, err := oidc.NewProvider(context.TODO(), issuerURL)
 	if err != nil {
 		return nil, err
@@ -46,9 +58,30 @@ func NewOIDCServiceProvider(clientID, clientSecret, redirectURI, issuerURL strin
 		issuerURL:    issuerURL,
 		provider:     provider,
 		verifier:     provider.Verifier(&oidc.Config{ClientID: clientID}),
+		breaker:      newCircuitBreaker("oidc-token-exchange", breakerThreshold, breakerCoolDown, isTokenExchangeFailure),
+
+		userInfoTimeout: userInfoTimeout,
 	}, nil
 }
 
+// OIDCEndpoints are the endpoints discovered at the issuer.
+type OIDCEndpoints struct {
+	Issuer        string `json:"issuer"`
+	Authorization string `json:"authorization_endpoint"`
+	Token         string `json:"token_endpoint"`
+	UserInfo      string `json:"userinfo_endpoint"`
+	JWKS          string `json:"jwks_uri"`
+}
+
+// Endpoints returns the endpoints of the discovery document of the issuer.
+func (o *OIDCServiceProvider) Endpoints() (*OIDCEndpoints, error) {
+	endpoints := &OIDCEndpoints{}
+	if err := o.provider.Claims(endpoints); err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
 func (o *OIDCServiceProvider) OIDCProviderConfig(scopes []string) *oauth2.Config {
 	return &oauth2.Config{
 		ClientID:     o.clientID,
@@ -58,3 +91,53 @@ func (o *OIDCServiceProvider) OIDCProviderConfig(scopes []string) *oauth2.Config
 		Scopes:       scopes,
 	}
 }
+
+// Exchange exchanges the authorization code for a token. It returns errCircuitOpen
+// without calling the IdP after repeated failures.
+func (o *OIDCServiceProvider) Exchange(ctx context.Context, code string) (*oauth2.Token, error) {
+	var token *oauth2.Token
+	err := o.breaker.Do(func() error {
+		var err error
+		token, err = o.OIDCProviderConfig(nil).Exchange(ctx, code)
+		return err
+	})
+	return token, err
+}
+
+// isTokenExchangeFailure returns whether the token exchange failed because the IdP is
+// unavailable, i.e. on transport errors, timeouts and 5xx responses. Rejections of the
+// request, e.g. of an invalid or replayed code, show that the IdP is up.
+func isTokenExchangeFailure(err error) bool {
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) {
+		return retrieveErr.Response == nil || retrieveErr.Response.StatusCode >= http.StatusInternalServerError
+	}
+	if errors.Is(err, context.Canceled) {
+		return false // the consumer went away
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// UserInfo returns the claims of the userinfo endpoint for the access token. The
+// subject of the userinfo response must be the one of the ID token.
+func (o *OIDCServiceProvider) UserInfo(ctx context.Context, accessToken, subject string) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, o.userInfoTimeout)
+	defer cancel()
+
+	info, err := o.provider.UserInfo(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: accessToken, TokenType: "Bearer"}))
+	if err != nil {
+		return nil, err
+	}
+	if info.Subject != subject {
+		return nil, fmt.Errorf("userinfo subject %q does not match the id token subject %q", info.Subject, subject)
+	}
+	var claims map[string]interface{}
+	if err := info.Claims(&claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"io"
+	"net/http"
+
+	"k8s.io/klog/v2"
+)
+
+// Content types of responses. Text responses are always UTF-8 encoded.
+const (
+	contentTypeHTML = "text/html; charset=utf-8"
+	contentTypeJSON = "application/json; charset=utf-8"
+	contentTypeYAML = "application/yaml; charset=utf-8"
+	contentTypeText = "text/plain; charset=utf-8"
+)
+
+// writeBody writes the body with the content type and status 200.
+func writeBody(w http.ResponseWriter, contentType string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body) // nolint:errcheck
+}
+
+// writeBuffered renders the body into a buffer before writing the status code and
+// the body. A render error hence never leaves a partial body with a success status
+// behind, but is answered with a clean 500.
+func writeBuffered(w http.ResponseWriter, r *http.Request, code int, contentType string, render func(io.Writer) error) {
+	var buf bytes.Buffer
+	if err := render(&buf); err != nil {
+		logger := klog.FromContext(r.Context()).WithValues("method", r.Method, "url", r.URL.String())
+		logger.Error(err, "failed to render response")
+		writeError(w, r, http.StatusInternalServerError, "The response could not be rendered.")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(code)
+	w.Write(buf.Bytes()) // nolint:errcheck
+}
+
+// writeHTML executes the template with the data and writes the result with the code.
+func writeHTML(w http.ResponseWriter, r *http.Request, code int, tmpl *htmltemplate.Template, data interface{}) {
+	writeBuffered(w, r, code, contentTypeHTML, func(out io.Writer) error {
+		return tmpl.Execute(out, data)
+	})
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"errors"
+	htmltemplate "html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+
+	"github.com/kube-bind/kube-bind/contrib/example-backend/session"
+)
+
+func TestResourcesRenderFailure(t *testing.T) {
+	funcs := map[string]interface{}{
+		"servedVersions": func(crd *apiextensionsv1.CustomResourceDefinition) ([]string, error) {
+			return nil, errors.New("boom")
+		},
+	}
+	h := newTestHandler(t, HandlerOptions{
+		TemplateFuncs: funcs,
+		CRDLister:     newTestCRDLister(t, newTestCRD()),
+	})
+
+	w := httptest.NewRecorder()
+	h.handleResources(w, httptest.NewRequest(http.MethodGet, "/resources?s=abc", nil))
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Contains(t, w.Body.String(), "500 Internal Server Error")
+	require.NotContains(t, w.Body.String(), "Group: ", "partially rendered resources page must not be sent")
+
+	r := httptest.NewRequest(http.MethodGet, "/resources?s=abc", nil)
+	r.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	h.handleResources(w, r)
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Equal(t, contentTypeJSON, w.Header().Get("Content-Type"))
+	require.JSONEq(t, `{"code":500,"status":"Internal Server Error","message":"The response could not be rendered.","requestID":"`+w.Header().Get(requestIDHeader)+`"}`, w.Body.String())
+}
+
+func TestErrorResponseRenderFailure(t *testing.T) {
+	orig := errorTemplate
+	t.Cleanup(func() { errorTemplate = orig })
+	errorTemplate = htmltemplate.Must(htmltemplate.New("error").Funcs(htmltemplate.FuncMap{
+		"fail": func() (string, error) { return "", errors.New("boom") },
+	}).Parse(`<h1>{{.Code}} {{.Status}}</h1>{{fail}}`))
+
+	w := httptest.NewRecorder()
+	writeError(w, httptest.NewRequest(http.MethodGet, "/foo", nil), http.StatusNotFound, "not found")
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	require.Equal(t, "Internal Server Error\n", w.Body.String())
+}
+
+func TestResponseContentTypes(t *testing.T) {
+	claims := session.NewClaimStore()
+	h := newTestHandler(t, HandlerOptions{
+		CRDLister: newTestCRDLister(t, newTestCRD()),
+		Claims:    claims,
+	})
+	router := mux.NewRouter()
+	installErrorHandlers(router)
+	h.AddRoutes(router)
+
+	claimToken, err := claims.Put([]byte(`{}`), time.Minute)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		method, path    string
+		form            url.Values
+		accept          string
+		wantCode        int
+		wantContentType string
+	}{
+		{name: "export", method: http.MethodGet, path: "/export", wantCode: http.StatusOK, wantContentType: contentTypeJSON},
+		{name: "metadata", method: http.MethodGet, path: "/metadata", wantCode: http.StatusOK, wantContentType: contentTypeJSON},
+		{name: "oidc requirements", method: http.MethodGet, path: "/oidc-requirements", wantCode: http.StatusOK, wantContentType: contentTypeJSON},
+		{name: "resources", method: http.MethodGet, path: "/resources?s=abc", wantCode: http.StatusOK, wantContentType: contentTypeHTML},
+		{name: "claim", method: http.MethodPost, path: "/claim", form: url.Values{"token": {claimToken}}, wantCode: http.StatusOK, wantContentType: contentTypeJSON},
+		{name: "cancel", method: http.MethodPost, path: "/cancel", form: url.Values{"s": {"abc"}}, wantCode: http.StatusOK, wantContentType: contentTypeText},
+		{name: "html error", method: http.MethodGet, path: "/unknown", wantCode: http.StatusNotFound, wantContentType: contentTypeHTML},
+		{name: "json error", method: http.MethodGet, path: "/unknown", accept: "application/json", wantCode: http.StatusNotFound, wantContentType: contentTypeJSON},
+		{name: "plain error", method: http.MethodPost, path: "/claim", wantCode: http.StatusBadRequest, wantContentType: contentTypeText},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.form.Encode()))
+			if tt.form != nil {
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			require.Equal(t, tt.wantCode, w.Code, w.Body.String())
+			require.Equal(t, tt.wantContentType, w.Header().Get("Content-Type"))
+		})
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	authorizationv1client "k8s.io/client-go/kubernetes/typed/authorization/v1"
+
+	"github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes"
+)
+
+// SubjectAccessReviewVerb is the verb a user needs on a resource in the provider
+// cluster RBAC to bind it with the SubjectAccessReview authorizer.
+const SubjectAccessReviewVerb = "bind"
+
+type subjectAccessReviewAuthorizer struct {
+	client       authorizationv1client.SubjectAccessReviewInterface
+	groupsClaim  string
+	groupsPrefix string
+}
+
+// NewSubjectAccessReviewAuthorizer returns an Authorizer that allows a bind if the
+// provider cluster authorizes the user to "bind" the requested resource, in the target
+// namespace if given. The user is the identity with the prefix of impersonated users,
+// the groups are taken from the groups claim if non-empty and prefixed with groupsPrefix.
+// Groups starting with "system:" are dropped, the IdP must not grant Kubernetes groups.
+func NewSubjectAccessReviewAuthorizer(client authorizationv1client.SubjectAccessReviewInterface, groupsClaim, groupsPrefix string) Authorizer {
+	return &subjectAccessReviewAuthorizer{
+		client:       client,
+		groupsClaim:  groupsClaim,
+		groupsPrefix: groupsPrefix,
+	}
+}
+
+func (a *subjectAccessReviewAuthorizer) Authorize(ctx context.Context, req *BindRequest) (bool, string, error) {
+	sar := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User: kubernetes.ImpersonatedUserPrefix + req.Identity,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: req.TargetNamespace,
+				Verb:      SubjectAccessReviewVerb,
+				Group:     req.Group,
+				Version:   req.Version,
+				Resource:  req.Resource,
+			},
+		},
+	}
+	if a.groupsClaim != "" {
+		groups, err := claimStrings(req.Claims, a.groupsClaim)
+		if err != nil {
+			return false, "", err
+		}
+		for _, g := range groups {
+			if strings.HasPrefix(g, "system:") {
+				continue
+			}
+			sar.Spec.Groups = append(sar.Spec.Groups, a.groupsPrefix+g)
+		}
+	}
+
+	result, err := a.client.Create(ctx, sar, metav1.CreateOptions{})
+	if err != nil {
+		return false, "", fmt.Errorf("failed to create SubjectAccessReview: %w", err)
+	}
+	if result.Status.EvaluationError != "" && !result.Status.Allowed {
+		return false, "", fmt.Errorf("failed to evaluate SubjectAccessReview: %s", result.Status.EvaluationError)
+	}
+	if !result.Status.Allowed {
+		reason := result.Status.Reason
+		if reason == "" {
+			reason = fmt.Sprintf("user %q cannot %s %s in the service provider cluster", sar.Spec.User, SubjectAccessReviewVerb, req.Resource+"."+req.Group)
+		}
+		return false, reason, nil
+	}
+	return true, "", nil
+}
+
+// claimStrings returns the claim as string list. A single string is a list of one.
+func claimStrings(claims map[string]interface{}, name string) ([]string, error) {
+	switch v := claims[name].(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, x := range v {
+			s, ok := x.(string)
+			if !ok {
+				return nil, fmt.Errorf("claim %q must be a list of strings", name)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("claim %q must be a list of strings", name)
+	}
+}
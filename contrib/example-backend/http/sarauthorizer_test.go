@@ -0,0 +1,112 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestSubjectAccessReviewAuthorizer(t *testing.T) {
+	req := &BindRequest{
+		Identity:        "https://issuer/jane",
+		Claims:          map[string]interface{}{"groups": []interface{}{"dba", "system:masters", "dev"}},
+		CRD:             newTestCRD(),
+		Group:           "mangodb.com",
+		Resource:        "mangodbs",
+		Version:         "v1",
+		TargetNamespace: "team-a",
+	}
+
+	tests := []struct {
+		name         string
+		groupsClaim  string
+		groupsPrefix string
+		status       authorizationv1.SubjectAccessReviewStatus
+		wantAllowed  bool
+		wantReason   string
+		wantErr      string
+		wantGroups   []string
+	}{
+		{name: "allowed", groupsClaim: "groups", status: authorizationv1.SubjectAccessReviewStatus{Allowed: true}, wantAllowed: true, wantGroups: []string{"dba", "dev"}},
+		{name: "prefixed groups", groupsClaim: "groups", groupsPrefix: "kube-bind:", status: authorizationv1.SubjectAccessReviewStatus{Allowed: true}, wantAllowed: true, wantGroups: []string{"kube-bind:dba", "kube-bind:dev"}},
+		{name: "denied with reason", groupsClaim: "groups", status: authorizationv1.SubjectAccessReviewStatus{Reason: "no RBAC policy matched"}, wantReason: "no RBAC policy matched", wantGroups: []string{"dba", "dev"}},
+		{name: "denied", status: authorizationv1.SubjectAccessReviewStatus{Denied: true}, wantReason: `user "kube-bind:https://issuer/jane" cannot bind mangodbs.mangodb.com in the service provider cluster`},
+		{name: "evaluation error", status: authorizationv1.SubjectAccessReviewStatus{EvaluationError: "webhook unavailable"}, wantErr: "webhook unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			var got *authorizationv1.SubjectAccessReview
+			client.PrependReactor("create", "subjectaccessreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				got = action.(clienttesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview).DeepCopy()
+				result := got.DeepCopy()
+				result.Status = tt.status
+				return true, result, nil
+			})
+
+			allowed, reason, err := NewSubjectAccessReviewAuthorizer(client.AuthorizationV1().SubjectAccessReviews(), tt.groupsClaim, tt.groupsPrefix).Authorize(context.Background(), req)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantAllowed, allowed)
+			require.Equal(t, tt.wantReason, reason)
+
+			require.Equal(t, "kube-bind:https://issuer/jane", got.Spec.User)
+			require.Equal(t, tt.wantGroups, got.Spec.Groups)
+			require.Equal(t, &authorizationv1.ResourceAttributes{
+				Namespace: "team-a",
+				Verb:      "bind",
+				Group:     "mangodb.com",
+				Version:   "v1",
+				Resource:  "mangodbs",
+			}, got.Spec.ResourceAttributes)
+		})
+	}
+}
+
+func TestClaimStrings(t *testing.T) {
+	claims := map[string]interface{}{
+		"single": "dba",
+		"list":   []interface{}{"dba", "dev"},
+		"mixed":  []interface{}{"dba", 42.0},
+		"number": 42.0,
+	}
+
+	got, err := claimStrings(claims, "single")
+	require.NoError(t, err)
+	require.Equal(t, []string{"dba"}, got)
+	got, err = claimStrings(claims, "list")
+	require.NoError(t, err)
+	require.Equal(t, []string{"dba", "dev"}, got)
+	got, err = claimStrings(claims, "missing")
+	require.NoError(t, err)
+	require.Nil(t, got)
+	_, err = claimStrings(claims, "mixed")
+	require.Error(t, err)
+	_, err = claimStrings(claims, "number")
+	require.Error(t, err)
+}
@@ -24,6 +24,8 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"k8s.io/apimachinery/pkg/util/sets"
+
 	"github.com/kube-bind/kube-bind/contrib/example-backend/options"
 )
 
@@ -38,6 +40,11 @@ func NewServer(options *options.Serve) (*Server, error) {
 		options: options,
 		Router:  mux.NewRouter(),
 	}
+	if options.MaxInFlight > 0 {
+		server.Router.Use(limitInFlight(options.MaxInFlight))
+	}
+	server.Router.Use(limitRequestBody(options.MaxRequestBodyBytes))
+	installErrorHandlers(server.Router)
 
 	if options.Listener == nil {
 		var err error
@@ -75,3 +82,44 @@ func (s *Server) Start(ctx context.Context) error {
 
 	return nil
 }
+
+// limitRequestBody rejects requests announcing a body larger than limit and
+// bounds the body of all others, such that reading beyond limit fails.
+func limitRequestBody(limit int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// unlimitedPaths are not subject to the in-flight limit, such that health probes
+// succeed while the backend is saturated.
+var unlimitedPaths = sets.NewString("/healthz", "/readyz")
+
+// limitInFlight rejects requests with 503 while limit requests are being served.
+func limitInFlight(limit int) mux.MiddlewareFunc {
+	inFlight := make(chan struct{}, limit)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if unlimitedPaths.Has(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			select {
+			case inFlight <- struct{}{}:
+				defer func() { <-inFlight }()
+				next.ServeHTTP(w, r)
+			default:
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "too many requests, retry later", http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
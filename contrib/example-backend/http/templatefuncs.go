@@ -0,0 +1,82 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	htmltemplate "html/template"
+	"sort"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/version"
+
+	"github.com/kube-bind/kube-bind/contrib/example-backend/template"
+)
+
+// TemplateFuncs returns the functions available in the resources and bound templates:
+//
+//   - join joins strings with a separator, e.g. {{join .Versions ", "}}.
+//   - sortVersions sorts version names by Kubernetes version priority, e.g. v1 before
+//     v1beta1 before v1alpha1.
+//   - servedVersions returns the served version names of a CRD sorted by priority.
+//
+// Functions passed to NewHandler are added to these and take precedence.
+func TemplateFuncs() htmltemplate.FuncMap {
+	return htmltemplate.FuncMap{
+		"join":           func(elems []string, sep string) string { return strings.Join(elems, sep) },
+		"sortVersions":   sortVersions,
+		"servedVersions": servedVersions,
+	}
+}
+
+// newResourcesTemplate parses the resources template with the built-in functions
+// and the given ones.
+func newResourcesTemplate(funcs htmltemplate.FuncMap) (*htmltemplate.Template, error) {
+	return parseTemplate("resource", "resources.gohtml", funcs)
+}
+
+// newBoundTemplate parses the landing page template shown after a bind with the
+// built-in functions and the given ones.
+func newBoundTemplate(funcs htmltemplate.FuncMap) (*htmltemplate.Template, error) {
+	return parseTemplate("bound", "bound.gohtml", funcs)
+}
+
+func parseTemplate(name, file string, funcs htmltemplate.FuncMap) (*htmltemplate.Template, error) {
+	all := TemplateFuncs()
+	for fn, f := range funcs {
+		all[fn] = f
+	}
+	return htmltemplate.New(name).Funcs(all).Parse(mustRead(template.Files.ReadFile, file))
+}
+
+func sortVersions(versions []string) []string {
+	sorted := append([]string(nil), versions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return version.CompareKubeAwareVersionStrings(sorted[i], sorted[j]) > 0
+	})
+	return sorted
+}
+
+func servedVersions(crd *apiextensionsv1.CustomResourceDefinition) []string {
+	var versions []string
+	for _, v := range crd.Spec.Versions {
+		if v.Served {
+			versions = append(versions, v.Name)
+		}
+	}
+	return sortVersions(versions)
+}
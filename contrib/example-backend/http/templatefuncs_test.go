@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func TestSortVersions(t *testing.T) {
+	require.Equal(t, []string{"v2", "v1", "v1beta2", "v1beta1", "v1alpha1", "foo"}, sortVersions([]string{"v1alpha1", "foo", "v1", "v1beta1", "v2", "v1beta2"}))
+}
+
+func TestResourcesTemplateFuncs(t *testing.T) {
+	crd := newTestCRD()
+	crd.Spec.Versions = []apiextensionsv1.CustomResourceDefinitionVersion{
+		{Name: "v1alpha1", Served: true},
+		{Name: "v1", Served: true, Storage: true},
+		{Name: "v1beta1"},
+	}
+
+	tests := []struct {
+		name  string
+		funcs map[string]interface{}
+		want  string
+	}{
+		{name: "built-in helpers", want: "Versions: v1, v1alpha1"},
+		{
+			name: "provided helper",
+			funcs: map[string]interface{}{
+				"servedVersions": func(crd *apiextensionsv1.CustomResourceDefinition) []string { return []string{"latest"} },
+			},
+			want: "Versions: latest",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(t, HandlerOptions{
+				TemplateFuncs: tt.funcs,
+				CRDLister:     newTestCRDLister(t, crd),
+			})
+
+			w := httptest.NewRecorder()
+			h.handleResources(w, httptest.NewRequest(http.MethodGet, "/resources?s=abc", nil))
+			require.Equal(t, http.StatusOK, w.Code)
+			require.Contains(t, w.Body.String(), tt.want)
+		})
+	}
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// BindReviewAPIVersion and BindReviewKind identify the review posted to authorization webhooks.
+const (
+	BindReviewAPIVersion = "example-backend.kube-bind.io/v1alpha1"
+	BindReviewKind       = "BindReview"
+)
+
+// maxBindReviewResponseBytes bounds the response read from authorization webhooks.
+const maxBindReviewResponseBytes = 64 * 1024
+
+// BindReview is posted to authorization webhooks, modelled after SubjectAccessReview.
+// The webhook responds with the review with the status filled in.
+type BindReview struct {
+	APIVersion string           `json:"apiVersion"`
+	Kind       string           `json:"kind"`
+	Spec       BindReviewSpec   `json:"spec"`
+	Status     BindReviewStatus `json:"status,omitempty"`
+}
+
+// BindReviewSpec is the bind to be authorized.
+type BindReviewSpec struct {
+	Identity        string                 `json:"identity"`
+	Claims          map[string]interface{} `json:"claims,omitempty"`
+	CRD             string                 `json:"crd"`
+	Group           string                 `json:"group"`
+	Resource        string                 `json:"resource"`
+	Version         string                 `json:"version,omitempty"`
+	TargetNamespace string                 `json:"targetNamespace,omitempty"`
+	Rotate          bool                   `json:"rotate,omitempty"`
+}
+
+// BindReviewStatus is the decision of the webhook.
+type BindReviewStatus struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+type webhookAuthorizer struct {
+	url      string
+	failOpen bool
+	client   *http.Client
+}
+
+// NewWebhookAuthorizer returns an Authorizer posting a BindReview to the webhook URL.
+// If the webhook cannot be reached within the timeout or fails, binds are allowed
+// with failOpen, and fail otherwise.
+func NewWebhookAuthorizer(url string, timeout time.Duration, failOpen bool) Authorizer {
+	return &webhookAuthorizer{
+		url:      url,
+		failOpen: failOpen,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+func (a *webhookAuthorizer) Authorize(ctx context.Context, req *BindRequest) (bool, string, error) {
+	status, err := a.review(ctx, req)
+	if err != nil {
+		if a.failOpen {
+			klog.FromContext(ctx).Info("authorization webhook failed, allowing bind", "error", err)
+			return true, "", nil
+		}
+		return false, "", fmt.Errorf("authorization webhook failed: %w", err)
+	}
+	return status.Allowed, status.Reason, nil
+}
+
+func (a *webhookAuthorizer) review(ctx context.Context, req *BindRequest) (*BindReviewStatus, error) {
+	review := BindReview{
+		APIVersion: BindReviewAPIVersion,
+		Kind:       BindReviewKind,
+		Spec: BindReviewSpec{
+			Identity:        req.Identity,
+			Claims:          req.Claims,
+			Group:           req.Group,
+			Resource:        req.Resource,
+			Version:         req.Version,
+			TargetNamespace: req.TargetNamespace,
+			Rotate:          req.Rotate,
+		},
+	}
+	if req.CRD != nil {
+		review.Spec.CRD = req.CRD.Name
+	}
+	body, err := json.Marshal(review)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json")
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	bs, err := io.ReadAll(io.LimitReader(resp.Body, maxBindReviewResponseBytes))
+	if err != nil {
+		return nil, err
+	}
+	var result BindReview
+	if err := json.Unmarshal(bs, &result); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	if result.Kind != BindReviewKind {
+		return nil, fmt.Errorf("invalid response kind %q, expected %q", result.Kind, BindReviewKind)
+	}
+	return &result.Status, nil
+}
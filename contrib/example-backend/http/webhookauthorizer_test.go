@@ -0,0 +1,117 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestWebhook(t *testing.T, decide func(review *BindReview) (int, *BindReview)) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var review BindReview
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&review))
+		code, resp := decide(&review)
+		w.WriteHeader(code)
+		if resp != nil {
+			require.NoError(t, json.NewEncoder(w).Encode(resp))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWebhookAuthorizer(t *testing.T) {
+	req := &BindRequest{
+		Identity: "https://issuer/jane",
+		Claims:   map[string]interface{}{"groups": []interface{}{"dba"}},
+		CRD:      newTestCRD(),
+		Group:    "mangodb.com",
+		Resource: "mangodbs",
+		Version:  "v1",
+	}
+
+	t.Run("allow", func(t *testing.T) {
+		srv := newTestWebhook(t, func(review *BindReview) (int, *BindReview) {
+			require.Equal(t, BindReviewAPIVersion, review.APIVersion)
+			require.Equal(t, BindReviewKind, review.Kind)
+			require.Equal(t, "https://issuer/jane", review.Spec.Identity)
+			require.Equal(t, []interface{}{"dba"}, review.Spec.Claims["groups"])
+			require.Equal(t, "mangodbs.mangodb.com", review.Spec.CRD)
+			require.Equal(t, "v1", review.Spec.Version)
+			review.Status.Allowed = true
+			return http.StatusOK, review
+		})
+
+		allowed, reason, err := NewWebhookAuthorizer(srv.URL, time.Second, false).Authorize(context.Background(), req)
+		require.NoError(t, err)
+		require.True(t, allowed)
+		require.Empty(t, reason)
+	})
+
+	t.Run("deny", func(t *testing.T) {
+		srv := newTestWebhook(t, func(review *BindReview) (int, *BindReview) {
+			review.Status = BindReviewStatus{Allowed: false, Reason: "dba group required in production"}
+			return http.StatusOK, review
+		})
+
+		allowed, reason, err := NewWebhookAuthorizer(srv.URL, time.Second, true).Authorize(context.Background(), req)
+		require.NoError(t, err)
+		require.False(t, allowed)
+		require.Equal(t, "dba group required in production", reason)
+	})
+
+	failures := []struct {
+		name    string
+		handler func(review *BindReview) (int, *BindReview)
+	}{
+		{name: "server error", handler: func(review *BindReview) (int, *BindReview) {
+			return http.StatusInternalServerError, nil
+		}},
+		{name: "wrong kind", handler: func(review *BindReview) (int, *BindReview) {
+			review.Kind = "SubjectAccessReview"
+			review.Status.Allowed = true
+			return http.StatusOK, review
+		}},
+		{name: "timeout", handler: func(review *BindReview) (int, *BindReview) {
+			time.Sleep(200 * time.Millisecond)
+			review.Status.Allowed = false
+			return http.StatusOK, review
+		}},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestWebhook(t, tt.handler)
+
+			_, _, err := NewWebhookAuthorizer(srv.URL, 50*time.Millisecond, false).Authorize(context.Background(), req)
+			require.ErrorContains(t, err, "authorization webhook failed")
+
+			allowed, _, err := NewWebhookAuthorizer(srv.URL, 50*time.Millisecond, true).Authorize(context.Background(), req)
+			require.NoError(t, err)
+			require.True(t, allowed, "fail open")
+		})
+	}
+}
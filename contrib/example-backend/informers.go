@@ -0,0 +1,417 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backend
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	kubeinformers "k8s.io/client-go/informers"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	rbacv1informers "k8s.io/client-go/informers/rbac/v1"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	rbacv1listers "k8s.io/client-go/listers/rbac/v1"
+	"k8s.io/client-go/tools/cache"
+
+	bindinformers "github.com/kube-bind/kube-bind/pkg/client/informers/externalversions"
+	bindv1alpha1informers "github.com/kube-bind/kube-bind/pkg/client/informers/externalversions/kubebind/v1alpha1"
+	bindlisters "github.com/kube-bind/kube-bind/pkg/client/listers/kubebind/v1alpha1"
+)
+
+// NamespacedInformers returns the informers of namespaced objects. With informer
+// namespaces, there is one factory per namespace and the returned informers merge
+// the informers of all factories.
+type NamespacedInformers struct {
+	Namespaces []string
+	Kube       []kubeinformers.SharedInformerFactory
+	Bind       []bindinformers.SharedInformerFactory
+}
+
+// Start starts the informers requested from the factories.
+func (i NamespacedInformers) Start(stopCh <-chan struct{}) {
+	for _, f := range i.Kube {
+		f.Start(stopCh)
+	}
+	for _, f := range i.Bind {
+		f.Start(stopCh)
+	}
+}
+
+// WaitForCacheSync waits for the informers of all factories, a type being synced if
+// its informers are synced in every namespace.
+func (i NamespacedInformers) WaitForCacheSync(stopCh <-chan struct{}) map[reflect.Type]bool {
+	synced := map[reflect.Type]bool{}
+	merge := func(res map[reflect.Type]bool) {
+		for t, ok := range res {
+			if prev, found := synced[t]; found {
+				ok = ok && prev
+			}
+			synced[t] = ok
+		}
+	}
+	for _, f := range i.Kube {
+		merge(f.WaitForCacheSync(stopCh))
+	}
+	for _, f := range i.Bind {
+		merge(f.WaitForCacheSync(stopCh))
+	}
+	return synced
+}
+
+func (i NamespacedInformers) Secrets() corev1informers.SecretInformer {
+	if len(i.Kube) == 1 {
+		return i.Kube[0].Core().V1().Secrets()
+	}
+	informers := make([]cache.SharedIndexInformer, 0, len(i.Kube))
+	for _, f := range i.Kube {
+		informers = append(informers, f.Core().V1().Secrets().Informer())
+	}
+	return secretInformer{newMultiNamespaceInformer(i.Namespaces, informers)}
+}
+
+func (i NamespacedInformers) Roles() rbacv1informers.RoleInformer {
+	if len(i.Kube) == 1 {
+		return i.Kube[0].Rbac().V1().Roles()
+	}
+	informers := make([]cache.SharedIndexInformer, 0, len(i.Kube))
+	for _, f := range i.Kube {
+		informers = append(informers, f.Rbac().V1().Roles().Informer())
+	}
+	return roleInformer{newMultiNamespaceInformer(i.Namespaces, informers)}
+}
+
+func (i NamespacedInformers) RoleBindings() rbacv1informers.RoleBindingInformer {
+	if len(i.Kube) == 1 {
+		return i.Kube[0].Rbac().V1().RoleBindings()
+	}
+	informers := make([]cache.SharedIndexInformer, 0, len(i.Kube))
+	for _, f := range i.Kube {
+		informers = append(informers, f.Rbac().V1().RoleBindings().Informer())
+	}
+	return roleBindingInformer{newMultiNamespaceInformer(i.Namespaces, informers)}
+}
+
+func (i NamespacedInformers) APIServiceExports() bindv1alpha1informers.APIServiceExportInformer {
+	if len(i.Bind) == 1 {
+		return i.Bind[0].KubeBind().V1alpha1().APIServiceExports()
+	}
+	informers := make([]cache.SharedIndexInformer, 0, len(i.Bind))
+	for _, f := range i.Bind {
+		informers = append(informers, f.KubeBind().V1alpha1().APIServiceExports().Informer())
+	}
+	return serviceExportInformer{newMultiNamespaceInformer(i.Namespaces, informers)}
+}
+
+func (i NamespacedInformers) APIServiceExportResources() bindv1alpha1informers.APIServiceExportResourceInformer {
+	if len(i.Bind) == 1 {
+		return i.Bind[0].KubeBind().V1alpha1().APIServiceExportResources()
+	}
+	informers := make([]cache.SharedIndexInformer, 0, len(i.Bind))
+	for _, f := range i.Bind {
+		informers = append(informers, f.KubeBind().V1alpha1().APIServiceExportResources().Informer())
+	}
+	return serviceExportResourceInformer{newMultiNamespaceInformer(i.Namespaces, informers)}
+}
+
+func (i NamespacedInformers) APIServiceNamespaces() bindv1alpha1informers.APIServiceNamespaceInformer {
+	if len(i.Bind) == 1 {
+		return i.Bind[0].KubeBind().V1alpha1().APIServiceNamespaces()
+	}
+	informers := make([]cache.SharedIndexInformer, 0, len(i.Bind))
+	for _, f := range i.Bind {
+		informers = append(informers, f.KubeBind().V1alpha1().APIServiceNamespaces().Informer())
+	}
+	return serviceNamespaceInformer{newMultiNamespaceInformer(i.Namespaces, informers)}
+}
+
+func (i NamespacedInformers) ClusterBindings() bindv1alpha1informers.ClusterBindingInformer {
+	if len(i.Bind) == 1 {
+		return i.Bind[0].KubeBind().V1alpha1().ClusterBindings()
+	}
+	informers := make([]cache.SharedIndexInformer, 0, len(i.Bind))
+	for _, f := range i.Bind {
+		informers = append(informers, f.KubeBind().V1alpha1().ClusterBindings().Informer())
+	}
+	return clusterBindingInformer{newMultiNamespaceInformer(i.Namespaces, informers)}
+}
+
+type secretInformer struct{ informer cache.SharedIndexInformer }
+
+func (i secretInformer) Informer() cache.SharedIndexInformer { return i.informer }
+func (i secretInformer) Lister() corev1listers.SecretLister {
+	return corev1listers.NewSecretLister(i.informer.GetIndexer())
+}
+
+type roleInformer struct{ informer cache.SharedIndexInformer }
+
+func (i roleInformer) Informer() cache.SharedIndexInformer { return i.informer }
+func (i roleInformer) Lister() rbacv1listers.RoleLister {
+	return rbacv1listers.NewRoleLister(i.informer.GetIndexer())
+}
+
+type roleBindingInformer struct{ informer cache.SharedIndexInformer }
+
+func (i roleBindingInformer) Informer() cache.SharedIndexInformer { return i.informer }
+func (i roleBindingInformer) Lister() rbacv1listers.RoleBindingLister {
+	return rbacv1listers.NewRoleBindingLister(i.informer.GetIndexer())
+}
+
+type serviceExportInformer struct{ informer cache.SharedIndexInformer }
+
+func (i serviceExportInformer) Informer() cache.SharedIndexInformer { return i.informer }
+func (i serviceExportInformer) Lister() bindlisters.APIServiceExportLister {
+	return bindlisters.NewAPIServiceExportLister(i.informer.GetIndexer())
+}
+
+type serviceExportResourceInformer struct{ informer cache.SharedIndexInformer }
+
+func (i serviceExportResourceInformer) Informer() cache.SharedIndexInformer { return i.informer }
+func (i serviceExportResourceInformer) Lister() bindlisters.APIServiceExportResourceLister {
+	return bindlisters.NewAPIServiceExportResourceLister(i.informer.GetIndexer())
+}
+
+type serviceNamespaceInformer struct{ informer cache.SharedIndexInformer }
+
+func (i serviceNamespaceInformer) Informer() cache.SharedIndexInformer { return i.informer }
+func (i serviceNamespaceInformer) Lister() bindlisters.APIServiceNamespaceLister {
+	return bindlisters.NewAPIServiceNamespaceLister(i.informer.GetIndexer())
+}
+
+type clusterBindingInformer struct{ informer cache.SharedIndexInformer }
+
+func (i clusterBindingInformer) Informer() cache.SharedIndexInformer { return i.informer }
+func (i clusterBindingInformer) Lister() bindlisters.ClusterBindingLister {
+	return bindlisters.NewClusterBindingLister(i.informer.GetIndexer())
+}
+
+// multiNamespaceInformer merges informers watching one namespace each. Event handlers
+// and indexers are added to all of them, and reads go through a merged indexer.
+type multiNamespaceInformer struct {
+	namespaces []string
+	informers  []cache.SharedIndexInformer
+}
+
+var _ cache.SharedIndexInformer = &multiNamespaceInformer{}
+
+func newMultiNamespaceInformer(namespaces []string, informers []cache.SharedIndexInformer) *multiNamespaceInformer {
+	return &multiNamespaceInformer{namespaces: namespaces, informers: informers}
+}
+
+func (i *multiNamespaceInformer) AddEventHandler(handler cache.ResourceEventHandler) {
+	for _, inf := range i.informers {
+		inf.AddEventHandler(handler)
+	}
+}
+
+func (i *multiNamespaceInformer) AddEventHandlerWithResyncPeriod(handler cache.ResourceEventHandler, resyncPeriod time.Duration) {
+	for _, inf := range i.informers {
+		inf.AddEventHandlerWithResyncPeriod(handler, resyncPeriod)
+	}
+}
+
+func (i *multiNamespaceInformer) GetStore() cache.Store {
+	return i.GetIndexer()
+}
+
+// GetController returns the merged informer itself, which runs and syncs all of the
+// per-namespace informers like the controller of a single informer.
+func (i *multiNamespaceInformer) GetController() cache.Controller {
+	return i
+}
+
+func (i *multiNamespaceInformer) Run(stopCh <-chan struct{}) {
+	for _, inf := range i.informers {
+		go inf.Run(stopCh)
+	}
+	<-stopCh
+}
+
+func (i *multiNamespaceInformer) HasSynced() bool {
+	for _, inf := range i.informers {
+		if !inf.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+func (i *multiNamespaceInformer) LastSyncResourceVersion() string {
+	return "" // resource versions of different watches are not comparable.
+}
+
+func (i *multiNamespaceInformer) SetWatchErrorHandler(handler cache.WatchErrorHandler) error {
+	for _, inf := range i.informers {
+		if err := inf.SetWatchErrorHandler(handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *multiNamespaceInformer) SetTransform(handler cache.TransformFunc) error {
+	for _, inf := range i.informers {
+		if err := inf.SetTransform(handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *multiNamespaceInformer) AddIndexers(indexers cache.Indexers) error {
+	return i.GetIndexer().AddIndexers(indexers)
+}
+
+func (i *multiNamespaceInformer) GetIndexer() cache.Indexer {
+	indexers := make(map[string]cache.Indexer, len(i.informers))
+	for j, inf := range i.informers {
+		indexers[i.namespaces[j]] = inf.GetIndexer()
+	}
+	return &multiNamespaceIndexer{indexers: indexers}
+}
+
+// multiNamespaceIndexer is the read-only union of the indexers of the informers of a
+// multiNamespaceInformer, by namespace. Writes are left to the informers.
+type multiNamespaceIndexer struct {
+	indexers map[string]cache.Indexer
+}
+
+var _ cache.Indexer = &multiNamespaceIndexer{}
+
+func (i *multiNamespaceIndexer) Add(obj interface{}) error {
+	return fmt.Errorf("merged indexer is read-only")
+}
+
+func (i *multiNamespaceIndexer) Update(obj interface{}) error {
+	return fmt.Errorf("merged indexer is read-only")
+}
+
+func (i *multiNamespaceIndexer) Delete(obj interface{}) error {
+	return fmt.Errorf("merged indexer is read-only")
+}
+
+func (i *multiNamespaceIndexer) Replace(list []interface{}, resourceVersion string) error {
+	return fmt.Errorf("merged indexer is read-only")
+}
+
+func (i *multiNamespaceIndexer) Resync() error {
+	return nil
+}
+
+func (i *multiNamespaceIndexer) List() []interface{} {
+	var ret []interface{}
+	for _, indexer := range i.indexers {
+		ret = append(ret, indexer.List()...)
+	}
+	return ret
+}
+
+func (i *multiNamespaceIndexer) ListKeys() []string {
+	var ret []string
+	for _, indexer := range i.indexers {
+		ret = append(ret, indexer.ListKeys()...)
+	}
+	return ret
+}
+
+func (i *multiNamespaceIndexer) Get(obj interface{}) (interface{}, bool, error) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return nil, false, err
+	}
+	return i.GetByKey(key)
+}
+
+func (i *multiNamespaceIndexer) GetByKey(key string) (interface{}, bool, error) {
+	ns, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+	indexer, found := i.indexers[ns]
+	if !found {
+		return nil, false, nil // not watched
+	}
+	return indexer.GetByKey(key)
+}
+
+func (i *multiNamespaceIndexer) Index(indexName string, obj interface{}) ([]interface{}, error) {
+	var ret []interface{}
+	for _, indexer := range i.indexers {
+		objs, err := indexer.Index(indexName, obj)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, objs...)
+	}
+	return ret, nil
+}
+
+func (i *multiNamespaceIndexer) IndexKeys(indexName, indexedValue string) ([]string, error) {
+	var ret []string
+	for _, indexer := range i.indexers {
+		keys, err := indexer.IndexKeys(indexName, indexedValue)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, keys...)
+	}
+	return ret, nil
+}
+
+func (i *multiNamespaceIndexer) ListIndexFuncValues(indexName string) []string {
+	values := map[string]bool{}
+	for _, indexer := range i.indexers {
+		for _, v := range indexer.ListIndexFuncValues(indexName) {
+			values[v] = true
+		}
+	}
+	ret := make([]string, 0, len(values))
+	for v := range values {
+		ret = append(ret, v)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (i *multiNamespaceIndexer) ByIndex(indexName, indexedValue string) ([]interface{}, error) {
+	var ret []interface{}
+	for _, indexer := range i.indexers {
+		objs, err := indexer.ByIndex(indexName, indexedValue)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, objs...)
+	}
+	return ret, nil
+}
+
+func (i *multiNamespaceIndexer) GetIndexers() cache.Indexers {
+	for _, indexer := range i.indexers {
+		return indexer.GetIndexers() // all have the same indexers.
+	}
+	return cache.Indexers{}
+}
+
+func (i *multiNamespaceIndexer) AddIndexers(newIndexers cache.Indexers) error {
+	for _, indexer := range i.indexers {
+		if err := indexer.AddIndexers(newIndexers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
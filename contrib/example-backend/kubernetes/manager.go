@@ -18,14 +18,20 @@ package kubernetes
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	corev1informers "k8s.io/client-go/informers/core/v1"
 	kubeclient "k8s.io/client-go/kubernetes"
 	corev1listers "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"k8s.io/klog/v2"
 
 	kuberesources "github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes/resources"
@@ -35,9 +41,54 @@ import (
 	"github.com/kube-bind/kube-bind/pkg/indexers"
 )
 
+const (
+	// ServiceAccountKubeconfigMode mints a kubeconfig for a service account per consumer namespace.
+	ServiceAccountKubeconfigMode = "serviceaccount"
+	// ImpersonationKubeconfigMode mints a kubeconfig for a service account per consumer
+	// namespace that may only impersonate a user per consumer.
+	ImpersonationKubeconfigMode = "impersonation"
+
+	// ImpersonatedUserPrefix is prepended to the identity to form the impersonated
+	// user name, such that it cannot collide with other users of the cluster.
+	ImpersonatedUserPrefix = "kube-bind:"
+
+	// TokenKubeconfigFormat returns kubeconfigs with embedded credentials.
+	TokenKubeconfigFormat = "token"
+	// ExecKubeconfigFormat returns kubeconfigs getting their credentials from the
+	// configured exec credential plugin.
+	ExecKubeconfigFormat = "exec"
+)
+
+// ErrRotationNotSupported is returned when the credentials of the kubeconfig mode cannot be rotated.
+var ErrRotationNotSupported = errors.New("credential rotation is not supported for impersonating kubeconfigs")
+
+// ErrExecKubeconfigNotConfigured is returned for exec kubeconfigs without an exec credential plugin.
+var ErrExecKubeconfigNotConfigured = errors.New("exec kubeconfigs require an exec credential plugin to be configured")
+
+// TargetNamespaceConflictError is returned when a target namespace is requested for an
+// identity that is already bound to another namespace.
+type TargetNamespaceConflictError struct {
+	Identity  string
+	Namespace string
+}
+
+func (e *TargetNamespaceConflictError) Error() string {
+	return fmt.Sprintf("identity %q is already bound to namespace %q", e.Identity, e.Namespace)
+}
+
 type Manager struct {
 	namespacePrefix    string
 	providerPrettyName string
+	kubeconfigMode     string
+	ownerReferences    bool
+
+	// tokenTTL makes service account kubeconfigs use bound tokens expiring after it,
+	// instead of legacy token secrets. Zero uses legacy token secrets.
+	tokenTTL time.Duration
+
+	// execConfig is the exec credential plugin of kubeconfigs in ExecKubeconfigFormat.
+	// Nil disables the format.
+	execConfig *clientcmdapi.ExecConfig
 
 	clusterConfig *rest.Config
 
@@ -52,7 +103,10 @@ type Manager struct {
 }
 
 func NewKubernetesManager(
-	namespacePrefix, providerPrettyName string,
+	namespacePrefix, providerPrettyName, kubeconfigMode string,
+	ownerReferences bool,
+	tokenTTL time.Duration,
+	execConfig *clientcmdapi.ExecConfig,
 	config *rest.Config,
 	namespaceInformer corev1informers.NamespaceInformer,
 	exportInformer bindinformers.APIServiceExportInformer,
@@ -69,9 +123,29 @@ func NewKubernetesManager(
 		return nil, err
 	}
 
+	return NewKubernetesManagerForClients(namespacePrefix, providerPrettyName, kubeconfigMode, ownerReferences, tokenTTL, execConfig, config, kubeClient, bindClient, namespaceInformer, exportInformer), nil
+}
+
+// NewKubernetesManagerForClients is NewKubernetesManager with the given clients. The
+// config is only embedded into kubeconfigs.
+func NewKubernetesManagerForClients(
+	namespacePrefix, providerPrettyName, kubeconfigMode string,
+	ownerReferences bool,
+	tokenTTL time.Duration,
+	execConfig *clientcmdapi.ExecConfig,
+	config *rest.Config,
+	kubeClient kubeclient.Interface,
+	bindClient bindclient.Interface,
+	namespaceInformer corev1informers.NamespaceInformer,
+	exportInformer bindinformers.APIServiceExportInformer,
+) *Manager {
 	m := &Manager{
 		namespacePrefix:    namespacePrefix,
 		providerPrettyName: providerPrettyName,
+		kubeconfigMode:     kubeconfigMode,
+		ownerReferences:    ownerReferences,
+		tokenTTL:           tokenTTL,
+		execConfig:         execConfig,
 
 		clusterConfig: config,
 
@@ -89,66 +163,284 @@ func NewKubernetesManager(
 		NamespacesByIdentity: IndexNamespacesByIdentity,
 	})
 
-	indexers.AddIfNotPresentOrDie(m.namespaceIndexer, cache.Indexers{
+	indexers.AddIfNotPresentOrDie(m.exportIndexer, cache.Indexers{
 		indexers.ServiceExportByServiceExportResource: indexers.IndexServiceExportByServiceExportResource,
 	})
 
-	return m, nil
+	return m
+}
+
+// MigrateIdentity moves the namespace of legacyIdentity over to identity, unless
+// identity already has one. Namespaces of backends predating the identity template
+// are keyed by the sub claim alone, and would otherwise be orphaned.
+func (m *Manager) MigrateIdentity(ctx context.Context, legacyIdentity, identity string) error {
+	if legacyIdentity == "" || legacyIdentity == identity {
+		return nil
+	}
+	current, err := m.findNamespace(ctx, identity)
+	if err != nil || current != nil {
+		return err
+	}
+	legacy, err := m.findNamespace(ctx, legacyIdentity)
+	if err != nil || legacy == nil {
+		return err
+	}
+
+	klog.FromContext(ctx).Info("Migrating namespace to the new identity", "namespace", legacy.Name, "legacyIdentity", legacyIdentity, "identity", identity)
+	return kuberesources.SetNamespaceIdentity(ctx, m.kubeClient, legacy.Name, identity)
 }
 
-func (m *Manager) HandleResources(ctx context.Context, identity, resource, group string) ([]byte, error) {
-	logger := klog.FromContext(ctx).WithValues("identity", identity, "resource", resource, "group", group)
+// RotateCredentials invalidates the service account token minted for the identity.
+// A following HandleResources mints a new one. Bound tokens are invalidated by
+// recreating the service account.
+func (m *Manager) RotateCredentials(ctx context.Context, identity string) error {
+	logger := klog.FromContext(ctx).WithValues("identity", identity)
+
+	if m.kubeconfigMode == ImpersonationKubeconfigMode {
+		return ErrRotationNotSupported
+	}
+
+	// the informer might not know a namespace created by a bind just before.
+	nsObj, err := m.findNamespace(ctx, identity)
+	if err != nil {
+		return err
+	}
+	if nsObj == nil {
+		return nil // nothing minted yet
+	}
+	ns := nsObj.Name
+
+	logger.Info("Rotating service account token", "namespace", ns)
+	if m.tokenTTL > 0 {
+		return kuberesources.DeleteServiceAccount(ctx, m.kubeClient, ns)
+	}
+	return kuberesources.DeleteSASecret(ctx, m.kubeClient, ns, kuberesources.ClusterAdminName)
+}
+
+// SupportsKubeconfigFormat returns whether HandleResources can return kubeconfigs in
+// the format. Empty is TokenKubeconfigFormat.
+func (m *Manager) SupportsKubeconfigFormat(format string) bool {
+	switch format {
+	case "", TokenKubeconfigFormat:
+		return true
+	case ExecKubeconfigFormat:
+		return m.execConfig != nil
+	default:
+		return false
+	}
+}
+
+// HandleResources provisions the namespace of the identity and the resources needed
+// to bind the given resource, and returns the kubeconfig for it in the given format,
+// empty meaning TokenKubeconfigFormat. If targetNamespace is non-empty, it is used
+// instead of a generated namespace name. The labels are set on newly created
+// namespaces. With owner references enabled, the provisioned objects are owned by the
+// namespace and garbage collected with it.
+//
+// Every step creates or adopts its object, and objects are only created after those
+// they refer to. Hence, a retry after a partial failure completes the provisioning.
+func (m *Manager) HandleResources(ctx context.Context, identity string, labels map[string]string, resource, group, version, targetNamespace, format string) ([]byte, error) {
+	logger := klog.FromContext(ctx).WithValues("identity", identity, "resource", resource, "group", group, "version", version)
 	ctx = klog.NewContext(ctx, logger)
 
+	// fail before provisioning anything.
+	if format == ExecKubeconfigFormat && m.execConfig == nil {
+		return nil, ErrExecKubeconfigNotConfigured
+	} else if !m.SupportsKubeconfigFormat(format) {
+		return nil, fmt.Errorf("unknown kubeconfig format %q", format)
+	}
+
 	// try to find an existing namespace by annotation, or create a new one.
-	nss, err := m.namespaceIndexer.ByIndex(NamespacesByIdentity, identity)
+	nsObj, err := m.findNamespace(ctx, identity)
 	if err != nil {
 		return nil, err
 	}
-	if len(nss) > 1 {
-		logger.Error(fmt.Errorf("found multiple namespaces for identity %q", identity), "found multiple namespaces for identity")
-		return nil, fmt.Errorf("found multiple namespaces for identity %q", identity)
-	}
-	var ns string
-	if len(nss) == 1 {
-		ns = nss[0].(*corev1.Namespace).Name
-	} else {
-		nsObj, err := kuberesources.CreateNamespace(ctx, m.kubeClient, m.namespacePrefix, identity)
+	if nsObj != nil {
+		if targetNamespace != "" && targetNamespace != nsObj.Name {
+			return nil, &TargetNamespaceConflictError{Identity: identity, Namespace: nsObj.Name}
+		}
+		if err := kuberesources.TouchNamespace(ctx, m.kubeClient, nsObj.Name); err != nil {
+			return nil, err
+		}
+	} else if targetNamespace != "" {
+		nsObj, err = kuberesources.CreateNamedNamespace(ctx, m.kubeClient, targetNamespace, identity, labels)
+		if err != nil {
+			return nil, err
+		}
 		logger.Info("Created namespace", "namespace", nsObj.Name)
+	} else {
+		nsObj, err = kuberesources.CreateNamespace(ctx, m.kubeClient, m.namespacePrefix, identity, labels)
 		if err != nil {
 			return nil, err
 		}
-		ns = nsObj.Name
+		logger.Info("Created namespace", "namespace", nsObj.Name)
 	}
+	ns := nsObj.Name
 	logger = logger.WithValues("namespace", ns)
 	ctx = klog.NewContext(ctx, logger)
 
-	sa, err := kuberesources.CreateServiceAccount(ctx, m.kubeClient, ns)
-	if err != nil {
+	var owners []metav1.OwnerReference
+	if m.ownerReferences {
+		owners = kuberesources.NamespaceOwnerReferences(nsObj)
+	}
+
+	var kfgSecret *corev1.Secret
+	switch m.kubeconfigMode {
+	case ImpersonationKubeconfigMode:
+		user := ImpersonatedUserPrefix + identity
+		sa, err := kuberesources.CreateServiceAccount(ctx, m.kubeClient, ns, owners)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := kuberesources.CreateImpersonatorClusterRoleBinding(ctx, m.kubeClient, ns, user, owners); err != nil {
+			return nil, err
+		}
+
+		if err := kuberesources.CreateImpersonatedUserAdminClusterRoleBinding(ctx, m.kubeClient, ns, user, owners); err != nil {
+			return nil, err
+		}
+
+		saSecret, err := kuberesources.CreateSASecret(ctx, m.kubeClient, ns, sa.Name, owners)
+		if err != nil {
+			return nil, err
+		}
+
+		kfgSecret, err = kuberesources.GenerateImpersonatingKubeconfig(ctx, m.kubeClient, m.clusterConfig, ns, saSecret.Name, user, owners)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		sa, err := kuberesources.CreateServiceAccount(ctx, m.kubeClient, ns, owners)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := kuberesources.CreateAdminClusterRoleBinding(ctx, m.kubeClient, ns, owners); err != nil {
+			return nil, err
+		}
+
+		if m.tokenTTL > 0 {
+			kfgSecret, err = kuberesources.GenerateBoundTokenKubeconfig(ctx, m.kubeClient, m.clusterConfig, ns, sa.Name, m.tokenTTL, owners)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+
+		saSecret, err := kuberesources.CreateSASecret(ctx, m.kubeClient, ns, sa.Name, owners)
+		if err != nil {
+			return nil, err
+		}
+
+		kfgSecret, err = kuberesources.GenerateKubeconfig(ctx, m.kubeClient, m.clusterConfig, ns, saSecret.Name, owners)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := kuberesources.CreateClusterBinding(ctx, m.bindClient, ns, kfgSecret.Name, m.providerPrettyName, owners); err != nil {
 		return nil, err
 	}
 
-	if err := kuberesources.CreateAdminClusterRoleBinding(ctx, m.kubeClient, ns); err != nil {
+	if err := kuberesources.CreateAPIServiceExport(ctx, m.bindClient, m.exportIndexer, ns, resource, group, version, owners); err != nil {
+		return nil, err
+	}
+
+	// only the returned kubeconfig is rewritten, the secret keeps the embedded credentials.
+	if format == ExecKubeconfigFormat {
+		return kuberesources.ExecKubeconfig(kfgSecret.Data["kubeconfig"], m.execConfig)
+	}
+	return kfgSecret.Data["kubeconfig"], nil
+}
+
+// ExportedResources returns the names of the APIServiceExports in the namespace of the
+// identity. The exports are listed from the API server, such that binds that have
+// just finished are counted.
+func (m *Manager) ExportedResources(ctx context.Context, identity string) ([]string, error) {
+	nsObj, err := m.findNamespace(ctx, identity)
+	if err != nil {
 		return nil, err
 	}
+	if nsObj == nil {
+		return nil, nil
+	}
 
-	saSecret, err := kuberesources.CreateSASecret(ctx, m.kubeClient, ns, sa.Name)
+	exports, err := m.bindClient.KubeBindV1alpha1().APIServiceExports(nsObj.Name).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
+	names := make([]string, 0, len(exports.Items))
+	for _, export := range exports.Items {
+		names = append(names, export.Name)
+	}
+	return names, nil
+}
+
+// Kubeconfig returns the kubeconfig minted for the identity by HandleResources in the
+// given format, or nil if there is none yet. It never provisions anything.
+func (m *Manager) Kubeconfig(ctx context.Context, identity, format string) ([]byte, error) {
+	if format == ExecKubeconfigFormat && m.execConfig == nil {
+		return nil, ErrExecKubeconfigNotConfigured
+	} else if !m.SupportsKubeconfigFormat(format) {
+		return nil, fmt.Errorf("unknown kubeconfig format %q", format)
+	}
 
-	kfgSecret, err := kuberesources.GenerateKubeconfig(ctx, m.kubeClient, m.clusterConfig, ns, saSecret.Name)
+	nsObj, err := m.findNamespace(ctx, identity)
 	if err != nil {
 		return nil, err
 	}
+	if nsObj == nil {
+		return nil, nil
+	}
 
-	if err := kuberesources.CreateClusterBinding(ctx, m.bindClient, ns, kfgSecret.Name, m.providerPrettyName); err != nil {
+	secret, err := m.kubeClient.CoreV1().Secrets(nsObj.Name).Get(ctx, kuberesources.KubeconfigSecretName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
 		return nil, err
 	}
+	if format == ExecKubeconfigFormat {
+		return kuberesources.ExecKubeconfig(secret.Data["kubeconfig"], m.execConfig)
+	}
+	return secret.Data["kubeconfig"], nil
+}
 
-	if err := kuberesources.CreateAPIServiceExport(ctx, m.bindClient, m.exportIndexer, ns, resource, group); err != nil {
+// findNamespace returns the namespace of the identity, or nil if there is none yet.
+// The informer might not have seen the namespace created by a previous, failed
+// attempt yet. Hence, a miss is double checked against the API server by the identity
+// hash label, in order not to create a second namespace with another generated name.
+// Namespaces of older backends without the label are found through the informer.
+func (m *Manager) findNamespace(ctx context.Context, identity string) (*corev1.Namespace, error) {
+	objs, err := m.namespaceIndexer.ByIndex(NamespacesByIdentity, identity)
+	if err != nil {
 		return nil, err
 	}
+	nss := make([]*corev1.Namespace, 0, len(objs))
+	for _, obj := range objs {
+		nss = append(nss, obj.(*corev1.Namespace))
+	}
+	if len(nss) == 0 {
+		list, err := m.kubeClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(labels.Set{kuberesources.IdentityHashLabelKey: kuberesources.IdentityHash(identity)}).String(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			if list.Items[i].Annotations[kuberesources.IdentityAnnotationKey] == identity {
+				nss = append(nss, &list.Items[i])
+			}
+		}
+	}
 
-	return kfgSecret.Data["kubeconfig"], nil
+	switch len(nss) {
+	case 0:
+		return nil, nil
+	case 1:
+		return nss[0], nil
+	default:
+		klog.FromContext(ctx).Error(fmt.Errorf("found multiple namespaces for identity %q", identity), "found multiple namespaces for identity")
+		return nil, fmt.Errorf("found multiple namespaces for identity %q", identity)
+	}
 }
@@ -0,0 +1,234 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	kuberesources "github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes/resources"
+	bindfake "github.com/kube-bind/kube-bind/pkg/client/clientset/versioned/fake"
+	"github.com/kube-bind/kube-bind/pkg/indexers"
+)
+
+func TestHandleResourcesRetryConverges(t *testing.T) {
+	tests := []struct {
+		name           string
+		kubeconfigMode string
+		failOn         string
+	}{
+		{name: "service account mode, failing service account", kubeconfigMode: ServiceAccountKubeconfigMode, failOn: "serviceaccounts"},
+		{name: "service account mode, failing cluster role binding", kubeconfigMode: ServiceAccountKubeconfigMode, failOn: "clusterrolebindings"},
+		{name: "impersonation mode, failing cluster role binding", kubeconfigMode: ImpersonationKubeconfigMode, failOn: "clusterrolebindings"},
+		{name: "impersonation mode, failing kubeconfig", kubeconfigMode: ImpersonationKubeconfigMode, failOn: "secrets"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client := fake.NewSimpleClientset()
+			bindClient := bindfake.NewSimpleClientset()
+
+			client.PrependReactor("create", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				switch obj := action.(clienttesting.CreateAction).GetObject().(type) {
+				case *corev1.Namespace:
+					// the fake clientset does not implement generateName.
+					if obj.Name == "" {
+						obj.Name = obj.GenerateName + rand.String(5)
+					}
+				case *corev1.Secret:
+					// simulates the token controller populating the service account token secret.
+					if obj.Type == kuberesources.ServiceAccountTokenType {
+						obj.Data = map[string][]byte{"token": []byte("token"), "ca.crt": []byte("ca")}
+					}
+				}
+				return false, nil, nil
+			})
+			failed := false
+			client.PrependReactor("create", tt.failOn, func(action clienttesting.Action) (bool, runtime.Object, error) {
+				if failed {
+					return false, nil, nil
+				}
+				failed = true
+				return true, nil, errors.New("injected failure")
+			})
+
+			// the informers never catch up, i.e. every attempt sees an empty cache.
+			m := &Manager{
+				namespacePrefix:    "cluster",
+				providerPrettyName: "Example Backend",
+				kubeconfigMode:     tt.kubeconfigMode,
+				clusterConfig:      &rest.Config{Host: "https://provider.example.com", BearerToken: "backend-token"},
+				kubeClient:         client,
+				bindClient:         bindClient,
+				namespaceIndexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+					NamespacesByIdentity: IndexNamespacesByIdentity,
+				}),
+				exportIndexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+					indexers.ServiceExportByServiceExportResource: indexers.IndexServiceExportByServiceExportResource,
+				}),
+			}
+
+			none, err := m.Kubeconfig(ctx, "jane", "")
+			require.NoError(t, err)
+			require.Nil(t, none, "nothing is minted before the first bind")
+
+			_, err = m.HandleResources(ctx, "jane", nil, "mangodbs", "mangodb.com", "", "", "")
+			require.ErrorContains(t, err, "injected failure")
+
+			kfg, err := m.HandleResources(ctx, "jane", nil, "mangodbs", "mangodb.com", "", "", "")
+			require.NoError(t, err)
+			require.NotEmpty(t, kfg)
+
+			// a further retry is a no-op.
+			again, err := m.HandleResources(ctx, "jane", nil, "mangodbs", "mangodb.com", "", "", "")
+			require.NoError(t, err)
+			require.Equal(t, kfg, again)
+			minted, err := m.Kubeconfig(ctx, "jane", "")
+			require.NoError(t, err)
+			require.Equal(t, kfg, minted)
+
+			_, err = m.HandleResources(ctx, "jane", nil, "mangodbs", "mangodb.com", "", "", ExecKubeconfigFormat)
+			require.ErrorIs(t, err, ErrExecKubeconfigNotConfigured)
+			_, err = m.Kubeconfig(ctx, "jane", ExecKubeconfigFormat)
+			require.ErrorIs(t, err, ErrExecKubeconfigNotConfigured)
+			m.execConfig = &clientcmdapi.ExecConfig{APIVersion: "client.authentication.k8s.io/v1", Command: "kube-bind-credentials"}
+			require.True(t, m.SupportsKubeconfigFormat(ExecKubeconfigFormat))
+			execKfg, err := m.HandleResources(ctx, "jane", nil, "mangodbs", "mangodb.com", "", "", ExecKubeconfigFormat)
+			require.NoError(t, err)
+			cfg, err := clientcmd.Load(execKfg)
+			require.NoError(t, err)
+			authInfo := cfg.AuthInfos[cfg.Contexts[cfg.CurrentContext].AuthInfo]
+			require.Empty(t, authInfo.Token)
+			require.Equal(t, "kube-bind-credentials", authInfo.Exec.Command)
+			minted, err = m.Kubeconfig(ctx, "jane", "")
+			require.NoError(t, err)
+			require.Equal(t, kfg, minted, "the stored kubeconfig keeps its token")
+			execMinted, err := m.Kubeconfig(ctx, "jane", ExecKubeconfigFormat)
+			require.NoError(t, err)
+			require.Equal(t, execKfg, execMinted)
+
+			nss, err := client.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+			require.NoError(t, err)
+			require.Len(t, nss.Items, 1, "retries must not create another namespace")
+			ns := nss.Items[0].Name
+
+			_, err = client.RbacV1().ClusterRoleBindings().Get(ctx, kuberesources.AdminClusterRoleBindingName(ns), metav1.GetOptions{})
+			require.NoError(t, err)
+			_, err = client.CoreV1().Secrets(ns).Get(ctx, "kubeconfig", metav1.GetOptions{})
+			require.NoError(t, err)
+			cb, err := bindClient.KubeBindV1alpha1().ClusterBindings(ns).Get(ctx, kuberesources.ClusterBindingName, metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, "kubeconfig", cb.Spec.KubeconfigSecretRef.Name)
+			_, err = bindClient.KubeBindV1alpha1().APIServiceExports(ns).Get(ctx, "mangodbs.mangodb.com", metav1.GetOptions{})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestMigrateIdentity(t *testing.T) {
+	ctx := context.Background()
+	namespace := func(name, identity string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: map[string]string{kuberesources.IdentityAnnotationKey: identity}}}
+	}
+	// the namespaces are seen by the informer, but without the identity hash label
+	// of namespaces created by older backends.
+	newManager := func(objs ...runtime.Object) *Manager {
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+			NamespacesByIdentity: IndexNamespacesByIdentity,
+		})
+		for _, obj := range objs {
+			require.NoError(t, indexer.Add(obj))
+		}
+		return &Manager{
+			kubeClient:       fake.NewSimpleClientset(objs...),
+			namespaceIndexer: indexer,
+		}
+	}
+	identityOf := func(m *Manager, name string) string {
+		ns, err := m.kubeClient.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		require.NoError(t, err)
+		return ns.Annotations[kuberesources.IdentityAnnotationKey]
+	}
+
+	t.Run("legacy namespace", func(t *testing.T) {
+		m := newManager(namespace("cluster-abc", "jane"))
+		require.NoError(t, m.MigrateIdentity(ctx, "jane", "https://issuer.example.com/jane"))
+		require.Equal(t, "https://issuer.example.com/jane", identityOf(m, "cluster-abc"))
+
+		ns, err := m.findNamespace(ctx, "https://issuer.example.com/jane")
+		require.NoError(t, err)
+		require.NotNil(t, ns)
+		require.Equal(t, "cluster-abc", ns.Name, "the existing namespace must be reused, also before the informer sees the migration")
+	})
+
+	t.Run("already migrated", func(t *testing.T) {
+		m := newManager(namespace("cluster-abc", "jane"), namespace("cluster-def", "https://issuer.example.com/jane"))
+		require.NoError(t, m.MigrateIdentity(ctx, "jane", "https://issuer.example.com/jane"))
+		require.Equal(t, "jane", identityOf(m, "cluster-abc"), "a namespace of the new identity takes precedence")
+	})
+
+	t.Run("nothing bound", func(t *testing.T) {
+		m := newManager()
+		require.NoError(t, m.MigrateIdentity(ctx, "jane", "https://issuer.example.com/jane"))
+	})
+}
+
+func TestFindNamespaceNotYetInformed(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	m := &Manager{
+		kubeClient: client,
+		namespaceIndexer: cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+			NamespacesByIdentity: IndexNamespacesByIdentity,
+		}),
+	}
+
+	created, err := kuberesources.CreateNamedNamespace(ctx, client, "cluster-abc", "jane", nil)
+	require.NoError(t, err)
+	_, err = kuberesources.CreateNamedNamespace(ctx, client, "cluster-def", "joe", nil)
+	require.NoError(t, err)
+
+	client.ClearActions()
+	ns, err := m.findNamespace(ctx, "jane")
+	require.NoError(t, err)
+	require.NotNil(t, ns)
+	require.Equal(t, created.Name, ns.Name)
+
+	// only the namespaces of the identity are listed.
+	require.Len(t, client.Actions(), 1)
+	list, ok := client.Actions()[0].(clienttesting.ListAction)
+	require.True(t, ok)
+	require.Equal(t, kuberesources.IdentityHashLabelKey+"="+kuberesources.IdentityHash("jane"), list.GetListRestrictions().Labels.String())
+
+	ns, err = m.findNamespace(ctx, "jim")
+	require.NoError(t, err)
+	require.Nil(t, ns)
+}
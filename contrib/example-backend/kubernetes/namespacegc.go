@@ -0,0 +1,151 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	kubeclient "k8s.io/client-go/kubernetes"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+
+	kuberesources "github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes/resources"
+)
+
+// NamespaceGC deletes consumer namespaces that have not seen a bind for longer
+// than the configured TTL.
+type NamespaceGC struct {
+	ttl    time.Duration
+	dryRun bool
+
+	kubeClient      kubeclient.Interface
+	namespaceLister corev1listers.NamespaceLister
+}
+
+func NewNamespaceGC(ttl time.Duration, dryRun bool, kubeClient kubeclient.Interface, namespaceLister corev1listers.NamespaceLister) *NamespaceGC {
+	return &NamespaceGC{
+		ttl:             ttl,
+		dryRun:          dryRun,
+		kubeClient:      kubeClient,
+		namespaceLister: namespaceLister,
+	}
+}
+
+// Start runs the garbage collection every interval until ctx is done.
+func (gc *NamespaceGC) Start(ctx context.Context, interval time.Duration) {
+	logger := klog.FromContext(ctx).WithValues("component", "namespace-gc", "ttl", gc.ttl, "dryRun", gc.dryRun)
+	ctx = klog.NewContext(ctx, logger)
+
+	logger.Info("Starting namespace garbage collection")
+	defer logger.Info("Shutting down namespace garbage collection")
+
+	wait.UntilWithContext(ctx, gc.collect, interval)
+}
+
+func (gc *NamespaceGC) collect(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+
+	nss, err := gc.namespaceLister.List(labels.Everything())
+	if err != nil {
+		logger.Error(err, "failed to list namespaces")
+		return
+	}
+
+	// namespaces of backends predating the last bind annotation start their TTL now.
+	if !gc.dryRun {
+		for _, ns := range unstampedNamespaces(nss) {
+			logger.V(2).Info("Recording last bind of namespace without one", "namespace", ns.Name)
+			if err := kuberesources.TouchNamespace(ctx, gc.kubeClient, ns.Name); err != nil && !errors.IsNotFound(err) {
+				logger.Error(err, "failed to record last bind of namespace", "namespace", ns.Name)
+			}
+		}
+	}
+
+	for _, ns := range expiredNamespaces(nss, time.Now(), gc.ttl) {
+		if gc.dryRun {
+			logger.Info("Would delete expired namespace (dry-run)", "namespace", ns.Name, "identity", ns.Annotations[kuberesources.IdentityAnnotationKey])
+			continue
+		}
+
+		logger.Info("Deleting expired namespace", "namespace", ns.Name, "identity", ns.Annotations[kuberesources.IdentityAnnotationKey])
+		if err := gc.kubeClient.CoreV1().Namespaces().Delete(ctx, ns.Name, metav1.DeleteOptions{
+			Preconditions: &metav1.Preconditions{UID: &ns.UID},
+		}); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "failed to delete expired namespace", "namespace", ns.Name)
+			continue
+		}
+
+		// the cluster-scoped RBAC is only garbage collected with the namespace if owner references are enabled.
+		if err := gc.kubeClient.RbacV1().ClusterRoleBindings().Delete(ctx, kuberesources.AdminClusterRoleBindingName(ns.Name), metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "failed to delete ClusterRoleBinding of expired namespace", "namespace", ns.Name)
+		}
+		if err := gc.kubeClient.RbacV1().ClusterRoleBindings().Delete(ctx, kuberesources.ImpersonatorName(ns.Name), metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "failed to delete impersonator ClusterRoleBinding of expired namespace", "namespace", ns.Name)
+		}
+		if err := gc.kubeClient.RbacV1().ClusterRoles().Delete(ctx, kuberesources.ImpersonatorName(ns.Name), metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "failed to delete impersonator ClusterRole of expired namespace", "namespace", ns.Name)
+		}
+	}
+}
+
+// expiredNamespaces returns the consumer namespaces whose last bind is older than ttl.
+// Namespaces without a last bind annotation are kept, their last bind is unknown.
+func expiredNamespaces(nss []*corev1.Namespace, now time.Time, ttl time.Duration) []*corev1.Namespace {
+	var expired []*corev1.Namespace
+	for _, ns := range nss {
+		if _, found := ns.Annotations[kuberesources.IdentityAnnotationKey]; !found {
+			continue // not a consumer namespace
+		}
+		if ns.DeletionTimestamp != nil {
+			continue
+		}
+
+		value, found := ns.Annotations[kuberesources.LastBindAnnotationKey]
+		if !found {
+			continue
+		}
+		lastBind, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			continue // be conservative and keep namespaces we cannot judge
+		}
+
+		if now.Sub(lastBind) > ttl {
+			expired = append(expired, ns)
+		}
+	}
+	return expired
+}
+
+// unstampedNamespaces returns the consumer namespaces without a last bind annotation.
+func unstampedNamespaces(nss []*corev1.Namespace) []*corev1.Namespace {
+	var unstamped []*corev1.Namespace
+	for _, ns := range nss {
+		if _, found := ns.Annotations[kuberesources.IdentityAnnotationKey]; !found || ns.DeletionTimestamp != nil {
+			continue
+		}
+		if _, found := ns.Annotations[kuberesources.LastBindAnnotationKey]; !found {
+			unstamped = append(unstamped, ns)
+		}
+	}
+	return unstamped
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kubernetes
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+
+	kuberesources "github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes/resources"
+)
+
+func TestExpiredNamespaces(t *testing.T) {
+	now := time.Date(2022, time.October, 1, 12, 0, 0, 0, time.UTC)
+	ttl := 24 * time.Hour
+
+	namespace := func(name string, created time.Time, annotations map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(created),
+				Annotations:       annotations,
+			},
+		}
+	}
+	lastBind := func(t time.Time) map[string]string {
+		return map[string]string{
+			kuberesources.IdentityAnnotationKey: "id",
+			kuberesources.LastBindAnnotationKey: t.Format(time.RFC3339),
+		}
+	}
+
+	nss := []*corev1.Namespace{
+		namespace("old", now.Add(-72*time.Hour), lastBind(now.Add(-48*time.Hour))),
+		namespace("recent", now.Add(-72*time.Hour), lastBind(now.Add(-time.Hour))),
+		namespace("old-without-last-bind", now.Add(-48*time.Hour), map[string]string{kuberesources.IdentityAnnotationKey: "id"}),
+		namespace("recent-without-last-bind", now.Add(-time.Hour), map[string]string{kuberesources.IdentityAnnotationKey: "id"}),
+		namespace("unparsable", now.Add(-72*time.Hour), map[string]string{
+			kuberesources.IdentityAnnotationKey: "id",
+			kuberesources.LastBindAnnotationKey: "yesterday",
+		}),
+		namespace("not-a-consumer", now.Add(-72*time.Hour), nil),
+	}
+
+	var names []string
+	for _, ns := range expiredNamespaces(nss, now, ttl) {
+		names = append(names, ns.Name)
+	}
+	require.Equal(t, []string{"old"}, names, "namespaces without a last bind must not be deleted")
+
+	names = nil
+	for _, ns := range unstampedNamespaces(nss) {
+		names = append(names, ns.Name)
+	}
+	require.Equal(t, []string{"old-without-last-bind", "recent-without-last-bind"}, names)
+}
+
+func TestCollectStampsNamespacesWithoutLastBind(t *testing.T) {
+	ctx := context.Background()
+	legacy := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:              "cluster-abc",
+		CreationTimestamp: metav1.NewTime(time.Now().Add(-72 * time.Hour)),
+		Annotations:       map[string]string{kuberesources.IdentityAnnotationKey: "id"},
+	}}
+	client := fake.NewSimpleClientset(legacy)
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	require.NoError(t, indexer.Add(legacy))
+	gc := NewNamespaceGC(24*time.Hour, false, client, corev1listers.NewNamespaceLister(indexer))
+
+	gc.collect(ctx)
+
+	ns, err := client.CoreV1().Namespaces().Get(ctx, "cluster-abc", metav1.GetOptions{})
+	require.NoError(t, err, "a namespace predating the last bind annotation must survive")
+	lastBind, err := time.Parse(time.RFC3339, ns.Annotations[kuberesources.LastBindAnnotationKey])
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now(), lastBind, time.Minute)
+}
@@ -26,14 +26,15 @@ import (
 	bindclient "github.com/kube-bind/kube-bind/pkg/client/clientset/versioned"
 )
 
-func CreateClusterBinding(ctx context.Context, client bindclient.Interface, ns, secretName, providerPrettyName string) error {
+func CreateClusterBinding(ctx context.Context, client bindclient.Interface, ns, secretName, providerPrettyName string, owners []metav1.OwnerReference) error {
 	_, err := client.KubeBindV1alpha1().ClusterBindings(ns).Get(ctx, ClusterBindingName, metav1.GetOptions{})
 	if err != nil {
 		if errors.IsNotFound(err) {
 			clusterBinding := &kubebindv1alpha1.ClusterBinding{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:      ClusterBindingName,
-					Namespace: ns,
+					Name:            ClusterBindingName,
+					Namespace:       ns,
+					OwnerReferences: owners,
 				},
 				Spec: kubebindv1alpha1.ClusterBindingSpec{
 					ProviderPrettyName: providerPrettyName,
@@ -45,7 +46,7 @@ func CreateClusterBinding(ctx context.Context, client bindclient.Interface, ns,
 			}
 
 			_, err = client.KubeBindV1alpha1().ClusterBindings(ns).Create(ctx, clusterBinding, metav1.CreateOptions{})
-			if err == nil {
+			if err == nil || errors.IsAlreadyExists(err) {
 				return nil
 			}
 		}
@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"time"
 
+	authenticationv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -36,7 +37,82 @@ func GenerateKubeconfig(ctx context.Context,
 	client kubernetes.Interface,
 	clusterConfig *rest.Config,
 	ns, saSecretName string,
+	owners []v1.OwnerReference,
 ) (*corev1.Secret, error) {
+	token, err := waitForSASecretToken(ctx, client, ns, saSecretName)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := tokenKubeconfig(clusterConfig, ns, token)
+
+	return writeKubeconfigSecret(ctx, client, ns, cfg, nil, owners)
+}
+
+// TokenExpirationAnnotationKey is set on kubeconfig secrets with a bound service account
+// token to the RFC3339 time the token expires at.
+const TokenExpirationAnnotationKey = "example-backend.kube-bind.io/token-expiration"
+
+// TokenIssuedAtAnnotationKey is set next to TokenExpirationAnnotationKey to the RFC3339
+// time the token was requested at. The API server may issue a shorter lifetime than
+// requested, which is the difference of both.
+const TokenIssuedAtAnnotationKey = "example-backend.kube-bind.io/token-issued-at"
+
+// GenerateBoundTokenKubeconfig creates a kubeconfig with a bound token of the service
+// account minted with the TokenRequest API, expiring after ttl. The expiration is
+// recorded in the TokenExpirationAnnotationKey and TokenIssuedAtAnnotationKey annotations
+// of the secret.
+func GenerateBoundTokenKubeconfig(ctx context.Context,
+	client kubernetes.Interface,
+	clusterConfig *rest.Config,
+	ns, saName string,
+	ttl time.Duration,
+	owners []v1.OwnerReference,
+) (*corev1.Secret, error) {
+	expirationSeconds := int64(ttl / time.Second)
+	issuedAt := time.Now()
+	token, err := client.CoreV1().ServiceAccounts(ns).CreateToken(ctx, saName, &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			ExpirationSeconds: &expirationSeconds,
+		},
+	}, v1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to request token of service account %s/%s: %w", ns, saName, err)
+	}
+
+	cfg := tokenKubeconfig(clusterConfig, ns, token.Status.Token)
+
+	return writeKubeconfigSecret(ctx, client, ns, cfg, map[string]string{
+		TokenExpirationAnnotationKey: token.Status.ExpirationTimestamp.UTC().Format(time.RFC3339),
+		TokenIssuedAtAnnotationKey:   issuedAt.UTC().Format(time.RFC3339),
+	}, owners)
+}
+
+// GenerateImpersonatingKubeconfig creates a kubeconfig with the token of the service
+// account secret, impersonating the given user. The service account must only be
+// allowed to impersonate that user, see CreateImpersonatorClusterRoleBinding. Access is
+// then controlled by the RBAC bound to the user. The credentials of the backend itself
+// are never embedded.
+func GenerateImpersonatingKubeconfig(ctx context.Context,
+	client kubernetes.Interface,
+	clusterConfig *rest.Config,
+	ns, saSecretName, user string,
+	owners []v1.OwnerReference,
+) (*corev1.Secret, error) {
+	token, err := waitForSASecretToken(ctx, client, ns, saSecretName)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := tokenKubeconfig(clusterConfig, ns, token)
+	cfg.AuthInfos["default"].Impersonate = user
+
+	return writeKubeconfigSecret(ctx, client, ns, cfg, nil, owners)
+}
+
+// waitForSASecretToken waits for the token controller to populate the service account
+// token secret and returns the token.
+func waitForSASecretToken(ctx context.Context, client kubernetes.Interface, ns, saSecretName string) (string, error) {
 	var saSecret *corev1.Secret
 	if err := wait.PollImmediateWithContext(ctx, 500*time.Millisecond, 10*time.Second, func(ctx context.Context) (done bool, err error) {
 		saSecret, err = client.CoreV1().Secrets(ns).Get(ctx, saSecretName, v1.GetOptions{})
@@ -47,10 +123,13 @@ func GenerateKubeconfig(ctx context.Context,
 		}
 		return saSecret.Data["token"] != nil && saSecret.Data["ca.crt"] != nil, nil
 	}); err != nil {
-		return nil, err
+		return "", err
 	}
+	return string(saSecret.Data["token"]), nil
+}
 
-	cfg := clientcmdapi.Config{
+func tokenKubeconfig(clusterConfig *rest.Config, ns, token string) clientcmdapi.Config {
+	return clientcmdapi.Config{
 		Clusters: map[string]*clientcmdapi.Cluster{
 			"default": {
 				Server:                   clusterConfig.Host,
@@ -66,12 +145,56 @@ func GenerateKubeconfig(ctx context.Context,
 		},
 		AuthInfos: map[string]*clientcmdapi.AuthInfo{
 			"default": {
-				Token: string(saSecret.Data["token"]),
+				Token: token,
 			},
 		},
 		CurrentContext: "default",
 	}
+}
+
+// ExecNamespaceEnv is set for the exec credential plugin of exec kubeconfigs to the
+// consumer namespace, such that the plugin knows which credentials to get.
+const ExecNamespaceEnv = "KUBE_BIND_NAMESPACE"
+
+// ExecKubeconfig rewrites the kubeconfig to get the credentials from the exec credential
+// plugin instead of embedding them. Impersonation is kept.
+func ExecKubeconfig(kubeconfig []byte, exec *clientcmdapi.ExecConfig) ([]byte, error) {
+	cfg, err := clientcmd.Load(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode kubeconfig: %w", err)
+	}
 
+	for name, authInfo := range cfg.AuthInfos {
+		plugin := exec.DeepCopy()
+		if plugin.InteractiveMode == "" {
+			// kubeconfigs are mostly used by the konnector, which has no terminal.
+			plugin.InteractiveMode = clientcmdapi.NeverExecInteractiveMode
+		}
+		for _, kubeContext := range cfg.Contexts {
+			if kubeContext.AuthInfo == name && kubeContext.Namespace != "" {
+				plugin.Env = append(plugin.Env, clientcmdapi.ExecEnvVar{Name: ExecNamespaceEnv, Value: kubeContext.Namespace})
+				break
+			}
+		}
+		cfg.AuthInfos[name] = &clientcmdapi.AuthInfo{
+			Exec:                 plugin,
+			Impersonate:          authInfo.Impersonate,
+			ImpersonateUID:       authInfo.ImpersonateUID,
+			ImpersonateGroups:    authInfo.ImpersonateGroups,
+			ImpersonateUserExtra: authInfo.ImpersonateUserExtra,
+		}
+	}
+
+	return clientcmd.Write(*cfg)
+}
+
+// KubeconfigSecretName is the name of the secret holding the kubeconfig minted for
+// a consumer in its namespace.
+const KubeconfigSecretName = "kubeconfig"
+
+// writeKubeconfigSecret creates or updates the kubeconfig secret. The given annotations
+// are set, others are kept.
+func writeKubeconfigSecret(ctx context.Context, client kubernetes.Interface, ns string, cfg clientcmdapi.Config, annotations map[string]string, owners []v1.OwnerReference) (*corev1.Secret, error) {
 	kubeconfig, err := clientcmd.Write(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode kubeconfig: %w", err)
@@ -79,8 +202,10 @@ func GenerateKubeconfig(ctx context.Context,
 
 	secret := &corev1.Secret{
 		ObjectMeta: v1.ObjectMeta{
-			Name:      "kubeconfig",
-			Namespace: ns,
+			Name:            KubeconfigSecretName,
+			Namespace:       ns,
+			Annotations:     annotations,
+			OwnerReferences: owners,
 		},
 		Data: map[string][]byte{
 			"kubeconfig": kubeconfig,
@@ -99,6 +224,12 @@ func GenerateKubeconfig(ctx context.Context,
 			return err
 		}
 		existing.Data = secret.Data
+		for k, v := range annotations {
+			if existing.Annotations == nil {
+				existing.Annotations = map[string]string{}
+			}
+			existing.Annotations[k] = v
+		}
 		updated, err = client.CoreV1().Secrets(ns).Update(ctx, existing, v1.UpdateOptions{})
 		return err
 	}); err != nil {
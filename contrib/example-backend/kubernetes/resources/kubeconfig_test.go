@@ -0,0 +1,175 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestGenerateImpersonatingKubeconfig(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	clusterConfig := &rest.Config{
+		Host:        "https://provider.example.com",
+		BearerToken: "backend-token",
+		Username:    "backend",
+		Password:    "backend-password",
+		TLSClientConfig: rest.TLSClientConfig{
+			CAData:   []byte("ca"),
+			CertData: []byte("backend-cert"),
+			KeyData:  []byte("backend-key"),
+		},
+	}
+	mintSASecret(t, client, "cluster-abc", "sa-token")
+
+	secret, err := GenerateImpersonatingKubeconfig(ctx, client, clusterConfig, "cluster-abc", ClusterAdminName, "kube-bind:jane", nil)
+	require.NoError(t, err)
+
+	cfg, err := clientcmd.Load(secret.Data["kubeconfig"])
+	require.NoError(t, err)
+	kubeContext := cfg.Contexts[cfg.CurrentContext]
+	require.Equal(t, "cluster-abc", kubeContext.Namespace)
+	authInfo := cfg.AuthInfos[kubeContext.AuthInfo]
+	require.Equal(t, "kube-bind:jane", authInfo.Impersonate)
+	require.Equal(t, "sa-token", authInfo.Token, "the service account token must be embedded, not the backend token")
+	require.Empty(t, authInfo.ClientCertificateData)
+	require.Empty(t, authInfo.ClientKeyData)
+	require.Empty(t, authInfo.Username)
+	require.Empty(t, authInfo.Password)
+	require.NotContains(t, string(secret.Data["kubeconfig"]), "backend-")
+	require.Equal(t, "https://provider.example.com", cfg.Clusters[kubeContext.Cluster].Server)
+}
+
+func TestCreateImpersonatorClusterRoleBinding(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+
+	require.NoError(t, CreateImpersonatorClusterRoleBinding(ctx, client, "cluster-abc", "kube-bind:jane", nil))
+	// a retry converges.
+	require.NoError(t, CreateImpersonatorClusterRoleBinding(ctx, client, "cluster-abc", "kube-bind:jane", nil))
+
+	cr, err := client.RbacV1().ClusterRoles().Get(ctx, "kube-bind-impersonate-cluster-abc", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []rbacv1.PolicyRule{{
+		APIGroups:     []string{""},
+		Resources:     []string{"users"},
+		Verbs:         []string{"impersonate"},
+		ResourceNames: []string{"kube-bind:jane"},
+	}}, cr.Rules, "the service account may only impersonate the one user")
+
+	crb, err := client.RbacV1().ClusterRoleBindings().Get(ctx, "kube-bind-impersonate-cluster-abc", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []rbacv1.Subject{{Kind: "ServiceAccount", Name: ClusterAdminName, Namespace: "cluster-abc"}}, crb.Subjects)
+	require.Equal(t, cr.Name, crb.RoleRef.Name)
+}
+
+// mintSASecret simulates the token controller populating the service account token secret.
+func mintSASecret(t *testing.T, client *fake.Clientset, ns, token string) {
+	t.Helper()
+	ctx := context.Background()
+	secret, err := CreateSASecret(ctx, client, ns, ClusterAdminName, nil)
+	require.NoError(t, err)
+	secret.Data = map[string][]byte{"token": []byte(token), "ca.crt": []byte("ca")}
+	_, err = client.CoreV1().Secrets(ns).Update(ctx, secret, metav1.UpdateOptions{})
+	require.NoError(t, err)
+}
+
+func TestCreateImpersonatedUserAdminClusterRoleBinding(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+
+	// a pre-existing binding for the service account is switched over to the user.
+	require.NoError(t, CreateAdminClusterRoleBinding(ctx, client, "cluster-abc", nil))
+	require.NoError(t, CreateImpersonatedUserAdminClusterRoleBinding(ctx, client, "cluster-abc", "kube-bind:jane", nil))
+
+	crb, err := client.RbacV1().ClusterRoleBindings().Get(ctx, "kube-bind-cluster-abc", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []rbacv1.Subject{{APIGroup: rbacv1.GroupName, Kind: rbacv1.UserKind, Name: "kube-bind:jane"}}, crb.Subjects)
+	require.Equal(t, "cluster-admin", crb.RoleRef.Name)
+}
+
+func TestRotateSASecret(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	clusterConfig := &rest.Config{Host: "https://provider.example.com"}
+
+	tokenOf := func(secret *corev1.Secret) string {
+		t.Helper()
+		cfg, err := clientcmd.Load(secret.Data["kubeconfig"])
+		require.NoError(t, err)
+		return cfg.AuthInfos[cfg.Contexts[cfg.CurrentContext].AuthInfo].Token
+	}
+
+	mintSASecret(t, client, "cluster-abc", "old-token")
+	kfg, err := GenerateKubeconfig(ctx, client, clusterConfig, "cluster-abc", ClusterAdminName, nil)
+	require.NoError(t, err)
+	require.Equal(t, "old-token", tokenOf(kfg))
+
+	require.NoError(t, DeleteSASecret(ctx, client, "cluster-abc", ClusterAdminName))
+	_, err = client.CoreV1().Secrets("cluster-abc").Get(ctx, ClusterAdminName, metav1.GetOptions{})
+	require.True(t, errors.IsNotFound(err), "old token secret must be gone")
+
+	mintSASecret(t, client, "cluster-abc", "new-token")
+	kfg, err = GenerateKubeconfig(ctx, client, clusterConfig, "cluster-abc", ClusterAdminName, nil)
+	require.NoError(t, err)
+	require.Equal(t, "new-token", tokenOf(kfg))
+}
+
+func TestExecKubeconfig(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	clusterConfig := &rest.Config{Host: "https://provider.example.com"}
+	mintSASecret(t, client, "cluster-abc", "sa-token")
+
+	secret, err := GenerateImpersonatingKubeconfig(ctx, client, clusterConfig, "cluster-abc", ClusterAdminName, "kube-bind:jane", nil)
+	require.NoError(t, err)
+
+	exec := &clientcmdapi.ExecConfig{
+		APIVersion: "client.authentication.k8s.io/v1",
+		Command:    "kube-bind-credentials",
+		Args:       []string{"--provider", "example"},
+	}
+	kubeconfig, err := ExecKubeconfig(secret.Data["kubeconfig"], exec)
+	require.NoError(t, err)
+
+	cfg, err := clientcmd.Load(kubeconfig)
+	require.NoError(t, err)
+	require.NoError(t, clientcmd.Validate(*cfg))
+	kubeContext := cfg.Contexts[cfg.CurrentContext]
+	require.Equal(t, "cluster-abc", kubeContext.Namespace)
+	authInfo := cfg.AuthInfos[kubeContext.AuthInfo]
+	require.Empty(t, authInfo.Token, "the static token must be replaced by the plugin")
+	require.Equal(t, "kube-bind:jane", authInfo.Impersonate)
+	require.NotNil(t, authInfo.Exec)
+	require.Equal(t, "kube-bind-credentials", authInfo.Exec.Command)
+	require.Equal(t, []string{"--provider", "example"}, authInfo.Exec.Args)
+	require.Equal(t, clientcmdapi.NeverExecInteractiveMode, authInfo.Exec.InteractiveMode)
+	require.Equal(t, []clientcmdapi.ExecEnvVar{{Name: ExecNamespaceEnv, Value: "cluster-abc"}}, authInfo.Exec.Env)
+	require.Empty(t, exec.Env, "the given exec config must not be modified")
+}
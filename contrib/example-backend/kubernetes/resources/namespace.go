@@ -18,27 +18,56 @@ package resources
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 )
 
 const (
 	IdentityAnnotationKey = "example-backend.kube-bind.io/identity"
+	LastBindAnnotationKey = "example-backend.kube-bind.io/last-bind"
+
+	// IdentityHashLabelKey is set on namespaces to IdentityHash of the identity in the
+	// IdentityAnnotationKey annotation, which is no valid label value itself, such
+	// that the namespace of an identity can be listed by label selector.
+	IdentityHashLabelKey = "example-backend.kube-bind.io/identity-hash"
 )
 
-func CreateNamespace(ctx context.Context, client kubernetes.Interface, generateName, id string) (*corev1.Namespace, error) {
+// IdentityHash returns the value of the IdentityHashLabelKey label for the identity.
+func IdentityHash(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:16])
+}
+
+// namespaceLabels returns the given labels with the identity hash label added.
+func namespaceLabels(id string, labels map[string]string) map[string]string {
+	ret := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		ret[k] = v
+	}
+	ret[IdentityHashLabelKey] = IdentityHash(id)
+	return ret
+}
+
+func CreateNamespace(ctx context.Context, client kubernetes.Interface, generateName, id string, labels map[string]string) (*corev1.Namespace, error) {
 	if !strings.HasSuffix(generateName, "-") {
 		generateName = generateName + "-"
 	}
 	namespace := &corev1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: generateName,
+			Labels:       namespaceLabels(id, labels),
 			Annotations: map[string]string{
 				IdentityAnnotationKey: id,
+				LastBindAnnotationKey: time.Now().UTC().Format(time.RFC3339),
 			},
 		},
 	}
@@ -58,3 +87,48 @@ func CreateNamespace(ctx context.Context, client kubernetes.Interface, generateN
 
 	return ns, err
 }
+
+// CreateNamedNamespace creates the namespace with the given name for the identity, or
+// returns it if it already exists and belongs to the identity.
+func CreateNamedNamespace(ctx context.Context, client kubernetes.Interface, name, id string, labels map[string]string) (*corev1.Namespace, error) {
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: namespaceLabels(id, labels),
+			Annotations: map[string]string{
+				IdentityAnnotationKey: id,
+				LastBindAnnotationKey: time.Now().UTC().Format(time.RFC3339),
+			},
+		},
+	}
+
+	ns, err := client.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
+	if err != nil && !errors.IsAlreadyExists(err) {
+		return nil, err
+	} else if err == nil {
+		return ns, nil
+	}
+
+	ns, err = client.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if ns.Annotations[IdentityAnnotationKey] != id {
+		return nil, errors.NewAlreadyExists(corev1.Resource("namespace"), ns.Name)
+	}
+	return ns, nil
+}
+
+// TouchNamespace records the current time as the last bind time of the namespace.
+func TouchNamespace(ctx context.Context, client kubernetes.Interface, name string) error {
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, LastBindAnnotationKey, time.Now().UTC().Format(time.RFC3339))
+	_, err := client.CoreV1().Namespaces().Patch(ctx, name, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	return err
+}
+
+// SetNamespaceIdentity changes the identity the namespace belongs to.
+func SetNamespaceIdentity(ctx context.Context, client kubernetes.Interface, name, id string) error {
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q},"labels":{%q:%q}}}`, IdentityAnnotationKey, id, IdentityHashLabelKey, IdentityHash(id))
+	_, err := client.CoreV1().Namespaces().Patch(ctx, name, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	return err
+}
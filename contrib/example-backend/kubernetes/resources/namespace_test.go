@@ -0,0 +1,83 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateNamedNamespace(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(&corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "kube-system"},
+	})
+
+	ns, err := CreateNamedNamespace(ctx, client, "team-a", "issuer/jane", nil)
+	require.NoError(t, err)
+	require.Equal(t, "team-a", ns.Name)
+	require.Equal(t, "issuer/jane", ns.Annotations[IdentityAnnotationKey])
+	require.Equal(t, IdentityHash("issuer/jane"), ns.Labels[IdentityHashLabelKey])
+
+	// idempotent for the owner.
+	ns, err = CreateNamedNamespace(ctx, client, "team-a", "issuer/jane", nil)
+	require.NoError(t, err)
+	require.Equal(t, "team-a", ns.Name)
+
+	// others cannot take over the namespace.
+	_, err = CreateNamedNamespace(ctx, client, "team-a", "issuer/joe", nil)
+	require.True(t, errors.IsAlreadyExists(err))
+	_, err = CreateNamedNamespace(ctx, client, "kube-system", "issuer/joe", nil)
+	require.True(t, errors.IsAlreadyExists(err))
+}
+
+func TestCreateNamespaceDerived(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+
+	ns, err := CreateNamespace(ctx, client, "cluster", "issuer/jane", nil)
+	require.NoError(t, err)
+	require.Equal(t, "cluster-", ns.GenerateName)
+	require.Equal(t, "issuer/jane", ns.Annotations[IdentityAnnotationKey])
+	require.Equal(t, IdentityHash("issuer/jane"), ns.Labels[IdentityHashLabelKey])
+}
+
+func TestCreateNamespaceLabels(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	labels := map[string]string{"example.com/department": "R-D-Europe"}
+	defer func() {
+		require.Len(t, labels, 1, "the labels passed in must not be changed")
+	}()
+
+	ns, err := CreateNamespace(ctx, client, "cluster", "issuer/jane", labels)
+	require.NoError(t, err)
+	require.Equal(t, "R-D-Europe", ns.Labels["example.com/department"])
+	require.Equal(t, IdentityHash("issuer/jane"), ns.Labels[IdentityHashLabelKey])
+
+	ns, err = CreateNamedNamespace(ctx, client, "team-a", "issuer/jane", labels)
+	require.NoError(t, err)
+	require.Equal(t, "R-D-Europe", ns.Labels["example.com/department"])
+	require.Equal(t, IdentityHash("issuer/jane"), ns.Labels[IdentityHashLabelKey])
+}
@@ -0,0 +1,36 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// NamespaceOwnerReferences returns the owner references pointing at the consumer
+// namespace. The namespace is cluster-scoped, hence it can also own the cluster-scoped
+// objects provisioned for the consumer, which are then garbage collected with it.
+func NamespaceOwnerReferences(ns *corev1.Namespace) []metav1.OwnerReference {
+	return []metav1.OwnerReference{
+		{
+			APIVersion: "v1",
+			Kind:       "Namespace",
+			Name:       ns.Name,
+			UID:        ns.UID,
+		},
+	}
+}
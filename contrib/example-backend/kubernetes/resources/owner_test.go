@@ -0,0 +1,113 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	bindfake "github.com/kube-bind/kube-bind/pkg/client/clientset/versioned/fake"
+	"github.com/kube-bind/kube-bind/pkg/indexers"
+)
+
+func TestNamespaceOwnerReferences(t *testing.T) {
+	ctx := context.Background()
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cluster-abc", UID: "ns-uid"}}
+	client := fake.NewSimpleClientset(ns)
+	bindClient := bindfake.NewSimpleClientset()
+	exports := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+		indexers.ServiceExportByServiceExportResource: indexers.IndexServiceExportByServiceExportResource,
+	})
+	owners := NamespaceOwnerReferences(ns)
+	require.Equal(t, []metav1.OwnerReference{{APIVersion: "v1", Kind: "Namespace", Name: "cluster-abc", UID: "ns-uid"}}, owners)
+
+	// a binding created before owner references were enabled is adopted.
+	require.NoError(t, CreateAdminClusterRoleBinding(ctx, client, ns.Name, nil))
+	require.NoError(t, CreateAdminClusterRoleBinding(ctx, client, ns.Name, owners))
+
+	_, err := CreateServiceAccount(ctx, client, ns.Name, owners)
+	require.NoError(t, err)
+	require.NoError(t, CreateImpersonatorClusterRoleBinding(ctx, client, ns.Name, "kube-bind:jane", owners))
+	saSecret, err := CreateSASecret(ctx, client, ns.Name, ClusterAdminName, owners)
+	require.NoError(t, err)
+	saSecret.Data = map[string][]byte{"token": []byte("token"), "ca.crt": []byte("ca")}
+	_, err = client.CoreV1().Secrets(ns.Name).Update(ctx, saSecret, metav1.UpdateOptions{})
+	require.NoError(t, err)
+	kfg, err := GenerateImpersonatingKubeconfig(ctx, client, &rest.Config{Host: "https://provider.example.com"}, ns.Name, ClusterAdminName, "kube-bind:jane", owners)
+	require.NoError(t, err)
+	require.NoError(t, CreateClusterBinding(ctx, bindClient, ns.Name, kfg.Name, "Example Backend", owners))
+	require.NoError(t, CreateAPIServiceExport(ctx, bindClient, exports, ns.Name, "mangodbs", "mangodb.com", "", owners))
+
+	// the fake client has no garbage collector, hence check that every provisioned object
+	// is a dependent of the namespace, including the cluster-scoped binding which would
+	// otherwise outlive it.
+	dependents := func(uid types.UID, objs ...metav1.Object) []string {
+		var names []string
+		for _, obj := range objs {
+			for _, ref := range obj.GetOwnerReferences() {
+				if ref.UID == uid {
+					names = append(names, obj.GetName())
+				}
+			}
+		}
+		return names
+	}
+
+	crb, err := client.RbacV1().ClusterRoleBindings().Get(ctx, "kube-bind-cluster-abc", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, rbacv1.ServiceAccountKind, crb.Subjects[0].Kind)
+	sa, err := client.CoreV1().ServiceAccounts(ns.Name).Get(ctx, ClusterAdminName, metav1.GetOptions{})
+	require.NoError(t, err)
+	impersonatorCR, err := client.RbacV1().ClusterRoles().Get(ctx, "kube-bind-impersonate-cluster-abc", metav1.GetOptions{})
+	require.NoError(t, err)
+	impersonatorCRB, err := client.RbacV1().ClusterRoleBindings().Get(ctx, "kube-bind-impersonate-cluster-abc", metav1.GetOptions{})
+	require.NoError(t, err)
+	saSecret, err = client.CoreV1().Secrets(ns.Name).Get(ctx, ClusterAdminName, metav1.GetOptions{})
+	require.NoError(t, err)
+	kfgSecret, err := client.CoreV1().Secrets(ns.Name).Get(ctx, "kubeconfig", metav1.GetOptions{})
+	require.NoError(t, err)
+	binding, err := bindClient.KubeBindV1alpha1().ClusterBindings(ns.Name).Get(ctx, ClusterBindingName, metav1.GetOptions{})
+	require.NoError(t, err)
+	export, err := bindClient.KubeBindV1alpha1().APIServiceExports(ns.Name).Get(ctx, "mangodbs.mangodb.com", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	require.Equal(t,
+		[]string{"kube-bind-cluster-abc", "kube-bind-impersonate-cluster-abc", "kube-bind-impersonate-cluster-abc", ClusterAdminName, ClusterAdminName, "kubeconfig", ClusterBindingName, "mangodbs.mangodb.com"},
+		dependents(ns.UID, crb, impersonatorCR, impersonatorCRB, sa, saSecret, kfgSecret, binding, export),
+	)
+	require.Empty(t, dependents("other-uid", crb, impersonatorCR, impersonatorCRB, sa, saSecret, kfgSecret, binding, export))
+}
+
+func TestNoOwnerReferences(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+
+	require.NoError(t, CreateAdminClusterRoleBinding(ctx, client, "cluster-abc", nil))
+	crb, err := client.RbacV1().ClusterRoleBindings().Get(ctx, "kube-bind-cluster-abc", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Empty(t, crb.OwnerReferences)
+}
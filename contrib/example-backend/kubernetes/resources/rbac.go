@@ -28,7 +28,7 @@ import (
 	"k8s.io/klog/v2"
 )
 
-func CreateServiceAccount(ctx context.Context, client kubeclient.Interface, ns string) (*corev1.ServiceAccount, error) {
+func CreateServiceAccount(ctx context.Context, client kubeclient.Interface, ns string, owners []metav1.OwnerReference) (*corev1.ServiceAccount, error) {
 	logger := klog.FromContext(ctx)
 
 	sa, err := client.CoreV1().ServiceAccounts(ns).Get(ctx, ClusterAdminName, metav1.GetOptions{})
@@ -36,31 +36,65 @@ func CreateServiceAccount(ctx context.Context, client kubeclient.Interface, ns s
 		if errors.IsNotFound(err) {
 			sa = &corev1.ServiceAccount{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:      ClusterAdminName,
-					Namespace: ns,
+					Name:            ClusterAdminName,
+					Namespace:       ns,
+					OwnerReferences: owners,
 				},
 			}
 
 			logger.Info("Creating service account", "name", sa.Name)
-			return client.CoreV1().ServiceAccounts(ns).Create(ctx, sa, metav1.CreateOptions{})
+			created, err := client.CoreV1().ServiceAccounts(ns).Create(ctx, sa, metav1.CreateOptions{})
+			if errors.IsAlreadyExists(err) {
+				return client.CoreV1().ServiceAccounts(ns).Get(ctx, ClusterAdminName, metav1.GetOptions{})
+			}
+			return created, err
 		}
 	}
 
 	return sa, err
 }
 
-func CreateAdminClusterRoleBinding(ctx context.Context, client kubeclient.Interface, ns string) error {
+// DeleteServiceAccount deletes the service account of the namespace. This invalidates
+// all bound tokens minted for it.
+func DeleteServiceAccount(ctx context.Context, client kubeclient.Interface, ns string) error {
+	err := client.CoreV1().ServiceAccounts(ns).Delete(ctx, ClusterAdminName, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+func CreateAdminClusterRoleBinding(ctx context.Context, client kubeclient.Interface, ns string, owners []metav1.OwnerReference) error {
+	return ensureAdminClusterRoleBinding(ctx, client, ns, owners, rbacv1.Subject{
+		Kind:      "ServiceAccount",
+		Name:      ClusterAdminName,
+		Namespace: ns,
+	})
+}
+
+// CreateImpersonatedUserAdminClusterRoleBinding grants the impersonated user of
+// the given namespace the same permissions the service account would get.
+func CreateImpersonatedUserAdminClusterRoleBinding(ctx context.Context, client kubeclient.Interface, ns, user string, owners []metav1.OwnerReference) error {
+	return ensureAdminClusterRoleBinding(ctx, client, ns, owners, rbacv1.Subject{
+		APIGroup: rbacv1.GroupName,
+		Kind:     rbacv1.UserKind,
+		Name:     user,
+	})
+}
+
+// AdminClusterRoleBindingName is the name of the ClusterRoleBinding granting the
+// consumer of the namespace its permissions.
+func AdminClusterRoleBindingName(ns string) string {
+	return "kube-bind-" + ns
+}
+
+func ensureAdminClusterRoleBinding(ctx context.Context, client kubeclient.Interface, ns string, owners []metav1.OwnerReference, subject rbacv1.Subject) error {
 	crb := &rbacv1.ClusterRoleBinding{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: "kube-bind-" + ns,
-		},
-		Subjects: []rbacv1.Subject{
-			{
-				Kind:      "ServiceAccount",
-				Name:      ClusterAdminName,
-				Namespace: ns,
-			},
+			Name:            AdminClusterRoleBindingName(ns),
+			OwnerReferences: owners,
 		},
+		Subjects: []rbacv1.Subject{subject},
 		RoleRef: rbacv1.RoleRef{
 			APIGroup: "rbac.authorization.k8s.io",
 			Kind:     "ClusterRole",
@@ -81,7 +115,88 @@ func CreateAdminClusterRoleBinding(ctx context.Context, client kubeclient.Interf
 		}
 		existing.Subjects = crb.Subjects
 		existing.RoleRef = crb.RoleRef
-		_, err = client.RbacV1().ClusterRoleBindings().Update(ctx, crb, metav1.UpdateOptions{})
+		if len(owners) > 0 {
+			// adopt bindings created before they were owned by the namespace.
+			existing.OwnerReferences = owners
+		}
+		_, err = client.RbacV1().ClusterRoleBindings().Update(ctx, existing, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// ImpersonatorName is the name of the ClusterRole and ClusterRoleBinding allowing the
+// service account of the namespace to impersonate the consumer user.
+func ImpersonatorName(ns string) string {
+	return "kube-bind-impersonate-" + ns
+}
+
+// CreateImpersonatorClusterRoleBinding allows the service account of the namespace to
+// impersonate the given user, and nothing else. Its token is embedded into impersonating
+// kubeconfigs, such that the consumer never gets the credentials of the backend.
+func CreateImpersonatorClusterRoleBinding(ctx context.Context, client kubeclient.Interface, ns, user string, owners []metav1.OwnerReference) error {
+	cr := &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            ImpersonatorName(ns),
+			OwnerReferences: owners,
+		},
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups:     []string{""},
+			Resources:     []string{"users"},
+			Verbs:         []string{"impersonate"},
+			ResourceNames: []string{user},
+		}},
+	}
+	if _, err := client.RbacV1().ClusterRoles().Create(ctx, cr, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	} else if err != nil {
+		if err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			existing, err := client.RbacV1().ClusterRoles().Get(ctx, cr.Name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			existing.Rules = cr.Rules
+			if len(owners) > 0 {
+				existing.OwnerReferences = owners
+			}
+			_, err = client.RbacV1().ClusterRoles().Update(ctx, existing, metav1.UpdateOptions{})
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+
+	crb := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            ImpersonatorName(ns),
+			OwnerReferences: owners,
+		},
+		Subjects: []rbacv1.Subject{{
+			Kind:      "ServiceAccount",
+			Name:      ClusterAdminName,
+			Namespace: ns,
+		}},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: "rbac.authorization.k8s.io",
+			Kind:     "ClusterRole",
+			Name:     cr.Name,
+		},
+	}
+	if _, err := client.RbacV1().ClusterRoleBindings().Create(ctx, crb, metav1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
+		return err
+	} else if err == nil {
+		return nil
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		existing, err := client.RbacV1().ClusterRoleBindings().Get(ctx, crb.Name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		existing.Subjects = crb.Subjects
+		if len(owners) > 0 {
+			existing.OwnerReferences = owners
+		}
+		_, err = client.RbacV1().ClusterRoleBindings().Update(ctx, existing, metav1.UpdateOptions{})
 		return err
 	})
 }
@@ -28,6 +28,14 @@ const (
 type AuthCode struct {
 	RedirectURL string `json:"redirectURL"`
 	SessionID   string `json:"sid"`
+	// IssuedAt is the unix time the code was issued at, to reject stale callbacks.
+	IssuedAt int64 `json:"iat,omitempty"`
+	// ClientSessionID is the session id chosen by the consumer if SessionID was
+	// generated by the backend. It is returned in the AuthResponse.
+	ClientSessionID string `json:"csid,omitempty"`
+	// CorrelationID is the id the consumer passed to correlate its request with the
+	// binding flow. It is returned in the AuthResponse.
+	CorrelationID string `json:"cid,omitempty"`
 }
 
 // AuthResponse contains the authentication data which is needed to connect to the service provider
@@ -38,5 +46,26 @@ type AuthResponse struct {
 	Kubeconfig []byte `json:"kubeconfig"`
 	Resource   string `json:"resource"`
 	Group      string `json:"group"`
+	Version    string `json:"version,omitempty"`
 	Export     string `json:"export"`
+	// CorrelationID is the id the consumer passed at /authorize, if any.
+	CorrelationID string `json:"correlationID,omitempty"`
+}
+
+// ProviderMetadata describes the service provider such that consumers can render
+// a branded consent screen before redirecting to the provider.
+type ProviderMetadata struct {
+	ProviderPrettyName string `json:"providerPrettyName"`
+	LogoURL            string `json:"logoURL,omitempty"`
+	ThemeColor         string `json:"themeColor,omitempty"`
+}
+
+// OIDCRequirements describes how the OpenID client of the backend must be registered
+// with the identity provider.
+type OIDCRequirements struct {
+	RedirectURIs   []string `json:"redirectURIs"`
+	Scopes         []string `json:"scopes"`
+	OptionalScopes []string `json:"optionalScopes,omitempty"`
+	ResponseTypes  []string `json:"responseTypes"`
+	GrantTypes     []string `json:"grantTypes"`
 }
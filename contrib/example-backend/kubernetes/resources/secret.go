@@ -25,14 +25,15 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
-func CreateSASecret(ctx context.Context, client kubernetes.Interface, ns, saName string) (*corev1.Secret, error) {
+func CreateSASecret(ctx context.Context, client kubernetes.Interface, ns, saName string, owners []metav1.OwnerReference) (*corev1.Secret, error) {
 	secret, err := client.CoreV1().Secrets(ns).Get(ctx, saName, metav1.GetOptions{})
 	if err != nil {
 		if errors.IsNotFound(err) {
 			secret = &corev1.Secret{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:      saName,
-					Namespace: ns,
+					Name:            saName,
+					Namespace:       ns,
+					OwnerReferences: owners,
 					Annotations: map[string]string{
 						ServiceAccountTokenAnnotation: saName,
 					},
@@ -40,7 +41,11 @@ func CreateSASecret(ctx context.Context, client kubernetes.Interface, ns, saName
 				Type: ServiceAccountTokenType,
 			}
 
-			return client.CoreV1().Secrets(ns).Create(ctx, secret, metav1.CreateOptions{})
+			created, err := client.CoreV1().Secrets(ns).Create(ctx, secret, metav1.CreateOptions{})
+			if errors.IsAlreadyExists(err) {
+				return client.CoreV1().Secrets(ns).Get(ctx, saName, metav1.GetOptions{})
+			}
+			return created, err
 		}
 
 		return nil, err
@@ -48,3 +53,13 @@ func CreateSASecret(ctx context.Context, client kubernetes.Interface, ns, saName
 
 	return secret, nil
 }
+
+// DeleteSASecret deletes the service account token secret. This invalidates the
+// token, and a new one is minted when the secret is recreated.
+func DeleteSASecret(ctx context.Context, client kubernetes.Interface, ns, saName string) error {
+	err := client.CoreV1().Secrets(ns).Delete(ctx, saName, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+	return nil
+}
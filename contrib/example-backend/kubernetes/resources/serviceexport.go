@@ -19,7 +19,9 @@ package resources
 import (
 	"context"
 	"fmt"
+	"reflect"
 
+	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
@@ -29,7 +31,9 @@ import (
 	"github.com/kube-bind/kube-bind/pkg/indexers"
 )
 
-func CreateAPIServiceExport(ctx context.Context, client bindclient.Interface, serviceExport cache.Indexer, ns, resource, group string) error {
+// CreateAPIServiceExport creates the APIServiceExport of the resource, or updates the
+// pinned versions of an existing one. An empty version exports all served versions.
+func CreateAPIServiceExport(ctx context.Context, client bindclient.Interface, serviceExport cache.Indexer, ns, resource, group, version string, owners []metav1.OwnerReference) error {
 	logging := klog.FromContext(ctx)
 
 	exports, err := serviceExport.ByIndex(indexers.ServiceExportByServiceExportResource, indexers.ServiceExportByServiceExportResourceKey(ns, resource, group))
@@ -37,16 +41,21 @@ func CreateAPIServiceExport(ctx context.Context, client bindclient.Interface, se
 		return fmt.Errorf("failed to get service export for resource %s.%s: %w", resource, group, err)
 	}
 
+	var versions []string
+	if version != "" {
+		versions = []string{version}
+	}
+
 	if len(exports) > 0 {
-		logging.Info("Service export already exists", "name", resource+"."+group)
-		return nil
+		return updatePinnedVersions(ctx, client, exports[0].(*kubebindv1alpha1.APIServiceExport), resource, group, versions)
 	}
 
 	logging.Info("Creating service export", "name", resource+"."+group)
 	_, err = client.KubeBindV1alpha1().APIServiceExports(ns).Create(ctx, &kubebindv1alpha1.APIServiceExport{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      resource + "." + group,
-			Namespace: ns,
+			Name:            resource + "." + group,
+			Namespace:       ns,
+			OwnerReferences: owners,
 		},
 		Spec: kubebindv1alpha1.APIServiceExportSpec{
 			Scope: kubebindv1alpha1.ClusterScope,
@@ -56,9 +65,36 @@ func CreateAPIServiceExport(ctx context.Context, client bindclient.Interface, se
 						Group:    group,
 						Resource: resource,
 					},
+					Versions: versions,
 				},
 			},
 		},
 	}, metav1.CreateOptions{})
-	return err
+	if !errors.IsAlreadyExists(err) {
+		return err
+	}
+
+	// created by a previous attempt the informer has not seen yet.
+	existing, err := client.KubeBindV1alpha1().APIServiceExports(ns).Get(ctx, resource+"."+group, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	return updatePinnedVersions(ctx, client, existing, resource, group, versions)
+}
+
+func updatePinnedVersions(ctx context.Context, client bindclient.Interface, existing *kubebindv1alpha1.APIServiceExport, resource, group string, versions []string) error {
+	logging := klog.FromContext(ctx)
+
+	for i, gr := range existing.Spec.Resources {
+		if gr.Group != group || gr.Resource != resource || reflect.DeepEqual(gr.Versions, versions) {
+			continue
+		}
+		logging.Info("Updating pinned versions of service export", "name", existing.Name, "versions", versions)
+		existing = existing.DeepCopy()
+		existing.Spec.Resources[i].Versions = versions
+		_, err := client.KubeBindV1alpha1().APIServiceExports(existing.Namespace).Update(ctx, existing, metav1.UpdateOptions{})
+		return err
+	}
+	logging.Info("Service export already exists", "name", resource+"."+group)
+	return nil
 }
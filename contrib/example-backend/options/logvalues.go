@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Redacted replaces the values of secret options when logging them.
+const Redacted = "<redacted>"
+
+// redactedOptions are secrets or key material, which are never logged.
+var redactedOptions = sets.NewString(
+	"OIDC.IssuerClientSecret",
+	"AdminToken",
+	"AuthResponseSigningKey",
+	"AuthResponseVerificationKeys",
+	"CookieSigningKeys",
+)
+
+// LogValues returns the effective options as key/value pairs for structured
+// logging. Secrets are redacted, and options without a loggable value like the
+// logging configuration and pre-wired listeners are omitted.
+func (options *CompletedOptions) LogValues() []interface{} {
+	var kvs []interface{}
+	kvs = appendLogValues(kvs, "OIDC.", reflect.ValueOf(options.OIDC).Elem())
+	kvs = appendLogValues(kvs, "Serve.", reflect.ValueOf(options.Serve).Elem())
+	kvs = appendLogValues(kvs, "", reflect.ValueOf(options.ExtraOptions))
+	return kvs
+}
+
+func appendLogValues(kvs []interface{}, prefix string, v reflect.Value) []interface{} {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := v.Field(i)
+		if !field.IsExported() || value.Kind() == reflect.Interface || value.Kind() == reflect.Func {
+			continue
+		}
+		key := prefix + field.Name
+		if redactedOptions.Has(key) {
+			if value.IsZero() {
+				kvs = append(kvs, key, "")
+			} else {
+				kvs = append(kvs, key, Redacted)
+			}
+			continue
+		}
+		kvs = append(kvs, key, value.Interface())
+	}
+	return kvs
+}
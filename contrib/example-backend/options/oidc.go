@@ -18,29 +18,79 @@ package options
 
 import (
 	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 )
 
+// ClientSecretEnv is the environment variable the OIDC client secret is read from
+// if neither the flag nor the file is given.
+const ClientSecretEnv = "OIDC_CLIENT_SECRET"
+
 type OIDC struct {
-	IssuerClientID     string
-	IssuerClientSecret string
-	IssuerURL          string
-	CallbackURL        string
+	IssuerClientID         string
+	IssuerClientSecret     string
+	IssuerClientSecretFile string
+	IssuerURL              string
+	CallbackURL            string
+
+	Prompt    string
+	MaxAge    time.Duration
+	AcrValues []string
+
+	AllowedScopes          []string
+	RejectDisallowedScopes bool
+
+	BreakerThreshold int
+	BreakerCoolDown  time.Duration
+
+	UserInfoTimeout time.Duration
+
+	// secretFlagSet is true if the client secret was given by flag, not by file or env.
+	secretFlagSet bool
 }
 
 func NewOIDC() *OIDC {
-	return &OIDC{}
+	return &OIDC{
+		BreakerThreshold: 5,
+		BreakerCoolDown:  30 * time.Second,
+	}
 }
 
 func (options *OIDC) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&options.IssuerClientID, "oidc-issuer-client-id", options.IssuerClientID, "Issuer client ID")
-	fs.StringVar(&options.IssuerClientSecret, "oidc-issuer-client-secret", options.IssuerClientSecret, "OpenID client secret")
+	fs.StringVar(&options.IssuerClientSecret, "oidc-issuer-client-secret", options.IssuerClientSecret, "OpenID client secret. Prefer --oidc-client-secret-file or the "+ClientSecretEnv+" environment variable to keep it out of process listings")
+	fs.StringVar(&options.IssuerClientSecretFile, "oidc-client-secret-file", options.IssuerClientSecretFile, "File containing the OpenID client secret")
 	fs.StringVar(&options.IssuerURL, "oidc-issuer-url", options.IssuerURL, "Callback URL for OpenID responses.")
 	fs.StringVar(&options.CallbackURL, "oidc-callback-url", options.CallbackURL, "OpenID callback URL")
+	fs.StringVar(&options.Prompt, "oidc-prompt", options.Prompt, "Default OpenID prompt parameter, space separated values of none, login, consent and select_account. Can be overridden with the prompt query parameter of /authorize")
+	fs.DurationVar(&options.MaxAge, "oidc-max-age", options.MaxAge, "Default OpenID max_age parameter, the maximum time since the last active authentication of the user. Zero omits it. Can be overridden with the max_age query parameter of /authorize")
+	fs.StringSliceVar(&options.AcrValues, "oidc-acr-values", options.AcrValues, "OpenID acr_values parameter, the authentication context class references requested from the IdP in order of preference, e.g. for multi-factor authentication. Binding is rejected unless the acr claim of the ID token is one of them. Empty disables the check")
+	fs.StringSliceVar(&options.AllowedScopes, "oidc-allowed-scopes", options.AllowedScopes, "Additional OpenID scopes a client may request with the scope query parameter of /authorize. The openid, profile and email scopes are always requested")
+	fs.BoolVar(&options.RejectDisallowedScopes, "oidc-reject-disallowed-scopes", options.RejectDisallowedScopes, "Reject authorize requests asking for scopes not in --oidc-allowed-scopes instead of silently dropping them")
+	fs.IntVar(&options.BreakerThreshold, "oidc-breaker-threshold", options.BreakerThreshold, "Number of consecutive failed token exchanges after which the IdP is considered down and callbacks fail fast. Zero disables failing fast")
+	fs.DurationVar(&options.BreakerCoolDown, "oidc-breaker-cool-down", options.BreakerCoolDown, "Time to fail callbacks fast before trying the IdP again")
+	fs.DurationVar(&options.UserInfoTimeout, "oidc-userinfo-timeout", options.UserInfoTimeout, "Timeout of fetching the claims of the OpenID userinfo endpoint with the access token, adding those missing from the ID token, e.g. email or groups of IdPs issuing thin ID tokens. Zero disables the userinfo endpoint")
 }
 
 func (options *OIDC) Complete() error {
+	options.secretFlagSet = options.IssuerClientSecret != ""
+
+	switch {
+	case options.secretFlagSet:
+	case options.IssuerClientSecretFile != "":
+		bs, err := os.ReadFile(options.IssuerClientSecretFile)
+		if err != nil {
+			return fmt.Errorf("failed to read OIDC client secret file: %w", err)
+		}
+		options.IssuerClientSecret = strings.TrimSpace(string(bs))
+	default:
+		options.IssuerClientSecret = strings.TrimSpace(os.Getenv(ClientSecretEnv))
+	}
+
 	return nil
 }
 
@@ -48,8 +98,11 @@ func (options *OIDC) Validate() error {
 	if options.IssuerClientID == "" {
 		return fmt.Errorf("OIDC issuer client ID cannot be empty")
 	}
+	if options.secretFlagSet && options.IssuerClientSecretFile != "" {
+		return fmt.Errorf("OIDC issuer client secret and client secret file are mutually exclusive")
+	}
 	if options.IssuerClientSecret == "" {
-		return fmt.Errorf("OIDC issuer client secret cannot be empty")
+		return fmt.Errorf("OIDC issuer client secret cannot be empty, use --oidc-client-secret-file or %s", ClientSecretEnv)
 	}
 	if options.IssuerURL == "" {
 		return fmt.Errorf("OIDC issuer URL cannot be empty")
@@ -57,6 +110,74 @@ func (options *OIDC) Validate() error {
 	if options.CallbackURL == "" {
 		return fmt.Errorf("OIDC callback URL cannot be empty")
 	}
+	if err := validateCallbackURL(options.CallbackURL); err != nil {
+		return err
+	}
+	if err := ValidatePrompt(options.Prompt); err != nil {
+		return err
+	}
+	if options.MaxAge < 0 {
+		return fmt.Errorf("OIDC max age cannot be negative")
+	}
+	for _, acr := range options.AcrValues {
+		if acr == "" || strings.ContainsAny(acr, " \t") {
+			return fmt.Errorf("invalid OIDC acr value %q", acr)
+		}
+	}
+	for _, scope := range options.AllowedScopes {
+		if scope == "" || strings.ContainsAny(scope, " \t") {
+			return fmt.Errorf("invalid OIDC allowed scope %q", scope)
+		}
+	}
+	if options.BreakerThreshold < 0 {
+		return fmt.Errorf("OIDC breaker threshold cannot be negative")
+	}
+	if options.BreakerCoolDown <= 0 {
+		return fmt.Errorf("OIDC breaker cool-down must be positive")
+	}
+	if options.UserInfoTimeout < 0 {
+		return fmt.Errorf("OIDC userinfo timeout cannot be negative")
+	}
+
+	return nil
+}
 
+// validateCallbackURL checks that the callback URL is what the IdP can redirect to
+// and what the backend serves, to catch redirect_uri mismatches early.
+func validateCallbackURL(callbackURL string) error {
+	u, err := url.Parse(callbackURL)
+	if err != nil {
+		return fmt.Errorf("invalid OIDC callback URL %q: %w", callbackURL, err)
+	}
+	if !u.IsAbs() || u.Host == "" {
+		return fmt.Errorf("OIDC callback URL %q must be absolute", callbackURL)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("OIDC callback URL %q must use http or https", callbackURL)
+	}
+	if !strings.HasSuffix(u.Path, "/callback") {
+		return fmt.Errorf("OIDC callback URL %q must end in /callback", callbackURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("OIDC callback URL %q must not have a query or fragment", callbackURL)
+	}
+	return nil
+}
+
+// ValidatePrompt checks the value of the OpenID prompt parameter. It is a space
+// separated list, and "none" cannot be combined with other values.
+func ValidatePrompt(prompt string) error {
+	values := strings.Fields(prompt)
+	for _, v := range values {
+		switch v {
+		case "none":
+			if len(values) > 1 {
+				return fmt.Errorf("OIDC prompt %q cannot combine none with other values", prompt)
+			}
+		case "login", "consent", "select_account":
+		default:
+			return fmt.Errorf("invalid OIDC prompt value %q, must be one of none, login, consent, select_account", v)
+		}
+	}
 	return nil
 }
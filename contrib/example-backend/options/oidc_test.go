@@ -0,0 +1,141 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCallbackURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "http://127.0.0.1:8080/callback"},
+		{url: "https://backend.example.com/kube-bind/callback"},
+		{url: "/callback", wantErr: true},
+		{url: "127.0.0.1:8080/callback", wantErr: true},
+		{url: "ftp://backend.example.com/callback", wantErr: true},
+		{url: "https://backend.example.com/", wantErr: true},
+		{url: "https://backend.example.com/callback/", wantErr: true},
+		{url: "https://backend.example.com/callback?x=y", wantErr: true},
+		{url: "https://backend.example.com/%zz/callback", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := validateCallbackURL(tt.url)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidatePrompt(t *testing.T) {
+	tests := []struct {
+		prompt  string
+		wantErr bool
+	}{
+		{prompt: ""},
+		{prompt: "none"},
+		{prompt: "login"},
+		{prompt: "login consent"},
+		{prompt: "select_account"},
+		{prompt: "none login", wantErr: true},
+		{prompt: "always", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.prompt, func(t *testing.T) {
+			err := ValidatePrompt(tt.prompt)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestClientSecret(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(secretFile, []byte("  file-secret\n"), 0600))
+
+	newOIDC := func() *OIDC {
+		return &OIDC{
+			IssuerClientID:   "kube-bind",
+			IssuerURL:        "https://login.example.com",
+			CallbackURL:      "https://backend.example.com/callback",
+			BreakerThreshold: 5,
+			BreakerCoolDown:  time.Second,
+		}
+	}
+
+	t.Run("file", func(t *testing.T) {
+		t.Setenv(ClientSecretEnv, "env-secret")
+		o := newOIDC()
+		o.IssuerClientSecretFile = secretFile
+		require.NoError(t, o.Complete())
+		require.NoError(t, o.Validate())
+		require.Equal(t, "file-secret", o.IssuerClientSecret)
+	})
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv(ClientSecretEnv, "env-secret")
+		o := newOIDC()
+		require.NoError(t, o.Complete())
+		require.NoError(t, o.Validate())
+		require.Equal(t, "env-secret", o.IssuerClientSecret)
+	})
+
+	t.Run("flag wins over env", func(t *testing.T) {
+		t.Setenv(ClientSecretEnv, "env-secret")
+		o := newOIDC()
+		o.IssuerClientSecret = "flag-secret"
+		require.NoError(t, o.Complete())
+		require.NoError(t, o.Validate())
+		require.Equal(t, "flag-secret", o.IssuerClientSecret)
+	})
+
+	t.Run("flag and file conflict", func(t *testing.T) {
+		o := newOIDC()
+		o.IssuerClientSecret = "flag-secret"
+		o.IssuerClientSecretFile = secretFile
+		require.NoError(t, o.Complete())
+		require.Error(t, o.Validate())
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		o := newOIDC()
+		o.IssuerClientSecretFile = filepath.Join(dir, "missing")
+		require.Error(t, o.Complete())
+	})
+
+	t.Run("none", func(t *testing.T) {
+		t.Setenv(ClientSecretEnv, "")
+		o := newOIDC()
+		require.NoError(t, o.Complete())
+		require.Error(t, o.Validate())
+	})
+}
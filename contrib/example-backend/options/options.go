@@ -17,14 +17,49 @@ limitations under the License.
 package options
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/spf13/pflag"
 
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/component-base/logs"
 	logsv1 "k8s.io/component-base/logs/api/v1"
+
+	"github.com/kube-bind/kube-bind/contrib/example-backend/cookie"
+	kuberesources "github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes/resources"
+	kubebindhelpers "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1/helpers"
 )
 
+var themeColorRegexp = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// cookieNamePrefixRegexp restricts the cookie name prefix to characters valid in
+// cookie names, such that browsers do not reject the session cookies.
+var cookieNamePrefixRegexp = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// MinResyncPeriod is the shortest informer resync period, such that resyncs do not
+// turn into a constant load on the reconcilers.
+const MinResyncPeriod = time.Minute
+
+// MinServiceAccountTokenTTL is the shortest lifetime the TokenRequest API accepts.
+const MinServiceAccountTokenTTL = 10 * time.Minute
+
+// MaxSessionLifetime bounds the session cookie TTL, such that a leaked cookie
+// cannot be used for longer than a day.
+const MaxSessionLifetime = 24 * time.Hour
+
 type Options struct {
 	Logs  *logs.Options
 	OIDC  *OIDC
@@ -33,10 +68,87 @@ type Options struct {
 	ExtraOptions
 }
 type ExtraOptions struct {
-	KubeConfig string
+	KubeConfig   string
+	Context      string
+	ResyncPeriod time.Duration
+
+	InformerNamespaces []string
+
+	NamespacePrefix    string
+	PrettyName         string
+	ProviderLogoURL    string
+	ProviderThemeColor string
+	IdentityTemplate   string
+	KubeconfigMode     string
+
+	// Identity is parsed from IdentityTemplate at completion.
+	Identity *template.Template
+
+	TargetNamespacePattern string
+
+	NamespaceTTL      time.Duration
+	NamespaceGCDryRun bool
+
+	OwnerReferences bool
+
+	ServiceAccountTokenTTL time.Duration
+
+	// KubeconfigExec* configure the exec credential plugin of exec kubeconfigs.
+	KubeconfigExecCommand    string
+	KubeconfigExecArgs       []string
+	KubeconfigExecAPIVersion string
+
+	Stateless        bool
+	SessionCookieTTL time.Duration
+
+	ForbiddenGroups []string
 
-	NamespacePrefix string
-	PrettyName      string
+	MaxBindingsPerSubject int
+
+	AuthorizationWebhookURL      string
+	AuthorizationWebhookTimeout  time.Duration
+	AuthorizationWebhookFailOpen bool
+
+	AuthorizationSubjectAccessReview bool
+	AuthorizationGroupsClaim         string
+	AuthorizationGroupsPrefix        string
+
+	ClaimLabels []string
+
+	MinConsumerVersion string
+
+	CallbackCheckTimeout time.Duration
+	CallbackCheckRetries int
+	CallbackCheckHosts   []string
+
+	MaxInlineAuthResponseBytes int
+
+	AuthCodeStorage       string
+	StateTTL              time.Duration
+	AuthCodeSweepInterval time.Duration
+	ServerSessionIDs      bool
+
+	ResourcesETag   bool
+	BindLandingPage bool
+
+	MaintenanceMode bool
+
+	// AdminToken is read from AdminTokenFile at completion.
+	AdminTokenFile string
+	AdminToken     string
+
+	// AuthResponseSigningKey is read from AuthResponseSigningKeyFile at completion.
+	AuthResponseSigningKeyFile string
+	AuthResponseSigningKey     ed25519.PrivateKey
+
+	// AuthResponseVerificationKeys are read from AuthResponseVerificationKeyFiles at completion.
+	AuthResponseVerificationKeyFiles []string
+	AuthResponseVerificationKeys     []ed25519.PublicKey
+
+	// CookieSigningKeys are read from CookieSigningKeyFiles at completion.
+	CookieSigningKeyFiles []string
+	CookieSigningKeys     [][]byte
+	CookieNamePrefix      string
 
 	TestingAutoSelect string
 }
@@ -64,8 +176,35 @@ func NewOptions() *Options {
 		Serve: NewServe(),
 
 		ExtraOptions: ExtraOptions{
-			NamespacePrefix: "cluster",
-			PrettyName:      "Example Backend",
+			ResyncPeriod: 30 * time.Minute,
+
+			NamespacePrefix:          "cluster",
+			PrettyName:               "Example Backend",
+			IdentityTemplate:         "{{.iss}}/{{.sub}}",
+			KubeconfigMode:           "serviceaccount",
+			KubeconfigExecAPIVersion: "client.authentication.k8s.io/v1",
+
+			NamespaceGCDryRun: true,
+
+			OwnerReferences: true,
+
+			SessionCookieTTL: time.Hour,
+
+			ForbiddenGroups: kubebindhelpers.DefaultForbiddenGroups,
+
+			AuthorizationWebhookTimeout: 5 * time.Second,
+			AuthorizationGroupsClaim:    "groups",
+			AuthorizationGroupsPrefix:   "kube-bind:",
+
+			CallbackCheckRetries: 2,
+
+			MaxInlineAuthResponseBytes: 6 * 1024,
+
+			AuthCodeStorage:       "state",
+			StateTTL:              10 * time.Minute,
+			AuthCodeSweepInterval: time.Minute,
+
+			CookieNamePrefix: cookie.DefaultNamePrefix,
 		},
 	}
 }
@@ -76,8 +215,52 @@ func (options *Options) AddFlags(fs *pflag.FlagSet) {
 	options.Serve.AddFlags(fs)
 
 	fs.StringVar(&options.KubeConfig, "kubeconfig", options.KubeConfig, "path to a kubeconfig. Only required if out-of-cluster")
+	fs.StringVar(&options.Context, "context", options.Context, "The kubeconfig context to use. Defaults to the current context of the kubeconfig")
+	fs.DurationVar(&options.ResyncPeriod, "resync-period", options.ResyncPeriod, fmt.Sprintf("How often informers resync and requeue all objects, at least %s", MinResyncPeriod))
+	fs.StringSliceVar(&options.InformerNamespaces, "informer-namespaces", options.InformerNamespaces, "Namespaces to watch namespaced objects in, instead of all namespaces. Consumers must choose one of them as target namespace, hence requires a --target-namespace-pattern matching them. Every identity needs a namespace of its own, i.e. this bounds the number of consumers")
 	fs.StringVar(&options.NamespacePrefix, "namespace-prefix", options.NamespacePrefix, "The prefix to use for cluster namespaces")
 	fs.StringVar(&options.PrettyName, "pretty-name", options.PrettyName, "Pretty name for the backend")
+	fs.StringVar(&options.ProviderLogoURL, "provider-logo-url", options.ProviderLogoURL, "URL of the provider logo shown by consumers on the consent screen")
+	fs.StringVar(&options.ProviderThemeColor, "provider-theme-color", options.ProviderThemeColor, "Theme color of the provider as hex RGB value, e.g. #326ce5")
+	fs.StringVar(&options.IdentityTemplate, "identity-template", options.IdentityTemplate, "Go template over the ID token claims used to derive the stable identity of a user, e.g. '{{.tid}}/{{.email}}'. Namespaces of identities derived from the sub claim alone move over to the templated identity on the next bind")
+
+	fs.StringVar(&options.KubeconfigMode, "kubeconfig-mode", options.KubeconfigMode, "How the kubeconfig handed to consumers authenticates: 'serviceaccount' for a service account per consumer, 'impersonation' for a service account per consumer that may only impersonate a user per consumer")
+	fs.StringVar(&options.TargetNamespacePattern, "target-namespace-pattern", options.TargetNamespacePattern, "Regular expression of namespace names consumers may choose with the targetNamespace parameter. Empty disallows choosing a namespace")
+	fs.DurationVar(&options.NamespaceTTL, "namespace-ttl", options.NamespaceTTL, "Delete consumer namespaces without a bind for longer than this duration. Zero disables the garbage collection")
+	fs.BoolVar(&options.NamespaceGCDryRun, "namespace-gc-dry-run", options.NamespaceGCDryRun, "Only log the consumer namespaces the garbage collection would delete")
+	fs.BoolVar(&options.OwnerReferences, "owner-references", options.OwnerReferences, "Make the consumer namespace the owner of the objects provisioned for the consumer, such that deleting the namespace also deletes the cluster-scoped ones")
+	fs.DurationVar(&options.ServiceAccountTokenTTL, "service-account-token-ttl", options.ServiceAccountTokenTTL, fmt.Sprintf("Lifetime of bound service account tokens in kubeconfigs handed to consumers, which are re-minted before they expire. At least %s. Zero uses non-expiring legacy token secrets. Only for --kubeconfig-mode=serviceaccount", MinServiceAccountTokenTTL))
+	fs.StringVar(&options.KubeconfigExecCommand, "kubeconfig-exec-command", options.KubeconfigExecCommand, "Command of the exec credential plugin in kubeconfigs requested with kubeconfigFormat=exec at /bind, instead of embedding the credentials. It gets the consumer namespace in the "+kuberesources.ExecNamespaceEnv+" environment variable and must be available where the kubeconfig is used, usually the konnector. Empty disables exec kubeconfigs")
+	fs.StringSliceVar(&options.KubeconfigExecArgs, "kubeconfig-exec-args", options.KubeconfigExecArgs, "Arguments of --kubeconfig-exec-command")
+	fs.StringVar(&options.KubeconfigExecAPIVersion, "kubeconfig-exec-api-version", options.KubeconfigExecAPIVersion, "ExecCredential API version of --kubeconfig-exec-command, client.authentication.k8s.io/v1 or client.authentication.k8s.io/v1beta1")
+	fs.BoolVar(&options.Stateless, "stateless", options.Stateless, "Do not request refresh tokens and end the session with the first bind, e.g. for short-lived automation")
+	fs.DurationVar(&options.SessionCookieTTL, "session-cookie-ttl", options.SessionCookieTTL, fmt.Sprintf("Lifetime of the session and its cookie, at most %s", MaxSessionLifetime))
+	fs.StringSliceVar(&options.ForbiddenGroups, "forbidden-groups", options.ForbiddenGroups, "API groups that can never be exported. A leading '*.' matches all subdomains")
+	fs.IntVar(&options.MaxBindingsPerSubject, "max-bindings-per-subject", options.MaxBindingsPerSubject, "Maximal number of resources a user can bind, including binds in progress. Rebinding a bound resource is always allowed. Zero is unlimited")
+	fs.StringVar(&options.AuthorizationWebhookURL, "authorization-webhook-url", options.AuthorizationWebhookURL, "URL a BindReview is posted to before every bind, approving or denying it. Empty allows all binds")
+	fs.DurationVar(&options.AuthorizationWebhookTimeout, "authorization-webhook-timeout", options.AuthorizationWebhookTimeout, "Timeout of the authorization webhook")
+	fs.BoolVar(&options.AuthorizationWebhookFailOpen, "authorization-webhook-fail-open", options.AuthorizationWebhookFailOpen, "Allow binds if the authorization webhook cannot be reached or fails, instead of failing them. Requires --authorization-webhook-url")
+	fs.BoolVar(&options.AuthorizationSubjectAccessReview, "authorization-subject-access-review", options.AuthorizationSubjectAccessReview, "Allow a bind only if a SubjectAccessReview in the service provider cluster permits the user the 'bind' verb on the resource, in the target namespace if chosen. The user is the identity prefixed with 'kube-bind:'")
+	fs.StringVar(&options.AuthorizationGroupsClaim, "authorization-groups-claim", options.AuthorizationGroupsClaim, "ID token claim with the groups of the user in SubjectAccessReviews. Empty omits groups")
+	fs.StringVar(&options.AuthorizationGroupsPrefix, "authorization-groups-prefix", options.AuthorizationGroupsPrefix, "Prefix of the groups of the user in SubjectAccessReviews, keeping IdP groups apart from Kubernetes groups. Groups starting with 'system:' are always dropped")
+	fs.StringArrayVar(&options.ClaimLabels, "claim-label", options.ClaimLabels, "<claim>=<labelKey> mapping of an ID token claim to a label on new consumer namespaces, e.g. department=example.com/department. Can be repeated")
+	fs.StringVar(&options.MinConsumerVersion, "min-consumer-version", options.MinConsumerVersion, "Oldest Kubernetes version of consumer clusters to support, e.g. 1.24. Exports using CRD features not served by it are flagged with the ConsumerVersionSupported condition. Empty disables the check")
+	fs.DurationVar(&options.CallbackCheckTimeout, "callback-check-timeout", options.CallbackCheckTimeout, "Timeout of each attempt to reach the consumer callback on one of the --callback-check-hosts before redirecting to it after a bind. Zero disables the check")
+	fs.IntVar(&options.CallbackCheckRetries, "callback-check-retries", options.CallbackCheckRetries, "Number of times to retry reaching the consumer callback before failing the bind")
+	fs.StringSliceVar(&options.CallbackCheckHosts, "callback-check-hosts", options.CallbackCheckHosts, "Hosts of consumer callbacks to check the reachability of, e.g. bind.example.com. Callbacks on other hosts are not checked. Loopback callbacks, like the usual localhost one of kubectl bind, are on the consumer machine and never checked, hence loopback hosts are refused. Hosts may resolve to private addresses, but never to loopback or link-local ones")
+	fs.StringVar(&options.AuthCodeStorage, "auth-code-storage", options.AuthCodeStorage, "Where the consumer redirect URL and session id are kept during authorization: 'state' to pass them through the identity provider in the OAuth2 state parameter, 'server' to keep them in the backend and pass only an opaque id. 'server' requires a single backend replica")
+	fs.DurationVar(&options.StateTTL, "state-ttl", options.StateTTL, "Maximal age of the OAuth2 state when the identity provider calls back. Older states are rejected to prevent replays. Zero disables the check. With --auth-code-storage=server, it is also the lifetime of the stored auth codes, 10m if zero")
+	fs.DurationVar(&options.AuthCodeSweepInterval, "auth-code-sweep-interval", options.AuthCodeSweepInterval, "Interval of removing expired auth codes of --auth-code-storage=server, which were never called back for")
+	fs.BoolVar(&options.ServerSessionIDs, "server-session-ids", options.ServerSessionIDs, "Generate session ids, which name the session cookies, in the backend instead of using the one chosen by the consumer. The consumer id is still returned in the auth response for correlation. Requires --auth-code-storage=server")
+	fs.BoolVar(&options.ResourcesETag, "resources-etag", options.ResourcesETag, "Serve the resources page with an ETag over the offered CRDs, such that browsers revalidate it instead of fetching it again")
+	fs.BoolVar(&options.BindLandingPage, "bind-landing-page", options.BindLandingPage, "Show a page summarizing the bound resource after a bind, with a link continuing to the consumer, instead of redirecting to the consumer right away. The landing query parameter of /bind overrides it per bind")
+	fs.BoolVar(&options.MaintenanceMode, "maintenance-mode", options.MaintenanceMode, "Start in maintenance mode, e.g. during migrations: the resources page keeps being served, but binds are refused with 503. With an admin token, it can be toggled at runtime with PUT /admin/maintenance")
+	fs.IntVar(&options.MaxInlineAuthResponseBytes, "max-inline-auth-response-bytes", options.MaxInlineAuthResponseBytes, "Maximal size of the encoded auth response passed to the consumer in the redirect URL. Larger responses are claimed by the consumer at /claim with a one-time token. Zero always passes it in the URL")
+	fs.StringVar(&options.AdminTokenFile, "admin-token-file", options.AdminTokenFile, "File containing the bearer token for the /admin endpoints and /metrics. Empty disables them")
+	fs.StringVar(&options.AuthResponseSigningKeyFile, "auth-response-signing-key-file", options.AuthResponseSigningKeyFile, "File containing a PEM encoded PKCS #8 Ed25519 private key to sign auth responses with. The public key is advertised at /export, such that consumers reject tampered responses. Empty disables signing")
+	fs.StringSliceVar(&options.AuthResponseVerificationKeyFiles, "auth-response-verification-key-files", options.AuthResponseVerificationKeyFiles, "Files containing PEM encoded PKIX Ed25519 public keys advertised at /export next to the signing key, such that consumers accept responses signed with them during key rotation. Requires --auth-response-signing-key-file")
+	fs.StringSliceVar(&options.CookieSigningKeyFiles, "cookie-signing-key-files", options.CookieSigningKeyFiles, fmt.Sprintf("Files containing keys of at least %d bytes to encrypt session cookies and sign the auth codes in the state parameter with, using keys derived per purpose. The first key encrypts and signs, all keys decrypt and verify. To rotate, prepend the new key and remove the old one once the cookies and states protected with it expired. Empty disables encrypting cookies, and signs the state with a key generated at startup", cookie.MinKeyLength))
+	fs.StringVar(&options.CookieNamePrefix, "cookie-name-prefix", options.CookieNamePrefix, "Prefix of the session cookie names, followed by the session id. Backends sharing a domain need distinct prefixes for their cookies not to collide")
 
 	fs.StringVar(&options.TestingAutoSelect, "testing-auto-select", options.TestingAutoSelect, "<resource>.<group> that is automatically selected on th bind screen for testing")
 	fs.MarkHidden("testing-auto-select") // nolint: errcheck
@@ -90,6 +273,58 @@ func (options *Options) Complete() (*CompletedOptions, error) {
 	if err := options.Serve.Complete(); err != nil {
 		return nil, err
 	}
+	identity, err := ParseIdentityTemplate(options.IdentityTemplate)
+	if err != nil {
+		return nil, err
+	}
+	options.Identity = identity
+	if options.AdminTokenFile != "" {
+		bs, err := os.ReadFile(options.AdminTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read admin token file: %w", err)
+		}
+		options.AdminToken = strings.TrimSpace(string(bs))
+	}
+	if options.AuthResponseSigningKeyFile != "" {
+		bs, err := os.ReadFile(options.AuthResponseSigningKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read auth response signing key file: %w", err)
+		}
+		if options.AuthResponseSigningKey, err = ParseSigningKey(bs); err != nil {
+			return nil, fmt.Errorf("invalid auth response signing key file %q: %w", options.AuthResponseSigningKeyFile, err)
+		}
+	}
+	options.AuthResponseVerificationKeys = nil
+	for _, file := range options.AuthResponseVerificationKeyFiles {
+		bs, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read auth response verification key file: %w", err)
+		}
+		key, err := ParseVerificationKey(bs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid auth response verification key file %q: %w", file, err)
+		}
+		options.AuthResponseVerificationKeys = append(options.AuthResponseVerificationKeys, key)
+	}
+	options.CookieSigningKeys = nil
+	for _, file := range options.CookieSigningKeyFiles {
+		bs, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cookie signing key file: %w", err)
+		}
+		options.CookieSigningKeys = append(options.CookieSigningKeys, bytes.TrimSpace(bs))
+	}
+	if options.Context != "" {
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		rules.ExplicitPath = options.KubeConfig
+		cfg, err := rules.Load()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+		}
+		if _, found := cfg.Contexts[options.Context]; !found {
+			return nil, fmt.Errorf("context %q not found in kubeconfig", options.Context)
+		}
+	}
 
 	return &CompletedOptions{
 		completedOptions: &completedOptions{
@@ -108,10 +343,261 @@ func (options *CompletedOptions) Validate() error {
 	if options.PrettyName == "" {
 		return fmt.Errorf("pretty name cannot be empty")
 	}
+	if err := validateInformerNamespaces(options.InformerNamespaces); err != nil {
+		return fmt.Errorf("invalid informer namespaces: %w", err)
+	}
+	if options.ProviderLogoURL != "" {
+		if u, err := url.Parse(options.ProviderLogoURL); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("provider logo URL must be an absolute URL")
+		}
+	}
+	if options.ProviderThemeColor != "" && !themeColorRegexp.MatchString(options.ProviderThemeColor) {
+		return fmt.Errorf("provider theme color must be a hex RGB value like #326ce5")
+	}
+	if options.KubeconfigMode != "serviceaccount" && options.KubeconfigMode != "impersonation" {
+		return fmt.Errorf("kubeconfig mode must be one of 'serviceaccount' or 'impersonation'")
+	}
+	if options.ServiceAccountTokenTTL != 0 {
+		if options.ServiceAccountTokenTTL < MinServiceAccountTokenTTL {
+			return fmt.Errorf("service account token TTL must be zero or at least %s", MinServiceAccountTokenTTL)
+		}
+		if options.KubeconfigMode != "serviceaccount" {
+			return fmt.Errorf("service account token TTL requires kubeconfig mode 'serviceaccount'")
+		}
+	}
+	if options.KubeconfigExecCommand == "" && len(options.KubeconfigExecArgs) > 0 {
+		return fmt.Errorf("kubeconfig exec args require a kubeconfig exec command")
+	}
+	if options.KubeconfigExecAPIVersion != "client.authentication.k8s.io/v1" && options.KubeconfigExecAPIVersion != "client.authentication.k8s.io/v1beta1" {
+		return fmt.Errorf("kubeconfig exec API version must be one of 'client.authentication.k8s.io/v1' or 'client.authentication.k8s.io/v1beta1'")
+	}
+	if options.TargetNamespacePattern != "" {
+		if _, err := regexp.Compile(options.TargetNamespacePattern); err != nil {
+			return fmt.Errorf("invalid target namespace pattern: %w", err)
+		}
+	}
+	if err := kubebindhelpers.ValidateGroupPatterns(options.ForbiddenGroups); err != nil {
+		return fmt.Errorf("invalid forbidden groups: %w", err)
+	}
+	if options.MaxBindingsPerSubject < 0 {
+		return fmt.Errorf("max bindings per subject cannot be negative")
+	}
+	if options.AuthorizationWebhookURL != "" {
+		if u, err := url.Parse(options.AuthorizationWebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("authorization webhook URL must be an absolute http or https URL")
+		}
+		if options.AuthorizationWebhookTimeout <= 0 {
+			return fmt.Errorf("authorization webhook timeout must be positive")
+		}
+	}
+	if options.AuthorizationSubjectAccessReview && options.AuthorizationWebhookURL != "" {
+		return fmt.Errorf("authorization with SubjectAccessReviews and an authorization webhook are mutually exclusive")
+	}
+	if strings.HasPrefix(options.AuthorizationGroupsPrefix, "system:") {
+		return fmt.Errorf("authorization groups prefix must not start with \"system:\"")
+	}
+	if _, err := ParseClaimLabels(options.ClaimLabels); err != nil {
+		return err
+	}
+	if options.MinConsumerVersion != "" {
+		if _, err := version.ParseGeneric(options.MinConsumerVersion); err != nil {
+			return fmt.Errorf("invalid minimum consumer version: %w", err)
+		}
+	}
+	if options.CallbackCheckTimeout < 0 {
+		return fmt.Errorf("callback check timeout cannot be negative")
+	}
+	if options.CallbackCheckRetries < 0 {
+		return fmt.Errorf("callback check retries cannot be negative")
+	}
+	if options.CallbackCheckTimeout > 0 && len(options.CallbackCheckHosts) == 0 {
+		return fmt.Errorf("callback check requires callback check hosts")
+	}
+	for _, host := range options.CallbackCheckHosts {
+		if isLoopbackHost(host) {
+			return fmt.Errorf("callback check host %q is a loopback host, which callbacks of the consumer machine are on and are never checked", host)
+		}
+	}
+	if options.AuthCodeStorage != "state" && options.AuthCodeStorage != "server" {
+		return fmt.Errorf("auth code storage must be one of 'state' or 'server'")
+	}
+	if options.StateTTL < 0 {
+		return fmt.Errorf("state TTL cannot be negative")
+	}
+	if options.AuthCodeSweepInterval <= 0 {
+		return fmt.Errorf("auth code sweep interval must be positive")
+	}
+	if options.ServerSessionIDs && options.AuthCodeStorage != "server" {
+		return fmt.Errorf("server session ids require auth code storage 'server'")
+	}
+	if options.MaxInlineAuthResponseBytes < 0 {
+		return fmt.Errorf("max inline auth response bytes cannot be negative")
+	}
+	if options.AdminTokenFile != "" && options.AdminToken == "" {
+		return fmt.Errorf("admin token file %q is empty", options.AdminTokenFile)
+	}
+	if len(options.AuthResponseVerificationKeyFiles) > 0 && options.AuthResponseSigningKeyFile == "" {
+		return fmt.Errorf("auth response verification keys require an auth response signing key")
+	}
+	for i, key := range options.CookieSigningKeys {
+		if len(key) < cookie.MinKeyLength {
+			return fmt.Errorf("cookie signing key file %q must contain at least %d bytes", options.CookieSigningKeyFiles[i], cookie.MinKeyLength)
+		}
+	}
+	if !cookieNamePrefixRegexp.MatchString(options.CookieNamePrefix) {
+		return fmt.Errorf("cookie name prefix %q must be non-empty and consist of letters, digits, '.', '_' or '-'", options.CookieNamePrefix)
+	}
+	if options.ResyncPeriod < MinResyncPeriod {
+		return fmt.Errorf("resync period must be at least %s", MinResyncPeriod)
+	}
+	if err := validateSessionCookieTTL(options.SessionCookieTTL); err != nil {
+		return err
+	}
+	if options.NamespaceTTL < 0 {
+		return fmt.Errorf("namespace TTL cannot be negative")
+	}
+	if options.IdentityTemplate == "" {
+		return fmt.Errorf("identity template cannot be empty")
+	}
 
 	if err := options.OIDC.Validate(); err != nil {
 		return err
 	}
+	if err := options.Serve.Validate(); err != nil {
+		return err
+	}
+	if err := options.validateCombinations(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// validateCombinations rejects options that are valid on their own, but contradict
+// each other.
+func (options *CompletedOptions) validateCombinations() error {
+	if options.AuthorizationWebhookFailOpen && options.AuthorizationWebhookURL == "" {
+		return fmt.Errorf("authorization webhook fail-open requires an authorization webhook URL")
+	}
+	if options.Serve.CertFile != "" {
+		if u, err := url.Parse(options.OIDC.CallbackURL); err == nil && u.Scheme == "http" {
+			return fmt.Errorf("OIDC callback URL %q must use https when serving TLS", options.OIDC.CallbackURL)
+		}
+	}
+	if len(options.InformerNamespaces) > 0 {
+		// generated consumer namespaces are never one of the informer namespaces.
+		if options.TargetNamespacePattern == "" {
+			return fmt.Errorf("informer namespaces require a target namespace pattern, as generated consumer namespaces are not watched")
+		}
+		pattern, err := regexp.Compile("^(?:" + options.TargetNamespacePattern + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid target namespace pattern: %w", err)
+		}
+		for _, ns := range options.InformerNamespaces {
+			if !pattern.MatchString(ns) {
+				return fmt.Errorf("target namespace pattern %q does not match informer namespace %q", options.TargetNamespacePattern, ns)
+			}
+		}
+	}
+	return nil
+}
+
+// ParseSigningKey parses a PEM encoded PKCS #8 Ed25519 private key.
+func ParseSigningKey(bs []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(bs)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("no PEM encoded PRIVATE KEY found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is %T, must be Ed25519", key)
+	}
+	return edKey, nil
+}
+
+// ParseVerificationKey parses a PEM encoded PKIX Ed25519 public key.
+func ParseVerificationKey(bs []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(bs)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("no PEM encoded PUBLIC KEY found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is %T, must be Ed25519", key)
+	}
+	return edKey, nil
+}
 
+// ParseClaimLabels parses <claim>=<labelKey> mappings into a map from claim to
+// label key.
+func ParseClaimLabels(mappings []string) (map[string]string, error) {
+	labels := make(map[string]string, len(mappings))
+	for _, mapping := range mappings {
+		claim, key, found := strings.Cut(mapping, "=")
+		if !found || claim == "" {
+			return nil, fmt.Errorf("invalid claim label %q, must be <claim>=<labelKey>", mapping)
+		}
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid label key %q of claim %q: %s", key, claim, strings.Join(errs, ", "))
+		}
+		if _, found := labels[claim]; found {
+			return nil, fmt.Errorf("duplicate claim label for claim %q", claim)
+		}
+		labels[claim] = key
+	}
+	return labels, nil
+}
+
+func validateSessionCookieTTL(ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("session cookie TTL must be positive")
+	}
+	if ttl > MaxSessionLifetime {
+		return fmt.Errorf("session cookie TTL must not exceed the max session lifetime of %s", MaxSessionLifetime)
+	}
 	return nil
 }
+
+// isLoopbackHost returns whether host is a loopback name or address.
+func isLoopbackHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func validateInformerNamespaces(namespaces []string) error {
+	seen := make(map[string]bool, len(namespaces))
+	for _, ns := range namespaces {
+		if ns == "" {
+			return fmt.Errorf("namespace cannot be empty")
+		}
+		if errs := validation.IsDNS1123Label(ns); len(errs) > 0 {
+			return fmt.Errorf("invalid namespace %q: %s", ns, strings.Join(errs, ", "))
+		}
+		if seen[ns] {
+			return fmt.Errorf("duplicate namespace %q", ns)
+		}
+		seen[ns] = true
+	}
+	return nil
+}
+
+// ParseIdentityTemplate parses the Go template deriving the identity of a user from
+// the claims of the ID token. Missing claims fail rendering.
+func ParseIdentityTemplate(identityTemplate string) (*template.Template, error) {
+	tmpl, err := template.New("identity").Option("missingkey=error").Parse(identityTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity template: %w", err)
+	}
+	return tmpl, nil
+}
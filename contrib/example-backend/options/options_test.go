@@ -0,0 +1,402 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+func TestValidateSessionCookieTTL(t *testing.T) {
+	tests := []struct {
+		ttl     time.Duration
+		wantErr bool
+	}{
+		{ttl: time.Hour},
+		{ttl: MaxSessionLifetime},
+		{ttl: 0, wantErr: true},
+		{ttl: -time.Hour, wantErr: true},
+		{ttl: MaxSessionLifetime + time.Second, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ttl.String(), func(t *testing.T) {
+			err := validateSessionCookieTTL(tt.ttl)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateResyncPeriod(t *testing.T) {
+	opts := NewOptions()
+	opts.ResyncPeriod = time.Second
+	completed, err := opts.Complete()
+	require.NoError(t, err)
+	require.ErrorContains(t, completed.Validate(), "resync period")
+}
+
+func TestCompleteIdentityTemplate(t *testing.T) {
+	opts := NewOptions()
+	completed, err := opts.Complete()
+	require.NoError(t, err)
+	require.NotNil(t, completed.Identity)
+
+	opts = NewOptions()
+	opts.IdentityTemplate = "{{.sub"
+	_, err = opts.Complete()
+	require.ErrorContains(t, err, "invalid identity template")
+}
+
+func TestValidateCallbackCheckHosts(t *testing.T) {
+	opts := NewOptions()
+	opts.CallbackCheckTimeout = time.Second
+	completed, err := opts.Complete()
+	require.NoError(t, err)
+	require.ErrorContains(t, completed.Validate(), "callback check hosts")
+
+	completed.CallbackCheckHosts = []string{"bind.example.com"}
+	require.NotContains(t, fmt.Sprint(completed.Validate()), "callback check hosts")
+
+	for _, host := range []string{"localhost", "bind.localhost", "127.0.0.1", "::1"} {
+		completed.CallbackCheckHosts = []string{"bind.example.com", host}
+		require.ErrorContains(t, completed.Validate(), "loopback host", host)
+	}
+}
+
+func TestValidateServerSessionIDs(t *testing.T) {
+	opts := NewOptions()
+	opts.ServerSessionIDs = true
+	completed, err := opts.Complete()
+	require.NoError(t, err)
+	require.ErrorContains(t, completed.Validate(), "server session ids")
+
+	completed.AuthCodeStorage = "server"
+	require.NotContains(t, fmt.Sprint(completed.Validate()), "server session ids")
+}
+
+func TestValidateAuthCodeSweepInterval(t *testing.T) {
+	opts := NewOptions()
+	opts.AuthCodeSweepInterval = 0
+	completed, err := opts.Complete()
+	require.NoError(t, err)
+	require.ErrorContains(t, completed.Validate(), "auth code sweep interval")
+}
+
+func TestValidateMaxBindingsPerSubject(t *testing.T) {
+	opts := NewOptions()
+	opts.MaxBindingsPerSubject = -1
+	completed, err := opts.Complete()
+	require.NoError(t, err)
+	require.ErrorContains(t, completed.Validate(), "max bindings per subject")
+}
+
+func TestValidateAuthorizationWebhook(t *testing.T) {
+	opts := NewOptions()
+	opts.AuthorizationWebhookURL = "/authorize"
+	completed, err := opts.Complete()
+	require.NoError(t, err)
+	require.ErrorContains(t, completed.Validate(), "authorization webhook URL")
+
+	completed.AuthorizationWebhookURL = "https://policy.example.com/bind"
+	completed.AuthorizationWebhookTimeout = 0
+	require.ErrorContains(t, completed.Validate(), "authorization webhook timeout")
+
+	completed.AuthorizationWebhookTimeout = time.Second
+	require.NotContains(t, fmt.Sprint(completed.Validate()), "authorization webhook")
+
+	completed.AuthorizationSubjectAccessReview = true
+	require.ErrorContains(t, completed.Validate(), "mutually exclusive")
+
+	completed.AuthorizationSubjectAccessReview = false
+	completed.AuthorizationGroupsPrefix = "system:kube-bind:"
+	require.ErrorContains(t, completed.Validate(), "authorization groups prefix")
+}
+
+func TestValidateKubeconfigExec(t *testing.T) {
+	opts := NewOptions()
+	opts.KubeconfigExecArgs = []string{"--provider", "example"}
+	completed, err := opts.Complete()
+	require.NoError(t, err)
+	require.ErrorContains(t, completed.Validate(), "kubeconfig exec args")
+
+	completed.KubeconfigExecCommand = "kube-bind-credentials"
+	completed.KubeconfigExecAPIVersion = "client.authentication.k8s.io/v1alpha1"
+	require.ErrorContains(t, completed.Validate(), "kubeconfig exec API version")
+
+	completed.KubeconfigExecAPIVersion = "client.authentication.k8s.io/v1beta1"
+	require.NotContains(t, fmt.Sprint(completed.Validate()), "kubeconfig exec")
+}
+
+func TestValidateServiceAccountTokenTTL(t *testing.T) {
+	tests := []struct {
+		name           string
+		ttl            time.Duration
+		kubeconfigMode string
+		wantErr        string
+	}{
+		{name: "legacy token secrets", kubeconfigMode: "serviceaccount"},
+		{name: "bound tokens", ttl: time.Hour, kubeconfigMode: "serviceaccount"},
+		{name: "too short", ttl: time.Minute, kubeconfigMode: "serviceaccount", wantErr: "at least 10m0s"},
+		{name: "negative", ttl: -time.Hour, kubeconfigMode: "serviceaccount", wantErr: "at least 10m0s"},
+		{name: "impersonation", ttl: time.Hour, kubeconfigMode: "impersonation", wantErr: "requires kubeconfig mode 'serviceaccount'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewOptions()
+			opts.ServiceAccountTokenTTL = tt.ttl
+			opts.KubeconfigMode = tt.kubeconfigMode
+			completed, err := opts.Complete()
+			require.NoError(t, err)
+			err = completed.Validate()
+			if tt.wantErr == "" {
+				require.NotContains(t, fmt.Sprint(err), "service account token TTL")
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestCompleteContext(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, clientcmd.WriteToFile(clientcmdapi.Config{
+		Clusters: map[string]*clientcmdapi.Cluster{
+			"east": {Server: "https://east.example.com"},
+			"west": {Server: "https://west.example.com"},
+		},
+		AuthInfos: map[string]*clientcmdapi.AuthInfo{"admin": {Token: "token"}},
+		Contexts: map[string]*clientcmdapi.Context{
+			"east": {Cluster: "east", AuthInfo: "admin"},
+			"west": {Cluster: "west", AuthInfo: "admin"},
+		},
+		CurrentContext: "east",
+	}, kubeconfig))
+
+	opts := NewOptions()
+	opts.KubeConfig = kubeconfig
+	opts.Context = "west"
+	_, err := opts.Complete()
+	require.NoError(t, err)
+
+	opts.Context = "north"
+	_, err = opts.Complete()
+	require.ErrorContains(t, err, `context "north" not found in kubeconfig`)
+}
+
+func TestValidateInformerNamespaces(t *testing.T) {
+	tests := []struct {
+		namespaces []string
+		wantErr    string
+	}{
+		{namespaces: nil},
+		{namespaces: []string{"kube-bind"}},
+		{namespaces: []string{""}, wantErr: "namespace cannot be empty"},
+		{namespaces: []string{"Kube_Bind"}, wantErr: `invalid namespace "Kube_Bind"`},
+		{namespaces: []string{"kube-bind", "kube-bind"}, wantErr: `duplicate namespace "kube-bind"`},
+		{namespaces: []string{"east", "west"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.namespaces), func(t *testing.T) {
+			err := validateInformerNamespaces(tt.namespaces)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseSigningKey(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+
+	key, err := ParseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+	require.Equal(t, priv, key)
+
+	_, err = ParseSigningKey([]byte("no pem"))
+	require.ErrorContains(t, err, "no PEM encoded PRIVATE KEY")
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	der, err = x509.MarshalPKCS8PrivateKey(rsaKey)
+	require.NoError(t, err)
+	_, err = ParseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	require.ErrorContains(t, err, "must be Ed25519")
+}
+
+func TestCompleteAuthResponseVerificationKeys(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	signingKeyFile := filepath.Join(dir, "signing.pem")
+	require.NoError(t, os.WriteFile(signingKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	retired, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err = x509.MarshalPKIXPublicKey(retired)
+	require.NoError(t, err)
+	verificationKeyFile := filepath.Join(dir, "retired.pem")
+	require.NoError(t, os.WriteFile(verificationKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+
+	opts := NewOptions()
+	opts.AuthResponseVerificationKeyFiles = []string{verificationKeyFile}
+	completed, err := opts.Complete()
+	require.NoError(t, err)
+	require.Equal(t, []ed25519.PublicKey{retired}, completed.AuthResponseVerificationKeys)
+	require.ErrorContains(t, completed.Validate(), "require an auth response signing key")
+
+	opts.AuthResponseSigningKeyFile = signingKeyFile
+	completed, err = opts.Complete()
+	require.NoError(t, err)
+	require.Equal(t, pub, completed.AuthResponseSigningKey.Public())
+	require.NotContains(t, fmt.Sprint(completed.Validate()), "auth response")
+
+	opts.AuthResponseVerificationKeyFiles = []string{signingKeyFile}
+	_, err = opts.Complete()
+	require.ErrorContains(t, err, "no PEM encoded PUBLIC KEY")
+}
+
+func TestCompleteCookieSigningKeys(t *testing.T) {
+	dir := t.TempDir()
+	current := filepath.Join(dir, "current")
+	require.NoError(t, os.WriteFile(current, []byte("0123456789abcdef0123456789abcdef\n"), 0o600))
+	short := filepath.Join(dir, "short")
+	require.NoError(t, os.WriteFile(short, []byte("too short"), 0o600))
+
+	opts := NewOptions()
+	opts.CookieSigningKeyFiles = []string{current, short}
+	completed, err := opts.Complete()
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{[]byte("0123456789abcdef0123456789abcdef"), []byte("too short")}, completed.CookieSigningKeys)
+	require.ErrorContains(t, completed.Validate(), fmt.Sprintf("cookie signing key file %q must contain at least 32 bytes", short))
+
+	opts.CookieSigningKeyFiles = []string{filepath.Join(dir, "missing")}
+	_, err = opts.Complete()
+	require.ErrorContains(t, err, "failed to read cookie signing key file")
+}
+
+func TestValidateCombinations(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(o *Options)
+		wantErr string
+	}{
+		{name: "defaults", mutate: func(o *Options) {}},
+		{
+			name:    "fail-open without webhook",
+			mutate:  func(o *Options) { o.AuthorizationWebhookFailOpen = true },
+			wantErr: "authorization webhook fail-open requires an authorization webhook URL",
+		},
+		{
+			name: "fail-open with webhook",
+			mutate: func(o *Options) {
+				o.AuthorizationWebhookFailOpen = true
+				o.AuthorizationWebhookURL = "https://policy.example.com/bind"
+			},
+		},
+		{
+			name: "TLS with http callback",
+			mutate: func(o *Options) {
+				o.Serve.CertFile, o.Serve.KeyFile = "tls.crt", "tls.key"
+			},
+			wantErr: `OIDC callback URL "http://localhost:8080/callback" must use https when serving TLS`,
+		},
+		{
+			name: "TLS with https callback",
+			mutate: func(o *Options) {
+				o.Serve.CertFile, o.Serve.KeyFile = "tls.crt", "tls.key"
+				o.OIDC.CallbackURL = "https://backend.example.com/callback"
+			},
+		},
+		{
+			name:    "informer namespaces without target namespace pattern",
+			mutate:  func(o *Options) { o.InformerNamespaces = []string{"consumers"} },
+			wantErr: "informer namespaces require a target namespace pattern, as generated consumer namespaces are not watched",
+		},
+		{
+			name: "informer namespaces not matching the target namespace pattern",
+			mutate: func(o *Options) {
+				o.InformerNamespaces = []string{"consumers"}
+				o.TargetNamespacePattern = "consumer-.*"
+			},
+			wantErr: `target namespace pattern "consumer-.*" does not match informer namespace "consumers"`,
+		},
+		{
+			name: "informer namespaces matching the target namespace pattern",
+			mutate: func(o *Options) {
+				o.InformerNamespaces = []string{"consumers"}
+				o.TargetNamespacePattern = "consumers|tenants"
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewOptions()
+			opts.OIDC.IssuerClientID = "client"
+			opts.OIDC.IssuerClientSecret = "secret"
+			opts.OIDC.IssuerURL = "https://issuer.example.com"
+			opts.OIDC.CallbackURL = "http://localhost:8080/callback"
+			tt.mutate(opts)
+			completed, err := opts.Complete()
+			require.NoError(t, err)
+			err = completed.Validate()
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateCookieNamePrefix(t *testing.T) {
+	for _, prefix := range []string{"", "kube bind-", "kube;bind-", "kube=bind-"} {
+		opts := NewOptions()
+		opts.CookieNamePrefix = prefix
+		completed, err := opts.Complete()
+		require.NoError(t, err)
+		require.ErrorContains(t, completed.Validate(), "cookie name prefix", prefix)
+	}
+
+	opts := NewOptions()
+	opts.CookieNamePrefix = "backend_a."
+	completed, err := opts.Complete()
+	require.NoError(t, err)
+	require.NotContains(t, fmt.Sprint(completed.Validate()), "cookie name prefix")
+}
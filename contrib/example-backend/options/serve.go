@@ -28,6 +28,9 @@ type Serve struct {
 	ListenPort        int
 	CertFile, KeyFile string
 
+	MaxRequestBodyBytes int64
+	MaxInFlight         int
+
 	// Listener is used to pre-wire a port zero listener for testing.
 	Listener net.Listener
 }
@@ -36,6 +39,8 @@ func NewServe() *Serve {
 	return &Serve{
 		ListenIP:   "127.0.0.1",
 		ListenPort: 8080,
+
+		MaxRequestBodyBytes: 1 << 20,
 	}
 }
 
@@ -44,6 +49,8 @@ func (options *Serve) AddFlags(fs *pflag.FlagSet) {
 	fs.IntVar(&options.ListenPort, "listen-port", options.ListenPort, "The host port where the backend is running")
 	fs.StringVar(&options.CertFile, "tls-cert-file", options.CertFile, "The TLS certificate file the webserver will use")
 	fs.StringVar(&options.KeyFile, "tls-key-file", options.KeyFile, "The TLS private key file the webserver will use")
+	fs.Int64Var(&options.MaxRequestBodyBytes, "max-request-body-bytes", options.MaxRequestBodyBytes, "Maximum size of request bodies in bytes. Larger requests are rejected with 413")
+	fs.IntVar(&options.MaxInFlight, "max-in-flight", options.MaxInFlight, "Maximum number of requests served concurrently. Further requests are rejected with 503 and Retry-After, except for /healthz and /readyz. Zero disables the limit")
 }
 
 func (options *Serve) Complete() error {
@@ -60,6 +67,12 @@ func (options *Serve) Validate() error {
 	if options.CertFile != "" && options.KeyFile == "" {
 		return fmt.Errorf("TLS cert file cannot be specified without TLS key file")
 	}
+	if options.MaxRequestBodyBytes <= 0 {
+		return fmt.Errorf("max request body bytes must be positive")
+	}
+	if options.MaxInFlight < 0 {
+		return fmt.Errorf("max in-flight requests cannot be negative")
+	}
 
 	return nil
 }
@@ -20,15 +20,23 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"reflect"
+	"time"
 
+	"k8s.io/apimachinery/pkg/util/version"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"k8s.io/klog/v2"
 
 	"github.com/kube-bind/kube-bind/contrib/example-backend/controllers/clusterbinding"
 	"github.com/kube-bind/kube-bind/contrib/example-backend/controllers/serviceexport"
 	"github.com/kube-bind/kube-bind/contrib/example-backend/controllers/serviceexportresource"
 	"github.com/kube-bind/kube-bind/contrib/example-backend/controllers/servicenamespace"
+	"github.com/kube-bind/kube-bind/contrib/example-backend/controllers/tokenrefresh"
+	"github.com/kube-bind/kube-bind/contrib/example-backend/cookie"
 	examplehttp "github.com/kube-bind/kube-bind/contrib/example-backend/http"
 	examplekube "github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes"
+	"github.com/kube-bind/kube-bind/contrib/example-backend/options"
+	"github.com/kube-bind/kube-bind/contrib/example-backend/session"
 )
 
 type Server struct {
@@ -37,6 +45,16 @@ type Server struct {
 	OIDC       *examplehttp.OIDCServiceProvider
 	Kubernetes *examplekube.Manager
 	WebServer  *examplehttp.Server
+	Sessions   *session.Store
+	Claims     *session.ClaimStore
+	AuthCodes  *session.ClaimStore
+
+	Maintenance *examplehttp.Maintenance
+
+	// CallbackURL is the effective OIDC callback URL.
+	CallbackURL string
+
+	NamespaceGC *examplekube.NamespaceGC
 
 	Controllers
 }
@@ -46,6 +64,7 @@ type Controllers struct {
 	ServiceNamespace      *servicenamespace.Controller
 	ServiceExport         *serviceexport.Controller
 	ServiceExportResource *serviceexportresource.Controller
+	TokenRefresh          *tokenrefresh.Controller
 }
 
 func NewServer(config *Config) (*Server, error) {
@@ -64,75 +83,189 @@ func NewServer(config *Config) (*Server, error) {
 	if callback == "" {
 		callback = fmt.Sprintf("http://%s/callback", s.WebServer.Addr().String())
 	}
+	klog.Background().Info("Using OIDC callback URL, it must be registered as redirect URI with the IdP", "callbackURL", callback)
+	s.CallbackURL = callback
 	s.OIDC, err = examplehttp.NewOIDCServiceProvider(
 		config.Options.OIDC.IssuerClientID,
 		config.Options.OIDC.IssuerClientSecret,
 		callback,
 		config.Options.OIDC.IssuerURL,
+		config.Options.OIDC.BreakerThreshold,
+		config.Options.OIDC.BreakerCoolDown,
+		config.Options.OIDC.UserInfoTimeout,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error setting up OIDC: %w", err)
 	}
+	var execConfig *clientcmdapi.ExecConfig
+	if config.Options.KubeconfigExecCommand != "" {
+		execConfig = &clientcmdapi.ExecConfig{
+			APIVersion: config.Options.KubeconfigExecAPIVersion,
+			Command:    config.Options.KubeconfigExecCommand,
+			Args:       config.Options.KubeconfigExecArgs,
+		}
+	}
 	s.Kubernetes, err = examplekube.NewKubernetesManager(
 		config.Options.NamespacePrefix,
 		config.Options.PrettyName,
+		config.Options.KubeconfigMode,
+		config.Options.OwnerReferences,
+		config.Options.ServiceAccountTokenTTL,
+		execConfig,
 		config.ClientConfig,
 		config.KubeInformers.Core().V1().Namespaces(),
-		config.BindInformers.KubeBind().V1alpha1().APIServiceExports(),
+		config.NamespacedInformers.APIServiceExports(),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error setting up Kubernetes Manager: %w", err)
 	}
-	handler, err := examplehttp.NewHandler(
-		s.OIDC,
-		callback,
-		config.Options.PrettyName,
-		config.Options.TestingAutoSelect,
-		s.Kubernetes,
-		config.ApiextensionsInformers.Apiextensions().V1().CustomResourceDefinitions().Lister(),
-	)
+	if config.Options.NamespaceTTL > 0 {
+		s.NamespaceGC = examplekube.NewNamespaceGC(
+			config.Options.NamespaceTTL,
+			config.Options.NamespaceGCDryRun,
+			config.KubeClient,
+			config.KubeInformers.Core().V1().Namespaces().Lister(),
+		)
+	}
+
+	authorizer := config.Authorizer
+	if config.Options.AuthorizationWebhookURL != "" {
+		if authorizer != nil {
+			return nil, fmt.Errorf("authorization webhook cannot be combined with a custom authorizer")
+		}
+		authorizer = examplehttp.NewWebhookAuthorizer(
+			config.Options.AuthorizationWebhookURL,
+			config.Options.AuthorizationWebhookTimeout,
+			config.Options.AuthorizationWebhookFailOpen,
+		)
+	}
+	if config.Options.AuthorizationSubjectAccessReview {
+		if authorizer != nil {
+			return nil, fmt.Errorf("authorization with SubjectAccessReviews cannot be combined with another authorizer")
+		}
+		authorizer = examplehttp.NewSubjectAccessReviewAuthorizer(
+			config.KubeClient.AuthorizationV1().SubjectAccessReviews(),
+			config.Options.AuthorizationGroupsClaim,
+			config.Options.AuthorizationGroupsPrefix,
+		)
+	}
+
+	s.Sessions = session.NewStore()
+	s.Claims = session.NewNamedClaimStore("claims")
+	s.AuthCodes = session.NewNamedClaimStore("auth-codes")
+	s.Maintenance = examplehttp.NewMaintenance(config.Options.MaintenanceMode)
+	var cookieKeys *cookie.KeySet
+	if len(config.Options.CookieSigningKeys) > 0 {
+		if cookieKeys, err = cookie.NewKeySet(config.Options.CookieSigningKeys...); err != nil {
+			return nil, fmt.Errorf("invalid cookie signing keys: %w", err)
+		}
+	}
+	handler, err := examplehttp.NewHandler(examplehttp.HandlerOptions{
+		Provider:                   s.OIDC,
+		BackendCallbackURL:         callback,
+		ProviderPrettyName:         config.Options.PrettyName,
+		ProviderLogoURL:            config.Options.ProviderLogoURL,
+		ProviderThemeColor:         config.Options.ProviderThemeColor,
+		TestingAutoSelect:          config.Options.TestingAutoSelect,
+		Identity:                   config.Options.Identity,
+		TargetNamespacePattern:     config.Options.TargetNamespacePattern,
+		TargetNamespaces:           config.Options.InformerNamespaces,
+		ClaimLabels:                config.Options.ClaimLabels,
+		Stateless:                  config.Options.Stateless,
+		SessionTTL:                 config.Options.SessionCookieTTL,
+		ForbiddenGroups:            config.Options.ForbiddenGroups,
+		Entitlement:                config.Entitlement,
+		Authorizer:                 authorizer,
+		TemplateFuncs:              config.TemplateFuncs,
+		MaxBindingsPerSubject:      config.Options.MaxBindingsPerSubject,
+		Prompt:                     config.Options.OIDC.Prompt,
+		MaxAge:                     config.Options.OIDC.MaxAge,
+		AcrValues:                  config.Options.OIDC.AcrValues,
+		AllowedScopes:              config.Options.OIDC.AllowedScopes,
+		RejectDisallowedScopes:     config.Options.OIDC.RejectDisallowedScopes,
+		CallbackCheckTimeout:       config.Options.CallbackCheckTimeout,
+		CallbackCheckRetries:       config.Options.CallbackCheckRetries,
+		CallbackCheckHosts:         config.Options.CallbackCheckHosts,
+		MaxInlineAuthResponseBytes: config.Options.MaxInlineAuthResponseBytes,
+		AuthCodeStorage:            config.Options.AuthCodeStorage,
+		StateTTL:                   config.Options.StateTTL,
+		ServerSessionIDs:           config.Options.ServerSessionIDs,
+		ResourcesETag:              config.Options.ResourcesETag,
+		BindLandingPage:            config.Options.BindLandingPage,
+		Maintenance:                s.Maintenance,
+		SigningKey:                 config.Options.AuthResponseSigningKey,
+		VerificationKeys:           config.Options.AuthResponseVerificationKeys,
+		CookieKeys:                 cookieKeys,
+		CookieNamePrefix:           config.Options.CookieNamePrefix,
+		Manager:                    s.Kubernetes,
+		CRDLister:                  config.ApiextensionsInformers.Apiextensions().V1().CustomResourceDefinitions().Lister(),
+		CRDSynced:                  config.ApiextensionsInformers.Apiextensions().V1().CustomResourceDefinitions().Informer().HasSynced,
+		Sessions:                   s.Sessions,
+		Claims:                     s.Claims,
+		AuthCodes:                  s.AuthCodes,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error setting up HTTP Handler: %w", err)
 	}
 	handler.AddRoutes(s.WebServer.Router)
+	if config.Options.AdminToken != "" {
+		examplehttp.NewAdminHandler(config.Options.AdminToken, s.Sessions, s.Maintenance).AddRoutes(s.WebServer.Router)
+	}
 
 	// construct controllers
 	s.ClusterBinding, err = clusterbinding.NewController(
 		config.ClientConfig,
-		config.BindInformers.KubeBind().V1alpha1().ClusterBindings(),
+		config.NamespacedInformers.ClusterBindings(),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error setting up ClusterBinding Controller: %v", err)
 	}
 	s.ServiceNamespace, err = servicenamespace.NewController(
 		config.ClientConfig,
-		config.BindInformers.KubeBind().V1alpha1().APIServiceNamespaces(),
-		config.BindInformers.KubeBind().V1alpha1().ClusterBindings(),
-		config.BindInformers.KubeBind().V1alpha1().APIServiceExports(),
+		config.NamespacedInformers.APIServiceNamespaces(),
+		config.NamespacedInformers.ClusterBindings(),
+		config.NamespacedInformers.APIServiceExports(),
 		config.KubeInformers.Core().V1().Namespaces(),
-		config.KubeInformers.Rbac().V1().Roles(),
-		config.KubeInformers.Rbac().V1().RoleBindings(),
+		config.NamespacedInformers.Roles(),
+		config.NamespacedInformers.RoleBindings(),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error setting up APIServiceNamespace Controller: %w", err)
 	}
+	var minConsumerVersion *version.Version
+	if config.Options.MinConsumerVersion != "" {
+		if minConsumerVersion, err = version.ParseGeneric(config.Options.MinConsumerVersion); err != nil {
+			return nil, fmt.Errorf("invalid minimum consumer version: %w", err)
+		}
+	}
 	s.ServiceExport, err = serviceexport.NewController(
 		config.ClientConfig,
-		config.BindInformers.KubeBind().V1alpha1().APIServiceExports(),
-		config.BindInformers.KubeBind().V1alpha1().APIServiceExportResources(),
+		config.NamespacedInformers.APIServiceExports(),
+		config.NamespacedInformers.APIServiceExportResources(),
 		config.ApiextensionsInformers.Apiextensions().V1().CustomResourceDefinitions(),
+		minConsumerVersion,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error setting up APIServiceExport Controller: %w", err)
 	}
 	s.ServiceExportResource, err = serviceexportresource.NewController(
 		config.ClientConfig,
-		config.BindInformers.KubeBind().V1alpha1().APIServiceExports(),
-		config.BindInformers.KubeBind().V1alpha1().APIServiceExportResources(),
+		config.NamespacedInformers.APIServiceExports(),
+		config.NamespacedInformers.APIServiceExportResources(),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("error setting up APIServiceExportResource Controller: %w", err)
 	}
+	if config.Options.ServiceAccountTokenTTL > 0 {
+		s.TokenRefresh, err = tokenrefresh.NewController(
+			config.ClientConfig,
+			config.Options.ServiceAccountTokenTTL,
+			config.NamespacedInformers.Secrets(),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("error setting up token refresh Controller: %w", err)
+		}
+	}
 
 	return s, nil
 }
@@ -145,17 +278,62 @@ func (s *Server) OptionallyStartInformers(ctx context.Context) {
 	s.Config.KubeInformers.Start(ctx.Done())
 	s.Config.BindInformers.Start(ctx.Done())
 	s.Config.ApiextensionsInformers.Start(ctx.Done())
+	s.Config.NamespacedInformers.Start(ctx.Done())
 	kubeSynced := s.Config.KubeInformers.WaitForCacheSync(ctx.Done())
 	kubeBindSynced := s.Config.BindInformers.WaitForCacheSync(ctx.Done())
 	apiextensionsSynced := s.Config.ApiextensionsInformers.WaitForCacheSync(ctx.Done())
+	namespacedSynced := s.Config.NamespacedInformers.WaitForCacheSync(ctx.Done())
 
 	logger.Info("local informers are synced",
 		"kubeSynced", fmt.Sprintf("%v", kubeSynced),
 		"kubeBindSynced", fmt.Sprintf("%v", kubeBindSynced),
 		"apiextensionsSynced", fmt.Sprintf("%v", apiextensionsSynced),
+		"namespacedSynced", fmt.Sprintf("%v", namespacedSynced),
 	)
 }
 
+// SelfCheck logs the effective configuration at v=2 to debug misconfigurations: the
+// options with redacted secrets, the callback URL, the endpoints discovered at the
+// OIDC issuer and whether the informers are synced.
+func (s *Server) SelfCheck(ctx context.Context) {
+	logger := klog.FromContext(ctx)
+
+	endpoints, err := s.OIDC.Endpoints()
+	if err != nil {
+		logger.Error(err, "failed to decode the OIDC discovery document")
+	}
+
+	synced := map[string]bool{}
+	for _, factory := range []interface {
+		WaitForCacheSync(stopCh <-chan struct{}) map[reflect.Type]bool
+	}{s.Config.KubeInformers, s.Config.BindInformers, s.Config.ApiextensionsInformers, s.Config.NamespacedInformers} {
+		// informers are started already, such that synced ones return at once.
+		stopped := make(chan struct{})
+		close(stopped)
+		for t, ok := range factory.WaitForCacheSync(stopped) {
+			synced[t.String()] = ok
+		}
+	}
+
+	logSelfCheck(logger, s.Config.Options, s.CallbackURL, endpoints, synced)
+}
+
+func logSelfCheck(logger klog.Logger, opts *options.CompletedOptions, callbackURL string, endpoints *examplehttp.OIDCEndpoints, synced map[string]bool) {
+	logger = logger.V(2).WithValues("check", "startup")
+	logger.Info("effective options", opts.LogValues()...)
+	logger.Info("effective OIDC callback URL", "callbackURL", callbackURL)
+	if endpoints != nil {
+		logger.Info("discovered OIDC endpoints",
+			"issuer", endpoints.Issuer,
+			"authorization", endpoints.Authorization,
+			"token", endpoints.Token,
+			"userinfo", endpoints.UserInfo,
+			"jwks", endpoints.JWKS,
+		)
+	}
+	logger.Info("informer sync status", "synced", synced)
+}
+
 func (s *Server) Addr() net.Addr {
 	return s.WebServer.Addr()
 }
@@ -166,6 +344,16 @@ func (s *Server) Run(ctx context.Context) error {
 	go s.Controllers.ServiceExport.Start(ctx, 1)
 	go s.Controllers.ServiceNamespace.Start(ctx, 1)
 	go s.Controllers.ClusterBinding.Start(ctx, 1)
+	if s.Controllers.TokenRefresh != nil {
+		go s.Controllers.TokenRefresh.Start(ctx, 1)
+	}
+
+	go s.Sessions.Start(ctx, time.Minute)
+	go s.Claims.Start(ctx, time.Minute)
+	go s.AuthCodes.Start(ctx, s.Config.Options.AuthCodeSweepInterval)
+	if s.NamespaceGC != nil {
+		go s.NamespaceGC.Start(ctx, 10*time.Minute)
+	}
 
 	go func() {
 		<-ctx.Done()
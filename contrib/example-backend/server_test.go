@@ -0,0 +1,70 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package backend
+
+import (
+	"crypto/ed25519"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/require"
+
+	examplehttp "github.com/kube-bind/kube-bind/contrib/example-backend/http"
+	"github.com/kube-bind/kube-bind/contrib/example-backend/options"
+)
+
+func TestLogSelfCheck(t *testing.T) {
+	opts := options.NewOptions()
+	opts.OIDC.IssuerClientID = "kube-bind"
+	opts.OIDC.IssuerClientSecret = "oidc-s3cr3t"
+	opts.OIDC.IssuerURL = "https://issuer.example.com"
+	opts.PrettyName = "MangoDB Inc."
+	completed, err := opts.Complete()
+	require.NoError(t, err)
+	completed.AdminToken = "admin-s3cr3t"
+	_, signingKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	completed.AuthResponseSigningKey = signingKey
+
+	var out strings.Builder
+	logger := funcr.New(func(prefix, args string) {
+		out.WriteString(args + "\n")
+	}, funcr.Options{Verbosity: 2})
+
+	logSelfCheck(logger, completed, "https://backend.example.com/callback", &examplehttp.OIDCEndpoints{
+		Issuer:        "https://issuer.example.com",
+		Authorization: "https://issuer.example.com/auth",
+		Token:         "https://issuer.example.com/token",
+	}, map[string]bool{"*v1.Namespace": true})
+
+	logged := out.String()
+	require.Contains(t, logged, `"OIDC.IssuerURL"="https://issuer.example.com"`)
+	require.Contains(t, logged, `"PrettyName"="MangoDB Inc."`)
+	require.Contains(t, logged, `"OIDC.IssuerClientSecret"="<redacted>"`)
+	require.Contains(t, logged, `"AdminToken"="<redacted>"`)
+	require.Contains(t, logged, `"AuthResponseSigningKey"="<redacted>"`)
+	require.Contains(t, logged, `"callbackURL"="https://backend.example.com/callback"`)
+	require.Contains(t, logged, `"token"="https://issuer.example.com/token"`)
+	require.Contains(t, logged, `"synced"={"*v1.Namespace":true}`)
+	require.NotContains(t, logged, "oidc-s3cr3t")
+	require.NotContains(t, logged, "admin-s3cr3t")
+
+	out.Reset()
+	logSelfCheck(funcr.New(func(prefix, args string) { out.WriteString(args) }, funcr.Options{Verbosity: 1}), completed, "", nil, nil)
+	require.Empty(t, out.String(), "the self-check logs at v=2")
+}
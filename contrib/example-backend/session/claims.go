@@ -0,0 +1,167 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+	"k8s.io/klog/v2"
+)
+
+var (
+	claimStoreEntries = metrics.NewGaugeVec(
+		&metrics.GaugeOpts{
+			Namespace:      "kube_bind",
+			Subsystem:      "backend",
+			Name:           "claim_store_entries",
+			Help:           "Number of entries in a server-side claim store, including expired ones not swept yet.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"store"},
+	)
+	claimStoreEvictions = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      "kube_bind",
+			Subsystem:      "backend",
+			Name:           "claim_store_evictions_total",
+			Help:           "Number of expired entries removed from a server-side claim store without being claimed.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"store"},
+	)
+)
+
+func init() {
+	legacyregistry.MustRegister(claimStoreEntries, claimStoreEvictions)
+}
+
+type claim struct {
+	payload   []byte
+	expiresAt time.Time
+}
+
+// ClaimStore keeps payloads server-side until they are claimed with a one-time
+// token, e.g. auth responses too large to be passed in a redirect URL.
+type ClaimStore struct {
+	// name labels the metrics of the store. Unnamed stores report no metrics.
+	name string
+
+	lock   sync.Mutex
+	claims map[string]*claim
+
+	now func() time.Time
+}
+
+func NewClaimStore() *ClaimStore {
+	return NewNamedClaimStore("")
+}
+
+// NewNamedClaimStore returns a store reporting its entries and evictions
+// under the given name.
+func NewNamedClaimStore(name string) *ClaimStore {
+	return &ClaimStore{
+		name:   name,
+		claims: map[string]*claim{},
+		now:    time.Now,
+	}
+}
+
+// Put stores the payload for ttl and returns the token to claim it with.
+func (s *ClaimStore) Put(payload []byte, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.claims[token] = &claim{
+		payload:   payload,
+		expiresAt: s.now().Add(ttl),
+	}
+	s.updateEntriesLocked()
+	return token, nil
+}
+
+// Take returns the payload of a non-expired token and removes it, such that
+// it can be claimed only once.
+func (s *ClaimStore) Take(token string) ([]byte, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	c, found := s.claims[token]
+	if !found {
+		return nil, false
+	}
+	delete(s.claims, token)
+	s.updateEntriesLocked()
+	if !s.now().Before(c.expiresAt) {
+		s.recordEvictions(1)
+		return nil, false
+	}
+	return c.payload, true
+}
+
+// DeleteExpired removes all expired claims and returns how many were removed.
+func (s *ClaimStore) DeleteExpired() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	deleted := 0
+	for token, c := range s.claims {
+		if !now.Before(c.expiresAt) {
+			delete(s.claims, token)
+			deleted++
+		}
+	}
+	s.updateEntriesLocked()
+	s.recordEvictions(deleted)
+	return deleted
+}
+
+func (s *ClaimStore) updateEntriesLocked() {
+	if s.name != "" {
+		claimStoreEntries.WithLabelValues(s.name).Set(float64(len(s.claims)))
+	}
+}
+
+func (s *ClaimStore) recordEvictions(n int) {
+	if s.name != "" && n > 0 {
+		claimStoreEvictions.WithLabelValues(s.name).Add(float64(n))
+	}
+}
+
+// Start removes expired claims every interval until ctx is done.
+func (s *ClaimStore) Start(ctx context.Context, interval time.Duration) {
+	logger := klog.FromContext(ctx).WithValues("component", "claim-store")
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if deleted := s.DeleteExpired(); deleted > 0 {
+			logger.V(2).Info("deleted expired claims", "count", deleted)
+		}
+	}, interval)
+}
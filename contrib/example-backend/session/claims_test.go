@@ -0,0 +1,110 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package session
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestClaimStore(t *testing.T) {
+	now := time.Date(2022, time.October, 1, 12, 0, 0, 0, time.UTC)
+	s := NewClaimStore()
+	s.now = func() time.Time { return now }
+
+	first, err := s.Put([]byte("first"), time.Minute)
+	require.NoError(t, err)
+	second, err := s.Put([]byte("second"), 5*time.Minute)
+	require.NoError(t, err)
+	require.NotEqual(t, first, second)
+
+	payload, found := s.Take(first)
+	require.True(t, found)
+	require.Equal(t, []byte("first"), payload)
+	_, found = s.Take(first)
+	require.False(t, found, "claims must be single use")
+
+	now = now.Add(5 * time.Minute)
+	_, found = s.Take(second)
+	require.False(t, found, "claims must expire")
+
+	_, err = s.Put([]byte("third"), time.Minute)
+	require.NoError(t, err)
+	now = now.Add(time.Minute)
+	require.Equal(t, 1, s.DeleteExpired())
+	require.Empty(t, s.claims)
+}
+
+func TestClaimStoreSweeper(t *testing.T) {
+	var lock sync.Mutex
+	now := time.Date(2022, time.October, 1, 12, 0, 0, 0, time.UTC)
+	s := NewNamedClaimStore("test-sweeper")
+	s.now = func() time.Time {
+		lock.Lock()
+		defer lock.Unlock()
+		return now
+	}
+
+	stale, err := s.Put([]byte("stale"), time.Minute)
+	require.NoError(t, err)
+	fresh, err := s.Put([]byte("fresh"), time.Hour)
+	require.NoError(t, err)
+	entries, err := testutil.GetGaugeMetricValue(claimStoreEntries.WithLabelValues("test-sweeper"))
+	require.NoError(t, err)
+	require.Equal(t, float64(2), entries)
+
+	lock.Lock()
+	now = now.Add(2 * time.Minute)
+	lock.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Start(ctx, 10*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		_, found := s.claims[stale]
+		return !found
+	}, wait.ForeverTestTimeout, 10*time.Millisecond, "expired entries must be swept")
+
+	evictions, err := testutil.GetCounterMetricValue(claimStoreEvictions.WithLabelValues("test-sweeper"))
+	require.NoError(t, err)
+	require.Equal(t, float64(1), evictions)
+	entries, err = testutil.GetGaugeMetricValue(claimStoreEntries.WithLabelValues("test-sweeper"))
+	require.NoError(t, err)
+	require.Equal(t, float64(1), entries)
+
+	_, found := s.Take(stale)
+	require.False(t, found, "swept entries must not be claimable")
+
+	payload, found := s.Take(fresh)
+	require.True(t, found)
+	require.Equal(t, []byte("fresh"), payload)
+	_, found = s.Take(fresh)
+	require.False(t, found, "claims must be single use")
+	entries, err = testutil.GetGaugeMetricValue(claimStoreEntries.WithLabelValues("test-sweeper"))
+	require.NoError(t, err)
+	require.Equal(t, float64(0), entries)
+}
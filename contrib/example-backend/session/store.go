@@ -0,0 +1,157 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package session
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+// Session is the server-side record of a session whose state lives in the
+// session cookie.
+type Session struct {
+	ID        string
+	Identity  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+
+	// State is the encoded session state if it is too large for the session cookie,
+	// nil otherwise.
+	State []byte
+}
+
+// Store keeps track of the sessions created by the backend, such that they can
+// be invalidated before the session cookie expires.
+type Store struct {
+	lock     sync.Mutex
+	sessions map[string]*Session
+
+	now func() time.Time
+}
+
+func NewStore() *Store {
+	return &Store{
+		sessions: map[string]*Session{},
+		now:      time.Now,
+	}
+}
+
+// Add records a new session of the given identity, replacing an existing one with the same id.
+func (s *Store) Add(id, identity string, ttl time.Duration) *Session {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	session := &Session{
+		ID:        id,
+		Identity:  identity,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	s.sessions[id] = session
+	return session
+}
+
+// Get returns the non-expired session with the given id.
+func (s *Store) Get(id string) (*Session, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	session, found := s.sessions[id]
+	if !found || !s.now().Before(session.ExpiresAt) {
+		return nil, false
+	}
+	result := *session
+	return &result, true
+}
+
+// SetState keeps the encoded state of the non-expired session with the given id, or
+// drops it if nil. It returns false if there is no such session.
+func (s *Store) SetState(id string, state []byte) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	session, found := s.sessions[id]
+	if !found || !s.now().Before(session.ExpiresAt) {
+		return false
+	}
+	session.State = state
+	return true
+}
+
+// List returns all sessions including the expired ones, oldest first.
+func (s *Store) List() []Session {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	sessions := make([]Session, 0, len(s.sessions))
+	for _, session := range s.sessions {
+		sessions = append(sessions, *session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].CreatedAt.Equal(sessions[j].CreatedAt) {
+			return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+		}
+		return sessions[i].ID < sessions[j].ID
+	})
+	return sessions
+}
+
+// Expired returns whether the session is expired at the current time of the store.
+func (s *Store) Expired(session Session) bool {
+	return !s.now().Before(session.ExpiresAt)
+}
+
+// Delete invalidates the session with the given id.
+func (s *Store) Delete(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.sessions, id)
+}
+
+// DeleteExpired removes all expired sessions and returns how many were removed.
+func (s *Store) DeleteExpired() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	deleted := 0
+	for id, session := range s.sessions {
+		if !now.Before(session.ExpiresAt) {
+			delete(s.sessions, id)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// Start removes expired sessions every interval until ctx is done.
+func (s *Store) Start(ctx context.Context, interval time.Duration) {
+	logger := klog.FromContext(ctx).WithValues("component", "session-store")
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if deleted := s.DeleteExpired(); deleted > 0 {
+			logger.V(2).Info("deleted expired sessions", "count", deleted)
+		}
+	}, interval)
+}
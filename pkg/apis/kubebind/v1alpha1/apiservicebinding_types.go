@@ -44,9 +44,28 @@ const (
 	// schema is applied to the consumer cluster.
 	APIServiceBindingConditionSchemaInSync conditionsapi.ConditionType = "SchemaInSync"
 
+	// APIServiceBindingConditionConsumerVersionSupported is set to true when the consumer
+	// cluster supports all CRD features used by the APIServiceExport's resources, e.g.
+	// x-kubernetes-validations.
+	APIServiceBindingConditionConsumerVersionSupported conditionsapi.ConditionType = "ConsumerVersionSupported"
+
+	// APIServiceBindingConditionBuiltInResourcesNotShadowed is set to true when no name of
+	// the APIServiceExport's resources collides with a well-known built-in resource of
+	// the consumer cluster, which kubectl would resolve instead.
+	APIServiceBindingConditionBuiltInResourcesNotShadowed conditionsapi.ConditionType = "BuiltInResourcesNotShadowed"
+
+	// APIServiceBindingConditionBackendReachable is set to true when the /export endpoint
+	// of the service provider backend in spec.providerURL answers the periodic probe
+	// of the konnector.
+	APIServiceBindingConditionBackendReachable conditionsapi.ConditionType = "BackendReachable"
+
 	// DownstreamFinalizer is put on downstream objects to block their deletion until
 	// the upstream object has been deleted.
 	DownstreamFinalizer = "kubebind.io/syncer"
+
+	// CRDCleanupFinalizer is put on APIServiceBindings to block their deletion until
+	// the CustomResourceDefinitions created for them are cleaned up.
+	CRDCleanupFinalizer = "kubebind.io/crd-cleanup"
 )
 
 // APIServiceBinding binds an API service represented by a APIServiceExport
@@ -96,8 +115,70 @@ type APIServiceBindingSpec struct {
 	// +kubebuilder:validation:Required
 	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="kubeconfigSecretRef is immutable"
 	KubeconfigSecretRef ClusterSecretKeyRef `json:"kubeconfigSecretRef"`
+
+	// scope is the scope the consumer expects the APIServiceExport to have. If set
+	// and different from the scope of the APIServiceExport, the export is not
+	// considered connected.
+	//
+	// +optional
+	Scope Scope `json:"scope,omitempty"`
+
+	// crdDeletionPolicy decides what happens to the CustomResourceDefinitions created
+	// for this binding when it is deleted or their resource is removed from the export.
+	// Delete removes them together with all their objects, Orphan keeps them.
+	// CustomResourceDefinitions shared with other bindings are never deleted, nor are
+	// those of removed resources that still have objects.
+	//
+	// +optional
+	// +kubebuilder:default=Delete
+	CRDDeletionPolicy CRDDeletionPolicy `json:"crdDeletionPolicy,omitempty"`
+
+	// providerURL is the URL of the /export endpoint of the service provider backend
+	// the binding was last bound with. If set, the konnector probes it periodically and
+	// reports the result in the BackendReachable condition.
+	//
+	// +optional
+	ProviderURL string `json:"providerURL,omitempty"`
+
+	// resources selects the resources of the APIServiceExport to bind. If empty, all
+	// exported resources are bound. Resources not selected get no CustomResourceDefinition
+	// and are not synced. Those removed from the list are cleaned up according to
+	// crdDeletionPolicy. Selecting a resource the export does not offer sets the
+	// ResourcesValid condition to false.
+	//
+	// +optional
+	// +listType=map
+	// +listMapKey=group
+	// +listMapKey=resource
+	Resources []GroupResource `json:"resources,omitempty"`
+
+	// consumerGroupSuffix is appended to the API group of every bound resource on the
+	// consumer cluster, e.g. mangodbs.mangodb.com is bound as mangodbs.mangodb.com.<suffix>.
+	// Set to something identifying the service provider, it keeps resources of the same
+	// name from different service providers apart. kubectl bind --provider-scoped derives
+	// it from the provider host.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="consumerGroupSuffix is immutable"
+	ConsumerGroupSuffix string `json:"consumerGroupSuffix,omitempty"`
 }
 
+// CRDDeletionPolicy is the policy for the CustomResourceDefinitions of a deleted APIServiceBinding.
+//
+// +kubebuilder:validation:Enum=Delete;Orphan
+type CRDDeletionPolicy string
+
+const (
+	// CRDDeletionPolicyDelete deletes the CustomResourceDefinitions and hence all their objects.
+	CRDDeletionPolicyDelete CRDDeletionPolicy = "Delete"
+
+	// CRDDeletionPolicyOrphan keeps the CustomResourceDefinitions and their objects, but
+	// they are not synced anymore.
+	CRDDeletionPolicyOrphan CRDDeletionPolicy = "Orphan"
+)
+
 type APIServiceBindingStatus struct {
 	// providerPrettyName is the pretty name of the service provider cluster. This
 	// can be shared among different APIServiceBindings.
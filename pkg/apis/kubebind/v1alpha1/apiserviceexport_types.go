@@ -40,6 +40,16 @@ const (
 	// APIServiceExportConditionResourcesInSync is set to true when the APIServiceExport's
 	// resources are in sync with the CRDs.
 	APIServiceExportConditionResourcesInSync conditionsapi.ConditionType = "ResourcesInSync"
+
+	// APIServiceExportConditionConsumerVersionSupported is set to true when consumer
+	// clusters of the minimum version the service provider supports can serve the
+	// APIServiceExport's resources.
+	APIServiceExportConditionConsumerVersionSupported conditionsapi.ConditionType = "ConsumerVersionSupported"
+
+	// APIServiceExportConditionBuiltInResourcesNotShadowed is set to true when no name of
+	// the APIServiceExport's resources, as seen by consumers, collides with a well-known
+	// built-in resource.
+	APIServiceExportConditionBuiltInResourcesNotShadowed conditionsapi.ConditionType = "BuiltInResourcesNotShadowed"
 )
 
 // APIServiceExport specifies an API service to exported to a consumer cluster. The
@@ -97,12 +107,73 @@ type APIServiceExportSpec struct {
 type APIServiceExportStatus struct {
 	// conditions is a list of conditions that apply to the APIServiceExport.
 	Conditions conditionsapi.Conditions `json:"conditions,omitempty"`
+
+	// resources lists the CRDs generated on the consumer cluster from the valid
+	// APIServiceExportResources of this export.
+	//
+	// +optional
+	Resources []APIServiceExportResourceCRD `json:"resources,omitempty"`
+}
+
+// APIServiceExportResourceCRD is the CRD generated from an APIServiceExportResource.
+type APIServiceExportResourceCRD struct {
+	// resource is the name of the APIServiceExportResource.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	Resource string `json:"resource"`
+
+	// crdName is the name of the generated CRD.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	CRDName string `json:"crdName"`
+
+	// servedVersions are the versions the generated CRD serves.
+	//
+	// +optional
+	ServedVersions []string `json:"servedVersions,omitempty"`
 }
 
 type APIServiceExportGroupResource struct {
 	GroupResource `json:",inline"`
+
+	// source is what serves the resource on the service provider cluster. If empty,
+	// the resource is defined by a CustomResourceDefinition.
+	//
+	// +optional
+	// +kubebuilder:validation:Enum=CustomResourceDefinition;AggregatedAPI
+	Source ResourceSource `json:"source,omitempty"`
+
+	// metadataPropagation selects the labels and annotations of the CRD that are set
+	// on the CRD on the consumer cluster. If unset, all but controller-internal ones
+	// are set.
+	//
+	// +optional
+	MetadataPropagation *MetadataPropagation `json:"metadataPropagation,omitempty"`
+
+	// versions pins the versions of the resource that are exported, e.g. to hide
+	// deprecated versions. If the storage version is not pinned, the first pinned
+	// version is stored on the consumer cluster. If empty, all served versions are
+	// exported.
+	//
+	// +optional
+	Versions []string `json:"versions,omitempty"`
 }
 
+// ResourceSource is what serves an exported resource on the service provider cluster.
+type ResourceSource string
+
+const (
+	// CustomResourceDefinitionSource is a resource defined by a CustomResourceDefinition.
+	CustomResourceDefinitionSource ResourceSource = "CustomResourceDefinition"
+	// AggregatedAPISource is a resource served by an aggregated API server. Its names,
+	// scope, versions and subresources are captured from discovery, the schema from the
+	// published OpenAPI v3 document. Versions without a usable schema preserve unknown
+	// fields, and objects are validated by the aggregated API server when synced.
+	AggregatedAPISource ResourceSource = "AggregatedAPI"
+)
+
 // GroupResource identifies a resource.
 type GroupResource struct {
 	// group is the name of an API group.
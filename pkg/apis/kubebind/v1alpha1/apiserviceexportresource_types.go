@@ -27,6 +27,22 @@ import (
 const (
 	// APIServiceExportResourrceConditionSyncing means the resource is actively syncing.
 	APIServiceExportResourrceConditionSyncing conditionsapi.ConditionType = "Syncing"
+
+	// StorageVersionAnnotationKey can be set on a CRD in the service provider cluster to
+	// select the storage version of the exported resource.
+	StorageVersionAnnotationKey = "kube-bind.io/storage-version"
+
+	// ConsumerGroupAnnotationKey can be set on a CRD in the service provider cluster to
+	// serve the exported resource under another API group on the consumer cluster.
+	ConsumerGroupAnnotationKey = "kube-bind.io/consumer-group"
+
+	// ConsumerNamespaceAnnotationKey can be set on a namespaced CRD in the service provider
+	// cluster to select the namespace on the consumer cluster the instances live in.
+	ConsumerNamespaceAnnotationKey = "kube-bind.io/consumer-namespace"
+
+	// CanonicalVersionAnnotationKey can be set on a CRD in the service provider cluster to
+	// collapse the exported resource to the given version on the consumer cluster.
+	CanonicalVersionAnnotationKey = "kube-bind.io/canonical-version"
 )
 
 // APIServiceExportResource specifies the resource to be exported. It is mostly a CRD::
@@ -79,6 +95,32 @@ type APIServiceExportResourceSpec struct {
 	// +kubebuilder:validation:Enum=Cluster;Namespaced
 	Scope apiextensionsv1.ResourceScope `json:"scope"`
 
+	// conversionStrategy is the conversion strategy of the CRD on the service provider
+	// cluster. Allowed values are `None` and `Webhook`. The consumer cluster cannot call
+	// the conversion webhook, hence `Webhook` is only valid if exactly one version
+	// is exported.
+	//
+	// +optional
+	// +kubebuilder:validation:Enum=None;Webhook
+	// +kubebuilder:default=None
+	ConversionStrategy apiextensionsv1.ConversionStrategyType `json:"conversionStrategy,omitempty"`
+
+	// storageVersion is the version used for storage in the consumer cluster. It must
+	// be one of the versions. If empty, the version with storage=true is used.
+	// It defaults to the storage version of the CRD on the service provider cluster,
+	// which can be overridden by the kube-bind.io/storage-version annotation.
+	//
+	// +optional
+	StorageVersion string `json:"storageVersion,omitempty"`
+
+	// canonicalVersion collapses the resource to a single version on the consumer
+	// cluster. The consumer CRD serves and stores only this version, the others are
+	// dropped, such that no conversion is needed on the consumer cluster. It must be
+	// one of the versions, and equal to storageVersion if that is set.
+	//
+	// +optional
+	CanonicalVersion string `json:"canonicalVersion,omitempty"`
+
 	// versions is the API version of the defined custom resource.
 	//
 	// Note: the OpenAPI v3 schemas must be equal for all versions until CEL
@@ -89,6 +131,80 @@ type APIServiceExportResourceSpec struct {
 	// +listMapKey=name
 	// +kubebuilder:validation:MinItems=1
 	Versions []APIServiceExportResourceVersion `json:"versions"`
+
+	// consumerRewrite renames the resource on the consumer cluster, e.g. to avoid
+	// collisions with other APIs or for branding. The CRD on the consumer cluster is
+	// named after the rewritten plural and group.
+	//
+	// +optional
+	ConsumerRewrite *APIServiceExportResourceRewrite `json:"consumerRewrite,omitempty"`
+
+	// consumerNamespace is the namespace on the consumer cluster the instances of a
+	// namespaced resource live in. The konnector creates the namespace and only syncs
+	// instances in it. If empty, instances in all namespaces are synced.
+	//
+	// +optional
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	ConsumerNamespace string `json:"consumerNamespace,omitempty"`
+
+	// crdMetadata are the labels and annotations of the CRD on the service provider
+	// cluster, without controller-internal ones.
+	//
+	// +optional
+	CRDMetadata *CRDMetadata `json:"crdMetadata,omitempty"`
+
+	// metadataPropagation selects the labels and annotations of crdMetadata that are
+	// set on the CRD on the consumer cluster. If unset, all of them are set.
+	//
+	// +optional
+	MetadataPropagation *MetadataPropagation `json:"metadataPropagation,omitempty"`
+}
+
+// CRDMetadata are the labels and annotations of a CRD.
+type CRDMetadata struct {
+	// labels of the CRD.
+	//
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// annotations of the CRD.
+	//
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// MetadataPropagation selects the labels and annotations of a CRD on the service
+// provider cluster that are set on the CRD on the consumer cluster. A key ending in
+// "*" matches all keys with that prefix. Controller-internal keys, e.g. of kubectl,
+// Helm or kube-bind, are never propagated.
+type MetadataPropagation struct {
+	// include are the keys of the labels and annotations that are propagated. If
+	// empty, all keys are propagated.
+	//
+	// +optional
+	Include []string `json:"include,omitempty"`
+
+	// exclude are the keys of the labels and annotations that are not propagated,
+	// even if included.
+	//
+	// +optional
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// APIServiceExportResourceRewrite renames an exported resource on the consumer cluster.
+type APIServiceExportResourceRewrite struct {
+	// group is the API group of the resource on the consumer cluster. It must contain
+	// a dot. If empty, the group is not rewritten.
+	//
+	// +optional
+	Group string `json:"group,omitempty"`
+
+	// names are the resource and kind names on the consumer cluster. They replace
+	// the names of the resource as a whole. If unset, the names are not rewritten.
+	//
+	// +optional
+	Names *apiextensionsv1.CustomResourceDefinitionNames `json:"names,omitempty"`
 }
 
 // APIServiceExportResourceVersion describes one API version of a resource.
@@ -144,6 +260,26 @@ type APIServiceExportResourceVersion struct {
 	// +listType=map
 	// +listMapKey=name
 	AdditionalPrinterColumns []apiextensionsv1.CustomResourceColumnDefinition `json:"additionalPrinterColumns,omitempty"`
+	// selectableFields specifies paths to fields that may be used as field selectors.
+	// They are only set on consumer clusters of Kubernetes 1.30 or newer.
+	// See https://kubernetes.io/docs/concepts/overview/working-with-objects/field-selectors/
+	//
+	// +optional
+	// +listType=atomic
+	// +kubebuilder:validation:MaxItems=8
+	SelectableFields []SelectableField `json:"selectableFields,omitempty"`
+}
+
+// SelectableField specifies the JSON path of a field that may be used with field selectors.
+type SelectableField struct {
+	// jsonPath is a simple JSON path which is evaluated against each custom resource
+	// to produce a field selector value, e.g. ".spec.tier". It must point to a field
+	// of type string, boolean or integer.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	JSONPath string `json:"jsonPath"`
 }
 
 type APIServiceExportResourceSchema struct {
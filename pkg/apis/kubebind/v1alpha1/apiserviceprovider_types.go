@@ -39,6 +39,37 @@ type APIServiceProvider struct {
 	Status APIServiceProviderStatus `json:"status,omitempty"`
 }
 
+// AuthResponseKey is an Ed25519 public key in JSON Web Key format (RFC 8037).
+type AuthResponseKey struct {
+	// kid is the key ID, the JSON Web Key thumbprint (RFC 7638) of the key.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	KeyID string `json:"kid"`
+
+	// kty is the key type.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=OKP
+	KeyType string `json:"kty"`
+
+	// crv is the curve of the key.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Enum=Ed25519
+	Curve string `json:"crv"`
+
+	// x is the base64url encoded public key, without padding.
+	//
+	// +required
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	X string `json:"x"`
+}
+
 // APIServiceProviderSpec represents the data in the newly created APIServiceProvider
 type APIServiceProviderSpec struct {
 	// AuthenticatedClientURL is the service provider url where the service consumer will use to authenticate against
@@ -57,6 +88,21 @@ type APIServiceProviderSpec struct {
 	// +kubebuilder:validation:MinLength=1
 	ProviderPrettyName string `json:"providerPrettyName"`
 
+	// authResponsePublicKey is the base64 encoded PKIX Ed25519 public key the service
+	// provider signs auth responses with. If set, consumers reject auth responses
+	// without a valid signature.
+	//
+	// +optional
+	AuthResponsePublicKey string `json:"authResponsePublicKey,omitempty"`
+
+	// authResponseKeys are the keys auth responses are verified with, the signing key
+	// first, followed by keys still accepted during key rotation. Signed auth responses
+	// name their key in the auth_response_key_id query parameter. If set, it takes
+	// precedence over authResponsePublicKey.
+	//
+	// +optional
+	AuthResponseKeys []AuthResponseKey `json:"authResponseKeys,omitempty"`
+
 	// serviceProviderSpec contains all the data the service provider needs to conduct the chosen service by the user.
 	// An example of those specs could be the resources that the user has chosen to use.
 	ServiceProviderSpec runtime.RawExtension `json:"serviceProviderSpecSpec,omitempty"`
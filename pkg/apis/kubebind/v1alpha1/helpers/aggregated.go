@@ -0,0 +1,267 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+)
+
+// preserveUnknownFieldsSchema is the schema of versions of aggregated resources
+// without a published or structural OpenAPI v3 schema.
+var preserveUnknownFieldsSchema = []byte(`{"type":"object","x-kubernetes-preserve-unknown-fields":true}`)
+
+// DiscoveredResource is a resource as published by the discovery of an aggregated
+// API server.
+type DiscoveredResource struct {
+	Group string
+	// PreferredVersion is the preferred version of the group.
+	PreferredVersion string
+	// Versions are the versions serving the resource, in the order of the group.
+	Versions []DiscoveredVersion
+}
+
+// DiscoveredVersion is a version of a discovered resource.
+type DiscoveredVersion struct {
+	Name     string
+	Resource metav1.APIResource
+	// Subresources are the names of the subresources, e.g. status.
+	Subresources []string
+	// Schema is the OpenAPI v3 schema of the kind, or nil if none is published.
+	Schema *apiextensionsv1.JSONSchemaProps
+}
+
+// DiscoveredResourceToServiceExportResource converts a resource of an aggregated API
+// server to a APIServiceExportResource. The aggregated API server converts between
+// its versions, hence only the preferred version, or the first one if it is not
+// serving the resource, is served and stored on the consumer cluster. A version
+// without a schema, or with one that is not structural, preserves unknown fields.
+func DiscoveredResourceToServiceExportResource(discovered *DiscoveredResource) (*kubebindv1alpha1.APIServiceExportResource, error) {
+	if len(discovered.Versions) == 0 {
+		return nil, fmt.Errorf("resource is not served in any version of group %q", discovered.Group)
+	}
+	if IsBuiltInGroup(discovered.Group) {
+		return nil, fmt.Errorf("group %q is built into Kubernetes", discovered.Group)
+	}
+
+	first := discovered.Versions[0].Resource
+	name := first.Name + "." + discovered.Group
+	resource := &kubebindv1alpha1.APIServiceExportResource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: kubebindv1alpha1.APIServiceExportResourceSpec{
+			Group: discovered.Group,
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Plural:     first.Name,
+				Singular:   first.SingularName,
+				Kind:       first.Kind,
+				ListKind:   first.Kind + "List",
+				ShortNames: first.ShortNames,
+				Categories: first.Categories,
+			},
+			Scope: apiextensionsv1.ClusterScoped,
+
+			ConversionStrategy: apiextensionsv1.NoneConverter,
+		},
+	}
+	if resource.Spec.Names.Singular == "" {
+		resource.Spec.Names.Singular = strings.ToLower(first.Kind)
+	}
+	if first.Namespaced {
+		resource.Spec.Scope = apiextensionsv1.NamespaceScoped
+	}
+
+	for _, v := range discovered.Versions {
+		if v.Resource.Kind != first.Kind || v.Resource.Namespaced != first.Namespaced {
+			return nil, fmt.Errorf("resource %s has a different kind or scope in version %q", name, v.Name)
+		}
+		version := kubebindv1alpha1.APIServiceExportResourceVersion{
+			Name:   v.Name,
+			Served: true,
+		}
+		version.Schema.OpenAPIV3Schema.Raw = preserveUnknownFieldsSchema
+		if v.Schema != nil && len(validateStructuralSchema(field.NewPath("schema"), v.Schema)) == 0 {
+			raw, err := json.Marshal(v.Schema)
+			if err != nil {
+				return nil, err
+			}
+			version.Schema.OpenAPIV3Schema.Raw = raw
+		}
+		for _, sub := range v.Subresources {
+			// the paths of scale are not published, hence it is not exported.
+			if sub == "status" {
+				version.Subresources.Status = &apiextensionsv1.CustomResourceSubresourceStatus{}
+			}
+		}
+		if v.Name == discovered.PreferredVersion {
+			resource.Spec.StorageVersion = v.Name
+		}
+		resource.Spec.Versions = append(resource.Spec.Versions, version)
+	}
+	if resource.Spec.StorageVersion == "" {
+		resource.Spec.StorageVersion = resource.Spec.Versions[0].Name
+	}
+	resource.Spec.CanonicalVersion = resource.Spec.StorageVersion
+	for i := range resource.Spec.Versions {
+		resource.Spec.Versions[i].Storage = resource.Spec.Versions[i].Name == resource.Spec.StorageVersion
+	}
+
+	return resource, nil
+}
+
+// OpenAPIV3KindSchema returns the schema of the kind in the OpenAPI v3 document of a
+// group version, in JSON, or nil if the document has none. References are inlined,
+// recursive ones preserve unknown fields. Constructs CustomResourceDefinitions do not
+// support, like defaults and oneOf, are dropped, and fields without a type preserve
+// unknown fields, such that the schema is usually structural.
+func OpenAPIV3KindSchema(document []byte, gvk metav1.GroupVersionKind) (*apiextensionsv1.JSONSchemaProps, error) {
+	var doc struct {
+		Components struct {
+			Schemas map[string]map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, fmt.Errorf("failed to decode OpenAPI v3 document: %w", err)
+	}
+
+	for name, s := range doc.Components.Schemas {
+		bs, err := json.Marshal(s["x-kubernetes-group-version-kind"])
+		if err != nil {
+			return nil, err
+		}
+		var gvks []metav1.GroupVersionKind
+		if err := json.Unmarshal(bs, &gvks); err != nil {
+			continue // not a kind
+		}
+		for _, other := range gvks {
+			if other != gvk {
+				continue
+			}
+
+			root := inlineSchema(doc.Components.Schemas, s, sets.NewString(name)).(map[string]interface{})
+			if _, found := root["type"]; !found {
+				root["type"] = "object"
+				delete(root, "x-kubernetes-preserve-unknown-fields")
+			}
+			if props, ok := root["properties"].(map[string]interface{}); ok {
+				if _, found := props["metadata"]; found {
+					props["metadata"] = map[string]interface{}{"type": "object"}
+				}
+			}
+
+			bs, err := json.Marshal(root)
+			if err != nil {
+				return nil, err
+			}
+			var props apiextensionsv1.JSONSchemaProps
+			if err := json.Unmarshal(bs, &props); err != nil {
+				return nil, fmt.Errorf("failed to decode schema %s: %w", name, err)
+			}
+			return &props, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// inlineSchema returns a copy of the schema node with references into schemas
+// inlined. visiting are the names of the schemas on the path to the node.
+func inlineSchema(schemas map[string]map[string]interface{}, node map[string]interface{}, visiting sets.String) interface{} {
+	// references with siblings, e.g. a description, are wrapped into allOf.
+	if allOf, ok := node["allOf"].([]interface{}); ok && len(allOf) == 1 {
+		if ref, ok := allOf[0].(map[string]interface{}); ok && ref["$ref"] != nil {
+			merged := map[string]interface{}{}
+			for k, v := range node {
+				if k != "allOf" {
+					merged[k] = v
+				}
+			}
+			merged["$ref"] = ref["$ref"]
+			node = merged
+		}
+	}
+
+	if ref, ok := node["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		target, found := schemas[name]
+		if !found || visiting.Has(name) {
+			return map[string]interface{}{"x-kubernetes-preserve-unknown-fields": true}
+		}
+		resolved := map[string]interface{}{}
+		for k, v := range target {
+			resolved[k] = v
+		}
+		for k, v := range node {
+			if k != "$ref" {
+				resolved[k] = v // siblings win over the referenced schema
+			}
+		}
+		return inlineSchema(schemas, resolved, visiting.Union(sets.NewString(name)))
+	}
+
+	if node["format"] == "int-or-string" {
+		out := map[string]interface{}{"x-kubernetes-int-or-string": true}
+		if d, ok := node["description"]; ok {
+			out["description"] = d
+		}
+		return out
+	}
+
+	out := map[string]interface{}{}
+	for k, v := range node {
+		switch k {
+		case "allOf", "anyOf", "oneOf", "not", "default", "uniqueItems", "x-kubernetes-group-version-kind":
+			// not supported or not structural in CustomResourceDefinitions.
+		case "properties":
+			props, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			inlined := map[string]interface{}{}
+			for name, p := range props {
+				if p, ok := p.(map[string]interface{}); ok {
+					inlined[name] = inlineSchema(schemas, p, visiting)
+				}
+			}
+			out[k] = inlined
+		case "items", "additionalProperties":
+			if sub, ok := v.(map[string]interface{}); ok {
+				out[k] = inlineSchema(schemas, sub, visiting)
+			} else {
+				out[k] = v
+			}
+		default:
+			out[k] = v
+		}
+	}
+	if props, ok := out["properties"].(map[string]interface{}); ok && len(props) > 0 {
+		delete(out, "additionalProperties") // both are not allowed in CustomResourceDefinitions
+	}
+	if _, found := out["type"]; !found {
+		out["x-kubernetes-preserve-unknown-fields"] = true
+	}
+	return out
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDiscoveredResourceToServiceExportResource(t *testing.T) {
+	usage := metav1.APIResource{Name: "usages", Namespaced: true, Kind: "Usage", ShortNames: []string{"us"}}
+
+	t.Run("preferred version is canonical", func(t *testing.T) {
+		resource, err := DiscoveredResourceToServiceExportResource(&DiscoveredResource{
+			Group:            "metrics.mangodb.com",
+			PreferredVersion: "v1",
+			Versions: []DiscoveredVersion{
+				{Name: "v1beta1", Resource: usage},
+				{Name: "v1", Resource: usage, Subresources: []string{"status", "scale"}},
+			},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "usages.metrics.mangodb.com", resource.Name)
+		require.Equal(t, apiextensionsv1.CustomResourceDefinitionNames{Plural: "usages", Singular: "usage", Kind: "Usage", ListKind: "UsageList", ShortNames: []string{"us"}}, resource.Spec.Names)
+		require.Equal(t, apiextensionsv1.NamespaceScoped, resource.Spec.Scope)
+		require.Equal(t, "v1", resource.Spec.StorageVersion)
+		require.Equal(t, "v1", resource.Spec.CanonicalVersion)
+		require.Len(t, resource.Spec.Versions, 2)
+		require.Nil(t, resource.Spec.Versions[0].Subresources.Status)
+		require.NotNil(t, resource.Spec.Versions[1].Subresources.Status)
+		require.Nil(t, resource.Spec.Versions[1].Subresources.Scale)
+
+		crd, err := ServiceExportResourceToCRD(resource, nil)
+		require.NoError(t, err)
+		require.Len(t, crd.Spec.Versions, 1)
+		require.Equal(t, "v1", crd.Spec.Versions[0].Name)
+		require.True(t, crd.Spec.Versions[0].Storage)
+		require.True(t, *crd.Spec.Versions[0].Schema.OpenAPIV3Schema.XPreserveUnknownFields)
+	})
+
+	t.Run("preferred version not serving the resource", func(t *testing.T) {
+		resource, err := DiscoveredResourceToServiceExportResource(&DiscoveredResource{
+			Group:            "metrics.mangodb.com",
+			PreferredVersion: "v2",
+			Versions:         []DiscoveredVersion{{Name: "v1", Resource: usage}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, "v1", resource.Spec.StorageVersion)
+		require.True(t, resource.Spec.Versions[0].Storage)
+	})
+
+	t.Run("kind differs between versions", func(t *testing.T) {
+		other := usage
+		other.Kind = "Consumption"
+		_, err := DiscoveredResourceToServiceExportResource(&DiscoveredResource{
+			Group:    "metrics.mangodb.com",
+			Versions: []DiscoveredVersion{{Name: "v1", Resource: usage}, {Name: "v2", Resource: other}},
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("published schema", func(t *testing.T) {
+		schema := &apiextensionsv1.JSONSchemaProps{
+			Type:       "object",
+			Properties: map[string]apiextensionsv1.JSONSchemaProps{"spec": {Type: "object"}},
+		}
+		resource, err := DiscoveredResourceToServiceExportResource(&DiscoveredResource{
+			Group:    "metrics.mangodb.com",
+			Versions: []DiscoveredVersion{{Name: "v1", Resource: usage, Schema: schema}},
+		})
+		require.NoError(t, err)
+		require.JSONEq(t, `{"type":"object","properties":{"spec":{"type":"object"}}}`, string(resource.Spec.Versions[0].Schema.OpenAPIV3Schema.Raw))
+	})
+
+	t.Run("non-structural schema", func(t *testing.T) {
+		schema := &apiextensionsv1.JSONSchemaProps{
+			Type:       "object",
+			Properties: map[string]apiextensionsv1.JSONSchemaProps{"spec": {Description: "without type"}},
+		}
+		resource, err := DiscoveredResourceToServiceExportResource(&DiscoveredResource{
+			Group:    "metrics.mangodb.com",
+			Versions: []DiscoveredVersion{{Name: "v1", Resource: usage, Schema: schema}},
+		})
+		require.NoError(t, err)
+		require.JSONEq(t, string(preserveUnknownFieldsSchema), string(resource.Spec.Versions[0].Schema.OpenAPIV3Schema.Raw))
+	})
+
+	t.Run("built-in group", func(t *testing.T) {
+		_, err := DiscoveredResourceToServiceExportResource(&DiscoveredResource{
+			Group:    "metrics",
+			Versions: []DiscoveredVersion{{Name: "v1", Resource: usage}},
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestOpenAPIV3KindSchema(t *testing.T) {
+	document := []byte(`{"components":{"schemas":{
+		"com.mangodb.metrics.v1.Usage": {
+			"type": "object",
+			"x-kubernetes-group-version-kind": [{"group":"metrics.mangodb.com","version":"v1","kind":"Usage"}],
+			"properties": {
+				"apiVersion": {"type":"string"},
+				"kind": {"type":"string"},
+				"metadata": {"allOf":[{"$ref":"#/components/schemas/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"}],"default":{}},
+				"spec": {"description":"the usage","allOf":[{"$ref":"#/components/schemas/com.mangodb.metrics.v1.UsageSpec"}],"default":{}}
+			}
+		},
+		"com.mangodb.metrics.v1.UsageSpec": {
+			"type": "object",
+			"properties": {
+				"bytes": {"$ref":"#/components/schemas/io.k8s.apimachinery.pkg.api.resource.Quantity"},
+				"port": {"$ref":"#/components/schemas/io.k8s.apimachinery.pkg.util.intstr.IntOrString"},
+				"parent": {"$ref":"#/components/schemas/com.mangodb.metrics.v1.UsageSpec"},
+				"owner": {"$ref":"#/components/schemas/com.mangodb.metrics.v1.Unknown"},
+				"tags": {"type":"array","uniqueItems":true,"items":{"type":"string","default":""}}
+			}
+		},
+		"io.k8s.apimachinery.pkg.api.resource.Quantity": {"oneOf":[{"type":"string"},{"type":"number"}]},
+		"io.k8s.apimachinery.pkg.util.intstr.IntOrString": {"format":"int-or-string","oneOf":[{"type":"integer"},{"type":"string"}]},
+		"io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {"type":"object","properties":{"name":{"type":"string"}}}
+	}}}`)
+
+	schema, err := OpenAPIV3KindSchema(document, metav1.GroupVersionKind{Group: "metrics.mangodb.com", Version: "v1", Kind: "Usage"})
+	require.NoError(t, err)
+	require.NotNil(t, schema)
+
+	preserve := true
+	require.Equal(t, &apiextensionsv1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"apiVersion": {Type: "string"},
+			"kind":       {Type: "string"},
+			"metadata":   {Type: "object"},
+			"spec": {
+				Type:        "object",
+				Description: "the usage",
+				Properties: map[string]apiextensionsv1.JSONSchemaProps{
+					"bytes":  {XPreserveUnknownFields: &preserve},
+					"port":   {XIntOrString: true},
+					"parent": {XPreserveUnknownFields: &preserve},
+					"owner":  {XPreserveUnknownFields: &preserve},
+					"tags":   {Type: "array", Items: &apiextensionsv1.JSONSchemaPropsOrArray{Schema: &apiextensionsv1.JSONSchemaProps{Type: "string"}}},
+				},
+			},
+		},
+	}, schema)
+	require.Empty(t, validateStructuralSchema(nil, schema))
+
+	schema, err = OpenAPIV3KindSchema(document, metav1.GroupVersionKind{Group: "metrics.mangodb.com", Version: "v1", Kind: "Other"})
+	require.NoError(t, err)
+	require.Nil(t, schema)
+
+	_, err = OpenAPIV3KindSchema([]byte("{"), metav1.GroupVersionKind{})
+	require.Error(t, err)
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+)
+
+// AuthResponseKeyID returns the JSON Web Key thumbprint (RFC 7638) of the key.
+func AuthResponseKeyID(key ed25519.PublicKey) string {
+	// the required members of an OKP key in lexicographic order, as RFC 7638 demands.
+	canonical := fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, base64.RawURLEncoding.EncodeToString(key))
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Ed25519ToAuthResponseKey returns the key in JSON Web Key format.
+func Ed25519ToAuthResponseKey(key ed25519.PublicKey) kubebindv1alpha1.AuthResponseKey {
+	return kubebindv1alpha1.AuthResponseKey{
+		KeyID:   AuthResponseKeyID(key),
+		KeyType: "OKP",
+		Curve:   "Ed25519",
+		X:       base64.RawURLEncoding.EncodeToString(key),
+	}
+}
+
+// AuthResponseKeyToEd25519 returns the Ed25519 public key of the JSON Web Key. It
+// fails if the key ID is not the thumbprint of the key.
+func AuthResponseKeyToEd25519(key kubebindv1alpha1.AuthResponseKey) (ed25519.PublicKey, error) {
+	if key.KeyType != "OKP" || key.Curve != "Ed25519" {
+		return nil, fmt.Errorf("unsupported auth response key %q of type %q and curve %q, must be OKP and Ed25519", key.KeyID, key.KeyType, key.Curve)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(key.X)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth response key %q: %w", key.KeyID, err)
+	}
+	if len(x) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid auth response key %q: must be %d bytes, got %d", key.KeyID, ed25519.PublicKeySize, len(x))
+	}
+	pub := ed25519.PublicKey(x)
+	if id := AuthResponseKeyID(pub); id != key.KeyID {
+		return nil, fmt.Errorf("auth response key ID %q does not match its thumbprint %q", key.KeyID, id)
+	}
+	return pub, nil
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthResponseKey(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	key := Ed25519ToAuthResponseKey(pub)
+	require.Equal(t, "OKP", key.KeyType)
+	require.Equal(t, "Ed25519", key.Curve)
+	require.Equal(t, AuthResponseKeyID(pub), key.KeyID)
+
+	parsed, err := AuthResponseKeyToEd25519(key)
+	require.NoError(t, err)
+	payload := []byte(`{"kind":"BindingResponse"}`)
+	require.True(t, ed25519.Verify(parsed, payload, ed25519.Sign(priv, payload)))
+
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	require.NotEqual(t, key.KeyID, AuthResponseKeyID(other))
+
+	wrongID := key
+	wrongID.KeyID = AuthResponseKeyID(other)
+	_, err = AuthResponseKeyToEd25519(wrongID)
+	require.ErrorContains(t, err, "does not match its thumbprint")
+
+	wrongCurve := key
+	wrongCurve.Curve = "X25519"
+	_, err = AuthResponseKeyToEd25519(wrongCurve)
+	require.ErrorContains(t, err, "unsupported auth response key")
+
+	short := key
+	short.X = "AAAA"
+	_, err = AuthResponseKeyToEd25519(short)
+	require.ErrorContains(t, err, "must be 32 bytes")
+}
+
+func TestAuthResponseKeyID(t *testing.T) {
+	// test vector of RFC 8037, appendix A.3.
+	pub := ed25519.PublicKey{
+		0xd7, 0x5a, 0x98, 0x01, 0x82, 0xb1, 0x0a, 0xb7, 0xd5, 0x4b, 0xfe, 0xd3, 0xc9, 0x64, 0x07, 0x3a,
+		0x0e, 0xe1, 0x72, 0xf3, 0xda, 0xa6, 0x23, 0x25, 0xaf, 0x02, 0x1a, 0x68, 0xf7, 0x07, 0x51, 0x1a,
+	}
+	require.Equal(t, "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k", AuthResponseKeyID(pub))
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+)
+
+// SelectedResources returns the exported resources selected by spec.resources of the
+// binding, in the order of the export, and the selected resources the export does not
+// offer. A binding without selection selects all exported resources.
+func SelectedResources(binding *kubebindv1alpha1.APIServiceBinding, exported []kubebindv1alpha1.APIServiceExportGroupResource) (selected []kubebindv1alpha1.APIServiceExportGroupResource, notExported []kubebindv1alpha1.GroupResource) {
+	if binding == nil || len(binding.Spec.Resources) == 0 {
+		return exported, nil
+	}
+
+	wanted := make(map[kubebindv1alpha1.GroupResource]bool, len(binding.Spec.Resources))
+	for _, gr := range binding.Spec.Resources {
+		wanted[gr] = true
+	}
+	for _, resource := range exported {
+		if wanted[resource.GroupResource] {
+			selected = append(selected, resource)
+			delete(wanted, resource.GroupResource)
+		}
+	}
+	for _, gr := range binding.Spec.Resources {
+		if wanted[gr] {
+			notExported = append(notExported, gr)
+		}
+	}
+	return selected, notExported
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+)
+
+func TestSelectedResources(t *testing.T) {
+	mangodbs := kubebindv1alpha1.APIServiceExportGroupResource{GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: "mangodbs"}, Versions: []string{"v1"}}
+	caches := kubebindv1alpha1.APIServiceExportGroupResource{GroupResource: kubebindv1alpha1.GroupResource{Group: "redis.io", Resource: "caches"}}
+	exported := []kubebindv1alpha1.APIServiceExportGroupResource{mangodbs, caches}
+
+	binding := &kubebindv1alpha1.APIServiceBinding{}
+	selected, notExported := SelectedResources(binding, exported)
+	require.Equal(t, exported, selected)
+	require.Empty(t, notExported)
+
+	selected, notExported = SelectedResources(nil, exported)
+	require.Equal(t, exported, selected)
+	require.Empty(t, notExported)
+
+	binding.Spec.Resources = []kubebindv1alpha1.GroupResource{
+		{Group: "example.com", Resource: "foos"},
+		caches.GroupResource,
+		{Group: "mangodb.com", Resource: "caches"},
+		mangodbs.GroupResource,
+	}
+	selected, notExported = SelectedResources(binding, exported)
+	require.Equal(t, exported, selected, "the order of the export is kept")
+	require.Equal(t, []kubebindv1alpha1.GroupResource{
+		{Group: "example.com", Resource: "foos"},
+		{Group: "mangodb.com", Resource: "caches"},
+	}, notExported)
+}
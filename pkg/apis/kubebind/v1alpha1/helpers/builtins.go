@@ -0,0 +1,105 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"sort"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// builtInResource is a well-known resource built into Kubernetes.
+type builtInResource struct {
+	group      string
+	plural     string
+	kind       string
+	shortNames []string
+}
+
+var builtInResources = []builtInResource{
+	{group: "", plural: "componentstatuses", kind: "ComponentStatus", shortNames: []string{"cs"}},
+	{group: "", plural: "configmaps", kind: "ConfigMap", shortNames: []string{"cm"}},
+	{group: "", plural: "endpoints", kind: "Endpoints", shortNames: []string{"ep"}},
+	{group: "", plural: "events", kind: "Event", shortNames: []string{"ev"}},
+	{group: "", plural: "limitranges", kind: "LimitRange", shortNames: []string{"limits"}},
+	{group: "", plural: "namespaces", kind: "Namespace", shortNames: []string{"ns"}},
+	{group: "", plural: "nodes", kind: "Node", shortNames: []string{"no"}},
+	{group: "", plural: "persistentvolumeclaims", kind: "PersistentVolumeClaim", shortNames: []string{"pvc"}},
+	{group: "", plural: "persistentvolumes", kind: "PersistentVolume", shortNames: []string{"pv"}},
+	{group: "", plural: "pods", kind: "Pod", shortNames: []string{"po"}},
+	{group: "", plural: "replicationcontrollers", kind: "ReplicationController", shortNames: []string{"rc"}},
+	{group: "", plural: "resourcequotas", kind: "ResourceQuota", shortNames: []string{"quota"}},
+	{group: "", plural: "secrets", kind: "Secret"},
+	{group: "", plural: "serviceaccounts", kind: "ServiceAccount", shortNames: []string{"sa"}},
+	{group: "", plural: "services", kind: "Service", shortNames: []string{"svc"}},
+	{group: "admissionregistration.k8s.io", plural: "mutatingwebhookconfigurations", kind: "MutatingWebhookConfiguration"},
+	{group: "admissionregistration.k8s.io", plural: "validatingwebhookconfigurations", kind: "ValidatingWebhookConfiguration"},
+	{group: "apiextensions.k8s.io", plural: "customresourcedefinitions", kind: "CustomResourceDefinition", shortNames: []string{"crd", "crds"}},
+	{group: "apiregistration.k8s.io", plural: "apiservices", kind: "APIService"},
+	{group: "apps", plural: "controllerrevisions", kind: "ControllerRevision"},
+	{group: "apps", plural: "daemonsets", kind: "DaemonSet", shortNames: []string{"ds"}},
+	{group: "apps", plural: "deployments", kind: "Deployment", shortNames: []string{"deploy"}},
+	{group: "apps", plural: "replicasets", kind: "ReplicaSet", shortNames: []string{"rs"}},
+	{group: "apps", plural: "statefulsets", kind: "StatefulSet", shortNames: []string{"sts"}},
+	{group: "autoscaling", plural: "horizontalpodautoscalers", kind: "HorizontalPodAutoscaler", shortNames: []string{"hpa"}},
+	{group: "batch", plural: "cronjobs", kind: "CronJob", shortNames: []string{"cj"}},
+	{group: "batch", plural: "jobs", kind: "Job"},
+	{group: "certificates.k8s.io", plural: "certificatesigningrequests", kind: "CertificateSigningRequest", shortNames: []string{"csr"}},
+	{group: "coordination.k8s.io", plural: "leases", kind: "Lease"},
+	{group: "discovery.k8s.io", plural: "endpointslices", kind: "EndpointSlice"},
+	{group: "networking.k8s.io", plural: "ingressclasses", kind: "IngressClass"},
+	{group: "networking.k8s.io", plural: "ingresses", kind: "Ingress", shortNames: []string{"ing"}},
+	{group: "networking.k8s.io", plural: "networkpolicies", kind: "NetworkPolicy", shortNames: []string{"netpol"}},
+	{group: "policy", plural: "poddisruptionbudgets", kind: "PodDisruptionBudget", shortNames: []string{"pdb"}},
+	{group: "rbac.authorization.k8s.io", plural: "clusterrolebindings", kind: "ClusterRoleBinding"},
+	{group: "rbac.authorization.k8s.io", plural: "clusterroles", kind: "ClusterRole"},
+	{group: "rbac.authorization.k8s.io", plural: "rolebindings", kind: "RoleBinding"},
+	{group: "rbac.authorization.k8s.io", plural: "roles", kind: "Role"},
+	{group: "scheduling.k8s.io", plural: "priorityclasses", kind: "PriorityClass", shortNames: []string{"pc"}},
+	{group: "storage.k8s.io", plural: "csidrivers", kind: "CSIDriver"},
+	{group: "storage.k8s.io", plural: "csinodes", kind: "CSINode"},
+	{group: "storage.k8s.io", plural: "storageclasses", kind: "StorageClass", shortNames: []string{"sc"}},
+	{group: "storage.k8s.io", plural: "volumeattachments", kind: "VolumeAttachment"},
+}
+
+// ShadowedBuiltInResources returns the well-known built-in resources, as <plural>[.<group>],
+// sharing a plural, singular or short name with the given CRD names. kubectl resolves
+// such a name to the built-in resource, hence the CRD can only be addressed by its
+// fully qualified name.
+func ShadowedBuiltInResources(names apiextensionsv1.CustomResourceDefinitionNames) []string {
+	crdNames := sets.NewString(names.ShortNames...)
+	crdNames.Insert(names.Plural, strings.ToLower(names.Kind))
+	if names.Singular != "" {
+		crdNames.Insert(names.Singular)
+	}
+
+	var shadowed []string
+	for _, r := range builtInResources {
+		if !crdNames.Has(r.plural) && !crdNames.Has(strings.ToLower(r.kind)) && !crdNames.HasAny(r.shortNames...) {
+			continue
+		}
+		name := r.plural
+		if r.group != "" {
+			name += "." + r.group
+		}
+		shadowed = append(shadowed, name)
+	}
+	sort.Strings(shadowed)
+	return shadowed
+}
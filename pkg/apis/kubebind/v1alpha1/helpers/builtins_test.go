@@ -0,0 +1,58 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func TestShadowedBuiltInResources(t *testing.T) {
+	tests := []struct {
+		name  string
+		names apiextensionsv1.CustomResourceDefinitionNames
+		want  []string
+	}{
+		{
+			name:  "no collision",
+			names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb", Kind: "MangoDB", ShortNames: []string{"mdb"}},
+		},
+		{
+			name:  "plural",
+			names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "pods", Singular: "pod", Kind: "Pod"},
+			want:  []string{"pods"},
+		},
+		{
+			name:  "short name of another group",
+			names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "deployers", Singular: "deployer", Kind: "Deployer", ShortNames: []string{"deploy"}},
+			want:  []string{"deployments.apps"},
+		},
+		{
+			name:  "singular and short name",
+			names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "jobqueues", Singular: "job", Kind: "JobQueue", ShortNames: []string{"svc"}},
+			want:  []string{"jobs.batch", "services"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, ShadowedBuiltInResources(tt.names))
+		})
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+)
+
+// InternalMetadataKeys are the controller-internal label and annotation keys of CRDs,
+// which are never propagated to the consumer cluster. They are interpreted by the
+// tools managing the CRD on the service provider cluster, or by kube-bind itself.
+var InternalMetadataKeys = []string{
+	"kubectl.kubernetes.io/*",
+	"controller-gen.kubebuilder.io/*",
+	"api-approved.kubernetes.io",
+	"app.kubernetes.io/managed-by",
+	"meta.helm.sh/*",
+	"helm.sh/*",
+	"argocd.argoproj.io/*",
+	"kapp.k14s.io/*",
+	"kube-bind.io/*",
+}
+
+// matchesMetadataKey returns true if the key matches one of the patterns. A pattern
+// ending in "*" matches all keys with that prefix.
+func matchesMetadataKey(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if pattern == key {
+			return true
+		}
+	}
+	return false
+}
+
+// filterMetadata returns the entries whose keys are selected by the propagation and
+// are not controller-internal, or nil if there are none.
+func filterMetadata(m map[string]string, propagation *kubebindv1alpha1.MetadataPropagation) map[string]string {
+	var filtered map[string]string
+	for k, v := range m {
+		if matchesMetadataKey(InternalMetadataKeys, k) {
+			continue
+		}
+		if propagation != nil {
+			if len(propagation.Include) > 0 && !matchesMetadataKey(propagation.Include, k) {
+				continue
+			}
+			if matchesMetadataKey(propagation.Exclude, k) {
+				continue
+			}
+		}
+		if filtered == nil {
+			filtered = map[string]string{}
+		}
+		filtered[k] = v
+	}
+	return filtered
+}
+
+// exportedCRDMetadata returns the labels and annotations of a CRD on the service
+// provider cluster without controller-internal ones, or nil if there are none.
+func exportedCRDMetadata(labels, annotations map[string]string) *kubebindv1alpha1.CRDMetadata {
+	metadata := &kubebindv1alpha1.CRDMetadata{
+		Labels:      filterMetadata(labels, nil),
+		Annotations: filterMetadata(annotations, nil),
+	}
+	if metadata.Labels == nil && metadata.Annotations == nil {
+		return nil
+	}
+	return metadata
+}
+
+func validateMetadataPropagation(fldPath *field.Path, propagation *kubebindv1alpha1.MetadataPropagation) field.ErrorList {
+	var errs field.ErrorList
+	validate := func(fldPath *field.Path, patterns []string) {
+		for i, pattern := range patterns {
+			if pattern == "" || strings.Contains(strings.TrimSuffix(pattern, "*"), "*") {
+				errs = append(errs, field.Invalid(fldPath.Index(i), pattern, "must be a key, or a key prefix followed by a single trailing '*'"))
+			}
+		}
+	}
+	validate(fldPath.Child("include"), propagation.Include)
+	validate(fldPath.Child("exclude"), propagation.Exclude)
+	return errs
+}
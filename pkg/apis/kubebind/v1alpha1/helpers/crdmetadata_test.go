@@ -0,0 +1,111 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+)
+
+func TestCRDMetadataPropagation(t *testing.T) {
+	tests := []struct {
+		name            string
+		propagation     *kubebindv1alpha1.MetadataPropagation
+		wantLabels      map[string]string
+		wantAnnotations map[string]string
+		wantErr         string
+	}{
+		{
+			name:            "default drops controller-internal keys",
+			wantLabels:      map[string]string{"mangodb.com/tier": "gold", "team": "db"},
+			wantAnnotations: map[string]string{"mangodb.com/docs": "https://mangodb.com/docs"},
+		},
+		{
+			name:            "include",
+			propagation:     &kubebindv1alpha1.MetadataPropagation{Include: []string{"mangodb.com/*"}},
+			wantLabels:      map[string]string{"mangodb.com/tier": "gold"},
+			wantAnnotations: map[string]string{"mangodb.com/docs": "https://mangodb.com/docs"},
+		},
+		{
+			name:        "exclude",
+			propagation: &kubebindv1alpha1.MetadataPropagation{Exclude: []string{"mangodb.com/docs", "team"}},
+			wantLabels:  map[string]string{"mangodb.com/tier": "gold"},
+		},
+		{
+			name:            "exclude takes precedence",
+			propagation:     &kubebindv1alpha1.MetadataPropagation{Include: []string{"mangodb.com/*"}, Exclude: []string{"mangodb.com/tier"}},
+			wantAnnotations: map[string]string{"mangodb.com/docs": "https://mangodb.com/docs"},
+		},
+		{
+			name:        "internal keys cannot be included",
+			propagation: &kubebindv1alpha1.MetadataPropagation{Include: []string{"meta.helm.sh/*", "app.kubernetes.io/managed-by"}},
+		},
+		{
+			name:        "invalid pattern",
+			propagation: &kubebindv1alpha1.MetadataPropagation{Include: []string{"mangodb.com/*/tier"}},
+			wantErr:     "spec.metadataPropagation.include[0]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crd := newTestCRD()
+			crd.Labels = map[string]string{
+				"mangodb.com/tier":             "gold",
+				"team":                         "db",
+				"app.kubernetes.io/managed-by": "Helm",
+			}
+			crd.Annotations = map[string]string{
+				"mangodb.com/docs": "https://mangodb.com/docs",
+				"kubectl.kubernetes.io/last-applied-configuration": "{}",
+				"meta.helm.sh/release-name":                        "mangodb",
+				"controller-gen.kubebuilder.io/version":            "v0.10.0",
+				kubebindv1alpha1.StorageVersionAnnotationKey:       "v1alpha1",
+			}
+
+			resource, err := CRDToServiceExportResource(crd)
+			require.NoError(t, err)
+			require.Equal(t, map[string]string{"mangodb.com/tier": "gold", "team": "db"}, resource.Spec.CRDMetadata.Labels)
+			require.Equal(t, map[string]string{"mangodb.com/docs": "https://mangodb.com/docs"}, resource.Spec.CRDMetadata.Annotations)
+
+			resource.Spec.MetadataPropagation = tt.propagation
+			got, err := ServiceExportResourceToCRD(resource, nil)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantLabels, got.Labels)
+			require.Equal(t, tt.wantAnnotations, got.Annotations)
+		})
+	}
+}
+
+func TestCRDMetadataOnlyInternal(t *testing.T) {
+	crd := newTestCRD()
+	crd.Annotations = map[string]string{"kubectl.kubernetes.io/last-applied-configuration": "{}"}
+
+	resource, err := CRDToServiceExportResource(crd)
+	require.NoError(t, err)
+	require.Nil(t, resource.Spec.CRDMetadata)
+
+	got, err := ServiceExportResourceToCRD(resource, nil)
+	require.NoError(t, err)
+	require.Nil(t, got.Annotations)
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+)
+
+// DefaultForbiddenGroups are the API groups that are never exported, because
+// they belong to Kubernetes or to kube-bind itself.
+var DefaultForbiddenGroups = []string{
+	"k8s.io",
+	"*.k8s.io",
+	"kube-bind.io",
+	"*.kube-bind.io",
+}
+
+// IsGroupForbidden returns true if the group matches one of the patterns. A
+// pattern is either a group name or "*." followed by a domain, matching all
+// groups below that domain.
+func IsGroupForbidden(group string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if domain := strings.TrimPrefix(pattern, "*"); domain != pattern {
+			if strings.HasSuffix(group, domain) {
+				return true
+			}
+		} else if group == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// IsKubeBindGroup returns true if the group belongs to kube-bind itself. Its resources
+// are never exported nor bound, independent of the configured forbidden groups.
+func IsKubeBindGroup(group string) bool {
+	return group == kubebindv1alpha1.GroupName || strings.HasSuffix(group, "."+kubebindv1alpha1.GroupName)
+}
+
+// IsBuiltInGroup returns true if the group cannot belong to a CustomResourceDefinition.
+// CRD groups must contain a dot, hence the core group and groups like "apps" are built-in.
+func IsBuiltInGroup(group string) bool {
+	return !strings.Contains(group, ".")
+}
+
+// ValidateGroup checks that the group is a valid API group name, i.e. a lowercase
+// DNS subdomain, or empty for the core group. Names like resource + "." + group
+// are only built from validated groups.
+func ValidateGroup(group string) error {
+	if group == "" {
+		return nil
+	}
+	if errs := validation.IsDNS1123Subdomain(group); len(errs) > 0 {
+		return fmt.Errorf("invalid group %q: %s", group, strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// ValidateGroupPatterns checks that the patterns are valid for IsGroupForbidden.
+func ValidateGroupPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if errs := validation.IsDNS1123Subdomain(strings.TrimPrefix(pattern, "*.")); len(errs) > 0 {
+			return fmt.Errorf("invalid group pattern %q: %s", pattern, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
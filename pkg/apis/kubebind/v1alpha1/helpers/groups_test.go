@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsGroupForbidden(t *testing.T) {
+	tests := []struct {
+		group string
+		want  bool
+	}{
+		{group: "rbac.authorization.k8s.io", want: true},
+		{group: "apiextensions.k8s.io", want: true},
+		{group: "k8s.io", want: true},
+		{group: "kube-bind.io", want: true},
+		{group: "mangodb.com"},
+		{group: "notk8s.io"},
+		{group: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.group, func(t *testing.T) {
+			require.Equal(t, tt.want, IsGroupForbidden(tt.group, DefaultForbiddenGroups))
+		})
+	}
+
+	require.NoError(t, ValidateGroupPatterns(DefaultForbiddenGroups))
+	require.Error(t, ValidateGroupPatterns([]string{"*"}))
+	require.Error(t, ValidateGroupPatterns([]string{"foo.*.io"}))
+}
+
+func TestIsKubeBindGroup(t *testing.T) {
+	require.True(t, IsKubeBindGroup("kube-bind.io"))
+	require.True(t, IsKubeBindGroup("example.kube-bind.io"))
+	require.False(t, IsKubeBindGroup("notkube-bind.io"))
+	require.False(t, IsKubeBindGroup("mangodb.com"))
+}
+
+func TestValidateGroup(t *testing.T) {
+	for _, group := range []string{"", "apps", "mangodb.com", "example.kube-bind.io"} {
+		require.NoError(t, ValidateGroup(group), group)
+	}
+	for _, group := range []string{"MangoDB.com", "mango_db.com", ".com", "mangodb.com.", "mangodb-.com", "mangodb.com/v1", strings.Repeat("a", 254)} {
+		require.ErrorContains(t, ValidateGroup(group), "invalid group", group)
+	}
+}
+
+func TestIsBuiltInGroup(t *testing.T) {
+	require.True(t, IsBuiltInGroup(""))
+	require.True(t, IsBuiltInGroup("apps"))
+	require.True(t, IsBuiltInGroup("batch"))
+	require.False(t, IsBuiltInGroup("mangodb.com"))
+	require.False(t, IsBuiltInGroup("snapshot.storage.k8s.io"))
+}
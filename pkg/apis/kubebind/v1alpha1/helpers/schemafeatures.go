@@ -0,0 +1,143 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/version"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+)
+
+// crdFeature is a CRD feature that consumer clusters only support from a version on.
+type crdFeature struct {
+	name       string
+	minVersion *version.Version
+
+	// usedByVersion and usedBySchema report whether the feature is used. Either may be nil.
+	usedByVersion func(v *kubebindv1alpha1.APIServiceExportResourceVersion) bool
+	usedBySchema  func(s *apiextensionsv1.JSONSchemaProps) bool
+}
+
+var crdFeatures = []crdFeature{
+	{
+		name:       "deprecated versions",
+		minVersion: version.MustParseGeneric("1.19"),
+		usedByVersion: func(v *kubebindv1alpha1.APIServiceExportResourceVersion) bool {
+			return v.Deprecated
+		},
+	},
+	{
+		name:       "selectableFields",
+		minVersion: SelectableFieldsMinVersion,
+		usedByVersion: func(v *kubebindv1alpha1.APIServiceExportResourceVersion) bool {
+			return len(v.SelectableFields) > 0
+		},
+	},
+	{
+		name:       "x-kubernetes-validations",
+		minVersion: version.MustParseGeneric("1.25"),
+		usedBySchema: func(s *apiextensionsv1.JSONSchemaProps) bool {
+			return len(s.XValidations) > 0
+		},
+	},
+}
+
+// UnsupportedFeatures returns the CRD features used by the resource that consumer
+// clusters of the given version do not support, each with the version it requires.
+func UnsupportedFeatures(resource *kubebindv1alpha1.APIServiceExportResource, consumerVersion *version.Version) ([]string, error) {
+	used := sets.NewString()
+	for i := range resource.Spec.Versions {
+		v := &resource.Spec.Versions[i]
+		var schema *apiextensionsv1.JSONSchemaProps
+		if len(v.Schema.OpenAPIV3Schema.Raw) > 0 {
+			schema = &apiextensionsv1.JSONSchemaProps{}
+			if err := json.Unmarshal(v.Schema.OpenAPIV3Schema.Raw, schema); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal schema for version %q: %w", v.Name, err)
+			}
+		}
+
+		for _, f := range crdFeatures {
+			if used.Has(f.name) || consumerVersion.AtLeast(f.minVersion) {
+				continue
+			}
+			if f.usedByVersion != nil && f.usedByVersion(v) {
+				used.Insert(f.name)
+			}
+			if f.usedBySchema != nil && schema != nil && anySchema(schema, f.usedBySchema) {
+				used.Insert(f.name)
+			}
+		}
+	}
+
+	var unsupported []string
+	for _, f := range crdFeatures {
+		if used.Has(f.name) {
+			unsupported = append(unsupported, fmt.Sprintf("%s (requires %s)", f.name, f.minVersion))
+		}
+	}
+	sort.Strings(unsupported)
+	return unsupported, nil
+}
+
+// anySchema returns whether pred holds for the schema or any of its subschemas.
+func anySchema(s *apiextensionsv1.JSONSchemaProps, pred func(s *apiextensionsv1.JSONSchemaProps) bool) bool {
+	if s == nil {
+		return false
+	}
+	if pred(s) {
+		return true
+	}
+
+	for _, m := range []map[string]apiextensionsv1.JSONSchemaProps{s.Properties, s.PatternProperties, s.Definitions} {
+		for k := range m {
+			child := m[k]
+			if anySchema(&child, pred) {
+				return true
+			}
+		}
+	}
+	for _, l := range [][]apiextensionsv1.JSONSchemaProps{s.AllOf, s.OneOf, s.AnyOf} {
+		for i := range l {
+			if anySchema(&l[i], pred) {
+				return true
+			}
+		}
+	}
+	if s.Items != nil {
+		if anySchema(s.Items.Schema, pred) {
+			return true
+		}
+		for i := range s.Items.JSONSchemas {
+			if anySchema(&s.Items.JSONSchemas[i], pred) {
+				return true
+			}
+		}
+	}
+	if s.AdditionalProperties != nil && anySchema(s.AdditionalProperties.Schema, pred) {
+		return true
+	}
+	if s.AdditionalItems != nil && anySchema(s.AdditionalItems.Schema, pred) {
+		return true
+	}
+	return anySchema(s.Not, pred)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+)
+
+func TestUnsupportedFeatures(t *testing.T) {
+	crd := newTestCRD()
+	crd.Spec.Versions[0].Schema.OpenAPIV3Schema = &apiextensionsv1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"spec": {
+				Type: "object",
+				Properties: map[string]apiextensionsv1.JSONSchemaProps{
+					"replicas": {
+						Type:         "integer",
+						XValidations: apiextensionsv1.ValidationRules{{Rule: "self >= 0"}},
+					},
+				},
+			},
+		},
+	}
+	validated, err := CRDToServiceExportResource(crd)
+	require.NoError(t, err)
+
+	plain, err := CRDToServiceExportResource(newTestCRD())
+	require.NoError(t, err)
+
+	deprecatedCRD := newTestCRD()
+	deprecatedCRD.Spec.Versions[0].Deprecated = true
+	deprecated, err := CRDToServiceExportResource(deprecatedCRD)
+	require.NoError(t, err)
+
+	selectable, err := CRDToServiceExportResource(newTestCRD())
+	require.NoError(t, err)
+	selectable.Spec.Versions[0].SelectableFields = []kubebindv1alpha1.SelectableField{{JSONPath: ".spec.tier"}}
+
+	tests := []struct {
+		name            string
+		consumerVersion string
+		resource        *kubebindv1alpha1.APIServiceExportResource
+		want            []string
+	}{
+		{name: "validations on old consumer", consumerVersion: "1.24", resource: validated, want: []string{"x-kubernetes-validations (requires 1.25)"}},
+		{name: "validations on patch release of old consumer", consumerVersion: "1.24.7", resource: validated, want: []string{"x-kubernetes-validations (requires 1.25)"}},
+		{name: "validations on new consumer", consumerVersion: "1.25", resource: validated},
+		{name: "plain schema on old consumer", consumerVersion: "1.16", resource: plain},
+		{name: "deprecated version on old consumer", consumerVersion: "1.18", resource: deprecated, want: []string{"deprecated versions (requires 1.19)"}},
+		{name: "deprecated version on new consumer", consumerVersion: "1.19", resource: deprecated},
+		{name: "selectable fields on old consumer", consumerVersion: "1.29", resource: selectable, want: []string{"selectableFields (requires 1.30)"}},
+		{name: "selectable fields on new consumer", consumerVersion: "1.30", resource: selectable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := UnsupportedFeatures(tt.resource, version.MustParseGeneric(tt.consumerVersion))
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/version"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+)
+
+// The CustomResourceDefinition types of k8s.io/apiextensions-apiserver v0.25 have no
+// selectableFields, hence they are read from and written into the unstructured CRD.
+
+// SelectableFieldsMinVersion is the Kubernetes version CRDs have selectableFields from.
+var SelectableFieldsMinVersion = version.MustParseGeneric("1.30")
+
+// maxSelectableFields is the maximal number of selectable fields per CRD version.
+const maxSelectableFields = 8
+
+var selectableFieldPathSegment = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_-]*$`)
+
+// CRDSelectableFields returns the selectable fields of the versions of the CRD by
+// version name.
+func CRDSelectableFields(crd *unstructured.Unstructured) (map[string][]kubebindv1alpha1.SelectableField, error) {
+	versions, _, err := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	if err != nil {
+		return nil, fmt.Errorf("invalid versions of CRD %s: %w", crd.GetName(), err)
+	}
+
+	var fields map[string][]kubebindv1alpha1.SelectableField
+	for _, v := range versions {
+		v, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid version of CRD %s", crd.GetName())
+		}
+		name, _, _ := unstructured.NestedString(v, "name")
+		raw, found, err := unstructured.NestedSlice(v, "selectableFields")
+		if err != nil {
+			return nil, fmt.Errorf("invalid selectableFields of CRD %s version %q: %w", crd.GetName(), name, err)
+		} else if !found || len(raw) == 0 {
+			continue
+		}
+
+		bs, err := json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		var versionFields []kubebindv1alpha1.SelectableField
+		if err := json.Unmarshal(bs, &versionFields); err != nil {
+			return nil, fmt.Errorf("invalid selectableFields of CRD %s version %q: %w", crd.GetName(), name, err)
+		}
+		if fields == nil {
+			fields = map[string][]kubebindv1alpha1.SelectableField{}
+		}
+		fields[name] = versionFields
+	}
+	return fields, nil
+}
+
+// SetSelectableFields sets the selectable fields of the versions of the resource by
+// version name. Versions without fields are cleared.
+func SetSelectableFields(resource *kubebindv1alpha1.APIServiceExportResource, fields map[string][]kubebindv1alpha1.SelectableField) {
+	for i := range resource.Spec.Versions {
+		v := &resource.Spec.Versions[i]
+		v.SelectableFields = append([]kubebindv1alpha1.SelectableField(nil), fields[v.Name]...)
+		if len(v.SelectableFields) == 0 {
+			v.SelectableFields = nil
+		}
+	}
+}
+
+// ConsumerSelectableFields returns the selectable fields of the versions of the
+// resource by version name, or nil if consumer clusters of the given version do not
+// support them. A nil version is assumed not to support them.
+func ConsumerSelectableFields(resource *kubebindv1alpha1.APIServiceExportResource, consumerVersion *version.Version) map[string][]kubebindv1alpha1.SelectableField {
+	if consumerVersion == nil || !consumerVersion.AtLeast(SelectableFieldsMinVersion) {
+		return nil
+	}
+	var fields map[string][]kubebindv1alpha1.SelectableField
+	for _, v := range resource.Spec.Versions {
+		if len(v.SelectableFields) == 0 {
+			continue
+		}
+		if fields == nil {
+			fields = map[string][]kubebindv1alpha1.SelectableField{}
+		}
+		fields[v.Name] = append([]kubebindv1alpha1.SelectableField(nil), v.SelectableFields...)
+	}
+	return fields
+}
+
+// WithSelectableFields returns the JSON encoded CRD with the selectable fields set on
+// its versions by version name. Versions of the CRD without fields are left alone.
+func WithSelectableFields(crd []byte, fields map[string][]kubebindv1alpha1.SelectableField) ([]byte, error) {
+	if len(fields) == 0 {
+		return crd, nil
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(crd, &obj); err != nil {
+		return nil, err
+	}
+	versions, _, err := unstructured.NestedSlice(obj, "spec", "versions")
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range versions {
+		v, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid CRD version")
+		}
+		name, _, _ := unstructured.NestedString(v, "name")
+		versionFields, found := fields[name]
+		if !found {
+			continue
+		}
+		raw := make([]interface{}, 0, len(versionFields))
+		for _, f := range versionFields {
+			raw = append(raw, map[string]interface{}{"jsonPath": f.JSONPath})
+		}
+		v["selectableFields"] = raw
+		versions[i] = v
+	}
+	if err := unstructured.SetNestedSlice(obj, versions, "spec", "versions"); err != nil {
+		return nil, err
+	}
+	return json.Marshal(obj)
+}
+
+// validateSelectableFields validates the selectable fields of a version against its
+// schema like the apiserver validates those of a CRD.
+func validateSelectableFields(fldPath *field.Path, fields []kubebindv1alpha1.SelectableField, schema *apiextensionsv1.JSONSchemaProps) field.ErrorList {
+	var errs field.ErrorList
+	if len(fields) > maxSelectableFields {
+		errs = append(errs, field.TooMany(fldPath, len(fields), maxSelectableFields))
+	}
+
+	seen := sets.NewString()
+	for i, f := range fields {
+		path := fldPath.Index(i).Child("jsonPath")
+		if f.JSONPath == "" {
+			errs = append(errs, field.Required(path, ""))
+			continue
+		}
+		if seen.Has(f.JSONPath) {
+			errs = append(errs, field.Duplicate(path, f.JSONPath))
+			continue
+		}
+		seen.Insert(f.JSONPath)
+
+		if !strings.HasPrefix(f.JSONPath, ".") {
+			errs = append(errs, field.Invalid(path, f.JSONPath, "must be a simple JSON path starting with a dot"))
+			continue
+		}
+		if schema == nil {
+			errs = append(errs, field.Invalid(path, f.JSONPath, "requires a schema"))
+			continue
+		}
+		s := schema
+		for _, segment := range strings.Split(f.JSONPath[1:], ".") {
+			if !selectableFieldPathSegment.MatchString(segment) {
+				s = nil
+				errs = append(errs, field.Invalid(path, f.JSONPath, "must be a simple JSON path of field names"))
+				break
+			}
+			child, found := s.Properties[segment]
+			if !found {
+				s = nil
+				errs = append(errs, field.Invalid(path, f.JSONPath, "does not exist in the schema"))
+				break
+			}
+			s = &child
+		}
+		if s == nil {
+			continue
+		}
+		switch s.Type {
+		case "string", "integer", "boolean":
+		default:
+			errs = append(errs, field.Invalid(path, f.JSONPath, "must point to a field of type string, boolean or integer"))
+		}
+	}
+	return errs
+}
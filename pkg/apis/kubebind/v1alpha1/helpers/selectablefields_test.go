@@ -0,0 +1,133 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/version"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+)
+
+func newSelectableTestCRD() *apiextensionsv1.CustomResourceDefinition {
+	crd := newTestCRD()
+	crd.Spec.Versions[0].Schema.OpenAPIV3Schema = &apiextensionsv1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"spec": {
+				Type: "object",
+				Properties: map[string]apiextensionsv1.JSONSchemaProps{
+					"tier":     {Type: "string"},
+					"replicas": {Type: "integer"},
+					"backup":   {Type: "object"},
+				},
+			},
+		},
+	}
+	return crd
+}
+
+func TestSelectableFieldsSurviveExport(t *testing.T) {
+	crd := newSelectableTestCRD()
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(crd)
+	require.NoError(t, err)
+	provider := &unstructured.Unstructured{Object: obj}
+	versions, _, err := unstructured.NestedSlice(provider.Object, "spec", "versions")
+	require.NoError(t, err)
+	versions[0].(map[string]interface{})["selectableFields"] = []interface{}{
+		map[string]interface{}{"jsonPath": ".spec.tier"},
+		map[string]interface{}{"jsonPath": ".spec.replicas"},
+	}
+	require.NoError(t, unstructured.SetNestedSlice(provider.Object, versions, "spec", "versions"))
+
+	// provider CRD -> APIServiceExportResource
+	fields, err := CRDSelectableFields(provider)
+	require.NoError(t, err)
+	resource, err := CRDToServiceExportResource(crd)
+	require.NoError(t, err)
+	SetSelectableFields(resource, fields)
+	want := []kubebindv1alpha1.SelectableField{{JSONPath: ".spec.tier"}, {JSONPath: ".spec.replicas"}}
+	require.Equal(t, want, resource.Spec.Versions[0].SelectableFields)
+
+	// APIServiceExportResource -> consumer CRD
+	consumer, err := ServiceExportResourceToCRD(resource, nil)
+	require.NoError(t, err)
+	data, err := json.Marshal(consumer)
+	require.NoError(t, err)
+
+	require.Nil(t, ConsumerSelectableFields(resource, version.MustParseGeneric("1.29.3")), "older consumers do not get selectable fields")
+	require.Nil(t, ConsumerSelectableFields(resource, nil))
+	applied, err := WithSelectableFields(data, ConsumerSelectableFields(resource, version.MustParseGeneric("1.30.0")))
+	require.NoError(t, err)
+
+	got := &unstructured.Unstructured{}
+	require.NoError(t, json.Unmarshal(applied, &got.Object))
+	gotFields, err := CRDSelectableFields(got)
+	require.NoError(t, err)
+	require.Equal(t, map[string][]kubebindv1alpha1.SelectableField{"v1alpha1": want}, gotFields)
+
+	unchanged, err := WithSelectableFields(data, nil)
+	require.NoError(t, err)
+	require.Equal(t, data, unchanged)
+}
+
+func TestValidateSelectableFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		fields   []kubebindv1alpha1.SelectableField
+		noSchema bool
+		wantErr  string
+	}{
+		{name: "string and integer", fields: []kubebindv1alpha1.SelectableField{{JSONPath: ".spec.tier"}, {JSONPath: ".spec.replicas"}}},
+		{name: "missing dot", fields: []kubebindv1alpha1.SelectableField{{JSONPath: "spec.tier"}}, wantErr: "must be a simple JSON path starting with a dot"},
+		{name: "not in schema", fields: []kubebindv1alpha1.SelectableField{{JSONPath: ".spec.size"}}, wantErr: "does not exist in the schema"},
+		{name: "object", fields: []kubebindv1alpha1.SelectableField{{JSONPath: ".spec.backup"}}, wantErr: "must point to a field of type string, boolean or integer"},
+		{name: "array index", fields: []kubebindv1alpha1.SelectableField{{JSONPath: ".spec[0]"}}, wantErr: "must be a simple JSON path of field names"},
+		{name: "duplicate", fields: []kubebindv1alpha1.SelectableField{{JSONPath: ".spec.tier"}, {JSONPath: ".spec.tier"}}, wantErr: "Duplicate value"},
+		{name: "empty", fields: []kubebindv1alpha1.SelectableField{{}}, wantErr: "Required value"},
+		{name: "too many", fields: []kubebindv1alpha1.SelectableField{
+			{JSONPath: ".a"}, {JSONPath: ".b"}, {JSONPath: ".c"}, {JSONPath: ".d"}, {JSONPath: ".e"}, {JSONPath: ".f"}, {JSONPath: ".g"}, {JSONPath: ".h"}, {JSONPath: ".i"},
+		}, wantErr: "must have at most 8 items"},
+		{name: "no schema", fields: []kubebindv1alpha1.SelectableField{{JSONPath: ".spec.tier"}}, noSchema: true, wantErr: "requires a schema"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crd := newSelectableTestCRD()
+			if tt.noSchema {
+				crd.Spec.Versions[0].Schema = nil
+			}
+			resource, err := CRDToServiceExportResource(crd)
+			require.NoError(t, err)
+			resource.Spec.Versions[0].SelectableFields = tt.fields
+
+			_, err = ServiceExportResourceToCRD(resource, nil)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+			require.ErrorContains(t, err, "spec.versions[0].selectableFields")
+		})
+	}
+}
@@ -17,31 +17,198 @@ limitations under the License.
 package helpers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	structuraldefaulting "k8s.io/apiextensions-apiserver/pkg/apiserver/schema/defaulting"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	"sigs.k8s.io/yaml"
 
 	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
 )
 
-// ServiceExportResourceToCRD converts a APIServiceExportResource to a CRD.
-func ServiceExportResourceToCRD(resource *kubebindv1alpha1.APIServiceExportResource) (*apiextensionsv1.CustomResourceDefinition, error) {
+// ResourceProblem is a single reason why an APIServiceExportResource cannot be
+// converted into a CRD.
+type ResourceProblem struct {
+	// Version is the name of the affected version, or empty if the problem is not
+	// specific to a version.
+	Version string
+
+	*field.Error
+}
+
+func (p ResourceProblem) String() string {
+	if p.Version == "" {
+		return p.Error.Error()
+	}
+	return fmt.Sprintf("version %q: %s", p.Version, p.Error.Error())
+}
+
+// InvalidResourceError is returned by ServiceExportResourceToCRD and enumerates all
+// problems of the APIServiceExportResource.
+type InvalidResourceError struct {
+	Resource string
+	Problems []ResourceProblem
+}
+
+func (e *InvalidResourceError) Error() string {
+	return fmt.Sprintf("invalid APIServiceExportResource %s: %s", e.Resource, e.Message())
+}
+
+// NameTooLong returns whether the name of the generated CRD is too long.
+func (e *InvalidResourceError) NameTooLong() bool {
+	for _, p := range e.Problems {
+		if p.Type == field.ErrorTypeTooLong && p.Field == "metadata.name" {
+			return true
+		}
+	}
+	return false
+}
+
+// Message returns the problems on a single line, e.g. for condition messages.
+func (e *InvalidResourceError) Message() string {
+	msgs := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		msgs = append(msgs, p.String())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ConsumerGroupNames returns the group and names of the resource on the consumer
+// cluster, i.e. with the consumer rewrite applied.
+func ConsumerGroupNames(resource *kubebindv1alpha1.APIServiceExportResource) (string, apiextensionsv1.CustomResourceDefinitionNames) {
+	group, names := resource.Spec.Group, *resource.Spec.Names.DeepCopy()
+	if rewrite := resource.Spec.ConsumerRewrite; rewrite != nil {
+		if rewrite.Group != "" {
+			group = rewrite.Group
+		}
+		if rewrite.Names != nil {
+			names = *rewrite.Names.DeepCopy()
+			if names.ListKind == "" {
+				names.ListKind = names.Kind + "List"
+			}
+		}
+	}
+	return group, names
+}
+
+// ServiceExportResourceAnnotationKey is set on consumer CRDs named differently than
+// their APIServiceExportResource, e.g. through a consumer rewrite, to its name.
+const ServiceExportResourceAnnotationKey = "kube-bind.io/service-export-resource"
+
+// ServiceExportResourceName returns the name of the APIServiceExportResource of the
+// consumer CRD.
+func ServiceExportResourceName(crd *apiextensionsv1.CustomResourceDefinition) string {
+	if name, found := crd.Annotations[ServiceExportResourceAnnotationKey]; found {
+		return name
+	}
+	return crd.Name
+}
+
+// WithConsumerGroupSuffix returns the resource with the suffix appended to its group on
+// the consumer cluster, see APIServiceBindingSpec.ConsumerGroupSuffix. The resource is
+// returned as is if the suffix is empty, otherwise it is a copy.
+func WithConsumerGroupSuffix(resource *kubebindv1alpha1.APIServiceExportResource, suffix string) *kubebindv1alpha1.APIServiceExportResource {
+	if suffix == "" {
+		return resource
+	}
+	group, _ := ConsumerGroupNames(resource)
+	resource = resource.DeepCopy()
+	if resource.Spec.ConsumerRewrite == nil {
+		resource.Spec.ConsumerRewrite = &kubebindv1alpha1.APIServiceExportResourceRewrite{}
+	}
+	resource.Spec.ConsumerRewrite.Group = group + "." + suffix
+	return resource
+}
+
+// ConsumerCRDName returns the name of the CRD of the resource on the consumer cluster.
+func ConsumerCRDName(resource *kubebindv1alpha1.APIServiceExportResource) string {
+	if resource.Spec.ConsumerRewrite == nil {
+		return resource.Name
+	}
+	group, names := ConsumerGroupNames(resource)
+	return names.Plural + "." + group
+}
+
+// ServiceExportResourceToCRD converts a APIServiceExportResource to a CRD. If versions
+// are given, e.g. pinned by the APIServiceExport, the CRD has only those of them
+// the resource has, see PinVersions. Invalid resources are reported with an
+// *InvalidResourceError.
+func ServiceExportResourceToCRD(resource *kubebindv1alpha1.APIServiceExportResource, versions []string) (*apiextensionsv1.CustomResourceDefinition, error) {
+	var problems []ResourceProblem
+	specPath := field.NewPath("spec")
+	if len(versions) > 0 {
+		pinned := resource.DeepCopy()
+		if err := PinVersions(pinned, versions); err != nil {
+			problems = append(problems, ResourceProblem{Error: field.Invalid(specPath.Child("versions"), versions, err.Error())})
+		} else {
+			resource = pinned
+		}
+	}
+	for _, err := range validateNames(specPath.Child("names"), &resource.Spec.Names) {
+		problems = append(problems, ResourceProblem{Error: err})
+	}
+	if err := validateStorageVersion(specPath.Child("storageVersion"), resource); err != nil {
+		problems = append(problems, ResourceProblem{Error: err})
+	}
+	if err := validateConsumerNamespace(specPath.Child("consumerNamespace"), resource); err != nil {
+		problems = append(problems, ResourceProblem{Error: err})
+	}
+	if err := validateCanonicalVersion(specPath.Child("canonicalVersion"), resource); err != nil {
+		problems = append(problems, ResourceProblem{Error: err})
+	}
+	if propagation := resource.Spec.MetadataPropagation; propagation != nil {
+		for _, err := range validateMetadataPropagation(specPath.Child("metadataPropagation"), propagation) {
+			problems = append(problems, ResourceProblem{Error: err})
+		}
+	}
+
+	group, names := ConsumerGroupNames(resource)
 	crd := &apiextensionsv1.CustomResourceDefinition{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: resource.Name,
+			Name: ConsumerCRDName(resource),
 		},
 		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
-			Group: resource.Spec.Group,
-			Names: resource.Spec.Names,
+			Group: group,
+			Names: names,
 			Scope: resource.Spec.Scope,
 		},
 	}
+	if metadata := resource.Spec.CRDMetadata; metadata != nil {
+		crd.Labels = filterMetadata(metadata.Labels, resource.Spec.MetadataPropagation)
+		crd.Annotations = filterMetadata(metadata.Annotations, resource.Spec.MetadataPropagation)
+	}
+	if crd.Name != resource.Name {
+		// the resource cannot be derived from the name of the CRD anymore.
+		if crd.Annotations == nil {
+			crd.Annotations = map[string]string{}
+		}
+		crd.Annotations[ServiceExportResourceAnnotationKey] = resource.Name
+	}
+	if rewrite := resource.Spec.ConsumerRewrite; rewrite != nil {
+		for _, err := range validateRewrite(specPath.Child("consumerRewrite"), rewrite) {
+			problems = append(problems, ResourceProblem{Error: err})
+		}
+	}
+	if err := validateCRDName(field.NewPath("metadata", "name"), crd.Name); err != nil {
+		problems = append(problems, ResourceProblem{Error: err})
+	}
 
+	// with a canonical version, the consumer CRD serves and stores only that version.
+	canonical := resource.Spec.CanonicalVersion
 	for i := range resource.Spec.Versions {
 		resourceVersion := resource.Spec.Versions[i]
+		if canonical != "" && resourceVersion.Name != canonical {
+			continue
+		}
 
 		crdVersion := apiextensionsv1.CustomResourceDefinitionVersion{
 			Name:                     resourceVersion.Name,
@@ -51,22 +218,49 @@ func ServiceExportResourceToCRD(resource *kubebindv1alpha1.APIServiceExportResou
 			DeprecationWarning:       resourceVersion.DeprecationWarning,
 			AdditionalPrinterColumns: resourceVersion.AdditionalPrinterColumns,
 		}
+		if resource.Spec.StorageVersion != "" {
+			crdVersion.Storage = resourceVersion.Name == resource.Spec.StorageVersion
+		}
+		if canonical != "" {
+			crdVersion.Served = true
+			crdVersion.Storage = true
+		}
 
 		if len(resourceVersion.Schema.OpenAPIV3Schema.Raw) > 0 {
+			schemaPath := specPath.Child("versions").Index(i).Child("schema", "openAPIV3Schema")
 			var schema apiextensionsv1.JSONSchemaProps
 			if err := yaml.Unmarshal(resourceVersion.Schema.OpenAPIV3Schema.Raw, &schema); err != nil {
-				return nil, fmt.Errorf("failed to unmarshal schema for version %q: %w", resourceVersion.Name, err)
+				problems = append(problems, ResourceProblem{
+					Version: resourceVersion.Name,
+					Error:   field.Invalid(schemaPath, string(resourceVersion.Schema.OpenAPIV3Schema.Raw), fmt.Sprintf("failed to unmarshal schema: %v", err)),
+				})
+				continue
+			}
+			for _, err := range validateStructuralSchema(schemaPath, &schema) {
+				problems = append(problems, ResourceProblem{Version: resourceVersion.Name, Error: err})
 			}
 			crdVersion.Schema = &apiextensionsv1.CustomResourceValidation{
 				OpenAPIV3Schema: &schema,
 			}
 		}
+		if len(resourceVersion.SelectableFields) > 0 {
+			var schema *apiextensionsv1.JSONSchemaProps
+			if crdVersion.Schema != nil {
+				schema = crdVersion.Schema.OpenAPIV3Schema
+			}
+			for _, err := range validateSelectableFields(specPath.Child("versions").Index(i).Child("selectableFields"), resourceVersion.SelectableFields, schema) {
+				problems = append(problems, ResourceProblem{Version: resourceVersion.Name, Error: err})
+			}
+		}
 
 		crdVersion.Subresources = &resourceVersion.Subresources
 
 		crd.Spec.Versions = append(crd.Spec.Versions, crdVersion)
 	}
 
+	if len(problems) > 0 {
+		return nil, &InvalidResourceError{Resource: resource.Name, Problems: problems}
+	}
 	return crd, nil
 }
 
@@ -78,12 +272,24 @@ func CRDToServiceExportResource(crd *apiextensionsv1.CustomResourceDefinition) (
 		},
 		Spec: kubebindv1alpha1.APIServiceExportResourceSpec{
 			Group: crd.Spec.Group,
-			Names: crd.Spec.Names,
+			Names: *crd.Spec.Names.DeepCopy(),
 			Scope: crd.Spec.Scope,
+
+			ConversionStrategy: apiextensionsv1.NoneConverter,
+
+			CRDMetadata: exportedCRDMetadata(crd.Labels, crd.Annotations),
 		},
 	}
+	if crd.Spec.Conversion != nil && crd.Spec.Conversion.Strategy != "" {
+		apiResourceSchema.Spec.ConversionStrategy = crd.Spec.Conversion.Strategy
+	}
 
-	onlyFirstServingVersion := crd.Spec.Conversion != nil && crd.Spec.Conversion.Strategy == apiextensionsv1.WebhookConverter
+	canonical := crd.Annotations[kubebindv1alpha1.CanonicalVersionAnnotationKey]
+	apiResourceSchema.Spec.CanonicalVersion = canonical
+
+	// the consumer cannot call the conversion webhook, hence a single version is passed
+	// through, the canonical one if chosen.
+	onlyOneServingVersion := apiResourceSchema.Spec.ConversionStrategy == apiextensionsv1.WebhookConverter
 	// TODO: come up with an API to select versions
 	for i := range crd.Spec.Versions {
 		crdVersion := crd.Spec.Versions[i]
@@ -92,6 +298,9 @@ func CRDToServiceExportResource(crd *apiextensionsv1.CustomResourceDefinition) (
 		if !crdVersion.Served {
 			continue
 		}
+		if onlyOneServingVersion && canonical != "" && crdVersion.Name != canonical {
+			continue
+		}
 
 		apiResourceVersion := kubebindv1alpha1.APIServiceExportResourceVersion{
 			Name:                     crdVersion.Name,
@@ -116,10 +325,237 @@ func CRDToServiceExportResource(crd *apiextensionsv1.CustomResourceDefinition) (
 
 		apiResourceSchema.Spec.Versions = append(apiResourceSchema.Spec.Versions, apiResourceVersion)
 
-		if onlyFirstServingVersion {
+		if onlyOneServingVersion {
 			break
 		}
 	}
 
+	if group := crd.Annotations[kubebindv1alpha1.ConsumerGroupAnnotationKey]; group != "" {
+		apiResourceSchema.Spec.ConsumerRewrite = &kubebindv1alpha1.APIServiceExportResourceRewrite{Group: group}
+	}
+
+	apiResourceSchema.Spec.ConsumerNamespace = crd.Annotations[kubebindv1alpha1.ConsumerNamespaceAnnotationKey]
+
+	apiResourceSchema.Spec.StorageVersion = crd.Annotations[kubebindv1alpha1.StorageVersionAnnotationKey]
+	if apiResourceSchema.Spec.StorageVersion == "" {
+		// the canonical version is the only one stored on the consumer cluster.
+		apiResourceSchema.Spec.StorageVersion = canonical
+	}
+	if apiResourceSchema.Spec.StorageVersion == "" {
+		for _, v := range apiResourceSchema.Spec.Versions {
+			if v.Storage {
+				apiResourceSchema.Spec.StorageVersion = v.Name
+				break
+			}
+		}
+	}
+	if apiResourceSchema.Spec.StorageVersion == "" && len(apiResourceSchema.Spec.Versions) > 0 {
+		// the storage version is not exported, e.g. with webhook conversion.
+		apiResourceSchema.Spec.StorageVersion = apiResourceSchema.Spec.Versions[0].Name
+	}
+
 	return apiResourceSchema, nil
 }
+
+// PinVersions drops the versions of the resource that are not pinned. No pinned
+// versions keep all versions. If the storage version is dropped, the first pinned
+// version becomes the storage version.
+func PinVersions(resource *kubebindv1alpha1.APIServiceExportResource, pinned []string) error {
+	if len(pinned) == 0 {
+		return nil
+	}
+
+	wanted := sets.NewString(pinned...)
+	var versions []kubebindv1alpha1.APIServiceExportResourceVersion
+	for _, v := range resource.Spec.Versions {
+		if wanted.Has(v.Name) {
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 0 {
+		return fmt.Errorf("none of the versions %s is exported", strings.Join(pinned, ", "))
+	}
+	resource.Spec.Versions = versions
+
+	for _, v := range versions {
+		if v.Name == resource.Spec.StorageVersion {
+			return nil
+		}
+	}
+	resource.Spec.StorageVersion = versions[0].Name
+
+	return nil
+}
+
+// ValidateStorageVersion checks that the storage version of the resource is
+// one of its versions.
+func ValidateStorageVersion(resource *kubebindv1alpha1.APIServiceExportResource) error {
+	if err := validateStorageVersion(field.NewPath("spec", "storageVersion"), resource); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validateStorageVersion(fldPath *field.Path, resource *kubebindv1alpha1.APIServiceExportResource) *field.Error {
+	if resource.Spec.StorageVersion == "" {
+		return nil
+	}
+	var names []string
+	for _, v := range resource.Spec.Versions {
+		if v.Name == resource.Spec.StorageVersion {
+			return nil
+		}
+		names = append(names, v.Name)
+	}
+	return field.NotSupported(fldPath, resource.Spec.StorageVersion, names)
+}
+
+// ValidateCanonicalVersion checks that the canonical version of the resource is one
+// of its versions, and that it does not contradict the storage version.
+func ValidateCanonicalVersion(resource *kubebindv1alpha1.APIServiceExportResource) error {
+	if err := validateCanonicalVersion(field.NewPath("spec", "canonicalVersion"), resource); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validateCanonicalVersion(fldPath *field.Path, resource *kubebindv1alpha1.APIServiceExportResource) *field.Error {
+	canonical := resource.Spec.CanonicalVersion
+	if canonical == "" {
+		return nil
+	}
+	var names []string
+	for _, v := range resource.Spec.Versions {
+		names = append(names, v.Name)
+	}
+	if !sets.NewString(names...).Has(canonical) {
+		return field.NotSupported(fldPath, canonical, names)
+	}
+	if storage := resource.Spec.StorageVersion; storage != "" && storage != canonical {
+		return field.Invalid(fldPath, canonical, fmt.Sprintf("must equal the storage version %q", storage))
+	}
+	return nil
+}
+
+// validateConsumerNamespace checks that the consumer namespace is a namespace name,
+// and only set for namespaced resources.
+func validateConsumerNamespace(fldPath *field.Path, resource *kubebindv1alpha1.APIServiceExportResource) *field.Error {
+	ns := resource.Spec.ConsumerNamespace
+	if ns == "" {
+		return nil
+	}
+	if resource.Spec.Scope != apiextensionsv1.NamespaceScoped {
+		return field.Invalid(fldPath, ns, "only allowed for namespaced resources")
+	}
+	if msgs := validation.IsDNS1123Label(ns); len(msgs) > 0 {
+		return field.Invalid(fldPath, ns, strings.Join(msgs, ", "))
+	}
+	return nil
+}
+
+// validateCRDName checks the length of the name of the generated CRD, the plural and
+// the group joined by a dot, which can exceed the maximal length although both are
+// valid on their own, e.g. with a long consumer group.
+func validateCRDName(fldPath *field.Path, name string) *field.Error {
+	if len(name) > validation.DNS1123SubdomainMaxLength {
+		err := field.TooLong(fldPath, name, validation.DNS1123SubdomainMaxLength)
+		err.Detail = fmt.Sprintf("the generated CustomResourceDefinition name has %d characters, but must have at most %d", len(name), validation.DNS1123SubdomainMaxLength)
+		return err
+	}
+	return nil
+}
+
+// validateStructuralSchema checks that the schema is structural and that its defaults
+// survive pruning, as the consumer API server requires before it serves the CRD.
+func validateStructuralSchema(fldPath *field.Path, schema *apiextensionsv1.JSONSchemaProps) field.ErrorList {
+	var internal apiextensions.JSONSchemaProps
+	if err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(schema, &internal, nil); err != nil {
+		return field.ErrorList{field.Invalid(fldPath, "", err.Error())}
+	}
+	structural, err := structuralschema.NewStructural(&internal)
+	if err != nil {
+		return field.ErrorList{field.Invalid(fldPath, "", err.Error())}
+	}
+
+	if errs := structuralschema.ValidateStructural(fldPath, structural); len(errs) > 0 {
+		return errs
+	}
+	errs, err := structuraldefaulting.ValidateDefaults(context.TODO(), fldPath, structural, true, true)
+	if err != nil {
+		return append(errs, field.InternalError(fldPath, err))
+	}
+	return errs
+}
+
+// validateNames checks that the short names and categories, which are carried over
+// to the consumer CRD as they are, do not conflict with each other or with the
+// plural and singular names.
+func validateNames(fldPath *field.Path, names *apiextensionsv1.CustomResourceDefinitionNames) field.ErrorList {
+	var errs field.ErrorList
+	seen := sets.NewString(names.Plural)
+	if names.Singular != "" {
+		seen.Insert(names.Singular)
+	}
+	for i, shortName := range names.ShortNames {
+		if msgs := validation.IsDNS1035Label(shortName); len(msgs) > 0 {
+			errs = append(errs, field.Invalid(fldPath.Child("shortNames").Index(i), shortName, strings.Join(msgs, ", ")))
+			continue
+		}
+		if seen.Has(shortName) {
+			errs = append(errs, field.Duplicate(fldPath.Child("shortNames").Index(i), shortName))
+			continue
+		}
+		seen.Insert(shortName)
+	}
+
+	categories := sets.NewString()
+	for i, category := range names.Categories {
+		if msgs := validation.IsDNS1035Label(category); len(msgs) > 0 {
+			errs = append(errs, field.Invalid(fldPath.Child("categories").Index(i), category, strings.Join(msgs, ", ")))
+			continue
+		}
+		if categories.Has(category) {
+			errs = append(errs, field.Duplicate(fldPath.Child("categories").Index(i), category))
+			continue
+		}
+		categories.Insert(category)
+	}
+
+	return errs
+}
+
+// validateRewrite checks that the rewritten group and names form a valid CRD on the
+// consumer cluster.
+func validateRewrite(fldPath *field.Path, rewrite *kubebindv1alpha1.APIServiceExportResourceRewrite) field.ErrorList {
+	var errs field.ErrorList
+	if rewrite.Group != "" {
+		groupPath := fldPath.Child("group")
+		if msgs := validation.IsDNS1123Subdomain(rewrite.Group); len(msgs) > 0 {
+			errs = append(errs, field.Invalid(groupPath, rewrite.Group, strings.Join(msgs, ", ")))
+		} else if IsBuiltInGroup(rewrite.Group) {
+			errs = append(errs, field.Invalid(groupPath, rewrite.Group, "must contain a dot"))
+		} else if IsGroupForbidden(rewrite.Group, DefaultForbiddenGroups) {
+			errs = append(errs, field.Invalid(groupPath, rewrite.Group, "must not belong to Kubernetes or kube-bind"))
+		}
+	}
+
+	if names := rewrite.Names; names != nil {
+		namesPath := fldPath.Child("names")
+		if msgs := validation.IsDNS1035Label(names.Plural); len(msgs) > 0 {
+			errs = append(errs, field.Invalid(namesPath.Child("plural"), names.Plural, strings.Join(msgs, ", ")))
+		}
+		if names.Singular != "" {
+			if msgs := validation.IsDNS1035Label(names.Singular); len(msgs) > 0 {
+				errs = append(errs, field.Invalid(namesPath.Child("singular"), names.Singular, strings.Join(msgs, ", ")))
+			}
+		}
+		if names.Kind == "" {
+			errs = append(errs, field.Required(namesPath.Child("kind"), ""))
+		} else if names.ListKind == names.Kind {
+			errs = append(errs, field.Invalid(namesPath.Child("listKind"), names.ListKind, "must differ from kind"))
+		}
+		errs = append(errs, validateNames(namesPath, names)...)
+	}
+
+	return errs
+}
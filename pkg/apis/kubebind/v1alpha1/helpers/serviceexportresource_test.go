@@ -0,0 +1,557 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package helpers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsvalidation "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/validation"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+)
+
+func newTestCRD() *apiextensionsv1.CustomResourceDefinition {
+	return &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group: "mangodb.com",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{
+				Plural:     "mangodbs",
+				Singular:   "mangodb",
+				Kind:       "MangoDB",
+				ListKind:   "MangoDBList",
+				ShortNames: []string{"mdb"},
+				Categories: []string{"all", "databases"},
+			},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{
+					Name:    "v1alpha1",
+					Served:  true,
+					Storage: true,
+					Schema: &apiextensionsv1.CustomResourceValidation{
+						OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{Type: "object"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestExportPreservesNames(t *testing.T) {
+	crd := newTestCRD()
+
+	resource, err := CRDToServiceExportResource(crd)
+	require.NoError(t, err)
+	got, err := ServiceExportResourceToCRD(resource, nil)
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"mdb"}, got.Spec.Names.ShortNames)
+	require.Equal(t, []string{"all", "databases"}, got.Spec.Names.Categories)
+
+	// the generated CRD must not alias the slices of the resource.
+	got.Spec.Names.ShortNames[0] = "changed"
+	require.Equal(t, "mdb", resource.Spec.Names.ShortNames[0])
+}
+
+func TestExportNameConflicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(names *apiextensionsv1.CustomResourceDefinitionNames)
+	}{
+		{"short name equals plural", func(names *apiextensionsv1.CustomResourceDefinitionNames) {
+			names.ShortNames = []string{"mangodbs"}
+		}},
+		{"short name equals singular", func(names *apiextensionsv1.CustomResourceDefinitionNames) {
+			names.ShortNames = []string{"mangodb"}
+		}},
+		{"duplicate short name", func(names *apiextensionsv1.CustomResourceDefinitionNames) {
+			names.ShortNames = []string{"mdb", "mdb"}
+		}},
+		{"duplicate category", func(names *apiextensionsv1.CustomResourceDefinitionNames) {
+			names.Categories = []string{"all", "all"}
+		}},
+		{"invalid category", func(names *apiextensionsv1.CustomResourceDefinitionNames) {
+			names.Categories = []string{"Not Valid"}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource, err := CRDToServiceExportResource(newTestCRD())
+			require.NoError(t, err)
+			tt.mutate(&resource.Spec.Names)
+
+			_, err = ServiceExportResourceToCRD(resource, nil)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestExportConsumerRewrite(t *testing.T) {
+	crd := newTestCRD()
+	crd.Annotations = map[string]string{kubebindv1alpha1.ConsumerGroupAnnotationKey: "acme.io"}
+	resource, err := CRDToServiceExportResource(crd)
+	require.NoError(t, err)
+	require.Equal(t, &kubebindv1alpha1.APIServiceExportResourceRewrite{Group: "acme.io"}, resource.Spec.ConsumerRewrite)
+
+	got, err := ServiceExportResourceToCRD(resource, nil)
+	require.NoError(t, err)
+	require.Equal(t, "mangodbs.acme.io", got.Name)
+	require.Equal(t, "acme.io", got.Spec.Group)
+	require.Equal(t, crd.Spec.Names, got.Spec.Names)
+	requireValidCRD(t, got)
+
+	// names are replaced as a whole.
+	resource.Spec.ConsumerRewrite.Names = &apiextensionsv1.CustomResourceDefinitionNames{Plural: "acmedbs", Singular: "acmedb", Kind: "AcmeDB"}
+	got, err = ServiceExportResourceToCRD(resource, nil)
+	require.NoError(t, err)
+	require.Equal(t, "acmedbs.acme.io", got.Name)
+	require.Equal(t, apiextensionsv1.CustomResourceDefinitionNames{Plural: "acmedbs", Singular: "acmedb", Kind: "AcmeDB", ListKind: "AcmeDBList"}, got.Spec.Names)
+	requireValidCRD(t, got)
+
+	tests := []struct {
+		name    string
+		rewrite kubebindv1alpha1.APIServiceExportResourceRewrite
+		field   string
+	}{
+		{name: "group without dot", rewrite: kubebindv1alpha1.APIServiceExportResourceRewrite{Group: "acme"}, field: "spec.consumerRewrite.group"},
+		{name: "invalid group", rewrite: kubebindv1alpha1.APIServiceExportResourceRewrite{Group: "Acme.io"}, field: "spec.consumerRewrite.group"},
+		{name: "forbidden group", rewrite: kubebindv1alpha1.APIServiceExportResourceRewrite{Group: "apps.kube-bind.io"}, field: "spec.consumerRewrite.group"},
+		{name: "invalid plural", rewrite: kubebindv1alpha1.APIServiceExportResourceRewrite{Names: &apiextensionsv1.CustomResourceDefinitionNames{Plural: "Acme_DBs", Kind: "AcmeDB"}}, field: "spec.consumerRewrite.names.plural"},
+		{name: "missing kind", rewrite: kubebindv1alpha1.APIServiceExportResourceRewrite{Names: &apiextensionsv1.CustomResourceDefinitionNames{Plural: "acmedbs"}}, field: "spec.consumerRewrite.names.kind"},
+		{name: "list kind equals kind", rewrite: kubebindv1alpha1.APIServiceExportResourceRewrite{Names: &apiextensionsv1.CustomResourceDefinitionNames{Plural: "acmedbs", Kind: "AcmeDB", ListKind: "AcmeDB"}}, field: "spec.consumerRewrite.names.listKind"},
+		{name: "short name conflict", rewrite: kubebindv1alpha1.APIServiceExportResourceRewrite{Names: &apiextensionsv1.CustomResourceDefinitionNames{Plural: "acmedbs", Kind: "AcmeDB", ShortNames: []string{"acmedbs"}}}, field: "spec.consumerRewrite.names.shortNames[0]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invalid := resource.DeepCopy()
+			invalid.Spec.ConsumerRewrite = &tt.rewrite
+			_, err := ServiceExportResourceToCRD(invalid, nil)
+			var invalidErr *InvalidResourceError
+			require.ErrorAs(t, err, &invalidErr)
+			require.Len(t, invalidErr.Problems, 1)
+			require.Equal(t, tt.field, invalidErr.Problems[0].Field)
+		})
+	}
+}
+
+// requireValidCRD checks the CRD with the validation of the API server.
+func requireValidCRD(t *testing.T, crd *apiextensionsv1.CustomResourceDefinition) {
+	t.Helper()
+
+	crd = crd.DeepCopy()
+	apiextensionsv1.SetObjectDefaults_CustomResourceDefinition(crd)
+	for _, v := range crd.Spec.Versions {
+		if v.Storage {
+			crd.Status.StoredVersions = append(crd.Status.StoredVersions, v.Name)
+		}
+	}
+	var internal apiextensions.CustomResourceDefinition
+	require.NoError(t, apiextensionsv1.Convert_v1_CustomResourceDefinition_To_apiextensions_CustomResourceDefinition(crd, &internal, nil))
+	require.Empty(t, apiextensionsvalidation.ValidateCustomResourceDefinition(context.Background(), &internal))
+}
+
+func TestExportConversionStrategy(t *testing.T) {
+	crd := newTestCRD()
+	crd.Spec.Versions = append(crd.Spec.Versions, apiextensionsv1.CustomResourceDefinitionVersion{Name: "v1beta1", Served: true})
+
+	resource, err := CRDToServiceExportResource(crd)
+	require.NoError(t, err)
+	require.Equal(t, apiextensionsv1.NoneConverter, resource.Spec.ConversionStrategy)
+	require.Len(t, resource.Spec.Versions, 2)
+
+	crd.Spec.Conversion = &apiextensionsv1.CustomResourceConversion{Strategy: apiextensionsv1.WebhookConverter}
+	resource, err = CRDToServiceExportResource(crd)
+	require.NoError(t, err)
+	require.Equal(t, apiextensionsv1.WebhookConverter, resource.Spec.ConversionStrategy)
+	require.Len(t, resource.Spec.Versions, 1, "webhook conversion must pass through a single version")
+}
+
+func TestExportStorageVersion(t *testing.T) {
+	storageVersions := func(crd *apiextensionsv1.CustomResourceDefinition) []string {
+		var names []string
+		for _, v := range crd.Spec.Versions {
+			if v.Storage {
+				names = append(names, v.Name)
+			}
+		}
+		return names
+	}
+
+	crd := newTestCRD()
+	crd.Spec.Versions = append(crd.Spec.Versions, apiextensionsv1.CustomResourceDefinitionVersion{Name: "v1beta1", Served: true})
+
+	t.Run("default", func(t *testing.T) {
+		resource, err := CRDToServiceExportResource(crd)
+		require.NoError(t, err)
+		require.Equal(t, "v1alpha1", resource.Spec.StorageVersion)
+
+		got, err := ServiceExportResourceToCRD(resource, nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{"v1alpha1"}, storageVersions(got))
+	})
+
+	t.Run("selected by annotation", func(t *testing.T) {
+		crd := crd.DeepCopy()
+		crd.Annotations = map[string]string{kubebindv1alpha1.StorageVersionAnnotationKey: "v1beta1"}
+		resource, err := CRDToServiceExportResource(crd)
+		require.NoError(t, err)
+		require.Equal(t, "v1beta1", resource.Spec.StorageVersion)
+
+		got, err := ServiceExportResourceToCRD(resource, nil)
+		require.NoError(t, err)
+		require.Equal(t, []string{"v1beta1"}, storageVersions(got))
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		resource, err := CRDToServiceExportResource(crd)
+		require.NoError(t, err)
+		resource.Spec.StorageVersion = "v2"
+		require.Error(t, ValidateStorageVersion(resource))
+		_, err = ServiceExportResourceToCRD(resource, nil)
+		require.Error(t, err)
+	})
+}
+
+func TestExportConsumerNamespace(t *testing.T) {
+	crd := newTestCRD()
+	crd.Annotations = map[string]string{kubebindv1alpha1.ConsumerNamespaceAnnotationKey: "databases"}
+	resource, err := CRDToServiceExportResource(crd)
+	require.NoError(t, err)
+	require.Equal(t, "databases", resource.Spec.ConsumerNamespace)
+	_, err = ServiceExportResourceToCRD(resource, nil)
+	require.NoError(t, err)
+
+	t.Run("invalid name", func(t *testing.T) {
+		resource := resource.DeepCopy()
+		resource.Spec.ConsumerNamespace = "Databases"
+		_, err := ServiceExportResourceToCRD(resource, nil)
+		require.ErrorContains(t, err, "spec.consumerNamespace")
+	})
+
+	t.Run("cluster scoped", func(t *testing.T) {
+		resource := resource.DeepCopy()
+		resource.Spec.Scope = apiextensionsv1.ClusterScoped
+		_, err := ServiceExportResourceToCRD(resource, nil)
+		require.ErrorContains(t, err, "only allowed for namespaced resources")
+	})
+}
+
+func TestExportCanonicalVersion(t *testing.T) {
+	crd := newTestCRD()
+	crd.Spec.Versions[0].Storage = false
+	crd.Spec.Versions = append(crd.Spec.Versions,
+		apiextensionsv1.CustomResourceDefinitionVersion{Name: "v1beta1", Served: true, Storage: true, Schema: crd.Spec.Versions[0].Schema},
+		apiextensionsv1.CustomResourceDefinitionVersion{Name: "v1", Served: true, Schema: crd.Spec.Versions[0].Schema},
+	)
+	crd.Annotations = map[string]string{kubebindv1alpha1.CanonicalVersionAnnotationKey: "v1"}
+
+	resource, err := CRDToServiceExportResource(crd)
+	require.NoError(t, err)
+	require.Equal(t, "v1", resource.Spec.CanonicalVersion)
+	require.Equal(t, "v1", resource.Spec.StorageVersion, "the canonical version is the only one to store")
+	require.Len(t, resource.Spec.Versions, 3)
+
+	got, err := ServiceExportResourceToCRD(resource, nil)
+	require.NoError(t, err)
+	require.Len(t, got.Spec.Versions, 1)
+	require.Equal(t, "v1", got.Spec.Versions[0].Name)
+	require.True(t, got.Spec.Versions[0].Served)
+	require.True(t, got.Spec.Versions[0].Storage)
+
+	requireValidCRD(t, got)
+
+	t.Run("webhook conversion", func(t *testing.T) {
+		crd := crd.DeepCopy()
+		crd.Spec.Conversion = &apiextensionsv1.CustomResourceConversion{Strategy: apiextensionsv1.WebhookConverter}
+		resource, err := CRDToServiceExportResource(crd)
+		require.NoError(t, err)
+		require.Len(t, resource.Spec.Versions, 1)
+		require.Equal(t, "v1", resource.Spec.Versions[0].Name, "the canonical version must be passed through, not the first one")
+	})
+
+	t.Run("unknown version", func(t *testing.T) {
+		resource := resource.DeepCopy()
+		resource.Spec.CanonicalVersion = "v2"
+		resource.Spec.StorageVersion = ""
+		require.Error(t, ValidateCanonicalVersion(resource))
+		_, err := ServiceExportResourceToCRD(resource, nil)
+		require.ErrorContains(t, err, "spec.canonicalVersion")
+	})
+
+	t.Run("other storage version", func(t *testing.T) {
+		resource := resource.DeepCopy()
+		resource.Spec.StorageVersion = "v1beta1"
+		require.ErrorContains(t, ValidateCanonicalVersion(resource), "must equal the storage version")
+		_, err := ServiceExportResourceToCRD(resource, nil)
+		require.Error(t, err)
+	})
+}
+
+func TestExportSchemaFidelity(t *testing.T) {
+	preserve := true
+	schema := &apiextensionsv1.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensionsv1.JSONSchemaProps{
+			"spec": {
+				Type:    "object",
+				Default: &apiextensionsv1.JSON{Raw: []byte(`{"replicas":1}`)},
+				Properties: map[string]apiextensionsv1.JSONSchemaProps{
+					"replicas": {Type: "integer", Default: &apiextensionsv1.JSON{Raw: []byte(`1`)}},
+					"ratio":    {Type: "number", Default: &apiextensionsv1.JSON{Raw: []byte(`0.5`)}},
+					"size":     {Type: "integer", Default: &apiextensionsv1.JSON{Raw: []byte(`9007199254740993`)}},
+					"tier":     {Type: "string", Default: &apiextensionsv1.JSON{Raw: []byte(`"on"`)}},
+					"backup": {
+						Type: "object",
+						Properties: map[string]apiextensionsv1.JSONSchemaProps{
+							"schedule": {Type: "string", Default: &apiextensionsv1.JSON{Raw: []byte(`"@daily"`)}},
+							"tags":     {Type: "array", Default: &apiextensionsv1.JSON{Raw: []byte(`["a","b"]`)}, Items: &apiextensionsv1.JSONSchemaPropsOrArray{Schema: &apiextensionsv1.JSONSchemaProps{Type: "string"}}},
+						},
+					},
+					"config": {Type: "object", XPreserveUnknownFields: &preserve},
+					"extra": {
+						Type: "object",
+						Properties: map[string]apiextensionsv1.JSONSchemaProps{
+							"raw": {XPreserveUnknownFields: &preserve, XEmbeddedResource: true, Type: "object"},
+						},
+					},
+				},
+			},
+			"status": {Type: "object", XPreserveUnknownFields: &preserve},
+		},
+	}
+	crd := newTestCRD()
+	crd.Spec.Versions[0].Schema.OpenAPIV3Schema = schema.DeepCopy()
+
+	resource, err := CRDToServiceExportResource(crd)
+	require.NoError(t, err)
+	got, err := ServiceExportResourceToCRD(resource, nil)
+	require.NoError(t, err)
+	require.Equal(t, schema, got.Spec.Versions[0].Schema.OpenAPIV3Schema)
+}
+
+func TestExportValidationRules(t *testing.T) {
+	schema := func(rules apiextensionsv1.ValidationRules) *apiextensionsv1.JSONSchemaProps {
+		return &apiextensionsv1.JSONSchemaProps{
+			Type: "object",
+			Properties: map[string]apiextensionsv1.JSONSchemaProps{
+				"spec": {
+					Type:         "object",
+					XValidations: rules,
+					Properties: map[string]apiextensionsv1.JSONSchemaProps{
+						"minReplicas": {Type: "integer"},
+						"maxReplicas": {Type: "integer"},
+						"tier": {
+							Type:         "string",
+							XValidations: apiextensionsv1.ValidationRules{{Rule: "self == oldSelf", Message: "tier is immutable"}},
+						},
+					},
+				},
+			},
+		}
+	}
+	v1alpha1 := schema(apiextensionsv1.ValidationRules{{Rule: "self.minReplicas <= self.maxReplicas"}})
+	v1beta1 := schema(apiextensionsv1.ValidationRules{
+		{Rule: "self.minReplicas <= self.maxReplicas", Message: "minReplicas must not exceed maxReplicas"},
+		{Rule: "self.maxReplicas <= 10"},
+	})
+
+	crd := newTestCRD()
+	crd.Spec.Versions[0].Schema.OpenAPIV3Schema = v1alpha1.DeepCopy()
+	crd.Spec.Versions = append(crd.Spec.Versions, apiextensionsv1.CustomResourceDefinitionVersion{
+		Name:   "v1beta1",
+		Served: true,
+		Schema: &apiextensionsv1.CustomResourceValidation{OpenAPIV3Schema: v1beta1.DeepCopy()},
+	})
+
+	resource, err := CRDToServiceExportResource(crd)
+	require.NoError(t, err)
+	got, err := ServiceExportResourceToCRD(resource, nil)
+	require.NoError(t, err)
+	require.Len(t, got.Spec.Versions, 2)
+	require.Equal(t, v1alpha1, got.Spec.Versions[0].Schema.OpenAPIV3Schema)
+	require.Equal(t, v1beta1, got.Spec.Versions[1].Schema.OpenAPIV3Schema)
+}
+
+func TestExportSchemaStructural(t *testing.T) {
+	preserve := true
+	tests := []struct {
+		name    string
+		schema  apiextensionsv1.JSONSchemaProps
+		wantErr bool
+	}{
+		{name: "structural", schema: apiextensionsv1.JSONSchemaProps{Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{"spec": {Type: "object"}}}},
+		{name: "missing type", schema: apiextensionsv1.JSONSchemaProps{Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{"spec": {}}}, wantErr: true},
+		{name: "unknown field in default", schema: apiextensionsv1.JSONSchemaProps{Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{"spec": {Type: "object", Default: &apiextensionsv1.JSON{Raw: []byte(`{"replicas":1}`)}}}}, wantErr: true},
+		{name: "unknown field in default preserved", schema: apiextensionsv1.JSONSchemaProps{Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{"spec": {Type: "object", XPreserveUnknownFields: &preserve, Default: &apiextensionsv1.JSON{Raw: []byte(`{"replicas":1}`)}}}}},
+		{name: "default of wrong type", schema: apiextensionsv1.JSONSchemaProps{Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{"replicas": {Type: "integer", Default: &apiextensionsv1.JSON{Raw: []byte(`"one"`)}}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crd := newTestCRD()
+			crd.Spec.Versions[0].Schema.OpenAPIV3Schema = &tt.schema
+			resource, err := CRDToServiceExportResource(crd)
+			require.NoError(t, err)
+
+			_, err = ServiceExportResourceToCRD(resource, nil)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestInvalidResourceError(t *testing.T) {
+	crd := newTestCRD()
+	crd.Spec.Names.ShortNames = []string{"mdb", "mangodbs"}
+	crd.Spec.Versions = append(crd.Spec.Versions, apiextensionsv1.CustomResourceDefinitionVersion{
+		Name:   "v1beta1",
+		Served: true,
+		Schema: &apiextensionsv1.CustomResourceValidation{
+			OpenAPIV3Schema: &apiextensionsv1.JSONSchemaProps{Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{"spec": {}}},
+		},
+	})
+	resource, err := CRDToServiceExportResource(crd)
+	require.NoError(t, err)
+	resource.Spec.StorageVersion = "v2"
+
+	_, err = ServiceExportResourceToCRD(resource, nil)
+	var invalid *InvalidResourceError
+	require.ErrorAs(t, err, &invalid)
+	require.Equal(t, "mangodbs.mangodb.com", invalid.Resource)
+
+	type problem struct {
+		version, field string
+		typ            field.ErrorType
+	}
+	var got []problem
+	for _, p := range invalid.Problems {
+		got = append(got, problem{version: p.Version, field: p.Field, typ: p.Type})
+	}
+	require.Equal(t, []problem{
+		{field: "spec.names.shortNames[1]", typ: field.ErrorTypeDuplicate},
+		{field: "spec.storageVersion", typ: field.ErrorTypeNotSupported},
+		{version: "v1beta1", field: "spec.versions[1].schema.openAPIV3Schema.properties[spec].type", typ: field.ErrorTypeRequired},
+	}, got)
+	require.Contains(t, invalid.Message(), `version "v1beta1": spec.versions[1].schema.openAPIV3Schema.properties[spec].type: Required value`)
+}
+
+func TestPinVersions(t *testing.T) {
+	newResource := func() *kubebindv1alpha1.APIServiceExportResource {
+		return &kubebindv1alpha1.APIServiceExportResource{
+			Spec: kubebindv1alpha1.APIServiceExportResourceSpec{
+				StorageVersion: "v1",
+				Versions: []kubebindv1alpha1.APIServiceExportResourceVersion{
+					{Name: "v1", Served: true, Storage: true},
+					{Name: "v1beta1", Served: true},
+				},
+			},
+		}
+	}
+	names := func(resource *kubebindv1alpha1.APIServiceExportResource) []string {
+		var names []string
+		for _, v := range resource.Spec.Versions {
+			names = append(names, v.Name)
+		}
+		return names
+	}
+
+	t.Run("unpinned", func(t *testing.T) {
+		resource := newResource()
+		require.NoError(t, PinVersions(resource, nil))
+		require.Equal(t, []string{"v1", "v1beta1"}, names(resource))
+	})
+
+	t.Run("pinned to non-storage version", func(t *testing.T) {
+		resource := newResource()
+		require.NoError(t, PinVersions(resource, []string{"v1beta1"}))
+		require.Equal(t, []string{"v1beta1"}, names(resource))
+		require.Equal(t, "v1beta1", resource.Spec.StorageVersion)
+	})
+
+	t.Run("pinned to unknown version", func(t *testing.T) {
+		resource := newResource()
+		require.Error(t, PinVersions(resource, []string{"v2"}))
+	})
+}
+
+func TestServiceExportResourceToCRDPinnedVersions(t *testing.T) {
+	resource := &kubebindv1alpha1.APIServiceExportResource{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+		Spec: kubebindv1alpha1.APIServiceExportResourceSpec{
+			Group:          "mangodb.com",
+			Names:          apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb", Kind: "MangoDB", ListKind: "MangoDBList"},
+			Scope:          apiextensionsv1.NamespaceScoped,
+			StorageVersion: "v1beta1",
+			Versions: []kubebindv1alpha1.APIServiceExportResourceVersion{
+				{Name: "v1", Served: true},
+				{Name: "v1beta1", Served: true, Storage: true, Deprecated: true},
+			},
+		},
+	}
+	original := resource.DeepCopy()
+
+	got, err := ServiceExportResourceToCRD(resource, nil)
+	require.NoError(t, err)
+	require.Len(t, got.Spec.Versions, 2)
+
+	// the storage version is remapped to the pinned one.
+	got, err = ServiceExportResourceToCRD(resource, []string{"v1"})
+	require.NoError(t, err)
+	require.Equal(t, []apiextensionsv1.CustomResourceDefinitionVersion{{Name: "v1", Served: true, Storage: true, Subresources: &apiextensionsv1.CustomResourceSubresources{}}}, got.Spec.Versions)
+	require.Equal(t, original, resource, "resource must not be modified")
+
+	got, err = ServiceExportResourceToCRD(resource, []string{"v1", "v1beta1", "v2"})
+	require.NoError(t, err)
+	require.Len(t, got.Spec.Versions, 2)
+
+	_, err = ServiceExportResourceToCRD(resource, []string{"v2"})
+	var invalid *InvalidResourceError
+	require.ErrorAs(t, err, &invalid)
+	require.Equal(t, `spec.versions: Invalid value: []string{"v2"}: none of the versions v2 is exported`, invalid.Message())
+}
+
+func TestServiceExportResourceToCRDNameTooLong(t *testing.T) {
+	// each part is valid, but the joined CRD name is not.
+	group := strings.Repeat(strings.Repeat("a", 60)+".", 4) + "io"
+	require.Len(t, group, 246)
+
+	resource, err := CRDToServiceExportResource(newTestCRD())
+	require.NoError(t, err)
+	resource.Spec.ConsumerRewrite = &kubebindv1alpha1.APIServiceExportResourceRewrite{Group: group}
+
+	_, err = ServiceExportResourceToCRD(resource, nil)
+	var invalid *InvalidResourceError
+	require.ErrorAs(t, err, &invalid)
+	require.True(t, invalid.NameTooLong())
+	require.Equal(t, "metadata.name: Too long: the generated CustomResourceDefinition name has 255 characters, but must have at most 253", invalid.Message())
+
+	resource.Spec.ConsumerRewrite.Group = group[2:]
+	got, err := ServiceExportResourceToCRD(resource, nil)
+	require.NoError(t, err)
+	require.Len(t, got.Name, 253)
+}
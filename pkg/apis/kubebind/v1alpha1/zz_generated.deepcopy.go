@@ -209,6 +209,11 @@ func (in *APIServiceBindingRequestStatus) DeepCopy() *APIServiceBindingRequestSt
 func (in *APIServiceBindingSpec) DeepCopyInto(out *APIServiceBindingSpec) {
 	*out = *in
 	out.KubeconfigSecretRef = in.KubeconfigSecretRef
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]GroupResource, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -277,6 +282,16 @@ func (in *APIServiceExport) DeepCopyObject() runtime.Object {
 func (in *APIServiceExportGroupResource) DeepCopyInto(out *APIServiceExportGroupResource) {
 	*out = *in
 	out.GroupResource = in.GroupResource
+	if in.Versions != nil {
+		in, out := &in.Versions, &out.Versions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.MetadataPropagation != nil {
+		in, out := &in.MetadataPropagation, &out.MetadataPropagation
+		*out = new(MetadataPropagation)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -351,6 +366,27 @@ func (in *APIServiceExportResource) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *APIServiceExportResourceCRD) DeepCopyInto(out *APIServiceExportResourceCRD) {
+	*out = *in
+	if in.ServedVersions != nil {
+		in, out := &in.ServedVersions, &out.ServedVersions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new APIServiceExportResourceCRD.
+func (in *APIServiceExportResourceCRD) DeepCopy() *APIServiceExportResourceCRD {
+	if in == nil {
+		return nil
+	}
+	out := new(APIServiceExportResourceCRD)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *APIServiceExportResourceList) DeepCopyInto(out *APIServiceExportResourceList) {
 	*out = *in
@@ -384,6 +420,27 @@ func (in *APIServiceExportResourceList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *APIServiceExportResourceRewrite) DeepCopyInto(out *APIServiceExportResourceRewrite) {
+	*out = *in
+	if in.Names != nil {
+		in, out := &in.Names, &out.Names
+		*out = new(v1.CustomResourceDefinitionNames)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new APIServiceExportResourceRewrite.
+func (in *APIServiceExportResourceRewrite) DeepCopy() *APIServiceExportResourceRewrite {
+	if in == nil {
+		return nil
+	}
+	out := new(APIServiceExportResourceRewrite)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *APIServiceExportResourceSchema) DeepCopyInto(out *APIServiceExportResourceSchema) {
 	*out = *in
@@ -412,6 +469,21 @@ func (in *APIServiceExportResourceSpec) DeepCopyInto(out *APIServiceExportResour
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.ConsumerRewrite != nil {
+		in, out := &in.ConsumerRewrite, &out.ConsumerRewrite
+		*out = new(APIServiceExportResourceRewrite)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CRDMetadata != nil {
+		in, out := &in.CRDMetadata, &out.CRDMetadata
+		*out = new(CRDMetadata)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MetadataPropagation != nil {
+		in, out := &in.MetadataPropagation, &out.MetadataPropagation
+		*out = new(MetadataPropagation)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -469,6 +541,11 @@ func (in *APIServiceExportResourceVersion) DeepCopyInto(out *APIServiceExportRes
 		*out = make([]v1.CustomResourceColumnDefinition, len(*in))
 		copy(*out, *in)
 	}
+	if in.SelectableFields != nil {
+		in, out := &in.SelectableFields, &out.SelectableFields
+		*out = make([]SelectableField, len(*in))
+		copy(*out, *in)
+	}
 	return
 }
 
@@ -488,7 +565,9 @@ func (in *APIServiceExportSpec) DeepCopyInto(out *APIServiceExportSpec) {
 	if in.Resources != nil {
 		in, out := &in.Resources, &out.Resources
 		*out = make([]APIServiceExportGroupResource, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	return
 }
@@ -513,6 +592,13 @@ func (in *APIServiceExportStatus) DeepCopyInto(out *APIServiceExportStatus) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = make([]APIServiceExportResourceCRD, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -716,6 +802,11 @@ func (in *APIServiceProviderList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *APIServiceProviderSpec) DeepCopyInto(out *APIServiceProviderSpec) {
 	*out = *in
+	if in.AuthResponseKeys != nil {
+		in, out := &in.AuthResponseKeys, &out.AuthResponseKeys
+		*out = make([]AuthResponseKey, len(*in))
+		copy(*out, *in)
+	}
 	in.ServiceProviderSpec.DeepCopyInto(&out.ServiceProviderSpec)
 	return
 }
@@ -791,6 +882,52 @@ func (in *APIServiceStatus) DeepCopy() *APIServiceStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AuthResponseKey) DeepCopyInto(out *AuthResponseKey) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AuthResponseKey.
+func (in *AuthResponseKey) DeepCopy() *AuthResponseKey {
+	if in == nil {
+		return nil
+	}
+	out := new(AuthResponseKey)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CRDMetadata) DeepCopyInto(out *CRDMetadata) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CRDMetadata.
+func (in *CRDMetadata) DeepCopy() *CRDMetadata {
+	if in == nil {
+		return nil
+	}
+	out := new(CRDMetadata)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterBinding) DeepCopyInto(out *ClusterBinding) {
 	*out = *in
@@ -943,3 +1080,45 @@ func (in *LocalSecretKeyRef) DeepCopy() *LocalSecretKeyRef {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MetadataPropagation) DeepCopyInto(out *MetadataPropagation) {
+	*out = *in
+	if in.Include != nil {
+		in, out := &in.Include, &out.Include
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Exclude != nil {
+		in, out := &in.Exclude, &out.Exclude
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MetadataPropagation.
+func (in *MetadataPropagation) DeepCopy() *MetadataPropagation {
+	if in == nil {
+		return nil
+	}
+	out := new(MetadataPropagation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SelectableField) DeepCopyInto(out *SelectableField) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SelectableField.
+func (in *SelectableField) DeepCopy() *SelectableField {
+	if in == nil {
+		return nil
+	}
+	out := new(SelectableField)
+	in.DeepCopyInto(out)
+	return out
+}
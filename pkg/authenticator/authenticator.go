@@ -18,16 +18,31 @@ package authenticator
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 
 	"github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes/resources"
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+	kubebindhelpers "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1/helpers"
+)
+
+const (
+	// maxClaimedAuthResponseBytes bounds the auth response claimed from the backend.
+	maxClaimedAuthResponseBytes = 10 << 20
+	// claimTimeout bounds claiming the auth response from the backend.
+	claimTimeout = 30 * time.Second
 )
 
 type Authenticator interface {
@@ -40,16 +55,30 @@ type defaultAuthenticator struct {
 	port    int
 	timeout time.Duration
 	action  func(context.Context, *resources.AuthResponse) error
+
+	// publicKeys verify the signature of auth responses by key ID, if non-empty.
+	publicKeys map[string]ed25519.PublicKey
+
+	// providerURL is the URL the service provider was fetched from. Auth responses
+	// are only claimed from the same scheme and host.
+	providerURL *url.URL
+	claimClient *http.Client
 }
 
-func NewDefaultAuthenticator(timeout time.Duration, action func(context.Context, *resources.AuthResponse) error) (Authenticator, error) {
+// NewDefaultAuthenticator returns an authenticator serving the callback of the service
+// provider fetched from providerURL. If publicKeys is non-empty, auth responses must be
+// signed with one of their private keys.
+func NewDefaultAuthenticator(timeout time.Duration, providerURL *url.URL, publicKeys map[string]ed25519.PublicKey, action func(context.Context, *resources.AuthResponse) error) (Authenticator, error) {
 	if timeout == 0 {
 		timeout = 5 * time.Second
 	}
 
 	defaultAuthenticator := &defaultAuthenticator{
-		timeout: timeout,
-		action:  action,
+		timeout:     timeout,
+		action:      action,
+		publicKeys:  publicKeys,
+		providerURL: providerURL,
+		claimClient: newClaimClient(),
 	}
 
 	server := echo.New()
@@ -91,19 +120,28 @@ func (d *defaultAuthenticator) Endpoint(context.Context) string {
 
 func (d *defaultAuthenticator) actionWrapper() func(echo.Context) error {
 	return func(c echo.Context) error {
-		authData := c.QueryParam("auth_response")
-
 		fmt.Printf("Got callback\n")
 
-		decode, err := base64.StdEncoding.DecodeString(authData)
-		if err != nil {
-			c.Logger().Error(err)
-			return err
+		var decode []byte
+		if token := c.QueryParam("claim"); token != "" {
+			// the response was too large for the redirect URL and is claimed from the backend.
+			var err error
+			if decode, err = d.claimAuthResponse(c.Request().Context(), c.QueryParam("claim_url"), token); err != nil {
+				c.Logger().Error(err)
+				return err
+			}
+		} else {
+			var err error
+			if decode, err = base64.StdEncoding.DecodeString(c.QueryParam("auth_response")); err != nil {
+				c.Logger().Error(err)
+				return err
+			}
 		}
 
-		authResponse := &resources.AuthResponse{}
-		if err := json.Unmarshal(decode, authResponse); err != nil {
-			return err
+		authResponse, err := DecodeAuthResponse(d.publicKeys, decode, c.QueryParam("auth_response_signature"), c.QueryParam("auth_response_key_id"))
+		if err != nil {
+			c.Logger().Error(err)
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 		}
 
 		if err := d.action(c.Request().Context(), authResponse); err != nil {
@@ -122,3 +160,144 @@ func (d *defaultAuthenticator) actionWrapper() func(echo.Context) error {
 		return nil
 	}
 }
+
+// ParsePublicKey parses the base64 encoded PKIX Ed25519 public key advertised by the
+// service provider.
+func ParsePublicKey(encoded string) (ed25519.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth response public key: %w", err)
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth response public key: %w", err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("auth response public key is %T, must be Ed25519", key)
+	}
+	return edKey, nil
+}
+
+// ProviderPublicKeys returns the keys verifying the auth responses of the service
+// provider by key ID, preferring authResponseKeys over the single authResponsePublicKey.
+// It returns nil if the service provider does not sign its auth responses.
+func ProviderPublicKeys(spec *kubebindv1alpha1.APIServiceProviderSpec) (map[string]ed25519.PublicKey, error) {
+	if len(spec.AuthResponseKeys) > 0 {
+		keys := make(map[string]ed25519.PublicKey, len(spec.AuthResponseKeys))
+		for _, key := range spec.AuthResponseKeys {
+			pub, err := kubebindhelpers.AuthResponseKeyToEd25519(key)
+			if err != nil {
+				return nil, err
+			}
+			keys[key.KeyID] = pub
+		}
+		return keys, nil
+	}
+	if spec.AuthResponsePublicKey != "" {
+		pub, err := ParsePublicKey(spec.AuthResponsePublicKey)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]ed25519.PublicKey{kubebindhelpers.AuthResponseKeyID(pub): pub}, nil
+	}
+	return nil, nil
+}
+
+// DecodeAuthResponse verifies the signature of the auth response payload and decodes
+// it. Nothing of the payload, in particular not the kubeconfig, must be trusted before.
+// If publicKeys is empty, the service provider does not sign its responses and the
+// payload is decoded unverified.
+func DecodeAuthResponse(publicKeys map[string]ed25519.PublicKey, payload []byte, signature, keyID string) (*resources.AuthResponse, error) {
+	if len(publicKeys) > 0 {
+		if err := verifyAuthResponse(publicKeys, payload, signature, keyID); err != nil {
+			return nil, err
+		}
+	}
+
+	authResponse := &resources.AuthResponse{}
+	if err := json.Unmarshal(payload, authResponse); err != nil {
+		return nil, fmt.Errorf("invalid auth response: %w", err)
+	}
+	return authResponse, nil
+}
+
+// verifyAuthResponse checks the base64 encoded signature of the auth response payload
+// against the key with the given ID. Without key ID, as sent by service providers
+// predating key rotation, any of the keys is accepted.
+func verifyAuthResponse(publicKeys map[string]ed25519.PublicKey, payload []byte, signature, keyID string) error {
+	if signature == "" {
+		return fmt.Errorf("auth response is not signed, but the service provider signs its responses")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("invalid auth response signature: %w", err)
+	}
+	if keyID != "" {
+		publicKey, found := publicKeys[keyID]
+		if !found {
+			return fmt.Errorf("auth response is signed with unknown key %q", keyID)
+		}
+		if !ed25519.Verify(publicKey, payload, sig) {
+			return fmt.Errorf("auth response signature does not match, the response might have been tampered with")
+		}
+		return nil
+	}
+	for _, publicKey := range publicKeys {
+		if ed25519.Verify(publicKey, payload, sig) {
+			return nil
+		}
+	}
+	return fmt.Errorf("auth response signature does not match, the response might have been tampered with")
+}
+
+// claimAuthResponse exchanges the one-time claim token for the auth response at the
+// backend. The claim URL comes with the callback, which anybody can call. Hence, it
+// must be on the scheme and host of the service provider, such that the token and the
+// kubeconfig are not exchanged with anybody else.
+func (d *defaultAuthenticator) claimAuthResponse(ctx context.Context, claimURL, token string) ([]byte, error) {
+	if claimURL == "" {
+		return nil, fmt.Errorf("missing claim_url for claim token")
+	}
+	u, err := url.Parse(claimURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid claim_url: %w", err)
+	}
+	if d.providerURL == nil {
+		return nil, fmt.Errorf("cannot claim auth response without the service provider URL")
+	}
+	if u.Scheme != d.providerURL.Scheme || u.Host != d.providerURL.Host {
+		return nil, fmt.Errorf("claim_url %q is not on the service provider %s://%s", claimURL, d.providerURL.Scheme, d.providerURL.Host)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, claimURL, strings.NewReader(url.Values{"token": {token}}.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := d.claimClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim auth response: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxClaimedAuthResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read claimed auth response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to claim auth response: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// newClaimClient returns a client for claiming auth responses. It does not follow
+// redirects, which could lead away from the service provider.
+func newClaimClient() *http.Client {
+	return &http.Client{
+		Timeout: claimTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
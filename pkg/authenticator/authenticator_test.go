@@ -0,0 +1,249 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package authenticator
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kube-bind/kube-bind/contrib/example-backend/kubernetes/resources"
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+	kubebindhelpers "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1/helpers"
+)
+
+func TestActionWrapperSignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	retiredPub, retiredPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keys := map[string]ed25519.PublicKey{
+		kubebindhelpers.AuthResponseKeyID(pub):        pub,
+		kubebindhelpers.AuthResponseKeyID(retiredPub): retiredPub,
+	}
+
+	payload := []byte(`{"kind":"BindingResponse","kubeconfig":"Zm9v"}`)
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, payload))
+	retiredSignature := base64.StdEncoding.EncodeToString(ed25519.Sign(retiredPriv, payload))
+	tampered := []byte(`{"kind":"BindingResponse","kubeconfig":"YmFy"}`)
+
+	tests := []struct {
+		name       string
+		publicKeys map[string]ed25519.PublicKey
+		payload    []byte
+		signature  string
+		keyID      string
+		wantErr    bool
+	}{
+		{name: "signed", publicKeys: keys, payload: payload, signature: signature, keyID: kubebindhelpers.AuthResponseKeyID(pub)},
+		{name: "signed with retired key", publicKeys: keys, payload: payload, signature: retiredSignature, keyID: kubebindhelpers.AuthResponseKeyID(retiredPub)},
+		{name: "signed without key id", publicKeys: keys, payload: payload, signature: retiredSignature},
+		{name: "wrong key id", publicKeys: keys, payload: payload, signature: retiredSignature, keyID: kubebindhelpers.AuthResponseKeyID(pub), wantErr: true},
+		{name: "unknown key id", publicKeys: keys, payload: payload, signature: signature, keyID: "unknown", wantErr: true},
+		{name: "tampered", publicKeys: keys, payload: tampered, signature: signature, keyID: kubebindhelpers.AuthResponseKeyID(pub), wantErr: true},
+		{name: "tampered without key id", publicKeys: keys, payload: tampered, signature: signature, wantErr: true},
+		{name: "unsigned", publicKeys: keys, payload: payload, wantErr: true},
+		{name: "invalid signature", publicKeys: keys, payload: payload, signature: "not base64", wantErr: true},
+		{name: "no public keys", payload: payload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			d := &defaultAuthenticator{
+				server:     echo.New(),
+				publicKeys: tt.publicKeys,
+				action: func(ctx context.Context, response *resources.AuthResponse) error {
+					called = true
+					return nil
+				},
+			}
+
+			values := url.Values{"auth_response": {base64.StdEncoding.EncodeToString(tt.payload)}}
+			if tt.signature != "" {
+				values.Set("auth_response_signature", tt.signature)
+			}
+			if tt.keyID != "" {
+				values.Set("auth_response_key_id", tt.keyID)
+			}
+			req := httptest.NewRequest("GET", "/callback?"+values.Encode(), nil)
+			err := d.actionWrapper()(d.server.NewContext(req, httptest.NewRecorder()))
+			if tt.wantErr {
+				require.Error(t, err)
+				require.False(t, called, "the action must not see unverified responses")
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, called)
+		})
+	}
+}
+
+func TestActionWrapperClaim(t *testing.T) {
+	payload := []byte(`{"kind":"BindingResponse","kubeconfig":"Zm9v"}`)
+	var claimed, stolen int32
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&claimed, 1)
+		w.Write(payload) // nolint:errcheck
+	}))
+	defer provider.Close()
+	attacker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&stolen, 1)
+		w.Write(payload) // nolint:errcheck
+	}))
+	defer attacker.Close()
+	providerURL, err := url.Parse(provider.URL + "/export")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		claimURL string
+		wantErr  string
+	}{
+		{name: "on the provider", claimURL: provider.URL + "/claim"},
+		{name: "other host", claimURL: attacker.URL + "/claim", wantErr: "is not on the service provider"},
+		{name: "other scheme", claimURL: strings.Replace(provider.URL, "http://", "https://", 1) + "/claim", wantErr: "is not on the service provider"},
+		{name: "missing", wantErr: "missing claim_url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			d := &defaultAuthenticator{
+				server:      echo.New(),
+				providerURL: providerURL,
+				claimClient: newClaimClient(),
+				action: func(ctx context.Context, response *resources.AuthResponse) error {
+					called = true
+					return nil
+				},
+			}
+
+			values := url.Values{"claim": {"token"}}
+			if tt.claimURL != "" {
+				values.Set("claim_url", tt.claimURL)
+			}
+			req := httptest.NewRequest("GET", "/callback?"+values.Encode(), nil)
+			err := d.actionWrapper()(d.server.NewContext(req, httptest.NewRecorder()))
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				require.False(t, called)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, called)
+		})
+	}
+	require.Equal(t, int32(1), atomic.LoadInt32(&claimed))
+	require.Zero(t, atomic.LoadInt32(&stolen), "the claim token must not be sent to other hosts")
+}
+
+func TestParsePublicKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+
+	parsed, err := ParsePublicKey(base64.StdEncoding.EncodeToString(der))
+	require.NoError(t, err)
+	require.Equal(t, pub, parsed)
+
+	_, err = ParsePublicKey("not base64")
+	require.Error(t, err)
+	_, err = ParsePublicKey(base64.StdEncoding.EncodeToString([]byte("not a key")))
+	require.Error(t, err)
+}
+
+func TestProviderPublicKeys(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	retired, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+
+	keys, err := ProviderPublicKeys(&kubebindv1alpha1.APIServiceProviderSpec{})
+	require.NoError(t, err)
+	require.Empty(t, keys)
+
+	keys, err = ProviderPublicKeys(&kubebindv1alpha1.APIServiceProviderSpec{
+		AuthResponsePublicKey: base64.StdEncoding.EncodeToString(der),
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]ed25519.PublicKey{kubebindhelpers.AuthResponseKeyID(pub): pub}, keys)
+
+	keys, err = ProviderPublicKeys(&kubebindv1alpha1.APIServiceProviderSpec{
+		AuthResponsePublicKey: "ignored",
+		AuthResponseKeys: []kubebindv1alpha1.AuthResponseKey{
+			kubebindhelpers.Ed25519ToAuthResponseKey(pub),
+			kubebindhelpers.Ed25519ToAuthResponseKey(retired),
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, map[string]ed25519.PublicKey{
+		kubebindhelpers.AuthResponseKeyID(pub):     pub,
+		kubebindhelpers.AuthResponseKeyID(retired): retired,
+	}, keys)
+
+	invalid := kubebindhelpers.Ed25519ToAuthResponseKey(pub)
+	invalid.KeyID = "forged"
+	_, err = ProviderPublicKeys(&kubebindv1alpha1.APIServiceProviderSpec{
+		AuthResponseKeys: []kubebindv1alpha1.AuthResponseKey{invalid},
+	})
+	require.Error(t, err)
+}
+
+func TestDecodeAuthResponse(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keyID := kubebindhelpers.AuthResponseKeyID(pub)
+	keys := map[string]ed25519.PublicKey{keyID: pub}
+
+	payload := []byte(`{"apiVersion":"kube-bind.io/v1alpha1","kind":"BindingResponse","id":"abc","kubeconfig":"Zm9v"}`)
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, payload))
+
+	response, err := DecodeAuthResponse(keys, payload, signature, keyID)
+	require.NoError(t, err)
+	require.Equal(t, "abc", response.ID)
+	require.Equal(t, []byte("foo"), response.Kubeconfig)
+
+	// a kubeconfig pointing elsewhere must not survive verification.
+	tampered := []byte(`{"apiVersion":"kube-bind.io/v1alpha1","kind":"BindingResponse","id":"abc","kubeconfig":"ZXZpbA=="}`)
+	response, err = DecodeAuthResponse(keys, tampered, signature, keyID)
+	require.ErrorContains(t, err, "tampered with")
+	require.Nil(t, response)
+
+	_, err = DecodeAuthResponse(keys, payload, "", "")
+	require.ErrorContains(t, err, "not signed")
+
+	response, err = DecodeAuthResponse(nil, tampered, "", "")
+	require.NoError(t, err, "unsigned responses are accepted from service providers without keys")
+	require.Equal(t, []byte("evil"), response.Kubeconfig)
+
+	garbage := []byte("not json")
+	_, err = DecodeAuthResponse(keys, garbage, base64.StdEncoding.EncodeToString(ed25519.Sign(priv, garbage)), keyID)
+	require.ErrorContains(t, err, "invalid auth response")
+}
@@ -32,6 +32,8 @@ import (
 )
 
 type Config struct {
+	Options *options.CompletedOptions
+
 	ClientConfig        *rest.Config
 	BindClient          *bindclient.Clientset
 	KubeClient          *kubernetesclient.Clientset
@@ -43,7 +45,9 @@ type Config struct {
 }
 
 func NewConfig(options *options.CompletedOptions) (*Config, error) {
-	config := &Config{}
+	config := &Config{
+		Options: options,
+	}
 
 	// create clients
 	rules := clientcmd.NewDefaultClientConfigLoadingRules()
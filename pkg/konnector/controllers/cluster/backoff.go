@@ -0,0 +1,44 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// Backoff configures how requests to the provider cluster are delayed after failed
+// connects. Delays grow by Factor from Initial up to Max, and each delay is extended
+// by up to Jitter times itself to spread reconnects of many konnectors.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+	Factor  float64
+	Jitter  float64
+}
+
+// delays returns a fresh sequence of retry delays.
+func (b Backoff) delays() *wait.Backoff {
+	return &wait.Backoff{
+		Duration: b.Initial,
+		Factor:   b.Factor,
+		Jitter:   b.Jitter,
+		Steps:    int(^uint(0) >> 1),
+		Cap:      b.Max,
+	}
+}
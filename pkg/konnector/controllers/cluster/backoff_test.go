@@ -0,0 +1,54 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoffDelays(t *testing.T) {
+	b := Backoff{
+		Initial: time.Second,
+		Max:     10 * time.Second,
+		Factor:  2.0,
+		Jitter:  0.5,
+	}
+
+	delays := b.delays()
+	bases := []time.Duration{1, 2, 4, 8, 10, 10, 10}
+	jittered := false
+	for i, base := range bases {
+		base *= time.Second
+		d := delays.Step()
+		require.GreaterOrEqual(t, d, base, "attempt %d", i+1)
+		require.LessOrEqual(t, d, base+time.Duration(float64(base)*b.Jitter), "attempt %d", i+1)
+		if d != base {
+			jittered = true
+		}
+	}
+	require.True(t, jittered, "delays should be jittered")
+
+	// without jitter the delays are exact.
+	b.Jitter = 0
+	delays = b.delays()
+	for _, base := range bases {
+		require.Equal(t, base*time.Second, delays.Step())
+	}
+}
@@ -24,8 +24,6 @@ import (
 
 	crdlisters "k8s.io/apiextensions-apiserver/pkg/client/listers/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
 	kubernetesinformers "k8s.io/client-go/informers"
 	kubernetesclient "k8s.io/client-go/kubernetes"
 	corelisters "k8s.io/client-go/listers/core/v1"
@@ -59,6 +57,8 @@ func NewController(
 	consumerSecretRefKey string,
 	providerNamespace string,
 	consumerConfig, providerConfig *rest.Config,
+	reconnectBackoff Backoff,
+	forbiddenGroups []string,
 	namespaceInformer dynamic.Informer[corelisters.NamespaceLister],
 	serviceBindingInformer dynamic.Informer[bindlisters.APIServiceBindingLister],
 	crdInformer dynamic.Informer[crdlisters.CustomResourceDefinitionLister],
@@ -68,6 +68,7 @@ func NewController(
 
 	providerConfig = rest.CopyConfig(providerConfig)
 	providerConfig = rest.AddUserAgent(providerConfig, controllerName)
+	providerConfig.Wrap(newReconnectThrottle(reconnectBackoff).Wrap)
 
 	// create shared informer factories
 	providerBindClient, err := bindclient.NewForConfig(providerConfig)
@@ -128,9 +129,11 @@ func NewController(
 		providerNamespace,
 		consumerConfig,
 		providerConfig,
+		forbiddenGroups,
 		providerBindInformers.KubeBind().V1alpha1().APIServiceExports(),
 		providerBindInformers.KubeBind().V1alpha1().APIServiceExportResources(),
 		serviceBindingInformer,
+		crdInformer,
 	)
 	if err != nil {
 		return nil, err
@@ -221,37 +224,27 @@ func (c *controller) Start(ctx context.Context) {
 		factory.Start(ctx.Done())
 	}
 
-	if err := wait.PollImmediateInfiniteWithContext(ctx, heartbeatInterval, func(ctx context.Context) (bool, error) {
-		waitCtx, cancel := context.WithDeadline(ctx, time.Now().Add(heartbeatInterval/2))
-		defer cancel()
-
-		logger.V(2).Info("waiting for cache sync")
-		for _, factory := range c.factories {
-			synced := factory.WaitForCacheSync(waitCtx.Done())
-			logger.V(2).Info("cache sync", "synced", synced)
+	// the informers keep reconnecting on their own, throttled by the reconnect backoff
+	// of the provider config.
+	for attempt := 1; ; attempt++ {
+		if c.waitForCacheSync(ctx, heartbeatInterval/2) {
+			break
 		}
-		select {
-		case <-ctx.Done():
-			// timeout
-			logger.Info("informers did not sync in time", "timeout", heartbeatInterval/2)
-			c.updateServiceBindings(ctx, func(binding *kubebindv1alpha1.APIServiceBinding) {
-				conditions.MarkFalse(
-					binding,
-					kubebindv1alpha1.APIServiceBindingConditionInformersSynced,
-					"InformerSyncTimeout",
-					conditionsapi.ConditionSeverityError,
-					"Informers did not sync within %s",
-					heartbeatInterval/2,
-				)
-			})
-
-			return false, nil
-		default:
-			return true, nil
+		if ctx.Err() != nil {
+			return
 		}
-	}); err != nil {
-		runtime.HandleError(err)
-		return
+
+		logger.Info("informers did not sync in time, still reconnecting", "timeout", heartbeatInterval/2, "attempt", attempt)
+		c.updateServiceBindings(ctx, func(binding *kubebindv1alpha1.APIServiceBinding) {
+			conditions.MarkFalse(
+				binding,
+				kubebindv1alpha1.APIServiceBindingConditionInformersSynced,
+				"InformerSyncTimeout",
+				conditionsapi.ConditionSeverityError,
+				"Informers did not sync within %s, reconnecting to the provider cluster with backoff (attempt %d)",
+				heartbeatInterval/2, attempt,
+			)
+		})
 	}
 
 	logger.V(2).Info("setting InformersSynced condition to true on service binding")
@@ -268,6 +261,26 @@ func (c *controller) Start(ctx context.Context) {
 	<-ctx.Done()
 }
 
+// waitForCacheSync waits up to timeout for all informers to sync.
+func (c *controller) waitForCacheSync(ctx context.Context, timeout time.Duration) bool {
+	logger := klog.FromContext(ctx)
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	logger.V(2).Info("waiting for cache sync")
+	for _, factory := range c.factories {
+		synced := factory.WaitForCacheSync(waitCtx.Done())
+		logger.V(2).Info("cache sync", "synced", synced)
+		for _, ok := range synced {
+			if !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func (c *controller) updateServiceBindings(ctx context.Context, update func(*kubebindv1alpha1.APIServiceBinding)) {
 	logger := klog.FromContext(ctx)
 
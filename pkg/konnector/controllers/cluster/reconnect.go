@@ -0,0 +1,108 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// reconnectThrottle delays requests to a provider cluster after failed connects. Each
+// failure pushes the next request out by the next delay of the backoff, and the first
+// successful request resets it. It is shared by all clients of a cluster connection,
+// such that the informers of a down provider cluster do not hammer it when it returns.
+type reconnectThrottle struct {
+	backoff Backoff
+
+	lock      sync.Mutex
+	delays    *wait.Backoff
+	notBefore time.Time
+}
+
+func newReconnectThrottle(backoff Backoff) *reconnectThrottle {
+	return &reconnectThrottle{
+		backoff: backoff,
+		delays:  backoff.delays(),
+	}
+}
+
+// Wrap returns rt throttled, to be used as rest.Config.WrapTransport.
+func (t *reconnectThrottle) Wrap(rt http.RoundTripper) http.RoundTripper {
+	return &throttledRoundTripper{throttle: t, delegate: rt}
+}
+
+// wait blocks until the next request may be sent, or the request is done.
+func (t *reconnectThrottle) wait(req *http.Request) error {
+	t.lock.Lock()
+	delay := time.Until(t.notBefore)
+	t.lock.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+		return req.Context().Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// observe records the outcome of a request.
+func (t *reconnectThrottle) observe(req *http.Request, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if err == nil {
+		t.delays = t.backoff.delays()
+		t.notBefore = time.Time{}
+		return
+	}
+	if req.Context().Err() != nil {
+		// given up by the caller, not failed to connect.
+		return
+	}
+	if time.Now().Before(t.notBefore) {
+		// another request failed concurrently, and the delay is already pending.
+		return
+	}
+	t.notBefore = time.Now().Add(t.delays.Step())
+}
+
+type throttledRoundTripper struct {
+	throttle *reconnectThrottle
+	delegate http.RoundTripper
+}
+
+func (rt *throttledRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := rt.throttle.wait(req); err != nil {
+		return nil, err
+	}
+	resp, err := rt.delegate.RoundTrip(req)
+	rt.throttle.observe(req, err)
+	return resp, err
+}
+
+// WrappedRoundTripper returns the delegate, for client-go to unwrap transports.
+func (rt *throttledRoundTripper) WrappedRoundTripper() http.RoundTripper {
+	return rt.delegate
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestReconnectThrottle(t *testing.T) {
+	delay := 50 * time.Millisecond
+	throttle := newReconnectThrottle(Backoff{Initial: delay, Max: delay, Factor: 1.0})
+
+	var lock sync.Mutex
+	var fail bool
+	var sent []time.Time
+	rt := throttle.Wrap(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		sent = append(sent, time.Now())
+		if fail {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{StatusCode: http.StatusOK}, nil
+	}))
+	do := func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://provider.example.com", nil)
+		require.NoError(t, err)
+		_, err = rt.RoundTrip(req)
+		return err
+	}
+	ctx := context.Background()
+
+	// requests are not delayed while connecting works.
+	require.NoError(t, do(ctx))
+	require.NoError(t, do(ctx))
+	require.Less(t, sent[1].Sub(sent[0]), delay)
+
+	// a failed connect delays the next request.
+	fail = true
+	require.Error(t, do(ctx))
+	fail = false
+	require.NoError(t, do(ctx))
+	require.GreaterOrEqual(t, sent[3].Sub(sent[2]), delay)
+
+	// a successful request resets the delay.
+	require.NoError(t, do(ctx))
+	require.Less(t, sent[4].Sub(sent[3]), delay)
+
+	// waiting requests can be cancelled.
+	fail = true
+	require.Error(t, do(ctx))
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	require.ErrorIs(t, do(cancelled), context.Canceled)
+	require.Len(t, sent, 6, "the cancelled request must not be sent")
+}
+
+func TestReconnectThrottleBacksOff(t *testing.T) {
+	throttle := newReconnectThrottle(Backoff{Initial: time.Second, Max: 4 * time.Second, Factor: 2.0})
+	req, err := http.NewRequest(http.MethodGet, "https://provider.example.com", nil)
+	require.NoError(t, err)
+
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		// pretend the previous delay has passed.
+		throttle.notBefore = time.Time{}
+		throttle.observe(req, errors.New("connection refused"))
+		require.InDelta(t, expected, time.Until(throttle.notBefore), float64(100*time.Millisecond))
+	}
+
+	// concurrent failures within the delay do not grow it further.
+	notBefore := throttle.notBefore
+	throttle.observe(req, errors.New("connection refused"))
+	require.Equal(t, notBefore, throttle.notBefore)
+
+	throttle.observe(req, nil)
+	require.True(t, throttle.notBefore.IsZero())
+	throttle.observe(req, errors.New("connection refused"))
+	require.InDelta(t, time.Second, time.Until(throttle.notBefore), float64(100*time.Millisecond))
+}
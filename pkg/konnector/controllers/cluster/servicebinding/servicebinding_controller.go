@@ -18,6 +18,7 @@ package servicebinding
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -26,25 +27,37 @@ import (
 	apiextensionslisters "k8s.io/apiextensions-apiserver/pkg/client/listers/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/version"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	dynamicclient "k8s.io/client-go/dynamic"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
+	"k8s.io/utils/pointer"
 
 	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+	kubebindhelpers "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1/helpers"
 	bindclient "github.com/kube-bind/kube-bind/pkg/client/clientset/versioned"
 	bindinformers "github.com/kube-bind/kube-bind/pkg/client/informers/externalversions/kubebind/v1alpha1"
 	bindlisters "github.com/kube-bind/kube-bind/pkg/client/listers/kubebind/v1alpha1"
 	"github.com/kube-bind/kube-bind/pkg/committer"
 	"github.com/kube-bind/kube-bind/pkg/indexers"
+	"github.com/kube-bind/kube-bind/pkg/konnector/controllers/crdcleanup"
 	"github.com/kube-bind/kube-bind/pkg/konnector/controllers/dynamic"
 )
 
 const (
 	controllerName = "kube-bind-konnector-cluster-servicebinding"
+
+	// applyManager is the field manager of the bound CRDs. Fields of other managers,
+	// e.g. annotations or labels added by other controllers, are not touched.
+	applyManager = "kube-bind.io/konnector"
 )
 
 // NewController returns a new controller for ServiceBindings.
@@ -74,6 +87,14 @@ func NewController(
 	if err != nil {
 		return nil, err
 	}
+	consumerDiscoveryClient, err := discovery.NewDiscoveryClientForConfig(consumerConfig)
+	if err != nil {
+		return nil, err
+	}
+	consumerDynamicClient, err := dynamicclient.NewForConfig(consumerConfig)
+	if err != nil {
+		return nil, err
+	}
 	providerBindClient, err := bindclient.NewForConfig(providerConfig)
 	if err != nil {
 		return nil, err
@@ -114,8 +135,46 @@ func NewController(
 			updateCRD: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) (*apiextensionsv1.CustomResourceDefinition, error) {
 				return apiextensionsClient.ApiextensionsV1().CustomResourceDefinitions().Update(ctx, crd, metav1.UpdateOptions{})
 			},
-			createCRD: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) (*apiextensionsv1.CustomResourceDefinition, error) {
-				return apiextensionsClient.ApiextensionsV1().CustomResourceDefinitions().Create(ctx, crd, metav1.CreateOptions{})
+			applyCRD: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition, selectableFields map[string][]kubebindv1alpha1.SelectableField) (*apiextensionsv1.CustomResourceDefinition, error) {
+				return applyCRD(ctx, apiextensionsClient, crd, selectableFields)
+			},
+			getConsumerVersion: newVersionCache(consumerVersionTTL, func() (*version.Version, error) {
+				info, err := consumerDiscoveryClient.ServerVersion()
+				if err != nil {
+					return nil, err
+				}
+				v, err := version.ParseGeneric(info.GitVersion)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse consumer cluster version %q: %w", info.GitVersion, err)
+				}
+				return v, nil
+			}).Get,
+			listBindingCRDs: func(bindingName string) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+				return crdcleanup.ListByServiceBinding(crdInformer.Informer().GetIndexer(), bindingName)
+			},
+			deleteCRD: func(ctx context.Context, name string) error {
+				return apiextensionsClient.ApiextensionsV1().CustomResourceDefinitions().Delete(ctx, name, metav1.DeleteOptions{})
+			},
+			hasObjects: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) (bool, error) {
+				if len(crd.Status.StoredVersions) == 0 {
+					return false, nil // nothing was ever stored
+				}
+				var version string
+				for _, v := range crd.Spec.Versions {
+					if v.Served {
+						version = v.Name
+						break
+					}
+				}
+				if version == "" {
+					return true, nil // be conservative, we cannot look
+				}
+				gvr := schema.GroupVersionResource{Group: crd.Spec.Group, Version: version, Resource: crd.Spec.Names.Plural}
+				list, err := consumerDynamicClient.Resource(gvr).List(ctx, metav1.ListOptions{Limit: 1})
+				if err != nil {
+					return false, err
+				}
+				return len(list.Items) > 0, nil
 			},
 		},
 
@@ -331,3 +390,23 @@ func (c *controller) process(ctx context.Context, key string) error {
 
 	return utilerrors.NewAggregate(errs)
 }
+
+// applyCRD server-side applies the fields set in the given CRD and the selectable
+// fields by version, taking them over from other field managers.
+func applyCRD(ctx context.Context, client apiextensionsclient.Interface, crd *apiextensionsv1.CustomResourceDefinition, selectableFields map[string][]kubebindv1alpha1.SelectableField) (*apiextensionsv1.CustomResourceDefinition, error) {
+	crd = crd.DeepCopy()
+	crd.TypeMeta = metav1.TypeMeta{
+		APIVersion: apiextensionsv1.SchemeGroupVersion.String(),
+		Kind:       "CustomResourceDefinition",
+	}
+	data, err := json.Marshal(crd)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = kubebindhelpers.WithSelectableFields(data, selectableFields); err != nil {
+		return nil, err
+	}
+	return client.ApiextensionsV1().CustomResourceDefinitions().Patch(ctx, crd.Name, types.ApplyPatchType, data,
+		metav1.PatchOptions{FieldManager: applyManager, Force: pointer.Bool(true)},
+	)
+}
@@ -18,6 +18,7 @@ package servicebinding
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
@@ -26,12 +27,15 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/version"
 	"k8s.io/utils/pointer"
 
 	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
 	kubebindhelpers "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1/helpers"
 	conditionsapi "github.com/kube-bind/kube-bind/pkg/apis/third_party/conditions/apis/conditions/v1alpha1"
 	"github.com/kube-bind/kube-bind/pkg/apis/third_party/conditions/util/conditions"
+	"github.com/kube-bind/kube-bind/pkg/konnector/controllers/crdcleanup"
 )
 
 type reconciler struct {
@@ -45,10 +49,23 @@ type reconciler struct {
 
 	getCRD    func(name string) (*apiextensionsv1.CustomResourceDefinition, error)
 	updateCRD func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) (*apiextensionsv1.CustomResourceDefinition, error)
-	createCRD func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) (*apiextensionsv1.CustomResourceDefinition, error)
+	// applyCRD creates or updates the CRD with server-side apply, with the given
+	// selectable fields by version, see kubebindhelpers.WithSelectableFields.
+	applyCRD func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition, selectableFields map[string][]kubebindv1alpha1.SelectableField) (*apiextensionsv1.CustomResourceDefinition, error)
+
+	getConsumerVersion func() (*version.Version, error)
+
+	listBindingCRDs func(bindingName string) ([]*apiextensionsv1.CustomResourceDefinition, error)
+	deleteCRD       func(ctx context.Context, name string) error
+	hasObjects      func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) (bool, error)
 }
 
 func (r *reconciler) reconcile(ctx context.Context, binding *kubebindv1alpha1.APIServiceBinding) error {
+	// the CRDs of a deleted binding are cleaned up by the consumer-side servicebinding controller.
+	if binding.DeletionTimestamp != nil {
+		return nil
+	}
+
 	var errs []error
 
 	if err := r.ensureValidServiceExport(ctx, binding); err != nil {
@@ -97,11 +114,40 @@ func (r *reconciler) ensureCRDs(ctx context.Context, binding *kubebindv1alpha1.A
 		return nil // nothing we can do here
 	}
 
+	consumerVersion, err := r.getConsumerVersion()
+	if err != nil {
+		errs = append(errs, err)
+	}
+
 	resourceValid := true
 	schemaInSync := true
+	var unsupported []string
+	var shadowing []string
+	// the consumer CRD names differ from the exported names if the resource is rewritten.
+	consumerNames := sets.NewString()
+	resolved := 0
+
+	// the binding can select a subset of the exported resources.
+	selected, notExported := kubebindhelpers.SelectedResources(binding, export.Spec.Resources)
+	if len(notExported) > 0 {
+		names := make([]string, 0, len(notExported))
+		for _, gr := range notExported {
+			names = append(names, gr.Resource+"."+gr.Group)
+		}
+		conditions.MarkFalse(
+			binding,
+			kubebindv1alpha1.APIServiceBindingConditionResourcesValid,
+			"SelectedResourceNotExported",
+			conditionsapi.ConditionSeverityError,
+			"APIServiceExport %s does not offer the selected resources: %s",
+			export.Name, strings.Join(names, ", "),
+		)
+		resourceValid = false
+	}
 nextResource:
-	for _, resource := range export.Spec.Resources {
+	for _, resource := range selected {
 		name := resource.Resource + "." + resource.Group
+		versions := resource.Versions
 		resource, err := r.getServiceExportResource(name)
 		if err != nil && !errors.IsNotFound(err) {
 			errs = append(errs, err)
@@ -132,20 +178,56 @@ nextResource:
 			continue
 		}
 
-		crd, err := kubebindhelpers.ServiceExportResourceToCRD(resource)
+		// the group suffix keeps the CRDs of different service providers apart.
+		crd, err := kubebindhelpers.ServiceExportResourceToCRD(kubebindhelpers.WithConsumerGroupSuffix(resource, binding.Spec.ConsumerGroupSuffix), versions)
 		if err != nil {
+			msg := err.Error()
+			if invalid, ok := err.(*kubebindhelpers.InvalidResourceError); ok {
+				msg = invalid.Message()
+			}
 			conditions.MarkFalse(
 				binding,
 				kubebindv1alpha1.APIServiceBindingConditionResourcesValid,
 				"ServiceExportResourceInvalid",
 				conditionsapi.ConditionSeverityError,
 				"APIServiceExportResource %s on the service provider cluster is invalid: %s",
-				name, err,
+				name, msg,
 			)
 			resourceValid = false
 			continue
 		}
 
+		// the consumer name is known from here on, even if the resource is rejected as duplicate.
+		resolved++
+		if consumerNames.Has(crd.Name) {
+			conditions.MarkFalse(
+				binding,
+				kubebindv1alpha1.APIServiceBindingConditionResourcesValid,
+				"DuplicateConsumerResource",
+				conditionsapi.ConditionSeverityError,
+				"APIServiceExportResource %s maps to CustomResourceDefinition %s on the consumer cluster, which another resource of the binding does already.",
+				name, crd.Name,
+			)
+			resourceValid = false
+			continue
+		}
+		consumerNames.Insert(crd.Name)
+
+		// older consumer clusters drop what they do not know, e.g. CEL validation rules. Apply anyway, but warn.
+		if consumerVersion != nil {
+			features, err := kubebindhelpers.UnsupportedFeatures(resource, consumerVersion)
+			if err != nil {
+				errs = append(errs, err)
+			} else if len(features) > 0 {
+				unsupported = append(unsupported, fmt.Sprintf("%s uses %s", name, strings.Join(features, ", ")))
+			}
+		}
+
+		// installed anyway, the CRD is still reachable by its fully qualified name.
+		if shadowed := kubebindhelpers.ShadowedBuiltInResources(crd.Spec.Names); len(shadowed) > 0 {
+			shadowing = append(shadowing, fmt.Sprintf("%s shadows %s", crd.Name, strings.Join(shadowed, ", ")))
+		}
+
 		// put binding owner reference on the CRD.
 		newReference := metav1.OwnerReference{
 			APIVersion: kubebindv1alpha1.SchemeGroupVersion.String(),
@@ -157,28 +239,12 @@ nextResource:
 		crd.OwnerReferences = append(crd.OwnerReferences, newReference)
 
 		existing, err := r.getCRD(crd.Name)
-		var result *apiextensionsv1.CustomResourceDefinition
 		if err != nil && !errors.IsNotFound(err) {
 			errs = append(errs, err)
 			continue
-		} else if errors.IsNotFound(err) {
-			result, err = r.createCRD(ctx, crd)
-			if err != nil && !errors.IsInvalid(err) {
-				errs = append(errs, err)
-				continue
-			} else if errors.IsInvalid(err) {
-				conditions.MarkFalse(
-					binding,
-					kubebindv1alpha1.APIServiceExportConditionSchemaInSync,
-					"CustomResourceDefinitionCreateFailed",
-					conditionsapi.ConditionSeverityError,
-					"CustomResourceDefinition %s cannot be created: %s",
-					name, err,
-				)
-				schemaInSync = false
-				continue
-			}
-		} else {
+		}
+		create := errors.IsNotFound(err)
+		if !create {
 			// first check this really ours and we don't override something else
 			foundOther := false
 			foundThis := false
@@ -186,8 +252,7 @@ nextResource:
 			for _, ref := range existing.OwnerReferences {
 				parts := strings.SplitN(ref.APIVersion, "/", 2)
 				if parts[0] != kubebindv1alpha1.SchemeGroupVersion.Group || ref.Kind != "APIServiceBinding" {
-					newOwners = append(newOwners, ref)
-					continue
+					continue // owned by others and kept by server-side apply
 				}
 
 				if ref.Name == binding.Name {
@@ -238,27 +303,32 @@ nextResource:
 			}
 
 			// add ourselves as owner if we are not there
-			crd.ObjectMeta = existing.ObjectMeta
 			if !foundThis {
 				newOwners = append(newOwners, newReference)
 			}
-			crd.ObjectMeta.OwnerReferences = newOwners
-			result, err = r.updateCRD(ctx, crd)
-			if err != nil {
-				errs = append(errs, err)
-				continue
-			} else if errors.IsInvalid(err) {
-				conditions.MarkFalse(
-					binding,
-					kubebindv1alpha1.APIServiceExportConditionSchemaInSync,
-					"CustomResourceDefinitionUpdateFailed",
-					conditionsapi.ConditionSeverityError,
-					"CustomResourceDefinition %s cannot be updated: %s",
-					name, err,
-				)
-				schemaInSync = false
-				continue
+			crd.OwnerReferences = newOwners
+		}
+
+		// only the fields set here are applied, fields of other managers are left alone.
+		result, err := r.applyCRD(ctx, crd, kubebindhelpers.ConsumerSelectableFields(resource, consumerVersion))
+		if err != nil && !errors.IsInvalid(err) {
+			errs = append(errs, err)
+			continue
+		} else if errors.IsInvalid(err) {
+			reason, verb := "CustomResourceDefinitionUpdateFailed", "updated"
+			if create {
+				reason, verb = "CustomResourceDefinitionCreateFailed", "created"
 			}
+			conditions.MarkFalse(
+				binding,
+				kubebindv1alpha1.APIServiceExportConditionSchemaInSync,
+				reason,
+				conditionsapi.ConditionSeverityError,
+				"CustomResourceDefinition %s cannot be %s: %s",
+				name, verb, err,
+			)
+			schemaInSync = false
+			continue
 		}
 
 		// copy the CRD status onto the APIServiceExportResource
@@ -290,6 +360,13 @@ nextResource:
 		}
 	}
 
+	// without the resources, the rewritten names of their CRDs are unknown and cleanup might hit them.
+	if resolved == len(selected) {
+		if err := r.ensureRemovedCRDsCleanedUp(ctx, binding, consumerNames); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
 	if resourceValid {
 		conditions.MarkTrue(
 			binding,
@@ -304,5 +381,53 @@ nextResource:
 		)
 	}
 
+	if consumerVersion != nil {
+		if len(unsupported) > 0 {
+			conditions.MarkFalse(
+				binding,
+				kubebindv1alpha1.APIServiceBindingConditionConsumerVersionSupported,
+				"UnsupportedByConsumerVersion",
+				conditionsapi.ConditionSeverityWarning,
+				"The consumer cluster of version %s cannot serve all resources: %s",
+				consumerVersion, strings.Join(unsupported, "; "),
+			)
+		} else {
+			conditions.MarkTrue(binding, kubebindv1alpha1.APIServiceBindingConditionConsumerVersionSupported)
+		}
+	}
+
+	if len(shadowing) > 0 {
+		conditions.MarkFalse(
+			binding,
+			kubebindv1alpha1.APIServiceBindingConditionBuiltInResourcesNotShadowed,
+			"ShadowsBuiltInResources",
+			conditionsapi.ConditionSeverityWarning,
+			"Names of resources collide with built-in resources of the consumer cluster, which kubectl resolves instead: %s",
+			strings.Join(shadowing, "; "),
+		)
+	} else {
+		conditions.MarkTrue(binding, kubebindv1alpha1.APIServiceBindingConditionBuiltInResourcesNotShadowed)
+	}
+
 	return utilerrors.NewAggregate(errs)
 }
+
+// ensureRemovedCRDsCleanedUp deletes or orphans, according to the binding policy, the
+// CRDs of the binding that are not among the exported CRD names anymore. CRDs that
+// still have objects or are shared with other bindings are only orphaned.
+func (r *reconciler) ensureRemovedCRDsCleanedUp(ctx context.Context, binding *kubebindv1alpha1.APIServiceBinding, exported sets.String) error {
+
+	crds, err := r.listBindingCRDs(binding.Name)
+	if err != nil {
+		return err
+	}
+	var removed []*apiextensionsv1.CustomResourceDefinition
+	for _, crd := range crds {
+		if !exported.Has(crd.Name) {
+			removed = append(removed, crd)
+		}
+	}
+
+	client := crdcleanup.Client{UpdateCRD: r.updateCRD, DeleteCRD: r.deleteCRD, HasObjects: r.hasObjects}
+	return crdcleanup.CleanUp(ctx, client, binding, removed)
+}
@@ -0,0 +1,763 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package servicebinding
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/rest"
+	"k8s.io/utils/pointer"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+	kubebindhelpers "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1/helpers"
+	conditionsapi "github.com/kube-bind/kube-bind/pkg/apis/third_party/conditions/apis/conditions/v1alpha1"
+	"github.com/kube-bind/kube-bind/pkg/apis/third_party/conditions/util/conditions"
+)
+
+func TestEnsureCRDsConsumerVersion(t *testing.T) {
+	schema := `{"type":"object","properties":{"spec":{"type":"object","x-kubernetes-validations":[{"rule":"self.minReplicas <= self.maxReplicas"}],"properties":{"minReplicas":{"type":"integer"},"maxReplicas":{"type":"integer"}}}}}`
+
+	tests := []struct {
+		name             string
+		consumerVersion  string
+		selectableFields []kubebindv1alpha1.SelectableField
+		wantStatus       corev1.ConditionStatus
+		wantMessage      string
+		wantSelectable   bool
+	}{
+		{name: "supported", consumerVersion: "v1.25.3", wantStatus: corev1.ConditionTrue},
+		{name: "vendor suffix", consumerVersion: "v1.26.1+k3s1", wantStatus: corev1.ConditionTrue},
+		{name: "unsupported", consumerVersion: "v1.24.7", wantStatus: corev1.ConditionFalse, wantMessage: "x-kubernetes-validations (requires 1.25)"},
+		{name: "selectable fields unsupported", consumerVersion: "v1.29.4", selectableFields: []kubebindv1alpha1.SelectableField{{JSONPath: ".spec.minReplicas"}}, wantStatus: corev1.ConditionFalse, wantMessage: "selectableFields (requires 1.30)"},
+		{name: "selectable fields supported", consumerVersion: "v1.30.0", selectableFields: []kubebindv1alpha1.SelectableField{{JSONPath: ".spec.minReplicas"}}, wantStatus: corev1.ConditionTrue, wantSelectable: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			export := &kubebindv1alpha1.APIServiceExport{
+				ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com", Namespace: "cluster-abc"},
+				Spec: kubebindv1alpha1.APIServiceExportSpec{
+					Resources: []kubebindv1alpha1.APIServiceExportGroupResource{
+						{GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: "mangodbs"}},
+					},
+				},
+			}
+			resource := &kubebindv1alpha1.APIServiceExportResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com", Namespace: "cluster-abc"},
+				Spec: kubebindv1alpha1.APIServiceExportResourceSpec{
+					Group: "mangodb.com",
+					Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb", Kind: "MangoDB", ListKind: "MangoDBList"},
+					Scope: apiextensionsv1.NamespaceScoped,
+					Versions: []kubebindv1alpha1.APIServiceExportResourceVersion{
+						{
+							Name:    "v1alpha1",
+							Served:  true,
+							Storage: true,
+							Schema: kubebindv1alpha1.APIServiceExportResourceSchema{
+								OpenAPIV3Schema: runtime.RawExtension{Raw: []byte(schema)},
+							},
+							SelectableFields: tt.selectableFields,
+						},
+					},
+				},
+			}
+
+			var created *apiextensionsv1.CustomResourceDefinition
+			var applied map[string][]kubebindv1alpha1.SelectableField
+			r := &reconciler{
+				getServiceExport: func(name string) (*kubebindv1alpha1.APIServiceExport, error) {
+					return export, nil
+				},
+				getServiceExportResource: func(name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					require.Equal(t, resource.Name, name)
+					return resource, nil
+				},
+				updateServiceExportResourceStatus: func(ctx context.Context, resource *kubebindv1alpha1.APIServiceExportResource) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					return resource, nil
+				},
+				getCRD: func(name string) (*apiextensionsv1.CustomResourceDefinition, error) {
+					return nil, errors.NewNotFound(apiextensionsv1.Resource("customresourcedefinitions"), name)
+				},
+				applyCRD: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition, selectableFields map[string][]kubebindv1alpha1.SelectableField) (*apiextensionsv1.CustomResourceDefinition, error) {
+					created, applied = crd, selectableFields
+					return crd, nil
+				},
+				getConsumerVersion: func() (*version.Version, error) {
+					return version.ParseGeneric(tt.consumerVersion)
+				},
+				listBindingCRDs: func(bindingName string) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+					return nil, nil
+				},
+			}
+
+			binding := &kubebindv1alpha1.APIServiceBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+				Spec:       kubebindv1alpha1.APIServiceBindingSpec{Export: export.Name},
+			}
+			require.NoError(t, r.ensureCRDs(context.Background(), binding))
+
+			// the CRD is applied either way, including its validation rules.
+			require.NotNil(t, created)
+			rules := created.Spec.Versions[0].Schema.OpenAPIV3Schema.Properties["spec"].XValidations
+			require.Equal(t, apiextensionsv1.ValidationRules{{Rule: "self.minReplicas <= self.maxReplicas"}}, rules)
+			if tt.wantSelectable {
+				require.Equal(t, map[string][]kubebindv1alpha1.SelectableField{"v1alpha1": tt.selectableFields}, applied)
+			} else {
+				require.Nil(t, applied, "selectable fields are only applied on consumers supporting them")
+			}
+
+			cond := conditions.Get(binding, kubebindv1alpha1.APIServiceBindingConditionConsumerVersionSupported)
+			require.NotNil(t, cond)
+			require.Equal(t, tt.wantStatus, cond.Status)
+			if tt.wantStatus == corev1.ConditionFalse {
+				require.Equal(t, "UnsupportedByConsumerVersion", cond.Reason)
+				require.Equal(t, conditionsapi.ConditionSeverityWarning, cond.Severity)
+				require.Contains(t, cond.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestEnsureCRDsApply(t *testing.T) {
+	export := &kubebindv1alpha1.APIServiceExport{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com", Namespace: "cluster-abc"},
+		Spec: kubebindv1alpha1.APIServiceExportSpec{
+			Resources: []kubebindv1alpha1.APIServiceExportGroupResource{
+				{GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: "mangodbs"}},
+			},
+		},
+	}
+	resource := &kubebindv1alpha1.APIServiceExportResource{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com", Namespace: "cluster-abc"},
+		Spec: kubebindv1alpha1.APIServiceExportResourceSpec{
+			Group: "mangodb.com",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb", Kind: "MangoDB", ListKind: "MangoDBList"},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []kubebindv1alpha1.APIServiceExportResourceVersion{
+				{
+					Name:    "v1alpha1",
+					Served:  true,
+					Storage: true,
+					Schema: kubebindv1alpha1.APIServiceExportResourceSchema{
+						OpenAPIV3Schema: runtime.RawExtension{Raw: []byte(`{"type":"object"}`)},
+					},
+				},
+			},
+		},
+	}
+	binding := &kubebindv1alpha1.APIServiceBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com", UID: "binding-uid"},
+		Spec:       kubebindv1alpha1.APIServiceBindingSpec{Export: export.Name},
+	}
+	ownRef := metav1.OwnerReference{APIVersion: kubebindv1alpha1.SchemeGroupVersion.String(), Kind: "APIServiceBinding", Name: binding.Name, UID: binding.UID, Controller: pointer.Bool(true)}
+	foreignRef := metav1.OwnerReference{APIVersion: "example.com/v1", Kind: "Addon", Name: "mangodb", UID: "addon-uid"}
+
+	// the CRD carries fields of other controllers.
+	existing := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "mangodbs.mangodb.com",
+			ResourceVersion: "42",
+			Labels:          map[string]string{"example.com/managed": "true"},
+			Annotations:     map[string]string{"example.com/note": "keep me"},
+			OwnerReferences: []metav1.OwnerReference{foreignRef, ownRef},
+		},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Conversion: &apiextensionsv1.CustomResourceConversion{Strategy: apiextensionsv1.NoneConverter},
+		},
+	}
+
+	var applied []*apiextensionsv1.CustomResourceDefinition
+	r := &reconciler{
+		getServiceExport: func(name string) (*kubebindv1alpha1.APIServiceExport, error) {
+			return export, nil
+		},
+		getServiceExportResource: func(name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+			return resource, nil
+		},
+		updateServiceExportResourceStatus: func(ctx context.Context, resource *kubebindv1alpha1.APIServiceExportResource) (*kubebindv1alpha1.APIServiceExportResource, error) {
+			return resource, nil
+		},
+		getCRD: func(name string) (*apiextensionsv1.CustomResourceDefinition, error) {
+			return existing, nil
+		},
+		updateCRD: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) (*apiextensionsv1.CustomResourceDefinition, error) {
+			t.Fatalf("unexpected update of CRD %s", crd.Name)
+			return nil, nil
+		},
+		applyCRD: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition, selectableFields map[string][]kubebindv1alpha1.SelectableField) (*apiextensionsv1.CustomResourceDefinition, error) {
+			applied = append(applied, crd)
+			return crd, nil
+		},
+		getConsumerVersion: func() (*version.Version, error) {
+			return version.MustParseGeneric("1.25"), nil
+		},
+		listBindingCRDs: func(bindingName string) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+			return nil, nil
+		},
+	}
+	require.NoError(t, r.ensureCRDs(context.Background(), binding))
+
+	// only the fields kube-bind manages are applied, such that the others are left alone.
+	require.Len(t, applied, 1)
+	require.Equal(t, "mangodbs.mangodb.com", applied[0].Name)
+	require.Empty(t, applied[0].ResourceVersion)
+	require.Empty(t, applied[0].Labels)
+	require.Empty(t, applied[0].Annotations)
+	require.Nil(t, applied[0].Spec.Conversion)
+	require.Equal(t, []metav1.OwnerReference{ownRef}, applied[0].OwnerReferences)
+	require.Equal(t, "mangodb.com", applied[0].Spec.Group)
+	require.Len(t, existing.OwnerReferences, 2, "informer objects must not be mutated")
+}
+
+func TestApplyCRD(t *testing.T) {
+	var request *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		var err error
+		body, err = io.ReadAll(r.Body)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+
+	client, err := apiextensionsclient.NewForConfig(&rest.Config{Host: server.URL})
+	require.NoError(t, err)
+
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Group:    "mangodb.com",
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{{Name: "v1", Served: true, Storage: true}},
+		},
+	}
+	result, err := applyCRD(context.Background(), client, crd, map[string][]kubebindv1alpha1.SelectableField{"v1": {{JSONPath: ".spec.tier"}}})
+	require.NoError(t, err)
+	require.Equal(t, "mangodb.com", result.Spec.Group)
+
+	require.Equal(t, http.MethodPatch, request.Method)
+	require.Equal(t, "/apis/apiextensions.k8s.io/v1/customresourcedefinitions/mangodbs.mangodb.com", request.URL.Path)
+	require.Equal(t, string(types.ApplyPatchType), request.Header.Get("Content-Type"))
+	require.Equal(t, applyManager, request.URL.Query().Get("fieldManager"))
+	require.Equal(t, "true", request.URL.Query().Get("force"))
+
+	var sent map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &sent))
+	require.Equal(t, "apiextensions.k8s.io/v1", sent["apiVersion"])
+	require.Equal(t, "CustomResourceDefinition", sent["kind"])
+	versions, _, err := unstructured.NestedSlice(sent, "spec", "versions")
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{map[string]interface{}{"jsonPath": ".spec.tier"}}, versions[0].(map[string]interface{})["selectableFields"])
+	require.Empty(t, crd.Kind, "the given CRD must not be mutated")
+}
+
+func TestEnsureCRDsRemovedResource(t *testing.T) {
+	owner := func(name string) metav1.OwnerReference {
+		return metav1.OwnerReference{APIVersion: kubebindv1alpha1.SchemeGroupVersion.String(), Kind: "APIServiceBinding", Name: name}
+	}
+
+	tests := []struct {
+		name       string
+		policy     kubebindv1alpha1.CRDDeletionPolicy
+		owners     []metav1.OwnerReference
+		inUse      bool
+		unresolved bool
+		wantDelete bool
+		wantOwners []metav1.OwnerReference
+	}{
+		{name: "deleted", owners: []metav1.OwnerReference{owner("binding")}, wantDelete: true},
+		{name: "in use", owners: []metav1.OwnerReference{owner("binding")}, inUse: true, wantOwners: []metav1.OwnerReference{}},
+		{name: "orphaned", policy: kubebindv1alpha1.CRDDeletionPolicyOrphan, owners: []metav1.OwnerReference{owner("binding")}, wantOwners: []metav1.OwnerReference{}},
+		{name: "shared", owners: []metav1.OwnerReference{owner("binding"), owner("other")}, wantOwners: []metav1.OwnerReference{owner("other")}},
+		{name: "unresolved export resource", owners: []metav1.OwnerReference{owner("binding")}, unresolved: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the export used to contain caches.redis.io too.
+			export := &kubebindv1alpha1.APIServiceExport{
+				ObjectMeta: metav1.ObjectMeta{Name: "export", Namespace: "cluster-abc"},
+				Spec: kubebindv1alpha1.APIServiceExportSpec{
+					Resources: []kubebindv1alpha1.APIServiceExportGroupResource{
+						{GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: "mangodbs"}},
+					},
+				},
+			}
+			exported := &apiextensionsv1.CustomResourceDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com", OwnerReferences: []metav1.OwnerReference{owner("binding")}},
+			}
+			resource := &kubebindv1alpha1.APIServiceExportResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com", Namespace: "cluster-abc"},
+				Spec: kubebindv1alpha1.APIServiceExportResourceSpec{
+					Group: "mangodb.com",
+					Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb", Kind: "MangoDB", ListKind: "MangoDBList"},
+					Scope: apiextensionsv1.NamespaceScoped,
+					Versions: []kubebindv1alpha1.APIServiceExportResourceVersion{
+						{Name: "v1alpha1", Served: true, Storage: true, Schema: kubebindv1alpha1.APIServiceExportResourceSchema{OpenAPIV3Schema: runtime.RawExtension{Raw: []byte(`{"type":"object"}`)}}},
+					},
+				},
+			}
+			removed := &apiextensionsv1.CustomResourceDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: "caches.redis.io", OwnerReferences: tt.owners},
+			}
+
+			var deleted []string
+			var updated []*apiextensionsv1.CustomResourceDefinition
+			r := &reconciler{
+				getServiceExport: func(name string) (*kubebindv1alpha1.APIServiceExport, error) {
+					return export, nil
+				},
+				getServiceExportResource: func(name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					if tt.unresolved {
+						return nil, errors.NewNotFound(kubebindv1alpha1.Resource("apiserviceexportresources"), name)
+					}
+					return resource, nil
+				},
+				updateServiceExportResourceStatus: func(ctx context.Context, resource *kubebindv1alpha1.APIServiceExportResource) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					return resource, nil
+				},
+				getCRD: func(name string) (*apiextensionsv1.CustomResourceDefinition, error) {
+					require.Equal(t, exported.Name, name)
+					return exported, nil
+				},
+				applyCRD: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition, selectableFields map[string][]kubebindv1alpha1.SelectableField) (*apiextensionsv1.CustomResourceDefinition, error) {
+					return crd, nil
+				},
+				getConsumerVersion: func() (*version.Version, error) {
+					return version.MustParseGeneric("1.25"), nil
+				},
+				listBindingCRDs: func(bindingName string) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+					require.Equal(t, "binding", bindingName)
+					return []*apiextensionsv1.CustomResourceDefinition{exported, removed}, nil
+				},
+				hasObjects: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) (bool, error) {
+					require.Equal(t, removed.Name, crd.Name)
+					return tt.inUse, nil
+				},
+				deleteCRD: func(ctx context.Context, name string) error {
+					deleted = append(deleted, name)
+					return nil
+				},
+				updateCRD: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) (*apiextensionsv1.CustomResourceDefinition, error) {
+					updated = append(updated, crd)
+					return crd, nil
+				},
+			}
+
+			binding := &kubebindv1alpha1.APIServiceBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "binding"},
+				Spec:       kubebindv1alpha1.APIServiceBindingSpec{Export: export.Name, CRDDeletionPolicy: tt.policy},
+			}
+			require.NoError(t, r.ensureCRDs(context.Background(), binding))
+
+			if tt.unresolved {
+				// the removed CRD might be the rewritten CRD of the unresolved resource.
+				require.Empty(t, deleted)
+				require.Empty(t, updated)
+			} else if tt.wantDelete {
+				require.Equal(t, []string{"caches.redis.io"}, deleted)
+				require.Empty(t, updated)
+			} else {
+				require.Empty(t, deleted)
+				require.Len(t, updated, 1)
+				require.Equal(t, "caches.redis.io", updated[0].Name)
+				if len(tt.wantOwners) == 0 {
+					require.Empty(t, updated[0].OwnerReferences)
+				} else {
+					require.Equal(t, tt.wantOwners, updated[0].OwnerReferences)
+				}
+			}
+			require.Len(t, removed.OwnerReferences, len(tt.owners), "informer objects must not be mutated")
+		})
+	}
+}
+
+func TestEnsureCRDsSelectedResources(t *testing.T) {
+	owner := metav1.OwnerReference{APIVersion: kubebindv1alpha1.SchemeGroupVersion.String(), Kind: "APIServiceBinding", Name: "binding"}
+	newResource := func(group, plural, kind string) *kubebindv1alpha1.APIServiceExportResource {
+		return &kubebindv1alpha1.APIServiceExportResource{
+			ObjectMeta: metav1.ObjectMeta{Name: plural + "." + group, Namespace: "cluster-abc"},
+			Spec: kubebindv1alpha1.APIServiceExportResourceSpec{
+				Group: group,
+				Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: plural, Kind: kind},
+				Scope: apiextensionsv1.NamespaceScoped,
+				Versions: []kubebindv1alpha1.APIServiceExportResourceVersion{
+					{Name: "v1", Served: true, Storage: true, Schema: kubebindv1alpha1.APIServiceExportResourceSchema{OpenAPIV3Schema: runtime.RawExtension{Raw: []byte(`{"type":"object"}`)}}},
+				},
+			},
+		}
+	}
+	resources := map[string]*kubebindv1alpha1.APIServiceExportResource{
+		"mangodbs.mangodb.com": newResource("mangodb.com", "mangodbs", "MangoDB"),
+		"caches.redis.io":      newResource("redis.io", "caches", "Cache"),
+	}
+	// mangodbs.mangodb.io is rewritten onto the consumer CRD of mangodbs.mangodb.com.
+	rewritten := newResource("mangodb.io", "mangodbs", "MangoDB")
+	rewritten.Spec.ConsumerRewrite = &kubebindv1alpha1.APIServiceExportResourceRewrite{Group: "mangodb.com"}
+	resources[rewritten.Name] = rewritten
+
+	tests := []struct {
+		name        string
+		selected    []kubebindv1alpha1.GroupResource
+		rewritten   bool
+		wantApplied []string
+		wantDeleted []string
+		wantReason  string
+		wantMessage string
+	}{
+		{name: "all", wantApplied: []string{"mangodbs.mangodb.com", "caches.redis.io"}},
+		{
+			name:        "subset",
+			selected:    []kubebindv1alpha1.GroupResource{{Group: "redis.io", Resource: "caches"}},
+			wantApplied: []string{"caches.redis.io"},
+			wantDeleted: []string{"mangodbs.mangodb.com"},
+		},
+		{
+			name:        "not exported",
+			selected:    []kubebindv1alpha1.GroupResource{{Group: "mangodb.com", Resource: "mangodbs"}, {Group: "example.com", Resource: "foos"}},
+			wantApplied: []string{"mangodbs.mangodb.com"},
+			wantReason:  "SelectedResourceNotExported",
+			wantMessage: "APIServiceExport export does not offer the selected resources: foos.example.com",
+		},
+		{
+			name:        "duplicate consumer names",
+			rewritten:   true,
+			selected:    []kubebindv1alpha1.GroupResource{{Group: "redis.io", Resource: "caches"}, {Group: "mangodb.io", Resource: "mangodbs"}, {Group: "mangodb.com", Resource: "mangodbs"}},
+			wantApplied: []string{"mangodbs.mangodb.com", "caches.redis.io"},
+			wantReason:  "DuplicateConsumerResource",
+			wantMessage: "APIServiceExportResource mangodbs.mangodb.io maps to CustomResourceDefinition mangodbs.mangodb.com on the consumer cluster, which another resource of the binding does already.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			export := &kubebindv1alpha1.APIServiceExport{
+				ObjectMeta: metav1.ObjectMeta{Name: "export", Namespace: "cluster-abc"},
+				Spec: kubebindv1alpha1.APIServiceExportSpec{
+					Resources: []kubebindv1alpha1.APIServiceExportGroupResource{
+						{GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: "mangodbs"}},
+						{GroupResource: kubebindv1alpha1.GroupResource{Group: "redis.io", Resource: "caches"}},
+					},
+				},
+			}
+			if tt.rewritten {
+				export.Spec.Resources = append(export.Spec.Resources, kubebindv1alpha1.APIServiceExportGroupResource{
+					GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.io", Resource: "mangodbs"},
+				})
+			}
+			// the binding used to bind all exported resources.
+			existing := &apiextensionsv1.CustomResourceDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com", OwnerReferences: []metav1.OwnerReference{owner}},
+			}
+
+			var applied, deleted []string
+			r := &reconciler{
+				getServiceExport: func(name string) (*kubebindv1alpha1.APIServiceExport, error) {
+					return export, nil
+				},
+				getServiceExportResource: func(name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					return resources[name], nil
+				},
+				updateServiceExportResourceStatus: func(ctx context.Context, resource *kubebindv1alpha1.APIServiceExportResource) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					return resource, nil
+				},
+				getCRD: func(name string) (*apiextensionsv1.CustomResourceDefinition, error) {
+					if name == existing.Name {
+						return existing, nil
+					}
+					return nil, errors.NewNotFound(apiextensionsv1.Resource("customresourcedefinitions"), name)
+				},
+				applyCRD: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition, selectableFields map[string][]kubebindv1alpha1.SelectableField) (*apiextensionsv1.CustomResourceDefinition, error) {
+					applied = append(applied, crd.Name)
+					return crd, nil
+				},
+				getConsumerVersion: func() (*version.Version, error) {
+					return version.MustParseGeneric("1.25"), nil
+				},
+				listBindingCRDs: func(bindingName string) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+					return []*apiextensionsv1.CustomResourceDefinition{existing}, nil
+				},
+				hasObjects: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) (bool, error) {
+					return false, nil
+				},
+				deleteCRD: func(ctx context.Context, name string) error {
+					deleted = append(deleted, name)
+					return nil
+				},
+			}
+
+			binding := &kubebindv1alpha1.APIServiceBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "binding"},
+				Spec:       kubebindv1alpha1.APIServiceBindingSpec{Export: export.Name, Resources: tt.selected},
+			}
+			require.NoError(t, r.ensureCRDs(context.Background(), binding))
+
+			require.Equal(t, tt.wantApplied, applied)
+			require.Equal(t, tt.wantDeleted, deleted)
+
+			cond := conditions.Get(binding, kubebindv1alpha1.APIServiceBindingConditionResourcesValid)
+			require.NotNil(t, cond)
+			if tt.wantReason == "" {
+				require.Equal(t, corev1.ConditionTrue, cond.Status)
+			} else {
+				require.Equal(t, corev1.ConditionFalse, cond.Status)
+				require.Equal(t, tt.wantReason, cond.Reason)
+				require.Equal(t, tt.wantMessage, cond.Message)
+			}
+		})
+	}
+}
+
+func TestEnsureCRDsBuiltInResourcesShadowed(t *testing.T) {
+	tests := []struct {
+		name       string
+		names      apiextensionsv1.CustomResourceDefinitionNames
+		wantStatus corev1.ConditionStatus
+	}{
+		{
+			name:       "no collision",
+			names:      apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb", Kind: "MangoDB", ListKind: "MangoDBList"},
+			wantStatus: corev1.ConditionTrue,
+		},
+		{
+			name:       "colliding plural",
+			names:      apiextensionsv1.CustomResourceDefinitionNames{Plural: "deployments", Singular: "deployment", Kind: "Deployment", ListKind: "DeploymentList"},
+			wantStatus: corev1.ConditionFalse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := tt.names.Plural + ".mangodb.com"
+			export := &kubebindv1alpha1.APIServiceExport{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "cluster-abc"},
+				Spec: kubebindv1alpha1.APIServiceExportSpec{
+					Resources: []kubebindv1alpha1.APIServiceExportGroupResource{
+						{GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: tt.names.Plural}},
+					},
+				},
+			}
+			resource := &kubebindv1alpha1.APIServiceExportResource{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "cluster-abc"},
+				Spec: kubebindv1alpha1.APIServiceExportResourceSpec{
+					Group: "mangodb.com",
+					Names: tt.names,
+					Scope: apiextensionsv1.NamespaceScoped,
+					Versions: []kubebindv1alpha1.APIServiceExportResourceVersion{
+						{
+							Name:    "v1alpha1",
+							Served:  true,
+							Storage: true,
+							Schema: kubebindv1alpha1.APIServiceExportResourceSchema{
+								OpenAPIV3Schema: runtime.RawExtension{Raw: []byte(`{"type":"object"}`)},
+							},
+						},
+					},
+				},
+			}
+
+			var created *apiextensionsv1.CustomResourceDefinition
+			r := &reconciler{
+				getServiceExport: func(name string) (*kubebindv1alpha1.APIServiceExport, error) {
+					return export, nil
+				},
+				getServiceExportResource: func(name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					return resource, nil
+				},
+				updateServiceExportResourceStatus: func(ctx context.Context, resource *kubebindv1alpha1.APIServiceExportResource) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					return resource, nil
+				},
+				getCRD: func(name string) (*apiextensionsv1.CustomResourceDefinition, error) {
+					return nil, errors.NewNotFound(apiextensionsv1.Resource("customresourcedefinitions"), name)
+				},
+				applyCRD: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition, selectableFields map[string][]kubebindv1alpha1.SelectableField) (*apiextensionsv1.CustomResourceDefinition, error) {
+					created = crd
+					return crd, nil
+				},
+				getConsumerVersion: func() (*version.Version, error) {
+					return version.ParseGeneric("v1.25.3")
+				},
+				listBindingCRDs: func(bindingName string) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+					return nil, nil
+				},
+			}
+
+			binding := &kubebindv1alpha1.APIServiceBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: name},
+				Spec:       kubebindv1alpha1.APIServiceBindingSpec{Export: export.Name},
+			}
+			require.NoError(t, r.ensureCRDs(context.Background(), binding))
+
+			// the CRD is installed either way, it is reachable by its fully qualified name.
+			require.NotNil(t, created)
+
+			cond := conditions.Get(binding, kubebindv1alpha1.APIServiceBindingConditionBuiltInResourcesNotShadowed)
+			require.NotNil(t, cond)
+			require.Equal(t, tt.wantStatus, cond.Status)
+			if tt.wantStatus == corev1.ConditionFalse {
+				require.Equal(t, "ShadowsBuiltInResources", cond.Reason)
+				require.Equal(t, conditionsapi.ConditionSeverityWarning, cond.Severity)
+				require.Contains(t, cond.Message, "deployments.mangodb.com shadows deployments.apps")
+			}
+		})
+	}
+}
+
+func TestEnsureCRDsTwoProviders(t *testing.T) {
+	tests := []struct {
+		name        string
+		suffixes    [2]string
+		wantCRDs    []string
+		wantForeign bool
+	}{
+		{
+			name:     "provider scoped",
+			suffixes: [2]string{"mangodb-a.example.com", "mangodb-b.example.com"},
+			wantCRDs: []string{"mangodbs.mangodb.com.mangodb-a.example.com", "mangodbs.mangodb.com.mangodb-b.example.com"},
+		},
+		{name: "not provider scoped", wantCRDs: []string{"mangodbs.mangodb.com"}, wantForeign: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// both service providers export a resource of the same name.
+			export := &kubebindv1alpha1.APIServiceExport{
+				ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com", Namespace: "cluster-abc"},
+				Spec: kubebindv1alpha1.APIServiceExportSpec{
+					Resources: []kubebindv1alpha1.APIServiceExportGroupResource{
+						{GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: "mangodbs"}},
+					},
+				},
+			}
+			resource := &kubebindv1alpha1.APIServiceExportResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com", Namespace: "cluster-abc"},
+				Spec: kubebindv1alpha1.APIServiceExportResourceSpec{
+					Group: "mangodb.com",
+					Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb", Kind: "MangoDB", ListKind: "MangoDBList"},
+					Scope: apiextensionsv1.NamespaceScoped,
+					Versions: []kubebindv1alpha1.APIServiceExportResourceVersion{
+						{Name: "v1alpha1", Served: true, Storage: true, Schema: kubebindv1alpha1.APIServiceExportResourceSchema{OpenAPIV3Schema: runtime.RawExtension{Raw: []byte(`{"type":"object"}`)}}},
+					},
+				},
+			}
+
+			// the consumer cluster shared by both providers.
+			crds := map[string]*apiextensionsv1.CustomResourceDefinition{}
+			bindings := map[string]*kubebindv1alpha1.APIServiceBinding{}
+			for i, provider := range []string{"a", "b"} {
+				name := "mangodbs.mangodb.com"
+				if tt.suffixes[i] != "" {
+					name += "." + tt.suffixes[i]
+				} else {
+					name += "-" + provider
+				}
+				bindings[provider] = &kubebindv1alpha1.APIServiceBinding{
+					ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID("binding-" + provider)},
+					Spec: kubebindv1alpha1.APIServiceBindingSpec{
+						Export: export.Name,
+						KubeconfigSecretRef: kubebindv1alpha1.ClusterSecretKeyRef{
+							LocalSecretKeyRef: kubebindv1alpha1.LocalSecretKeyRef{Name: "kubeconfig-" + provider, Key: "kubeconfig"},
+							Namespace:         "kube-bind",
+						},
+						ConsumerGroupSuffix: tt.suffixes[i],
+					},
+				}
+			}
+
+			for _, provider := range []string{"a", "b"} {
+				r := &reconciler{
+					getServiceExport: func(name string) (*kubebindv1alpha1.APIServiceExport, error) {
+						return export, nil
+					},
+					getServiceBinding: func(name string) (*kubebindv1alpha1.APIServiceBinding, error) {
+						for _, binding := range bindings {
+							if binding.Name == name {
+								return binding, nil
+							}
+						}
+						return nil, errors.NewNotFound(kubebindv1alpha1.Resource("apiservicebindings"), name)
+					},
+					getServiceExportResource: func(name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+						return resource, nil
+					},
+					updateServiceExportResourceStatus: func(ctx context.Context, resource *kubebindv1alpha1.APIServiceExportResource) (*kubebindv1alpha1.APIServiceExportResource, error) {
+						return resource, nil
+					},
+					getCRD: func(name string) (*apiextensionsv1.CustomResourceDefinition, error) {
+						if crd, found := crds[name]; found {
+							return crd, nil
+						}
+						return nil, errors.NewNotFound(apiextensionsv1.Resource("customresourcedefinitions"), name)
+					},
+					applyCRD: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition, selectableFields map[string][]kubebindv1alpha1.SelectableField) (*apiextensionsv1.CustomResourceDefinition, error) {
+						crds[crd.Name] = crd
+						return crd, nil
+					},
+					getConsumerVersion: func() (*version.Version, error) {
+						return version.MustParseGeneric("1.25"), nil
+					},
+					listBindingCRDs: func(bindingName string) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+						return nil, nil
+					},
+				}
+				require.NoError(t, r.ensureCRDs(context.Background(), bindings[provider]))
+			}
+
+			var names []string
+			for name, crd := range crds {
+				names = append(names, name)
+				// the consumer syncer finds the resource by the annotation.
+				require.Equal(t, "mangodbs.mangodb.com", kubebindhelpers.ServiceExportResourceName(crd))
+			}
+			sort.Strings(names)
+			require.Equal(t, tt.wantCRDs, names)
+
+			condA := conditions.Get(bindings["a"], kubebindv1alpha1.APIServiceBindingConditionSchemaInSync)
+			require.NotNil(t, condA)
+			require.Equal(t, corev1.ConditionTrue, condA.Status)
+			condB := conditions.Get(bindings["b"], kubebindv1alpha1.APIServiceBindingConditionSchemaInSync)
+			require.NotNil(t, condB)
+			if tt.wantForeign {
+				require.Equal(t, corev1.ConditionFalse, condB.Status)
+				require.Equal(t, "ForeignCustomResourceDefinition", condB.Reason)
+				return
+			}
+			require.Equal(t, corev1.ConditionTrue, condB.Status)
+			require.Equal(t, "mangodb.com.mangodb-b.example.com", crds["mangodbs.mangodb.com.mangodb-b.example.com"].Spec.Group)
+			require.Equal(t, []metav1.OwnerReference{{
+				APIVersion: kubebindv1alpha1.SchemeGroupVersion.String(),
+				Kind:       "APIServiceBinding",
+				Name:       bindings["b"].Name,
+				UID:        bindings["b"].UID,
+				Controller: pointer.Bool(true),
+			}}, crds["mangodbs.mangodb.com.mangodb-b.example.com"].OwnerReferences)
+		})
+	}
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package servicebinding
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// consumerVersionTTL is how long the consumer cluster version is cached. Upgrades
+// of the consumer cluster are picked up after at most this long.
+const consumerVersionTTL = 10 * time.Minute
+
+// versionCache caches the result of get for ttl. Errors are not cached.
+type versionCache struct {
+	ttl time.Duration
+	get func() (*version.Version, error)
+	now func() time.Time
+
+	lock    sync.Mutex
+	version *version.Version
+	expires time.Time
+}
+
+func newVersionCache(ttl time.Duration, get func() (*version.Version, error)) *versionCache {
+	return &versionCache{
+		ttl: ttl,
+		get: get,
+		now: time.Now,
+	}
+}
+
+// Get returns the cached version, or calls get if there is none or it has expired.
+func (c *versionCache) Get() (*version.Version, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.version != nil && c.now().Before(c.expires) {
+		return c.version, nil
+	}
+	v, err := c.get()
+	if err != nil {
+		return nil, err
+	}
+	c.version, c.expires = v, c.now().Add(c.ttl)
+	return v, nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package servicebinding
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+func TestVersionCache(t *testing.T) {
+	calls := 0
+	var err error
+	c := newVersionCache(time.Minute, func() (*version.Version, error) {
+		calls++
+		if err != nil {
+			return nil, err
+		}
+		return version.MustParseGeneric("v1.25.0"), nil
+	})
+	now := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	err = errors.New("boom")
+	_, got := c.Get()
+	require.EqualError(t, got, "boom")
+
+	err = nil
+	v, got := c.Get()
+	require.NoError(t, got)
+	require.Equal(t, "1.25.0", v.String())
+	require.Equal(t, 2, calls, "errors are not cached")
+
+	now = now.Add(30 * time.Second)
+	_, got = c.Get()
+	require.NoError(t, got)
+	require.Equal(t, 2, calls, "cached within the ttl")
+
+	now = now.Add(time.Minute)
+	_, got = c.Get()
+	require.NoError(t, got)
+	require.Equal(t, 3, calls, "refreshed after the ttl")
+}
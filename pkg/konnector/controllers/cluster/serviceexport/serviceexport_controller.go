@@ -21,8 +21,11 @@ import (
 	"fmt"
 	"time"
 
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apiextensionslisters "k8s.io/apiextensions-apiserver/pkg/client/listers/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -48,9 +51,11 @@ const (
 func NewController(
 	consumerSecretRefKey, providerNamespace string,
 	consumerConfig, providerConfig *rest.Config,
+	forbiddenGroups []string,
 	serviceExportInformer bindinformers.APIServiceExportInformer,
 	serviceExportResourceInformer bindinformers.APIServiceExportResourceInformer,
 	serviceBindingInformer dynamic.Informer[bindlisters.APIServiceBindingLister],
+	crdInformer dynamic.Informer[apiextensionslisters.CustomResourceDefinitionLister],
 ) (*controller, error) {
 	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName)
 
@@ -87,8 +92,11 @@ func NewController(
 		serviceExportResourceIndexer: serviceExportResourceInformer.Informer().GetIndexer(),
 
 		serviceBindingInformer: serviceBindingInformer,
+		crdInformer:            crdInformer,
 
 		reconciler: reconciler{
+			forbiddenGroups: forbiddenGroups,
+
 			listServiceBinding: func(export string) ([]*kubebindv1alpha1.APIServiceBinding, error) {
 				objs, err := serviceBindingInformer.Informer().GetIndexer().ByIndex(indexers.ByServiceBindingKubeconfigSecret, consumerSecretRefKey)
 				if err != nil {
@@ -106,6 +114,12 @@ func NewController(
 			getServiceExportResource: func(name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
 				return serviceExportResourceInformer.Lister().APIServiceExportResources(providerNamespace).Get(name)
 			},
+			getCRD: func(name string) (*apiextensionsv1.CustomResourceDefinition, error) {
+				return crdInformer.Lister().Get(name)
+			},
+			getProviderServiceExportResource: func(ctx context.Context, name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+				return providerBindClient.KubeBindV1alpha1().APIServiceExportResources(providerNamespace).Get(ctx, name, metav1.GetOptions{})
+			},
 		},
 
 		commit: committer.NewCommitter[*kubebindv1alpha1.APIServiceExport, *kubebindv1alpha1.APIServiceExportSpec, *kubebindv1alpha1.APIServiceExportStatus](
@@ -167,6 +181,7 @@ type controller struct {
 	serviceExportResourceIndexer cache.Indexer
 
 	serviceBindingInformer dynamic.Informer[bindlisters.APIServiceBindingLister]
+	crdInformer            dynamic.Informer[apiextensionslisters.CustomResourceDefinitionLister]
 
 	reconciler
 
@@ -199,6 +214,35 @@ func (c *controller) enqueueServiceBinding(logger klog.Logger, obj interface{})
 	c.queue.Add(key)
 }
 
+// enqueueCRD queues the exports of the bindings owning the CRD, such that drift of
+// the applied schema is noticed.
+func (c *controller) enqueueCRD(logger klog.Logger, obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	bindingNames, err := indexers.IndexCRDByServiceBinding(obj)
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, name := range bindingNames {
+		binding, err := c.serviceBindingInformer.Lister().Get(name)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				runtime.HandleError(err)
+			}
+			continue
+		}
+		if indexers.ByServiceBindingKubeconfigSecretKey(binding) != c.consumerSecretRefKey {
+			continue // not for us
+		}
+
+		key := c.providerNamespace + "/" + binding.Spec.Export
+		logger.V(2).Info("queueing APIServiceExport", "key", key, "reason", "CustomResourceDefinition", "CustomResourceDefinitionKey", name)
+		c.queue.Add(key)
+	}
+}
+
 func (c *controller) enqueueServiceExportResource(logger klog.Logger, obj interface{}) {
 	serKey, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
 	if err != nil {
@@ -250,6 +294,18 @@ func (c *controller) Start(ctx context.Context, numThreads int) {
 		},
 	})
 
+	c.crdInformer.Informer().AddDynamicEventHandler(ctx, controllerName, cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.enqueueCRD(logger, obj)
+		},
+		UpdateFunc: func(_, newObj interface{}) {
+			c.enqueueCRD(logger, newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			c.enqueueCRD(logger, obj)
+		},
+	})
+
 	for i := 0; i < numThreads; i++ {
 		go wait.UntilWithContext(ctx, c.startWorker, time.Second)
 	}
@@ -18,8 +18,11 @@ package serviceexport
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 
@@ -30,8 +33,15 @@ import (
 )
 
 type reconciler struct {
+	forbiddenGroups []string
+
 	listServiceBinding       func(export string) ([]*kubebindv1alpha1.APIServiceBinding, error)
 	getServiceExportResource func(name string) (*kubebindv1alpha1.APIServiceExportResource, error)
+	getCRD                   func(name string) (*apiextensionsv1.CustomResourceDefinition, error)
+
+	// getProviderServiceExportResource gets the export resource from the service provider
+	// cluster, bypassing the informer that lags behind deletions. Nil trusts the informer.
+	getProviderServiceExportResource func(ctx context.Context, name string) (*kubebindv1alpha1.APIServiceExportResource, error)
 }
 
 func (r *reconciler) reconcile(ctx context.Context, export *kubebindv1alpha1.APIServiceExport) error {
@@ -63,6 +73,7 @@ func (r *reconciler) reconcile(ctx context.Context, export *kubebindv1alpha1.API
 			kubebindv1alpha1.APIServiceExportConditionConnected,
 		)
 
+		r.ensureServiceBindingScope(export, bindings[0])
 		if err := r.ensureServiceBindingConditionCopied(ctx, export, bindings[0]); err != nil {
 			errs = append(errs, err)
 		}
@@ -72,6 +83,14 @@ func (r *reconciler) reconcile(ctx context.Context, export *kubebindv1alpha1.API
 		errs = append(errs, err)
 	}
 
+	var binding *kubebindv1alpha1.APIServiceBinding
+	if len(bindings) == 1 {
+		binding = bindings[0]
+	}
+	if err := r.ensureSchemaInSync(ctx, export, binding); err != nil {
+		errs = append(errs, err)
+	}
+
 	conditions.SetSummary(export)
 
 	return utilerrors.NewAggregate(errs)
@@ -79,7 +98,7 @@ func (r *reconciler) reconcile(ctx context.Context, export *kubebindv1alpha1.API
 
 func (r *reconciler) ensureServiceBindingConditionCopied(ctx context.Context, export *kubebindv1alpha1.APIServiceExport, binding *kubebindv1alpha1.APIServiceBinding) error {
 	if inSync := conditions.Get(binding, kubebindv1alpha1.APIServiceBindingConditionSchemaInSync); inSync != nil {
-		conditions.Set(export, inSync)
+		copyCondition(export, inSync, kubebindv1alpha1.APIServiceExportConditionSchemaInSync)
 	} else {
 		conditions.MarkFalse(
 			export,
@@ -92,9 +111,7 @@ func (r *reconciler) ensureServiceBindingConditionCopied(ctx context.Context, ex
 	}
 
 	if ready := conditions.Get(binding, conditionsapi.ReadyCondition); ready != nil {
-		clone := *ready
-		clone.Type = kubebindv1alpha1.APIServiceExportConditionServiceBindingReady
-		conditions.Set(export, &clone)
+		copyCondition(export, ready, kubebindv1alpha1.APIServiceExportConditionServiceBindingReady)
 	} else {
 		conditions.MarkFalse(
 			export,
@@ -109,15 +126,93 @@ func (r *reconciler) ensureServiceBindingConditionCopied(ctx context.Context, ex
 	return nil
 }
 
+// copyCondition sets a copy of the condition with the given type. The last transition
+// time of an existing condition in the same state is kept, to avoid noisy updates.
+func copyCondition(to conditions.Setter, condition *conditionsapi.Condition, conditionType conditionsapi.ConditionType) {
+	clone := condition.DeepCopy()
+	clone.Type = conditionType
+	conditions.Set(to, clone)
+}
+
+// ensureServiceBindingScope flags the export as not connected if the binding
+// expects a different scope than the export has.
+func (r *reconciler) ensureServiceBindingScope(export *kubebindv1alpha1.APIServiceExport, binding *kubebindv1alpha1.APIServiceBinding) {
+	if binding.Spec.Scope == "" || binding.Spec.Scope == export.Spec.Scope {
+		return
+	}
+
+	conditions.MarkFalse(
+		export,
+		kubebindv1alpha1.APIServiceExportConditionConnected,
+		"ServiceBindingScopeMismatch",
+		conditionsapi.ConditionSeverityError,
+		"APIServiceBinding %s in the consumer cluster expects %s scope, but the APIServiceExport has %s scope.",
+		binding.Name, binding.Spec.Scope, export.Spec.Scope,
+	)
+}
+
 func (r *reconciler) ensureResourcesExist(ctx context.Context, export *kubebindv1alpha1.APIServiceExport) error {
+	// an export without resources binds nothing, which is hardly intended.
+	if len(export.Spec.Resources) == 0 {
+		export.Status.Resources = nil
+		conditions.MarkFalse(
+			export,
+			kubebindv1alpha1.APIServiceExportConditionResourcesValid,
+			"NoResources",
+			conditionsapi.ConditionSeverityWarning,
+			"APIServiceExport does not reference any resources, it is likely misconfigured.",
+		)
+		return nil
+	}
+
 	var errs []error
 
+	previous := map[string]kubebindv1alpha1.APIServiceExportResourceCRD{}
+	for _, crd := range export.Status.Resources {
+		previous[crd.Resource] = crd
+	}
+	var crds []kubebindv1alpha1.APIServiceExportResourceCRD
+
 	resourceValid := true
 	for _, resource := range export.Spec.Resources {
 		name := resource.Resource + "." + resource.Group
+		versions := resource.Versions
+		if kubebindhelpers.IsKubeBindGroup(resource.Group) {
+			conditions.MarkFalse(
+				export,
+				kubebindv1alpha1.APIServiceExportConditionResourcesValid,
+				"KubeBindResource",
+				conditionsapi.ConditionSeverityError,
+				"APIServiceExportResource %s is in group %q of kube-bind itself, which cannot be bound.",
+				name, resource.Group,
+			)
+			resourceValid = false
+			continue
+		}
+		if kubebindhelpers.IsGroupForbidden(resource.Group, r.forbiddenGroups) {
+			conditions.MarkFalse(
+				export,
+				kubebindv1alpha1.APIServiceExportConditionResourcesValid,
+				"ServiceExportResourceForbidden",
+				conditionsapi.ConditionSeverityError,
+				"APIServiceExportResource %s is in group %q, which cannot be bound.",
+				name, resource.Group,
+			)
+			resourceValid = false
+			continue
+		}
+
 		resource, err := r.getServiceExportResource(name)
+		if err == nil && r.getProviderServiceExportResource != nil {
+			// the backend deletes the export resource when the CRD is gone, which a stale
+			// informer would not tell yet.
+			resource, err = r.getProviderServiceExportResource(ctx, name)
+		}
 		if err != nil && !errors.IsNotFound(err) {
 			errs = append(errs, err)
+			if crd, found := previous[name]; found {
+				crds = append(crds, crd) // keep what we knew until the next reconcile
+			}
 			continue
 		} else if errors.IsNotFound(err) {
 			conditions.MarkFalse(
@@ -130,6 +225,18 @@ func (r *reconciler) ensureResourcesExist(ctx context.Context, export *kubebindv
 			)
 			resourceValid = false
 			continue
+		} else if resource.DeletionTimestamp != nil {
+			// the object lingers until finalizers of third parties are done.
+			conditions.MarkFalse(
+				export,
+				kubebindv1alpha1.APIServiceExportConditionResourcesValid,
+				"ServiceExportResourceDeleting",
+				conditionsapi.ConditionSeverityError,
+				"APIServiceExportResource %s is being deleted on the service provider cluster.",
+				name,
+			)
+			resourceValid = false
+			continue
 		}
 
 		if resource.Spec.Scope != apiextensionsv1.NamespaceScoped && export.Spec.Scope != kubebindv1alpha1.ClusterScope {
@@ -145,11 +252,59 @@ func (r *reconciler) ensureResourcesExist(ctx context.Context, export *kubebindv
 			continue
 		}
 
-		if _, err := kubebindhelpers.ServiceExportResourceToCRD(resource); err != nil {
+		// the export can pin a subset of the versions, e.g. to hide deprecated ones.
+		exported := resource
+		if len(versions) > 0 {
+			exported = resource.DeepCopy()
+			if err := kubebindhelpers.PinVersions(exported, versions); err != nil {
+				conditions.MarkFalse(
+					export,
+					kubebindv1alpha1.APIServiceExportConditionResourcesValid,
+					"PinnedVersionNotServed",
+					conditionsapi.ConditionSeverityError,
+					"APIServiceExportResource %s cannot be exported with the pinned versions: %s",
+					name, err,
+				)
+				resourceValid = false
+				continue
+			}
+		}
+
+		switch resource.Spec.ConversionStrategy {
+		case "", apiextensionsv1.NoneConverter:
+		case apiextensionsv1.WebhookConverter:
+			// without conversion on the consumer side, webhook conversion is only safe for a single version,
+			// or when collapsing to the canonical version.
+			if len(exported.Spec.Versions) > 1 && exported.Spec.CanonicalVersion == "" {
+				conditions.MarkFalse(
+					export,
+					kubebindv1alpha1.APIServiceExportConditionResourcesValid,
+					"ServiceExportResourceConversionUnsupported",
+					conditionsapi.ConditionSeverityError,
+					"APIServiceExportResource %s requires webhook conversion between %d versions, which is not supported on the consumer cluster.",
+					name, len(exported.Spec.Versions),
+				)
+				resourceValid = false
+				continue
+			}
+		default:
+			conditions.MarkFalse(
+				export,
+				kubebindv1alpha1.APIServiceExportConditionResourcesValid,
+				"ServiceExportResourceConversionUnsupported",
+				conditionsapi.ConditionSeverityError,
+				"APIServiceExportResource %s has unknown conversion strategy %q.",
+				name, resource.Spec.ConversionStrategy,
+			)
+			resourceValid = false
+			continue
+		}
+
+		if err := kubebindhelpers.ValidateStorageVersion(resource); err != nil {
 			conditions.MarkFalse(
 				export,
 				kubebindv1alpha1.APIServiceExportConditionResourcesValid,
-				"ServiceExportResourceInvalid",
+				"ServiceExportResourceInvalidStorageVersion",
 				conditionsapi.ConditionSeverityError,
 				"APIServiceExportResource %s on the service provider cluster is invalid: %s",
 				name, err,
@@ -157,7 +312,41 @@ func (r *reconciler) ensureResourcesExist(ctx context.Context, export *kubebindv
 			resourceValid = false
 			continue
 		}
+
+		crd, err := kubebindhelpers.ServiceExportResourceToCRD(resource, versions)
+		if err != nil {
+			msg, reason := err.Error(), "ServiceExportResourceInvalid"
+			if invalid, ok := err.(*kubebindhelpers.InvalidResourceError); ok {
+				msg = invalid.Message()
+				if invalid.NameTooLong() {
+					// the consumer API server would reject the CRD on apply.
+					reason = "ServiceExportResourceNameTooLong"
+				}
+			}
+			conditions.MarkFalse(
+				export,
+				kubebindv1alpha1.APIServiceExportConditionResourcesValid,
+				reason,
+				conditionsapi.ConditionSeverityError,
+				"APIServiceExportResource %s on the service provider cluster is invalid: %s",
+				name, msg,
+			)
+			resourceValid = false
+			continue
+		}
+
+		generated := kubebindv1alpha1.APIServiceExportResourceCRD{
+			Resource: name,
+			CRDName:  crd.Name,
+		}
+		for _, v := range crd.Spec.Versions {
+			if v.Served {
+				generated.ServedVersions = append(generated.ServedVersions, v.Name)
+			}
+		}
+		crds = append(crds, generated)
 	}
+	export.Status.Resources = crds
 
 	if resourceValid {
 		conditions.MarkTrue(
@@ -168,3 +357,138 @@ func (r *reconciler) ensureResourcesExist(ctx context.Context, export *kubebindv
 
 	return utilerrors.NewAggregate(errs)
 }
+
+// ensureSchemaInSync compares the CRDs generated from the valid resources of the export
+// with those applied to the consumer cluster, independently of what the binding reports.
+// Drift marks the schema out of sync. Otherwise, the condition copied from the binding
+// is kept, or, without a single binding, the schema is marked in sync. Resources not
+// selected by the binding are skipped.
+func (r *reconciler) ensureSchemaInSync(ctx context.Context, export *kubebindv1alpha1.APIServiceExport, binding *kubebindv1alpha1.APIServiceBinding) error {
+	var errs []error
+	var missing, drifted []string
+	selected, _ := kubebindhelpers.SelectedResources(binding, export.Spec.Resources)
+	var suffix string
+	if binding != nil {
+		suffix = binding.Spec.ConsumerGroupSuffix
+	}
+	pinned := map[string][]string{}
+	for _, resource := range selected {
+		pinned[resource.Resource+"."+resource.Group] = resource.Versions
+	}
+	for _, generated := range export.Status.Resources {
+		versions, found := pinned[generated.Resource]
+		if !found {
+			continue
+		}
+		resource, err := r.getServiceExportResource(generated.Resource)
+		if err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, err)
+			continue
+		} else if errors.IsNotFound(err) {
+			continue // reported by ensureResourcesExist on the next reconcile
+		}
+		crd, err := kubebindhelpers.ServiceExportResourceToCRD(kubebindhelpers.WithConsumerGroupSuffix(resource, suffix), versions)
+		if err != nil {
+			continue // reported by ensureResourcesExist
+		}
+
+		live, err := r.getCRD(crd.Name)
+		if err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, err)
+			continue
+		} else if errors.IsNotFound(err) {
+			missing = append(missing, crd.Name)
+			continue
+		}
+		if fields := schemaDrift(crd, live); len(fields) > 0 {
+			drifted = append(drifted, fmt.Sprintf("%s differs in %s", crd.Name, strings.Join(fields, ", ")))
+		}
+	}
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	switch {
+	case len(missing) > 0:
+		conditions.MarkFalse(
+			export,
+			kubebindv1alpha1.APIServiceExportConditionSchemaInSync,
+			"CustomResourceDefinitionMissing",
+			conditionsapi.ConditionSeverityError,
+			"CustomResourceDefinitions are not applied to the consumer cluster: %s",
+			strings.Join(missing, ", "),
+		)
+	case len(drifted) > 0:
+		conditions.MarkFalse(
+			export,
+			kubebindv1alpha1.APIServiceExportConditionSchemaInSync,
+			"CustomResourceDefinitionOutOfSync",
+			conditionsapi.ConditionSeverityError,
+			"CustomResourceDefinitions on the consumer cluster differ from the exported resources: %s",
+			strings.Join(drifted, "; "),
+		)
+	case binding == nil:
+		conditions.MarkTrue(export, kubebindv1alpha1.APIServiceExportConditionSchemaInSync)
+	}
+
+	return nil
+}
+
+// schemaDrift returns the fields in which the live CRD differs from the generated one.
+// Only the fields kube-bind applies are compared, after defaulting the generated CRD
+// like the API server does.
+func schemaDrift(generated, live *apiextensionsv1.CustomResourceDefinition) []string {
+	generated = generated.DeepCopy()
+	apiextensionsv1.SetObjectDefaults_CustomResourceDefinition(generated)
+
+	var fields []string
+	if generated.Spec.Group != live.Spec.Group {
+		fields = append(fields, "group")
+	}
+	if !equality.Semantic.DeepEqual(generated.Spec.Names, live.Spec.Names) {
+		fields = append(fields, "names")
+	}
+	if generated.Spec.Scope != live.Spec.Scope {
+		fields = append(fields, "scope")
+	}
+
+	liveVersions := map[string]apiextensionsv1.CustomResourceDefinitionVersion{}
+	for _, v := range live.Spec.Versions {
+		liveVersions[v.Name] = v
+	}
+	for _, v := range generated.Spec.Versions {
+		lv, found := liveVersions[v.Name]
+		if !found {
+			fields = append(fields, fmt.Sprintf("missing version %s", v.Name))
+			continue
+		}
+		delete(liveVersions, v.Name)
+		if v.Served != lv.Served || v.Storage != lv.Storage || v.Deprecated != lv.Deprecated || !equality.Semantic.DeepEqual(v.DeprecationWarning, lv.DeprecationWarning) {
+			fields = append(fields, fmt.Sprintf("version %s serving", v.Name))
+		}
+		if !equality.Semantic.DeepEqual(v.Schema, lv.Schema) {
+			fields = append(fields, fmt.Sprintf("version %s schema", v.Name))
+		}
+		if !equality.Semantic.DeepEqual(subresourcesOf(v), subresourcesOf(lv)) {
+			fields = append(fields, fmt.Sprintf("version %s subresources", v.Name))
+		}
+		if !equality.Semantic.DeepEqual(v.AdditionalPrinterColumns, lv.AdditionalPrinterColumns) {
+			fields = append(fields, fmt.Sprintf("version %s printer columns", v.Name))
+		}
+	}
+	for _, v := range live.Spec.Versions {
+		if _, found := liveVersions[v.Name]; found {
+			fields = append(fields, fmt.Sprintf("additional version %s", v.Name))
+		}
+	}
+
+	return fields
+}
+
+// subresourcesOf returns the subresources of the version, with nil meaning none.
+func subresourcesOf(v apiextensionsv1.CustomResourceDefinitionVersion) apiextensionsv1.CustomResourceSubresources {
+	if v.Subresources == nil {
+		return apiextensionsv1.CustomResourceSubresources{}
+	}
+	return *v.Subresources
+}
@@ -0,0 +1,562 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package serviceexport
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/pointer"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+	"github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1/helpers"
+	conditionsapi "github.com/kube-bind/kube-bind/pkg/apis/third_party/conditions/apis/conditions/v1alpha1"
+	"github.com/kube-bind/kube-bind/pkg/apis/third_party/conditions/util/conditions"
+)
+
+func TestEnsureResourcesExistConversion(t *testing.T) {
+	version := func(name string, storage bool) kubebindv1alpha1.APIServiceExportResourceVersion {
+		return kubebindv1alpha1.APIServiceExportResourceVersion{Name: name, Served: true, Storage: storage}
+	}
+
+	tests := []struct {
+		name       string
+		strategy   apiextensionsv1.ConversionStrategyType
+		versions   []kubebindv1alpha1.APIServiceExportResourceVersion
+		storage    string
+		canonical  string
+		group      string
+		forbidden  []string
+		wantValid  bool
+		wantReason string
+	}{
+		{name: "none", strategy: apiextensionsv1.NoneConverter, versions: []kubebindv1alpha1.APIServiceExportResourceVersion{version("v1", true), version("v1beta1", false)}, wantValid: true},
+		{name: "unset", versions: []kubebindv1alpha1.APIServiceExportResourceVersion{version("v1", true)}, wantValid: true},
+		{name: "webhook with single version", strategy: apiextensionsv1.WebhookConverter, versions: []kubebindv1alpha1.APIServiceExportResourceVersion{version("v1", true)}, wantValid: true},
+		{name: "non-default storage version", versions: []kubebindv1alpha1.APIServiceExportResourceVersion{version("v1", true), version("v1beta1", false)}, storage: "v1beta1", wantValid: true},
+		{name: "unknown storage version", versions: []kubebindv1alpha1.APIServiceExportResourceVersion{version("v1", true)}, storage: "v2", wantReason: "ServiceExportResourceInvalidStorageVersion"},
+		{name: "forbidden group", group: "rbac.authorization.k8s.io", versions: []kubebindv1alpha1.APIServiceExportResourceVersion{version("v1", true)}, wantReason: "ServiceExportResourceForbidden"},
+		{name: "kube-bind group", group: "kube-bind.io", forbidden: []string{}, versions: []kubebindv1alpha1.APIServiceExportResourceVersion{version("v1", true)}, wantReason: "KubeBindResource"},
+		{name: "kube-bind subgroup", group: "example.kube-bind.io", forbidden: []string{}, versions: []kubebindv1alpha1.APIServiceExportResourceVersion{version("v1", true)}, wantReason: "KubeBindResource"},
+		{name: "webhook with multiple versions", strategy: apiextensionsv1.WebhookConverter, versions: []kubebindv1alpha1.APIServiceExportResourceVersion{version("v1", true), version("v1beta1", false)}, wantReason: "ServiceExportResourceConversionUnsupported"},
+		{name: "webhook collapsed to canonical version", strategy: apiextensionsv1.WebhookConverter, versions: []kubebindv1alpha1.APIServiceExportResourceVersion{version("v1", true), version("v1beta1", false)}, canonical: "v1beta1", wantValid: true},
+		{name: "unknown canonical version", versions: []kubebindv1alpha1.APIServiceExportResourceVersion{version("v1", true)}, canonical: "v2", wantReason: "ServiceExportResourceInvalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.group == "" {
+				tt.group = "mangodb.com"
+			}
+			if tt.forbidden == nil {
+				tt.forbidden = helpers.DefaultForbiddenGroups
+			}
+			resource := &kubebindv1alpha1.APIServiceExportResource{
+				ObjectMeta: metav1.ObjectMeta{Name: "mangodbs." + tt.group},
+				Spec: kubebindv1alpha1.APIServiceExportResourceSpec{
+					Group:              tt.group,
+					Names:              apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb", Kind: "MangoDB", ListKind: "MangoDBList"},
+					Scope:              apiextensionsv1.NamespaceScoped,
+					ConversionStrategy: tt.strategy,
+					StorageVersion:     tt.storage,
+					CanonicalVersion:   tt.canonical,
+					Versions:           tt.versions,
+				},
+			}
+			r := &reconciler{
+				forbiddenGroups: tt.forbidden,
+				getServiceExportResource: func(name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					require.Equal(t, resource.Name, name)
+					return resource, nil
+				},
+			}
+			export := &kubebindv1alpha1.APIServiceExport{
+				ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+				Spec: kubebindv1alpha1.APIServiceExportSpec{
+					Resources: []kubebindv1alpha1.APIServiceExportGroupResource{{GroupResource: kubebindv1alpha1.GroupResource{Group: tt.group, Resource: "mangodbs"}}},
+				},
+			}
+
+			require.NoError(t, r.ensureResourcesExist(context.Background(), export))
+
+			cond := conditions.Get(export, kubebindv1alpha1.APIServiceExportConditionResourcesValid)
+			require.NotNil(t, cond)
+			if tt.wantValid {
+				require.Equal(t, corev1.ConditionTrue, cond.Status)
+				require.Len(t, export.Status.Resources, 1)
+				require.Equal(t, resource.Name, export.Status.Resources[0].Resource)
+				require.Equal(t, resource.Name, export.Status.Resources[0].CRDName)
+				var served []string
+				for _, v := range tt.versions {
+					served = append(served, v.Name)
+				}
+				if tt.canonical != "" {
+					served = []string{tt.canonical}
+				}
+				require.Equal(t, served, export.Status.Resources[0].ServedVersions)
+			} else {
+				require.Equal(t, corev1.ConditionFalse, cond.Status)
+				require.Equal(t, tt.wantReason, cond.Reason)
+				require.Empty(t, export.Status.Resources)
+			}
+		})
+	}
+}
+
+func TestReconcileServiceBindingScope(t *testing.T) {
+	tests := []struct {
+		name          string
+		bindingScope  kubebindv1alpha1.Scope
+		wantConnected corev1.ConditionStatus
+	}{
+		{name: "unset", wantConnected: corev1.ConditionTrue},
+		{name: "agreeing", bindingScope: kubebindv1alpha1.ClusterScope, wantConnected: corev1.ConditionTrue},
+		{name: "disagreeing", bindingScope: kubebindv1alpha1.NamespacedScope, wantConnected: corev1.ConditionFalse},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binding := &kubebindv1alpha1.APIServiceBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+				Spec: kubebindv1alpha1.APIServiceBindingSpec{
+					Export: "mangodbs.mangodb.com",
+					Scope:  tt.bindingScope,
+				},
+			}
+			r := &reconciler{
+				listServiceBinding: func(export string) ([]*kubebindv1alpha1.APIServiceBinding, error) {
+					return []*kubebindv1alpha1.APIServiceBinding{binding}, nil
+				},
+			}
+			export := &kubebindv1alpha1.APIServiceExport{
+				ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+				Spec:       kubebindv1alpha1.APIServiceExportSpec{Scope: kubebindv1alpha1.ClusterScope},
+			}
+
+			require.NoError(t, r.reconcile(context.Background(), export))
+
+			cond := conditions.Get(export, kubebindv1alpha1.APIServiceExportConditionConnected)
+			require.NotNil(t, cond)
+			require.Equal(t, tt.wantConnected, cond.Status)
+			if tt.wantConnected == corev1.ConditionFalse {
+				require.Equal(t, "ServiceBindingScopeMismatch", cond.Reason)
+			}
+		})
+	}
+}
+
+func TestReconcileServiceBindingConditionCopied(t *testing.T) {
+	transitioned := metav1.NewTime(time.Date(2022, time.October, 1, 12, 0, 0, 0, time.UTC))
+	binding := &kubebindv1alpha1.APIServiceBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+		Spec:       kubebindv1alpha1.APIServiceBindingSpec{Export: "mangodbs.mangodb.com"},
+		Status: kubebindv1alpha1.APIServiceBindingStatus{
+			Conditions: conditionsapi.Conditions{
+				{Type: conditionsapi.ReadyCondition, Status: corev1.ConditionTrue, LastTransitionTime: transitioned},
+				{Type: kubebindv1alpha1.APIServiceBindingConditionSchemaInSync, Status: corev1.ConditionTrue, LastTransitionTime: transitioned},
+			},
+		},
+	}
+	original := binding.DeepCopy()
+	r := &reconciler{
+		listServiceBinding: func(export string) ([]*kubebindv1alpha1.APIServiceBinding, error) {
+			return []*kubebindv1alpha1.APIServiceBinding{binding}, nil
+		},
+	}
+	export := &kubebindv1alpha1.APIServiceExport{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+	}
+	// a stale state from an earlier reconcile, before the binding became in sync.
+	conditions.MarkFalse(export, kubebindv1alpha1.APIServiceExportConditionSchemaInSync, "Unknown", conditionsapi.ConditionSeverityInfo, "not yet")
+
+	require.NoError(t, r.reconcile(context.Background(), export))
+	first := export.DeepCopy()
+	require.Equal(t, transitioned, conditions.Get(export, kubebindv1alpha1.APIServiceExportConditionServiceBindingReady).LastTransitionTime)
+	require.Equal(t, corev1.ConditionTrue, conditions.Get(export, kubebindv1alpha1.APIServiceExportConditionSchemaInSync).Status)
+
+	require.NoError(t, r.reconcile(context.Background(), export))
+	require.Equal(t, first.Status.Conditions, export.Status.Conditions, "conditions must not change when reconciling identical input")
+	require.Equal(t, original, binding, "binding conditions must not be modified")
+}
+
+func TestEnsureResourcesExistKeepsStatusOnError(t *testing.T) {
+	r := &reconciler{
+		getServiceExportResource: func(name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+			return nil, errors.New("connection refused")
+		},
+	}
+	known := kubebindv1alpha1.APIServiceExportResourceCRD{Resource: "mangodbs.mangodb.com", CRDName: "mangodbs.mangodb.com", ServedVersions: []string{"v1"}}
+	export := &kubebindv1alpha1.APIServiceExport{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+		Spec: kubebindv1alpha1.APIServiceExportSpec{
+			Resources: []kubebindv1alpha1.APIServiceExportGroupResource{{GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: "mangodbs"}}},
+		},
+		Status: kubebindv1alpha1.APIServiceExportStatus{
+			Resources: []kubebindv1alpha1.APIServiceExportResourceCRD{known},
+		},
+	}
+
+	require.Error(t, r.ensureResourcesExist(context.Background(), export))
+	require.Equal(t, []kubebindv1alpha1.APIServiceExportResourceCRD{known}, export.Status.Resources)
+}
+
+func TestEnsureResourcesExistStaleResource(t *testing.T) {
+	now := metav1.Now()
+	newResource := func() *kubebindv1alpha1.APIServiceExportResource {
+		return &kubebindv1alpha1.APIServiceExportResource{
+			ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+			Spec: kubebindv1alpha1.APIServiceExportResourceSpec{
+				Group:    "mangodb.com",
+				Names:    apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb", Kind: "MangoDB", ListKind: "MangoDBList"},
+				Scope:    apiextensionsv1.NamespaceScoped,
+				Versions: []kubebindv1alpha1.APIServiceExportResourceVersion{{Name: "v1", Served: true, Storage: true}},
+			},
+		}
+	}
+	deleting := newResource()
+	deleting.DeletionTimestamp = &now
+	deleting.Finalizers = []string{"example.com/cleanup"}
+
+	tests := []struct {
+		name       string
+		provider   *kubebindv1alpha1.APIServiceExportResource
+		wantReason string
+	}{
+		// the backend deleted the export resource of a deleted CRD, but the informer lags behind.
+		{name: "deleted", wantReason: "ServiceExportResourceNotFound"},
+		{name: "deleting", provider: deleting, wantReason: "ServiceExportResourceDeleting"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &reconciler{
+				getServiceExportResource: func(name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					return newResource(), nil
+				},
+				getProviderServiceExportResource: func(ctx context.Context, name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					if tt.provider == nil {
+						return nil, apierrors.NewNotFound(kubebindv1alpha1.Resource("apiserviceexportresources"), name)
+					}
+					return tt.provider, nil
+				},
+			}
+			export := &kubebindv1alpha1.APIServiceExport{
+				ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+				Spec: kubebindv1alpha1.APIServiceExportSpec{
+					Resources: []kubebindv1alpha1.APIServiceExportGroupResource{{GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: "mangodbs"}}},
+				},
+				Status: kubebindv1alpha1.APIServiceExportStatus{
+					Resources: []kubebindv1alpha1.APIServiceExportResourceCRD{{Resource: "mangodbs.mangodb.com", CRDName: "mangodbs.mangodb.com", ServedVersions: []string{"v1"}}},
+				},
+			}
+
+			require.NoError(t, r.ensureResourcesExist(context.Background(), export))
+
+			cond := conditions.Get(export, kubebindv1alpha1.APIServiceExportConditionResourcesValid)
+			require.NotNil(t, cond)
+			require.Equal(t, corev1.ConditionFalse, cond.Status)
+			require.Equal(t, tt.wantReason, cond.Reason)
+			require.Empty(t, export.Status.Resources, "a deleted resource must not be reported")
+		})
+	}
+}
+
+func TestEnsureResourcesExistInvalidResource(t *testing.T) {
+	resource := &kubebindv1alpha1.APIServiceExportResource{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+		Spec: kubebindv1alpha1.APIServiceExportResourceSpec{
+			Group:    "mangodb.com",
+			Names:    apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb", Kind: "MangoDB", ListKind: "MangoDBList", ShortNames: []string{"mangodb"}},
+			Scope:    apiextensionsv1.NamespaceScoped,
+			Versions: []kubebindv1alpha1.APIServiceExportResourceVersion{{Name: "v1", Served: true, Storage: true}},
+		},
+	}
+	r := &reconciler{
+		getServiceExportResource: func(name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+			return resource, nil
+		},
+	}
+	export := &kubebindv1alpha1.APIServiceExport{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+		Spec: kubebindv1alpha1.APIServiceExportSpec{
+			Resources: []kubebindv1alpha1.APIServiceExportGroupResource{{GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: "mangodbs"}}},
+		},
+	}
+
+	require.NoError(t, r.ensureResourcesExist(context.Background(), export))
+
+	cond := conditions.Get(export, kubebindv1alpha1.APIServiceExportConditionResourcesValid)
+	require.NotNil(t, cond)
+	require.Equal(t, corev1.ConditionFalse, cond.Status)
+	require.Equal(t, "ServiceExportResourceInvalid", cond.Reason)
+	require.Equal(t, `APIServiceExportResource mangodbs.mangodb.com on the service provider cluster is invalid: spec.names.shortNames[0]: Duplicate value: "mangodb"`, cond.Message)
+}
+
+func TestEnsureResourcesExistNameTooLong(t *testing.T) {
+	resource := &kubebindv1alpha1.APIServiceExportResource{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+		Spec: kubebindv1alpha1.APIServiceExportResourceSpec{
+			Group:           "mangodb.com",
+			Names:           apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb", Kind: "MangoDB", ListKind: "MangoDBList"},
+			Scope:           apiextensionsv1.NamespaceScoped,
+			Versions:        []kubebindv1alpha1.APIServiceExportResourceVersion{{Name: "v1", Served: true, Storage: true}},
+			ConsumerRewrite: &kubebindv1alpha1.APIServiceExportResourceRewrite{Group: strings.Repeat(strings.Repeat("a", 60)+".", 4) + "io"},
+		},
+	}
+	r := &reconciler{
+		getServiceExportResource: func(name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+			return resource, nil
+		},
+	}
+	export := &kubebindv1alpha1.APIServiceExport{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+		Spec: kubebindv1alpha1.APIServiceExportSpec{
+			Resources: []kubebindv1alpha1.APIServiceExportGroupResource{{GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: "mangodbs"}}},
+		},
+	}
+
+	require.NoError(t, r.ensureResourcesExist(context.Background(), export))
+
+	cond := conditions.Get(export, kubebindv1alpha1.APIServiceExportConditionResourcesValid)
+	require.NotNil(t, cond)
+	require.Equal(t, corev1.ConditionFalse, cond.Status)
+	require.Equal(t, "ServiceExportResourceNameTooLong", cond.Reason)
+	require.Contains(t, cond.Message, "the generated CustomResourceDefinition name has 255 characters, but must have at most 253")
+	require.Empty(t, export.Status.Resources)
+}
+
+func TestEnsureResourcesExistPinnedVersions(t *testing.T) {
+	resource := &kubebindv1alpha1.APIServiceExportResource{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+		Spec: kubebindv1alpha1.APIServiceExportResourceSpec{
+			Group:              "mangodb.com",
+			Names:              apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Singular: "mangodb", Kind: "MangoDB", ListKind: "MangoDBList"},
+			Scope:              apiextensionsv1.NamespaceScoped,
+			ConversionStrategy: apiextensionsv1.WebhookConverter,
+			StorageVersion:     "v1beta1",
+			Versions: []kubebindv1alpha1.APIServiceExportResourceVersion{
+				{Name: "v1", Served: true},
+				{Name: "v1beta1", Served: true, Storage: true, Deprecated: true},
+			},
+		},
+	}
+	r := &reconciler{
+		getServiceExportResource: func(name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+			return resource, nil
+		},
+	}
+	newExport := func(versions ...string) *kubebindv1alpha1.APIServiceExport {
+		return &kubebindv1alpha1.APIServiceExport{
+			ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+			Spec: kubebindv1alpha1.APIServiceExportSpec{
+				Resources: []kubebindv1alpha1.APIServiceExportGroupResource{{
+					GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: "mangodbs"},
+					Versions:      versions,
+				}},
+			},
+		}
+	}
+
+	t.Run("unpinned", func(t *testing.T) {
+		export := newExport()
+		require.NoError(t, r.ensureResourcesExist(context.Background(), export))
+		cond := conditions.Get(export, kubebindv1alpha1.APIServiceExportConditionResourcesValid)
+		require.NotNil(t, cond)
+		require.Equal(t, "ServiceExportResourceConversionUnsupported", cond.Reason)
+	})
+
+	t.Run("pinned to a single version", func(t *testing.T) {
+		export := newExport("v1")
+		require.NoError(t, r.ensureResourcesExist(context.Background(), export))
+		require.True(t, conditions.IsTrue(export, kubebindv1alpha1.APIServiceExportConditionResourcesValid))
+		require.Equal(t, []kubebindv1alpha1.APIServiceExportResourceCRD{{Resource: "mangodbs.mangodb.com", CRDName: "mangodbs.mangodb.com", ServedVersions: []string{"v1"}}}, export.Status.Resources)
+	})
+
+	t.Run("pinned to an unknown version", func(t *testing.T) {
+		export := newExport("v2")
+		require.NoError(t, r.ensureResourcesExist(context.Background(), export))
+		cond := conditions.Get(export, kubebindv1alpha1.APIServiceExportConditionResourcesValid)
+		require.NotNil(t, cond)
+		require.Equal(t, corev1.ConditionFalse, cond.Status)
+		require.Equal(t, "PinnedVersionNotServed", cond.Reason)
+		require.Empty(t, export.Status.Resources)
+	})
+}
+
+func TestReconcileNoResources(t *testing.T) {
+	r := &reconciler{
+		listServiceBinding: func(export string) ([]*kubebindv1alpha1.APIServiceBinding, error) {
+			return nil, nil
+		},
+		getServiceExportResource: func(name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+			t.Fatalf("unexpected APIServiceExportResource lookup of %s", name)
+			return nil, nil
+		},
+	}
+	export := &kubebindv1alpha1.APIServiceExport{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+		Status: kubebindv1alpha1.APIServiceExportStatus{
+			Resources: []kubebindv1alpha1.APIServiceExportResourceCRD{{Resource: "mangodbs.mangodb.com", CRDName: "mangodbs.mangodb.com"}},
+		},
+	}
+
+	require.NoError(t, r.reconcile(context.Background(), export))
+
+	cond := conditions.Get(export, kubebindv1alpha1.APIServiceExportConditionResourcesValid)
+	require.NotNil(t, cond)
+	require.Equal(t, corev1.ConditionFalse, cond.Status)
+	require.Equal(t, "NoResources", cond.Reason)
+	require.Equal(t, conditionsapi.ConditionSeverityWarning, cond.Severity)
+	require.Empty(t, export.Status.Resources)
+	require.False(t, conditions.IsTrue(export, conditionsapi.ReadyCondition))
+}
+
+func TestReconcileSchemaInSync(t *testing.T) {
+	resource := &kubebindv1alpha1.APIServiceExportResource{
+		ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+		Spec: kubebindv1alpha1.APIServiceExportResourceSpec{
+			Group: "mangodb.com",
+			Names: apiextensionsv1.CustomResourceDefinitionNames{Plural: "mangodbs", Kind: "MangoDB"},
+			Scope: apiextensionsv1.NamespaceScoped,
+			Versions: []kubebindv1alpha1.APIServiceExportResourceVersion{{
+				Name:    "v1",
+				Served:  true,
+				Storage: true,
+				Schema:  kubebindv1alpha1.APIServiceExportResourceSchema{OpenAPIV3Schema: runtime.RawExtension{Raw: []byte(`{"type":"object"}`)}},
+			}},
+		},
+	}
+	applied, err := helpers.ServiceExportResourceToCRD(resource, nil)
+	require.NoError(t, err)
+	// the API server defaults singular, list kind and conversion.
+	apiextensionsv1.SetObjectDefaults_CustomResourceDefinition(applied)
+
+	tests := []struct {
+		name        string
+		noBinding   bool
+		selected    []kubebindv1alpha1.GroupResource
+		bindingSync corev1.ConditionStatus
+		live        func(crd *apiextensionsv1.CustomResourceDefinition) *apiextensionsv1.CustomResourceDefinition
+		wantStatus  corev1.ConditionStatus
+		wantReason  string
+		wantMessage string
+	}{
+		{name: "in sync", bindingSync: corev1.ConditionTrue, wantStatus: corev1.ConditionTrue},
+		{name: "in sync without binding", noBinding: true, wantStatus: corev1.ConditionTrue},
+		{name: "binding out of sync", bindingSync: corev1.ConditionFalse, wantStatus: corev1.ConditionFalse},
+		{
+			name:        "schema changed",
+			bindingSync: corev1.ConditionTrue,
+			live: func(crd *apiextensionsv1.CustomResourceDefinition) *apiextensionsv1.CustomResourceDefinition {
+				crd.Spec.Versions[0].Schema.OpenAPIV3Schema.XPreserveUnknownFields = pointer.Bool(true)
+				return crd
+			},
+			wantStatus:  corev1.ConditionFalse,
+			wantReason:  "CustomResourceDefinitionOutOfSync",
+			wantMessage: "mangodbs.mangodb.com differs in version v1 schema",
+		},
+		{
+			name:      "additional version without binding",
+			noBinding: true,
+			live: func(crd *apiextensionsv1.CustomResourceDefinition) *apiextensionsv1.CustomResourceDefinition {
+				v := crd.Spec.Versions[0].DeepCopy()
+				v.Name, v.Storage = "v2", false
+				crd.Spec.Versions = append(crd.Spec.Versions, *v)
+				return crd
+			},
+			wantStatus:  corev1.ConditionFalse,
+			wantReason:  "CustomResourceDefinitionOutOfSync",
+			wantMessage: "additional version v2",
+		},
+		{
+			name:        "missing",
+			bindingSync: corev1.ConditionTrue,
+			live: func(crd *apiextensionsv1.CustomResourceDefinition) *apiextensionsv1.CustomResourceDefinition {
+				return nil
+			},
+			wantStatus:  corev1.ConditionFalse,
+			wantReason:  "CustomResourceDefinitionMissing",
+			wantMessage: "mangodbs.mangodb.com",
+		},
+		{
+			name:        "missing but not selected",
+			selected:    []kubebindv1alpha1.GroupResource{{Group: "redis.io", Resource: "caches"}},
+			bindingSync: corev1.ConditionTrue,
+			live: func(crd *apiextensionsv1.CustomResourceDefinition) *apiextensionsv1.CustomResourceDefinition {
+				return nil
+			},
+			wantStatus: corev1.ConditionTrue,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			live := applied.DeepCopy()
+			if tt.live != nil {
+				live = tt.live(live)
+			}
+			var bindings []*kubebindv1alpha1.APIServiceBinding
+			if !tt.noBinding {
+				bindings = append(bindings, &kubebindv1alpha1.APIServiceBinding{
+					ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+					Spec:       kubebindv1alpha1.APIServiceBindingSpec{Export: "mangodbs.mangodb.com", Resources: tt.selected},
+					Status: kubebindv1alpha1.APIServiceBindingStatus{
+						Conditions: conditionsapi.Conditions{
+							{Type: kubebindv1alpha1.APIServiceBindingConditionSchemaInSync, Status: tt.bindingSync, Reason: "FromBinding"},
+						},
+					},
+				})
+			}
+			r := &reconciler{
+				listServiceBinding: func(export string) ([]*kubebindv1alpha1.APIServiceBinding, error) {
+					return bindings, nil
+				},
+				getServiceExportResource: func(name string) (*kubebindv1alpha1.APIServiceExportResource, error) {
+					return resource, nil
+				},
+				getCRD: func(name string) (*apiextensionsv1.CustomResourceDefinition, error) {
+					if live == nil {
+						return nil, apierrors.NewNotFound(apiextensionsv1.Resource("customresourcedefinitions"), name)
+					}
+					return live, nil
+				},
+			}
+			export := &kubebindv1alpha1.APIServiceExport{
+				ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+				Spec: kubebindv1alpha1.APIServiceExportSpec{
+					Resources: []kubebindv1alpha1.APIServiceExportGroupResource{{GroupResource: kubebindv1alpha1.GroupResource{Group: "mangodb.com", Resource: "mangodbs"}}},
+				},
+			}
+
+			require.NoError(t, r.reconcile(context.Background(), export))
+
+			cond := conditions.Get(export, kubebindv1alpha1.APIServiceExportConditionSchemaInSync)
+			require.NotNil(t, cond)
+			require.Equal(t, tt.wantStatus, cond.Status)
+			if tt.wantReason != "" {
+				require.Equal(t, tt.wantReason, cond.Reason)
+				require.Contains(t, cond.Message, tt.wantMessage)
+			}
+		})
+	}
+}
@@ -21,18 +21,23 @@ import (
 	"fmt"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apiextensionslisters "k8s.io/apiextensions-apiserver/pkg/client/listers/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	kubernetesclient "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 
 	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+	kubebindhelpers "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1/helpers"
 	bindclient "github.com/kube-bind/kube-bind/pkg/client/clientset/versioned"
 	bindinformers "github.com/kube-bind/kube-bind/pkg/client/informers/externalversions/kubebind/v1alpha1"
 	bindlisters "github.com/kube-bind/kube-bind/pkg/client/listers/kubebind/v1alpha1"
@@ -69,6 +74,10 @@ func NewController(
 	if err != nil {
 		return nil, err
 	}
+	consumerClient, err := kubernetesclient.NewForConfig(consumerConfig)
+	if err != nil {
+		return nil, err
+	}
 
 	dynamicServiceNamespaceInformer := dynamic.NewDynamicInformer[bindlisters.APIServiceNamespaceLister](serviceNamespaceInformer)
 	c := &controller{
@@ -98,6 +107,22 @@ func NewController(
 			getServiceBinding: func(name string) (*kubebindv1alpha1.APIServiceBinding, error) {
 				return serviceBindingInformer.Lister().Get(name)
 			},
+			listServiceBindings: func() ([]*kubebindv1alpha1.APIServiceBinding, error) {
+				bindings, err := serviceBindingInformer.Lister().List(labels.Everything())
+				if err != nil {
+					return nil, err
+				}
+				var ours []*kubebindv1alpha1.APIServiceBinding
+				for _, binding := range bindings {
+					if indexers.ByServiceBindingKubeconfigSecretKey(binding) == consumerSecretRefKey {
+						ours = append(ours, binding)
+					}
+				}
+				return ours, nil
+			},
+			createConsumerNamespace: func(ctx context.Context, ns *corev1.Namespace) (*corev1.Namespace, error) {
+				return consumerClient.CoreV1().Namespaces().Create(ctx, ns, metav1.CreateOptions{})
+			},
 		},
 
 		commit: committer.NewCommitter[*kubebindv1alpha1.APIServiceExportResource, *kubebindv1alpha1.APIServiceExportResourceSpec, *kubebindv1alpha1.APIServiceExportResourceStatus](
@@ -174,26 +199,30 @@ func (c *controller) enqueueServiceBinding(logger klog.Logger, obj interface{})
 		return
 	}
 
-	for _, crd := range crds {
-		key, err := cache.MetaNamespaceKeyFunc(crd)
-		if err != nil {
-			runtime.HandleError(err)
+	for _, obj := range crds {
+		crd, ok := obj.(*apiextensionsv1.CustomResourceDefinition)
+		if !ok {
+			runtime.HandleError(fmt.Errorf("unexpected type %T", obj))
 			continue
 		}
+		key := c.providerNamespace + "/" + kubebindhelpers.ServiceExportResourceName(crd)
 		logger.V(2).Info("queueing APIServiceExportResource", "key", key, "reason", "APIServiceBinding", "ServiceBindingKey", binding.Name)
 		c.queue.Add(key)
 	}
 }
 
 func (c *controller) enqueueCRD(logger klog.Logger, obj interface{}) {
-	crdKey, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
-	if err != nil {
-		runtime.HandleError(err)
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	crd, ok := obj.(*apiextensionsv1.CustomResourceDefinition)
+	if !ok {
+		runtime.HandleError(fmt.Errorf("unexpected type %T", obj))
 		return
 	}
-
-	key := c.providerNamespace + "/" + crdKey
-	logger.V(2).Info("queueing APIServiceExportResource", "key", key, "reason", "APIServiceExportResource", "ServiceExportResourceKey", crdKey)
+	// the resource is named differently than the CRD if rewritten.
+	key := c.providerNamespace + "/" + kubebindhelpers.ServiceExportResourceName(crd)
+	logger.V(2).Info("queueing APIServiceExportResource", "key", key, "reason", "CustomResourceDefinition", "CustomResourceDefinitionKey", crd.Name)
 	c.queue.Add(key)
 }
 
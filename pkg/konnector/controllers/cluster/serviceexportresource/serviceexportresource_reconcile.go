@@ -18,21 +18,26 @@ package serviceexportresource
 
 import (
 	"context"
+	"fmt"
 	"strings"
 	"sync"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtimeschema "k8s.io/apimachinery/pkg/runtime/schema"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	dynamicclient "k8s.io/client-go/dynamic"
 	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
 
 	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+	kubebindhelpers "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1/helpers"
 	conditionsapi "github.com/kube-bind/kube-bind/pkg/apis/third_party/conditions/apis/conditions/v1alpha1"
 	"github.com/kube-bind/kube-bind/pkg/apis/third_party/conditions/util/conditions"
 	bindlisters "github.com/kube-bind/kube-bind/pkg/client/listers/kubebind/v1alpha1"
@@ -52,13 +57,18 @@ type reconciler struct {
 	lock        sync.Mutex
 	syncContext map[string]syncContext // by CRD name
 
-	getCRD            func(name string) (*apiextensionsv1.CustomResourceDefinition, error)
-	getServiceBinding func(name string) (*kubebindv1alpha1.APIServiceBinding, error)
+	getCRD              func(name string) (*apiextensionsv1.CustomResourceDefinition, error)
+	getServiceBinding   func(name string) (*kubebindv1alpha1.APIServiceBinding, error)
+	listServiceBindings func() ([]*kubebindv1alpha1.APIServiceBinding, error)
+
+	createConsumerNamespace func(ctx context.Context, ns *corev1.Namespace) (*corev1.Namespace, error)
 }
 
 type syncContext struct {
 	generation int64
-	cancel     func()
+	// crdName is the consumer CRD synced into, which changes with the binding.
+	crdName string
+	cancel  func()
 }
 
 func (r *reconciler) reconcile(ctx context.Context, name string, resource *kubebindv1alpha1.APIServiceExportResource) error {
@@ -77,10 +87,41 @@ func (r *reconciler) reconcile(ctx context.Context, name string, resource *kubeb
 	}
 
 	var errs []error
-	crd, err := r.getCRD(resource.Name)
-	if err != nil && !errors.IsNotFound(err) {
+
+	// the consumer CRD name depends on the group suffix of the binding, hence look for
+	// the CRD of every binding of this service provider.
+	bindings, err := r.listServiceBindings()
+	if err != nil {
 		return err
-	} else if errors.IsNotFound(err) {
+	}
+	suffixes := sets.NewString("")
+	for _, binding := range bindings {
+		suffixes.Insert(binding.Spec.ConsumerGroupSuffix)
+	}
+	var crd *apiextensionsv1.CustomResourceDefinition
+	consumerResource, foundCRD := resource, false
+	for _, suffix := range suffixes.List() {
+		candidate := kubebindhelpers.WithConsumerGroupSuffix(resource, suffix)
+		existing, err := r.getCRD(kubebindhelpers.ConsumerCRDName(candidate))
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		} else if errors.IsNotFound(err) {
+			continue
+		}
+		foundCRD = true
+
+		// any binding that references this CRD?
+		owned, err := r.ownedByServiceBinding(existing, suffix)
+		if err != nil {
+			return err
+		}
+		if owned {
+			crd, consumerResource = existing, candidate
+			break
+		}
+	}
+
+	if !foundCRD {
 		// stop it
 		r.lock.Lock()
 		defer r.lock.Unlock()
@@ -101,27 +142,7 @@ func (r *reconciler) reconcile(ctx context.Context, name string, resource *kubeb
 		return nil
 	}
 
-	// any binding that references this CRD?
-	foundBinding := false
-	for _, ref := range crd.OwnerReferences {
-		parts := strings.SplitN(ref.APIVersion, "/", 2)
-		if parts[0] != kubebindv1alpha1.SchemeGroupVersion.Group || ref.Kind != "APIServiceBinding" {
-			continue
-		}
-		binding, err := r.getServiceBinding(ref.Name)
-		if err != nil && !errors.IsNotFound(err) {
-			return err
-		} else if err != nil {
-			continue
-		}
-
-		if binding.Spec.KubeconfigSecretRef.Namespace+"/"+binding.Spec.KubeconfigSecretRef.Name == r.consumerSecretRefKey {
-			foundBinding = true
-			break
-		}
-	}
-
-	if !foundBinding {
+	if crd == nil {
 		// stop it
 		r.lock.Lock()
 		defer r.lock.Unlock()
@@ -145,7 +166,7 @@ func (r *reconciler) reconcile(ctx context.Context, name string, resource *kubeb
 	r.lock.Lock()
 	c, found := r.syncContext[resource.Name]
 	if found {
-		if c.generation == resource.Generation {
+		if c.generation == resource.Generation && c.crdName == crd.Name {
 			r.lock.Unlock()
 			conditions.MarkTrue(resource, kubebindv1alpha1.APIServiceExportResourrceConditionSyncing)
 			return nil // all as expected
@@ -154,7 +175,7 @@ func (r *reconciler) reconcile(ctx context.Context, name string, resource *kubeb
 		// technically, we could be less aggressive here if nothing big changed in the resource, e.g. just schemas. But ¯\_(ツ)_/¯
 
 		if c, found := r.syncContext[resource.Name]; found {
-			logger.V(1).Info("Stopping APIServiceExportResource sync", "reason", "GenerationChanged", "generation", resource.Generation)
+			logger.V(1).Info("Stopping APIServiceExportResource sync", "reason", "GenerationChanged", "generation", resource.Generation, "crd", crd.Name)
 			c.cancel()
 			delete(r.syncContext, resource.Name)
 		}
@@ -163,6 +184,12 @@ func (r *reconciler) reconcile(ctx context.Context, name string, resource *kubeb
 
 	// start a new syncer
 
+	if ns := resource.Spec.ConsumerNamespace; ns != "" {
+		if _, err := r.createConsumerNamespace(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}}); err != nil && !errors.IsAlreadyExists(err) {
+			return fmt.Errorf("failed to create consumer namespace %q: %w", ns, err)
+		}
+	}
+
 	var syncVersion string
 	for _, v := range resource.Spec.Versions {
 		if v.Served {
@@ -170,7 +197,11 @@ func (r *reconciler) reconcile(ctx context.Context, name string, resource *kubeb
 			break
 		}
 	}
-	gvr := runtimeschema.GroupVersionResource{Group: resource.Spec.Group, Version: syncVersion, Resource: resource.Spec.Names.Plural}
+	// the group and names differ on the consumer cluster if the resource is rewritten.
+	providerGVR := runtimeschema.GroupVersionResource{Group: resource.Spec.Group, Version: syncVersion, Resource: resource.Spec.Names.Plural}
+	providerGVK := runtimeschema.GroupVersionKind{Group: resource.Spec.Group, Version: syncVersion, Kind: resource.Spec.Names.Kind}
+	consumerGroup, consumerNames := kubebindhelpers.ConsumerGroupNames(consumerResource)
+	consumerGVR := runtimeschema.GroupVersionResource{Group: consumerGroup, Version: syncVersion, Resource: consumerNames.Plural}
 
 	dynamicConsumerClient := dynamicclient.NewForConfigOrDie(r.consumerConfig)
 	dynamicProviderClient := dynamicclient.NewForConfigOrDie(r.providerConfig)
@@ -178,12 +209,15 @@ func (r *reconciler) reconcile(ctx context.Context, name string, resource *kubeb
 	providerInf := dynamicinformer.NewDynamicSharedInformerFactory(dynamicProviderClient, time.Minute*30)
 
 	specCtrl, err := spec.NewController(
-		gvr,
+		consumerGVR,
+		providerGVR,
+		providerGVK,
 		r.providerNamespace,
+		resource.Spec.ConsumerNamespace,
 		r.consumerConfig,
 		r.providerConfig,
-		consumerInf.ForResource(gvr),
-		providerInf.ForResource(gvr),
+		consumerInf.ForResource(consumerGVR),
+		providerInf.ForResource(providerGVR),
 		r.serviceNamespaceInformer,
 	)
 	if err != nil {
@@ -191,12 +225,13 @@ func (r *reconciler) reconcile(ctx context.Context, name string, resource *kubeb
 		return nil // nothing we can do here
 	}
 	statusCtrl, err := status.NewController(
-		gvr,
+		consumerGVR,
+		providerGVR,
 		r.providerNamespace,
 		r.consumerConfig,
 		r.providerConfig,
-		consumerInf.ForResource(gvr),
-		providerInf.ForResource(gvr),
+		consumerInf.ForResource(consumerGVR),
+		providerInf.ForResource(providerGVR),
 		r.serviceNamespaceInformer,
 	)
 	if err != nil {
@@ -224,6 +259,7 @@ func (r *reconciler) reconcile(ctx context.Context, name string, resource *kubeb
 	defer r.lock.Unlock()
 	r.syncContext[resource.Name] = syncContext{
 		generation: resource.Generation,
+		crdName:    crd.Name,
 		cancel:     cancel,
 	}
 
@@ -231,3 +267,25 @@ func (r *reconciler) reconcile(ctx context.Context, name string, resource *kubeb
 
 	return utilerrors.NewAggregate(errs)
 }
+
+// ownedByServiceBinding returns true if a binding of this service provider with the
+// given group suffix references the CRD.
+func (r *reconciler) ownedByServiceBinding(crd *apiextensionsv1.CustomResourceDefinition, suffix string) (bool, error) {
+	for _, ref := range crd.OwnerReferences {
+		parts := strings.SplitN(ref.APIVersion, "/", 2)
+		if parts[0] != kubebindv1alpha1.SchemeGroupVersion.Group || ref.Kind != "APIServiceBinding" {
+			continue
+		}
+		binding, err := r.getServiceBinding(ref.Name)
+		if err != nil && !errors.IsNotFound(err) {
+			return false, err
+		} else if err != nil {
+			continue
+		}
+
+		if binding.Spec.KubeconfigSecretRef.Namespace+"/"+binding.Spec.KubeconfigSecretRef.Name == r.consumerSecretRefKey && binding.Spec.ConsumerGroupSuffix == suffix {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -52,9 +52,12 @@ const (
 )
 
 // NewController returns a new controller reconciling downstream objects to upstream.
+// The resource is served as consumerGVR on the consumer cluster and as providerGVK and
+// providerGVR on the provider cluster, which differ if the resource is rewritten.
 func NewController(
-	gvr schema.GroupVersionResource,
-	providerNamespace string,
+	consumerGVR, providerGVR schema.GroupVersionResource,
+	providerGVK schema.GroupVersionKind,
+	providerNamespace, consumerNamespace string,
 	consumerConfig, providerConfig *rest.Config,
 	consumerDynamicInformer, providerDynamicInformer informers.GenericInformer,
 	serviceNamespaceInformer dynamic.Informer[bindlisters.APIServiceNamespaceLister],
@@ -79,8 +82,8 @@ func NewController(
 		return nil, err
 	}
 
-	dynamicConsumerLister := dynamiclister.New(consumerDynamicInformer.Informer().GetIndexer(), gvr)
-	dynamicProviderLister := dynamiclister.New(providerDynamicInformer.Informer().GetIndexer(), gvr)
+	dynamicConsumerLister := dynamiclister.New(consumerDynamicInformer.Informer().GetIndexer(), consumerGVR)
+	dynamicProviderLister := dynamiclister.New(providerDynamicInformer.Informer().GetIndexer(), providerGVR)
 	c := &controller{
 		queue: queue,
 
@@ -97,6 +100,8 @@ func NewController(
 
 		reconciler: reconciler{
 			providerNamespace: providerNamespace,
+			consumerNamespace: consumerNamespace,
+			providerGVK:       providerGVK,
 			getServiceNamespace: func(name string) (*kubebindv1alpha1.APIServiceNamespace, error) {
 				return serviceNamespaceInformer.Lister().APIServiceNamespaces(providerNamespace).Get(name)
 			},
@@ -107,22 +112,22 @@ func NewController(
 				return dynamicProviderLister.Namespace(ns).Get(name)
 			},
 			createProviderObject: func(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
-				return providerClient.Resource(gvr).Namespace(obj.GetNamespace()).Create(ctx, obj, metav1.CreateOptions{})
+				return providerClient.Resource(providerGVR).Namespace(obj.GetNamespace()).Create(ctx, obj, metav1.CreateOptions{})
 			},
 			updateProviderObject: func(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
 				data, err := json.Marshal(obj.Object)
 				if err != nil {
 					return nil, err
 				}
-				return providerClient.Resource(gvr).Namespace(obj.GetNamespace()).Patch(ctx,
+				return providerClient.Resource(providerGVR).Namespace(obj.GetNamespace()).Patch(ctx,
 					obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{FieldManager: applyManager, Force: pointer.Bool(true)},
 				)
 			},
 			deleteProviderObject: func(ctx context.Context, ns, name string) error {
-				return providerClient.Resource(gvr).Namespace(ns).Delete(ctx, name, metav1.DeleteOptions{})
+				return providerClient.Resource(providerGVR).Namespace(ns).Delete(ctx, name, metav1.DeleteOptions{})
 			},
 			updateConsumerObject: func(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
-				return consumerClient.Resource(gvr).Namespace(obj.GetNamespace()).Update(ctx, obj, metav1.UpdateOptions{})
+				return consumerClient.Resource(consumerGVR).Namespace(obj.GetNamespace()).Update(ctx, obj, metav1.UpdateOptions{})
 			},
 			requeue: func(obj *unstructured.Unstructured, after time.Duration) error {
 				key, err := cache.MetaNamespaceKeyFunc(obj)
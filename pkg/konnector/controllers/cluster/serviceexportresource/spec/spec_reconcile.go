@@ -26,6 +26,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/klog/v2"
 
 	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
@@ -33,6 +34,11 @@ import (
 
 type reconciler struct {
 	providerNamespace string
+	// consumerNamespace restricts syncing to objects in this namespace if non-empty.
+	consumerNamespace string
+	// providerGVK is the kind of upstream objects, which differs from the downstream
+	// one if the resource is rewritten.
+	providerGVK schema.GroupVersionKind
 
 	getServiceNamespace    func(name string) (*kubebindv1alpha1.APIServiceNamespace, error)
 	createServiceNamespace func(ctx context.Context, sn *kubebindv1alpha1.APIServiceNamespace) (*kubebindv1alpha1.APIServiceNamespace, error)
@@ -52,6 +58,16 @@ func (r *reconciler) reconcile(ctx context.Context, obj *unstructured.Unstructur
 	logger := klog.FromContext(ctx)
 
 	ns := obj.GetNamespace()
+	if r.consumerNamespace != "" && ns != r.consumerNamespace {
+		logger.V(2).Info("object is not in the consumer namespace, don't sync", "consumerNamespace", r.consumerNamespace)
+		if obj.GetDeletionTimestamp() != nil && !obj.GetDeletionTimestamp().IsZero() {
+			// synced before the consumer namespace was set.
+			if _, err := r.removeDownstreamFinalizer(ctx, obj); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 	if ns != "" {
 		sn, err := r.getServiceNamespace(ns)
 		if err != nil && !errors.IsNotFound(err) {
@@ -103,6 +119,7 @@ func (r *reconciler) reconcile(ctx context.Context, obj *unstructured.Unstructur
 		upstream = obj.DeepCopy()
 		upstream.SetUID("")
 		upstream.SetResourceVersion("")
+		upstream.SetGroupVersionKind(r.providerGVK)
 		upstream.SetNamespace(ns)
 		upstream.SetManagedFields(nil)
 		upstream.SetDeletionTimestamp(nil)
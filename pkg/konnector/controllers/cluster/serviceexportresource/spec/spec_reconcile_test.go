@@ -0,0 +1,104 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package spec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+)
+
+func TestReconcileConsumerNamespace(t *testing.T) {
+	gr := schema.GroupResource{Group: "mangodb.com", Resource: "mangodbs"}
+	providerGVK := schema.GroupVersionKind{Group: "mangodb.com", Version: "v1alpha1", Kind: "MangoDB"}
+	newObj := func(ns string) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{}
+		obj.SetAPIVersion("mangodb.com/v1alpha1")
+		obj.SetKind("MangoDB")
+		obj.SetNamespace(ns)
+		obj.SetName("tenant")
+		require.NoError(t, unstructured.SetNestedField(obj.Object, "small", "spec", "tier"))
+		return obj
+	}
+
+	tests := []struct {
+		name              string
+		consumerNamespace string
+		objNamespace      string
+		providerGVK       *schema.GroupVersionKind
+		wantUpstream      string
+	}{
+		{name: "no consumer namespace", objNamespace: "default", wantUpstream: "cluster-abc-default"},
+		{name: "in consumer namespace", consumerNamespace: "databases", objNamespace: "databases", wantUpstream: "cluster-abc-databases"},
+		{name: "outside consumer namespace", consumerNamespace: "databases", objNamespace: "default"},
+		{name: "consumer rewrite", objNamespace: "default", wantUpstream: "cluster-abc-default",
+			providerGVK: &schema.GroupVersionKind{Group: "mangodb.io", Version: "v1alpha1", Kind: "MangoDatabase"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created []*unstructured.Unstructured
+			wantGVK := providerGVK
+			if tt.providerGVK != nil {
+				wantGVK = *tt.providerGVK
+			}
+			r := reconciler{
+				providerNamespace: "cluster-abc",
+				consumerNamespace: tt.consumerNamespace,
+				providerGVK:       wantGVK,
+				getServiceNamespace: func(name string) (*kubebindv1alpha1.APIServiceNamespace, error) {
+					return &kubebindv1alpha1.APIServiceNamespace{
+						ObjectMeta: metav1.ObjectMeta{Namespace: "cluster-abc", Name: name},
+						Status:     kubebindv1alpha1.APIServiceNamespaceStatus{Namespace: "cluster-abc-" + name},
+					}, nil
+				},
+				getProviderObject: func(ns, name string) (*unstructured.Unstructured, error) {
+					return nil, errors.NewNotFound(gr, name)
+				},
+				createProviderObject: func(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+					created = append(created, obj)
+					return obj, nil
+				},
+				updateConsumerObject: func(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+					return obj, nil
+				},
+				requeue: func(obj *unstructured.Unstructured, after time.Duration) error {
+					return nil
+				},
+			}
+
+			require.NoError(t, r.reconcile(context.Background(), newObj(tt.objNamespace)))
+			if tt.wantUpstream == "" {
+				require.Empty(t, created)
+				return
+			}
+			require.Len(t, created, 1)
+			require.Equal(t, tt.wantUpstream, created[0].GetNamespace())
+			require.Equal(t, "tenant", created[0].GetName())
+			require.Equal(t, wantGVK, created[0].GroupVersionKind())
+		})
+	}
+}
@@ -46,8 +46,10 @@ const (
 )
 
 // NewController returns a new controller reconciling status of upstream to downstream.
+// The resource is served as consumerGVR on the consumer cluster and as providerGVR on the
+// provider cluster, which differ if the resource is rewritten.
 func NewController(
-	gvr schema.GroupVersionResource,
+	consumerGVR, providerGVR schema.GroupVersionResource,
 	providerNamespace string,
 	consumerConfig, providerConfig *rest.Config,
 	consumerDynamicInformer, providerDynamicInformer informers.GenericInformer,
@@ -72,12 +74,12 @@ func NewController(
 		return nil, err
 	}
 
-	dynamicConsumerLister := dynamiclister.New(consumerDynamicInformer.Informer().GetIndexer(), gvr)
-	dynamicProviderLister := dynamiclister.New(providerDynamicInformer.Informer().GetIndexer(), gvr)
+	dynamicConsumerLister := dynamiclister.New(consumerDynamicInformer.Informer().GetIndexer(), consumerGVR)
+	dynamicProviderLister := dynamiclister.New(providerDynamicInformer.Informer().GetIndexer(), providerGVR)
 	c := &controller{
 		queue: queue,
 
-		gvr:               gvr,
+		consumerGVR:       consumerGVR,
 		providerNamespace: providerNamespace,
 
 		consumerClient: consumerClient,
@@ -106,10 +108,10 @@ func NewController(
 				return dynamicConsumerLister.Namespace(ns).Get(name)
 			},
 			updateConsumerObjectStatus: func(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
-				return consumerClient.Resource(gvr).Namespace(obj.GetNamespace()).UpdateStatus(ctx, obj, metav1.UpdateOptions{})
+				return consumerClient.Resource(consumerGVR).Namespace(obj.GetNamespace()).UpdateStatus(ctx, obj, metav1.UpdateOptions{})
 			},
 			deleteProviderObject: func(ctx context.Context, ns, name string) error {
-				return providerClient.Resource(gvr).Namespace(ns).Delete(ctx, name, metav1.DeleteOptions{})
+				return providerClient.Resource(providerGVR).Namespace(ns).Delete(ctx, name, metav1.DeleteOptions{})
 			},
 		},
 	}
@@ -145,7 +147,7 @@ func NewController(
 type controller struct {
 	queue workqueue.RateLimitingInterface
 
-	gvr               schema.GroupVersionResource
+	consumerGVR       schema.GroupVersionResource
 	providerNamespace string
 
 	consumerClient, providerClient dynamicclient.Interface
@@ -371,7 +373,7 @@ func (c *controller) removeDownstreamFinalizer(ctx context.Context, obj *unstruc
 		obj = obj.DeepCopy()
 		obj.SetFinalizers(finalizers)
 		var err error
-		if obj, err = c.consumerClient.Resource(c.gvr).Namespace(obj.GetNamespace()).Update(ctx, obj, metav1.UpdateOptions{}); err != nil && !errors.IsNotFound(err) {
+		if obj, err = c.consumerClient.Resource(c.consumerGVR).Namespace(obj.GetNamespace()).Update(ctx, obj, metav1.UpdateOptions{}); err != nil && !errors.IsNotFound(err) {
 			return nil, err
 		}
 	}
@@ -0,0 +1,111 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package crdcleanup
+
+import (
+	"context"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+	"github.com/kube-bind/kube-bind/pkg/indexers"
+)
+
+// Client deletes and updates CustomResourceDefinitions during clean-up.
+type Client struct {
+	UpdateCRD func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) (*apiextensionsv1.CustomResourceDefinition, error)
+	DeleteCRD func(ctx context.Context, name string) error
+
+	// HasObjects returns true if objects of the CRD exist. CRDs with objects are
+	// orphaned instead of deleted. Nil deletes CRDs regardless.
+	HasObjects func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) (bool, error)
+}
+
+// ListByServiceBinding returns the CustomResourceDefinitions owned by the named
+// APIServiceBinding, using the indexers.CRDByServiceBinding index.
+func ListByServiceBinding(indexer cache.Indexer, bindingName string) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+	objs, err := indexer.ByIndex(indexers.CRDByServiceBinding, bindingName)
+	if err != nil {
+		return nil, err
+	}
+	crds := make([]*apiextensionsv1.CustomResourceDefinition, 0, len(objs))
+	for _, obj := range objs {
+		crds = append(crds, obj.(*apiextensionsv1.CustomResourceDefinition))
+	}
+	return crds, nil
+}
+
+// CleanUp deletes or orphans, according to the binding policy, the given CRDs owned
+// by the binding. CRDs shared with other bindings are only orphaned by dropping the
+// owner reference of the binding, keeping them from the garbage collector.
+func CleanUp(ctx context.Context, client Client, binding *kubebindv1alpha1.APIServiceBinding, crds []*apiextensionsv1.CustomResourceDefinition) error {
+	logger := klog.FromContext(ctx)
+
+	var errs []error
+	for _, crd := range crds {
+		var owners []metav1.OwnerReference
+		foundThis, foundOther := false, false
+		for _, ref := range crd.OwnerReferences {
+			parts := strings.SplitN(ref.APIVersion, "/", 2)
+			if parts[0] == kubebindv1alpha1.SchemeGroupVersion.Group && ref.Kind == "APIServiceBinding" {
+				if ref.Name == binding.Name {
+					foundThis = true
+					continue
+				}
+				foundOther = true
+			}
+			owners = append(owners, ref)
+		}
+		if !foundThis {
+			continue
+		}
+
+		if binding.Spec.CRDDeletionPolicy != kubebindv1alpha1.CRDDeletionPolicyOrphan && !foundOther {
+			inUse := false
+			if client.HasObjects != nil {
+				var err error
+				if inUse, err = client.HasObjects(ctx, crd); err != nil {
+					errs = append(errs, err)
+					continue
+				}
+			}
+			if !inUse {
+				logger.V(1).Info("Deleting CustomResourceDefinition", "crd", crd.Name, "binding", binding.Name)
+				if err := client.DeleteCRD(ctx, crd.Name); err != nil && !errors.IsNotFound(err) {
+					errs = append(errs, err)
+				}
+				continue
+			}
+			logger.Info("Keeping CustomResourceDefinition because it still has objects", "crd", crd.Name, "binding", binding.Name)
+		}
+
+		logger.V(1).Info("Orphaning CustomResourceDefinition", "crd", crd.Name, "binding", binding.Name)
+		crd = crd.DeepCopy()
+		crd.OwnerReferences = owners
+		if _, err := client.UpdateCRD(ctx, crd); err != nil && !errors.IsNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,145 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package servicebinding
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+)
+
+// backendProbeTimeout is the timeout of a single probe of a backend.
+const backendProbeTimeout = 10 * time.Second
+
+// backendProbeRetention is the number of probe intervals the result of a URL is kept
+// without being asked for. Bindings are requeued every interval, hence URLs that are
+// not asked for anymore are not referenced by any binding.
+const backendProbeRetention = 3
+
+// backendProber probes the /export endpoints of service provider backends in the
+// background. Every URL is probed at most once per interval, such that bindings of the
+// same backend and frequent reconciles do not multiply the requests. In between, the
+// last result is returned.
+type backendProber struct {
+	client   *http.Client
+	interval time.Duration
+	now      func() time.Time
+	// probed is called with the URL when a probe has finished.
+	probed func(url string)
+
+	lock    sync.Mutex
+	results map[string]backendProbeResult
+	probing sets.String
+}
+
+type backendProbeResult struct {
+	time time.Time
+	// requested is the last time the result was asked for.
+	requested time.Time
+	err       error
+}
+
+func newBackendProber(interval time.Duration, probed func(url string)) *backendProber {
+	return &backendProber{
+		client:   &http.Client{Timeout: backendProbeTimeout},
+		interval: interval,
+		now:      time.Now,
+		probed:   probed,
+		results:  map[string]backendProbeResult{},
+		probing:  sets.NewString(),
+	}
+}
+
+// probe returns the last result of the backend, i.e. nil if it answered with an
+// APIServiceProvider, or the error why it did not. If the result is missing or older
+// than the interval, the backend is probed in the background. Found is false as long
+// as there is no result yet.
+func (p *backendProber) probe(url string) (found bool, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := p.now()
+	for u, res := range p.results {
+		if now.After(res.requested.Add(backendProbeRetention * p.interval)) {
+			delete(p.results, u)
+		}
+	}
+
+	res, found := p.results[url]
+	if found {
+		res.requested = now
+		p.results[url] = res
+	}
+	if (!found || !now.Before(res.time.Add(p.interval))) && !p.probing.Has(url) {
+		p.probing.Insert(url)
+		go p.run(url)
+	}
+	return found, res.err
+}
+
+func (p *backendProber) run(url string) {
+	ctx, cancel := context.WithTimeout(context.Background(), backendProbeTimeout)
+	defer cancel()
+	err := p.get(ctx, url)
+
+	p.lock.Lock()
+	now := p.now()
+	p.probing.Delete(url)
+	requested := now
+	if res, found := p.results[url]; found {
+		requested = res.requested
+	}
+	p.results[url] = backendProbeResult{time: now, requested: requested, err: err}
+	p.lock.Unlock()
+
+	if p.probed != nil {
+		p.probed(url)
+	}
+}
+
+func (p *backendProber) get(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	blob, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	var provider kubebindv1alpha1.APIServiceProvider
+	if err := json.Unmarshal(blob, &provider); err != nil {
+		return fmt.Errorf("invalid APIServiceProvider: %w", err)
+	}
+	return nil
+}
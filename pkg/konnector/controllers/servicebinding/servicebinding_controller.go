@@ -22,9 +22,13 @@ import (
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	apiextensionsinformers "k8s.io/apiextensions-apiserver/pkg/client/informers/externalversions/apiextensions/v1"
 	apiextensionslisters "k8s.io/apiextensions-apiserver/pkg/client/listers/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -41,6 +45,7 @@ import (
 	bindlisters "github.com/kube-bind/kube-bind/pkg/client/listers/kubebind/v1alpha1"
 	"github.com/kube-bind/kube-bind/pkg/committer"
 	"github.com/kube-bind/kube-bind/pkg/indexers"
+	"github.com/kube-bind/kube-bind/pkg/konnector/controllers/crdcleanup"
 )
 
 const (
@@ -53,6 +58,7 @@ func NewController(
 	serviceBindingInformer bindinformers.APIServiceBindingInformer,
 	consumerSecretInformer coreinformers.SecretInformer,
 	crdInformer apiextensionsinformers.CustomResourceDefinitionInformer,
+	backendProbeInterval time.Duration,
 ) (*controller, error) {
 	queue := workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerName)
 
@@ -65,10 +71,16 @@ func NewController(
 	if err != nil {
 		return nil, err
 	}
+	apiextensionsClient, err := apiextensionsclient.NewForConfig(consumerConfig)
+	if err != nil {
+		return nil, err
+	}
 
 	c := &controller{
 		queue: queue,
 
+		backendProbeInterval: backendProbeInterval,
+
 		serviceBindingLister:  serviceBindingInformer.Lister(),
 		serviceBindingIndexer: serviceBindingInformer.Informer().GetIndexer(),
 
@@ -81,6 +93,15 @@ func NewController(
 			getConsumerSecret: func(ns, name string) (*corev1.Secret, error) {
 				return consumerSecretInformer.Lister().Secrets(ns).Get(name)
 			},
+			listCRDs: func(bindingName string) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+				return crdcleanup.ListByServiceBinding(crdInformer.Informer().GetIndexer(), bindingName)
+			},
+			updateCRD: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) (*apiextensionsv1.CustomResourceDefinition, error) {
+				return apiextensionsClient.ApiextensionsV1().CustomResourceDefinitions().Update(ctx, crd, metav1.UpdateOptions{})
+			},
+			deleteCRD: func(ctx context.Context, name string) error {
+				return apiextensionsClient.ApiextensionsV1().CustomResourceDefinitions().Delete(ctx, name, metav1.DeleteOptions{})
+			},
 		},
 
 		commit: committer.NewCommitter[*kubebindv1alpha1.APIServiceBinding, *kubebindv1alpha1.APIServiceBindingSpec, *kubebindv1alpha1.APIServiceBindingStatus](
@@ -95,6 +116,10 @@ func NewController(
 		indexers.ByServiceBindingKubeconfigSecret: indexers.IndexServiceBindingByKubeconfigSecret,
 	})
 
+	indexers.AddIfNotPresentOrDie(crdInformer.Informer().GetIndexer(), cache.Indexers{
+		indexers.CRDByServiceBinding: indexers.IndexCRDByServiceBinding,
+	})
+
 	serviceBindingInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			c.enqueueServiceBinding(logger, obj)
@@ -131,6 +156,12 @@ func NewController(
 		},
 	})
 
+	if backendProbeInterval > 0 {
+		c.reconciler.probeBackend = newBackendProber(backendProbeInterval, func(url string) {
+			c.enqueueProviderURL(logger, url)
+		}).probe
+	}
+
 	return c, nil
 }
 
@@ -143,6 +174,10 @@ type CommitFunc = func(context.Context, *Resource, *Resource) error
 type controller struct {
 	queue workqueue.RateLimitingInterface
 
+	// backendProbeInterval is the interval bindings with a provider URL are requeued
+	// in to probe their backend. Zero disables probing.
+	backendProbeInterval time.Duration
+
 	serviceBindingLister  bindlisters.APIServiceBindingLister
 	serviceBindingIndexer cache.Indexer
 
@@ -167,6 +202,28 @@ func (c *controller) enqueueServiceBinding(logger klog.Logger, obj interface{})
 	c.queue.Add(key)
 }
 
+// enqueueProviderURL queues the bindings of the given provider URL, e.g. when the
+// probe of their backend has finished.
+func (c *controller) enqueueProviderURL(logger klog.Logger, url string) {
+	bindings, err := c.serviceBindingLister.List(labels.Everything())
+	if err != nil {
+		runtime.HandleError(err)
+		return
+	}
+	for _, binding := range bindings {
+		if binding.Spec.ProviderURL != url {
+			continue
+		}
+		key, err := cache.MetaNamespaceKeyFunc(binding)
+		if err != nil {
+			runtime.HandleError(err)
+			continue
+		}
+		logger.V(2).Info("queueing APIServiceBinding", "key", key, "reason", "BackendProbed")
+		c.queue.Add(key)
+	}
+}
+
 func (c *controller) enqueueConsumerSecret(logger klog.Logger, obj interface{}) {
 	secretKey, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
 	if err != nil {
@@ -278,5 +335,9 @@ func (c *controller) process(ctx context.Context, key string) error {
 		errs = append(errs, err)
 	}
 
+	if c.backendProbeInterval > 0 && obj.Spec.ProviderURL != "" && obj.DeletionTimestamp == nil {
+		c.queue.AddAfter(key, c.backendProbeInterval)
+	}
+
 	return utilerrors.NewAggregate(errs)
 }
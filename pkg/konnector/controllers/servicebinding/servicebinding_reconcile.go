@@ -20,26 +20,49 @@ import (
 	"context"
 
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/clientcmd"
 
 	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
 	conditionsapi "github.com/kube-bind/kube-bind/pkg/apis/third_party/conditions/apis/conditions/v1alpha1"
 	"github.com/kube-bind/kube-bind/pkg/apis/third_party/conditions/util/conditions"
+	"github.com/kube-bind/kube-bind/pkg/konnector/controllers/crdcleanup"
 )
 
 type reconciler struct {
 	getConsumerSecret func(ns, name string) (*corev1.Secret, error)
+
+	// probeBackend returns the last probe result of the backend at the URL, nil if it
+	// is reachable, and found false if it has not been probed yet. Nil disables the
+	// BackendReachable condition.
+	probeBackend func(url string) (found bool, err error)
+
+	listCRDs  func(bindingName string) ([]*apiextensionsv1.CustomResourceDefinition, error)
+	updateCRD func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) (*apiextensionsv1.CustomResourceDefinition, error)
+	deleteCRD func(ctx context.Context, name string) error
 }
 
 func (r *reconciler) reconcile(ctx context.Context, binding *kubebindv1alpha1.APIServiceBinding) error {
+	if binding.DeletionTimestamp != nil {
+		return r.ensureCRDsCleanedUp(ctx, binding)
+	}
+	if !sets.NewString(binding.Finalizers...).Has(kubebindv1alpha1.CRDCleanupFinalizer) {
+		// metadata and status cannot be committed together. The update triggers another reconcile.
+		binding.Finalizers = append(binding.Finalizers, kubebindv1alpha1.CRDCleanupFinalizer)
+		return nil
+	}
+
 	var errs []error
 
 	if err := r.ensureValidKubeconfigSecret(ctx, binding); err != nil {
 		errs = append(errs, err)
 	}
 
+	r.ensureBackendReachable(binding)
+
 	conditions.SetSummary(binding)
 
 	return utilerrors.NewAggregate(errs)
@@ -138,3 +161,63 @@ func (r *reconciler) ensureValidKubeconfigSecret(ctx context.Context, binding *k
 
 	return nil
 }
+
+func (r *reconciler) ensureBackendReachable(binding *kubebindv1alpha1.APIServiceBinding) {
+	if r.probeBackend == nil || binding.Spec.ProviderURL == "" {
+		conditions.Delete(binding, kubebindv1alpha1.APIServiceBindingConditionBackendReachable)
+		return
+	}
+
+	if found, err := r.probeBackend(binding.Spec.ProviderURL); !found {
+		conditions.MarkUnknown(
+			binding,
+			kubebindv1alpha1.APIServiceBindingConditionBackendReachable,
+			"Probing",
+			"Probing service provider backend %s",
+			binding.Spec.ProviderURL,
+		)
+		return
+	} else if err != nil {
+		conditions.MarkFalse(
+			binding,
+			kubebindv1alpha1.APIServiceBindingConditionBackendReachable,
+			"BackendUnreachable",
+			conditionsapi.ConditionSeverityWarning,
+			"Service provider backend %s is unreachable: %v",
+			binding.Spec.ProviderURL, err,
+		)
+		return
+	}
+
+	conditions.MarkTrue(binding, kubebindv1alpha1.APIServiceBindingConditionBackendReachable)
+}
+
+// ensureCRDsCleanedUp deletes or orphans the CustomResourceDefinitions of the deleted
+// binding according to its policy, and then removes the finalizer.
+func (r *reconciler) ensureCRDsCleanedUp(ctx context.Context, binding *kubebindv1alpha1.APIServiceBinding) error {
+	if !sets.NewString(binding.Finalizers...).Has(kubebindv1alpha1.CRDCleanupFinalizer) {
+		return nil
+	}
+
+	crds, err := r.listCRDs(binding.Name)
+	if err != nil {
+		return err
+	}
+	// no HasObjects on purpose: the Delete policy deletes the CRDs of a deleted binding
+	// together with all their objects. Only CRDs of resources removed from a binding
+	// that still exists are kept while they have objects.
+	client := crdcleanup.Client{UpdateCRD: r.updateCRD, DeleteCRD: r.deleteCRD}
+	if err := crdcleanup.CleanUp(ctx, client, binding, crds); err != nil {
+		return err
+	}
+
+	var finalizers []string
+	for _, f := range binding.Finalizers {
+		if f != kubebindv1alpha1.CRDCleanupFinalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	binding.Finalizers = finalizers
+
+	return nil
+}
@@ -0,0 +1,236 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package servicebinding
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+	"github.com/kube-bind/kube-bind/pkg/apis/third_party/conditions/util/conditions"
+)
+
+func bindingOwnerReference(name string) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: kubebindv1alpha1.SchemeGroupVersion.String(),
+		Kind:       "APIServiceBinding",
+		Name:       name,
+	}
+}
+
+func TestReconcileAddsFinalizer(t *testing.T) {
+	r := &reconciler{}
+	binding := &kubebindv1alpha1.APIServiceBinding{ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"}}
+
+	require.NoError(t, r.reconcile(context.Background(), binding))
+	require.Equal(t, []string{kubebindv1alpha1.CRDCleanupFinalizer}, binding.Finalizers)
+	require.Empty(t, binding.Status.Conditions, "status must not change together with the finalizer")
+}
+
+func TestEnsureCRDsCleanedUp(t *testing.T) {
+	podOwner := metav1.OwnerReference{APIVersion: "v1", Kind: "Pod", Name: "operator"}
+
+	tests := []struct {
+		name       string
+		policy     kubebindv1alpha1.CRDDeletionPolicy
+		owners     []metav1.OwnerReference
+		deleteErr  error
+		wantDelete bool
+		wantOwners []metav1.OwnerReference
+		wantErr    bool
+	}{
+		{name: "default deletes", owners: []metav1.OwnerReference{bindingOwnerReference("mangodbs.mangodb.com")}, wantDelete: true},
+		{name: "delete", policy: kubebindv1alpha1.CRDDeletionPolicyDelete, owners: []metav1.OwnerReference{bindingOwnerReference("mangodbs.mangodb.com")}, wantDelete: true},
+		{name: "delete keeps shared", policy: kubebindv1alpha1.CRDDeletionPolicyDelete, owners: []metav1.OwnerReference{bindingOwnerReference("mangodbs.mangodb.com"), bindingOwnerReference("other")}, wantOwners: []metav1.OwnerReference{bindingOwnerReference("other")}},
+		{name: "delete fails", policy: kubebindv1alpha1.CRDDeletionPolicyDelete, owners: []metav1.OwnerReference{bindingOwnerReference("mangodbs.mangodb.com")}, deleteErr: errors.New("boom"), wantDelete: true, wantErr: true},
+		{name: "orphan", policy: kubebindv1alpha1.CRDDeletionPolicyOrphan, owners: []metav1.OwnerReference{podOwner, bindingOwnerReference("mangodbs.mangodb.com")}, wantOwners: []metav1.OwnerReference{podOwner}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crd := &apiextensionsv1.CustomResourceDefinition{
+				ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com", OwnerReferences: tt.owners},
+			}
+			var deleted bool
+			var updated *apiextensionsv1.CustomResourceDefinition
+			r := &reconciler{
+				listCRDs: func(bindingName string) ([]*apiextensionsv1.CustomResourceDefinition, error) {
+					require.Equal(t, "mangodbs.mangodb.com", bindingName)
+					return []*apiextensionsv1.CustomResourceDefinition{crd}, nil
+				},
+				deleteCRD: func(ctx context.Context, name string) error {
+					require.Equal(t, crd.Name, name)
+					deleted = true
+					return tt.deleteErr
+				},
+				updateCRD: func(ctx context.Context, crd *apiextensionsv1.CustomResourceDefinition) (*apiextensionsv1.CustomResourceDefinition, error) {
+					updated = crd
+					return crd, nil
+				},
+			}
+
+			now := metav1.Now()
+			binding := &kubebindv1alpha1.APIServiceBinding{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "mangodbs.mangodb.com",
+					DeletionTimestamp: &now,
+					Finalizers:        []string{"other", kubebindv1alpha1.CRDCleanupFinalizer},
+				},
+				Spec: kubebindv1alpha1.APIServiceBindingSpec{CRDDeletionPolicy: tt.policy},
+			}
+			err := r.reconcile(context.Background(), binding)
+
+			require.Equal(t, tt.wantDelete, deleted)
+			if tt.wantOwners != nil {
+				require.NotNil(t, updated)
+				require.Equal(t, tt.wantOwners, updated.OwnerReferences)
+			} else {
+				require.Nil(t, updated)
+			}
+			if tt.wantErr {
+				require.Error(t, err)
+				require.Contains(t, binding.Finalizers, kubebindv1alpha1.CRDCleanupFinalizer, "finalizer must stay until the CRDs are cleaned up")
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, []string{"other"}, binding.Finalizers)
+			}
+		})
+	}
+}
+
+func TestEnsureBackendReachable(t *testing.T) {
+	reachable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/export", r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"apiVersion":"kube-bind.io/v1alpha1","kind":"APIServiceProvider","spec":{"authenticatedClientURL":"http://mangodb.com/authorize"}}`)) // nolint: errcheck
+	}))
+	defer reachable.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "maintenance", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	tests := []struct {
+		name        string
+		url         string
+		wantStatus  corev1.ConditionStatus
+		wantMessage string
+	}{
+		{name: "reachable", url: reachable.URL + "/export", wantStatus: corev1.ConditionTrue},
+		{name: "error status", url: failing.URL + "/export", wantStatus: corev1.ConditionFalse, wantMessage: "unexpected status 503"},
+		{name: "unreachable", url: down.URL + "/export", wantStatus: corev1.ConditionFalse, wantMessage: "connection refused"},
+		{name: "no provider URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probed := make(chan string, 1)
+			r := &reconciler{probeBackend: newBackendProber(time.Minute, func(url string) { probed <- url }).probe}
+			binding := &kubebindv1alpha1.APIServiceBinding{
+				ObjectMeta: metav1.ObjectMeta{Name: "mangodbs.mangodb.com"},
+				Spec:       kubebindv1alpha1.APIServiceBindingSpec{ProviderURL: tt.url},
+			}
+
+			r.ensureBackendReachable(binding)
+
+			cond := conditions.Get(binding, kubebindv1alpha1.APIServiceBindingConditionBackendReachable)
+			if tt.url == "" {
+				require.Nil(t, cond)
+				return
+			}
+			require.NotNil(t, cond)
+			require.Equal(t, corev1.ConditionUnknown, cond.Status, "the probe runs in the background")
+
+			require.Equal(t, tt.url, <-probed)
+			r.ensureBackendReachable(binding)
+
+			cond = conditions.Get(binding, kubebindv1alpha1.APIServiceBindingConditionBackendReachable)
+			require.NotNil(t, cond)
+			require.Equal(t, tt.wantStatus, cond.Status)
+			require.Contains(t, cond.Message, tt.wantMessage)
+		})
+	}
+}
+
+func TestBackendProberCachesResult(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`{}`)) // nolint: errcheck
+	}))
+	defer server.Close()
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`)) // nolint: errcheck
+	}))
+	defer other.Close()
+
+	var lock sync.Mutex
+	now := time.Now()
+	probed := make(chan string, 1)
+	p := newBackendProber(time.Minute, func(url string) { probed <- url })
+	p.now = func() time.Time {
+		lock.Lock()
+		defer lock.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		lock.Lock()
+		defer lock.Unlock()
+		now = now.Add(d)
+	}
+
+	found, _ := p.probe(server.URL)
+	require.False(t, found, "no result before the first probe")
+	found, _ = p.probe(server.URL)
+	require.False(t, found)
+	require.Equal(t, server.URL, <-probed)
+
+	found, err := p.probe(server.URL)
+	require.True(t, found)
+	require.NoError(t, err)
+	require.Equal(t, int32(1), atomic.LoadInt32(&requests), "the probe in flight is not repeated")
+
+	// older results are returned while probing again.
+	advance(time.Minute)
+	found, err = p.probe(server.URL)
+	require.True(t, found)
+	require.NoError(t, err)
+	require.Equal(t, server.URL, <-probed)
+	require.Equal(t, int32(2), atomic.LoadInt32(&requests))
+
+	// results not asked for anymore are pruned.
+	advance(backendProbeRetention*time.Minute + time.Second)
+	found, _ = p.probe(other.URL)
+	require.False(t, found)
+	require.Equal(t, other.URL, <-probed)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	require.NotContains(t, p.results, server.URL)
+	require.Contains(t, p.results, other.URL)
+}
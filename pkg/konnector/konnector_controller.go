@@ -53,6 +53,9 @@ const (
 // New returns a konnector controller.
 func New(
 	consumerConfig *rest.Config,
+	reconnectBackoff cluster.Backoff,
+	forbiddenGroups []string,
+	backendProbeInterval time.Duration,
 	serviceBindingInformer bindinformers.APIServiceBindingInformer,
 	secretInformer coreinformers.SecretInformer,
 	namespaceInformer coreinformers.NamespaceInformer,
@@ -70,7 +73,7 @@ func New(
 		return nil, err
 	}
 
-	servicebindingCtrl, err := servicebinding.NewController(consumerConfig, serviceBindingInformer, secretInformer, crdInformer)
+	servicebindingCtrl, err := servicebinding.NewController(consumerConfig, serviceBindingInformer, secretInformer, crdInformer, backendProbeInterval)
 	if err != nil {
 		return nil, err
 	}
@@ -106,6 +109,8 @@ func New(
 					providerNamespace,
 					consumerConfig,
 					providerConfig,
+					reconnectBackoff,
+					forbiddenGroups,
 					namespaceDynamicInformer,
 					serviceBindingDynamicInformer,
 					crdDynamicInformer,
@@ -293,7 +298,7 @@ func (c *Controller) process(ctx context.Context, key string) error {
 	if err != nil && !errors.IsNotFound(err) {
 		return err
 	} else if errors.IsNotFound(err) {
-		// update remote condition
+		c.release(ctx, name)
 		return nil
 	}
 
@@ -42,7 +42,11 @@ type reconciler struct {
 	getSecret            func(ns, name string) (*corev1.Secret, error)
 }
 
+// controllerContext is a running cluster Controller. There is one per provider
+// credential, i.e. per kubeconfig secret and its content, such that bindings of
+// different providers never share informers, clients or queues.
 type controllerContext struct {
+	secretRefKey    string
 	kubeconfig      string
 	cancel          func()
 	serviceBindings sets.String // when this is empty, the Controller should be stopped by closing the context
@@ -63,18 +67,16 @@ func (r *reconciler) reconcile(ctx context.Context, binding *kubebindv1alpha1.AP
 		kubeconfig = string(secret.Data[ref.Key])
 	}
 
+	secretRefKey := ref.Namespace + "/" + ref.Name
+
 	r.lock.Lock()
 	defer r.lock.Unlock()
 	ctrlContext, found := r.controllers[binding.Name]
 
-	// stop existing with old kubeconfig
-	if found && ctrlContext.kubeconfig != kubeconfig {
-		logger.V(2).Info("stopping Controller with old kubeconfig", "secret", ref.Namespace+"/"+ref.Name)
-		ctrlContext.serviceBindings.Delete(binding.Name)
-		if len(ctrlContext.serviceBindings) == 0 {
-			ctrlContext.cancel()
-		}
-		delete(r.controllers, binding.Name)
+	// stop existing with old kubeconfig or secret
+	if found && (ctrlContext.kubeconfig != kubeconfig || ctrlContext.secretRefKey != secretRefKey) {
+		logger.V(2).Info("stopping Controller with old kubeconfig", "secret", ctrlContext.secretRefKey)
+		r.releaseLocked(binding.Name)
 	}
 
 	// no need to start a new one
@@ -82,9 +84,10 @@ func (r *reconciler) reconcile(ctx context.Context, binding *kubebindv1alpha1.AP
 		return nil
 	}
 
-	// find existing with new kubeconfig
+	// find existing with new kubeconfig. The secret must match too, as the cluster
+	// Controller only serves the bindings of the secret it was started for.
 	for _, ctrlContext := range r.controllers {
-		if ctrlContext.kubeconfig == kubeconfig {
+		if ctrlContext.secretRefKey == secretRefKey && ctrlContext.kubeconfig == kubeconfig {
 			// add to it
 			logger.V(2).Info("adding to existing Controller", "secret", ref.Namespace+"/"+ref.Name)
 			r.controllers[binding.Name] = ctrlContext
@@ -118,7 +121,7 @@ func (r *reconciler) reconcile(ctx context.Context, binding *kubebindv1alpha1.AP
 	// create new because there is none yet for this kubeconfig
 	logger.V(2).Info("starting new Controller", "secret", ref.Namespace+"/"+ref.Name)
 	ctrl, err := r.newClusterController(
-		binding.Spec.KubeconfigSecretRef.Namespace+"/"+binding.Spec.KubeconfigSecretRef.Name,
+		secretRefKey,
 		providerNamespace,
 		providerConfig,
 	)
@@ -129,6 +132,7 @@ func (r *reconciler) reconcile(ctx context.Context, binding *kubebindv1alpha1.AP
 
 	ctrlCtx, cancel := context.WithCancel(ctx)
 	r.controllers[binding.Name] = &controllerContext{
+		secretRefKey:    secretRefKey,
 		kubeconfig:      kubeconfig,
 		cancel:          cancel,
 		serviceBindings: sets.NewString(binding.Name),
@@ -137,3 +141,28 @@ func (r *reconciler) reconcile(ctx context.Context, binding *kubebindv1alpha1.AP
 
 	return nil
 }
+
+// release removes the binding from its cluster Controller, e.g. when the binding
+// is deleted. The Controller is stopped when it serves no binding anymore.
+func (r *reconciler) release(ctx context.Context, name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if ctrlContext, found := r.controllers[name]; found {
+		klog.FromContext(ctx).V(2).Info("releasing Controller of deleted APIServiceBinding", "secret", ctrlContext.secretRefKey)
+		r.releaseLocked(name)
+	}
+}
+
+// releaseLocked is release with r.lock held.
+func (r *reconciler) releaseLocked(name string) {
+	ctrlContext, found := r.controllers[name]
+	if !found {
+		return
+	}
+	ctrlContext.serviceBindings.Delete(name)
+	if len(ctrlContext.serviceBindings) == 0 {
+		ctrlContext.cancel()
+	}
+	delete(r.controllers, name)
+}
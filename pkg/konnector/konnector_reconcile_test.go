@@ -0,0 +1,157 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package konnector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+)
+
+type fakeClusterController struct {
+	secretRefKey      string
+	providerNamespace string
+	host              string
+	ctx               chan context.Context
+}
+
+func (c *fakeClusterController) Start(ctx context.Context) {
+	c.ctx <- ctx
+}
+
+// started returns the context the controller was started with.
+func (c *fakeClusterController) started(t *testing.T) context.Context {
+	t.Helper()
+	return <-c.ctx
+}
+
+func newTestKubeconfig(t *testing.T, host, namespace string) string {
+	t.Helper()
+	bs, err := clientcmd.Write(clientcmdapi.Config{
+		Clusters:       map[string]*clientcmdapi.Cluster{"provider": {Server: host}},
+		AuthInfos:      map[string]*clientcmdapi.AuthInfo{"provider": {Token: "token-" + namespace}},
+		Contexts:       map[string]*clientcmdapi.Context{"default": {Cluster: "provider", AuthInfo: "provider", Namespace: namespace}},
+		CurrentContext: "default",
+	})
+	require.NoError(t, err)
+	return string(bs)
+}
+
+func newTestBinding(name, secretNamespace, secretName string) *kubebindv1alpha1.APIServiceBinding {
+	return &kubebindv1alpha1.APIServiceBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: kubebindv1alpha1.APIServiceBindingSpec{
+			KubeconfigSecretRef: kubebindv1alpha1.ClusterSecretKeyRef{
+				LocalSecretKeyRef: kubebindv1alpha1.LocalSecretKeyRef{Name: secretName, Key: "kubeconfig"},
+				Namespace:         secretNamespace,
+			},
+		},
+	}
+}
+
+func TestReconcileMultipleProviders(t *testing.T) {
+	secrets := map[string]string{
+		"kube-bind/provider-a": newTestKubeconfig(t, "https://a.example.com", "kube-bind-a"),
+		"kube-bind/provider-b": newTestKubeconfig(t, "https://b.example.com", "kube-bind-b"),
+		// same credentials as provider-a, but another secret.
+		"kube-bind/provider-c": newTestKubeconfig(t, "https://a.example.com", "kube-bind-a"),
+	}
+	var started []*fakeClusterController
+	r := &reconciler{
+		controllers: map[string]*controllerContext{},
+		getSecret: func(ns, name string) (*corev1.Secret, error) {
+			kfg, ok := secrets[ns+"/"+name]
+			if !ok {
+				return nil, errors.NewNotFound(schema.GroupResource{Resource: "secrets"}, name)
+			}
+			return &corev1.Secret{Data: map[string][]byte{"kubeconfig": []byte(kfg)}}, nil
+		},
+		newClusterController: func(consumerSecretRefKey, providerNamespace string, providerConfig *rest.Config) (startable, error) {
+			ctrl := &fakeClusterController{
+				secretRefKey:      consumerSecretRefKey,
+				providerNamespace: providerNamespace,
+				host:              providerConfig.Host,
+				ctx:               make(chan context.Context, 1),
+			}
+			started = append(started, ctrl)
+			return ctrl, nil
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// two bindings per provider share the controller of their provider.
+	for _, b := range []*kubebindv1alpha1.APIServiceBinding{
+		newTestBinding("foos.a", "kube-bind", "provider-a"),
+		newTestBinding("bars.a", "kube-bind", "provider-a"),
+		newTestBinding("foos.b", "kube-bind", "provider-b"),
+		newTestBinding("bars.b", "kube-bind", "provider-b"),
+	} {
+		require.NoError(t, r.reconcile(ctx, b))
+	}
+	require.Len(t, started, 2)
+	a, b := started[0], started[1]
+	require.Equal(t, "kube-bind/provider-a", a.secretRefKey)
+	require.Equal(t, "kube-bind-a", a.providerNamespace)
+	require.Equal(t, "https://a.example.com", a.host)
+	require.Equal(t, "kube-bind/provider-b", b.secretRefKey)
+	require.Equal(t, "kube-bind-b", b.providerNamespace)
+	require.Equal(t, "https://b.example.com", b.host)
+	aCtx, bCtx := a.started(t), b.started(t)
+	require.Equal(t, r.controllers["foos.a"], r.controllers["bars.a"])
+	require.Equal(t, r.controllers["foos.b"], r.controllers["bars.b"])
+
+	// identical credentials in another secret get their own controller, as a cluster
+	// controller only serves the bindings of its secret.
+	require.NoError(t, r.reconcile(ctx, newTestBinding("foos.c", "kube-bind", "provider-c")))
+	require.Len(t, started, 3)
+	c := started[2]
+	require.Equal(t, "kube-bind/provider-c", c.secretRefKey)
+	cCtx := c.started(t)
+
+	// deleting the bindings of provider a stops its controller only.
+	r.release(ctx, "foos.a")
+	require.NoError(t, aCtx.Err(), "controller must run while it serves a binding")
+	r.release(ctx, "bars.a")
+	require.Error(t, aCtx.Err())
+	require.NoError(t, bCtx.Err())
+	require.NoError(t, cCtx.Err())
+
+	// rotating the credentials of provider b restarts its controller only.
+	secrets["kube-bind/provider-b"] = newTestKubeconfig(t, "https://b2.example.com", "kube-bind-b")
+	require.NoError(t, r.reconcile(ctx, newTestBinding("foos.b", "kube-bind", "provider-b")))
+	require.NoError(t, bCtx.Err(), "controller must run while it serves bars.b")
+	require.NoError(t, r.reconcile(ctx, newTestBinding("bars.b", "kube-bind", "provider-b")))
+	require.Error(t, bCtx.Err())
+	require.Len(t, started, 4)
+	b2 := started[3]
+	require.Equal(t, "https://b2.example.com", b2.host)
+	b2.started(t)
+	require.Equal(t, r.controllers["foos.b"], r.controllers["bars.b"])
+	require.NoError(t, cCtx.Err())
+}
@@ -20,11 +20,14 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"time"
 
 	"github.com/spf13/pflag"
 
 	"k8s.io/component-base/logs"
 	logsv1 "k8s.io/component-base/logs/api/v1"
+
+	kubebindhelpers "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1/helpers"
 )
 
 type Options struct {
@@ -39,6 +42,15 @@ type ExtraOptions struct {
 	LeaseLockName      string
 	LeaseLockNamespace string
 	LeaseLockIdentity  string
+
+	ReconnectInitialDelay  time.Duration
+	ReconnectMaxDelay      time.Duration
+	ReconnectBackoffFactor float64
+	ReconnectJitter        float64
+
+	ForbiddenGroups []string
+
+	BackendProbeInterval time.Duration
 }
 
 type completedOptions struct {
@@ -63,6 +75,15 @@ func NewOptions() *Options {
 			LeaseLockName:      "kube-bind",
 			LeaseLockNamespace: os.Getenv("POD_NAMESPACE"),
 			LeaseLockIdentity:  os.Getenv("POD_NAME"),
+
+			ReconnectInitialDelay:  5 * time.Second,
+			ReconnectMaxDelay:      5 * time.Minute,
+			ReconnectBackoffFactor: 2.0,
+			ReconnectJitter:        0.2,
+
+			ForbiddenGroups: kubebindhelpers.DefaultForbiddenGroups,
+
+			BackendProbeInterval: time.Minute,
 		},
 	}
 
@@ -79,6 +100,13 @@ func (options *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&options.KubeConfigPath, "kubeconfig", options.KubeConfigPath, "Kubeconfig file for the local cluster.")
 	fs.StringVar(&options.LeaseLockName, "lease-name", options.LeaseLockName, "Name of lease lock")
 	fs.StringVar(&options.LeaseLockNamespace, "lease-namespace", options.LeaseLockNamespace, "Name of lease lock namespace")
+
+	fs.DurationVar(&options.ReconnectInitialDelay, "reconnect-initial-delay", options.ReconnectInitialDelay, "Delay of further requests to a provider cluster after a failed connect.")
+	fs.DurationVar(&options.ReconnectMaxDelay, "reconnect-max-delay", options.ReconnectMaxDelay, "Maximum delay of requests to a provider cluster after repeatedly failed connects, before jitter.")
+	fs.Float64Var(&options.ReconnectBackoffFactor, "reconnect-backoff-factor", options.ReconnectBackoffFactor, "Factor the delay of requests is multiplied with after each further failed connect to a provider cluster. A successful request resets the delay.")
+	fs.Float64Var(&options.ReconnectJitter, "reconnect-jitter", options.ReconnectJitter, "Maximum fraction of the delay added randomly to spread reconnects.")
+	fs.StringSliceVar(&options.ForbiddenGroups, "forbidden-groups", options.ForbiddenGroups, "API groups that are never bound from a service provider. A leading '*.' matches all subdomains.")
+	fs.DurationVar(&options.BackendProbeInterval, "backend-probe-interval", options.BackendProbeInterval, "Interval of probing the /export endpoint of the service provider backend of each APIServiceBinding for the BackendReachable condition. Zero disables probing.")
 }
 
 func (options *Options) Complete() (*CompletedOptions, error) {
@@ -95,5 +123,24 @@ func (options *Options) Complete() (*CompletedOptions, error) {
 }
 
 func (options *CompletedOptions) Validate() error {
+	if options.ReconnectInitialDelay <= 0 {
+		return fmt.Errorf("--reconnect-initial-delay must be positive")
+	}
+	if options.ReconnectMaxDelay < options.ReconnectInitialDelay {
+		return fmt.Errorf("--reconnect-max-delay must not be smaller than --reconnect-initial-delay")
+	}
+	if options.ReconnectBackoffFactor < 1.0 {
+		return fmt.Errorf("--reconnect-backoff-factor must be at least 1.0")
+	}
+	if options.ReconnectJitter < 0 || options.ReconnectJitter > 1.0 {
+		return fmt.Errorf("--reconnect-jitter must be between 0.0 and 1.0")
+	}
+	if err := kubebindhelpers.ValidateGroupPatterns(options.ForbiddenGroups); err != nil {
+		return fmt.Errorf("invalid --forbidden-groups: %w", err)
+	}
+	if options.BackendProbeInterval < 0 {
+		return fmt.Errorf("--backend-probe-interval must not be negative")
+	}
+
 	return nil
 }
@@ -25,6 +25,7 @@ import (
 
 	"github.com/kube-bind/kube-bind/deploy/crd"
 	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+	"github.com/kube-bind/kube-bind/pkg/konnector/controllers/cluster"
 )
 
 type Server struct {
@@ -36,6 +37,14 @@ func NewServer(config *Config) (*Server, error) {
 	// construct controllers
 	k, err := New(
 		config.ClientConfig,
+		cluster.Backoff{
+			Initial: config.Options.ReconnectInitialDelay,
+			Max:     config.Options.ReconnectMaxDelay,
+			Factor:  config.Options.ReconnectBackoffFactor,
+			Jitter:  config.Options.ReconnectJitter,
+		},
+		config.Options.ForbiddenGroups,
+		config.Options.BackendProbeInterval,
 		config.BindInformers.KubeBind().V1alpha1().APIServiceBindings(),
 		config.KubeInformers.Core().V1().Secrets(), // TODO(sttts): watch individual secrets for security and memory consumption
 		config.KubeInformers.Core().V1().Namespaces(),
@@ -58,6 +58,14 @@ type BindOptions struct {
 
 	// skipKonnector skips the deployment of the konnector.
 	SkipKonnector bool
+
+	// RequireSignedAuthResponse rejects service providers that do not sign their
+	// auth responses, e.g. because their advertised keys were stripped on the way.
+	RequireSignedAuthResponse bool
+
+	// ProviderScoped binds the resources with API groups suffixed by the provider host,
+	// such that resources of the same name from different providers do not conflict.
+	ProviderScoped bool
 }
 
 // NewBindOptions returns new BindOptions.
@@ -72,6 +80,8 @@ func (b *BindOptions) AddCmdFlags(cmd *cobra.Command) {
 	b.Options.BindFlags(cmd)
 
 	cmd.Flags().BoolVar(&b.SkipKonnector, "skip-konnector", false, "Skip the deployment of the konnector")
+	cmd.Flags().BoolVar(&b.RequireSignedAuthResponse, "require-signed-auth-response", false, "Refuse to bind if the service provider does not advertise keys to verify its auth responses with")
+	cmd.Flags().BoolVar(&b.ProviderScoped, "provider-scoped", false, "Suffix the API groups of the bound resources with the host of the service provider, e.g. mangodbs.mangodb.com.provider.example.com, to bind resources of the same name from different service providers")
 }
 
 // Complete ensures all fields are initialized.
@@ -120,15 +130,6 @@ func (b *BindOptions) Run(ctx context.Context, urlCh chan<- string) error {
 		return err
 	}
 
-	var response *backendresources.AuthResponse
-	auth, err := authenticator.NewDefaultAuthenticator(10*time.Minute, func(ctx context.Context, resp *backendresources.AuthResponse) error {
-		response = resp
-		return nil
-	})
-	if err != nil {
-		return err
-	}
-
 	exportURL, err := url.Parse(b.URL)
 	if err != nil {
 		return err // should never happen because we test this in Validate()
@@ -138,6 +139,32 @@ func (b *BindOptions) Run(ctx context.Context, urlCh chan<- string) error {
 	if err != nil {
 		return fmt.Errorf("failed to fetch authentication url %q: %v", exportURL, err)
 	}
+	providerIdentity, err := resources.ProviderIdentity(provider)
+	if err != nil {
+		return err
+	}
+	var groupSuffix string
+	if b.ProviderScoped {
+		if groupSuffix, err = resources.ProviderGroupSuffix(providerIdentity); err != nil {
+			return err
+		}
+	}
+	publicKeys, err := authenticator.ProviderPublicKeys(&provider.Spec)
+	if err != nil {
+		return err
+	}
+	if len(publicKeys) == 0 && b.RequireSignedAuthResponse {
+		return fmt.Errorf("service provider %q does not sign its auth responses, but --require-signed-auth-response is set", exportURL)
+	}
+
+	var response *backendresources.AuthResponse
+	auth, err := authenticator.NewDefaultAuthenticator(10*time.Minute, exportURL, publicKeys, func(ctx context.Context, resp *backendresources.AuthResponse) error {
+		response = resp
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
 	sessionID := rand.String(rand.IntnRange(20, 30))
 
@@ -196,31 +223,31 @@ func (b *BindOptions) Run(ctx context.Context, urlCh chan<- string) error {
 		fmt.Fprintf(b.IOStreams.Out, "Created kube-binding namespace.\n") // nolint: errcheck
 	}
 
-	// look for secret of the given identity
+	// look for secret of the given identity. Cluster ids of different providers may overlap.
 	secrets, err := kubeClient.CoreV1().Secrets("kube-bind").List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return err
 	}
-	var secretName string
-	for _, s := range secrets.Items {
-		if s.Annotations[resources.ClusterIDAnnotationKey] == response.ID {
-			secretName = s.Name
-			break
-		}
+	secretName := resources.FindServiceBindingAuthData(secrets.Items, providerIdentity, response.ID)
+
+	// the binding and its CRD are named after the suffixed group if provider scoped.
+	name := response.Resource + "." + response.Group
+	if groupSuffix != "" {
+		name += "." + groupSuffix
 	}
 
 	// check for existing CRD
-	crd, err := apiextensionsClient.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, response.Resource+"."+response.Group, metav1.GetOptions{})
+	crd, err := apiextensionsClient.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, name, metav1.GetOptions{})
 	if err != nil && !apierrors.IsNotFound(err) {
 		return err
 	}
 	if secretName == "" {
 		if err == nil {
-			return fmt.Errorf("CRD %s.%s already exists and is not from this service provider", response.Resource, response.Group)
+			return fmt.Errorf("CRD %s already exists and is not from this service provider", name)
 		}
 
 		fmt.Fprintf(b.IOStreams.Out, "Creating secret for identity %s\n", response.ID) // nolint: errcheck
-		secretName, err = resources.EnsureServiceBindingAuthData(ctx, string(response.Kubeconfig), response.ID, "kube-bind", "", kubeClient)
+		secretName, err = resources.EnsureServiceBindingAuthData(ctx, string(response.Kubeconfig), providerIdentity, response.ID, "kube-bind", "", kubeClient)
 		if err != nil {
 			return err
 		}
@@ -243,14 +270,16 @@ func (b *BindOptions) Run(ctx context.Context, urlCh chan<- string) error {
 
 			if existing.Spec.KubeconfigSecretRef.Namespace == "kube-bind" && existing.Spec.KubeconfigSecretRef.Name == secretName {
 				fmt.Fprintf(b.IOStreams.Out, "Updating credentials for existing APIServiceBinding %s\n", existing.Name) // nolint: errcheck
-				_, err = resources.EnsureServiceBindingAuthData(ctx, string(response.Kubeconfig), response.ID, "kube-bind", secretName, kubeClient)
-				return err
+				if _, err = resources.EnsureServiceBindingAuthData(ctx, string(response.Kubeconfig), providerIdentity, response.ID, "kube-bind", secretName, kubeClient); err != nil {
+					return err
+				}
+				return ensureProviderURL(ctx, bindClient, existing, exportURL.String())
 			}
 		}
 		return fmt.Errorf("found existing CustomResourceDefinition %s not from this service provider", response.ID)
 	} else {
 		fmt.Fprintf(b.IOStreams.Out, "Updating credentials\n") // noilnt: errcheck
-		secretName, err = resources.EnsureServiceBindingAuthData(ctx, string(response.Kubeconfig), response.ID, "kube-bind", secretName, kubeClient)
+		secretName, err = resources.EnsureServiceBindingAuthData(ctx, string(response.Kubeconfig), providerIdentity, response.ID, "kube-bind", secretName, kubeClient)
 		if err != nil {
 			return err
 		}
@@ -265,7 +294,7 @@ func (b *BindOptions) Run(ctx context.Context, urlCh chan<- string) error {
 		}
 		_, err := bindClient.KubeBindV1alpha1().APIServiceBindings().Create(ctx, &kubebindv1alpha1.APIServiceBinding{
 			ObjectMeta: metav1.ObjectMeta{
-				Name:      response.Resource + "." + response.Group,
+				Name:      name,
 				Namespace: "kube-bind",
 			},
 			Spec: kubebindv1alpha1.APIServiceBindingSpec{
@@ -276,20 +305,25 @@ func (b *BindOptions) Run(ctx context.Context, urlCh chan<- string) error {
 					},
 					Namespace: "kube-bind",
 				},
-				Export: response.Export,
+				Export:              response.Export,
+				ProviderURL:         exportURL.String(),
+				ConsumerGroupSuffix: groupSuffix,
 			},
 		}, metav1.CreateOptions{})
 		if err != nil && !apierrors.IsAlreadyExists(err) {
 			return false, err
 		} else if apierrors.IsAlreadyExists(err) {
-			existing, err := bindClient.KubeBindV1alpha1().APIServiceBindings().Get(ctx, response.Resource+"."+response.Group, metav1.GetOptions{})
+			existing, err := bindClient.KubeBindV1alpha1().APIServiceBindings().Get(ctx, name, metav1.GetOptions{})
 			if err != nil {
 				return false, nil
 			}
 			if existing.Spec.KubeconfigSecretRef.Namespace == "kube-bind" && existing.Spec.KubeconfigSecretRef.Name == secretName {
+				if err := ensureProviderURL(ctx, bindClient, existing, exportURL.String()); err != nil {
+					return false, err
+				}
 				return true, nil
 			}
-			return false, fmt.Errorf("APIServiceBinding %s.%s already exists, but from different provider", response.Resource, response.Group)
+			return false, fmt.Errorf("APIServiceBinding %s already exists, but from different provider", name)
 		}
 
 		return true, nil
@@ -297,7 +331,19 @@ func (b *BindOptions) Run(ctx context.Context, urlCh chan<- string) error {
 		fmt.Fprintln(b.IOStreams.Out, "") // nolint: errcheck
 		return err
 	}
-	fmt.Fprintf(b.IOStreams.Out, "\nCreated APIServiceBinding %s.%s\n", response.Resource, response.Group) // nolint: errcheck
+	fmt.Fprintf(b.IOStreams.Out, "\nCreated APIServiceBinding %s\n", name) // nolint: errcheck
 
 	return nil
 }
+
+// ensureProviderURL updates the provider URL of an existing binding, e.g. when the
+// backend is reached under another URL than when it was bound.
+func ensureProviderURL(ctx context.Context, bindClient bindclient.Interface, binding *kubebindv1alpha1.APIServiceBinding, url string) error {
+	if binding.Spec.ProviderURL == url {
+		return nil
+	}
+	binding = binding.DeepCopy()
+	binding.Spec.ProviderURL = url
+	_, err := bindClient.KubeBindV1alpha1().APIServiceBindings().Update(ctx, binding, metav1.UpdateOptions{})
+	return err
+}
@@ -19,28 +19,74 @@ package resources
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
 	kubeclient "k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/util/retry"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
 )
 
 const (
 	ClusterIDAnnotationKey = "kube-bind.io/cluster-id"
+	ProviderAnnotationKey  = "kube-bind.io/provider"
 )
 
+// ProviderIdentity returns the identity of the service provider on the consumer side,
+// i.e. the host of its authentication URL. Cluster ids are only unique per provider.
+func ProviderIdentity(provider *kubebindv1alpha1.APIServiceProvider) (string, error) {
+	u, err := url.Parse(provider.Spec.AuthenticatedClientURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse auth url: %w", err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("auth url %q has no host", provider.Spec.AuthenticatedClientURL)
+	}
+	return strings.ToLower(u.Host), nil
+}
+
+// ProviderGroupSuffix returns the consumer group suffix of the bindings of the service
+// provider of the given identity, i.e. the host with the port joined by a dash.
+func ProviderGroupSuffix(identity string) (string, error) {
+	suffix := strings.ReplaceAll(identity, ":", "-")
+	if msgs := validation.IsDNS1123Subdomain(suffix); len(msgs) > 0 {
+		return "", fmt.Errorf("cannot derive an API group suffix from provider %q: %s", identity, strings.Join(msgs, ", "))
+	}
+	return suffix, nil
+}
+
+// FindServiceBindingAuthData returns the name of the secret holding the service binding authenticated
+// data of the given provider and cluster id, or an empty string if there is none. Secrets created
+// before the provider annotation existed match any provider.
+func FindServiceBindingAuthData(secrets []corev1.Secret, provider, clusterID string) string {
+	for _, s := range secrets {
+		if s.Annotations[ClusterIDAnnotationKey] != clusterID {
+			continue
+		}
+		if p, found := s.Annotations[ProviderAnnotationKey]; found && p != provider {
+			continue
+		}
+		return s.Name
+	}
+	return ""
+}
+
 // EnsureServiceBindingAuthData create a secret which contains the service binding authenticated data such as
 // the binding session id and the kubeconfig of the service provider cluster. If it is pre-existing, the kubeconfig
 // is updated.
-func EnsureServiceBindingAuthData(ctx context.Context, kubeconfig, clusterID, ns, name string, client kubeclient.Interface) (string, error) {
+func EnsureServiceBindingAuthData(ctx context.Context, kubeconfig, provider, clusterID, ns, name string, client kubeclient.Interface) (string, error) {
 	if name == "" {
 		secret := &corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{
 				Namespace:    ns,
 				GenerateName: "kubeconfig-",
 				Annotations: map[string]string{
+					ProviderAnnotationKey:  provider,
 					ClusterIDAnnotationKey: clusterID,
 				},
 			},
@@ -69,6 +115,13 @@ func EnsureServiceBindingAuthData(ctx context.Context, kubeconfig, clusterID, ns
 		if secret.Annotations[ClusterIDAnnotationKey] != clusterID {
 			return errors.NewAlreadyExists(corev1.Resource("secret"), secret.Name)
 		}
+		if p, found := secret.Annotations[ProviderAnnotationKey]; found && p != provider {
+			return errors.NewAlreadyExists(corev1.Resource("secret"), secret.Name)
+		}
+		if secret.Annotations == nil {
+			secret.Annotations = map[string]string{}
+		}
+		secret.Annotations[ProviderAnnotationKey] = provider // adopt secrets from before the provider annotation
 		secret.Data["kubeconfig"] = []byte(kubeconfig)
 		if _, err := client.CoreV1().Secrets(ns).Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
 			return err
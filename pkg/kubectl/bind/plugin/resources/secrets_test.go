@@ -0,0 +1,123 @@
+/*
+Copyright 2022 The Kube Bind Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+
+	kubebindv1alpha1 "github.com/kube-bind/kube-bind/pkg/apis/kubebind/v1alpha1"
+)
+
+func TestProviderIdentity(t *testing.T) {
+	provider := func(u string) *kubebindv1alpha1.APIServiceProvider {
+		return &kubebindv1alpha1.APIServiceProvider{Spec: kubebindv1alpha1.APIServiceProviderSpec{AuthenticatedClientURL: u}}
+	}
+
+	id, err := ProviderIdentity(provider("http://MangoDB.com:8080/authorize"))
+	require.NoError(t, err)
+	require.Equal(t, "mangodb.com:8080", id)
+
+	_, err = ProviderIdentity(provider("/authorize"))
+	require.Error(t, err)
+}
+
+func TestProviderGroupSuffix(t *testing.T) {
+	suffix, err := ProviderGroupSuffix("mangodb.com:8080")
+	require.NoError(t, err)
+	require.Equal(t, "mangodb.com-8080", suffix)
+
+	suffix, err = ProviderGroupSuffix("mangodb.com")
+	require.NoError(t, err)
+	require.Equal(t, "mangodb.com", suffix)
+
+	_, err = ProviderGroupSuffix("[::1]:8080")
+	require.Error(t, err)
+}
+
+func TestServiceBindingAuthDataPerProvider(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	// the fake clientset does not implement generateName.
+	client.PrependReactor("create", "secrets", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		secret := action.(clienttesting.CreateAction).GetObject().(*corev1.Secret)
+		if secret.Name == "" {
+			secret.Name = secret.GenerateName + rand.String(5)
+		}
+		return false, nil, nil
+	})
+
+	list := func() []corev1.Secret {
+		t.Helper()
+		secrets, err := client.CoreV1().Secrets("kube-bind").List(ctx, metav1.ListOptions{})
+		require.NoError(t, err)
+		return secrets.Items
+	}
+
+	// both providers hand out the same cluster id for their mangodbs.mangodb.com export.
+	a, err := EnsureServiceBindingAuthData(ctx, "kubeconfig-a", "a.example.com", "cluster-abc", "kube-bind", "", client)
+	require.NoError(t, err)
+	require.Equal(t, a, FindServiceBindingAuthData(list(), "a.example.com", "cluster-abc"))
+	require.Empty(t, FindServiceBindingAuthData(list(), "b.example.com", "cluster-abc"))
+
+	b, err := EnsureServiceBindingAuthData(ctx, "kubeconfig-b", "b.example.com", "cluster-abc", "kube-bind", "", client)
+	require.NoError(t, err)
+	require.NotEqual(t, a, b)
+	require.Equal(t, a, FindServiceBindingAuthData(list(), "a.example.com", "cluster-abc"))
+	require.Equal(t, b, FindServiceBindingAuthData(list(), "b.example.com", "cluster-abc"))
+
+	// the credentials of one provider are never overwritten by the other.
+	_, err = EnsureServiceBindingAuthData(ctx, "kubeconfig-b", "b.example.com", "cluster-abc", "kube-bind", a, client)
+	require.True(t, errors.IsAlreadyExists(err), "expected AlreadyExists, got %v", err)
+	secret, err := client.CoreV1().Secrets("kube-bind").Get(ctx, a, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "kubeconfig-a", string(secret.Data["kubeconfig"]))
+}
+
+func TestServiceBindingAuthDataAdoptsLegacySecret(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "kube-bind",
+			Name:        "kubeconfig-legacy",
+			Annotations: map[string]string{ClusterIDAnnotationKey: "cluster-abc"},
+		},
+		Data: map[string][]byte{"kubeconfig": []byte("old")},
+	})
+
+	secrets, err := client.CoreV1().Secrets("kube-bind").List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	name := FindServiceBindingAuthData(secrets.Items, "a.example.com", "cluster-abc")
+	require.Equal(t, "kubeconfig-legacy", name)
+
+	_, err = EnsureServiceBindingAuthData(ctx, "new", "a.example.com", "cluster-abc", "kube-bind", name, client)
+	require.NoError(t, err)
+	secret, err := client.CoreV1().Secrets("kube-bind").Get(ctx, name, metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "a.example.com", secret.Annotations[ProviderAnnotationKey])
+	require.Equal(t, "new", string(secret.Data["kubeconfig"]))
+}